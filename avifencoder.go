@@ -0,0 +1,113 @@
+// +build avif
+
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+// Note: modify these flags for your enviornment if required.
+
+// #cgo CFLAGS: -O2
+// #cgo LDFLAGS: -lavif
+// #include <stdlib.h>
+// #include <string.h>
+// #include <avif/avif.h>
+//
+// static int encodeAvif(unsigned char *rgb, int width, int height, int quality,
+//                       unsigned char **out, size_t *outSize) {
+//     avifRWData output = AVIF_DATA_EMPTY;
+//     avifRGBImage rgbImage;
+//     avifEncoder *encoder = NULL;
+//     avifResult rc;
+//     avifImage *image = avifImageCreate(width, height, 8, AVIF_PIXEL_FORMAT_YUV420);
+//     if (image == NULL) {
+//         return -1;
+//     }
+//
+//     avifRGBImageSetDefaults(&rgbImage, image);
+//     rgbImage.format = AVIF_RGB_FORMAT_RGB;
+//     rgbImage.depth = 8;
+//     rgbImage.pixels = rgb;
+//     rgbImage.rowBytes = width * 3;
+//
+//     rc = avifImageRGBToYUV(image, &rgbImage);
+//     if (rc == AVIF_RESULT_OK) {
+//         encoder = avifEncoderCreate();
+//         if (encoder == NULL) {
+//             rc = AVIF_RESULT_OUT_OF_MEMORY;
+//         }
+//     }
+//     if (rc == AVIF_RESULT_OK) {
+//         encoder->quality = quality;
+//         rc = avifEncoderWrite(encoder, image, &output);
+//     }
+//     if (rc == AVIF_RESULT_OK) {
+//         *out = malloc(output.size);
+//         if (*out == NULL) {
+//             rc = AVIF_RESULT_OUT_OF_MEMORY;
+//         } else {
+//             memcpy(*out, output.data, output.size);
+//             *outSize = output.size;
+//         }
+//     }
+//
+//     avifRWDataFree(&output);
+//     if (encoder != NULL) {
+//         avifEncoderDestroy(encoder);
+//     }
+//     avifImageDestroy(image);
+//     return rc == AVIF_RESULT_OK ? 0 : -1;
+// }
+import "C"
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"unsafe"
+)
+
+func init() {
+	registerEncoder(OutputAvif, encodeAvif)
+}
+
+// encodeAvif encodes an image as AVIF using libavif.
+func encodeAvif(w io.Writer, img image.Image, quality int) error {
+	b := img.Bounds()
+	if b.Empty() {
+		return fmt.Errorf("error encoding AVIF: empty image")
+	}
+	pix := rgbPixels(img)
+
+	var out *C.uchar
+	var outSize C.size_t
+	rc := C.encodeAvif((*C.uchar)(unsafe.Pointer(&pix[0])), C.int(b.Dx()),
+		C.int(b.Dy()), C.int(quality), &out, &outSize)
+	if rc != 0 {
+		return fmt.Errorf("error encoding AVIF")
+	}
+	defer C.free(unsafe.Pointer(out))
+
+	_, err := w.Write(C.GoBytes(unsafe.Pointer(out), C.int(outSize)))
+	return err
+}
@@ -0,0 +1,334 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"log"
+	"slices"
+)
+
+// DNG opcode lists holding bad pixel opcodes, by tag: OpcodeList1 applies
+// to the raw image data as stored, OpcodeList2 and OpcodeList3 to the
+// ActiveArea.
+const (
+	tagOpcodeList1 = 0xc740
+	tagOpcodeList2 = 0xc741
+	tagOpcodeList3 = 0xc74e
+)
+
+// opcodeFixBadPixelsList is the ID of the DNG FixBadPixelsList opcode,
+// listing bad pixels and rectangles of bad pixels.  FixBadPixelsConstant
+// (ID 4) marks bad pixels by a raw value, lost once developed; they are
+// found as stuck pixels instead.
+const opcodeFixBadPixelsList = 5
+
+// stuckPixelThreshold is the difference, of 16-bit samples, by which a
+// sample of a stuck pixel exceeds those of all its neighbors or falls short
+// of them: 64 of 8-bit samples.
+const stuckPixelThreshold = 64 * 0x101
+
+// badPixelMap are the bad pixels of the raw image data listed by the DNG
+// FixBadPixelsList opcodes, relative to the ActiveArea.
+type badPixelMap struct {
+	points []image.Point
+	rects  []image.Rectangle
+
+	// size is the size of the ActiveArea and orientation that of the raw
+	// file, as developed by a RawDecoder.
+	size        image.Point
+	orientation Orientation
+}
+
+// readBadPixelMap reads the FixBadPixelsList opcodes of the opcode lists
+// of the IFD of the raw image data of a DNG.  Errors are not fatal as the
+// stuck pixels are found regardless.
+// Returns the bad pixels or nil if none are listed.
+func readBadPixelMap(f io.ReaderAt) *badPixelMap {
+	ifds := findRawIFDs(f)
+	if ifds == nil {
+		return nil
+	}
+	r := ifds.rawImage()
+
+	m := &badPixelMap{size: image.Pt(r.ActiveArea.Width(), r.ActiveArea.Height())}
+	if ifds.ifd0 != nil {
+		if e := ifds.ifd0.Find(0x0112); e != nil {
+			if o, err := e.Uint(); err == nil {
+				m.orientation = orientationOf(uint16(o))
+			}
+		}
+	}
+
+	for _, tag := range []uint16{tagOpcodeList1, tagOpcodeList2, tagOpcodeList3} {
+		e := ifds.raw.Find(tag)
+		if e == nil {
+			continue
+		}
+		data, err := e.Bytes()
+		if err != nil {
+			log.Printf("Error reading opcode list 0x%04x: %v\n", tag, err)
+			continue
+		}
+		var origin image.Point
+		if tag == tagOpcodeList1 {
+			origin = image.Pt(r.ActiveArea.Left, r.ActiveArea.Top)
+		}
+		m.readOpcodeList(data, origin)
+	}
+
+	if len(m.points) == 0 && len(m.rects) == 0 {
+		return nil
+	}
+	return m
+}
+
+// readOpcodeList records the bad pixels of the FixBadPixelsList opcodes of
+// a DNG opcode list, always big endian: the number of opcodes, then each
+// opcode's ID, DNG version, flags, size of its parameters, and parameters.
+// The parameters of FixBadPixelsList are the BayerPhase, the number of
+// points and of rectangles, then the points (row, column) and rectangles
+// (top, left, bottom, right).  Points are made relative to an origin.
+func (m *badPixelMap) readOpcodeList(data []byte, origin image.Point) {
+	be := binary.BigEndian
+	if len(data) < 4 {
+		return
+	}
+	count := be.Uint32(data)
+	data = data[4:]
+
+	for range count {
+		if len(data) < 16 {
+			return
+		}
+		id, size := be.Uint32(data), be.Uint32(data[12:])
+		if uint64(size) > uint64(len(data)-16) {
+			return
+		}
+		params := data[16 : 16+size]
+		data = data[16+size:]
+		if id != opcodeFixBadPixelsList || len(params) < 12 {
+			continue
+		}
+
+		points, rects := uint64(be.Uint32(params[4:])), uint64(be.Uint32(params[8:]))
+		params = params[12:]
+		if points*8+rects*16 > uint64(len(params)) {
+			log.Printf("Error reading FixBadPixelsList: %d points and %d rectangles\n", points, rects)
+			continue
+		}
+		for i := range int(points) {
+			p := params[i*8:]
+			m.points = append(m.points, image.Pt(int(be.Uint32(p[4:])), int(be.Uint32(p))).Sub(origin))
+		}
+		params = params[points*8:]
+		for i := range int(rects) {
+			p := params[i*16:]
+			rect := image.Rect(int(be.Uint32(p[4:])), int(be.Uint32(p)), int(be.Uint32(p[12:])), int(be.Uint32(p[8:])))
+			m.rects = append(m.rects, rect.Sub(origin))
+		}
+	}
+}
+
+// orient maps a pixel of the ActiveArea to the image developed from it,
+// mirrored and rotated upright per the orientation.
+func (m *badPixelMap) orient(p image.Point) image.Point {
+	degrees, mirror := m.orientation.Transform()
+	w, h := m.size.X, m.size.Y
+	if mirror {
+		p.X = w - 1 - p.X
+	}
+	switch degrees {
+	case 90:
+		return image.Pt(h-1-p.Y, p.X)
+	case 180:
+		return image.Pt(w-1-p.X, h-1-p.Y)
+	case 270:
+		return image.Pt(p.Y, w-1-p.X)
+	}
+	return p
+}
+
+// mask marks the bad pixels of an image developed from the ActiveArea.
+// Returns the mask, row by row; nil if the image is not of the size of the
+// ActiveArea, as the pixels cannot be mapped.
+func (m *badPixelMap) mask(b image.Rectangle) []bool {
+	size := m.size
+	if degrees, _ := m.orientation.Transform(); degrees == 90 || degrees == 270 {
+		size.X, size.Y = size.Y, size.X
+	}
+	if b.Size() != size {
+		log.Printf("Bad pixels of a %dx%d area not mapped to the %dx%d image\n", m.size.X, m.size.Y, b.Dx(), b.Dy())
+		return nil
+	}
+
+	bad := make([]bool, size.X*size.Y)
+	mark := func(p image.Point) {
+		p = m.orient(p)
+		if p.In(image.Rectangle{Max: size}) {
+			bad[p.Y*size.X+p.X] = true
+		}
+	}
+	for _, p := range m.points {
+		mark(p)
+	}
+	for _, r := range m.rects {
+		r = r.Intersect(image.Rectangle{Max: m.size})
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				mark(image.Pt(x, y))
+			}
+		}
+	}
+	return bad
+}
+
+// correctBadPixels corrects the bad pixels of an image developed by a
+// RawDecoder: those of the DNG bad pixel map of the raw file, if any, and
+// stuck pixels.  Errors reading the raw file are not fatal.
+// Returns the corrected image, of the bit depth of the image.
+func correctBadPixels(img image.Image, info *RawFileInfo) image.Image {
+	var bad []bool
+	if f, err := openRawFile(info); err != nil {
+		log.Printf("Error reading bad pixels of '%s': %v\n", info.File, err)
+	} else {
+		if m := readBadPixelMap(f); m != nil {
+			bad = m.mask(img.Bounds())
+		}
+		f.Close()
+	}
+
+	fixed := fixBadPixels(img, bad)
+	if is16Bit(img) {
+		return fixed
+	}
+	rgba := image.NewRGBA(fixed.Rect)
+	draw.Draw(rgba, rgba.Rect, fixed, image.Point{}, draw.Src)
+	return rgba
+}
+
+// fixBadPixels replaces the bad pixels of an image, marked by a mask (nil
+// if none), and its stuck pixels, isolated pixels far brighter or darker
+// than all their neighbors, e.g., the hot pixels of a long exposure, by
+// the median of their neighbors.  Neighbors that are bad are excluded.
+// Returns the corrected copy of the image.
+func fixBadPixels(img image.Image, bad []bool) *image.RGBA64 {
+	b := img.Bounds()
+	src := image.NewRGBA64(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Rect, img, b.Min, draw.Src)
+	dst := image.NewRGBA64(src.Rect)
+	copy(dst.Pix, src.Pix)
+
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	isBad := func(x, y int) bool {
+		return bad != nil && bad[y*w+x]
+	}
+	neighbors := make([]color.RGBA64, 0, 24)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if !isBad(x, y) && !isStuck(src, x, y) {
+				continue
+			}
+
+			for radius := 1; radius <= 2 && len(neighbors) == 0; radius++ {
+				for ny := max(y-radius, 0); ny <= min(y+radius, h-1); ny++ {
+					for nx := max(x-radius, 0); nx <= min(x+radius, w-1); nx++ {
+						if (nx != x || ny != y) && !isBad(nx, ny) {
+							neighbors = append(neighbors, src.RGBA64At(nx, ny))
+						}
+					}
+				}
+			}
+			if len(neighbors) > 0 {
+				dst.SetRGBA64(x, y, medianColor(neighbors))
+			}
+			neighbors = neighbors[:0]
+		}
+	}
+	return dst
+}
+
+// samples returns the red, green, and blue samples of a color.
+func samples(c color.RGBA64) [3]int {
+	return [3]int{int(c.R), int(c.G), int(c.B)}
+}
+
+// isStuck determines if a pixel of an image is stuck: a sample exceeds
+// those of all its 8 neighbors, or falls short of them, by
+// stuckPixelThreshold.  Pixels of the edges are not examined.
+func isStuck(img *image.RGBA64, x, y int) bool {
+	if x < 1 || y < 1 || x >= img.Rect.Dx()-1 || y >= img.Rect.Dy()-1 {
+		return false
+	}
+
+	lo, hi := [3]int{0xffff, 0xffff, 0xffff}, [3]int{}
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if dx == 0 && dy == 0 {
+				continue
+			}
+			n := samples(img.RGBA64At(x+dx, y+dy))
+			for c := range n {
+				lo[c], hi[c] = min(lo[c], n[c]), max(hi[c], n[c])
+			}
+		}
+	}
+
+	v := samples(img.RGBA64At(x, y))
+	for c := range v {
+		if v[c] > hi[c]+stuckPixelThreshold || v[c] < lo[c]-stuckPixelThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+// medianColor returns the opaque color of the median of each sample of
+// colors.
+func medianColor(colors []color.RGBA64) color.RGBA64 {
+	var median [3]uint16
+	values := make([]int, len(colors))
+	for c := range median {
+		for i, n := range colors {
+			values[i] = samples(n)[c]
+		}
+		slices.Sort(values)
+		median[c] = uint16(values[len(values)/2])
+	}
+	return color.RGBA64{median[0], median[1], median[2], 0xffff}
+}
+
+// is16Bit determines if an image has 16-bit samples, e.g., developed at a
+// RenderOptions.BitDepth of 16.
+func is16Bit(img image.Image) bool {
+	switch img.ColorModel() {
+	case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model, color.Alpha16Model:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// hotPixelDecoder is a RawDecoder developing a gray image with a hot pixel
+// at (2, 2) and a bright 2x2 block, e.g., a star, at (5, 1).
+type hotPixelDecoder struct{}
+
+func (hotPixelDecoder) DecodeRaw(info *RawFileInfo) (image.Image, error) {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 8; x++ {
+			img.Set(x, y, color.RGBA{100, 100, 100, 255})
+		}
+	}
+	img.Set(2, 2, color.RGBA{255, 240, 250, 255})
+	for _, p := range []image.Point{{5, 1}, {6, 1}, {5, 2}, {6, 2}} {
+		img.Set(p.X, p.Y, color.RGBA{250, 250, 250, 255})
+	}
+	return img, nil
+}
+
+// opcodeList encodes a DNG opcode list of a FixBadPixelsList opcode, of
+// points (row, column) and rectangles (top, left, bottom, right).
+func opcodeList(points [][2]uint32, rects [][4]uint32) []byte {
+	be := binary.BigEndian
+	params := be.AppendUint32(nil, 0)
+	params = be.AppendUint32(params, uint32(len(points)))
+	params = be.AppendUint32(params, uint32(len(rects)))
+	for _, p := range points {
+		params = be.AppendUint32(be.AppendUint32(params, p[0]), p[1])
+	}
+	for _, r := range rects {
+		for _, v := range r {
+			params = be.AppendUint32(params, v)
+		}
+	}
+
+	data := be.AppendUint32(nil, 1)
+	data = be.AppendUint32(data, opcodeFixBadPixelsList)
+	data = be.AppendUint32(data, 0x01030000)
+	data = be.AppendUint32(data, 0)
+	data = be.AppendUint32(data, uint32(len(params)))
+	return append(data, params...)
+}
+
+func TestFixBadPixels(t *testing.T) {
+	saved := registeredRawDecoder()
+	defer RegisterRawDecoder(saved)
+	RegisterRawDecoder(hotPixelDecoder{})
+
+	img, err := DecodeRaw(&RawFileInfo{File: TestNefFile, FixBadPixels: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if c := img.At(2, 2).(color.RGBA); c != (color.RGBA{100, 100, 100, 255}) {
+		t.Errorf("Expected the hot pixel to be corrected; got %v\n", c)
+	}
+	if c := img.At(5, 1).(color.RGBA); c.R != 250 {
+		t.Errorf("Expected the 2x2 block to be kept; got %v\n", c)
+	}
+
+	img, _ = DecodeRaw(&RawFileInfo{File: TestNefFile})
+	if c := img.At(2, 2).(color.RGBA); c.R != 255 {
+		t.Errorf("Expected no correction; got %v\n", c)
+	}
+}
+
+func TestBadPixelMap(t *testing.T) {
+	tt := newTestTiff(true)
+	cfa := tt.addBlob(make([]byte, 8*6*2))
+	raw := tt.addIfd(0,
+		longEntry(0x00fe, 0),
+		longEntry(0x0100, 8),
+		longEntry(0x0101, 6),
+		shortEntry(0x0106, 32803),
+		longEntry(0x0111, cfa),
+		longEntry(0x0117, 8*6*2),
+		longEntry(0xc68d, 1, 2, 5, 8),
+		testEntry{tag: tagOpcodeList1, fieldType: 7, raw: opcodeList([][2]uint32{{2, 3}}, nil)},
+		testEntry{tag: tagOpcodeList2, fieldType: 7, raw: opcodeList(nil, [][4]uint32{{3, 5, 4, 6}})})
+	data := tt.bytes(tt.addIfd(0,
+		testEntry{tag: 0xc612, fieldType: 1, raw: []byte{1, 4, 0, 0}},
+		shortEntry(0x0112, uint32(Rotate90)),
+		longEntry(0x014a, raw)))
+
+	m := readBadPixelMap(bytes.NewReader(data))
+	if m == nil {
+		t.Fatalf("Expected bad pixels\n")
+	}
+	if m.mask(image.Rect(0, 0, 6, 4)) != nil {
+		t.Errorf("Expected no mask of an image not rotated\n")
+	}
+
+	// the 6x4 ActiveArea is developed rotated to 4x6
+	mask := m.mask(image.Rect(0, 0, 4, 6))
+	var bad []image.Point
+	for i, b := range mask {
+		if b {
+			bad = append(bad, image.Pt(i%4, i/4))
+		}
+	}
+	want := []image.Point{{2, 1}, {0, 5}}
+	if len(bad) != len(want) || bad[0] != want[0] || bad[1] != want[1] {
+		t.Errorf("Expected bad pixels %v; got %v\n", want, bad)
+	}
+}
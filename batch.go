@@ -0,0 +1,479 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"fmt"
+	"iter"
+	"log"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// BatchProcessor processes a batch of raw files concurrently.  The parser
+// of each file is selected by its file extension from the registered
+// formats; see RegisterFormat.  A BatchProcessor is configured by
+// BatchOptions and may be reused.
+type BatchProcessor struct {
+	destDir   string
+	quality   int
+	jpeg      JpegOptions
+	workers   int
+	dedupe    DedupeMode
+	histogram bool
+	tagHooks  *TagHooks
+	report    *ReportWriter
+	dryRun    bool
+	overwrite OverwritePolicy
+	stats     *BatchStats
+	onResult  func(BatchResult)
+	cache     *PreviewCache
+	artist    string
+	copyright string
+	toSRGB    bool
+
+	// throttle limits the rate at which files are started; nil if
+	// unlimited.  See WithRateLimit and WithByteRateLimit.
+	throttle      *throttle
+	lowIOPriority bool
+
+	// fds holds a token for each file processed while the file
+	// descriptors are limited; nil if unlimited.  See WithMaxOpenFiles.
+	fds chan struct{}
+}
+
+// fdsPerFile is the number of file descriptors held open at once while
+// processing a file of a batch: the raw file and the preview written.
+const fdsPerFile = 2
+
+// BatchOption configures a BatchProcessor.
+type BatchOption func(*BatchProcessor)
+
+// BatchResult is a struct representing the outcome of processing a file of
+// a batch.
+type BatchResult struct {
+	File string
+
+	// RawFile is the parsed raw file; nil if the file was not parsed
+	// (e.g., a duplicate found by content).
+	RawFile *RawFile
+
+	// Err is the error processing the file; nil otherwise.
+	Err error
+
+	// DuplicateOf is the file representing the group of duplicates the
+	// file belongs to, which was processed in its place; empty if the
+	// file is not a duplicate.  See WithDedupe.
+	DuplicateOf string
+}
+
+// NewBatchProcessor creates a BatchProcessor extracting the embedded JPEGs,
+// using a JPEG quality parameter from 1 to 100 or QualityAuto, to destDir.
+// Returns the BatchProcessor.
+func NewBatchProcessor(destDir string, quality int, opts ...BatchOption) *BatchProcessor {
+	b := &BatchProcessor{
+		destDir: destDir,
+		quality: quality,
+		workers: runtime.NumCPU(),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// WithWorkers sets the number of files processed concurrently.  Defaults
+// to the number of CPUs.
+func WithWorkers(n int) BatchOption {
+	return func(b *BatchProcessor) {
+		if n > 0 {
+			b.workers = n
+		}
+	}
+}
+
+// WithJpegOptions sets the chroma subsampling and progressive encoding of
+// the extracted JPEGs.
+func WithJpegOptions(opts JpegOptions) BatchOption {
+	return func(b *BatchProcessor) {
+		b.jpeg = opts
+	}
+}
+
+// WithHistogram computes the Histogram of the preview of each file; see
+// RawFileInfo.Histogram.
+func WithHistogram() BatchOption {
+	return func(b *BatchProcessor) {
+		b.histogram = true
+	}
+}
+
+// WithTagHooks calls the hooks with the values of the tags of each file; see
+// RawFileInfo.TagHooks.  The hooks are called concurrently by the workers.
+func WithTagHooks(hooks *TagHooks) BatchOption {
+	return func(b *BatchProcessor) {
+		b.tagHooks = hooks
+	}
+}
+
+// WithReport writes the result of each file to rw as it completes, e.g., as
+// an audit log.  Flush rw once the batch completes to write buffered rows
+// and check for errors.
+func WithReport(rw *ReportWriter) BatchOption {
+	return func(b *BatchProcessor) {
+		b.report = rw
+	}
+}
+
+// WithDryRun parses the files and encodes their previews without creating
+// any file or directory; the file each would write is reported in
+// ExtractionResult.Planned; the planned sizes are estimates under the
+// native JPEG backends.  See RawFileInfo.DryRun.
+func WithDryRun() BatchOption {
+	return func(b *BatchProcessor) {
+		b.dryRun = true
+	}
+}
+
+// WithOverwritePolicy sets the handling of existing files at the paths of
+// the extracted previews, e.g., SkipExisting to resume an interrupted
+// batch.  The action taken for each file is recorded in
+// ExtractionResult.Action.  Defaults to OverwriteExisting.
+func WithOverwritePolicy(policy OverwritePolicy) BatchOption {
+	return func(b *BatchProcessor) {
+		b.overwrite = policy
+	}
+}
+
+// WithMaxOpenFiles limits the file descriptors held open by the batch to n,
+// e.g., to remain below the open file limit of the process, by limiting
+// the files processed at once to n/2 (at least one) regardless of the
+// workers.  The limit is shared by the batches run concurrently by the
+// BatchProcessor.
+func WithMaxOpenFiles(n int) BatchOption {
+	return func(b *BatchProcessor) {
+		if n > 0 {
+			b.fds = make(chan struct{}, max(n/fdsPerFile, 1))
+		}
+	}
+}
+
+// WithStats aggregates the outcome of each file to stats as it completes,
+// e.g., to publish the totals of a long-running ingest daemon with
+// expvar.  The stats may be shared by BatchProcessors.
+func WithStats(stats *BatchStats) BatchOption {
+	return func(b *BatchProcessor) {
+		b.stats = stats
+	}
+}
+
+// WithResultFunc calls fn with the result of each file as it completes,
+// e.g., to record metrics (see the metrics subpackage).  fn is called by
+// the goroutine running the batch, not concurrently.
+func WithResultFunc(fn func(BatchResult)) BatchOption {
+	return func(b *BatchProcessor) {
+		b.onResult = fn
+	}
+}
+
+// WithPreviewCache returns the RawFiles of the unchanged files processed
+// by a previous batch from cache rather than parsing them again; see
+// RawFileInfo.Cache.
+func WithPreviewCache(cache *PreviewCache) BatchOption {
+	return func(b *BatchProcessor) {
+		b.cache = cache
+	}
+}
+
+// WithCopyright stamps the artist and copyright, if not empty, into the
+// EXIF metadata of the extracted previews; see RawFileInfo.Artist.
+func WithCopyright(artist, copyright string) BatchOption {
+	return func(b *BatchProcessor) {
+		b.artist, b.copyright = artist, copyright
+	}
+}
+
+// WithSRGB converts the extracted previews in Adobe RGB to sRGB; see
+// RawFileInfo.ConvertToSRGB.
+func WithSRGB() BatchOption {
+	return func(b *BatchProcessor) {
+		b.toSRGB = true
+	}
+}
+
+// WithRateLimit limits the files started by the batch to filesPerSecond,
+// e.g., so that background indexing does not starve interactive work on the
+// same machine.  The limit is shared by the workers.
+func WithRateLimit(filesPerSecond float64) BatchOption {
+	return func(b *BatchProcessor) {
+		if filesPerSecond > 0 {
+			b.rateLimit().filesPerSec = filesPerSecond
+		}
+	}
+}
+
+// WithByteRateLimit limits the bytes read by the batch to bytesPerSecond,
+// on average: the start of the next file is delayed by the time the bytes
+// read by each file take at that rate.  The limit is shared by the workers
+// and may be combined with WithRateLimit.
+func WithByteRateLimit(bytesPerSecond int64) BatchOption {
+	return func(b *BatchProcessor) {
+		if bytesPerSecond > 0 {
+			b.rateLimit().bytesPerSec = bytesPerSecond
+		}
+	}
+}
+
+// WithLowIOPriority runs the workers of the batch, including those of the
+// dedupe pre-pass, in the idle IO scheduling class, so that their reads are
+// served only when the disk is otherwise idle.  Only supported on Linux;
+// ignored elsewhere.
+func WithLowIOPriority() BatchOption {
+	return func(b *BatchProcessor) {
+		b.lowIOPriority = true
+	}
+}
+
+// rateLimit returns the throttle of the BatchProcessor, creating it if
+// unlimited.
+func (b *BatchProcessor) rateLimit() *throttle {
+	if b.throttle == nil {
+		b.throttle = &throttle{}
+	}
+	return b.throttle
+}
+
+// Process processes the files of a batch.
+// Returns the result of each file, in the order of files.
+func (b *BatchProcessor) Process(files []string) []BatchResult {
+	results := make([]BatchResult, len(files))
+	b.run(files, func(i int, res *BatchResult) bool {
+		results[i] = *res
+		return true
+	})
+	return results
+}
+
+// Results processes the files of a batch, yielding the result of each file
+// as it completes; the order is not that of files.  Breaking out of the
+// loop stops the batch: no further files are started, and the loop exits
+// once the files in progress complete.
+func (b *BatchProcessor) Results(files []string) iter.Seq[BatchResult] {
+	return func(yield func(BatchResult) bool) {
+		b.run(files, func(_ int, res *BatchResult) bool {
+			return yield(*res)
+		})
+	}
+}
+
+// run processes the files of a batch, calling fn with the index and result
+// of each file as it completes, until fn returns false.  The results of
+// files not processed by a pre-pass (e.g., duplicates) are reported first.
+func (b *BatchProcessor) run(files []string, fn func(i int, res *BatchResult) bool) {
+	if rw := b.report; rw != nil {
+		yield := fn
+		fn = func(i int, res *BatchResult) bool {
+			rw.Write(*res)
+			return yield(i, res)
+		}
+	}
+	if stats := b.stats; stats != nil {
+		yield := fn
+		fn = func(i int, res *BatchResult) bool {
+			stats.record(res)
+			return yield(i, res)
+		}
+	}
+	if onResult := b.onResult; onResult != nil {
+		yield := fn
+		fn = func(i int, res *BatchResult) bool {
+			onResult(*res)
+			return yield(i, res)
+		}
+	}
+	results, pending := b.prepare(files)
+
+	isPending := make([]bool, len(files))
+	for _, i := range pending {
+		isPending[i] = true
+	}
+	for i := range results {
+		if !isPending[i] && !fn(i, &results[i]) {
+			return
+		}
+	}
+
+	groups := nameGroups(files, pending)
+	units := make([]int, len(groups))
+	for g := range units {
+		units[g] = g
+	}
+	claims := newOutputClaims()
+
+	done := make(chan struct{})
+	completed := make(chan int)
+	go func() {
+		b.forEachUntil(done, units, func(g int) {
+			for _, i := range groups[g] {
+				if b.throttle != nil && !b.throttle.wait(done) {
+					return
+				}
+				b.withOpenFiles(func() { b.processFile(&results[i], claims) })
+				if b.throttle != nil && results[i].RawFile != nil {
+					b.throttle.charge(results[i].RawFile.ReadStats.BytesRead)
+				}
+				select {
+				case completed <- i:
+				case <-done:
+					return
+				}
+			}
+		})
+		close(completed)
+	}()
+
+	for i := range completed {
+		if !fn(i, &results[i]) {
+			close(done)
+			for range completed {
+				// wait for the files in progress
+			}
+			return
+		}
+	}
+}
+
+// prepare creates the results of the files of a batch and runs the dedupe
+// pre-pass, if any.
+// Returns the results and the indexes of the files to process.
+func (b *BatchProcessor) prepare(files []string) ([]BatchResult, []int) {
+	results := make([]BatchResult, len(files))
+	pending := make([]int, len(files))
+	for i, file := range files {
+		results[i].File = file
+		pending[i] = i
+	}
+
+	switch b.dedupe {
+	case DedupeContent:
+		pending = b.dedupeByContent(results)
+	case DedupePhotoID:
+		pending = b.dedupeByPhotoID(results)
+	}
+	return results, pending
+}
+
+// nameGroups groups the indexes of the files of a batch by the base name
+// of the file, which names its preview, in the order of the indexes.  The
+// files of a group are processed in order by a single worker, so that the
+// preview of the first keeps its name, and those of the others are
+// disambiguated alike, regardless of the scheduling of the workers.
+// Returns the groups, in the order of their first index.
+func nameGroups(files []string, indexes []int) [][]int {
+	var groups [][]int
+	byName := make(map[string]int)
+	for _, i := range indexes {
+		name := safeBaseName(files[i])
+		g, ok := byName[name]
+		if !ok {
+			g = len(groups)
+			byName[name] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
+
+// processFile extracts the embedded JPEG of a file of the batch, claiming
+// the path of its preview in claims.  If the file was parsed by a pre-pass,
+// the preview is extracted without parsing the file again.
+func (b *BatchProcessor) processFile(res *BatchResult, claims *outputClaims) {
+	info := &RawFileInfo{File: res.File, DestDir: b.destDir, Quality: b.quality, Jpeg: b.jpeg, Histogram: b.histogram, TagHooks: b.tagHooks, DryRun: b.dryRun, Overwrite: b.overwrite, Cache: b.cache, Artist: b.artist, Copyright: b.copyright, ConvertToSRGB: b.toSRGB, claims: claims}
+
+	if res.RawFile != nil {
+		_, res.Err = res.RawFile.Extract(info)
+		return
+	}
+
+	p := NewFormatParser(filepath.Ext(res.File))
+	if p == nil {
+		res.Err = fmt.Errorf("%w: %s", ErrUnknownFormat, res.File)
+		return
+	}
+	res.RawFile, res.Err = p.ProcessFile(info)
+}
+
+// withOpenFiles calls fn, which opens the files of a file of the batch,
+// once the file descriptors are available if limited by WithMaxOpenFiles.
+func (b *BatchProcessor) withOpenFiles(fn func()) {
+	if b.fds != nil {
+		b.fds <- struct{}{}
+		defer func() { <-b.fds }()
+	}
+	fn()
+}
+
+// forEach calls fn for each index, concurrently by the workers of the
+// BatchProcessor.
+func (b *BatchProcessor) forEach(indexes []int, fn func(i int)) {
+	b.forEachUntil(nil, indexes, fn)
+}
+
+// forEachUntil calls fn for each index, concurrently by the workers of the
+// BatchProcessor, until done is closed.
+func (b *BatchProcessor) forEachUntil(done <-chan struct{}, indexes []int, fn func(i int)) {
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < b.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if b.lowIOPriority {
+				// the thread is never unlocked, so it exits with the
+				// worker rather than returning to the scheduler with
+				// its priority lowered
+				runtime.LockOSThread()
+				if err := lowerIOPriority(); err != nil {
+					log.Printf("Error lowering IO priority: %v\n", err)
+				}
+			}
+			for i := range work {
+				fn(i)
+			}
+		}()
+	}
+
+feed:
+	for _, i := range indexes {
+		select {
+		case work <- i:
+		case <-done:
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+}
@@ -0,0 +1,336 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// buildTestPhoto builds a synthetic NRW with an ImageUniqueID.  The
+// software tag varies the content of files of the same photo.
+func buildTestPhoto(t *testing.T, id, software string) []byte {
+	tt := newTestTiff(true)
+	preview := testJpeg(t, 64, 48)
+	exif := tt.addIfd(0, asciiEntry(0xa420, id))
+	ifd0 := tt.addIfd(0,
+		longEntry(0x0201, tt.addBlob(preview)),
+		longEntry(0x0202, uint32(len(preview))),
+		asciiEntry(0x0131, software),
+		longEntry(0x8769, exif))
+	return tt.bytes(ifd0)
+}
+
+func writeFile(t *testing.T, name string, data []byte) {
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		t.Fatalf("Error writing %s: %v\n", name, err)
+	}
+}
+
+func TestBatchProcess(t *testing.T) {
+	a, dir := writeTestFile(t, "a.NRW", buildTestPhoto(t, "id-a", "v1"))
+	files := []string{a, filepath.Join(dir, "missing.NRW"), filepath.Join(dir, "c.ABC")}
+
+	results := NewBatchProcessor(dir, 75, WithWorkers(2)).Process(files)
+	if len(results) != len(files) {
+		t.Fatalf("Unexpected results: %+v\n", results)
+	}
+	if results[0].Err != nil || results[0].RawFile.JpegPath == "" {
+		t.Errorf("Unexpected result: %+v\n", results[0])
+	}
+	if results[1].Err == nil {
+		t.Error("Expected error for missing file")
+	}
+	if !errors.Is(results[2].Err, ErrUnknownFormat) {
+		t.Errorf("Expected ErrUnknownFormat; got %v\n", results[2].Err)
+	}
+	for i, res := range results {
+		if res.File != files[i] || res.DuplicateOf != "" {
+			t.Errorf("Unexpected result %d: %+v\n", i, res)
+		}
+	}
+}
+
+func TestBatchDedupeContent(t *testing.T) {
+	a, dir := writeTestFile(t, "a.NRW", buildTestPhoto(t, "id-a", "v1"))
+	b := filepath.Join(dir, "b.NRW")
+	c := filepath.Join(dir, "c.NRW")
+	d := filepath.Join(dir, "d.NRW")
+	writeFile(t, b, buildTestPhoto(t, "id-a", "v1")) // copy of a
+	writeFile(t, c, buildTestPhoto(t, "id-a", "v2")) // same size, modified
+	writeFile(t, d, buildTestPhoto(t, "id-d", "v1"))
+
+	results := NewBatchProcessor(dir, 75, WithDedupe(DedupeContent)).Process([]string{a, b, c, d})
+
+	expected := []string{"", a, "", ""}
+	for i, res := range results {
+		if res.Err != nil || res.DuplicateOf != expected[i] {
+			t.Errorf("Unexpected result %d: %+v\n", i, res)
+		}
+		if (res.RawFile == nil) != (expected[i] != "") {
+			t.Errorf("Unexpected processing of result %d: %+v\n", i, res)
+		}
+	}
+}
+
+func TestBatchDedupePhotoID(t *testing.T) {
+	a, dir := writeTestFile(t, "a.NRW", buildTestPhoto(t, "id-a", "v1"))
+	b := filepath.Join(dir, "b.NRW")
+	c := filepath.Join(dir, "c.NRW")
+	writeFile(t, b, buildTestPhoto(t, "id-a", "edited"))
+	writeFile(t, c, buildTestPhoto(t, "id-c", "v1"))
+
+	results := NewBatchProcessor(dir, 75, WithDedupe(DedupePhotoID)).Process([]string{a, b, c})
+
+	expected := []string{"", a, ""}
+	for i, res := range results {
+		if res.Err != nil || res.DuplicateOf != expected[i] || res.RawFile == nil {
+			t.Fatalf("Unexpected result %d: %+v\n", i, res)
+		}
+		extracted := res.RawFile.JpegPath != ""
+		if extracted != (expected[i] == "") {
+			t.Errorf("Unexpected extraction of result %d: %+v\n", i, res.RawFile)
+		}
+	}
+	if results[0].RawFile.PhotoID != "id-a" || results[0].RawFile.PreviewWidth != 64 {
+		t.Errorf("Unexpected raw file: %+v\n", results[0].RawFile)
+	}
+}
+
+func TestPhotoID(t *testing.T) {
+	m := rawMetadata{make: "NIKON", model: "D800"}
+	m.dates.original = "2013:07:06 14:29:40"
+	if id := m.photoID(); id != "" {
+		t.Errorf("Unexpected photo ID without sub-seconds: %s\n", id)
+	}
+
+	m.dates.subSecOriginal = "81"
+	if id := m.photoID(); id != "NIKON/D800/2013:07:06 14:29:40.81" {
+		t.Errorf("Unexpected derived photo ID: %s\n", id)
+	}
+
+	m.imageUniqueID = "f1e2d3"
+	if id := m.photoID(); id != "f1e2d3" {
+		t.Errorf("Unexpected photo ID: %s\n", id)
+	}
+}
+
+func TestBatchResults(t *testing.T) {
+	a, dir := writeTestFile(t, "a.NRW", buildTestPhoto(t, "id-a", "v1"))
+	b := filepath.Join(dir, "b.NRW")
+	c := filepath.Join(dir, "c.NRW")
+	writeFile(t, b, buildTestPhoto(t, "id-b", "v1"))
+	writeFile(t, c, buildTestPhoto(t, "id-a", "v1"))
+	files := []string{a, b, c}
+
+	seen := make(map[string]BatchResult)
+	batch := NewBatchProcessor(dir, 75, WithWorkers(2), WithDedupe(DedupeContent))
+	for res := range batch.Results(files) {
+		seen[res.File] = res
+	}
+	if len(seen) != len(files) {
+		t.Fatalf("Unexpected results: %+v\n", seen)
+	}
+	if seen[c].DuplicateOf != a || seen[a].Err != nil || seen[b].Err != nil {
+		t.Errorf("Unexpected results: %+v\n", seen)
+	}
+
+	// breaking out of the loop stops the batch
+	n := 0
+	for range NewBatchProcessor(dir, 75, WithWorkers(1)).Results(files) {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 result; got %d\n", n)
+	}
+}
+
+func TestBatchErrors(t *testing.T) {
+	a, dir := writeTestFile(t, "a.NRW", buildTestPhoto(t, "id-a", "v1"))
+	missing := filepath.Join(dir, "missing.NRW")
+	unknown := filepath.Join(dir, "c.ABC")
+	results := NewBatchProcessor(dir, 75).Process([]string{a, missing, unknown})
+
+	err := BatchErrors(results)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errs) != 2 {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if !errors.Is(err, ErrUnknownFormat) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the errors of each file; got %v\n", err)
+	}
+	if batchErr.Err(a) != nil || !errors.Is(batchErr.Err(unknown), ErrUnknownFormat) {
+		t.Errorf("Unexpected per-file errors: %v\n", batchErr.Errs)
+	}
+
+	var fileErr *FileError
+	if !errors.As(err, &fileErr) || fileErr.File != missing {
+		t.Errorf("Expected a FileError for %s; got %v\n", missing, fileErr)
+	}
+	if want := batchErr.Errs[0].Error() + "\n" + batchErr.Errs[1].Error(); err.Error() != want {
+		t.Errorf("Expected %q; got %q\n", want, err.Error())
+	}
+
+	if err := BatchErrors(results[:1]); err != nil {
+		t.Errorf("Expected nil; got %v\n", err)
+	}
+}
+
+func TestBatchDryRun(t *testing.T) {
+	a, dir := writeTestFile(t, "a.NRW", buildTestPhoto(t, "id-a", "v1"))
+	b := filepath.Join(dir, "b.NRW")
+	writeFile(t, b, buildTestPhoto(t, "id-b", "v1"))
+	existing := filepath.Join(dir, "b.NRW_extracted.jpg")
+	writeFile(t, existing, []byte("existing"))
+
+	results := NewBatchProcessor(dir, 75, WithDryRun()).Process([]string{a, b})
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 3 {
+		t.Errorf("Unexpected files created by dry run: %v\n", entries)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "existing" {
+		t.Error("Existing file modified by dry run")
+	}
+
+	for i, want := range []bool{false, true} {
+		res := results[i]
+		if res.Err != nil || res.RawFile.JpegPath != "" {
+			t.Fatalf("Unexpected result %d: %+v\n", i, res)
+		}
+		planned := res.RawFile.Extraction.Planned
+		if planned == nil || planned.Size <= 0 || planned.Overwrite != want ||
+			planned.Path != filepath.Join(dir, filepath.Base(res.File)+"_extracted.jpg") {
+			t.Errorf("Unexpected planned file %d: %+v\n", i, planned)
+		}
+	}
+
+	// the planned size is that of the file written by the pure-Go encoder
+	results = NewBatchProcessor(dir, 75).Process([]string{a})
+	fi, err := os.Stat(results[0].RawFile.JpegPath)
+	if err != nil || results[0].RawFile.Extraction.Planned != nil {
+		t.Fatalf("Unexpected result: %+v %v\n", results[0], err)
+	}
+	planned := NewBatchProcessor(dir, 75, WithDryRun()).Process([]string{a})[0].RawFile.Extraction.Planned
+	if planned == nil || planned.Size <= 0 || !planned.Overwrite ||
+		(!nativeJpeg && planned.Size != fi.Size()) {
+		t.Errorf("Unexpected planned file: %+v; written %d bytes\n", planned, fi.Size())
+	}
+}
+
+func TestBatchMaxOpenFiles(t *testing.T) {
+	a, dir := writeTestFile(t, "a.NRW", buildTestPhoto(t, "id-a", "v1"))
+	files := []string{a}
+	for i := 0; i < 7; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("%d.NRW", i))
+		writeFile(t, name, buildTestPhoto(t, fmt.Sprintf("id-%d", i), "v1"))
+		files = append(files, name)
+	}
+
+	// the hooks run while the raw file is open
+	var open, maxOpen atomic.Int32
+	var hooks TagHooks
+	hooks.OnTag(0x0131, func(tiff.Kind, uint16, any) {
+		n := open.Add(1)
+		for m := maxOpen.Load(); n > m && !maxOpen.CompareAndSwap(m, n); m = maxOpen.Load() {
+		}
+		time.Sleep(5 * time.Millisecond)
+		open.Add(-1)
+	})
+
+	for _, dedupe := range []DedupeMode{DedupeNone, DedupePhotoID} {
+		maxOpen.Store(0)
+		b := NewBatchProcessor(dir, 75, WithWorkers(8), WithMaxOpenFiles(5), WithTagHooks(&hooks), WithDedupe(dedupe))
+		for _, res := range b.Process(files) {
+			if res.Err != nil {
+				t.Errorf("Unexpected error: %v\n", res.Err)
+			}
+		}
+		if m := maxOpen.Load(); m < 1 || m > 2 {
+			t.Errorf("dedupe %v: expected at most 2 files open at once; got %d\n", dedupe, m)
+		}
+	}
+}
+
+func TestBatchRateLimit(t *testing.T) {
+	a, dir := writeTestFile(t, "a.NRW", buildTestPhoto(t, "id-a", "v1"))
+	files := []string{a}
+	for i := 0; i < 4; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("%d.NRW", i))
+		writeFile(t, name, buildTestPhoto(t, fmt.Sprintf("id-%d", i), "v1"))
+		files = append(files, name)
+	}
+
+	start := time.Now()
+	for _, res := range NewBatchProcessor(dir, 75, WithWorkers(4), WithRateLimit(20)).Process(files) {
+		if res.Err != nil {
+			t.Errorf("Unexpected error: %v\n", res.Err)
+		}
+	}
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Errorf("Expected 5 files at 20 files/sec to take at least 200ms; took %v\n", d)
+	}
+
+	// the bytes read by a file delay the next
+	bytesRead := NewBatchProcessor(dir, 75).Process(files[:1])[0].RawFile.ReadStats.BytesRead
+	start = time.Now()
+	for _, res := range NewBatchProcessor(dir, 75, WithWorkers(1), WithByteRateLimit(bytesRead*20)).Process(files[:3]) {
+		if res.Err != nil {
+			t.Errorf("Unexpected error: %v\n", res.Err)
+		}
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("Expected 3 files at 20 files' worth of bytes/sec to take at least 100ms; took %v\n", d)
+	}
+
+	// stopping the batch does not wait for the files throttled
+	start = time.Now()
+	for range NewBatchProcessor(dir, 75, WithRateLimit(0.5)).Results(files) {
+		break
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expected stopping the batch to skip the throttled files; took %v\n", d)
+	}
+}
+
+func TestBatchLowIOPriority(t *testing.T) {
+	a, dir := writeTestFile(t, "a.NRW", buildTestPhoto(t, "id-a", "v1"))
+	b := filepath.Join(dir, "b.NRW")
+	writeFile(t, b, buildTestPhoto(t, "id-a", "v2"))
+
+	for _, dedupe := range []DedupeMode{DedupeNone, DedupeContent} {
+		for _, res := range NewBatchProcessor(dir, 75, WithLowIOPriority(), WithDedupe(dedupe)).Process([]string{a, b}) {
+			if res.Err != nil || res.RawFile == nil && res.DuplicateOf == "" {
+				t.Errorf("dedupe %v: unexpected result: %+v\n", dedupe, res)
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"strings"
+)
+
+// FileError is an error processing a file of a batch.
+type FileError struct {
+	File string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return e.File + ": " + e.Err.Error()
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError aggregates the errors of the files of a batch that failed,
+// with the semantics of errors.Join: its message is the message of each
+// FileError, separated by newlines, and errors.Is and errors.As match any
+// of its errors.
+type BatchError struct {
+	// Errs are the errors of the files that failed, in the order of the
+	// batch.
+	Errs []*FileError
+}
+
+// BatchErrors aggregates the errors of the results of a batch.
+// Returns a *BatchError, or nil if no file failed.
+func BatchErrors(results []BatchResult) error {
+	var errs []*FileError
+	for _, res := range results {
+		if res.Err != nil {
+			errs = append(errs, &FileError{File: res.File, Err: res.Err})
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &BatchError{Errs: errs}
+}
+
+func (e *BatchError) Error() string {
+	var b strings.Builder
+	for i, err := range e.Errs {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+// Unwrap returns the errors of the files that failed.
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, len(e.Errs))
+	for i, err := range e.Errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Err returns the error of a file of the batch; nil if the file did not
+// fail.
+func (e *BatchError) Err(file string) error {
+	for _, err := range e.Errs {
+		if err.File == file {
+			return err.Err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+// Package catalog persists the RawFiles parsed by the rawparser package,
+// their metadata, preview paths, and checksums, into a SQLite database,
+// e.g., as the ingestion layer of a photo manager.  A raw file is stored
+// once, by absolute path: storing it again updates it.  Capture dates are
+// stored in UTC, so that they sort and compare as times whatever their
+// offsets.
+//
+// The package does not depend on a SQLite driver; the database is opened
+// with the driver of the application, e.g.:
+//
+//	import _ "modernc.org/sqlite"
+//
+//	db, err := sql.Open("sqlite", "photos.db")
+//	...
+//	c, err := catalog.New(ctx, db)
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/jeremytorres/rawparser"
+)
+
+// ErrNotFound is returned by Get when a raw file is not in the catalog.
+var ErrNotFound = errors.New("catalog: raw file not found")
+
+// schema is the schema of the catalog: a row per raw file, keyed by its
+// absolute path.  The create_date column holds the CreateDate in UTC, in
+// dateFormat; the metadata column holds the RawFile as JSON.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS raw_files (
+		file_name      TEXT PRIMARY KEY,
+		create_date    TEXT,
+		camera_make    TEXT,
+		camera_model   TEXT,
+		lens           TEXT,
+		image_width    INTEGER,
+		image_height   INTEGER,
+		preview_width  INTEGER,
+		preview_height INTEGER,
+		jpeg_path      TEXT,
+		photo_id       TEXT,
+		rating         INTEGER,
+		raw_sha256     TEXT,
+		jpeg_sha256    TEXT,
+		metadata       TEXT NOT NULL,
+		updated_at     TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS raw_files_create_date ON raw_files (create_date)`,
+	`CREATE INDEX IF NOT EXISTS raw_files_photo_id ON raw_files (photo_id)`,
+}
+
+// dateFormat is the format of the dates of the catalog: RFC 3339 in UTC,
+// with a fixed number of fractional digits, so that dates sort as text in
+// the order of the times.
+const dateFormat = "2006-01-02T15:04:05.000000000Z"
+
+// upsert inserts or updates the row of a raw file.
+const upsert = `INSERT INTO raw_files (
+	file_name, create_date, camera_make, camera_model, lens,
+	image_width, image_height, preview_width, preview_height,
+	jpeg_path, photo_id, rating, raw_sha256, jpeg_sha256,
+	metadata, updated_at
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (file_name) DO UPDATE SET
+	create_date = excluded.create_date,
+	camera_make = excluded.camera_make,
+	camera_model = excluded.camera_model,
+	lens = excluded.lens,
+	image_width = excluded.image_width,
+	image_height = excluded.image_height,
+	preview_width = excluded.preview_width,
+	preview_height = excluded.preview_height,
+	jpeg_path = excluded.jpeg_path,
+	photo_id = excluded.photo_id,
+	rating = excluded.rating,
+	raw_sha256 = excluded.raw_sha256,
+	jpeg_sha256 = excluded.jpeg_sha256,
+	metadata = excluded.metadata,
+	updated_at = excluded.updated_at`
+
+// query selects the row of a raw file.
+const query = `SELECT
+	file_name, create_date, camera_make, camera_model, lens,
+	image_width, image_height, preview_width, preview_height,
+	jpeg_path, photo_id, rating, raw_sha256, jpeg_sha256,
+	metadata, updated_at
+FROM raw_files WHERE file_name = ?`
+
+// Record is a struct representing the row of a raw file in the catalog.
+// Empty and zero values are those not recorded by the RawFile.
+type Record struct {
+	// FileName is the absolute path of the raw file.
+	FileName string
+
+	// CreateDate is the CreateDate of the raw file, in UTC.
+	CreateDate time.Time
+
+	CameraMake, CameraModel     string
+	Lens                        string
+	ImageWidth, ImageHeight     int
+	PreviewWidth, PreviewHeight int
+	JpegPath                    string
+	PhotoID                     string
+	Rating                      int
+	RawSHA256, JpegSHA256       string
+
+	// Metadata is the RawFile, encoded as JSON.
+	Metadata json.RawMessage
+
+	// UpdatedAt is the time the row was last stored.
+	UpdatedAt time.Time
+}
+
+// Catalog is a catalog of raw files stored in a SQLite database.  It is
+// safe for concurrent use, as is the sql.DB.
+type Catalog struct {
+	db *sql.DB
+}
+
+// New creates a Catalog stored in db, creating its table and indexes if
+// they do not exist.
+// Returns the Catalog or error.
+func New(ctx context.Context, db *sql.DB) (*Catalog, error) {
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("catalog: creating schema: %w", err)
+		}
+	}
+	return &Catalog{db: db}, nil
+}
+
+// Put stores a raw file, replacing the row of a raw file of the same
+// absolute path.
+// Returns nil or error.
+func (c *Catalog) Put(ctx context.Context, r *rawparser.RawFile) error {
+	args, err := rowArgs(r)
+	if err != nil {
+		return err
+	}
+	if _, err := c.db.ExecContext(ctx, upsert, args...); err != nil {
+		return fmt.Errorf("catalog: storing %s: %w", r.FileName, err)
+	}
+	return nil
+}
+
+// PutResults stores the parsed raw files of the results of a batch in a
+// single transaction.  Results without a RawFile, e.g., of files that
+// could not be parsed, are skipped.
+// Returns the number of raw files stored or error, in which case none are
+// stored.
+func (c *Catalog) PutResults(ctx context.Context, results []rawparser.BatchResult) (int, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("catalog: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, upsert)
+	if err != nil {
+		return 0, fmt.Errorf("catalog: %w", err)
+	}
+	defer stmt.Close()
+
+	n := 0
+	for _, res := range results {
+		if res.RawFile == nil {
+			continue
+		}
+		args, err := rowArgs(res.RawFile)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return 0, fmt.Errorf("catalog: storing %s: %w", res.RawFile.FileName, err)
+		}
+		n++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("catalog: %w", err)
+	}
+	return n, nil
+}
+
+// Get reads the row of a raw file by path, relative to the working
+// directory or absolute.
+// Returns the Record or error wrapping ErrNotFound.
+func (c *Catalog) Get(ctx context.Context, fileName string) (*Record, error) {
+	fileName, err := filepath.Abs(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("catalog: %w", err)
+	}
+
+	var rec Record
+	var createDate, updatedAt string
+	var metadata []byte
+	err = c.db.QueryRowContext(ctx, query, fileName).Scan(
+		&rec.FileName, &createDate, &rec.CameraMake, &rec.CameraModel, &rec.Lens,
+		&rec.ImageWidth, &rec.ImageHeight, &rec.PreviewWidth, &rec.PreviewHeight,
+		&rec.JpegPath, &rec.PhotoID, &rec.Rating, &rec.RawSHA256, &rec.JpegSHA256,
+		&metadata, &updatedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, fileName)
+	case err != nil:
+		return nil, fmt.Errorf("catalog: reading %s: %w", fileName, err)
+	}
+
+	rec.Metadata = metadata
+	if createDate != "" {
+		rec.CreateDate, err = time.Parse(time.RFC3339Nano, createDate)
+	}
+	if err == nil {
+		rec.UpdatedAt, err = time.Parse(time.RFC3339Nano, updatedAt)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("catalog: reading %s: %w", fileName, err)
+	}
+
+	return &rec, nil
+}
+
+// rowArgs converts a raw file to the arguments of upsert.
+// Returns the arguments or error.
+func rowArgs(r *rawparser.RawFile) ([]any, error) {
+	if r.FileName == "" {
+		return nil, errors.New("catalog: raw file without a file name")
+	}
+	fileName, err := filepath.Abs(r.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("catalog: storing %s: %w", r.FileName, err)
+	}
+	metadata, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("catalog: encoding %s: %w", r.FileName, err)
+	}
+
+	var createDate string
+	if !r.CreateDate.IsZero() {
+		createDate = r.CreateDate.UTC().Format(dateFormat)
+	}
+	var rawSHA256, jpegSHA256 string
+	if c := r.Checksums; c != nil {
+		rawSHA256, jpegSHA256 = c.RawSHA256, c.JpegSHA256
+	}
+
+	return []any{
+		fileName, createDate, r.CameraModel.Make, r.CameraModel.Model, r.Lens.Model,
+		r.ImageWidth, r.ImageHeight, r.PreviewWidth, r.PreviewHeight,
+		r.JpegPath, r.PhotoID, r.Rating, rawSHA256, jpegSHA256,
+		string(metadata), time.Now().UTC().Format(dateFormat),
+	}, nil
+}
@@ -0,0 +1,135 @@
+//go:build sqlite
+
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jeremytorres/rawparser"
+
+	_ "modernc.org/sqlite"
+)
+
+// The tests of this file run the statements of the catalog on SQLite, with
+// the modernc.org/sqlite driver:
+//
+//	go test -tags sqlite ./catalog
+
+func openSQLiteCatalog(t *testing.T) (*Catalog, *sql.DB) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "catalog.db"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// the schema is created once
+	for i := 0; i < 2; i++ {
+		if _, err := New(context.Background(), db); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+	}
+	c, _ := New(context.Background(), db)
+	return c, db
+}
+
+func TestSQLiteCatalogPut(t *testing.T) {
+	c, db := openSQLiteCatalog(t)
+	ctx := context.Background()
+	t.Chdir(t.TempDir())
+
+	// the later of two raw files recorded with different offsets sorts
+	// after the earlier
+	plus2 := time.FixedZone("", 2*60*60)
+	earlier := &rawparser.RawFile{FileName: "a.NEF", CreateDate: time.Date(2019, 10, 11, 12, 13, 14, 0, plus2)}
+	later := &rawparser.RawFile{FileName: "b.NEF", CreateDate: time.Date(2019, 10, 11, 11, 0, 0, 500, time.UTC), Rating: 2}
+	for _, r := range []*rawparser.RawFile{later, earlier} {
+		if err := c.Put(ctx, r); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+	}
+
+	// stored again, by absolute path, updates the row
+	abs, _ := filepath.Abs(later.FileName)
+	later.FileName, later.Rating = abs, 4
+	if err := c.Put(ctx, later); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT file_name FROM raw_files WHERE create_date >= ? ORDER BY create_date",
+		time.Date(2019, 10, 11, 0, 0, 0, 0, time.UTC).Format(dateFormat))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		names = append(names, filepath.Base(name))
+	}
+	if len(names) != 2 || names[0] != "a.NEF" || names[1] != "b.NEF" {
+		t.Errorf("Unexpected rows by date: %v\n", names)
+	}
+
+	rec, err := c.Get(ctx, "b.NEF")
+	if err != nil || rec.FileName != abs || rec.Rating != 4 || !rec.CreateDate.Equal(later.CreateDate) || rec.UpdatedAt.IsZero() {
+		t.Errorf("Unexpected record: %+v, %v\n", rec, err)
+	}
+	if _, err := c.Get(ctx, "missing.NEF"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound; got %v\n", err)
+	}
+}
+
+func TestSQLiteCatalogPutResults(t *testing.T) {
+	c, db := openSQLiteCatalog(t)
+	ctx := context.Background()
+
+	results := []rawparser.BatchResult{
+		{File: "a.NEF", RawFile: &rawparser.RawFile{FileName: "/photos/a.NEF"}},
+		{File: "b.NEF", Err: errors.New("unreadable")},
+		{File: "c.NEF", RawFile: &rawparser.RawFile{FileName: "/photos/c.NEF"}},
+	}
+	if n, err := c.PutResults(ctx, results); err != nil || n != 2 {
+		t.Errorf("Expected 2 raw files stored; got %d, %v\n", n, err)
+	}
+
+	// a failure stores none of the results
+	results = append(results, rawparser.BatchResult{RawFile: &rawparser.RawFile{}})
+	results[0].RawFile = &rawparser.RawFile{FileName: "/photos/d.NEF"}
+	if n, err := c.PutResults(ctx, results); err == nil || n != 0 {
+		t.Errorf("Expected none stored; got %d, %v\n", n, err)
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM raw_files").Scan(&count); err != nil || count != 2 {
+		t.Errorf("Expected 2 rows; got %d, %v\n", count, err)
+	}
+}
@@ -0,0 +1,233 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jeremytorres/rawparser"
+)
+
+// testDriver is a database/sql driver emulating the statements of the
+// catalog on a map of rows keyed by file name.  Writes of a transaction are
+// applied on commit.  The statements themselves are run on SQLite by the
+// tests of catalog_sqlite_test.go.
+type testDriver struct {
+	mu   sync.Mutex
+	rows map[string][]driver.Value
+}
+
+type testConn struct {
+	d       *testDriver
+	pending map[string][]driver.Value // nil outside a transaction
+}
+
+type testStmt struct {
+	c     *testConn
+	query string
+}
+
+type testRows struct {
+	row  []driver.Value
+	done bool
+}
+
+func (d *testDriver) Open(name string) (driver.Conn, error) { return &testConn{d: d}, nil }
+
+func (c *testConn) Prepare(query string) (driver.Stmt, error) { return &testStmt{c, query}, nil }
+func (c *testConn) Close() error                              { return nil }
+func (c *testConn) Begin() (driver.Tx, error) {
+	c.pending = make(map[string][]driver.Value)
+	return c, nil
+}
+
+func (c *testConn) Commit() error {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	for k, v := range c.pending {
+		c.d.rows[k] = v
+	}
+	c.pending = nil
+	return nil
+}
+
+func (c *testConn) Rollback() error {
+	c.pending = nil
+	return nil
+}
+
+func (s *testStmt) Close() error  { return nil }
+func (s *testStmt) NumInput() int { return -1 }
+
+func (s *testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	switch {
+	case strings.HasPrefix(s.query, "CREATE"):
+	case strings.HasPrefix(s.query, "INSERT") && len(args) == 16:
+		name := args[0].(string)
+		if name == "" {
+			return nil, errors.New("NOT NULL constraint failed")
+		}
+		if s.c.pending != nil {
+			s.c.pending[name] = args
+			break
+		}
+		s.c.d.mu.Lock()
+		s.c.d.rows[name] = args
+		s.c.d.mu.Unlock()
+	default:
+		return nil, errors.New("unexpected statement: " + s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.c.d.mu.Lock()
+	defer s.c.d.mu.Unlock()
+	return &testRows{row: s.c.d.rows[args[0].(string)], done: s.c.d.rows[args[0].(string)] == nil}, nil
+}
+
+func (r *testRows) Columns() []string { return make([]string, 16) }
+func (r *testRows) Close() error      { return nil }
+func (r *testRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	copy(dest, r.row)
+	r.done = true
+	return nil
+}
+
+func openTestCatalog(t *testing.T) (*Catalog, *testDriver) {
+	d := &testDriver{rows: make(map[string][]driver.Value)}
+	db := sql.OpenDB(connector{d})
+	t.Cleanup(func() { db.Close() })
+
+	c, err := New(context.Background(), db)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	return c, d
+}
+
+// connector opens connections of a testDriver.
+type connector struct{ d *testDriver }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c connector) Driver() driver.Driver                        { return c.d }
+
+func TestCatalogPut(t *testing.T) {
+	c, _ := openTestCatalog(t)
+	ctx := context.Background()
+	date := time.Date(2019, 10, 11, 12, 13, 14, 0, time.UTC)
+
+	r := &rawparser.RawFile{
+		FileName:    "/photos/DSC_0001.NEF",
+		CreateDate:  date,
+		CameraModel: rawparser.CameraModel{Make: "NIKON CORPORATION", Model: "NIKON D700"},
+		JpegPath:    "/previews/DSC_0001.jpg",
+		Checksums:   &rawparser.Checksums{RawSHA256: "abc"},
+	}
+	if err := c.Put(ctx, r); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	// stored again by path
+	r.Rating = 4
+	if err := c.Put(ctx, r); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	rec, err := c.Get(ctx, r.FileName)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if !rec.CreateDate.Equal(date) || rec.CameraModel != "NIKON D700" || rec.JpegPath != r.JpegPath ||
+		rec.RawSHA256 != "abc" || rec.Rating != 4 || rec.UpdatedAt.IsZero() {
+		t.Errorf("Unexpected record: %+v\n", rec)
+	}
+	if !strings.Contains(string(rec.Metadata), `"cameraModel":{"make":"NIKON CORPORATION"`) {
+		t.Errorf("Unexpected metadata: %s\n", rec.Metadata)
+	}
+
+	if _, err := c.Get(ctx, "/photos/missing.NEF"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound; got %v\n", err)
+	}
+}
+
+func TestCatalogPutNormalized(t *testing.T) {
+	c, d := openTestCatalog(t)
+	ctx := context.Background()
+	t.Chdir(t.TempDir())
+
+	// the same raw file by relative and absolute path
+	date := time.Date(2019, 10, 11, 12, 13, 14, 500, time.FixedZone("", 2*60*60))
+	r := &rawparser.RawFile{FileName: "DSC_0001.NEF", CreateDate: date}
+	if err := c.Put(ctx, r); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	abs, _ := filepath.Abs(r.FileName)
+	r.FileName = abs
+	if err := c.Put(ctx, r); err != nil || len(d.rows) != 1 {
+		t.Fatalf("Expected a row; got %d, %v\n", len(d.rows), err)
+	}
+
+	if got := d.rows[abs][1]; got != "2019-10-11T10:13:14.000000500Z" {
+		t.Errorf("Unexpected create_date: %v\n", got)
+	}
+	rec, err := c.Get(ctx, "DSC_0001.NEF")
+	if err != nil || rec.FileName != abs || !rec.CreateDate.Equal(date) || rec.CreateDate.Location() != time.UTC {
+		t.Errorf("Unexpected record: %+v, %v\n", rec, err)
+	}
+}
+
+func TestCatalogPutResults(t *testing.T) {
+	c, d := openTestCatalog(t)
+	ctx := context.Background()
+
+	results := []rawparser.BatchResult{
+		{File: "a.NEF", RawFile: &rawparser.RawFile{FileName: "a.NEF"}},
+		{File: "b.NEF", Err: errors.New("unreadable")},
+		{File: "c.NEF", RawFile: &rawparser.RawFile{FileName: "c.NEF"}},
+	}
+	if n, err := c.PutResults(ctx, results); err != nil || n != 2 || len(d.rows) != 2 {
+		t.Errorf("Expected 2 raw files stored; got %d, %v\n", n, err)
+	}
+
+	// a failure stores none of the results
+	results = append(results, rawparser.BatchResult{RawFile: &rawparser.RawFile{}})
+	results[0].RawFile = &rawparser.RawFile{FileName: "d.NEF"}
+	abs, _ := filepath.Abs("d.NEF")
+	if n, err := c.PutResults(ctx, results); err == nil || n != 0 || d.rows[abs] != nil {
+		t.Errorf("Expected none stored; got %d, %v\n", n, err)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+)
+
+// Checksum selects the checksums of the raw file and of the extracted
+// preview computed while processing a raw file; see RawFile.Checksums.
+// Checksums may be combined, e.g., ChecksumSHA256 | ChecksumXXH64.
+type Checksum int
+
+const (
+	// ChecksumSHA256 computes the SHA-256, a cryptographic hash.
+	ChecksumSHA256 Checksum = 1 << iota
+
+	// ChecksumXXH64 computes the 64-bit xxHash, a fast non-cryptographic
+	// hash suited to detecting duplicate files.
+	ChecksumXXH64
+)
+
+// Checksums is a struct representing the hex-encoded checksums of a raw
+// file and of its extracted preview.  Checksums not requested, and the
+// checksums of a preview that was not extracted, are empty.
+type Checksums struct {
+	RawSHA256  string `json:"rawSHA256,omitempty"`
+	RawXXH64   string `json:"rawXXH64,omitempty"`
+	JpegSHA256 string `json:"jpegSHA256,omitempty"`
+	JpegXXH64  string `json:"jpegXXH64,omitempty"`
+}
+
+// checksumRaw computes the selected checksums of the content of a raw
+// file.
+// Returns the checksums or error.
+func checksumRaw(f *rawSource, which Checksum) (*Checksums, error) {
+	size, err := f.Size()
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(Checksums)
+	c.RawSHA256, c.RawXXH64, err = checksum(io.NewSectionReader(f, 0, size), which)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// checksumPreview computes the selected checksums of an extracted preview
+// file.
+// Returns error.
+func (c *Checksums) checksumPreview(name string, which Checksum) error {
+	c.JpegSHA256, c.JpegXXH64 = "", ""
+
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	c.JpegSHA256, c.JpegXXH64, err = checksum(f, which)
+	return err
+}
+
+// checksum computes the selected checksums of the content of r in a
+// single pass.
+// Returns the hex-encoded SHA-256 and XXH64, empty if not selected, or
+// error.
+func checksum(r io.Reader, which Checksum) (sha, xxh string, err error) {
+	var hashes []hash.Hash
+	var shaHash, xxhHash hash.Hash
+	if which&ChecksumSHA256 != 0 {
+		shaHash = sha256.New()
+		hashes = append(hashes, shaHash)
+	}
+	if which&ChecksumXXH64 != 0 {
+		xxhHash = newXXH64()
+		hashes = append(hashes, xxhHash)
+	}
+	if len(hashes) == 0 {
+		return "", "", nil
+	}
+
+	w := make([]io.Writer, len(hashes))
+	for i, h := range hashes {
+		w[i] = h
+	}
+	if _, err := io.Copy(io.MultiWriter(w...), r); err != nil {
+		return "", "", err
+	}
+
+	if shaHash != nil {
+		sha = hex.EncodeToString(shaHash.Sum(nil))
+	}
+	if xxhHash != nil {
+		xxh = hex.EncodeToString(xxhHash.Sum(nil))
+	}
+	return sha, xxh, nil
+}
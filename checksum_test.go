@@ -0,0 +1,130 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"testing"
+)
+
+func TestXXH64(t *testing.T) {
+	vectors := []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	}
+
+	for _, v := range vectors {
+		h := newXXH64()
+		h.Write([]byte(v.in))
+		if got := h.Sum64(); got != v.want {
+			t.Errorf("XXH64(%q): expected %016x; got %016x\n", v.in, v.want, got)
+		}
+	}
+
+	// the hash must not depend on how the input is split
+	data := bytes.Repeat([]byte("0123456789abcdef"), 20)
+	whole := newXXH64()
+	whole.Write(data)
+	for _, chunk := range []int{1, 7, 31, 32, 33, 100} {
+		h := newXXH64()
+		for p := data; len(p) > 0; {
+			n := min(chunk, len(p))
+			h.Write(p[:n])
+			p = p[n:]
+		}
+		if h.Sum64() != whole.Sum64() {
+			t.Errorf("XXH64 in chunks of %d: expected %016x; got %016x\n", chunk, whole.Sum64(), h.Sum64())
+		}
+	}
+}
+
+func TestProcessFileChecksums(t *testing.T) {
+	data := buildTestNrw(t, true)
+	path, dir := writeTestFile(t, "checksum.NRW", data)
+	p, _ := NewNrwParser(isHostLittleEndian())
+
+	r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if r.Checksums != nil {
+		t.Errorf("Unexpected checksums: %+v\n", r.Checksums)
+	}
+
+	r, err = p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Checksums: ChecksumSHA256 | ChecksumXXH64})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	c := r.Checksums
+	if c == nil {
+		t.Fatalf("Expected checksums\n")
+	}
+
+	rawSha := sha256.Sum256(data)
+	if c.RawSHA256 != hex.EncodeToString(rawSha[:]) {
+		t.Errorf("Unexpected raw SHA-256: %s\n", c.RawSHA256)
+	}
+	h := newXXH64()
+	h.Write(data)
+	if c.RawXXH64 != hex.EncodeToString(h.Sum(nil)) {
+		t.Errorf("Unexpected raw XXH64: %s\n", c.RawXXH64)
+	}
+
+	jpeg, err := os.ReadFile(r.JpegPath)
+	if err != nil {
+		t.Fatalf("Extracted jpeg not found: %v\n", err)
+	}
+	jpegSha := sha256.Sum256(jpeg)
+	if c.JpegSHA256 != hex.EncodeToString(jpegSha[:]) {
+		t.Errorf("Unexpected jpeg SHA-256: %s\n", c.JpegSHA256)
+	}
+	if len(c.JpegXXH64) != 16 || c.JpegXXH64 == c.RawXXH64 {
+		t.Errorf("Unexpected jpeg XXH64: %s\n", c.JpegXXH64)
+	}
+
+	// only the selected checksums; no preview checksums without extraction
+	r, err = p.ProcessFile(&RawFileInfo{File: path, Checksums: ChecksumXXH64, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if got := *r.Checksums; got != (Checksums{RawXXH64: c.RawXXH64}) {
+		t.Errorf("Unexpected checksums: %+v\n", got)
+	}
+
+	// re-extraction updates the preview checksums
+	if _, err := r.Extract(&RawFileInfo{DestDir: dir, Checksums: ChecksumSHA256}); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if r.Checksums.JpegSHA256 != c.JpegSHA256 || r.Checksums.RawSHA256 != c.RawSHA256 {
+		t.Errorf("Unexpected checksums after Extract: %+v\n", r.Checksums)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+// Command rawdump prints the IFDs of TIFF-based raw files: every IFD, with
+// the tag, name, field type, count, and value of its entries, e.g., to
+// report a raw file of an unsupported camera.
+//
+// Usage:
+//
+//	rawdump [-json] file...
+//
+// The IFDs referenced by an IFD (SubIFDs, EXIF, GPS, and interoperability)
+// are indented below it.  With -json, the dump of each file is written as
+// a line of JSON (see rawparser.IFDDump).
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/jeremytorres/rawparser"
+)
+
+func main() {
+	asJSON := flag.Bool("json", false, "write the dump of each file as a line of JSON")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-json] file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// the library logs its progress
+	log.SetOutput(io.Discard)
+
+	status := 0
+	enc := json.NewEncoder(os.Stdout)
+	for _, name := range flag.Args() {
+		dump, err := rawparser.DumpIFDs(&rawparser.RawFileInfo{File: name})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			status = 1
+			continue
+		}
+
+		if *asJSON {
+			err = enc.Encode(dump)
+		} else {
+			err = writeDump(os.Stdout, dump)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			os.Exit(1)
+		}
+	}
+	os.Exit(status)
+}
+
+// writeDump writes the IFDs of a raw file as indented text.
+// Returns nil on success or error.
+func writeDump(w io.Writer, dump *rawparser.IFDDump) error {
+	if _, err := fmt.Fprintf(w, "%s (%s)\n", dump.FileName, dump.ByteOrder); err != nil {
+		return err
+	}
+	for _, ifd := range dump.IFDs {
+		if err := writeIFD(w, ifd, 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeIFD writes an IFD and its children, indented by depth.
+// Returns nil on success or error.
+func writeIFD(w io.Writer, ifd *rawparser.DumpedIFD, depth int) error {
+	indent := strings.Repeat("  ", depth)
+	_, err := fmt.Fprintf(w, "%s+ %s%d at offset %d, %d entries\n", indent, ifd.Kind, ifd.Index, ifd.Offset, len(ifd.Entries))
+	if err != nil {
+		return err
+	}
+
+	for i, e := range ifd.Entries {
+		name := e.Name
+		if name == "" {
+			name = "Unknown"
+		}
+		at := ""
+		if e.Offset > 0 {
+			at = fmt.Sprintf(" at offset %d", e.Offset)
+		}
+		_, err := fmt.Fprintf(w, "%s| %2d) %s = %s\n%s|     - Tag 0x%04x (%d %s%s)\n",
+			indent, i, name, e.Value, indent, e.Tag, e.Count, e.Type, at)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, child := range ifd.Children {
+		if err := writeIFD(w, child, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
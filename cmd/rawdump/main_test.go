@@ -0,0 +1,71 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jeremytorres/rawparser"
+)
+
+func TestWriteDump(t *testing.T) {
+	dump := &rawparser.IFDDump{
+		FileName:  "test.NEF",
+		ByteOrder: "MM",
+		IFDs: []*rawparser.DumpedIFD{{
+			Kind: "IFD", Offset: 8,
+			Entries: []rawparser.DumpedEntry{
+				{Tag: 0x0110, Name: "Model", Type: "ASCII", Count: 10, Offset: 200, Value: `"NIKON D90"`},
+				{Tag: 0x8769, Name: "ExifIFD", Type: "LONG", Count: 1, Value: "300"},
+			},
+			Children: []*rawparser.DumpedIFD{{
+				Kind: "EXIF", Offset: 300,
+				Entries: []rawparser.DumpedEntry{{Tag: 0x9999, Type: "SHORT", Count: 1, Value: "7"}},
+			}},
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeDump(&buf, dump); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	want := strings.Join([]string{
+		"test.NEF (MM)",
+		"  + IFD0 at offset 8, 2 entries",
+		`  |  0) Model = "NIKON D90"`,
+		"  |     - Tag 0x0110 (10 ASCII at offset 200)",
+		"  |  1) ExifIFD = 300",
+		"  |     - Tag 0x8769 (1 LONG)",
+		"    + EXIF0 at offset 300, 1 entries",
+		"    |  0) Unknown = 7",
+		"    |     - Tag 0x9999 (1 SHORT)",
+		"",
+	}, "\n")
+	if buf.String() != want {
+		t.Errorf("Unexpected dump:\n%s\nexpected:\n%s\n", buf.String(), want)
+	}
+}
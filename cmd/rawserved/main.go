@@ -0,0 +1,314 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+// Command rawserved serves the embedded previews and metadata of raw files
+// over HTTP.
+//
+// Usage:
+//
+//	rawserved [-addr :8080] [-grpc-addr :9090] [-root dir] [-max-upload bytes]
+//		[-max-preview-memory bytes] [-srgb]
+//
+// Endpoints:
+//
+//	POST /preview    upload a raw file; responds with the preview JPEG
+//	POST /metadata   upload a raw file; responds with the metadata JSON
+//	GET  /preview?path=p, GET /metadata?path=p
+//	                 process the raw file p, relative to -root
+//	GET  /metrics    the Prometheus metrics of the raw files processed
+//
+// A raw file is uploaded either as the request body, with its format given
+// by the "format" query parameter (e.g., "NEF"), or as the "file" field of
+// a multipart form, with its format given by the file name extension.  The
+// "quality" query parameter sets the JPEG quality of the preview (default
+// 85).  Paths are served only if -root is set and cannot escape it.  With
+// -srgb, previews in Adobe RGB are converted to sRGB, as browsers assume.
+// A preview larger than -max-preview-memory (default 64 MB) is served as is
+// rather than decoded and re-encoded.
+//
+// With -grpc-addr, the RawParser gRPC service of rpc/rawparser.proto is
+// also served, over HTTP/2 without TLS; see the rpc package.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/jeremytorres/rawparser"
+	"github.com/jeremytorres/rawparser/metrics"
+	"github.com/jeremytorres/rawparser/rpc"
+)
+
+const defaultQuality = 85
+
+// server handles the HTTP requests.
+type server struct {
+	// root is the directory of the raw files served by path; nil if
+	// disabled.
+	root *os.Root
+
+	// maxUpload is the largest raw file accepted by upload, in bytes.
+	maxUpload int64
+
+	// maxPreviewMemory is the memory budget of the preview of a raw file,
+	// in bytes; see rawparser.RawFileInfo.MaxPreviewMemory.
+	maxPreviewMemory int64
+
+	// metrics records the raw files processed; nil if disabled.
+	metrics *metrics.Metrics
+
+	// toSRGB converts previews in Adobe RGB to sRGB.
+	toSRGB bool
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	rootDir := flag.String("root", "", "directory of the raw files served by path; disabled if empty")
+	maxUpload := flag.Int64("max-upload", 256<<20, "largest raw file accepted by upload, in bytes")
+	maxPreviewMemory := flag.Int64("max-preview-memory", 64<<20, "memory budget of the preview of a raw file, in bytes; larger previews are served as is")
+	grpcAddr := flag.String("grpc-addr", "", "address to serve the gRPC service on; disabled if empty")
+	toSRGB := flag.Bool("srgb", false, "convert previews in Adobe RGB to sRGB")
+	flag.Parse()
+
+	s := &server{maxUpload: *maxUpload, maxPreviewMemory: *maxPreviewMemory, metrics: metrics.New(), toSRGB: *toSRGB}
+	if *rootDir != "" {
+		root, err := os.OpenRoot(*rootDir)
+		if err != nil {
+			log.Fatalf("Error opening root: %v\n", err)
+		}
+		defer root.Close()
+		s.root = root
+	}
+
+	if *grpcAddr != "" {
+		srv := &http.Server{Addr: *grpcAddr, Handler: rpc.NewServer(s.root, s.maxUpload, s.maxPreviewMemory)}
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetUnencryptedHTTP2(true)
+		go func() {
+			log.Printf("Serving gRPC on %s\n", *grpcAddr)
+			log.Fatal(srv.ListenAndServe())
+		}()
+	}
+
+	log.Printf("Listening on %s\n", *addr)
+	log.Fatal(http.ListenAndServe(*addr, s.handler()))
+}
+
+// handler returns the routes of the server.
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/preview", func(w http.ResponseWriter, req *http.Request) {
+		s.serve(w, req, s.writePreview)
+	})
+	mux.HandleFunc("/metadata", func(w http.ResponseWriter, req *http.Request) {
+		s.serve(w, req, writeMetadata)
+	})
+	if s.metrics != nil {
+		mux.Handle("/metrics", s.metrics)
+	}
+	return mux
+}
+
+// responder writes the response for a parsed raw file, read from f.
+type responder func(w http.ResponseWriter, req *http.Request, f *os.File, r *rawparser.RawFile) error
+
+// serve opens the raw file of a request, by upload or path, parses it, and
+// writes the response.
+func (s *server) serve(w http.ResponseWriter, req *http.Request, respond responder) {
+	var f *os.File
+	var key string
+	var err error
+	switch req.Method {
+	case http.MethodPost:
+		f, key, err = s.upload(w, req)
+		if f != nil {
+			defer os.Remove(f.Name())
+		}
+	case http.MethodGet:
+		f, key, err = s.open(req.URL.Query().Get("path"))
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if f != nil {
+		defer f.Close()
+	}
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	p := rawparser.NewFormatParser(key)
+	if p == nil {
+		httpError(w, fmt.Errorf("%w: %q", rawparser.ErrUnknownFormat, key))
+		return
+	}
+
+	start := time.Now()
+	r, err := p.ProcessFile(&rawparser.RawFileInfo{File: f.Name(), Handle: f, SkipExtraction: true})
+	if err == nil {
+		err = respond(w, req, f, r)
+	}
+	if s.metrics != nil {
+		s.metrics.Observe(key, time.Since(start), r, err)
+	}
+	if err != nil {
+		httpError(w, err)
+	}
+}
+
+// upload spools the raw file uploaded by a request to a temporary file.
+// Returns the file, the key of its format, or error.
+func (s *server) upload(w http.ResponseWriter, req *http.Request) (*os.File, string, error) {
+	body := http.MaxBytesReader(w, req.Body, s.maxUpload)
+	key := req.URL.Query().Get("format")
+
+	var src io.Reader = body
+	if mr, err := req.MultipartReader(); err == nil {
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				return nil, "", badRequest("missing file field: %v", err)
+			}
+			if part.FormName() == "file" {
+				src = part
+				if key == "" {
+					key = filepath.Ext(part.FileName())
+				}
+				break
+			}
+		}
+	}
+	if key == "" {
+		return nil, "", badRequest("unknown raw format: set the format parameter")
+	}
+
+	tmp, err := os.CreateTemp("", "rawserved-*")
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := io.Copy(tmp, src); err != nil {
+		return tmp, "", err
+	}
+	return tmp, key, nil
+}
+
+// open opens a raw file by its path relative to the root of the server.
+// Returns the file, the key of its format, or error.
+func (s *server) open(path string) (*os.File, string, error) {
+	if s.root == nil {
+		return nil, "", statusError{http.StatusForbidden, "serving paths is disabled"}
+	}
+	if !filepath.IsLocal(path) {
+		return nil, "", badRequest("invalid path: %q", path)
+	}
+
+	f, err := s.root.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, filepath.Ext(path), nil
+}
+
+// writePreview writes the preview of a raw file as JPEG.
+func (s *server) writePreview(w http.ResponseWriter, req *http.Request, f *os.File, r *rawparser.RawFile) error {
+	quality := defaultQuality
+	if q := req.URL.Query().Get("quality"); q != "" {
+		var err error
+		if quality, err = strconv.Atoi(q); err != nil || quality < 1 || quality > 100 {
+			return badRequest("invalid quality: %q", q)
+		}
+	}
+
+	// encode before writing the header, so that errors are reported
+	var buf bytes.Buffer
+	if err := r.ExtractJpegTo(&buf, &rawparser.RawFileInfo{Handle: f, Quality: quality, ConvertToSRGB: s.toSRGB, MaxPreviewMemory: s.maxPreviewMemory}); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// writeMetadata writes the metadata of a raw file as JSON.
+func writeMetadata(w http.ResponseWriter, _ *http.Request, _ *os.File, r *rawparser.RawFile) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+	return err
+}
+
+// statusError is an error with an HTTP status code.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e statusError) Error() string {
+	return e.msg
+}
+
+// badRequest creates a statusError with the status 400 Bad Request.
+func badRequest(format string, args ...any) error {
+	return statusError{http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
+
+// httpError writes an error response, with the status code matching the
+// error.
+func httpError(w http.ResponseWriter, err error) {
+	var se statusError
+	var maxBytes *http.MaxBytesError
+	code := http.StatusUnprocessableEntity
+	switch {
+	case errors.As(err, &se):
+		code = se.code
+	case errors.As(err, &maxBytes):
+		code = http.StatusRequestEntityTooLarge
+	case errors.Is(err, rawparser.ErrUnknownFormat):
+		code = http.StatusUnsupportedMediaType
+	case errors.Is(err, rawparser.ErrNoPreview):
+		code = http.StatusNotFound
+	case errors.Is(err, os.ErrNotExist):
+		code = http.StatusNotFound
+	case errors.Is(err, os.ErrPermission):
+		code = http.StatusForbidden
+	}
+	if code == http.StatusUnprocessableEntity {
+		log.Printf("Error: %v\n", err)
+	}
+	http.Error(w, err.Error(), code)
+}
@@ -0,0 +1,190 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/jpeg"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jeremytorres/rawparser/metrics"
+)
+
+const testFiles = "../../test_files"
+
+func newTestServer(t *testing.T) *httptest.Server {
+	root, err := os.OpenRoot(testFiles)
+	if err != nil {
+		t.Fatalf("Error opening root: %v\n", err)
+	}
+	t.Cleanup(func() { root.Close() })
+
+	ts := httptest.NewServer((&server{root: root, maxUpload: 64 << 20, metrics: metrics.New()}).handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestUploadPreview(t *testing.T) {
+	ts := newTestServer(t)
+	data, err := os.ReadFile(testFiles + "/big_endian.NEF")
+	if err != nil {
+		t.Fatalf("Error reading test file: %v\n", err)
+	}
+
+	resp, err := http.Post(ts.URL+"/preview?format=NEF&quality=50", "application/octet-stream", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("Unexpected response: %s\n", resp.Status)
+	}
+	cfg, err := jpeg.DecodeConfig(resp.Body)
+	if err != nil || cfg.Width != 4256 || cfg.Height != 2832 {
+		t.Errorf("Unexpected preview: %+v, %v\n", cfg, err)
+	}
+}
+
+func TestUploadMetadata(t *testing.T) {
+	ts := newTestServer(t)
+	data, err := os.ReadFile(testFiles + "/little_endian.CR2")
+	if err != nil {
+		t.Fatalf("Error reading test file: %v\n", err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "IMG_0001.CR2")
+	fw.Write(data)
+	mw.Close()
+
+	resp, err := http.Post(ts.URL+"/metadata", mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected response: %s\n", resp.Status)
+	}
+	var meta map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		t.Fatalf("Error decoding metadata: %v\n", err)
+	}
+	if meta["createDate"] == nil || meta["imageWidth"] == nil {
+		t.Errorf("Unexpected metadata: %v\n", meta)
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		method, url string
+		want        int
+	}{
+		{http.MethodGet, "/metadata?path=big_endian.NEF", http.StatusOK},
+		{http.MethodGet, "/metadata?path=../README.md", http.StatusBadRequest},
+		{http.MethodGet, "/metadata?path=/etc/passwd", http.StatusBadRequest},
+		{http.MethodGet, "/metadata?path=missing.NEF", http.StatusNotFound},
+		{http.MethodGet, "/metadata?path=COPYRIGHT.txt", http.StatusUnsupportedMediaType},
+		{http.MethodGet, "/preview?path=little_endian_no_jpeg.NEF", http.StatusOK}, // maker note preview
+		{http.MethodGet, "/preview?path=big_endian.NEF&quality=101", http.StatusBadRequest},
+		{http.MethodPost, "/preview", http.StatusBadRequest},
+		{http.MethodPut, "/preview", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, ts.URL+tt.url, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s %s: expected %d; got %s\n", tt.method, tt.url, tt.want, resp.Status)
+		}
+	}
+
+	// a NEF without an embedded jpeg: IFD0 with a single NewSubfileType
+	noJpeg := []byte{'I', 'I', 42, 0, 8, 0, 0, 0, 1, 0, 0xfe, 0, 4, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	resp, err := http.Post(ts.URL+"/preview?format=NEF", "application/octet-stream", bytes.NewReader(noJpeg))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected %d for a NEF without a preview; got %s\n", http.StatusNotFound, resp.Status)
+	}
+
+	// paths are served only with a root
+	ts = httptest.NewServer((&server{}).handler())
+	defer ts.Close()
+	resp, err = http.Get(ts.URL + "/metadata?path=big_endian.NEF")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected %d; got %s\n", http.StatusForbidden, resp.Status)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	ts := newTestServer(t)
+	for _, path := range []string{"big_endian.NEF", "little_endian.CR2", "missing.NEF"} {
+		resp, err := http.Get(ts.URL + "/metadata?path=" + path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected response: %s, %v\n", resp.Status, err)
+	}
+
+	// a file not found is not processed
+	for _, want := range []string{
+		`rawparser_files_total{format="CR2"} 1`,
+		`rawparser_files_total{format="NEF"} 1`,
+		`rawparser_processing_seconds_count{format="NEF"} 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected %q in metrics:\n%s\n", want, body)
+		}
+	}
+}
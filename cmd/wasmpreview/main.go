@@ -0,0 +1,93 @@
+//go:build js && wasm
+
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+// Command wasmpreview extracts the preview of a raw file in a web browser,
+// e.g., to show a preview of a raw file before it is uploaded.  It is
+// compiled to WebAssembly:
+//
+//	GOOS=js GOARCH=wasm go build -o rawpreview.wasm github.com/jeremytorres/rawparser/cmd/wasmpreview
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" .
+//
+// and defines the JavaScript function rawPreview(bytes, name), of the
+// bytes of a raw file (a Uint8Array, e.g., of the arrayBuffer of a File)
+// and its name, whose extension identifies TIFF-based formats.  It
+// returns the preview, a JPEG with the EXIF metadata of the raw file, as
+// a Uint8Array, or throws an Error.  index.html, in this directory, shows
+// the preview of a File selected by an <input type="file">.
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"syscall/js"
+
+	"github.com/jeremytorres/rawparser"
+)
+
+// previewQuality is the JPEG quality of the preview.
+const previewQuality = 85
+
+func main() {
+	// the library logs its progress
+	log.SetOutput(io.Discard)
+
+	js.Global().Set("rawPreview", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) != 2 || args[0].Type() != js.TypeObject || args[1].Type() != js.TypeString {
+			panic(js.Global().Get("Error").New("usage: rawPreview(bytes, name)"))
+		}
+		data := make([]byte, args[0].Get("length").Int())
+		js.CopyBytesToGo(data, args[0])
+
+		jpeg, err := preview(data, args[1].String())
+		if err != nil {
+			panic(js.Global().Get("Error").New(err.Error()))
+		}
+		out := js.Global().Get("Uint8Array").New(len(jpeg))
+		js.CopyBytesToJS(out, jpeg)
+		return out
+	}))
+
+	// serve calls until the page is closed
+	select {}
+}
+
+// preview extracts the preview of a raw file held in memory, without
+// files, as a JPEG with the EXIF metadata of the raw file, e.g., its
+// orientation, which browsers apply.
+// Returns the JPEG or error.
+func preview(data []byte, name string) ([]byte, error) {
+	r, err := rawparser.ProcessBytes(data, &rawparser.RawFileInfo{File: name, SkipExtraction: true})
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	info := &rawparser.RawFileInfo{File: name, Reader: bytes.NewReader(data), Quality: previewQuality, PreserveExif: true}
+	if err := r.ExtractJpegTo(&b, info); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
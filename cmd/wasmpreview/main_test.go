@@ -0,0 +1,53 @@
+//go:build js && wasm
+
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"bytes"
+	"image/jpeg"
+	"os"
+	"testing"
+)
+
+func TestPreview(t *testing.T) {
+	for _, name := range []string{"../../test_files/big_endian.NEF", "../../test_files/little_endian.CR2"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("Error reading test file: %v\n", err)
+		}
+		out, err := preview(data, name)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v\n", name, err)
+		}
+		if _, err := jpeg.DecodeConfig(bytes.NewReader(out)); err != nil {
+			t.Errorf("%s: unexpected error decoding the preview: %v\n", name, err)
+		}
+	}
+
+	if _, err := preview([]byte("not a raw file"), "file.NEF"); err == nil {
+		t.Errorf("Expected an error for a file that is not a raw file\n")
+	}
+}
@@ -0,0 +1,313 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sync"
+)
+
+// ColorSpace is the color space of the embedded preview of a raw file, as
+// recorded by the EXIF ColorSpace and InteroperabilityIndex.
+type ColorSpace uint8
+
+const (
+	ColorSpaceUnknown  ColorSpace = iota // not recorded, or uncalibrated
+	ColorSpaceSRGB                       // sRGB
+	ColorSpaceAdobeRGB                   // Adobe RGB (1998)
+)
+
+// String returns the name of the color space, e.g., "Adobe RGB".
+func (c ColorSpace) String() string {
+	switch c {
+	case ColorSpaceUnknown:
+		return "Unknown"
+	case ColorSpaceSRGB:
+		return "sRGB"
+	case ColorSpaceAdobeRGB:
+		return "Adobe RGB"
+	}
+	return fmt.Sprintf("ColorSpace(%d)", int(c))
+}
+
+// MarshalText encodes the color space by name.
+func (c ColorSpace) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// colorSpaceOf determines the color space recorded by the EXIF ColorSpace
+// and InteroperabilityIndex: an uncalibrated ColorSpace is Adobe RGB by the
+// "R03" index of the Design rule for Camera File system (DCF) option file.
+func colorSpaceOf(exif uint16, interop string) ColorSpace {
+	switch {
+	case exif == 1:
+		return ColorSpaceSRGB
+	case exif == 2:
+		return ColorSpaceAdobeRGB
+	case exif == 0xffff && interop == "R03":
+		return ColorSpaceAdobeRGB
+	case exif == 0xffff && interop == "R98":
+		return ColorSpaceSRGB
+	}
+	return ColorSpaceUnknown
+}
+
+// processColorSpaceEntry records the EXIF ColorSpace of the EXIF IFD.
+// Errors are not fatal as the tag is optional.
+func processColorSpaceEntry(entry *IfdEntry, m *rawMetadata) {
+	if entry.tag == 0xa001 { // ColorSpace
+		if v, err := entry.Uint16(); err == nil {
+			m.colorSpace = v
+		}
+	}
+}
+
+// previewSpace determines the color space of the preview of a RawFile to
+// convert to sRGB, if info.ConvertToSRGB is set: the ColorSpace of the raw
+// file, ColorSpaceUnknown to detect it by the ICC profile of the preview;
+// ColorSpaceSRGB, i.e., written as is, if not set.
+func (r *RawFile) previewSpace(info *RawFileInfo) ColorSpace {
+	if !info.ConvertToSRGB {
+		return ColorSpaceSRGB
+	}
+	return r.ColorSpace
+}
+
+// isAdobeRGBPreview determines if the jpeg data of a preview, in color
+// space space, is to be converted to sRGB: if space is Adobe RGB or, if
+// ColorSpaceUnknown, the ICC profile embedded in data is Adobe RGB.  See
+// previewSpace.
+func isAdobeRGBPreview(data []byte, space ColorSpace) bool {
+	return space == ColorSpaceAdobeRGB ||
+		space == ColorSpaceUnknown && isAdobeRGBProfile(jpegICCProfile(data))
+}
+
+// decodeJpegSRGB decodes the embedded jpeg as by decodeJpeg, converted to
+// sRGB if in Adobe RGB.  See isAdobeRGBPreview.
+// Returns the decoded image or error.
+func decodeJpegSRGB(data []byte, space ColorSpace) (image.Image, error) {
+	img, err := decodeJpeg(data)
+	if err != nil || !isAdobeRGBPreview(data, space) {
+		return img, err
+	}
+	return adobeRGBToSRGB(img), nil
+}
+
+// iccHeader identifies the APP2 segments of a JPEG holding an ICC profile.
+var iccHeader = []byte("ICC_PROFILE\x00")
+
+// jpegICCProfile reads the ICC profile of a JPEG, from the APP2 segments
+// preceding the image data, in order of their sequence numbers.
+// Returns the profile; nil if none or incomplete.
+func jpegICCProfile(data []byte) []byte {
+	var chunks [][]byte
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xff && data[pos+1] != 0xda {
+		n := 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if n < 4 || pos+n > len(data) {
+			return nil
+		}
+		seg := data[pos+4 : pos+n]
+		if data[pos+1] == 0xe2 && len(seg) > len(iccHeader)+2 && bytes.HasPrefix(seg, iccHeader) {
+			seq, count := int(seg[len(iccHeader)]), int(seg[len(iccHeader)+1])
+			if chunks == nil {
+				chunks = make([][]byte, count)
+			}
+			if seq < 1 || seq > len(chunks) {
+				return nil
+			}
+			chunks[seq-1] = seg[len(iccHeader)+2:]
+		}
+		pos += n
+	}
+
+	var profile []byte
+	for _, c := range chunks {
+		if c == nil {
+			return nil
+		}
+		profile = append(profile, c...)
+	}
+	return profile
+}
+
+// adobeRGBPrimaries are the D50-adapted red and green colorants of Adobe
+// RGB (1998), as recorded by the rXYZ and gXYZ tags of its ICC profiles.
+var adobeRGBPrimaries = map[string][3]float64{
+	"rXYZ": {0.6097, 0.3111, 0.0195},
+	"gXYZ": {0.2053, 0.6257, 0.0609},
+}
+
+// isAdobeRGBProfile determines if an ICC profile is of Adobe RGB by its
+// colorants, regardless of the description of the profile.
+func isAdobeRGBProfile(profile []byte) bool {
+	const tolerance = 0.002
+
+	be := binary.BigEndian
+	if len(profile) < 132 {
+		return false
+	}
+	n := int(be.Uint32(profile[128:]))
+	if n > (len(profile)-132)/12 {
+		return false
+	}
+
+	matched := 0
+	for i := 0; i < n; i++ {
+		t := profile[132+12*i:]
+		want, ok := adobeRGBPrimaries[string(t[:4])]
+		if !ok {
+			continue
+		}
+		offset, size := int64(be.Uint32(t[4:])), int64(be.Uint32(t[8:]))
+		if size < 20 || offset+20 > int64(len(profile)) || string(profile[offset:offset+4]) != "XYZ " {
+			return false
+		}
+		for k, w := range want {
+			v := float64(int32(be.Uint32(profile[offset+8+4*int64(k):]))) / 65536
+			if math.Abs(v-w) > tolerance {
+				return false
+			}
+		}
+		matched++
+	}
+	return matched == len(adobeRGBPrimaries)
+}
+
+// adobeRGBToXYZ and xyzToSRGB convert linear Adobe RGB (1998) to CIE XYZ,
+// and CIE XYZ to linear sRGB; both have the D65 white point.
+var (
+	adobeRGBToXYZ = [3][3]float64{
+		{0.5767309, 0.1855540, 0.1881852},
+		{0.2973769, 0.6273491, 0.0752741},
+		{0.0270343, 0.0706872, 0.9911085},
+	}
+	xyzToSRGB = [3][3]float64{
+		{3.2404542, -1.5371385, -0.4985314},
+		{-0.9692660, 1.8760108, 0.0415560},
+		{0.0556434, -0.2040259, 1.0572252},
+	}
+)
+
+// adobeRGBGamma is the exponent of the tone curve of Adobe RGB (1998).
+const adobeRGBGamma = 563.0 / 256
+
+// srgbLinearLevels is the number of levels of linear light encoded by the
+// sRGB lookup table of an adobeRGBTransform.
+const srgbLinearLevels = 4096
+
+// adobeRGBTransform is a struct representing the conversion of 8-bit Adobe
+// RGB to 8-bit sRGB: lookup tables of the tone curves and the matrix of
+// linear light.
+type adobeRGBTransform struct {
+	linear [256]float32            // Adobe RGB to linear light
+	matrix [3][3]float32           // linear Adobe RGB to linear sRGB
+	encode [srgbLinearLevels]uint8 // linear light to sRGB
+}
+
+// adobeRGBTransformOnce builds the Adobe RGB transform once.
+var adobeRGBTransformOnce = sync.OnceValue(newAdobeRGBTransform)
+
+// newAdobeRGBTransform builds the tables and matrix of the Adobe RGB to
+// sRGB conversion.
+// Returns the transform.
+func newAdobeRGBTransform() *adobeRGBTransform {
+	t := new(adobeRGBTransform)
+	for i := range t.linear {
+		t.linear[i] = float32(math.Pow(float64(i)/255, adobeRGBGamma))
+	}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			var v float64
+			for k := 0; k < 3; k++ {
+				v += xyzToSRGB[i][k] * adobeRGBToXYZ[k][j]
+			}
+			t.matrix[i][j] = float32(v)
+		}
+	}
+	for i := range t.encode {
+		t.encode[i] = uint8(math.Round(255 * linearToSRGB(float64(i)/(srgbLinearLevels-1))))
+	}
+	return t
+}
+
+// pixel converts an Adobe RGB pixel to sRGB; colors outside of the sRGB
+// gamut are clipped.
+func (t *adobeRGBTransform) pixel(r, g, b uint8) (uint8, uint8, uint8) {
+	lr, lg, lb := t.linear[r], t.linear[g], t.linear[b]
+	m := &t.matrix
+	return t.encodeLinear(m[0][0]*lr + m[0][1]*lg + m[0][2]*lb),
+		t.encodeLinear(m[1][0]*lr + m[1][1]*lg + m[1][2]*lb),
+		t.encodeLinear(m[2][0]*lr + m[2][1]*lg + m[2][2]*lb)
+}
+
+// encodeLinear encodes linear light, clipped to 0 to 1, as sRGB.
+func (t *adobeRGBTransform) encodeLinear(v float32) uint8 {
+	i := int(v*(srgbLinearLevels-1) + 0.5)
+	return t.encode[min(max(i, 0), srgbLinearLevels-1)]
+}
+
+// adobeRGBToSRGB converts an image in Adobe RGB (1998) to sRGB, so that
+// previews do not appear desaturated in applications, e.g., browsers,
+// assuming sRGB.  The YCbCr images decoded from JPEG are converted without
+// the overhead of image.Image.At.
+// Returns the opaque image in sRGB.
+func adobeRGBToSRGB(img image.Image) *image.RGBA {
+	t := adobeRGBTransformOnce()
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+
+	ycc, isYCbCr := img.(*image.YCbCr)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := out.Pix[(y-b.Min.Y)*out.Stride:]
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var r, g, bl uint8
+			if isYCbCr {
+				ci := ycc.COffset(x, y)
+				r, g, bl = color.YCbCrToRGB(ycc.Y[ycc.YOffset(x, y)], ycc.Cb[ci], ycc.Cr[ci])
+			} else {
+				c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+				r, g, bl = c.R, c.G, c.B
+			}
+			p := row[4*(x-b.Min.X):]
+			p[0], p[1], p[2] = t.pixel(r, g, bl)
+			p[3] = 0xff
+		}
+	}
+	return out
+}
+
+// linearToSRGB converts linear light, from 0 to 1, to an sRGB value.  See
+// srgbToLinear.
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
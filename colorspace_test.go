@@ -0,0 +1,233 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// testColor is a saturated green, within the Adobe RGB gamut.
+var testColor = color.RGBA{60, 170, 70, 0xff}
+
+// colorJpeg encodes a JPEG of a single color with the ICC profile, if not
+// nil, in an APP2 segment.
+func colorJpeg(t *testing.T, c color.RGBA, profile []byte) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for i := 0; i < len(img.Pix); i += 4 {
+		copy(img.Pix[i:], []byte{c.R, c.G, c.B, c.A})
+	}
+
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("Error encoding test jpeg: %v\n", err)
+	}
+	data := b.Bytes()
+	if profile == nil {
+		return data
+	}
+
+	seg := append([]byte{0xff, 0xe2, 0, 0}, iccHeader...)
+	seg = append(append(seg, 1, 1), profile...)
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(seg)-2))
+	return append(append([]byte{0xff, 0xd8}, seg...), data[2:]...)
+}
+
+// testAdobeRGBProfile builds an ICC profile holding the colorants of Adobe
+// RGB only.
+func testAdobeRGBProfile() []byte {
+	be := binary.BigEndian
+	profile := make([]byte, 128)
+	profile = be.AppendUint32(profile, 2)
+	data := 132 + 2*12
+	for i, sig := range []string{"rXYZ", "gXYZ"} {
+		profile = append(profile, sig...)
+		profile = be.AppendUint32(profile, uint32(data+20*i))
+		profile = be.AppendUint32(profile, 20)
+	}
+	for _, xyz := range [][3]float64{{0.60974, 0.31111, 0.01947}, {0.20528, 0.62567, 0.06087}} {
+		profile = append(profile, "XYZ \x00\x00\x00\x00"...)
+		for _, v := range xyz {
+			profile = be.AppendUint32(profile, uint32(int32(v*65536+0.5)))
+		}
+	}
+	return profile
+}
+
+// centerColor decodes a JPEG.
+// Returns the color of its center pixel.
+func centerColor(t *testing.T, data []byte) color.RGBA {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Error decoding jpeg: %v\n", err)
+	}
+	b := img.Bounds()
+	return color.RGBAModel.Convert(img.At(b.Dx()/2, b.Dy()/2)).(color.RGBA)
+}
+
+// isMoreSaturated determines if the green of c is more saturated than that
+// of testColor, as by a conversion from Adobe RGB to sRGB.
+func isMoreSaturated(c color.RGBA) bool {
+	return int(c.G)-int(c.R) > int(testColor.G)-int(testColor.R)+20
+}
+
+func TestColorSpaceOf(t *testing.T) {
+	tests := []struct {
+		exif    uint16
+		interop string
+		want    ColorSpace
+	}{
+		{0, "", ColorSpaceUnknown},
+		{1, "", ColorSpaceSRGB},
+		{2, "", ColorSpaceAdobeRGB},
+		{0xffff, "R03", ColorSpaceAdobeRGB},
+		{0xffff, "R98", ColorSpaceSRGB},
+		{0xffff, "", ColorSpaceUnknown},
+	}
+	for _, test := range tests {
+		if got := colorSpaceOf(test.exif, test.interop); got != test.want {
+			t.Errorf("colorSpaceOf(0x%x, %q) = %v; expected %v\n", test.exif, test.interop, got, test.want)
+		}
+	}
+
+	b, err := json.Marshal(RawFile{ColorSpace: ColorSpaceAdobeRGB})
+	if err != nil || !strings.Contains(string(b), `"colorSpace":"Adobe RGB"`) {
+		t.Errorf("Unexpected JSON: %s %v\n", b, err)
+	}
+
+	r, err := NewFormatParser(Cr2ParserKey).ProcessFile(&RawFileInfo{File: TestCR2File, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if r.ColorSpace != ColorSpaceSRGB {
+		t.Errorf("Unexpected color space: %v\n", r.ColorSpace)
+	}
+}
+
+func TestAdobeRGBToSRGB(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 5, 1))
+	for x, c := range []color.RGBA{{0, 0, 0, 0xff}, {255, 255, 255, 0xff}, {128, 128, 128, 0xff}, {0, 255, 0, 0xff}, testColor} {
+		img.SetRGBA(x, 0, c)
+	}
+
+	out := adobeRGBToSRGB(img)
+	for x, want := range []color.RGBA{{0, 0, 0, 0xff}, {255, 255, 255, 0xff}, {128, 128, 128, 0xff}, {0, 255, 0, 0xff}} {
+		got := out.RGBAAt(x, 0)
+		for i, v := range []int{int(got.R), int(got.G), int(got.B)} {
+			w := []int{int(want.R), int(want.G), int(want.B)}[i]
+			if v < w-1 || v > w+1 {
+				t.Errorf("Unexpected conversion of %v: %v; expected %v\n", img.RGBAAt(x, 0), got, want)
+				break
+			}
+		}
+	}
+	if c := out.RGBAAt(4, 0); !isMoreSaturated(c) {
+		t.Errorf("Unexpected conversion of %v: %v\n", testColor, c)
+	}
+}
+
+func TestAdobeRGBProfile(t *testing.T) {
+	adobe := colorJpeg(t, testColor, testAdobeRGBProfile())
+	if !isAdobeRGBPreview(adobe, ColorSpaceUnknown) {
+		t.Error("Expected an Adobe RGB profile\n")
+	}
+	if isAdobeRGBPreview(adobe, ColorSpaceSRGB) {
+		t.Error("Expected the color space recorded to take precedence\n")
+	}
+	if isAdobeRGBPreview(colorJpeg(t, testColor, srgbProfile()), ColorSpaceUnknown) {
+		t.Error("Unexpected Adobe RGB profile of sRGB\n")
+	}
+	if isAdobeRGBPreview(colorJpeg(t, testColor, nil), ColorSpaceUnknown) {
+		t.Error("Unexpected Adobe RGB profile of a JPEG without profile\n")
+	}
+
+	var b bytes.Buffer
+	if err := encodeTo(&b, adobe, OutputJpeg, 95, JpegOptions{}, ColorSpaceUnknown, nil); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if c := centerColor(t, b.Bytes()); !isMoreSaturated(c) {
+		t.Errorf("Unexpected color of the converted preview: %v\n", c)
+	}
+}
+
+func TestConvertToSRGB(t *testing.T) {
+	tt := newTestTiff(false)
+	preview := colorJpeg(t, testColor, nil)
+	previewOffset := tt.addBlob(preview)
+	interop := tt.addIfd(0, asciiEntry(0x0001, "R03"))
+	exif := tt.addIfd(0,
+		shortEntry(0xa001, 0xffff),
+		longEntry(0xa005, interop))
+	ifd0 := tt.addIfd(0,
+		asciiEntry(0x010f, "Nikon"),
+		longEntry(0x0201, previewOffset),
+		longEntry(0x0202, uint32(len(preview))),
+		longEntry(0x8769, exif))
+	path, dir := writeTestFile(t, "a.DNG", tt.bytes(ifd0))
+
+	r, err := NewFormatParser(".DNG").ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 95, PreserveExif: true, ConvertToSRGB: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if r.ColorSpace != ColorSpaceAdobeRGB {
+		t.Errorf("Unexpected color space: %v\n", r.ColorSpace)
+	}
+	data, err := os.ReadFile(r.JpegPath)
+	if err != nil {
+		t.Fatalf("Error reading %s: %v\n", r.JpegPath, err)
+	}
+	if c := centerColor(t, data); !isMoreSaturated(c) {
+		t.Errorf("Unexpected color of the converted preview: %v\n", c)
+	}
+
+	ifds := readJpegExif(t, r.JpegPath)
+	if e := findExifEntry(ifds, tiff.KindExif, 0xa001); e == nil {
+		t.Error("Missing color space\n")
+	} else if v, _ := e.Uint(); v != 1 {
+		t.Errorf("Unexpected color space: 0x%x\n", v)
+	}
+	if e := findExifEntry(ifds, tiff.KindInterop, 0x0001); e == nil {
+		t.Error("Missing interop index\n")
+	} else if v, _ := e.ASCII(); v != "R98" {
+		t.Errorf("Unexpected interop index: %q\n", v)
+	}
+
+	// not converted unless requested
+	var b bytes.Buffer
+	if err := r.ExtractJpegTo(&b, &RawFileInfo{File: path, Quality: 95}); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if c := centerColor(t, b.Bytes()); isMoreSaturated(c) {
+		t.Errorf("Unexpected conversion of the preview: %v\n", c)
+	}
+}
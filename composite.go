@@ -0,0 +1,82 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import "fmt"
+
+// CompositeImage records whether a photo is a composite of several source
+// images, as recorded by the EXIF CompositeImage (EXIF 2.32).
+type CompositeImage uint16
+
+const (
+	CompositeUnknown CompositeImage = iota // not recorded
+	CompositeNone                          // not a composite image
+	CompositeGeneral                       // composed after shooting
+	CompositeCapture                       // composed while shooting, e.g., an in-camera HDR
+)
+
+// String returns the name of the composite image type, e.g., "Not a
+// composite image".
+func (c CompositeImage) String() string {
+	switch c {
+	case CompositeUnknown:
+		return "Unknown"
+	case CompositeNone:
+		return "Not a composite image"
+	case CompositeGeneral:
+		return "General composite image"
+	case CompositeCapture:
+		return "Composite image captured while shooting"
+	}
+	return fmt.Sprintf("CompositeImage(%d)", int(c))
+}
+
+// MarshalText encodes the composite image type by name.
+func (c CompositeImage) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// compositeInfo is a struct representing the composite image tags of a
+// raw file.
+type compositeInfo struct {
+	composite CompositeImage
+	sources   uint16 // the source images used
+}
+
+// processCompositeEntry records the composite image tags of the EXIF IFD
+// (CompositeImage and SourceImageNumberOfCompositeImage).  Errors are not
+// fatal as the tags are optional.
+func processCompositeEntry(entry *IfdEntry, m *rawMetadata) {
+	switch entry.tag {
+	case 0xa460: // CompositeImage
+		if v, err := entry.Uint16(); err == nil {
+			m.composite.composite = CompositeImage(v)
+		}
+	case 0xa461: // SourceImageNumberOfCompositeImage
+		// the source images in total and those used
+		if v, err := entry.Shorts(); err == nil && len(v) == 2 {
+			m.composite.sources = v[1]
+		}
+	}
+}
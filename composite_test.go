@@ -0,0 +1,102 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestExif232Tags(t *testing.T) {
+	for _, bigEndian := range []bool{false, true} {
+		tt := newTestTiff(bigEndian)
+		preview := testJpeg(t, 160, 120)
+		previewOffset := tt.addBlob(preview)
+		interop := tt.addIfd(0,
+			asciiEntry(0x0001, "R03"),
+			testEntry{tag: 0x0002, fieldType: 7, raw: []byte("0100")})
+		exif := tt.addIfd(0,
+			asciiEntry(0x9004, "2021:03:04 05:06:07"),
+			asciiEntry(0x9012, "-07:00"),
+			longEntry(0xa005, interop),
+			asciiEntry(0xa431, "2061234 "),
+			asciiEntry(0xa435, "0000c1234"),
+			shortEntry(0xa460, 3),
+			shortEntry(0xa461, 5, 3))
+		ifd0 := tt.addIfd(0,
+			asciiEntry(0x010f, "Canon"),
+			longEntry(0x0201, previewOffset),
+			longEntry(0x0202, uint32(len(preview))),
+			longEntry(0x8769, exif))
+		data := tt.bytes(ifd0)
+
+		for _, name := range []string{"a.DNG", "a.NEF"} {
+			path, _ := writeTestFile(t, name, data)
+			p := NewFormatParser(name[strings.LastIndex(name, "."):])
+			r, err := p.ProcessFile(&RawFileInfo{File: path, SkipExtraction: true, Lenient: true})
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v\n", name, err)
+			}
+			if r.SerialNumber != "2061234" || r.Lens.SerialNumber != "0000c1234" {
+				t.Errorf("%s: unexpected serial numbers: %q %q\n", name, r.SerialNumber, r.Lens.SerialNumber)
+			}
+			if r.CompositeImage != CompositeCapture || r.CompositeSources != 3 {
+				t.Errorf("%s: unexpected composite image: %v of %d\n", name, r.CompositeImage, r.CompositeSources)
+			}
+			if r.InteropIndex != "R03" {
+				t.Errorf("%s: unexpected interop index: %q\n", name, r.InteropIndex)
+			}
+			if _, offset := r.CreateDate.Zone(); offset != -7*3600 {
+				t.Errorf("%s: unexpected create date: %v\n", name, r.CreateDate)
+			}
+			if r.TagStats.Unknown != 1 { // InteroperabilityVersion
+				t.Errorf("%s: unexpected tag stats: %+v\n", name, r.TagStats)
+			}
+		}
+	}
+}
+
+func TestInteropIndexRealFile(t *testing.T) {
+	r, err := NewFormatParser(Cr2ParserKey).ProcessFile(&RawFileInfo{File: TestCR2File, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if r.InteropIndex != "R98" {
+		t.Errorf("Unexpected interop index: %q\n", r.InteropIndex)
+	}
+}
+
+func TestCompositeImageJSON(t *testing.T) {
+	b, err := json.Marshal(RawFile{CompositeImage: CompositeGeneral, CompositeSources: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if !strings.Contains(string(b), `"compositeImage":"General composite image","compositeSources":2`) {
+		t.Errorf("Unexpected JSON: %s\n", b)
+	}
+	if b, _ := json.Marshal(RawFile{}); strings.Contains(string(b), "composite") {
+		t.Errorf("Unexpected JSON of a RawFile without composite image: %s\n", b)
+	}
+}
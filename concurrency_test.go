@@ -0,0 +1,82 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentProcessFile verifies that a single parser instance may be
+// shared by goroutines processing files concurrently; run with -race.
+func TestConcurrentProcessFile(t *testing.T) {
+	nrw, _ := writeTestFile(t, "concurrent.NRW", buildTestNrw(t, true))
+	crw, _ := writeTestFile(t, "concurrent.CRW", buildTestCrw(t))
+	files := []string{TestNefFile, TestNefNoJpegFile, TestCR2File, nrw, crw}
+
+	// the previews of the test files are large; only those of the
+	// synthetic files are extracted
+	info := func(file, destDir string) *RawFileInfo {
+		return &RawFileInfo{File: file, DestDir: destDir, Quality: 75, SkipExtraction: file != nrw && file != crw}
+	}
+
+	// expected results, processed serially
+	want := make(map[string]*RawFile)
+	for _, file := range files {
+		r, err := NewFormatParser(filepath.Ext(file)).ProcessFile(info(file, t.TempDir()))
+		if err != nil {
+			t.Fatalf("Unexpected error processing %s: %v\n", file, err)
+		}
+		want[file] = r
+	}
+
+	parsers := make(map[string]RawParser)
+	for _, file := range files {
+		parsers[file] = NewFormatParser(filepath.Ext(file))
+	}
+
+	const workers = 8
+	var wg sync.WaitGroup
+	for i := range workers {
+		destDir := t.TempDir()
+		wg.Go(func() {
+			for j := range files {
+				file := files[(i+j)%len(files)]
+				r, err := parsers[file].ProcessFile(info(file, destDir))
+				if err != nil {
+					t.Errorf("Unexpected error processing %s: %v\n", file, err)
+					continue
+				}
+				w := want[file]
+				if !r.CreateDate.Equal(w.CreateDate) || r.Orientation != w.Orientation ||
+					r.PreviewWidth != w.PreviewWidth || r.PreviewHeight != w.PreviewHeight ||
+					r.CameraModel != w.CameraModel || r.Extraction.Err != nil {
+					t.Errorf("Unexpected result processing %s concurrently: %+v\n", file, r)
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
@@ -24,16 +24,20 @@
 package rawparser
 
 import (
-	"log"
-	"math"
+	"fmt"
+	"io"
 	"os"
-	"time"
+
+	"github.com/jeremytorres/rawparser/tiff"
 )
 
 // Cr2ParserKey is a unique identifier for the CR2 raw file parser.
 // This key may be used as a key the RawParsers map.
 const Cr2ParserKey = "CR2"
 
+// cr2MagicWord identifies a CR2 file; it follows the TIFF header.
+const cr2MagicWord = "CR"
+
 // cr2Header is a struct representing a CR2 file header.
 //   Byte Order: offset 0, len 2
 //   TIFF Magic Value: offset 2, len 2
@@ -55,10 +59,14 @@ type cr2Header struct {
 // (CR2).  For a specified CR2, the EXIF create time and orientation are parsed and the
 // embedded JPEG is extracted.  The following are resources on CR2 file details:
 //
+// The TIF raw files of the EOS-1D and EOS-1Ds, which lack the CR2 magic
+// word, are parsed as generic TIFF-based raw files (see quirkTifContainer);
+// the TIF file extension is not registered as it is shared with ordinary
+// TIFF images.
+//
 // CR2-specific information: http://lclevy.free.fr/cr2
 // TIFF specification: http://partners.adobe.com/public/developer/en/tiff/TIFF6.pdf
 type Cr2Parser struct {
-	//HostIsLittleEndian bool
 	*rawParser
 }
 
@@ -69,67 +77,72 @@ type Cr2Parser struct {
 func (n Cr2Parser) ProcessFile(info *RawFileInfo) (CR2 *RawFile, err error) {
 	CR2 = new(RawFile)
 
-	// file is closed in subsequent method
-	f, err := os.Open(info.File)
+	if info, err = info.withDefaults(); err != nil {
+		return CR2, err
+	}
+
+	f, err := openRawFile(info)
 	if err != nil {
-		log.Printf("Error: Unable to open file: '%s'\n", info.File)
-	} else {
-		h, err := n.processHeader(f)
-		jpegInfo, createDate, err := n.processIfds(f, h)
-		if err == nil {
-			jpegPath, err := n.decodeAndWriteJpeg(f, jpegInfo, info.DestDir, info.Quality)
-			if err == nil {
-				CR2.FileName = info.File
-				CR2.CreateDate = createDate
-				CR2.JpegPath = jpegPath
-				CR2.JpegOrientation = jpegInfo.orientation
-
-				log.Printf("========= Processed file %s\n", info.File)
-			}
+		return CR2, err
+	}
+	defer f.Close()
+	if cached := info.Cache.lookup(f, info); cached != nil {
+		return cached, nil
+	}
+
+	cache := newReadCache(f)
+	h, err := n.processHeader(cache)
+	tifContainer := false
+	if err == nil && h.cr2MagicValue != cr2MagicWord {
+		if tifContainer = n.cameraModel(cache, h).quirks()&quirkTifContainer != 0; !tifContainer {
+			err = &HeaderError{Field: "CR2 magic word", Got: fmt.Sprintf("%q", h.cr2MagicValue), Want: fmt.Sprintf("%q", cr2MagicWord)}
 		}
 	}
+	headerErr, err := lenientHeader(info, err)
+	if err != nil {
+		return CR2, err
+	}
+	var jpegInfo *jpegInfo
+	var meta *rawMetadata
+	if tifContainer {
+		jpegInfo, meta, err = n.processTifContainer(cache)
+	} else {
+		jpegInfo, meta, err = n.processIfds(cache, h)
+	}
+	if err != nil {
+		return CR2, err
+	}
+	if headerErr != nil {
+		meta.warn(headerErr)
+	}
+	meta.images = listImages(cache)
+	meta.rawImage = readRawImage(cache)
+	runTagHooks(cache, info.TagHooks)
 
-	return CR2, err
+	return CR2, completeRawFile(CR2, info, f, jpegInfo, meta)
 }
 
 // processHeader reads CR2 header that defines:
 //   byte order;
 //   TIFF magic value
 //   TIFF offset
-// Returns a pointer to the header struct or error.
-func (n Cr2Parser) processHeader(f *os.File) (*cr2Header, error) {
+// The CR2 magic word is read but not verified, as it is absent from the
+// TIF raw files of the models with quirkTifContainer.
+// Returns a pointer to the header struct or error; a *HeaderError, with
+// the header read, if the TIFF magic value is invalid.
+func (n Cr2Parser) processHeader(f io.ReaderAt) (*cr2Header, error) {
 	var h cr2Header
 
-	// byte order
-	bytes, err := readField(0, 2, f)
+	th, err := tiff.ReadHeader(f)
 	if err != nil {
 		return &h, err
 	}
-	// byte order bytes
-	byteOrder := bytesToUShort(n.HostIsLittleEndian, false, bytes)
-
-	// set byte order from header read
-	h.isBigEndian = (byteOrder == 0x4D4D)
-
-	// TIFF magic value
-	bytes, err = readField(2, 2, f)
-	if err != nil {
-		return &h, err
-	}
-	h.tiffMagicValue = bytesToUShort(n.HostIsLittleEndian, h.isBigEndian, bytes)
-	//	log.Printf("TIFF Magic Val converted: 0x%x\n", h.tiffMagicValue)
-
-	// TIFF offset
-	bytes, err = readField(4, 4, f)
-	if err != nil {
-		return &h, err
-	}
-	val := bytesToUInt(n.HostIsLittleEndian, h.isBigEndian, bytes)
-	h.tiffOffset = int64(val)
-	//	log.Printf("TIFF Offset Val converted: 0x%x\n", h.tiffOffset)
+	h.isBigEndian = th.IsBigEndian()
+	h.tiffMagicValue = th.Magic
+	h.tiffOffset = th.Offset
 
 	// cr2 magic val
-	bytes, err = readField(8, 2, f)
+	bytes, err := readField(8, 2, f)
 	if err != nil {
 		return &h, err
 	}
@@ -154,100 +167,203 @@ func (n Cr2Parser) processHeader(f *os.File) (*cr2Header, error) {
 	}
 	h.cr2MinorValue = uint8(bytes[0])
 
-	return &h, err
+	if err := checkTiffMagic(th, tiffMagic); err != nil {
+		return &h, err
+	}
+	return &h, nil
+}
+
+// cameraModel reads the make and model of IFD0 of a CR2, e.g., to look up
+// its quirks before its layout is known.
+// Returns the CameraModel; empty if not recorded.
+func (n Cr2Parser) cameraModel(f io.ReaderAt, h *cr2Header) CameraModel {
+	var c CameraModel
+	entries, _ := processIfd(n.IsHostLittleEndian(), h.isBigEndian, h.tiffOffset, f)
+	for e := entries.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(IfdEntry)
+		switch entry.tag {
+		case 0x010f:
+			c.Make, _ = entry.ASCII()
+		case 0x0110:
+			c.Model, _ = entry.ASCII()
+		}
+	}
+	return c
 }
 
 // processIfds reads all currently-supported IFDs from the CR2.  Currently, it parses:
 //     jpegInfo - the information pertaining to the embedded jpeg within the CR2;
-//     cDate - the EXIF specified CR2 creation time;
+//     meta - the EXIF specified CR2 creation time and raw dimensions;
 //     Note: more EXIF and CR2-specific tags could be parsed in a future release.
-// Return jpegInfo, creation date/time or an error.
-func (n Cr2Parser) processIfds(f *os.File, h *cr2Header) (j *jpegInfo, cDate time.Time, err error) {
+// Return jpegInfo, metadata or an error.
+func (n Cr2Parser) processIfds(f io.ReaderAt, h *cr2Header) (j *jpegInfo, meta *rawMetadata, err error) {
 	var jpeg jpegInfo
+	var m rawMetadata
+	var stripOffsets, stripLengths []uint32
 	offset := h.tiffOffset
 
-	entries, err := processIfd(n.HostIsLittleEndian, h.isBigEndian, offset, f)
+	entries, err := processIfd(n.IsHostLittleEndian(), h.isBigEndian, offset, f)
 	if err != nil {
-		return &jpeg, cDate, err
+		if entries.Len() == 0 {
+			return &jpeg, &m, err
+		}
+		// truncated within IFD0; the entries read are processed
+		m.readFailed("IFD0", 0, err)
 	}
+	m.tags.record(entries, ifd0Tags)
 
 	for e := entries.Front(); e != nil; e = e.Next() {
-		entry := e.Value.(ifdEntry)
+		entry := e.Value.(IfdEntry)
 
 		switch {
-		case entry.tag == 0x0111: // JPEG offset for IFD0
-			jpeg.offset = int64(entry.valueOffset)
+		case entry.tag == 0x0111: // JPEG strip offsets for IFD0
+			stripOffsets, _ = processIntegerArray(n.IsHostLittleEndian(), h.isBigEndian, &entry, f)
 		case entry.tag == 0x0112: // orientation tag
-			o := processShortValue(h.isBigEndian, entry.valueOffset)
-			if o == 8 {
-				// rotate 270 CW
-				rotationRads := 270 * math.Pi / 180
-				jpeg.orientation = rotationRads
-			} else {
-				jpeg.orientation = 0.0
-			}
-		case entry.tag == 0x0117:
-			jpeg.length = int64(entry.valueOffset)
+			v, _ := entry.Uint16()
+			jpeg.orientation = orientationOf(v)
+		case entry.tag == 0x0117: // JPEG strip byte counts for IFD0
+			stripLengths, _ = processIntegerArray(n.IsHostLittleEndian(), h.isBigEndian, &entry, f)
 		case entry.tag == 0x011a:
-			jpeg.xRes, _, jpeg.xResFloat, err = processRationalEntry(n.HostIsLittleEndian, h.isBigEndian, entry.valueOffset, f)
+			jpeg.xRes, _, jpeg.xResFloat, err = entry.Rational()
+			if err != nil {
+				m.readFailed("IFD0", entry.tag, err)
+			}
 		case entry.tag == 0x011b:
-			jpeg.yRes, _, jpeg.yResFloat, err = processRationalEntry(n.HostIsLittleEndian, h.isBigEndian, entry.valueOffset, f)
+			jpeg.yRes, _, jpeg.yResFloat, err = entry.Rational()
+			if err != nil {
+				m.readFailed("IFD0", entry.tag, err)
+			}
 		case entry.tag == 0x8769: // EXIF IFD pointer
-			// EXIF IFD pointer.  Note: the pointer is the value represented
-			// in valueOffset.
+			// EXIF IFD pointer.  Note: the pointer is the value of the entry,
+			// by its field type; see ifdPointer.
 			// Read EXIF Entries
-			exifEntries, err := processIfd(n.HostIsLittleEndian, h.isBigEndian, int64(entry.valueOffset), f)
+			exifEntries, err := processIfdOf(n.IsHostLittleEndian(), h.isBigEndian, &entry, f)
 			if err != nil {
-				return &jpeg, cDate, err
+				m.readFailed("EXIF IFD", 0, err)
+				continue
 			}
+			m.tags.record(exifEntries, cr2ExifTags)
 
 			for exif := exifEntries.Front(); exif != nil; exif = exif.Next() {
-				exifEntry := exif.Value.(ifdEntry)
-				if exifEntry.tag == 0x9004 {
-					createDate, err := processASCIIEntry(&exifEntry, f)
-					if err == nil {
-						cDate, err = parseDateTime(createDate)
-					}
+				exifEntry := exif.Value.(IfdEntry)
+				processDateEntry(&exifEntry, &m.dates)
+				processPhotoIDEntry(&exifEntry, &m)
+				processLensEntry(&exifEntry, &m)
+				processExposureEntry(&exifEntry, &m)
+				processCompositeEntry(&exifEntry, &m)
+				processColorSpaceEntry(&exifEntry, &m)
+				processSubjectEntry(&exifEntry, &m)
+				if exifEntry.tag == 0xa005 { // Interoperability IFD pointer
+					processInteropIfd(n.IsHostLittleEndian(), h.isBigEndian, &exifEntry, f, &m)
+				}
+				if exifEntry.tag == 0x927c { // MakerNote
+					processCanonMakerNote(n.IsHostLittleEndian(), h.isBigEndian, &exifEntry, f, &m)
 				}
 			}
+		case entry.tag == 0x8825: // GPS IFD pointer
+			processGpsIfd(n.IsHostLittleEndian(), h.isBigEndian, &entry, f, &m)
+		case entry.tag == 0x010f:
+			m.make = m.readASCIIEntry("IFD0", &entry)
+		case entry.tag == 0x0110:
+			m.model = m.readASCIIEntry("IFD0", &entry)
+		case entry.tag == 0x0132: // DateTime
+			m.dates.dateTime, _ = entry.ASCII()
+		case entry.tag == 0x013b, entry.tag == 0x8298: // Artist, Copyright
+			processCopyrightEntry(&entry, &m)
+		case entry.tag == 0x02bc, entry.tag == 0x4746: // XMP, Rating
+			processRatingEntry(&entry, &m)
+		}
+	}
+
+	// the jpeg of IFD0, stored as one or more strips
+	strips := newByteRanges(uint64s(stripOffsets), uint64s(stripLengths))
+	jpeg.offset, jpeg.length = stripsExtent(strips)
+	if len(strips) > 1 {
+		jpeg.strips = strips
+	}
+	if !isJpegAt(f, jpeg.offset) {
+		// the preview is stored elsewhere, e.g., by very old bodies
+		n.processLargestJpeg(f, &jpeg)
+	}
+
+	// raw dimensions from the lossless jpeg within IFD3
+	m.imageWidth, m.imageHeight = n.processRawDimensions(f, h, offset)
+
+	return &jpeg, &m, nil
+}
+
+// processTifContainer reads the TIF raw files of the EOS-1D and EOS-1Ds as
+// generic TIFF-based raw files.
+// Returns jpegInfo, metadata or an error.
+func (n Cr2Parser) processTifContainer(f io.ReaderAt) (*jpegInfo, *rawMetadata, error) {
+	h, err := tiff.ReadHeader(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tiffParser{rawParser: n.rawParser}.processIfds(f, h)
+}
 
-			// TODO add for future release
-			//case entry.tag == 0x010f:
-			//mk, _ := processAsciiEntry(&entry, f)
-			//log.Printf("Model: %s\n", mk)
-			//case entry.tag == 0x0110:
-			//model, _ := processAsciiEntry(&entry, f)
-			//log.Printf("Model: %s\n", model)
+// processLargestJpeg selects the largest jpeg of the IFDs of a CR2 whose
+// IFD0 holds none, retaining the orientation and resolution of IFD0.
+func (n Cr2Parser) processLargestJpeg(f io.ReaderAt, j *jpegInfo) {
+	largest, _, err := n.processTifContainer(f)
+	if err != nil || largest.length <= 0 {
+		j.offset, j.length, j.strips = 0, 0, nil
+		return
+	}
+	j.offset, j.length, j.strips = largest.offset, largest.length, largest.strips
+}
 
+// processRawDimensions walks to IFD3, which contains the raw image data, and
+// reads the raw dimensions from the lossless JPEG frame header (SOF3).
+// Errors are not fatal as the dimensions are optional.
+// Returns the raw width and height; zero if not found.
+func (n Cr2Parser) processRawDimensions(f io.ReaderAt, h *cr2Header, ifd0Offset int64) (width, height uint32) {
+	offset := ifd0Offset
+	var stripOffset int64
+	for i := 0; i <= 3 && offset > 0; i++ {
+		entries, next, err := processIfdWithNext(n.IsHostLittleEndian(), h.isBigEndian, offset, f)
+		if err != nil {
+			return 0, 0
+		}
+		if i == 3 {
+			for e := entries.Front(); e != nil; e = e.Next() {
+				entry := e.Value.(IfdEntry)
+				if entry.tag == 0x0111 {
+					stripOffset = int64(entry.valueOffset)
+				}
+			}
 		}
+		offset = next
 	}
 
-	return &jpeg, cDate, err
+	if stripOffset == 0 {
+		return 0, 0
+	}
+
+	return losslessJpegDimensions(n.IsHostLittleEndian(), f, stripOffset)
 }
 
 // decodeAndWriteJpeg extracts the embedded jpeg bytes within a CR2,
 // decodes the JPEG data, and then creates a new jpeg file.
 // Returns the full path to the jpeg extracted or an error.
 func (n Cr2Parser) decodeAndWriteJpeg(f *os.File, j *jpegInfo, destDir string, quality int) (jpegFileName string, err error) {
-	// extract jpeg to new file
-	jpegFileName = genExtractedJpegName(f, destDir, "_extracted.jpg")
-	log.Printf("Creating JPEG file: %s\n", jpegFileName)
-
-	data := make([]byte, j.length)
-	_, err = f.ReadAt(data, j.offset)
-
-	if err != nil {
-		log.Printf("Error reading embedded jpeg file: %v\n", err)
-		return jpegFileName, err
-	}
-
-	err = decodeAndWriteJpeg(data, quality, jpegFileName)
+	src := fileSource(f)
+	jpegFileName = genExtractedJpegName(src, destDir, OutputJpeg.suffix())
+	return jpegFileName, writePreview(src, j, jpegFileName, quality, OutputJpeg, JpegOptions{}, ColorSpaceSRGB, nil, nil)
+}
 
-	return jpegFileName, err
+// Capabilities returns the operations supported for CR2 files: those of the
+// built-in parsers, and the tags may be rewritten by UpdateTags.
+func (n Cr2Parser) Capabilities() Capabilities {
+	c := n.rawParser.Capabilities()
+	c.Write = true
+	return c
 }
 
 // NewCr2Parser creates an instance of Cr2Parser.
 // Returns a pointer to a Cr2Parser instance.
+// The hostIsLittleEndian argument is ignored; see RawParser.
 func NewCr2Parser(hostIsLittleEndian bool) (RawParser, string) {
-	return &Cr2Parser{&rawParser{hostIsLittleEndian}}, Cr2ParserKey
+	return &Cr2Parser{&rawParser{}}, Cr2ParserKey
 }
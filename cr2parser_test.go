@@ -24,6 +24,7 @@
 package rawparser
 
 import (
+	"errors"
 	"os"
 	"testing"
 )
@@ -37,8 +38,7 @@ var (
 )
 
 func setupCr2() {
-	gHostIsLe = isHostLittleEndian()
-	gCr2Parser = &Cr2Parser{&rawParser{gHostIsLe}}
+	gCr2Parser = &Cr2Parser{&rawParser{}}
 }
 
 func openTestCr2File() (*os.File, error) {
@@ -108,11 +108,11 @@ func TestCr2ProcessIfds(t *testing.T) {
 			t.Fail()
 		}
 		t.Logf("Header: %v\n", h)
-		jpegInfo, createDate, err := gCr2Parser.processIfds(f, h)
+		jpegInfo, meta, err := gCr2Parser.processIfds(f, h)
 		if err != nil {
 			t.Errorf("Error processing IFDs: %v\n", err)
 		}
-		t.Logf("jpegInfo: %v createDate: %v\n", jpegInfo, createDate)
+		t.Logf("jpegInfo: %v meta: %v\n", jpegInfo, meta)
 
 	} else {
 		t.Fatalf("Unable to open test CR2 file: %v\n", e)
@@ -131,11 +131,11 @@ func TestProcessJpegDecodeAndWrite(t *testing.T) {
 			t.Fail()
 		}
 		t.Logf("Header: %v\n", h)
-		jpegInfo, createDate, err := gCr2Parser.processIfds(f, h)
+		jpegInfo, meta, err := gCr2Parser.processIfds(f, h)
 		if err != nil {
 			t.Fail()
 		}
-		t.Logf("jpegInfo: %v createDate: %v\n", jpegInfo, createDate)
+		t.Logf("jpegInfo: %v meta: %v\n", jpegInfo, meta)
 
 		curdir, e := os.Getwd()
 		if e != nil {
@@ -170,7 +170,7 @@ func TestCr2ProcessFile(t *testing.T) {
 	// little endian CR2
 	testdir, e := getCr2TestDir()
 	if e == nil {
-		ni := RawFileInfo{TestCR2File, testdir, 50}
+		ni := RawFileInfo{File: TestCR2File, DestDir: testdir, Quality: 50}
 		cr2, err := gCr2Parser.ProcessFile(&ni)
 		defer os.Remove(cr2.JpegPath)
 		if err != nil {
@@ -187,6 +187,14 @@ func TestCr2ProcessFile(t *testing.T) {
 		if info.Size() == 0 {
 			t.Fail()
 		}
+
+		// verify dimensions
+		if cr2.ImageWidth <= 0 || cr2.ImageHeight <= 0 {
+			t.Errorf("Unexpected raw dimensions: %dx%d\n", cr2.ImageWidth, cr2.ImageHeight)
+		}
+		if cr2.PreviewWidth != 5616 || cr2.PreviewHeight != 3744 {
+			t.Errorf("Unexpected preview dimensions: %dx%d\n", cr2.PreviewWidth, cr2.PreviewHeight)
+		}
 	} else {
 		t.Fatal("Unable to determine test directory")
 	}
@@ -200,7 +208,7 @@ func TestCr2ProcessNonExistentFile(t *testing.T) {
 	if e != nil {
 		t.Fatal("Unable to determine test directory")
 	} else {
-		ni := RawFileInfo{"", testdir, 50}
+		ni := RawFileInfo{File: "", DestDir: testdir, Quality: 50}
 		_, err := gCr2Parser.ProcessFile(&ni)
 		if err == nil {
 			t.Fatal("Expected error not generated while parsing test little endian CR2")
@@ -213,11 +221,116 @@ func TestCr2ProcessNonExistentFile(t *testing.T) {
 func TestEndianessState(t *testing.T) {
 	setupCr2()
 
-	if gCr2Parser.SetHostIsLittleEndian(true); gCr2Parser.IsHostLittleEndian() != true {
-		t.Fail()
+	// the host endianness is detected; setting it has no effect
+	for _, b := range []bool{true, false} {
+		if gCr2Parser.SetHostIsLittleEndian(b); gCr2Parser.IsHostLittleEndian() != isHostLittleEndian() {
+			t.Fail()
+		}
 	}
+}
 
-	if gCr2Parser.SetHostIsLittleEndian(false); gCr2Parser.IsHostLittleEndian() != false {
-		t.Fail()
+func TestCr2ProcessFileHandle(t *testing.T) {
+	setupCr2()
+
+	f, err := openTestCr2File()
+	if err != nil {
+		t.Fatalf("Unable to open test CR2 file: %v\n", err)
+	}
+	defer f.Close()
+
+	ni := RawFileInfo{DestDir: t.TempDir() + string(os.PathSeparator), Quality: 50, Handle: f}
+	cr2, err := gCr2Parser.ProcessFile(&ni)
+	if err != nil {
+		t.Fatalf("Unexpected error while parsing CR2 handle: %v\n", err)
+	}
+	if cr2.FileName != TestCR2File || cr2.JpegPath == "" {
+		t.Errorf("Unexpected result: %+v\n", cr2)
+	}
+
+	// the caller retains ownership; the handle must remain open
+	if _, err := f.Stat(); err != nil {
+		t.Errorf("Handle closed by ProcessFile: %v\n", err)
+	}
+}
+
+// buildStripCr2 builds a synthetic CR2 whose IFD0 jpeg is stored as two
+// strips.
+func buildStripCr2(t *testing.T) []byte {
+	tt := newTestTiff(false)
+	tt.addBlob([]byte("CR\x02\x00\x00\x00\x00\x00"))
+
+	preview := testJpeg(t, 160, 120)
+	half := len(preview) / 2
+	first := tt.addBlob(preview[:half])
+	second := tt.addBlob(preview[half:])
+	exif := tt.addIfd(0, asciiEntry(0x9004, "2004:05:06 07:08:09"))
+	return tt.bytes(tt.addIfd(0,
+		longEntry(0x0111, first, second),
+		longEntry(0x0117, uint32(half), uint32(len(preview)-half)),
+		asciiEntry(0x0110, "Canon EOS-1D Mark II"),
+		longEntry(0x8769, exif)))
+}
+
+func TestCr2ProcessFileStrips(t *testing.T) {
+	setupCr2()
+
+	path, dir := writeTestFile(t, "strips.CR2", buildStripCr2(t))
+	cr2, err := gCr2Parser.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75})
+	if err != nil {
+		t.Fatalf("Unexpected error processing CR2: %v\n", err)
+	}
+	if cr2.PreviewWidth != 160 || cr2.PreviewHeight != 120 || cr2.CreateDate.IsZero() {
+		t.Errorf("Unexpected result: %+v\n", cr2)
+	}
+}
+
+// buildTestTifContainer builds a TIF raw file of a camera model, without
+// the CR2 header: IFD0 holds a small thumbnail, SubIFD0 the preview JPEG.
+func buildTestTifContainer(t *testing.T, model string) []byte {
+	tt := newTestTiff(true)
+	thumb := testJpeg(t, 32, 24)
+	preview := testJpeg(t, 320, 240)
+
+	thumbOffset := tt.addBlob(thumb)
+	previewOffset := tt.addBlob(preview)
+
+	exif := tt.addIfd(0, asciiEntry(0x9004, "2002:03:04 05:06:07"))
+	sub0 := tt.addIfd(0,
+		longEntry(0x00fe, 1),
+		shortEntry(0x0103, 6),
+		longEntry(0x0201, previewOffset),
+		longEntry(0x0202, uint32(len(preview))))
+	return tt.bytes(tt.addIfd(0,
+		longEntry(0x00fe, 1),
+		asciiEntry(0x010f, "Canon"),
+		asciiEntry(0x0110, model),
+		longEntry(0x0111, thumbOffset),
+		longEntry(0x0117, uint32(len(thumb))),
+		longEntry(0x014a, sub0),
+		longEntry(0x8769, exif)))
+}
+
+// TestCr2ProcessFileTifContainer verifies that a TIF raw file, without the
+// CR2 magic word, of a model with quirkTifContainer is parsed as a generic
+// TIFF-based raw file, and that of another model is rejected.
+func TestCr2ProcessFileTifContainer(t *testing.T) {
+	setupCr2()
+
+	for _, model := range []string{"Canon EOS-1D", "Canon EOS-1DS", "Canon EOS 5D Mark II"} {
+		path, dir := writeTestFile(t, "IMG_0001.TIF", buildTestTifContainer(t, model))
+		cr2, err := gCr2Parser.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75})
+		if model == "Canon EOS 5D Mark II" {
+			var he *HeaderError
+			if !errors.As(err, &he) || he.Field != "CR2 magic word" {
+				t.Errorf("Expected a CR2 magic word error for %s; got %v\n", model, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error processing TIF of %s: %v\n", model, err)
+		}
+		if cr2.PreviewWidth != 320 || cr2.PreviewHeight != 240 || cr2.CreateDate.IsZero() || cr2.CameraModel.Model != model {
+			t.Errorf("Unexpected result for %s: %+v\n", model, cr2)
+		}
 	}
 }
@@ -0,0 +1,122 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// cropAspect returns the aspect ratio, width / height, of the crop of the
+// preview of a RawFile, as stored, for thumbnails of aspect ratio aspect
+// when displayed upright: inverted if the preview is rotated by 90 or 270
+// degrees.
+func (r *RawFile) cropAspect(aspect float64) float64 {
+	if r.orientation().Degrees()%180 != 0 {
+		return 1 / aspect
+	}
+	return aspect
+}
+
+// cropDecodeEdge returns the long edge, in pixels, to decode a width x
+// height preview at, so that its crop to any aspect ratio still has a long
+// edge of at least longEdge pixels.
+func cropDecodeEdge(width, height, longEdge int) int {
+	if width <= 0 || height <= 0 {
+		return longEdge
+	}
+	long, short := max(width, height), min(width, height)
+	return (longEdge*long + short - 1) / short
+}
+
+// smartCrop determines the rectangle of aspect ratio aspect, width /
+// height, to crop an image of bounds b to: the largest such rectangle,
+// centered on the faces or, if none, the subject area of the regions,
+// which are relative to the frame of the image; centered on b if neither
+// is recorded.  The rectangle is moved within b as needed.
+// Returns the rectangle; b if aspect is not positive.
+func smartCrop(b image.Rectangle, aspect float64, regions []Region) image.Rectangle {
+	if aspect <= 0 || b.Empty() {
+		return b
+	}
+
+	w, h := b.Dx(), int(math.Round(float64(b.Dx())/aspect))
+	if h > b.Dy() {
+		w, h = int(math.Round(float64(b.Dy())*aspect)), b.Dy()
+	}
+	w, h = max(w, 1), max(h, 1)
+
+	cx, cy := float64(b.Min.X)+float64(b.Dx())/2, float64(b.Min.Y)+float64(b.Dy())/2
+	if x0, y0, x1, y1, ok := salientArea(regions); ok {
+		cx = float64(b.Min.X) + (x0+x1)/2*float64(b.Dx())
+		cy = float64(b.Min.Y) + (y0+y1)/2*float64(b.Dy())
+	}
+
+	x := min(max(int(math.Round(cx-float64(w)/2)), b.Min.X), b.Max.X-w)
+	y := min(max(int(math.Round(cy-float64(h)/2)), b.Min.Y), b.Max.Y-h)
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// salientArea determines the area of the regions to center a crop on: the
+// bounds of the faces or, if none, of the subject area, relative to their
+// frames.  Regions of unknown frames are ignored.
+// Returns the area, from x0, y0 to x1, y1, and true; false if none.
+func salientArea(regions []Region) (x0, y0, x1, y1 float64, ok bool) {
+	for _, kind := range []RegionKind{RegionFace, RegionSubject} {
+		for _, r := range regions {
+			if r.Kind != kind || r.FrameWidth <= 0 || r.FrameHeight <= 0 {
+				continue
+			}
+			x, y, w, h := r.Relative()
+			if !ok {
+				x0, y0, x1, y1, ok = x, y, x+w, y+h, true
+				continue
+			}
+			x0, y0 = min(x0, x), min(y0, y)
+			x1, y1 = max(x1, x+w), max(y1, y+h)
+		}
+		if ok {
+			return x0, y0, x1, y1, true
+		}
+	}
+	return 0, 0, 0, 0, false
+}
+
+// cropImage crops an image to the rectangle r, within its bounds, sharing
+// the pixels of img if it supports SubImage.
+// Returns the cropped image.
+func cropImage(img image.Image, r image.Rectangle) image.Image {
+	if r == img.Bounds() {
+		return img
+	}
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(r)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Rect, img, r.Min, draw.Src)
+	return dst
+}
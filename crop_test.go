@@ -0,0 +1,89 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+func TestSmartCrop(t *testing.T) {
+	b := image.Rect(0, 0, 600, 400)
+	face := Region{Kind: RegionFace, X: 0, Y: 100, Width: 60, Height: 60, FrameWidth: 600, FrameHeight: 400}
+	subject := Region{Kind: RegionSubject, X: 500, Y: 200, FrameWidth: 600, FrameHeight: 400}
+	for _, tc := range []struct {
+		name    string
+		b       image.Rectangle
+		aspect  float64
+		regions []Region
+		want    image.Rectangle
+	}{
+		{"center", b, 1, nil, image.Rect(100, 0, 500, 400)},
+		{"face", b, 1, []Region{face}, image.Rect(0, 0, 400, 400)},
+		{"subject", b, 1, []Region{subject}, image.Rect(200, 0, 600, 400)},
+		{"faces before subject", b, 1, []Region{subject, face}, image.Rect(0, 0, 400, 400)},
+		{"unknown frame", b, 1, []Region{{Kind: RegionFace, Width: 10, Height: 10}}, image.Rect(100, 0, 500, 400)},
+		{"wide", b, 2, []Region{face}, image.Rect(0, 0, 600, 300)},
+		{"scaled", image.Rect(10, 10, 160, 110), 1, []Region{subject}, image.Rect(60, 10, 160, 110)},
+		{"none", b, 0, []Region{face}, b},
+	} {
+		if got := smartCrop(tc.b, tc.aspect, tc.regions); got != tc.want {
+			t.Errorf("%s: unexpected crop: %v; expected %v\n", tc.name, got, tc.want)
+		}
+	}
+
+	r := &RawFile{Orientation: Rotate90}
+	if a := r.cropAspect(0.8); a != 1.25 {
+		t.Errorf("Unexpected aspect of a rotated preview: %v\n", a)
+	}
+}
+
+func TestRenditionsCropAspect(t *testing.T) {
+	path, dir := writeTestFile(t, "burst.NRW", buildTestNrw(t, true))
+	p, _ := NewNrwParser(isHostLittleEndian())
+
+	r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	r.Subjects = []Region{{Kind: RegionFace, X: 300, Y: 100, Width: 20, Height: 20, FrameWidth: 320, FrameHeight: 240}}
+
+	out, err := r.Renditions(&RawFileInfo{Quality: 80, CropAspect: 1}, 0, 200, 64)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	want := [][2]int{{320, 240}, {200, 200}, {64, 64}}
+	for i, rd := range out {
+		img, err := jpeg.Decode(bytes.NewReader(rd.Data))
+		if err != nil {
+			t.Fatalf("Error decoding rendition %d: %v\n", rd.Size, err)
+		}
+		b := img.Bounds()
+		if b.Dx() != want[i][0] || b.Dy() != want[i][1] || rd.Width != b.Dx() || rd.Height != b.Dy() {
+			t.Errorf("Unexpected rendition %d dimensions: %v; %dx%d\n", rd.Size, b, rd.Width, rd.Height)
+		}
+	}
+}
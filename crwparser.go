@@ -0,0 +1,259 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+// CrwParserKey is a unique identifier for the CRW raw file parser.
+// This key may be used as a key the RawParsers map.
+const CrwParserKey = "CRW"
+
+// CIFF record tags used by the CrwParser.  The tag ID is the low 14 bits of
+// the record type.
+const (
+	ciffJpegImage    = 0x2007
+	ciffSensorInfo   = 0x1031
+	ciffCapturedTime = 0x180e
+	ciffImageInfo    = 0x1810
+)
+
+// maxCiffDepth bounds the recursion into CIFF subdirectories.
+const maxCiffDepth = 8
+
+// maxCiffHeaps bounds the CIFF heaps read from a CRW, as a file may list
+// many subdirectories.
+const maxCiffHeaps = 256
+
+// crwHeader is a struct representing a CRW (CIFF) file header.
+//   Byte Order: offset 0, len 2
+//   Header Length: offset 2, len 4
+//   CIFF Signature "HEAPCCDR": offset 6, len 8
+type crwHeader struct {
+	isBigEndian bool
+	length      int64 // start of the root heap
+	signature   string
+}
+
+// CrwParser is the struct defining the state of
+// the RawFile concept.  Implements the RawParser interface.
+// This parser provides basic parsing functionaity for the Canon Raw format
+// (CRW) of 2000s-era Canon cameras.  CRW is not TIFF-based; it is a Camera
+// Image File Format (CIFF) container of nested heaps.  For a specified CRW,
+// the capture time and rotation are parsed and the embedded JPEG is
+// extracted.  The following are resources on CRW file details:
+//
+// CIFF specification: http://xyrion.org/ciff/CIFFspecV1R04.pdf
+type CrwParser struct {
+	*rawParser
+}
+
+// ProcessFile is the entry point into the CrwParser.  For a specified CRW,
+// via RawFileInfo, the file shall be processed, JPEG extracted, and
+// processed details returned to the caller.
+// Returns a pointer the RawFile data structure or error.
+func (n CrwParser) ProcessFile(info *RawFileInfo) (*RawFile, error) {
+	crw := new(RawFile)
+
+	info, err := info.withDefaults()
+	if err != nil {
+		return crw, err
+	}
+
+	f, err := openRawFile(info)
+	if err != nil {
+		return crw, err
+	}
+	defer f.Close()
+	if cached := info.Cache.lookup(f, info); cached != nil {
+		return cached, nil
+	}
+
+	cache := newReadCache(f)
+	h, err := n.processHeader(cache)
+	if err != nil {
+		return crw, err
+	}
+
+	size, err := f.Size()
+	if err != nil {
+		return crw, err
+	}
+
+	jpegInfo, meta, err := n.processHeaps(cache, size, h)
+	if err != nil {
+		return crw, err
+	}
+
+	return crw, completeRawFile(crw, info, f, jpegInfo, meta)
+}
+
+// processHeader reads the CRW header that defines:
+//   byte order;
+//   header length
+//   CIFF signature
+// Returns a pointer to the header struct or error.
+func (n CrwParser) processHeader(f io.ReaderAt) (*crwHeader, error) {
+	var h crwHeader
+
+	bytes, err := readField(0, 14, f)
+	if err != nil {
+		return &h, err
+	}
+
+	switch bytesToUShort(n.IsHostLittleEndian(), false, bytes[0:2]) {
+	case 0x4D4D:
+		h.isBigEndian = true
+	case 0x4949:
+		h.isBigEndian = false
+	default:
+		return &h, fmt.Errorf("invalid CRW byte order: 0x%x%x", bytes[0], bytes[1])
+	}
+
+	h.length = int64(bytesToUInt(n.IsHostLittleEndian(), h.isBigEndian, bytes[2:6]))
+	h.signature = bytesToASCIIString(bytes[6:14])
+	if h.signature != "HEAPCCDR" {
+		return &h, fmt.Errorf("invalid CIFF signature: '%s'", h.signature)
+	}
+
+	return &h, nil
+}
+
+// processHeaps walks the CIFF heaps of a CRW, starting with the root heap
+// that spans from the end of the header to the end of the file of size
+// bytes.
+// Currently, it parses:
+//     jpegInfo - the information pertaining to the embedded jpeg;
+//     meta - the capture time and raw dimensions;
+// Return jpegInfo, metadata or an error.
+func (n CrwParser) processHeaps(f io.ReaderAt, size int64, h *crwHeader) (*jpegInfo, *rawMetadata, error) {
+	var jpeg jpegInfo
+	var m rawMetadata
+
+	visited := make(map[int64]bool)
+	err := n.processHeap(f, h, h.length, size-h.length, 0, visited, &jpeg, &m)
+
+	return &jpeg, &m, err
+}
+
+// processHeap reads the directory of a CIFF heap and processes its records,
+// recursing into subdirectories.  The directory offset is stored in the last
+// 4 bytes of the heap; record offsets are relative to the start of the heap.
+// The start of each heap read is recorded in visited, so that a heap listed
+// again, e.g., by a subdirectory of itself, is read once.
+// Returns error.
+func (n CrwParser) processHeap(f io.ReaderAt, h *crwHeader, start, length int64, depth int, visited map[int64]bool, jpeg *jpegInfo, m *rawMetadata) error {
+	if depth > maxCiffDepth || length < 4 {
+		return fmt.Errorf("invalid CIFF heap at offset %d", start)
+	}
+	if visited[start] {
+		return fmt.Errorf("CIFF heap at offset %d listed again", start)
+	}
+	if len(visited) >= maxCiffHeaps {
+		return fmt.Errorf("CIFF heaps exceed %d", maxCiffHeaps)
+	}
+	visited[start] = true
+
+	bytes, err := readField(start+length-4, 4, f)
+	if err != nil {
+		return err
+	}
+	dirOffset := start + int64(bytesToUInt(n.IsHostLittleEndian(), h.isBigEndian, bytes))
+
+	bytes, err = readField(dirOffset, 2, f)
+	if err != nil {
+		return err
+	}
+	count := int64(bytesToUShort(n.IsHostLittleEndian(), h.isBigEndian, bytes))
+
+	records, err := readField(dirOffset+2, uint32(count*10), f)
+	if err != nil {
+		return err
+	}
+
+	for i := int64(0); i < count; i++ {
+		record := records[i*10 : i*10+10]
+		recordType := bytesToUShort(n.IsHostLittleEndian(), h.isBigEndian, record[0:2])
+		size := int64(bytesToUInt(n.IsHostLittleEndian(), h.isBigEndian, record[2:6]))
+		offset := start + int64(bytesToUInt(n.IsHostLittleEndian(), h.isBigEndian, record[6:10]))
+
+		// data stored within the record rather than the heap
+		inRecord := recordType&0xC000 == 0x4000
+		dataType := recordType & 0x3800
+		tag := recordType & 0x3FFF
+
+		switch {
+		case !inRecord && (dataType == 0x2800 || dataType == 0x3000):
+			// subdirectory; errors within are not fatal
+			if err := n.processHeap(f, h, offset, size, depth+1, visited, jpeg, m); err != nil {
+				log.Printf("Error reading CIFF subdirectory: %v\n", err)
+			}
+		case tag == ciffJpegImage && !inRecord:
+			if size > jpeg.length {
+				jpeg.offset, jpeg.length = offset, size
+			}
+		case tag == ciffCapturedTime:
+			n.processCapturedTime(f, h, record, offset, inRecord, m)
+		case tag == ciffImageInfo && !inRecord && size >= 16:
+			if bytes, err := readField(offset, 16, f); err == nil {
+				rotation := int32(bytesToUInt(n.IsHostLittleEndian(), h.isBigEndian, bytes[12:16]))
+				jpeg.orientation = orientationOfDegrees(float64(rotation))
+			}
+		case tag == ciffSensorInfo && !inRecord && size >= 6:
+			// shorts: [1] sensor width, [2] sensor height
+			if bytes, err := readField(offset, 6, f); err == nil {
+				m.imageWidth = uint32(bytesToUShort(n.IsHostLittleEndian(), h.isBigEndian, bytes[2:4]))
+				m.imageHeight = uint32(bytesToUShort(n.IsHostLittleEndian(), h.isBigEndian, bytes[4:6]))
+			}
+		}
+	}
+
+	return nil
+}
+
+// processCapturedTime reads the CIFF capture time, seconds since 1970 in
+// the camera's local time, and records it as the digitized date/time.
+func (n CrwParser) processCapturedTime(f io.ReaderAt, h *crwHeader, record []byte, offset int64, inRecord bool, m *rawMetadata) {
+	bytes := record[2:6]
+	if !inRecord {
+		var err error
+		if bytes, err = readField(offset, 4, f); err != nil {
+			return
+		}
+	}
+
+	seconds := int64(bytesToUInt(n.IsHostLittleEndian(), h.isBigEndian, bytes))
+	m.dates.digitized = time.Unix(seconds, 0).UTC().Format("2006:01:02 15:04:05")
+}
+
+// NewCrwParser creates an instance of CRW-specific RawParser.
+// Returns an instance of a CRW-specific RawParser.
+// The hostIsLittleEndian argument is ignored; see RawParser.
+func NewCrwParser(hostIsLittleEndian bool) (RawParser, string) {
+	return &CrwParser{&rawParser{}}, CrwParserKey
+}
@@ -0,0 +1,157 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+)
+
+// testCiffRecord is a synthetic CIFF record stored within the heap.
+type testCiffRecord struct {
+	recordType uint16
+	data       []byte
+}
+
+// buildTestCiffHeap builds a CIFF heap: the record data followed by the
+// directory and the directory offset.
+func buildTestCiffHeap(records ...testCiffRecord) []byte {
+	le := binary.LittleEndian
+	var heap, dir []byte
+
+	dir = le.AppendUint16(dir, uint16(len(records)))
+	for _, r := range records {
+		dir = le.AppendUint16(dir, r.recordType)
+		dir = le.AppendUint32(dir, uint32(len(r.data)))
+		dir = le.AppendUint32(dir, uint32(len(heap)))
+		heap = append(heap, r.data...)
+	}
+
+	dirOffset := uint32(len(heap))
+	heap = append(heap, dir...)
+	return le.AppendUint32(heap, dirOffset)
+}
+
+func buildTestCrw(t testing.TB) []byte {
+	le := binary.LittleEndian
+	captured := time.Date(2004, time.May, 6, 7, 8, 9, 0, time.UTC)
+
+	var capturedTime, imageInfo, sensorInfo []byte
+	capturedTime = le.AppendUint32(capturedTime, uint32(captured.Unix()))
+	capturedTime = le.AppendUint32(capturedTime, 0)
+	capturedTime = le.AppendUint32(capturedTime, 0)
+	imageInfo = le.AppendUint32(imageInfo, 3072)
+	imageInfo = le.AppendUint32(imageInfo, 2048)
+	imageInfo = le.AppendUint32(imageInfo, 0)
+	imageInfo = le.AppendUint32(imageInfo, 270)
+	for _, v := range []uint16{12, 3152, 2068} {
+		sensorInfo = le.AppendUint16(sensorInfo, v)
+	}
+
+	props := buildTestCiffHeap(
+		testCiffRecord{ciffCapturedTime, capturedTime},
+		testCiffRecord{ciffImageInfo, imageInfo},
+		testCiffRecord{ciffSensorInfo, sensorInfo})
+	root := buildTestCiffHeap(
+		testCiffRecord{ciffJpegImage, testJpeg(t, 160, 120)},
+		testCiffRecord{0x300a, props})
+
+	header := []byte{'I', 'I', 26, 0, 0, 0}
+	header = append(header, "HEAPCCDR"...)
+	header = append(header, make([]byte, 12)...)
+
+	return append(header, root...)
+}
+
+func TestCrwProcessFile(t *testing.T) {
+	path, dir := writeTestFile(t, "test.CRW", buildTestCrw(t))
+
+	p, key := NewCrwParser(isHostLittleEndian())
+	if key != CrwParserKey {
+		t.Fatalf("Unexpected key: %s\n", key)
+	}
+
+	crw, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75})
+	if err != nil {
+		t.Fatalf("Unexpected error processing CRW: %v\n", err)
+	}
+	t.Logf("Parsed CRW: %+v\n", crw)
+
+	if !crw.CreateDate.Equal(time.Date(2004, time.May, 6, 7, 8, 9, 0, time.UTC)) {
+		t.Errorf("Unexpected create date: %v\n", crw.CreateDate)
+	}
+	if crw.PreviewWidth != 160 || crw.PreviewHeight != 120 {
+		t.Errorf("Unexpected preview dimensions: %dx%d\n", crw.PreviewWidth, crw.PreviewHeight)
+	}
+	if crw.ImageWidth != 3152 || crw.ImageHeight != 2068 {
+		t.Errorf("Unexpected raw dimensions: %dx%d\n", crw.ImageWidth, crw.ImageHeight)
+	}
+	if _, err := os.Stat(crw.JpegPath); err != nil {
+		t.Errorf("Extracted jpeg not found: %v\n", err)
+	}
+}
+
+func TestCrwInvalidSignature(t *testing.T) {
+	data := buildTestCrw(t)
+	copy(data[6:14], "HEAPJUNK")
+	path, dir := writeTestFile(t, "junk.CRW", data)
+
+	p, _ := NewCrwParser(isHostLittleEndian())
+	if _, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75}); err == nil {
+		t.Fatal("Expected error processing invalid CIFF signature")
+	}
+}
+
+// TestCrwSelfReferencingHeap verifies that a heap listing itself as its
+// subdirectories, e.g., of a hostile file, is read once rather than once
+// per path through the subdirectories.
+func TestCrwSelfReferencingHeap(t *testing.T) {
+	le := binary.LittleEndian
+	const records = 7
+	length := uint32(2 + records*10 + 4)
+
+	root := le.AppendUint16(nil, records)
+	for i := 0; i < records; i++ {
+		root = le.AppendUint16(root, 0x300a)
+		root = le.AppendUint32(root, length)
+		root = le.AppendUint32(root, 0)
+	}
+	root = le.AppendUint32(root, 0)
+
+	header := []byte{'I', 'I', 26, 0, 0, 0}
+	header = append(header, "HEAPCCDR"...)
+	header = append(header, make([]byte, 12)...)
+	data := append(header, root...)
+
+	start := time.Now()
+	crw, err := ProcessBytes(data, &RawFileInfo{File: "loop.CRW", SkipExtraction: true})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Self-referencing heap read in %v\n", elapsed)
+	}
+	if err != nil || crw.PreviewWidth != 0 {
+		t.Errorf("Unexpected result: %+v, %v\n", crw, err)
+	}
+}
@@ -0,0 +1,387 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DatePolicy defines the handling of an implausible CreateDate parsed from
+// a raw file.  Cameras whose clock was never set commonly record dates such
+// as 1970 or 2099, which break downstream sorting.
+type DatePolicy int
+
+const (
+	// DateAccept uses the parsed CreateDate as-is.
+	DateAccept DatePolicy = iota
+
+	// DateFlag uses the parsed CreateDate but sets RawFile.DateSuspect.
+	DateFlag
+
+	// DateReplaceWithModTime replaces an implausible CreateDate with the
+	// raw file's modification time and sets RawFile.DateSuspect.
+	DateReplaceWithModTime
+)
+
+// earliestPlausibleDate is the earliest CreateDate considered plausible for
+// a digital camera raw file.
+var earliestPlausibleDate = time.Date(1990, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// futureDateTolerance allows for camera clocks set to a time zone ahead of
+// the host's.
+const futureDateTolerance = 24 * time.Hour
+
+// isPlausibleDate determines if a CreateDate is plausible: not before 1990
+// and not in the future.
+func isPlausibleDate(t time.Time) bool {
+	return !t.Before(earliestPlausibleDate) &&
+		!t.After(time.Now().Add(futureDateTolerance))
+}
+
+// applyDatePolicy applies the DatePolicy to a parsed CreateDate.  For
+// DateReplaceWithModTime, the modification time of f is used.
+// Returns the resulting date and true if the parsed date was implausible.
+func applyDatePolicy(policy DatePolicy, t time.Time, f interface{ Stat() (os.FileInfo, error) }) (time.Time, bool) {
+	if policy == DateAccept || isPlausibleDate(t) {
+		return t, false
+	}
+
+	if policy == DateReplaceWithModTime {
+		if mt := modTime(f); !mt.IsZero() {
+			return mt, true
+		}
+	}
+
+	return t, true
+}
+
+// DateSource identifies the source of the CreateDate of a RawFile.
+type DateSource int
+
+const (
+	// DateSourceNone: no create date was found.
+	DateSourceNone DateSource = iota
+
+	// DateSourceDigitized: the EXIF DateTimeDigitized.
+	DateSourceDigitized
+
+	// DateSourceOriginal: the EXIF DateTimeOriginal, as DateTimeDigitized
+	// is not recorded.
+	DateSourceOriginal
+
+	// DateSourceDateTime: the TIFF DateTime of IFD0, as neither EXIF date
+	// is recorded.
+	DateSourceDateTime
+
+	// DateSourceModTime: the modification time of the raw file, as no date
+	// is recorded or, for DateReplaceWithModTime, the recorded date is
+	// implausible.
+	DateSourceModTime
+)
+
+// String returns the name of the DateSource, e.g., "dateTimeOriginal";
+// empty for DateSourceNone.
+func (s DateSource) String() string {
+	switch s {
+	case DateSourceNone:
+		return ""
+	case DateSourceDigitized:
+		return "dateTimeDigitized"
+	case DateSourceOriginal:
+		return "dateTimeOriginal"
+	case DateSourceDateTime:
+		return "dateTime"
+	case DateSourceModTime:
+		return "modTime"
+	}
+	return fmt.Sprintf("DateSource(%d)", int(s))
+}
+
+// MarshalText encodes the DateSource by name.
+func (s DateSource) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// modTime reads the modification time of f.
+// Returns the modification time; zero if it could not be read.
+func modTime(f interface{ Stat() (os.FileInfo, error) }) time.Time {
+	info, err := f.Stat()
+	if err != nil {
+		log.Printf("Error reading modification time: %v\n", err)
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// dateTags is a struct representing the EXIF and GPS date/time tags from
+// which a RawFile's CreateDate is resolved.
+type dateTags struct {
+	dateTime                                string // TIFF DateTime
+	original, digitized                     string // DateTimeOriginal, DateTimeDigitized
+	offset, offsetOriginal, offsetDigitized string // OffsetTime*, e.g., "+09:00"
+	subSecOriginal, subSecDigitized         string // SubSecTime*, e.g., "59"
+	gpsDate                                 string // GPSDateStamp, e.g., "2010:08:10"
+	gpsTime                                 [3]float64
+	hasGpsTime                              bool
+}
+
+// fill records the date/time entries of other that are not recorded by d,
+// e.g., those of the EXIF of an embedded jpeg.
+func (d *dateTags) fill(other *dateTags) {
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&d.dateTime, other.dateTime},
+		{&d.original, other.original},
+		{&d.digitized, other.digitized},
+		{&d.offset, other.offset},
+		{&d.offsetOriginal, other.offsetOriginal},
+		{&d.offsetDigitized, other.offsetDigitized},
+		{&d.subSecOriginal, other.subSecOriginal},
+		{&d.subSecDigitized, other.subSecDigitized},
+		{&d.gpsDate, other.gpsDate},
+	} {
+		if *f.dst == "" {
+			*f.dst = f.src
+		}
+	}
+	if !d.hasGpsTime {
+		d.gpsTime, d.hasGpsTime = other.gpsTime, other.hasGpsTime
+	}
+}
+
+// processDateEntry records an EXIF date/time related entry.  Errors are
+// not fatal as the entries are optional.
+func processDateEntry(entry *IfdEntry, d *dateTags) {
+	var field *string
+
+	switch entry.tag {
+	case 0x9003:
+		field = &d.original
+	case 0x9004:
+		field = &d.digitized
+	case 0x9010:
+		field = &d.offset
+	case 0x9011:
+		field = &d.offsetOriginal
+	case 0x9012:
+		field = &d.offsetDigitized
+	case 0x9291:
+		field = &d.subSecOriginal
+	case 0x9292:
+		field = &d.subSecDigitized
+	default:
+		return
+	}
+
+	val, err := entry.ASCII()
+	if err == nil {
+		*field = val
+	}
+}
+
+// processGpsIfd reads the GPS IFD, referenced by the GPS IFD pointer
+// entry, for the GPS date stamp and time stamp (UTC).  Errors are not fatal
+// as the entries are optional.
+func processGpsIfd(isHostLe, isFileBe bool, entry *IfdEntry, f io.ReaderAt, m *rawMetadata) {
+	entries, err := processIfdOf(isHostLe, isFileBe, entry, f)
+	if err != nil {
+		m.readFailed("GPS IFD", 0, err)
+	}
+	processGpsEntries(isHostLe, isFileBe, entries, f, m)
+}
+
+// processGpsEntries reads the GPS date and time entries of a GPS IFD.
+func processGpsEntries(isHostLe, isFileBe bool, entries *list.List, f io.ReaderAt, m *rawMetadata) {
+	m.tags.record(entries, gpsTags)
+	d := &m.dates
+
+	for e := entries.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(IfdEntry)
+		switch {
+		case entry.tag == 0x0007 && entry.count == 3: // GPSTimeStamp
+			hasTime := true
+			for i := range d.gpsTime {
+				num, den, _, err := processRationalEntry(isHostLe, isFileBe, entry.offset+int64(i*8), f)
+				if err != nil || den == 0 {
+					hasTime = false
+					break
+				}
+				d.gpsTime[i] = float64(num) / float64(den)
+			}
+			d.hasGpsTime = hasTime
+		case entry.tag == 0x001d: // GPSDateStamp
+			d.gpsDate, _ = entry.ASCII()
+		}
+	}
+}
+
+// createDate resolves the CreateDate from, in order of precedence, the
+// EXIF DateTimeDigitized, the EXIF DateTimeOriginal, or the TIFF DateTime
+// of IFD0, in the time zone given by, in order of precedence: the EXIF
+// offset time, the difference between the GPS timestamp and the local
+// time, or defaultLoc (UTC if nil).  Sub-second precision is applied if
+// present.
+// Returns the create date (zero if not present), its source or error.
+func (d *dateTags) createDate(defaultLoc *time.Location) (time.Time, DateSource, error) {
+	var local, offset, subSec string
+	var source DateSource
+
+	switch {
+	case d.digitized != "":
+		local, source = d.digitized, DateSourceDigitized
+		offset = firstNonEmpty(d.offsetDigitized, d.offsetOriginal, d.offset)
+		subSec = firstNonEmpty(d.subSecDigitized, d.subSecOriginal)
+	case d.original != "":
+		local, source = d.original, DateSourceOriginal
+		offset = firstNonEmpty(d.offsetOriginal, d.offset)
+		subSec = d.subSecOriginal
+	case d.dateTime != "":
+		local, source = d.dateTime, DateSourceDateTime
+		offset = d.offset
+	default:
+		return time.Time{}, DateSourceNone, nil
+	}
+
+	loc := defaultLoc
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	if offset != "" {
+		if zone, err := parseOffsetTime(offset); err == nil {
+			loc = zone
+		} else {
+			log.Printf("Ignoring invalid offset time: %v\n", err)
+		}
+	} else if zone, ok := d.gpsZone(local); ok {
+		loc = zone
+	}
+
+	t, err := parseDateTimeIn(local, loc)
+	if err != nil {
+		return t, source, err
+	}
+
+	if subSec != "" {
+		t = t.Add(parseSubSecTime(subSec))
+	}
+
+	return t, source, nil
+}
+
+// gpsZone derives the time zone of the local date/time from the difference
+// to the GPS timestamp (UTC), rounded to 15 minutes.
+// Returns the zone and true if the GPS date and time are present and the
+// difference is a valid UTC offset; false otherwise.
+func (d *dateTags) gpsZone(localTime string) (*time.Location, bool) {
+	if !d.hasGpsTime || d.gpsDate == "" {
+		return nil, false
+	}
+
+	local, err := parseDateTime(localTime)
+	if err != nil {
+		return nil, false
+	}
+
+	gpsDate, err := parseDateTime(d.gpsDate + " 00:00:00")
+	if err != nil {
+		return nil, false
+	}
+	seconds := d.gpsTime[0]*3600 + d.gpsTime[1]*60 + d.gpsTime[2]
+	gps := gpsDate.Add(time.Duration(seconds * float64(time.Second)))
+
+	const quarterHour = 15 * 60
+	diff := local.Sub(gps).Seconds()
+	offset := int(math.Floor(diff/quarterHour+0.5)) * quarterHour
+	if offset < -12*3600 || offset > 14*3600 {
+		return nil, false
+	}
+
+	return time.FixedZone("", offset), true
+}
+
+// parseOffsetTime converts an EXIF offset time string, e.g., "+09:00",
+// into a fixed time zone.
+// Returns the time zone or error.
+func parseOffsetTime(s string) (*time.Location, error) {
+	if len(s) != 6 || (s[0] != '+' && s[0] != '-') || s[3] != ':' {
+		return nil, fmt.Errorf("invalid offset time: '%s'", s)
+	}
+
+	hours, err := strconv.Atoi(s[1:3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid offset time: '%s'", s)
+	}
+	minutes, err := strconv.Atoi(s[4:6])
+	if err != nil || hours > 14 || minutes > 59 {
+		return nil, fmt.Errorf("invalid offset time: '%s'", s)
+	}
+
+	offset := hours*3600 + minutes*60
+	if s[0] == '-' {
+		offset = -offset
+	}
+
+	return time.FixedZone(s, offset), nil
+}
+
+// parseSubSecTime converts an EXIF sub-second time string, the decimal
+// digits of the fractional second, e.g., "59" for 0.59s, into a duration.
+// Returns the duration; zero if invalid.
+func parseSubSecTime(s string) time.Duration {
+	s = strings.TrimSpace(s)
+	if len(s) > 9 {
+		s = s[:9]
+	}
+
+	val, err := strconv.Atoi(s)
+	if err != nil || val < 0 {
+		return 0
+	}
+	for i := len(s); i < 9; i++ {
+		val *= 10
+	}
+
+	return time.Duration(val)
+}
+
+// firstNonEmpty returns the first non-empty string; empty if none.
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
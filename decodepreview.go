@@ -0,0 +1,115 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+)
+
+// previewDecodeBufferSize is the size of the buffer through which the
+// embedded jpeg is decoded: the raw file is read in reads of this size,
+// e.g., ranged requests of a RangeReaderAt, rather than in the small reads
+// of the decoder.
+const previewDecodeBufferSize = 256 << 10
+
+// DecodePreview decodes the embedded JPEG of a raw file straight from the
+// raw file, without extracting it to a file or reading it whole into
+// memory first.  The raw file is parsed, without extraction, by the parser
+// registered for its file extension.  The image is as stored: it is not
+// rotated by the Orientation of the raw file.  If info.ConvertToSRGB is
+// set, a preview in Adobe RGB, by the ColorSpace of the raw file, is
+// converted to sRGB; the ICC profile of the preview is not read.
+// Returns the image or error.
+func DecodePreview(info *RawFileInfo) (image.Image, error) {
+	parseInfo := *info
+	parseInfo.SkipExtraction = true
+
+	r, err := processFileFallback(&parseInfo, ErrUnknownFormat)
+	if err != nil {
+		return nil, err
+	}
+	return r.DecodePreview(info)
+}
+
+// DecodePreview decodes the embedded JPEG of a parsed raw file, opened as
+// by Extract, as the package-level DecodePreview does.  The preview
+// dimensions of the RawFile are updated.  A preview exceeding
+// info.MaxPreviewMemory is not decoded.
+// Returns the image or an error wrapping ErrExtractionFailed.
+func (r *RawFile) DecodePreview(info *RawFileInfo) (image.Image, error) {
+	if r.preview == nil {
+		return nil, fmt.Errorf("%w: %w", ErrExtractionFailed, ErrNoPreview)
+	}
+
+	f, err := r.openRawFile(info)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrExtractionFailed, err)
+	}
+	defer f.Close()
+
+	j := *r.preview
+	err = checkPreviewMemory(f, &j, info.MaxPreviewMemory)
+	var img image.Image
+	if err == nil {
+		img, err = decodePreview(f, &j)
+	}
+	r.ReadStats.add(f.stats())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrExtractionFailed, err)
+	}
+
+	r.PreviewWidth, r.PreviewHeight = j.width, j.height
+	r.Panorama = isPanorama(j.width, j.height)
+	r.setImageDimensions(&j)
+
+	if r.previewSpace(info) == ColorSpaceAdobeRGB {
+		img = adobeRGBToSRGB(img)
+	}
+	return img, nil
+}
+
+// decodePreview decodes the embedded jpeg through a buffered reader over
+// its byte range.  Its markers and dimensions, within the limits of the
+// decoder, are verified first, and the dimensions recorded in j.
+// Returns the image or error.
+func decodePreview(f io.ReaderAt, j *jpegInfo) (image.Image, error) {
+	if err := verifyPreview(f, j); err != nil {
+		return nil, err
+	}
+	width, height, err := previewConfig(newReadCache(f), j)
+	if err != nil {
+		return nil, err
+	}
+	if width*height > maxGoDecodePixels {
+		return nil, fmt.Errorf("%w: %dx%d exceeds %d pixels",
+			ErrPreviewTooLarge, width, height, maxGoDecodePixels)
+	}
+	j.width, j.height = width, height
+
+	return jpeg.Decode(bufio.NewReaderSize(previewReader(f, j), previewDecodeBufferSize))
+}
@@ -0,0 +1,112 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodePreview(t *testing.T) {
+	for _, name := range []string{TestNefFile, TestCR2File} {
+		img, err := DecodePreview(&RawFileInfo{File: name})
+		if err != nil {
+			t.Fatalf("Unexpected error decoding the preview of %s: %v\n", name, err)
+		}
+
+		// the same image as decoded from the preview bytes
+		r, err := NewFormatParser(name[len(name)-3:]).ProcessFile(&RawFileInfo{File: name, SkipExtraction: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		f, err := r.openRawFile(&RawFileInfo{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		data, err := readPreview(f, r.preview)
+		f.Close()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		want, err := decodeJpeg(data)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		if img.Bounds() != want.Bounds() || img.At(100, 100) != want.At(100, 100) {
+			t.Errorf("%s: expected %v; got %v\n", name, want.Bounds(), img.Bounds())
+		}
+
+		// the preview is read once, in buffer-sized reads, after its markers
+		before := r.ReadStats
+		if _, err := r.DecodePreview(&RawFileInfo{}); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		reads := r.ReadStats.ReadCalls - before.ReadCalls
+		if bytes := r.ReadStats.BytesRead - before.BytesRead; bytes > r.PreviewBytes+2*readCacheBlockSize+2+previewTailSize ||
+			reads > r.PreviewBytes/previewDecodeBufferSize+6 {
+			t.Errorf("%s: unexpected reads of a %d-byte preview: %d reads, %d bytes\n", name, r.PreviewBytes, reads, bytes)
+		}
+		if r.PreviewWidth != img.Bounds().Dx() {
+			t.Errorf("%s: expected preview width %d; got %d\n", name, img.Bounds().Dx(), r.PreviewWidth)
+		}
+	}
+}
+
+func TestDecodePreviewNoPreview(t *testing.T) {
+	r := new(RawFile)
+	if _, err := r.DecodePreview(&RawFileInfo{}); !errors.Is(err, ErrNoPreview) {
+		t.Errorf("Expected ErrNoPreview; got %v\n", err)
+	}
+
+	path, _ := writeTestFile(t, "test.ABC", []byte("not a raw file"))
+	if _, err := DecodePreview(&RawFileInfo{File: path}); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Expected ErrUnknownFormat; got %v\n", err)
+	}
+}
+
+func TestDecodeSmallImage(t *testing.T) {
+	img, err := DecodeSmallImage(&RawFileInfo{File: TestCR2File})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if b := img.Bounds(); b.Dx() != 362 || b.Dy() != 234 {
+		t.Errorf("Expected a 362x234 image; got %v\n", b)
+	}
+
+	// scaled between the darkest and brightest samples
+	var darkest, brightest uint32 = 0xffff, 0
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			darkest, brightest = min(darkest, r, g, b), max(brightest, r, g, b)
+		}
+	}
+	if darkest != 0 || brightest != 0xffff {
+		t.Errorf("Unexpected range of samples: %d to %d\n", darkest, brightest)
+	}
+
+	if _, err := DecodeSmallImage(&RawFileInfo{File: TestNefFile}); !errors.Is(err, ErrNoSmallImage) {
+		t.Errorf("Expected ErrNoSmallImage for a NEF; got %v\n", err)
+	}
+}
@@ -0,0 +1,162 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// DedupeMode defines how a BatchProcessor identifies duplicate files, e.g.,
+// the same card dumped twice.  Only one file of each group of duplicates
+// is processed; the others are reported via BatchResult.DuplicateOf.
+type DedupeMode int
+
+const (
+	// DedupeNone processes every file.
+	DedupeNone DedupeMode = iota
+
+	// DedupeContent groups files with identical content (SHA-256).  Only
+	// files of equal size are hashed.
+	DedupeContent
+
+	// DedupePhotoID groups files with the same RawFile.PhotoID, which also
+	// detects copies whose metadata was modified.  Every file is parsed by
+	// the pre-pass; the preview of one file per group is extracted.  Files
+	// without a PhotoID are not grouped.
+	DedupePhotoID
+)
+
+// WithDedupe enables a pre-pass grouping duplicate files before extraction.
+func WithDedupe(mode DedupeMode) BatchOption {
+	return func(b *BatchProcessor) {
+		b.dedupe = mode
+	}
+}
+
+// dedupeByContent groups the files of a batch by size and then by content
+// hash.  The first file of each group is its representative.
+// Returns the indexes of the files to process.
+func (b *BatchProcessor) dedupeByContent(results []BatchResult) []int {
+	bySize := make(map[int64][]int)
+	var sizes []int64 // in order of the first file of each size
+	for i := range results {
+		fi, err := os.Stat(results[i].File)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		if _, ok := bySize[fi.Size()]; !ok {
+			sizes = append(sizes, fi.Size())
+		}
+		bySize[fi.Size()] = append(bySize[fi.Size()], i)
+	}
+
+	// hash the files sharing a size
+	hashes := make([]string, len(results))
+	var toHash []int
+	for _, size := range sizes {
+		if group := bySize[size]; len(group) > 1 {
+			toHash = append(toHash, group...)
+		}
+	}
+	b.forEach(toHash, func(i int) {
+		b.withOpenFiles(func() { hashes[i], results[i].Err = hashFile(results[i].File) })
+	})
+
+	var pending []int
+	for _, size := range sizes {
+		representatives := make(map[string]int)
+		for _, i := range bySize[size] {
+			if results[i].Err != nil {
+				continue
+			}
+			if first, ok := representatives[hashes[i]]; ok {
+				results[i].DuplicateOf = results[first].File
+				continue
+			}
+			representatives[hashes[i]] = i
+			pending = append(pending, i)
+		}
+	}
+	slices.Sort(pending)
+	return pending
+}
+
+// dedupeByPhotoID parses the files of a batch, without extraction, and
+// groups them by PhotoID.  The first file of each group is its
+// representative.
+// Returns the indexes of the files to process.
+func (b *BatchProcessor) dedupeByPhotoID(results []BatchResult) []int {
+	all := make([]int, len(results))
+	for i := range all {
+		all[i] = i
+	}
+	b.forEach(all, func(i int) {
+		res := &results[i]
+		p := NewFormatParser(filepath.Ext(res.File))
+		if p == nil {
+			// reported by processFile
+			return
+		}
+		b.withOpenFiles(func() {
+			res.RawFile, res.Err = p.ProcessFile(&RawFileInfo{File: res.File, SkipExtraction: true, TagHooks: b.tagHooks})
+		})
+		if res.Err != nil {
+			res.RawFile = nil
+		}
+	})
+
+	representatives := make(map[string]int)
+	var pending []int
+	for i := range results {
+		res := &results[i]
+		if res.Err != nil {
+			continue
+		}
+		if res.RawFile != nil && res.RawFile.PhotoID != "" {
+			if first, ok := representatives[res.RawFile.PhotoID]; ok {
+				res.DuplicateOf = results[first].File
+				continue
+			}
+			representatives[res.RawFile.PhotoID] = i
+		}
+		pending = append(pending, i)
+	}
+	return pending
+}
+
+// hashFile computes the SHA-256 of the content of a file.
+// Returns the hex-encoded hash or error.
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	sha, _, err := checksum(f, ChecksumSHA256)
+	return sha, err
+}
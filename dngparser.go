@@ -0,0 +1,128 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"strings"
+)
+
+// DngParserKey is a unique identifier for the DNG raw file parser.
+// This key may be used as a key the RawParsers map.
+const DngParserKey = "DNG"
+
+// GprParserKey is a unique identifier for the GoPro GPR raw file parser.
+// This key may be used as a key the RawParsers map.
+const GprParserKey = "GPR"
+
+// vc5Compression is the TIFF compression value of GoPro's VC-5 codec.
+const vc5Compression = 9
+
+// DngVariant identifies vendor-specific variants of the Digital Negative
+// (DNG) format.
+type DngVariant int
+
+const (
+	// DngGeneric is a DNG without known vendor quirks.
+	DngGeneric DngVariant = iota
+
+	// DngGoProGpr is a GoPro GPR: a DNG whose raw image is VC-5 compressed.
+	DngGoProGpr
+
+	// DngDji is a DNG written by a DJI drone or camera.
+	DngDji
+)
+
+// String returns the name of the DNG variant.
+func (v DngVariant) String() string {
+	switch v {
+	case DngGoProGpr:
+		return "GPR"
+	case DngDji:
+		return "DJI"
+	}
+	return "DNG"
+}
+
+// dngVariantOf identifies the DNG variant from the parsed metadata.
+func dngVariantOf(m *rawMetadata) DngVariant {
+	switch {
+	case m.rawCompression == vc5Compression || strings.EqualFold(m.make, "GoPro"):
+		return DngGoProGpr
+	case strings.EqualFold(m.make, "DJI"):
+		return DngDji
+	}
+	return DngGeneric
+}
+
+// DngParser is the struct defining the state of
+// the RawFile concept.  Implements the RawParser interface.
+// This parser provides basic parsing functionaity for the Adobe Digital
+// Negative format (DNG), including the DJI variant.  The EXIF create time
+// and orientation are parsed and the largest embedded JPEG preview is
+// extracted.  The following are resources on DNG file details:
+//
+// DNG specification: https://helpx.adobe.com/photoshop/digital-negative.html
+type DngParser struct {
+	tiffParser
+}
+
+// ProcessFile is the entry point into the DngParser.  For a specified DNG,
+// via RawFileInfo, the file shall be processed, JPEG extracted, and
+// processed details returned to the caller.
+// Returns a pointer the RawFile data structure or error.
+func (n DngParser) ProcessFile(info *RawFileInfo) (*RawFile, error) {
+	return n.processTiffFile(info)
+}
+
+// NewDngParser creates an instance of DNG-specific RawParser.
+// Returns an instance of a DNG-specific RawParser.
+// The hostIsLittleEndian argument is ignored; see RawParser.
+func NewDngParser(hostIsLittleEndian bool) (RawParser, string) {
+	return &DngParser{tiffParser{rawParser: &rawParser{}}}, DngParserKey
+}
+
+// GprParser is the struct defining the state of
+// the RawFile concept.  Implements the RawParser interface.
+// This parser provides basic parsing functionaity for the GoPro raw format
+// (GPR).  GPR is a DNG whose raw image is VC-5 compressed; the DNG-compatible
+// metadata is parsed and the embedded JPEG preview is extracted.  The VC-5
+// raw image data is not decoded.
+type GprParser struct {
+	tiffParser
+}
+
+// ProcessFile is the entry point into the GprParser.  For a specified GPR,
+// via RawFileInfo, the file shall be processed, JPEG extracted, and
+// processed details returned to the caller.
+// Returns a pointer the RawFile data structure or error.
+func (n GprParser) ProcessFile(info *RawFileInfo) (*RawFile, error) {
+	return n.processTiffFile(info)
+}
+
+// NewGprParser creates an instance of GPR-specific RawParser.
+// Returns an instance of a GPR-specific RawParser.
+// The hostIsLittleEndian argument is ignored; see RawParser.
+func NewGprParser(hostIsLittleEndian bool) (RawParser, string) {
+	return &GprParser{tiffParser{rawParser: &rawParser{}}}, GprParserKey
+}
@@ -0,0 +1,130 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func buildTestDng(t testing.TB, make string, withPreview bool, rawCompression uint32) []byte {
+	tt := newTestTiff(false)
+
+	raw := tt.addIfd(0,
+		longEntry(0x00fe, 0),
+		longEntry(0x0100, 4000),
+		longEntry(0x0101, 3000),
+		shortEntry(0x0103, rawCompression))
+
+	entries := []testEntry{
+		longEntry(0x00fe, 1),
+		asciiEntry(0x010f, make),
+		asciiEntry(0x0132, "2019:10:11 12:13:14"),
+		longEntry(0x014a, raw),
+		{tag: 0xc612, fieldType: 1, raw: []byte{1, 4, 0, 0}},
+	}
+	if withPreview {
+		preview := testJpeg(t, 200, 150)
+		entries = append(entries,
+			shortEntry(0x0103, 7),
+			longEntry(0x0111, tt.addBlob(preview)),
+			longEntry(0x0117, uint32(len(preview))))
+	}
+
+	return tt.bytes(tt.addIfd(0, entries...))
+}
+
+func TestGprProcessFile(t *testing.T) {
+	path, dir := writeTestFile(t, "test.GPR", buildTestDng(t, "GoPro", true, vc5Compression))
+
+	p, key := NewGprParser(isHostLittleEndian())
+	if key != GprParserKey {
+		t.Fatalf("Unexpected key: %s\n", key)
+	}
+
+	gpr, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75})
+	if err != nil {
+		t.Fatalf("Unexpected error processing GPR: %v\n", err)
+	}
+	if gpr.DngVersion != "1.4.0.0" || gpr.DngVariant != DngGoProGpr {
+		t.Errorf("Unexpected DNG version/variant: %s %v\n", gpr.DngVersion, gpr.DngVariant)
+	}
+	if gpr.PreviewWidth != 200 || gpr.ImageWidth != 4000 {
+		t.Errorf("Unexpected dimensions: %+v\n", gpr)
+	}
+}
+
+func TestDngDjiWithoutPreview(t *testing.T) {
+	path, dir := writeTestFile(t, "test.DNG", buildTestDng(t, "DJI", false, 1))
+
+	p, _ := NewDngParser(isHostLittleEndian())
+	dng, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75})
+	if !errors.Is(err, ErrExtractionFailed) {
+		t.Fatalf("Expected ErrExtractionFailed; got: %v\n", err)
+	}
+	if dng.DngVariant != DngDji || dng.DngVariant.String() != "DJI" {
+		t.Errorf("Unexpected DNG variant: %v\n", dng.DngVariant)
+	}
+	if !dng.CreateDate.Equal(time.Date(2019, time.October, 11, 12, 13, 14, 0, time.UTC)) {
+		t.Errorf("Unexpected create date: %v\n", dng.CreateDate)
+	}
+}
+
+func TestDngBigTIFF(t *testing.T) {
+	// a stitched DNG over 4 GB: a BigTIFF whose preview is beyond 4 GB
+	const previewOffset = 5 << 30
+	preview := testJpeg(t, 320, 240)
+	date := []byte("2019:10:11 12:13:14\x00")
+
+	le := binary.LittleEndian
+	b := le.AppendUint64([]byte{'I', 'I', 43, 0, 8, 0, 0, 0}, 16)
+	entry := func(tag, typ uint16, count, value uint64) {
+		b = le.AppendUint64(le.AppendUint16(le.AppendUint16(b, tag), typ), count)
+		b = le.AppendUint64(b, value)
+	}
+	b = le.AppendUint64(b, 6)
+	entry(0x00fe, 4, 1, 0)
+	entry(0x0100, 4, 1, 80000)
+	entry(0x0101, 4, 1, 20000)
+	entry(0x0132, 2, uint64(len(date)), 16+8+6*20+8)
+	entry(0x0201, 16, 1, previewOffset) // LONG8
+	entry(0x0202, 4, 1, uint64(len(preview)))
+	b = append(le.AppendUint64(b, 0), date...)
+	f := &sparseFile{header: b, blobOffset: previewOffset, blob: preview}
+
+	p, _ := NewDngParser(isHostLittleEndian())
+	dng, err := p.ProcessFile(&RawFileInfo{File: "stitched.DNG", Reader: f, DestDir: t.TempDir(), Quality: 75})
+	if err != nil {
+		t.Fatalf("Unexpected error processing BigTIFF DNG: %v\n", err)
+	}
+	if dng.PreviewWidth != 320 || dng.ImageWidth != 80000 || dng.CreateDate.Year() != 2019 {
+		t.Errorf("Unexpected BigTIFF DNG result: %+v\n", dng)
+	}
+	if _, err := os.Stat(dng.JpegPath); err != nil {
+		t.Errorf("Extracted jpeg not found: %v\n", err)
+	}
+}
@@ -0,0 +1,656 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+// Package dngwriter converts the raw files of supported formats to DNG:
+// the raw image data, decoded, is written uncompressed with the metadata
+// describing it (the CFA pattern, active area, default crop, black and
+// white levels, and white balance) and the EXIF metadata of the raw file.
+// It is an alternative to the Adobe DNG Converter for the raw files
+// supported: Nikon NEFs, compressed (lossless or lossy) or uncompressed,
+// and Canon CR2s of lossless JPEG raw image data, of an RGB CFA.
+//
+// The DNG specification:
+// https://helpx.adobe.com/camera-raw/digital-negative.html
+package dngwriter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jeremytorres/rawparser"
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// ErrUnsupported is returned converting a raw file of an unsupported
+// format, compression, or CFA.
+var ErrUnsupported = errors.New("dngwriter: unsupported raw file")
+
+// maxRawLength is the largest length, in bytes, of the raw image data read.
+const maxRawLength = 1 << 30
+
+// calibrationD65 is the CalibrationIlluminant of D65 daylight.
+const calibrationD65 = 21
+
+// srgbMatrix is the matrix from XYZ to linear sRGB, row by row: the
+// default ColorMatrix1, under D65.
+var srgbMatrix = [9]float64{
+	3.2406, -1.5372, -0.4986,
+	-0.9689, 1.8758, 0.0415,
+	0.0557, -0.2040, 1.0570,
+}
+
+// Options are the options of Convert.
+type Options struct {
+	// ColorMatrix is the ColorMatrix1 of the DNG, row by row: the matrix
+	// from XYZ to the color space of the camera under D65 daylight, e.g.,
+	// as published by the Adobe DNG Converter for the camera model.
+	// Defaults to the matrix from XYZ to linear sRGB, which renders the
+	// colors of the camera approximately.
+	ColorMatrix [9]float64
+}
+
+// dngExifTags are the tags of IFD0 of the EXIF metadata of a raw file
+// copied to the DNG.
+var dngExifTags = map[uint16]bool{
+	0x010e: true, // ImageDescription
+	0x010f: true, // Make
+	0x0110: true, // Model
+	0x0112: true, // Orientation
+	0x011a: true, // XResolution
+	0x011b: true, // YResolution
+	0x0128: true, // ResolutionUnit
+	0x0131: true, // Software
+	0x0132: true, // ModifyDate
+	0x013b: true, // Artist
+	0x02bc: true, // ApplicationNotes (XMP)
+	0x8298: true, // Copyright
+	0x83bb: true, // IPTC-NAA
+	0x9003: true, // DateTimeOriginal
+}
+
+// mosaic is the decoded raw image data of a raw file and the metadata of
+// the DNG describing it.
+type mosaic struct {
+	pix           []uint16
+	width, height int
+
+	// black and white are the BlackLevel and WhiteLevel.
+	black, white int
+
+	// neutral is the AsShotNeutral: the values of a neutral color in the
+	// color space of the camera, red, green, and blue; nil if not recorded.
+	neutral []float64
+}
+
+// Convert converts a raw file, a NEF or CR2 as identified by the extension
+// of info.File, to an uncompressed DNG written to w.  The raw file is read
+// from info.Reader, info.Handle, or info.File, as by the rawparser
+// parsers; the other fields of info are ignored.  The EXIF metadata of the
+// raw file, including its IFD0 (e.g., the make, model, orientation, and
+// date) and its EXIF and GPS IFDs, is copied.  opts may be nil.
+// Returns error; ErrUnsupported if the raw file is not supported.
+func Convert(info *rawparser.RawFileInfo, w io.Writer, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	key := strings.ToUpper(strings.TrimPrefix(filepath.Ext(info.File), "."))
+	if key != "NEF" && key != "CR2" {
+		return fmt.Errorf("%w: '%s' is not a NEF or CR2", ErrUnsupported, info.File)
+	}
+
+	parseInfo := rawparser.RawFileInfo{File: info.File, Reader: info.Reader, Size: info.Size, Handle: info.Handle, SkipExtraction: true}
+	raw, err := rawparser.NewFormatParser(key).ProcessFile(&parseInfo)
+	if err != nil {
+		return err
+	}
+	img := raw.RawImage
+	if img == nil {
+		return fmt.Errorf("%w: no raw image data in '%s'", ErrUnsupported, info.File)
+	}
+	cfa, err := cfaValues(img.CFAPattern)
+	if err != nil && key == "CR2" && img.CFAPattern == "" {
+		// Canon sensors are RGGB from the origin of the raw image data
+		cfa, err = shiftRGGB(img.ActiveArea)
+	}
+	if err != nil {
+		return err
+	}
+
+	var r io.ReaderAt
+	switch {
+	case info.Reader != nil:
+		r = info.Reader
+	case info.Handle != nil:
+		r = info.Handle
+	default:
+		f, err := os.Open(info.File)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var m *mosaic
+	if key == "NEF" {
+		m, err = decodeNef(r, img)
+	} else {
+		m, err = decodeCr2(r, img)
+	}
+	if err != nil {
+		return fmt.Errorf("decoding raw image data of '%s': %w", info.File, err)
+	}
+
+	exif, err := rawparser.ExifData(&parseInfo)
+	if err != nil {
+		log.Printf("Converting '%s' without EXIF metadata: %v\n", info.File, err)
+		exif = nil
+	}
+
+	d := &dng{
+		mosaic:      m,
+		image:       img,
+		cfa:         cfa,
+		model:       raw.CameraModel.String(),
+		colorMatrix: opts.ColorMatrix,
+	}
+	if d.colorMatrix == ([9]float64{}) {
+		d.colorMatrix = srgbMatrix
+	}
+	return d.encode(w, exif)
+}
+
+// cfaValues converts a CFAPattern of rawparser.RawImage to the values of
+// the CFAPattern tag: 0 for red, 1 for green, and 2 for blue.
+// Returns the values or error wrapping ErrUnsupported if not a 2 by 2 RGB
+// pattern.
+func cfaValues(pattern string) ([]byte, error) {
+	if len(pattern) != 4 {
+		return nil, fmt.Errorf("%w: CFA pattern '%s'", ErrUnsupported, pattern)
+	}
+	values := make([]byte, len(pattern))
+	for i, c := range []byte(pattern) {
+		v := strings.IndexByte("RGB", c)
+		if v < 0 {
+			return nil, fmt.Errorf("%w: CFA pattern '%s'", ErrUnsupported, pattern)
+		}
+		values[i] = byte(v)
+	}
+	return values, nil
+}
+
+// shiftRGGB returns the values of the RGGB CFA pattern, from the origin of
+// the raw image data, from the top-left pixel of an active area.
+// Returns the values or error.
+func shiftRGGB(active rawparser.Area) ([]byte, error) {
+	rggb := []byte("RGGB")
+	pattern := make([]byte, 4)
+	for y := range 2 {
+		for x := range 2 {
+			pattern[2*y+x] = rggb[2*((y+active.Top)&1)+(x+active.Left)&1]
+		}
+	}
+	return cfaValues(string(pattern))
+}
+
+// findIFD finds an IFD of a TIFF-based raw file by name, e.g., "SubIFD1",
+// as named by rawparser.RawImage.
+// Returns the IFD, the byte order of the file, or error.
+func findIFD(r io.ReaderAt, name string) (*tiff.IFD, binary.ByteOrder, error) {
+	h, err := tiff.ReadHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var found *tiff.IFD
+	err = tiff.WalkIFDs(r, h, func(ifd *tiff.IFD) error {
+		if fmt.Sprintf("%s%d", ifd.Kind, ifd.Index) == name {
+			found = ifd
+			return tiff.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if found == nil {
+		return nil, nil, fmt.Errorf("%w: %s not found", errCorrupt, name)
+	}
+	return found, h.ByteOrder, nil
+}
+
+// readStrips reads the strips of an IFD, in order.
+// Returns the data or error.
+func readStrips(r io.ReaderAt, ifd *tiff.IFD) ([]byte, error) {
+	offsets, counts := ifd.Find(0x0111), ifd.Find(0x0117)
+	if offsets == nil || counts == nil {
+		return nil, fmt.Errorf("%w: missing strips", ErrUnsupported)
+	}
+	o, err := offsets.Uints64()
+	if err != nil {
+		return nil, err
+	}
+	c, err := counts.Uints64()
+	if err != nil {
+		return nil, err
+	}
+	if len(o) != len(c) {
+		return nil, fmt.Errorf("%w: %d strip offsets and %d byte counts", errCorrupt, len(o), len(c))
+	}
+
+	var length uint64
+	for _, n := range c {
+		length += n
+	}
+	if length > maxRawLength {
+		return nil, fmt.Errorf("%w: raw image data of %d bytes", ErrUnsupported, length)
+	}
+	data := make([]byte, 0, length)
+	for i := range o {
+		if o[i] > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: strip offset %d", errCorrupt, o[i])
+		}
+		strip := make([]byte, c[i])
+		if _, err := r.ReadAt(strip, int64(o[i])); err != nil {
+			return nil, fmt.Errorf("reading strip %d: %w", i, err)
+		}
+		data = append(data, strip...)
+	}
+	return data, nil
+}
+
+// readMakerNote reads the IFD of the maker note of the EXIF IFD of a
+// TIFF-based raw file.  The IFD of a Nikon maker note ("Nikon\0" followed
+// by a TIFF header) is read from the embedded TIFF data; otherwise, the
+// maker note is an IFD of the byte order of the file.
+// Returns the IFD, the byte order of its values, or error.
+func readMakerNote(r io.ReaderAt) (*tiff.IFD, binary.ByteOrder, error) {
+	exif, order, err := findIFD(r, "EXIF0")
+	if err != nil {
+		return nil, nil, err
+	}
+	e := exif.Find(0x927c)
+	if e == nil {
+		return nil, nil, fmt.Errorf("%w: missing maker note", ErrUnsupported)
+	}
+
+	magic := make([]byte, 6)
+	if _, err := r.ReadAt(magic, e.Offset); err != nil {
+		return nil, nil, err
+	}
+	if string(magic) != "Nikon\x00" {
+		ifd, err := tiff.ReadIFD(r, order, e.Offset)
+		return ifd, order, err
+	}
+
+	note := io.NewSectionReader(r, e.Offset+10, e.Size()-10)
+	h, err := tiff.ReadHeader(note)
+	if err != nil {
+		return nil, nil, err
+	}
+	ifd, err := tiff.ReadIFD(note, h.ByteOrder, h.Offset)
+	return ifd, h.ByteOrder, err
+}
+
+// decodeNef decodes the raw image data of a NEF: Nikon compressed, as
+// described by the NEFLinearizationTable of the maker note, or
+// uncompressed, of 16-bit or packed samples.  The black level and white
+// balance are those of the maker note.
+// Returns the mosaic or error.
+func decodeNef(r io.ReaderAt, img *rawparser.RawImage) (*mosaic, error) {
+	ifd, order, err := findIFD(r, img.IFD)
+	if err != nil {
+		return nil, err
+	}
+	data, err := readStrips(r, ifd)
+	if err != nil {
+		return nil, err
+	}
+	note, noteOrder, err := readMakerNote(r)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &mosaic{width: img.Width, height: img.Height, white: 1<<img.BitsPerSample - 1}
+	switch img.Compression {
+	case nikonCompressed:
+		table := note.Find(0x0096)
+		if table == nil {
+			return nil, fmt.Errorf("%w: missing NEFLinearizationTable", ErrUnsupported)
+		}
+		b, err := table.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		d, err := newNikonDecoder(b, noteOrder, img.BitsPerSample)
+		if err != nil {
+			return nil, err
+		}
+		if m.pix, err = d.decode(data, m.width, m.height); err != nil {
+			return nil, err
+		}
+		m.white = d.whiteLevel()
+	case 1:
+		if m.pix, err = unpack(data, order, m.width, m.height, img.BitsPerSample); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: NEF compression %d", ErrUnsupported, img.Compression)
+	}
+
+	if e := note.Find(0x003d); e != nil {
+		if v, err := e.Uints(); err == nil && len(v) > 0 {
+			m.black = int(v[0])
+		}
+	}
+	if e := note.Find(0x000c); e != nil {
+		if v, err := e.Value(); err == nil {
+			if levels, ok := v.([]tiff.RationalValue); ok && len(levels) >= 2 &&
+				levels[0].Num > 0 && levels[1].Num > 0 {
+				red := float64(levels[0].Num) / float64(levels[0].Den)
+				blue := float64(levels[1].Num) / float64(levels[1].Den)
+				m.neutral = []float64{1 / red, 1, 1 / blue}
+			}
+		}
+	}
+	return m, nil
+}
+
+// unpack reads the uncompressed samples of raw image data of a width and
+// height: 16-bit samples in a byte order or, otherwise, samples of a
+// number of bits packed most significant bit first.
+// Returns the samples or error.
+func unpack(data []byte, order binary.ByteOrder, width, height, bits int) ([]uint16, error) {
+	n := width * height
+	pix := make([]uint16, n)
+	switch {
+	case len(data) == 2*n:
+		for i := range pix {
+			pix[i] = order.Uint16(data[2*i:])
+		}
+	case bits > 0 && bits < 16 && len(data) == n*bits/8:
+		b := &bitReader{data: data}
+		for i := range pix {
+			pix[i] = uint16(b.bits(uint(bits)))
+		}
+	default:
+		return nil, fmt.Errorf("%w: %d bytes of %d-bit raw image data of %dx%d", ErrUnsupported, len(data), bits, width, height)
+	}
+	return pix, nil
+}
+
+// decodeCr2 decodes the lossless JPEG raw image data of a CR2, whose rows
+// are split into vertical slices as described by the CR2Slice tag (0xc640):
+// the number of slices but the last, their width, and the width of the
+// last.  The black level is the mean of the masked pixels left of the
+// ActiveArea, and the white balance is that of the ColorData of the maker
+// note.
+// Returns the mosaic or error.
+func decodeCr2(r io.ReaderAt, img *rawparser.RawImage) (*mosaic, error) {
+	ifd, _, err := findIFD(r, img.IFD)
+	if err != nil {
+		return nil, err
+	}
+	data, err := readStrips(r, ifd)
+	if err != nil {
+		return nil, err
+	}
+	j, err := parseLJPEG(data)
+	if err != nil {
+		return nil, err
+	}
+	samples, err := j.decode()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &mosaic{width: j.width * j.components, height: j.height, white: 1<<j.bits - 1}
+	var cr2Slices []uint32
+	if e := ifd.Find(0xc640); e != nil {
+		if cr2Slices, err = e.Uints(); err != nil {
+			return nil, err
+		}
+	}
+	if len(cr2Slices) == 3 && cr2Slices[0]*cr2Slices[1]+cr2Slices[2] > 0 {
+		m.width = int(cr2Slices[0]*cr2Slices[1] + cr2Slices[2])
+		m.height = len(samples) / m.width
+		m.pix = unslice(samples, m.width, m.height, cr2Slices)
+	} else {
+		m.pix = samples
+	}
+
+	if a := img.ActiveArea; a.Left > 0 && a.Bottom <= m.height {
+		var sum, n int
+		for y := a.Top; y < a.Bottom; y++ {
+			for _, v := range m.pix[y*m.width : y*m.width+a.Left] {
+				sum += int(v)
+			}
+			n += a.Left
+		}
+		m.black = sum / n
+	}
+
+	if note, order, err := readMakerNote(r); err == nil {
+		m.neutral = canonNeutral(note, order)
+	}
+	return m, nil
+}
+
+// unslice arranges the samples of the lossless JPEG of a CR2, in the order
+// of the slices, as the rows of the raw image data of a width and height.
+// Returns the raw image data.
+func unslice(samples []uint16, width, height int, slices []uint32) []uint16 {
+	pix := make([]uint16, width*height)
+	count, sliceWidth, lastWidth := int(slices[0]), int(slices[1]), int(slices[2])
+	for i, v := range samples[:width*height] {
+		slice := i / (sliceWidth * height)
+		w := sliceWidth
+		if slice >= count {
+			slice, w = count, lastWidth
+		}
+		i -= slice * sliceWidth * height
+		y, x := i/w, i%w+slice*sliceWidth
+		pix[y*width+x] = v
+	}
+	return pix
+}
+
+// canonNeutral reads the as shot white balance of the ColorData of a Canon
+// maker note (0x4001): the levels of red, green, green, and blue, at an
+// offset depending on the version of the ColorData, as identified by its
+// length.
+// Returns the AsShotNeutral or nil if not recorded.
+func canonNeutral(note *tiff.IFD, order binary.ByteOrder) []float64 {
+	e := note.Find(0x4001)
+	if e == nil || e.Count <= 500 {
+		return nil
+	}
+	b, err := e.Bytes()
+	if err != nil {
+		return nil
+	}
+
+	offset := 126
+	switch e.Count {
+	case 582:
+		offset = 50
+	case 653:
+		offset = 68
+	case 5120:
+		offset = 142
+	}
+	if offset+8 > len(b) {
+		return nil
+	}
+	red, green, blue := order.Uint16(b[offset:]), order.Uint16(b[offset+2:]), order.Uint16(b[offset+6:])
+	if red == 0 || green == 0 || blue == 0 {
+		return nil
+	}
+	return []float64{float64(green) / float64(red), 1, float64(green) / float64(blue)}
+}
+
+// dng is a DNG to encode: the mosaic of a raw file and its metadata.
+type dng struct {
+	*mosaic
+	image       *rawparser.RawImage
+	cfa         []byte
+	model       string
+	colorMatrix [9]float64
+}
+
+// encode writes the DNG: IFD0, describing the raw image data, with the
+// tags of dngExifTags of the EXIF metadata, and the EXIF, GPS, and
+// interoperability IFDs, followed by a single strip of 16-bit samples.
+// Returns error.
+func (d *dng) encode(w io.Writer, exif []byte) error {
+	var meta []*tiff.IFD
+	if exif != nil {
+		ifds, err := tiff.ReadAll(bytes.NewReader(exif))
+		if err != nil {
+			return fmt.Errorf("reading EXIF data: %w", err)
+		}
+		meta = ifds
+	}
+
+	// the geometry of rawparser.RawImage applies if the decoded raw image
+	// data is of its dimensions
+	active := d.image.ActiveArea
+	cropX, cropY := d.image.CropMargins.Left, d.image.CropMargins.Top
+	cropWidth, cropHeight := d.image.DefaultCropWidth, d.image.DefaultCropHeight
+	if d.width != d.image.Width || d.height != d.image.Height ||
+		active.Bottom > d.height || active.Right > d.width || active.Width() <= 0 || active.Height() <= 0 {
+		active = rawparser.Area{Bottom: d.height, Right: d.width}
+		cropX, cropY, cropWidth, cropHeight = 0, 0, d.width, d.height
+	}
+	length := int64(d.width) * int64(d.height) * 2
+
+	le := binary.LittleEndian
+	short := func(tag uint16, v ...uint16) tiff.Entry {
+		var b []byte
+		for _, s := range v {
+			b = le.AppendUint16(b, s)
+		}
+		return tiff.NewEntry(le, tag, tiff.Short, uint32(len(v)), b)
+	}
+	long := func(tag uint16, v ...uint32) tiff.Entry {
+		var b []byte
+		for _, l := range v {
+			b = le.AppendUint32(b, l)
+		}
+		return tiff.NewEntry(le, tag, tiff.Long, uint32(len(v)), b)
+	}
+	byteEntry := func(tag uint16, v ...byte) tiff.Entry {
+		return tiff.NewEntry(le, tag, tiff.Byte, uint32(len(v)), v)
+	}
+	rational := func(tag uint16, typ tiff.Type, v ...float64) tiff.Entry {
+		var b []byte
+		for _, f := range v {
+			b = le.AppendUint32(b, uint32(int32(math.Round(f*10000))))
+			b = le.AppendUint32(b, 10000)
+		}
+		return tiff.NewEntry(le, tag, typ, uint32(len(v)), b)
+	}
+	model := append([]byte(d.model), 0)
+
+	ifds := func(offset uint32) []*tiff.IFD {
+		ifd0 := &tiff.IFD{Kind: tiff.KindMain, Entries: []tiff.Entry{
+			long(0x00fe, 0), // main image
+			long(0x0100, uint32(d.width)),
+			long(0x0101, uint32(d.height)),
+			short(0x0102, 16),
+			short(0x0103, 1),     // uncompressed
+			short(0x0106, 32803), // CFA
+			long(0x0111, offset),
+			short(0x0115, 1),
+			long(0x0116, uint32(d.height)),
+			long(0x0117, uint32(length)),
+			short(0x011c, 1), // chunky
+			short(0x828d, 2, 2),
+			byteEntry(0x828e, d.cfa...),
+			byteEntry(0xc612, 1, 4, 0, 0), // DNGVersion
+			byteEntry(0xc613, 1, 1, 0, 0), // DNGBackwardVersion
+			tiff.NewEntry(le, 0xc614, tiff.ASCII, uint32(len(model)), model),
+			long(0xc61a, uint32(d.black)),
+			long(0xc61d, uint32(d.white)),
+			long(0xc61f, uint32(cropX), uint32(cropY)),
+			long(0xc620, uint32(cropWidth), uint32(cropHeight)),
+			rational(0xc621, tiff.SRational, d.colorMatrix[:]...),
+			short(0xc65a, calibrationD65),
+			long(0xc68d, uint32(active.Top), uint32(active.Left), uint32(active.Bottom), uint32(active.Right)),
+		}}
+		if d.neutral != nil {
+			ifd0.Entries = append(ifd0.Entries, rational(0xc628, tiff.Rational, d.neutral...))
+		}
+		out := []*tiff.IFD{ifd0}
+		for _, ifd := range meta {
+			switch {
+			case ifd.Kind == tiff.KindMain && ifd.Index == 0:
+				for _, e := range ifd.Entries {
+					if dngExifTags[e.Tag] &&
+						!slices.ContainsFunc(ifd0.Entries, func(i tiff.Entry) bool { return i.Tag == e.Tag }) {
+						ifd0.Entries = append(ifd0.Entries, e)
+					}
+				}
+			case ifd.Kind == tiff.KindExif || ifd.Kind == tiff.KindGPS || ifd.Kind == tiff.KindInterop:
+				out = append(out, ifd)
+			}
+		}
+		return out
+	}
+
+	// the strip follows the IFDs, whose size does not depend on its offset
+	header, err := tiff.Encode(le, ifds(0))
+	if err != nil {
+		return err
+	}
+	if header, err = tiff.Encode(le, ifds(uint32(len(header)))); err != nil {
+		return err
+	}
+	if int64(len(header))+length > math.MaxUint32 {
+		return fmt.Errorf("dngwriter: DNG of %d bytes exceeds 4 GiB", int64(len(header))+length)
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	row := make([]byte, 0, d.width*2)
+	for y := 0; y < d.height; y++ {
+		row = row[:0]
+		for _, v := range d.pix[y*d.width : (y+1)*d.width] {
+			row = le.AppendUint16(row, v)
+		}
+		if _, err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package dngwriter
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/jeremytorres/rawparser"
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+const (
+	testNefFile       = "../test_files/big_endian.NEF"
+	testNefNoJpegFile = "../test_files/little_endian_no_jpeg.NEF"
+	testCR2File       = "../test_files/little_endian.CR2"
+)
+
+// convert converts a raw file and reads IFD0 and the EXIF IFD of the DNG.
+// Returns the DNG, IFD0, and the EXIF IFD.
+func convert(t *testing.T, file string) ([]byte, *tiff.IFD, *tiff.IFD) {
+	t.Helper()
+	var b bytes.Buffer
+	if err := Convert(&rawparser.RawFileInfo{File: file}, &b, nil); err != nil {
+		t.Fatalf("%s: unexpected error: %v\n", file, err)
+	}
+	ifds, err := tiff.ReadAll(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("%s: unexpected error: %v\n", file, err)
+	}
+	var exif *tiff.IFD
+	for _, ifd := range ifds {
+		if ifd.Kind == tiff.KindExif {
+			exif = ifd
+		}
+	}
+	if exif == nil {
+		t.Fatalf("%s: missing EXIF IFD\n", file)
+	}
+	return b.Bytes(), ifds[0], exif
+}
+
+// value reads the value of a tag of an IFD.
+func value(t *testing.T, ifd *tiff.IFD, tag uint16) any {
+	t.Helper()
+	e := ifd.Find(tag)
+	if e == nil {
+		t.Fatalf("missing tag 0x%04x\n", tag)
+	}
+	v, err := e.Value()
+	if err != nil {
+		t.Fatalf("tag 0x%04x: unexpected error: %v\n", tag, err)
+	}
+	return v
+}
+
+func TestConvertNef(t *testing.T) {
+	data, ifd0, exif := convert(t, testNefFile)
+
+	want := map[uint16]any{
+		0x0100: []uint32{4288},
+		0x0101: []uint32{2844},
+		0x0102: []uint16{16},
+		0x0103: []uint16{1},
+		0x0106: []uint16{32803},
+		0x0117: []uint32{4288 * 2844 * 2},
+		0x828d: []uint16{2, 2},
+		0x828e: []byte{0, 1, 1, 2},
+		0xc612: []byte{1, 4, 0, 0},
+		0xc614: "NIKON D700",
+		0xc61a: []uint32{0},
+		0xc61d: []uint32{16383},
+		0xc68d: []uint32{0, 0, 2844, 4288},
+		0x010f: "NIKON CORPORATION",
+	}
+	for tag, w := range want {
+		if v := value(t, ifd0, tag); !reflect.DeepEqual(v, w) {
+			t.Errorf("tag 0x%04x: expected %v, got %v\n", tag, w, v)
+		}
+	}
+	if ifd0.Find(0xc628) == nil {
+		t.Errorf("missing AsShotNeutral\n")
+	}
+	if exif.Find(0x829a) == nil {
+		t.Errorf("missing ExposureTime in EXIF IFD\n")
+	}
+
+	offset := value(t, ifd0, 0x0111).([]uint32)[0]
+	if int(offset)+4288*2844*2 != len(data) {
+		t.Errorf("expected strip at %d of %d bytes, got %d bytes\n", offset, 4288*2844*2, len(data)-int(offset))
+	}
+}
+
+func TestConvertCr2(t *testing.T) {
+	_, ifd0, _ := convert(t, testCR2File)
+
+	want := map[uint16]any{
+		0x0100: []uint32{5792},
+		0x0101: []uint32{3804},
+		0x828e: []byte{0, 1, 1, 2},
+		0xc614: "Canon EOS 5D Mark II",
+		0xc61d: []uint32{16383},
+		0xc68d: []uint32{56, 168, 3800, 5784},
+	}
+	for tag, w := range want {
+		if v := value(t, ifd0, tag); !reflect.DeepEqual(v, w) {
+			t.Errorf("tag 0x%04x: expected %v, got %v\n", tag, w, v)
+		}
+	}
+
+	// the black level of the masked pixels is about 1024
+	if black := value(t, ifd0, 0xc61a).([]uint32)[0]; black < 900 || black > 1200 {
+		t.Errorf("unexpected black level %d\n", black)
+	}
+	neutral := value(t, ifd0, 0xc628).([]tiff.RationalValue)
+	if len(neutral) != 3 || neutral[1].Num != neutral[1].Den || neutral[0].Num == 0 || neutral[2].Num == 0 {
+		t.Errorf("unexpected AsShotNeutral %v\n", neutral)
+	}
+}
+
+func TestConvertUnsupported(t *testing.T) {
+	for _, file := range []string{
+		testNefNoJpegFile,              // CMYG CFA
+		"../test_files/big_endian.jpg", // not a NEF or CR2
+	} {
+		var b bytes.Buffer
+		if err := Convert(&rawparser.RawFileInfo{File: file}, &b, nil); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: expected ErrUnsupported, got %v\n", file, err)
+		}
+		if b.Len() > 0 {
+			t.Errorf("%s: unexpected output of %d bytes\n", file, b.Len())
+		}
+	}
+}
+
+func TestLJPEG(t *testing.T) {
+	// a 2x2 lossless JPEG of 1 component, 8 bits, predictor 1, whose
+	// Huffman table codes the difference length 0 as "0" and 2 as "1"
+	data := []byte{
+		0xff, 0xd8,
+		0xff, 0xc4, 0x00, 0x15, 0x00,
+		0x02, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0x00, 0x02,
+		0xff, 0xc3, 0x00, 0x0b, 0x08, 0x00, 0x02, 0x00, 0x02, 0x01, 0x01, 0x11, 0x00,
+		0xff, 0xda, 0x00, 0x08, 0x01, 0x01, 0x00, 0x01, 0x00, 0x00,
+		// 0 | 1 11 | 1 00 | 0: 128, 131 (+3), 125 (-3), 125
+		0x78,
+		0xff, 0xd9,
+	}
+	j, err := parseLJPEG(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	samples, err := j.decode()
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	if want := []uint16{128, 131, 125, 125}; !reflect.DeepEqual(samples, want) {
+		t.Errorf("expected %v, got %v\n", want, samples)
+	}
+}
@@ -0,0 +1,174 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package dngwriter
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errCorrupt is returned decoding corrupt raw image data.
+var errCorrupt = errors.New("dngwriter: corrupt raw image data")
+
+// bitReader reads the bits of entropy-coded data, most significant bit
+// first.  The bits past the end of the data, or past a JPEG marker, are
+// zero.
+type bitReader struct {
+	data []byte
+	pos  int
+	acc  uint64 // the bits read, left-justified
+	n    uint   // the number of bits of acc
+
+	// stuffed is set for JPEG data, where a 0xff byte is followed by a
+	// stuffed 0x00 byte; other 0xff bytes start a marker.
+	stuffed bool
+	marker  bool // a marker was reached
+}
+
+// fill reads bytes into the accumulator until it holds at least 57 bits.
+func (b *bitReader) fill() {
+	for b.n <= 56 {
+		var c byte
+		if !b.marker && b.pos < len(b.data) {
+			c = b.data[b.pos]
+			b.pos++
+			if b.stuffed && c == 0xff {
+				if b.pos < len(b.data) && b.data[b.pos] == 0 {
+					b.pos++
+				} else {
+					b.pos--
+					b.marker, c = true, 0
+				}
+			}
+		}
+		b.acc |= uint64(c) << (56 - b.n)
+		b.n += 8
+	}
+}
+
+// bits reads n bits, up to 16.
+// Returns the bits.
+func (b *bitReader) bits(n uint) uint32 {
+	if n == 0 {
+		return 0
+	}
+	if b.n < n {
+		b.fill()
+	}
+	v := uint32(b.acc >> (64 - n))
+	b.acc <<= n
+	b.n -= n
+	return v
+}
+
+// peek returns the next 16 bits without reading them.
+func (b *bitReader) peek() uint32 {
+	if b.n < 16 {
+		b.fill()
+	}
+	return uint32(b.acc >> 48)
+}
+
+// skip skips n bits, up to 16, previously peeked.
+func (b *bitReader) skip(n uint) {
+	b.acc <<= n
+	b.n -= n
+}
+
+// lookupBits is the number of bits of the codes decoded by table lookup;
+// longer codes are decoded by their length.
+const lookupBits = 9
+
+// huffman is a Huffman table of codes of up to 16 bits, as specified by a
+// JPEG DHT segment: the number of codes of each length, then the symbols
+// in the order of the codes.
+type huffman struct {
+	// lookup is the length (high byte) and symbol (low byte) of the codes
+	// of up to lookupBits, by their bits, padded; 0 for longer codes.
+	lookup [1 << lookupBits]uint16
+
+	// maxCode is the largest code of each length plus one, left-justified
+	// to 16 bits; offset the index of its first symbol less its first
+	// code.
+	maxCode [17]uint32
+	offset  [17]int
+	symbols []byte
+}
+
+// newHuffman builds a Huffman table from the number of codes of each
+// length, from 1 to 16 bits, and the symbols.
+// Returns the table or error.
+func newHuffman(counts []byte, symbols []byte) (*huffman, error) {
+	if len(counts) != 16 {
+		return nil, fmt.Errorf("%w: Huffman table of %d lengths", errCorrupt, len(counts))
+	}
+	total := 0
+	for _, c := range counts {
+		total += int(c)
+	}
+	if total > len(symbols) || total > 256 {
+		return nil, fmt.Errorf("%w: Huffman table of %d symbols", errCorrupt, total)
+	}
+
+	h := &huffman{symbols: symbols[:total]}
+	code, index := 0, 0
+	for length := 1; length <= 16; length++ {
+		n := int(counts[length-1])
+		h.offset[length] = index - code
+		for i := 0; i < n; i++ {
+			if length <= lookupBits {
+				shift := lookupBits - length
+				for pad := 0; pad < 1<<shift; pad++ {
+					h.lookup[code<<shift|pad] = uint16(length)<<8 | uint16(symbols[index])
+				}
+			}
+			code++
+			index++
+		}
+		if code > 1<<length {
+			return nil, fmt.Errorf("%w: Huffman codes overflow %d bits", errCorrupt, length)
+		}
+		h.maxCode[length] = uint32(code) << (16 - length)
+		code <<= 1
+	}
+	return h, nil
+}
+
+// decode reads a code.
+// Returns its symbol or error if the bits are not a code.
+func (h *huffman) decode(b *bitReader) (byte, error) {
+	bits := b.peek()
+	if v := h.lookup[bits>>(16-lookupBits)]; v != 0 {
+		b.skip(uint(v >> 8))
+		return byte(v), nil
+	}
+
+	for length := lookupBits + 1; length <= 16; length++ {
+		if bits < h.maxCode[length] {
+			b.skip(uint(length))
+			return h.symbols[h.offset[length]+int(bits>>(16-length))], nil
+		}
+	}
+	return 0, fmt.Errorf("%w: invalid Huffman code", errCorrupt)
+}
@@ -0,0 +1,219 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package dngwriter
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// ljpeg is a lossless JPEG (ITU T.81, process 14), e.g., the raw image data
+// of a CR2: rows of Width pixels of Components interleaved samples.
+type ljpeg struct {
+	bits, width, height, components int
+	predictor, pointTransform       int
+
+	// tables are the Huffman tables of the components.
+	tables []*huffman
+
+	// data is the entropy-coded data, following the SOS segment.
+	data []byte
+}
+
+// parseLJPEG parses the segments of a lossless JPEG up to the start of its
+// entropy-coded data.  Restart intervals are not supported.
+// Returns the JPEG or error.
+func parseLJPEG(data []byte) (*ljpeg, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, fmt.Errorf("%w: missing JPEG start of image", errCorrupt)
+	}
+
+	j := &ljpeg{}
+	var dht [4]*huffman
+	var ids []byte
+	pos := 2
+	for {
+		if pos+4 > len(data) || data[pos] != 0xff {
+			return nil, fmt.Errorf("%w: missing JPEG marker at offset %d", errCorrupt, pos)
+		}
+		marker := data[pos+1]
+		n := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if n < 2 || pos+2+n > len(data) {
+			return nil, fmt.Errorf("%w: JPEG segment of %d bytes at offset %d", errCorrupt, n, pos)
+		}
+		seg := data[pos+4 : pos+2+n]
+		pos += 2 + n
+
+		switch marker {
+		case 0xc3: // SOF3
+			if len(seg) < 6 {
+				return nil, fmt.Errorf("%w: SOF3 of %d bytes", errCorrupt, len(seg))
+			}
+			j.bits = int(seg[0])
+			j.height = int(binary.BigEndian.Uint16(seg[1:]))
+			j.width = int(binary.BigEndian.Uint16(seg[3:]))
+			j.components = int(seg[5])
+			if j.components < 1 || j.components > 4 || len(seg) < 6+3*j.components {
+				return nil, fmt.Errorf("%w: SOF3 of %d components", errCorrupt, j.components)
+			}
+			for c := 0; c < j.components; c++ {
+				ids = append(ids, seg[6+3*c])
+			}
+		case 0xc0, 0xc1, 0xc2, 0xc5, 0xc6, 0xc7, 0xc9, 0xca, 0xcb, 0xcd, 0xce, 0xcf:
+			return nil, fmt.Errorf("%w: JPEG frame 0x%02x is not lossless", ErrUnsupported, marker)
+		case 0xc4: // DHT
+			for len(seg) >= 17 {
+				id := seg[0] & 0x0f
+				total := 0
+				for _, c := range seg[1:17] {
+					total += int(c)
+				}
+				if id > 3 || len(seg) < 17+total {
+					return nil, fmt.Errorf("%w: DHT table %d", errCorrupt, id)
+				}
+				h, err := newHuffman(seg[1:17], seg[17:17+total])
+				if err != nil {
+					return nil, err
+				}
+				dht[id] = h
+				seg = seg[17+total:]
+			}
+		case 0xdd: // DRI
+			if len(seg) >= 2 && binary.BigEndian.Uint16(seg) != 0 {
+				return nil, fmt.Errorf("%w: JPEG restart intervals", ErrUnsupported)
+			}
+		case 0xda: // SOS
+			if j.components == 0 || len(seg) < 1+2*j.components+3 || int(seg[0]) != j.components {
+				return nil, fmt.Errorf("%w: SOS of %d components", errCorrupt, len(seg))
+			}
+			for c := 0; c < j.components; c++ {
+				if seg[1+2*c] != ids[c] {
+					return nil, fmt.Errorf("%w: non-interleaved JPEG scan", ErrUnsupported)
+				}
+				h := dht[seg[2+2*c]>>4&3]
+				if h == nil {
+					return nil, fmt.Errorf("%w: missing Huffman table of component %d", errCorrupt, c)
+				}
+				j.tables = append(j.tables, h)
+			}
+			j.predictor = int(seg[1+2*j.components])
+			j.pointTransform = int(seg[3+2*j.components] & 0x0f)
+			if j.predictor < 1 || j.predictor > 7 || j.bits < 2 || j.bits > 16 || j.pointTransform >= j.bits {
+				return nil, fmt.Errorf("%w: predictor %d of %d-bit samples", errCorrupt, j.predictor, j.bits)
+			}
+			j.data = data[pos:]
+			return j, nil
+		}
+	}
+}
+
+// decode decodes the samples of the JPEG, row by row.
+// Returns the samples or error.
+func (j *ljpeg) decode() ([]uint16, error) {
+	stride := j.width * j.components
+	samples := make([]uint16, stride*j.height)
+	b := &bitReader{data: j.data, stuffed: true}
+	initial := 1 << (j.bits - j.pointTransform - 1)
+	mask := 1<<(j.bits-j.pointTransform) - 1
+
+	for y := 0; y < j.height; y++ {
+		row := samples[y*stride : (y+1)*stride]
+		var above []uint16
+		if y > 0 {
+			above = samples[(y-1)*stride : y*stride]
+		}
+		for x := 0; x < stride; x++ {
+			c := x % j.components
+			diff, err := j.diff(b, j.tables[c])
+			if err != nil {
+				return nil, fmt.Errorf("%w at row %d", err, y)
+			}
+
+			var pred int
+			switch {
+			case y == 0 && x < j.components:
+				pred = initial
+			case y == 0:
+				pred = int(row[x-j.components])
+			case x < j.components:
+				pred = int(above[x])
+			default:
+				pred = predict(j.predictor, int(row[x-j.components]), int(above[x]), int(above[x-j.components]))
+			}
+			row[x] = uint16((pred + diff) & mask)
+		}
+	}
+
+	if j.pointTransform > 0 {
+		for i := range samples {
+			samples[i] <<= j.pointTransform
+		}
+	}
+	return samples, nil
+}
+
+// diff reads the difference of a sample to its prediction: its length in
+// bits, Huffman coded, then its bits.
+// Returns the difference or error.
+func (j *ljpeg) diff(b *bitReader, h *huffman) (int, error) {
+	length, err := h.decode(b)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case length == 0:
+		return 0, nil
+	case length == 16:
+		return 32768, nil
+	case length > 16:
+		return 0, fmt.Errorf("%w: difference of %d bits", errCorrupt, length)
+	}
+
+	diff := int(b.bits(uint(length)))
+	if diff < 1<<(length-1) {
+		diff -= 1<<length - 1
+	}
+	return diff, nil
+}
+
+// predict predicts a sample from the samples to its left (a), above (b),
+// and above left (c) by one of the predictors of a lossless JPEG.
+// Returns the prediction.
+func predict(predictor, a, b, c int) int {
+	switch predictor {
+	case 1:
+		return a
+	case 2:
+		return b
+	case 3:
+		return c
+	case 4:
+		return a + b - c
+	case 5:
+		return a + (b-c)>>1
+	case 6:
+		return b + (a-c)>>1
+	}
+	return (a + b) >> 1
+}
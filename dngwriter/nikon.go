@@ -0,0 +1,210 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package dngwriter
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// nikonTrees are the Huffman tables of the Nikon compressed NEF (the
+// number of codes of each length, then the symbols, zero padded), by the
+// compression: 12-bit lossy, 12-bit lossy after the split row, 12-bit
+// lossless, then likewise for 14-bit.  A symbol is the length of the
+// difference (low nibble) and its shift (high nibble).
+var nikonTrees = [6][32]byte{
+	{0, 1, 5, 1, 1, 1, 1, 1, 1, 2, 0, 0, 0, 0, 0, 0,
+		5, 4, 3, 6, 2, 7, 1, 0, 8, 9, 11, 10, 12},
+	{0, 1, 5, 1, 1, 1, 1, 1, 1, 2, 0, 0, 0, 0, 0, 0,
+		0x39, 0x5a, 0x38, 0x27, 0x16, 5, 4, 3, 2, 1, 0, 11, 12, 12},
+	{0, 1, 4, 2, 3, 1, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		5, 4, 6, 3, 7, 2, 8, 1, 9, 0, 10, 11, 12},
+	{0, 1, 4, 3, 1, 1, 1, 1, 1, 2, 0, 0, 0, 0, 0, 0,
+		5, 6, 4, 7, 8, 3, 9, 2, 1, 0, 10, 11, 12, 13, 14},
+	{0, 1, 5, 1, 1, 1, 1, 1, 1, 1, 2, 0, 0, 0, 0, 0,
+		8, 0x5c, 0x4b, 0x3a, 0x29, 7, 6, 5, 4, 3, 2, 1, 0, 13, 14},
+	{0, 1, 4, 2, 2, 3, 1, 2, 0, 0, 0, 0, 0, 0, 0, 0,
+		7, 6, 8, 5, 9, 4, 10, 3, 11, 12, 2, 0, 1, 13, 14},
+}
+
+// nikonCompressed is the Compression of the raw image data of a Nikon
+// compressed NEF.
+const nikonCompressed = 34713
+
+// nikonDecoder decodes the raw image data of a Nikon compressed NEF, as
+// described by the NEFLinearizationTable of its maker note: the version
+// of the compression, the initial predictions, and the tone curve applied
+// to the decoded values.
+type nikonDecoder struct {
+	bits  int
+	tree  int
+	vpred [2][2]uint16
+	curve []uint16
+	max   int // the number of values of the curve used
+
+	// split is the row from which the lossy tables after the split apply;
+	// 0 if none.
+	split int
+}
+
+// newNikonDecoder parses a NEFLinearizationTable in the byte order of the
+// maker note, for raw image data of a number of bits per sample, 12 or 14:
+// the version (2 bytes), the vertical predictions (4 SHORTs), and the
+// points of the curve (a SHORT count and the SHORTs) of a lossy NEF.  The
+// curve of a lossy NEF of version 0x4420 is interpolated from the points,
+// and the split row follows at offset 562.
+// Returns the decoder or error.
+func newNikonDecoder(table []byte, order binary.ByteOrder, bits int) (*nikonDecoder, error) {
+	if bits != 12 && bits != 14 {
+		return nil, fmt.Errorf("%w: %d-bit compressed NEF", ErrUnsupported, bits)
+	}
+	if len(table) < 12 {
+		return nil, fmt.Errorf("%w: NEFLinearizationTable of %d bytes", errCorrupt, len(table))
+	}
+
+	d := &nikonDecoder{bits: bits, curve: make([]uint16, 1<<16)}
+	for i := range d.curve {
+		d.curve[i] = uint16(i)
+	}
+	ver0, ver1 := table[0], table[1]
+	pos := 2
+	if ver0 == 0x49 || ver1 == 0x58 {
+		pos += 2110
+	}
+	if ver0 == 0x46 {
+		d.tree = 2
+	}
+	if bits == 14 {
+		d.tree += 3
+	}
+	if pos+10 > len(table) {
+		return nil, fmt.Errorf("%w: NEFLinearizationTable of %d bytes", errCorrupt, len(table))
+	}
+	for i := range 4 {
+		d.vpred[i/2][i%2] = order.Uint16(table[pos+2*i:])
+	}
+	pos += 8
+	size := int(order.Uint16(table[pos:]))
+	pos += 2
+
+	d.max = 1 << bits & 0x7fff
+	step := 0
+	if size > 1 {
+		step = d.max / (size - 1)
+	}
+	switch {
+	case ver0 == 0x44 && ver1 == 0x20 && step > 0:
+		if pos+2*size > len(table) || len(table) < 564 {
+			return nil, fmt.Errorf("%w: NEFLinearizationTable of %d bytes", errCorrupt, len(table))
+		}
+		for i := range size {
+			d.curve[i*step] = order.Uint16(table[pos+2*i:])
+		}
+		for i := range d.max {
+			base := i - i%step
+			d.curve[i] = uint16((int(d.curve[base])*(step-i%step) + int(d.curve[base+step])*(i%step)) / step)
+		}
+		d.split = int(order.Uint16(table[562:]))
+	case ver0 != 0x46 && size <= 0x4001:
+		if pos+2*size > len(table) {
+			return nil, fmt.Errorf("%w: NEFLinearizationTable of %d bytes", errCorrupt, len(table))
+		}
+		for i := range size {
+			d.curve[i] = order.Uint16(table[pos+2*i:])
+		}
+		d.max = size
+	}
+	for d.max > 2 && d.curve[d.max-2] == d.curve[d.max-1] {
+		d.max--
+	}
+	return d, nil
+}
+
+// whiteLevel returns the largest value of the curve.
+func (d *nikonDecoder) whiteLevel() int {
+	return int(d.curve[d.max-1])
+}
+
+// decode decodes raw image data of a width and height: the difference of
+// each value to its prediction, the value to its left of the same color or,
+// for the first two columns, the value above, of which the Huffman coded
+// length is followed by the bits.
+// Returns the values, row by row, or error.
+func (d *nikonDecoder) decode(data []byte, width, height int) ([]uint16, error) {
+	t := nikonTrees[d.tree]
+	h, err := newHuffman(t[:16], t[16:])
+	if err != nil {
+		return nil, err
+	}
+
+	pix := make([]uint16, width*height)
+	b := &bitReader{data: data}
+	vpred := d.vpred
+	var hpred [2]uint16
+	lo, hi := 0, d.max
+	for row := range height {
+		if d.split > 0 && row == d.split {
+			t = nikonTrees[d.tree+1]
+			if h, err = newHuffman(t[:16], t[16:]); err != nil {
+				return nil, err
+			}
+			lo = 16
+			hi += lo << 1
+		}
+		for col := range width {
+			symbol, err := h.decode(b)
+			if err != nil {
+				return nil, fmt.Errorf("%w at row %d", err, row)
+			}
+			length, shift := int(symbol&15), int(symbol>>4)
+			diff := 0
+			if length > 0 {
+				diff = (int(b.bits(uint(length-shift)))<<1 + 1) << shift >> 1
+				if diff&(1<<(length-1)) == 0 {
+					diff -= 1 << length
+					if shift == 0 {
+						diff++
+					}
+				}
+			}
+
+			if col < 2 {
+				vpred[row&1][col] += uint16(diff)
+				hpred[col] = vpred[row&1][col]
+			} else {
+				hpred[col&1] += uint16(diff)
+			}
+			if int(hpred[col&1]+uint16(lo)) >= hi {
+				return nil, fmt.Errorf("%w: value %d out of range at row %d", errCorrupt, int16(hpred[col&1]), row)
+			}
+			pix[row*width+col] = d.curve[clamp(int(int16(hpred[col&1])), 0, 0x3fff)]
+		}
+	}
+	return pix, nil
+}
+
+// clamp limits a value to a range.
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
@@ -0,0 +1,198 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// maxDumpedValues is the number of values of an entry formatted by
+// DumpIFDs; the remaining values are elided.
+const maxDumpedValues = 16
+
+// IFDDump is a struct representing the IFDs of a TIFF-based raw file, as
+// read by DumpIFDs.
+type IFDDump struct {
+	FileName string `json:"fileName"`
+
+	// ByteOrder is "II" (little endian) or "MM" (big endian).
+	ByteOrder string `json:"byteOrder"`
+
+	// IFDs are the IFDs of the main chain, IFD0 first.
+	IFDs []*DumpedIFD `json:"ifds"`
+}
+
+// DumpedIFD is a struct representing an IFD and the IFDs it references.
+type DumpedIFD struct {
+	// Kind is the kind of the IFD, e.g., "IFD" or "EXIF", and Index its
+	// position in its chain.  See tiff.Kind.
+	Kind   string `json:"kind"`
+	Index  int    `json:"index"`
+	Offset int64  `json:"offset"`
+
+	Entries []DumpedEntry `json:"entries"`
+
+	// Children are the IFDs referenced by the entries of the IFD:
+	// SubIFDs, and the EXIF, GPS, and interoperability IFDs.
+	Children []*DumpedIFD `json:"children,omitempty"`
+}
+
+// DumpedEntry is a struct representing an IFD entry.
+type DumpedEntry struct {
+	Tag   uint16 `json:"tag"`
+	Name  string `json:"name,omitempty"` // empty if unknown
+	Type  string `json:"type"`
+	Count uint32 `json:"count"`
+
+	// Offset is the offset of the value; 0 if the value is inline.
+	Offset int64 `json:"offset,omitempty"`
+
+	// Value is the formatted value, at most maxDumpedValues values, or
+	// the error reading the value.
+	Value string `json:"value"`
+}
+
+// DumpIFDs reads all IFDs of a TIFF-based raw file, with their tags, field
+// types, and values, e.g., to report a raw file of an unsupported camera.
+// The IFDs are read as by tiff.WalkIFDs; maker notes are not decoded.
+// Returns the IFDs or error.
+func DumpIFDs(info *RawFileInfo) (*IFDDump, error) {
+	f, err := openRawFile(info)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cache := newReadCache(f)
+	h, err := tiff.ReadHeader(cache)
+	if err != nil {
+		return nil, err
+	}
+
+	dump := &IFDDump{FileName: f.Name(), ByteOrder: "II"}
+	if h.ByteOrder == binary.BigEndian {
+		dump.ByteOrder = "MM"
+	}
+
+	// parents are the IFDs referencing the IFDs to be visited, by offset
+	parents := make(map[int64]*DumpedIFD)
+	err = tiff.WalkIFDs(cache, h, func(ifd *tiff.IFD) error {
+		d := dumpIFD(ifd)
+		parent := parents[ifd.Offset]
+		if parent != nil {
+			parent.Children = append(parent.Children, d)
+		} else {
+			dump.IFDs = append(dump.IFDs, d)
+		}
+
+		for _, e := range ifd.Entries {
+			switch e.Tag {
+			case tiff.TagSubIFDs, tiff.TagExifIFD, tiff.TagGPSIFD, tiff.TagInteropIFD:
+				offsets, _ := e.Uints64()
+				for _, offset := range offsets {
+					parents[int64(min(offset, math.MaxInt64))] = d
+				}
+			}
+		}
+		if ifd.Kind == tiff.KindSub && ifd.Next > 0 && parent != nil {
+			// chained SubIFDs share the parent
+			parents[ifd.Next] = parent
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dump, nil
+}
+
+// dumpIFD formats the entries of an IFD.
+// Returns the IFD, without its children.
+func dumpIFD(ifd *tiff.IFD) *DumpedIFD {
+	d := &DumpedIFD{
+		Kind:    ifd.Kind.String(),
+		Index:   ifd.Index,
+		Offset:  ifd.Offset,
+		Entries: make([]DumpedEntry, 0, len(ifd.Entries)),
+	}
+
+	for i := range ifd.Entries {
+		e := &ifd.Entries[i]
+		de := DumpedEntry{
+			Tag:   e.Tag,
+			Name:  tiff.TagName(ifd.Kind, e.Tag),
+			Type:  e.Type.String(),
+			Count: e.Count,
+			Value: dumpValue(e),
+		}
+		if !e.Inline() {
+			de.Offset = e.Offset
+		}
+		d.Entries = append(d.Entries, de)
+	}
+	return d
+}
+
+// dumpValue formats the value of an entry: a quoted string for ASCII, hex
+// bytes for BYTE and UNDEFINED, and space-separated numbers otherwise, with
+// the values beyond maxDumpedValues elided.
+// Returns the formatted value.
+func dumpValue(e *tiff.Entry) string {
+	v, err := e.Value()
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+
+	var values []string
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case []byte:
+		if len(v) > maxDumpedValues {
+			return fmt.Sprintf("% x ... (%d bytes)", v[:maxDumpedValues], len(v))
+		}
+		return fmt.Sprintf("% x", v)
+	case []tiff.RationalValue:
+		for _, r := range v {
+			values = append(values, fmt.Sprintf("%d/%d", r.Num, r.Den))
+		}
+	case []tiff.SRationalValue:
+		for _, r := range v {
+			values = append(values, fmt.Sprintf("%d/%d", r.Num, r.Den))
+		}
+	default:
+		s := fmt.Sprint(v)
+		values = strings.Fields(s[1 : len(s)-1]) // trim "[" and "]"
+	}
+
+	if len(values) > maxDumpedValues {
+		return fmt.Sprintf("%s ... (%d values)", strings.Join(values[:maxDumpedValues], " "), len(values))
+	}
+	return strings.Join(values, " ")
+}
@@ -0,0 +1,66 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import "testing"
+
+func TestDumpIFDs(t *testing.T) {
+	dump, err := DumpIFDs(&RawFileInfo{File: TestCR2File})
+	if err != nil {
+		t.Fatalf("Unexpected error dumping CR2: %v\n", err)
+	}
+
+	if dump.ByteOrder != "II" || len(dump.IFDs) != 4 {
+		t.Fatalf("Unexpected dump: %s, %d IFDs\n", dump.ByteOrder, len(dump.IFDs))
+	}
+
+	ifd0 := dump.IFDs[0]
+	if ifd0.Kind != "IFD" || ifd0.Index != 0 || len(ifd0.Children) != 2 {
+		t.Fatalf("Unexpected IFD0: %+v\n", ifd0)
+	}
+	if e := ifd0.Entries[5]; e.Tag != 0x0110 || e.Name != "Model" || e.Type != "ASCII" || e.Value != `"Canon EOS 5D Mark II"` {
+		t.Errorf("Unexpected entry: %+v\n", e)
+	}
+
+	exif := ifd0.Children[0]
+	if exif.Kind != "EXIF" || len(exif.Children) != 1 || exif.Children[0].Kind != "Interop" {
+		t.Errorf("Unexpected EXIF IFD: %+v\n", exif)
+	}
+	if e := exif.Entries[0]; e.Name != "ExposureTime" || e.Value != "1/60" || e.Offset == 0 {
+		t.Errorf("Unexpected entry: %+v\n", e)
+	}
+	if gps := ifd0.Children[1]; gps.Kind != "GPS" {
+		t.Errorf("Unexpected GPS IFD: %+v\n", gps)
+	}
+}
+
+func TestDumpIFDsNotTiff(t *testing.T) {
+	path, _ := writeTestFile(t, "test.CRW", buildTestCrw(t))
+	if _, err := DumpIFDs(&RawFileInfo{File: path}); err == nil {
+		t.Error("Expected error dumping a CRW")
+	}
+	if _, err := DumpIFDs(&RawFileInfo{File: "missing.NEF"}); err == nil {
+		t.Error("Expected error dumping a missing file")
+	}
+}
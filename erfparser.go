@@ -0,0 +1,53 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+// ErfParserKey is a unique identifier for the ERF raw file parser.
+// This key may be used as a key the RawParsers map.
+const ErfParserKey = "ERF"
+
+// ErfParser is the struct defining the state of
+// the RawFile concept.  Implements the RawParser interface.
+// This parser provides basic parsing functionaity for the Epson Raw Format
+// (ERF) of the Epson R-D1 rangefinders.  ERF is TIFF-based; the EXIF create
+// time and orientation are parsed and the largest embedded JPEG is
+// extracted.
+type ErfParser struct {
+	tiffParser
+}
+
+// ProcessFile is the entry point into the ErfParser.  For a specified ERF,
+// via RawFileInfo, the file shall be processed, JPEG extracted, and
+// processed details returned to the caller.
+// Returns a pointer the RawFile data structure or error.
+func (n ErfParser) ProcessFile(info *RawFileInfo) (*RawFile, error) {
+	return n.processTiffFile(info)
+}
+
+// NewErfParser creates an instance of ERF-specific RawParser.
+// Returns an instance of a ERF-specific RawParser.
+// The hostIsLittleEndian argument is ignored; see RawParser.
+func NewErfParser(hostIsLittleEndian bool) (RawParser, string) {
+	return &ErfParser{tiffParser{rawParser: &rawParser{}}}, ErfParserKey
+}
@@ -0,0 +1,285 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+// Package exifcompat exposes the EXIF metadata of raw files, and of JPEG
+// and TIFF files, through the API of goexif
+// (github.com/rwcarlsen/goexif/exif), so that applications written
+// against goexif can read raw files with the parsing of the rawparser
+// package, e.g.:
+//
+//	x, err := exifcompat.Decode(f)
+//	...
+//	tag, err := x.Get(exifcompat.Model)
+//	model, err := tag.StringVal()
+//
+// The Tag type of goexif's tiff package is the Tag type of this package.
+// IFD0 and the EXIF, GPS, and interoperability IFDs are read; the SubIFDs
+// of raw files, holding the raw image and previews, are skipped.  Maker
+// notes are not decoded.
+package exifcompat
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jeremytorres/rawparser"
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// maxJpegSegments bounds the markers walked to find the EXIF segment of a
+// JPEG; APP segments precede the image data.
+const maxJpegSegments = 64
+
+// exifHeader begins the APP1 segment holding the EXIF data of a JPEG.
+var exifHeader = []byte("Exif\x00\x00")
+
+// ErrNoExif is returned when a JPEG has no EXIF segment.
+var ErrNoExif = errors.New("exifcompat: no EXIF data")
+
+// TagNotPresentError is returned by Get when a tag is not present.
+type TagNotPresentError FieldName
+
+func (e TagNotPresentError) Error() string {
+	return fmt.Sprintf("exif: tag %q is not present", string(e))
+}
+
+// IsTagNotPresentError determines if an error is a TagNotPresentError.
+func IsTagNotPresentError(err error) bool {
+	var e TagNotPresentError
+	return errors.As(err, &e)
+}
+
+// Walker is implemented by the visitors of the tags of an Exif.
+type Walker interface {
+	Walk(name FieldName, tag *Tag) error
+}
+
+// Exif is a struct representing the EXIF metadata of a file: the tags of
+// known name of IFD0 and the EXIF, GPS, and interoperability IFDs.
+type Exif struct {
+	tags  map[FieldName]*Tag
+	names []FieldName // in file order
+}
+
+// Decode reads the EXIF metadata of a raw file, a TIFF, or a JPEG.  The
+// values are read by Decode; a reader implementing io.ReaderAt, e.g., an
+// *os.File, is read at the offsets of the IFDs only, others are read in
+// full.
+// Returns the Exif or error.
+func Decode(r io.Reader) (*Exif, error) {
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		ra = bytes.NewReader(data)
+	}
+
+	soi := make([]byte, 2)
+	if _, err := ra.ReadAt(soi, 0); err != nil {
+		return nil, err
+	}
+	if soi[0] == 0xFF && soi[1] == 0xD8 {
+		exif, err := jpegExif(ra)
+		if err != nil {
+			return nil, err
+		}
+		ra = exif
+	}
+	return decode(ra)
+}
+
+// DecodeFile reads the EXIF metadata of a TIFF-based raw file specified by
+// RawFileInfo, as read by rawparser.ExifData: File, or the Reader or Handle
+// supplied by the caller.
+// Returns the Exif or error.
+func DecodeFile(info *rawparser.RawFileInfo) (*Exif, error) {
+	data, err := rawparser.ExifData(info)
+	if err != nil {
+		return nil, err
+	}
+	return decode(bytes.NewReader(data))
+}
+
+// decode walks IFD0 and the EXIF, GPS, and interoperability IFDs of TIFF
+// data.  Of tags of the same name, the first is kept.
+// Returns the Exif or error.
+func decode(r io.ReaderAt) (*Exif, error) {
+	h, err := tiff.ReadHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	x := &Exif{tags: make(map[FieldName]*Tag)}
+	err = tiff.WalkIFDs(r, h, func(ifd *tiff.IFD) error {
+		switch ifd.Kind {
+		case tiff.KindMain:
+			if ifd.Index > 0 {
+				return tiff.SkipChildren
+			}
+		case tiff.KindExif, tiff.KindGPS, tiff.KindInterop:
+		default:
+			return tiff.SkipChildren
+		}
+
+		for i := range ifd.Entries {
+			e := &ifd.Entries[i]
+			name := FieldName(tiff.TagName(ifd.Kind, e.Tag))
+			if name == "" || x.tags[name] != nil {
+				continue
+			}
+			tag, err := newTag(e, h.ByteOrder)
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", name, err)
+			}
+			x.tags[name] = tag
+			x.names = append(x.names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// jpegExif finds the EXIF segment of a JPEG.
+// Returns the TIFF data of the segment or error.
+func jpegExif(r io.ReaderAt) (*io.SectionReader, error) {
+	pos := int64(2)
+	marker := make([]byte, 4+len(exifHeader))
+	for i := 0; i < maxJpegSegments; i++ {
+		if n, _ := r.ReadAt(marker, pos); n < 4 || marker[0] != 0xFF {
+			break
+		}
+		length := int64(marker[2])<<8 | int64(marker[3])
+		if marker[1] == 0xE1 && length > int64(2+len(exifHeader)) && bytes.Equal(marker[4:], exifHeader) {
+			start := pos + 4 + int64(len(exifHeader))
+			return io.NewSectionReader(r, start, length-2-int64(len(exifHeader))), nil
+		}
+		if marker[1] == 0xDA { // start of scan
+			break
+		}
+		pos += 2 + length
+	}
+	return nil, ErrNoExif
+}
+
+// Get returns the tag of a name.
+// Returns the tag or a TagNotPresentError.
+func (x *Exif) Get(name FieldName) (*Tag, error) {
+	if alias, ok := aliases[name]; ok {
+		name = alias
+	}
+	if tag := x.tags[name]; tag != nil {
+		return tag, nil
+	}
+	return nil, TagNotPresentError(name)
+}
+
+// Walk calls the Walker with every tag, in file order, stopping at the
+// first error.
+// Returns the error of the Walker or nil.
+func (x *Exif) Walk(w Walker) error {
+	for _, name := range x.names {
+		if err := w.Walk(name, x.tags[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DateTime reads the DateTimeOriginal or, if not present, the DateTime,
+// in the time zone of the OffsetTimeOriginal or OffsetTime if present;
+// local time otherwise.
+// Returns the time or error.
+func (x *Exif) DateTime() (time.Time, error) {
+	tag, err := x.Get(DateTimeOriginal)
+	if err != nil {
+		if tag, err = x.Get(DateTime); err != nil {
+			return time.Time{}, err
+		}
+	}
+	s, err := tag.StringVal()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	loc := time.Local
+	for _, name := range []FieldName{"OffsetTimeOriginal", "OffsetTime"} {
+		if tag, err := x.Get(name); err == nil {
+			offset, _ := tag.StringVal()
+			if t, err := time.Parse("-07:00", offset); err == nil {
+				loc = t.Location()
+				break
+			}
+		}
+	}
+	return time.ParseInLocation("2006:01:02 15:04:05", strings.TrimSpace(s), loc)
+}
+
+// LatLong reads the GPS latitude and longitude, in degrees: negative
+// south and west.
+// Returns the latitude, longitude, or error.
+func (x *Exif) LatLong() (lat, long float64, err error) {
+	if lat, err = x.degrees(GPSLatitude, GPSLatitudeRef, "S"); err != nil {
+		return 0, 0, err
+	}
+	if long, err = x.degrees(GPSLongitude, GPSLongitudeRef, "W"); err != nil {
+		return 0, 0, err
+	}
+	return lat, long, nil
+}
+
+// degrees reads a GPS coordinate of degrees, minutes, and seconds, and its
+// reference, negated if the reference is negative.
+// Returns the coordinate, in degrees, or error.
+func (x *Exif) degrees(name, refName FieldName, negative string) (float64, error) {
+	tag, err := x.Get(name)
+	if err != nil {
+		return 0, err
+	}
+	ref, err := x.Get(refName)
+	if err != nil {
+		return 0, err
+	}
+
+	var d float64
+	for i, unit := range []float64{1, 60, 3600} {
+		r, err := tag.Rat(i)
+		if err != nil {
+			return 0, fmt.Errorf("reading %s: %w", name, err)
+		}
+		f, _ := r.Float64()
+		d += f / unit
+	}
+	if s, _ := ref.StringVal(); s == negative {
+		d = -d
+	}
+	return d, nil
+}
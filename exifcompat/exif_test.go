@@ -0,0 +1,179 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package exifcompat
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/jeremytorres/rawparser"
+)
+
+const (
+	testNefFile  = "../test_files/big_endian.NEF"
+	testCR2File  = "../test_files/little_endian.CR2"
+	testJpegFile = "../test_files/big_endian.jpg"
+)
+
+// countWalker counts the tags walked.
+type countWalker map[FieldName]int
+
+func (w countWalker) Walk(name FieldName, tag *Tag) error {
+	w[name]++
+	return nil
+}
+
+func TestDecodeNef(t *testing.T) {
+	f, err := os.Open(testNefFile)
+	if err != nil {
+		t.Fatalf("Unable to open test NEF file: %v\n", err)
+	}
+	defer f.Close()
+
+	x, err := Decode(f)
+	if err != nil {
+		t.Fatalf("Unexpected error decoding NEF: %v\n", err)
+	}
+
+	tag, err := x.Get(Model)
+	if err != nil {
+		t.Fatalf("Unexpected error getting Model: %v\n", err)
+	}
+	if model, err := tag.StringVal(); model != "NIKON D700" || err != nil {
+		t.Errorf("Unexpected Model: %q %v\n", model, err)
+	}
+	if tag, err := x.Get(Orientation); err != nil {
+		t.Errorf("Unexpected error getting Orientation: %v\n", err)
+	} else if o, err := tag.Int(0); o != 8 || err != nil {
+		t.Errorf("Unexpected Orientation: %d %v\n", o, err)
+	}
+	if tag, err := x.Get(FNumber); err != nil {
+		t.Errorf("Unexpected error getting FNumber: %v\n", err)
+	} else if num, den, err := tag.Rat2(0); num != 28 || den != 10 || err != nil {
+		t.Errorf("Unexpected FNumber: %d/%d %v\n", num, den, err)
+	}
+	if tag, err := x.Get(ExifIFDPointer); err != nil {
+		t.Errorf("Unexpected error getting ExifIFDPointer: %v\n", err)
+	} else if offset, err := tag.Int(0); offset != 600 || err != nil {
+		t.Errorf("Unexpected ExifIFDPointer: %d %v\n", offset, err)
+	}
+
+	dt, err := x.DateTime()
+	if err != nil || dt.Year() != 2013 || dt.Month() != 7 || dt.Hour() != 14 {
+		t.Errorf("Unexpected DateTime: %v %v\n", dt, err)
+	}
+
+	// the SubIFDs of the previews and the raw image are skipped
+	if _, err := x.Get("JPEGInterchangeFormat"); !IsTagNotPresentError(err) {
+		t.Errorf("Expected JPEGInterchangeFormat not present; got %v\n", err)
+	}
+
+	w := make(countWalker)
+	if err := x.Walk(w); err != nil {
+		t.Errorf("Unexpected error walking: %v\n", err)
+	}
+	if w[Model] != 1 || w[ExposureTime] != 1 || len(w) != len(x.tags) {
+		t.Errorf("Unexpected tags walked: %v\n", w)
+	}
+}
+
+func TestDecodeJpeg(t *testing.T) {
+	data, err := os.ReadFile(testJpegFile)
+	if err != nil {
+		t.Fatalf("Unable to read test JPEG file: %v\n", err)
+	}
+
+	// a reader not implementing io.ReaderAt is read in full
+	x, err := Decode(struct{ *bytes.Buffer }{bytes.NewBuffer(data)})
+	if err != nil {
+		t.Fatalf("Unexpected error decoding JPEG: %v\n", err)
+	}
+	tag, err := x.Get(Make)
+	if err != nil {
+		t.Fatalf("Unexpected error getting Make: %v\n", err)
+	}
+	if mk, err := tag.StringVal(); mk == "" || err != nil {
+		t.Errorf("Unexpected Make: %q %v\n", mk, err)
+	}
+
+	if _, err := Decode(bytes.NewReader([]byte{0xFF, 0xD8, 0xFF, 0xDA, 0, 2})); !errors.Is(err, ErrNoExif) {
+		t.Errorf("Expected ErrNoExif; got %v\n", err)
+	}
+}
+
+func TestDecodeFile(t *testing.T) {
+	x, err := DecodeFile(&rawparser.RawFileInfo{File: testCR2File})
+	if err != nil {
+		t.Fatalf("Unexpected error decoding CR2: %v\n", err)
+	}
+	tag, err := x.Get(Make)
+	if err != nil {
+		t.Fatalf("Unexpected error getting Make: %v\n", err)
+	}
+	if mk, err := tag.StringVal(); mk != "Canon" || err != nil {
+		t.Errorf("Unexpected Make: %q %v\n", mk, err)
+	}
+	if _, err := x.DateTime(); err != nil {
+		t.Errorf("Unexpected error getting DateTime: %v\n", err)
+	}
+}
+
+func TestTagFormats(t *testing.T) {
+	f, err := os.Open(testNefFile)
+	if err != nil {
+		t.Fatalf("Unable to open test NEF file: %v\n", err)
+	}
+	defer f.Close()
+	x, err := Decode(f)
+	if err != nil {
+		t.Fatalf("Unexpected error decoding NEF: %v\n", err)
+	}
+
+	model, _ := x.Get(Model)
+	if model.Format() != StringVal {
+		t.Errorf("Unexpected format of Model: %d\n", model.Format())
+	}
+	if _, err := model.Int(0); !errors.Is(err, ErrFormat) {
+		t.Errorf("Expected ErrFormat reading Model as an integer; got %v\n", err)
+	}
+	bits, _ := x.Get(BitsPerSample)
+	if v, err := bits.Int(2); v != 8 || err != nil {
+		t.Errorf("Unexpected BitsPerSample: %d %v\n", v, err)
+	}
+	if _, err := bits.Int(3); !errors.Is(err, ErrFormat) {
+		t.Errorf("Expected ErrFormat reading beyond the count; got %v\n", err)
+	}
+	if s := bits.String(); s != "[8,8,8]" {
+		t.Errorf("Unexpected BitsPerSample string: %s\n", s)
+	}
+	bias, _ := x.Get(ExposureBiasValue)
+	if r, err := bias.Rat(0); err != nil || r.Sign() != 0 {
+		t.Errorf("Unexpected ExposureBiasValue: %v %v\n", r, err)
+	}
+	if _, err := x.Get(GPSSatelites); err != nil && !IsTagNotPresentError(err) {
+		t.Errorf("Unexpected error getting GPSSatelites: %v\n", err)
+	}
+}
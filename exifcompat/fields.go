@@ -0,0 +1,155 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package exifcompat
+
+// FieldName is the name of a tag, as by goexif: the name defined by the
+// TIFF, EXIF, and DNG specifications, e.g., "DateTimeOriginal".  Any name
+// of the tags package may be used; the names of goexif differing from
+// them are aliases.
+type FieldName string
+
+// The names of the tags of IFD0.
+const (
+	ImageWidth                FieldName = "ImageWidth"
+	ImageLength               FieldName = "ImageLength"
+	BitsPerSample             FieldName = "BitsPerSample"
+	Compression               FieldName = "Compression"
+	PhotometricInterpretation FieldName = "PhotometricInterpretation"
+	Orientation               FieldName = "Orientation"
+	SamplesPerPixel           FieldName = "SamplesPerPixel"
+	PlanarConfiguration       FieldName = "PlanarConfiguration"
+	YCbCrSubSampling          FieldName = "YCbCrSubSampling"
+	YCbCrPositioning          FieldName = "YCbCrPositioning"
+	XResolution               FieldName = "XResolution"
+	YResolution               FieldName = "YResolution"
+	ResolutionUnit            FieldName = "ResolutionUnit"
+	DateTime                  FieldName = "DateTime"
+	ImageDescription          FieldName = "ImageDescription"
+	Make                      FieldName = "Make"
+	Model                     FieldName = "Model"
+	Software                  FieldName = "Software"
+	Artist                    FieldName = "Artist"
+	Copyright                 FieldName = "Copyright"
+
+	ExifIFDPointer             FieldName = "ExifIFDPointer"
+	GPSInfoIFDPointer          FieldName = "GPSInfoIFDPointer"
+	InteroperabilityIFDPointer FieldName = "InteroperabilityIFDPointer"
+)
+
+// The names of the tags of the EXIF IFD.
+const (
+	ExifVersion              FieldName = "ExifVersion"
+	FlashpixVersion          FieldName = "FlashpixVersion"
+	ColorSpace               FieldName = "ColorSpace"
+	ComponentsConfiguration  FieldName = "ComponentsConfiguration"
+	CompressedBitsPerPixel   FieldName = "CompressedBitsPerPixel"
+	PixelXDimension          FieldName = "PixelXDimension"
+	PixelYDimension          FieldName = "PixelYDimension"
+	MakerNote                FieldName = "MakerNote"
+	UserComment              FieldName = "UserComment"
+	DateTimeOriginal         FieldName = "DateTimeOriginal"
+	DateTimeDigitized        FieldName = "DateTimeDigitized"
+	SubSecTime               FieldName = "SubSecTime"
+	SubSecTimeOriginal       FieldName = "SubSecTimeOriginal"
+	SubSecTimeDigitized      FieldName = "SubSecTimeDigitized"
+	ImageUniqueID            FieldName = "ImageUniqueID"
+	ExposureTime             FieldName = "ExposureTime"
+	FNumber                  FieldName = "FNumber"
+	ExposureProgram          FieldName = "ExposureProgram"
+	ISOSpeedRatings          FieldName = "ISOSpeedRatings"
+	ShutterSpeedValue        FieldName = "ShutterSpeedValue"
+	ApertureValue            FieldName = "ApertureValue"
+	ExposureBiasValue        FieldName = "ExposureBiasValue"
+	MaxApertureValue         FieldName = "MaxApertureValue"
+	SubjectDistance          FieldName = "SubjectDistance"
+	MeteringMode             FieldName = "MeteringMode"
+	LightSource              FieldName = "LightSource"
+	Flash                    FieldName = "Flash"
+	FocalLength              FieldName = "FocalLength"
+	FocalPlaneXResolution    FieldName = "FocalPlaneXResolution"
+	FocalPlaneYResolution    FieldName = "FocalPlaneYResolution"
+	FocalPlaneResolutionUnit FieldName = "FocalPlaneResolutionUnit"
+	SensingMethod            FieldName = "SensingMethod"
+	FileSource               FieldName = "FileSource"
+	SceneType                FieldName = "SceneType"
+	CFAPattern               FieldName = "CFAPattern"
+	CustomRendered           FieldName = "CustomRendered"
+	ExposureMode             FieldName = "ExposureMode"
+	WhiteBalance             FieldName = "WhiteBalance"
+	DigitalZoomRatio         FieldName = "DigitalZoomRatio"
+	FocalLengthIn35mmFilm    FieldName = "FocalLengthIn35mmFilm"
+	SceneCaptureType         FieldName = "SceneCaptureType"
+	GainControl              FieldName = "GainControl"
+	Contrast                 FieldName = "Contrast"
+	Saturation               FieldName = "Saturation"
+	Sharpness                FieldName = "Sharpness"
+	SubjectDistanceRange     FieldName = "SubjectDistanceRange"
+	LensMake                 FieldName = "LensMake"
+	LensModel                FieldName = "LensModel"
+)
+
+// The names of the tags of the GPS IFD.
+const (
+	GPSVersionID        FieldName = "GPSVersionID"
+	GPSLatitudeRef      FieldName = "GPSLatitudeRef"
+	GPSLatitude         FieldName = "GPSLatitude"
+	GPSLongitudeRef     FieldName = "GPSLongitudeRef"
+	GPSLongitude        FieldName = "GPSLongitude"
+	GPSAltitudeRef      FieldName = "GPSAltitudeRef"
+	GPSAltitude         FieldName = "GPSAltitude"
+	GPSTimeStamp        FieldName = "GPSTimeStamp"
+	GPSSatelites        FieldName = "GPSSatelites"
+	GPSStatus           FieldName = "GPSStatus"
+	GPSMeasureMode      FieldName = "GPSMeasureMode"
+	GPSDOP              FieldName = "GPSDOP"
+	GPSSpeedRef         FieldName = "GPSSpeedRef"
+	GPSSpeed            FieldName = "GPSSpeed"
+	GPSTrackRef         FieldName = "GPSTrackRef"
+	GPSTrack            FieldName = "GPSTrack"
+	GPSImgDirectionRef  FieldName = "GPSImgDirectionRef"
+	GPSImgDirection     FieldName = "GPSImgDirection"
+	GPSMapDatum         FieldName = "GPSMapDatum"
+	GPSDestLatitudeRef  FieldName = "GPSDestLatitudeRef"
+	GPSDestLatitude     FieldName = "GPSDestLatitude"
+	GPSDestLongitudeRef FieldName = "GPSDestLongitudeRef"
+	GPSDestLongitude    FieldName = "GPSDestLongitude"
+	GPSProcessingMethod FieldName = "GPSProcessingMethod"
+	GPSAreaInformation  FieldName = "GPSAreaInformation"
+	GPSDateStamp        FieldName = "GPSDateStamp"
+	GPSDifferential     FieldName = "GPSDifferential"
+)
+
+// The names of the tags of the interoperability IFD.
+const (
+	InteroperabilityIndex FieldName = "InteroperabilityIndex"
+)
+
+// aliases are the names of goexif differing from those of the tags
+// package.
+var aliases = map[FieldName]FieldName{
+	ExifIFDPointer:             "ExifIFD",
+	GPSInfoIFDPointer:          "GPSInfoIFD",
+	InteroperabilityIFDPointer: "InteroperabilityIFD",
+	GPSSatelites:               "GPSSatellites",
+}
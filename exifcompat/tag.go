@@ -0,0 +1,231 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package exifcompat
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// ErrFormat is returned when the value of a Tag is read as a format it
+// does not have, e.g., Int of an ASCII tag, or at an index beyond its
+// count.
+var ErrFormat = errors.New("exifcompat: invalid tag value format")
+
+// Format is the format of the values of a Tag, as by goexif.
+type Format int
+
+// The formats of the values of a Tag.
+const (
+	IntVal Format = iota
+	FloatVal
+	RatVal
+	StringVal
+	UndefVal
+	OtherVal
+)
+
+// Tag is a struct representing an entry of an IFD, as the tiff.Tag of
+// goexif.  The value is read when the Exif is decoded.
+type Tag struct {
+	Id    uint16 // the tag, named as by goexif
+	Type  tiff.Type
+	Count uint32
+	Order binary.ByteOrder
+
+	// Val is the value, in the byte order of the file.
+	Val []byte
+
+	value  any // the value decoded as by tiff.Entry.Value
+	format Format
+}
+
+// newTag reads the value of an entry.
+// Returns the tag or error.
+func newTag(e *tiff.Entry, order binary.ByteOrder) (*Tag, error) {
+	val, err := e.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	value, err := e.Value()
+	if err != nil {
+		return nil, err
+	}
+	return &Tag{Id: e.Tag, Type: e.Type, Count: e.Count, Order: order, Val: val, value: value, format: formatOf(e.Type)}, nil
+}
+
+// formatOf determines the format of the values of a field type.
+func formatOf(t tiff.Type) Format {
+	switch t {
+	case tiff.Byte, tiff.Short, tiff.Long, tiff.SByte, tiff.SShort, tiff.SLong, tiff.IFDType, tiff.Long8, tiff.SLong8, tiff.IFD8:
+		return IntVal
+	case tiff.Float, tiff.Double:
+		return FloatVal
+	case tiff.Rational, tiff.SRational:
+		return RatVal
+	case tiff.ASCII:
+		return StringVal
+	case tiff.Undefined:
+		return UndefVal
+	}
+	return OtherVal
+}
+
+// Format returns the format of the values of the tag.
+func (t *Tag) Format() Format {
+	return t.format
+}
+
+// Int reads the i-th value of an integer tag.
+// Returns the value or error.
+func (t *Tag) Int(i int) (int, error) {
+	v, err := t.Int64(i)
+	return int(v), err
+}
+
+// Int64 reads the i-th value of an integer tag.
+// Returns the value or error.
+func (t *Tag) Int64(i int) (int64, error) {
+	if err := t.check(IntVal, i); err != nil {
+		return 0, err
+	}
+	switch v := t.value.(type) {
+	case []byte:
+		return int64(v[i]), nil
+	case []uint16:
+		return int64(v[i]), nil
+	case []uint32:
+		return int64(v[i]), nil
+	case []int8:
+		return int64(v[i]), nil
+	case []int16:
+		return int64(v[i]), nil
+	case []int32:
+		return int64(v[i]), nil
+	case []uint64:
+		return int64(v[i]), nil
+	case []int64:
+		return v[i], nil
+	}
+	return 0, t.formatError(IntVal)
+}
+
+// Rat2 reads the i-th value of a rational tag.
+// Returns the numerator and denominator or error.
+func (t *Tag) Rat2(i int) (num, den int64, err error) {
+	if err := t.check(RatVal, i); err != nil {
+		return 0, 0, err
+	}
+	switch v := t.value.(type) {
+	case []tiff.RationalValue:
+		return int64(v[i].Num), int64(v[i].Den), nil
+	case []tiff.SRationalValue:
+		return int64(v[i].Num), int64(v[i].Den), nil
+	}
+	return 0, 0, t.formatError(RatVal)
+}
+
+// Rat reads the i-th value of a rational tag.
+// Returns the value or error, e.g., if the denominator is zero.
+func (t *Tag) Rat(i int) (*big.Rat, error) {
+	num, den, err := t.Rat2(i)
+	if err != nil {
+		return nil, err
+	}
+	if den == 0 {
+		return nil, fmt.Errorf("%w: tag 0x%04x value %d/0", ErrFormat, t.Id, num)
+	}
+	return big.NewRat(num, den), nil
+}
+
+// Float reads the i-th value of a floating point tag.
+// Returns the value or error.
+func (t *Tag) Float(i int) (float64, error) {
+	if err := t.check(FloatVal, i); err != nil {
+		return 0, err
+	}
+	switch v := t.value.(type) {
+	case []float32:
+		return float64(v[i]), nil
+	case []float64:
+		return v[i], nil
+	}
+	return 0, t.formatError(FloatVal)
+}
+
+// StringVal reads the value of an ASCII tag, without trailing NULs.
+// Returns the value or error.
+func (t *Tag) StringVal() (string, error) {
+	if t.format != StringVal {
+		return "", t.formatError(StringVal)
+	}
+	return t.value.(string), nil
+}
+
+// String formats the values of the tag, e.g., "[300/1]" or "\"NIKON\"".
+func (t *Tag) String() string {
+	switch v := t.value.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case []tiff.RationalValue:
+		s := make([]string, len(v))
+		for i := range v {
+			s[i] = fmt.Sprintf("%d/%d", v[i].Num, v[i].Den)
+		}
+		return "[" + strings.Join(s, ",") + "]"
+	case []tiff.SRationalValue:
+		s := make([]string, len(v))
+		for i := range v {
+			s[i] = fmt.Sprintf("%d/%d", v[i].Num, v[i].Den)
+		}
+		return "[" + strings.Join(s, ",") + "]"
+	case []byte:
+		if t.format == UndefVal {
+			return fmt.Sprintf("%q", v)
+		}
+	}
+	return strings.ReplaceAll(fmt.Sprint(t.value), " ", ",")
+}
+
+// check verifies the format of the tag and the index of a value.
+// Returns nil or an error wrapping ErrFormat.
+func (t *Tag) check(f Format, i int) error {
+	if t.format != f {
+		return t.formatError(f)
+	}
+	if i < 0 || i >= int(t.Count) {
+		return fmt.Errorf("%w: index %d of tag 0x%04x of %d values", ErrFormat, i, t.Id, t.Count)
+	}
+	return nil
+}
+
+// formatError reports a tag read as a format it does not have.
+func (t *Tag) formatError(f Format) error {
+	return fmt.Errorf("%w: tag 0x%04x of type %v is not of format %d", ErrFormat, t.Id, t.Type, f)
+}
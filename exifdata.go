@@ -0,0 +1,111 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// exifDataExcludedTags are the tags not included by ExifData: they
+// reference image data or private structures by offset, which are not
+// valid outside the raw file.
+var exifDataExcludedTags = map[uint16]bool{
+	0x0111: true, // StripOffsets
+	0x0117: true, // StripByteCounts
+	0x0144: true, // TileOffsets
+	0x0145: true, // TileByteCounts
+	0x014a: true, // SubIFDs
+	0x0201: true, // JPEGInterchangeFormat
+	0x0202: true, // JPEGInterchangeFormatLength
+	0x927c: true, // MakerNote; e.g., Canon's uses offsets within the file
+	0xc634: true, // DNGPrivateData
+}
+
+// ExifData reads the EXIF metadata of a TIFF-based raw file, IFD0 and the
+// EXIF, GPS, and interoperability IFDs, as self-contained TIFF data: the
+// format of the EXIF data of a JPEG, read by EXIF libraries, e.g.,
+// exif.Decode(bytes.NewReader(data)) of goexif.  Tags referencing data by
+// offset (e.g., strips, SubIFDs, and the maker note) are excluded.  The
+// IFDs of the returned data, or of the EXIF data exposed by other
+// libraries, are read by tiff.ReadAll.
+// Returns the TIFF data or error.
+func ExifData(info *RawFileInfo) ([]byte, error) {
+	f, err := openRawFile(info)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	order, ifds, err := readExifIFDs(newReadCache(f))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := tiff.Encode(order, ifds)
+	if err != nil {
+		return nil, fmt.Errorf("encoding EXIF data of '%s': %w", f.Name(), err)
+	}
+	return data, nil
+}
+
+// readExifIFDs reads IFD0 and the EXIF, GPS, and interoperability IFDs of
+// TIFF data, without the tags of exifDataExcludedTags.
+// Returns the byte order of the data, the IFDs, or error.
+func readExifIFDs(r io.ReaderAt) (binary.ByteOrder, []*tiff.IFD, error) {
+	h, err := tiff.ReadHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ifds []*tiff.IFD
+	err = tiff.WalkIFDs(r, h, func(ifd *tiff.IFD) error {
+		switch ifd.Kind {
+		case tiff.KindMain:
+			if ifd.Index > 0 {
+				return tiff.SkipChildren
+			}
+		case tiff.KindExif, tiff.KindGPS, tiff.KindInterop:
+		default:
+			return tiff.SkipChildren
+		}
+
+		entries := make([]tiff.Entry, 0, len(ifd.Entries))
+		for _, e := range ifd.Entries {
+			if !exifDataExcludedTags[e.Tag] {
+				entries = append(entries, e)
+			}
+		}
+		ifd.Entries = entries
+		ifds = append(ifds, ifd)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return h.ByteOrder, ifds, nil
+}
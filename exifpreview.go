@@ -0,0 +1,289 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// exifHeader identifies the APP1 segment of a JPEG holding EXIF data.
+var exifHeader = []byte("Exif\x00\x00")
+
+// maxExifSize is the maximum size of the EXIF data of a JPEG: the data of
+// an APP1 segment, less the exifHeader.
+const maxExifSize = 0xffff - 2 - 6
+
+// previewExcludedTags are the tags not copied to the EXIF data of an
+// extracted preview, in addition to exifDataExcludedTags: they describe
+// the raw image data rather than the preview.
+var previewExcludedTags = map[uint16]bool{
+	0x00fe: true, // NewSubfileType
+	0x0100: true, // ImageWidth
+	0x0101: true, // ImageLength
+	0x0102: true, // BitsPerSample
+	0x0103: true, // Compression
+	0x0106: true, // PhotometricInterpretation
+	0x0115: true, // SamplesPerPixel
+	0x0116: true, // RowsPerStrip
+	0x011c: true, // PlanarConfiguration
+	0x0153: true, // SampleFormat
+	0x0211: true, // YCbCrCoefficients
+	0x0212: true, // YCbCrSubSampling
+	0x0213: true, // YCbCrPositioning
+	0x828d: true, // CFARepeatPatternDim
+	0x828e: true, // CFAPattern
+	0xa002: true, // PixelXDimension
+	0xa003: true, // PixelYDimension
+}
+
+// isDngTag determines if a tag is defined by the DNG specification, which
+// describe the raw image data.
+func isDngTag(tag uint16) bool {
+	return tag >= 0xc612 && tag <= 0xc7ff
+}
+
+// previewExif determines the EXIF data written to the extracted preview of
+// a raw file if info.PreserveExif is set and the output format is JPEG:
+// the EXIF metadata of a TIFF-based raw file, or EXIF metadata synthesized
+// from the RawFile for other raw files or if the metadata exceeds the
+// size of a JPEG segment.  The Artist and Copyright of info, if set, are
+// stamped into IFD0, even if info.PreserveExif is not set.
+// Returns the TIFF data; nil if not requested or none could be encoded.
+func (r *RawFile) previewExif(f *rawSource, info *RawFileInfo) []byte {
+	stamped := info.Artist != "" || info.Copyright != ""
+	if !info.PreserveExif && !stamped || info.OutputFormat != OutputJpeg {
+		return nil
+	}
+
+	if !info.PreserveExif {
+		data, err := encodeExif(binary.BigEndian, []*tiff.IFD{{Kind: tiff.KindMain}}, info)
+		if err != nil {
+			log.Printf("Error encoding the artist and copyright of '%s': %v\n", f.Name(), err)
+			return nil
+		}
+		return data
+	}
+
+	data, err := copiedExif(f, info)
+	if err == nil && len(data) <= maxExifSize {
+		return data
+	}
+	if err != nil {
+		log.Printf("Synthesizing EXIF data of '%s': %v\n", f.Name(), err)
+	}
+
+	data, err = r.synthesizedExif(info)
+	if err != nil {
+		log.Printf("Error synthesizing EXIF data of '%s': %v\n", f.Name(), err)
+		return nil
+	}
+	return data
+}
+
+// copiedExif reads the EXIF metadata of a TIFF-based raw file, without the
+// tags describing the raw image data, stamped as by encodeExif.
+// Returns the TIFF data or error.
+func copiedExif(f *rawSource, info *RawFileInfo) ([]byte, error) {
+	order, ifds, err := readExifIFDs(newReadCache(f))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ifd := range ifds {
+		entries := ifd.Entries[:0]
+		for _, e := range ifd.Entries {
+			if !previewExcludedTags[e.Tag] && !isDngTag(e.Tag) {
+				entries = append(entries, e)
+			}
+		}
+		ifd.Entries = entries
+	}
+	return encodeExif(order, ifds, info)
+}
+
+// synthesizedExif encodes the metadata of a RawFile as EXIF data, stamped
+// as by encodeExif: the camera make and model, the artist and copyright,
+// the orientation of the preview, and the CreateDate as DateTimeOriginal.
+// Returns the TIFF data or error.
+func (r *RawFile) synthesizedExif(info *RawFileInfo) ([]byte, error) {
+	order := binary.BigEndian
+
+	ifd0 := &tiff.IFD{Kind: tiff.KindMain}
+	if r.CameraModel.Make != "" {
+		ifd0.Entries = append(ifd0.Entries, asciiTiffEntry(order, 0x010f, r.CameraModel.Make))
+	}
+	if r.CameraModel.Model != "" {
+		ifd0.Entries = append(ifd0.Entries, asciiTiffEntry(order, 0x0110, r.CameraModel.Model))
+	}
+	if r.Artist != "" {
+		ifd0.Entries = append(ifd0.Entries, asciiTiffEntry(order, 0x013b, r.Artist))
+	}
+	if r.Copyright != "" {
+		ifd0.Entries = append(ifd0.Entries, asciiTiffEntry(order, 0x8298, r.Copyright))
+	}
+	ifd0.Entries = append(ifd0.Entries,
+		tiff.NewEntry(order, 0x0112, tiff.Short, 1, order.AppendUint16(nil, r.orientation().exif())))
+
+	ifds := []*tiff.IFD{ifd0}
+	if !r.CreateDate.IsZero() {
+		ifds = append(ifds, &tiff.IFD{Kind: tiff.KindExif, Entries: []tiff.Entry{
+			asciiTiffEntry(order, 0x9003, r.CreateDate.Format("2006:01:02 15:04:05")),
+		}})
+	}
+	return encodeExif(order, ifds, info)
+}
+
+// encodeExif encodes IFD0 and the EXIF, GPS, and interoperability IFDs as
+// EXIF data, with the Artist and Copyright of info, if set, replacing
+// those of IFD0, and, if info.ConvertToSRGB is set, the color space
+// recorded as by srgbExif.
+// Returns the TIFF data or error.
+func encodeExif(order binary.ByteOrder, ifds []*tiff.IFD, info *RawFileInfo) ([]byte, error) {
+	if info.ConvertToSRGB {
+		srgbExif(order, ifds)
+	}
+	for _, ifd := range ifds {
+		if ifd.Kind != tiff.KindMain || ifd.Index != 0 {
+			continue
+		}
+		if info.Artist != "" {
+			setTiffEntry(ifd, asciiTiffEntry(order, 0x013b, info.Artist))
+		}
+		if info.Copyright != "" {
+			setTiffEntry(ifd, asciiTiffEntry(order, 0x8298, info.Copyright))
+		}
+	}
+	return tiff.Encode(order, ifds)
+}
+
+// srgbExif records sRGB as the color space of EXIF data recording Adobe
+// RGB, i.e., of a preview converted to sRGB: the ColorSpace and, if
+// recorded, the InteroperabilityIndex ("R98").  See colorSpaceOf.
+func srgbExif(order binary.ByteOrder, ifds []*tiff.IFD) {
+	var colorSpace, index *tiff.Entry
+	for _, ifd := range ifds {
+		switch ifd.Kind {
+		case tiff.KindExif:
+			colorSpace = ifd.Find(0xa001)
+		case tiff.KindInterop:
+			index = ifd.Find(0x0001)
+		}
+	}
+	if colorSpace == nil {
+		return
+	}
+
+	v, _ := colorSpace.Uint()
+	interop := ""
+	if index != nil {
+		interop, _ = index.ASCII()
+	}
+	if colorSpaceOf(uint16(v), interop) != ColorSpaceAdobeRGB {
+		return
+	}
+
+	srgb := make([]byte, 2)
+	order.PutUint16(srgb, 1)
+	*colorSpace = tiff.NewEntry(order, 0xa001, tiff.Short, 1, srgb)
+	if index != nil {
+		*index = asciiTiffEntry(order, 0x0001, "R98")
+	}
+}
+
+// asciiTiffEntry creates an ASCII entry holding s.
+func asciiTiffEntry(order binary.ByteOrder, tag uint16, s string) tiff.Entry {
+	v := append([]byte(s), 0)
+	return tiff.NewEntry(order, tag, tiff.ASCII, uint32(len(v)), v)
+}
+
+// setTiffEntry replaces the entry of an IFD with the tag of e, or adds e.
+func setTiffEntry(ifd *tiff.IFD, e tiff.Entry) {
+	if old := ifd.Find(e.Tag); old != nil {
+		*old = e
+		return
+	}
+	ifd.Entries = append(ifd.Entries, e)
+}
+
+// insertExif inserts EXIF data into a JPEG as an APP1 segment, following
+// the JFIF APP0 segment, if any, and replacing any EXIF APP1 segment.
+// Returns the JPEG or error.
+func insertExif(jpeg, exif []byte) ([]byte, error) {
+	if len(jpeg) < 2 || jpeg[0] != 0xff || jpeg[1] != 0xd8 {
+		return nil, errors.New("missing JPEG start of image")
+	}
+	if len(exif) > maxExifSize {
+		return nil, fmt.Errorf("EXIF data of %d bytes exceeds a JPEG segment", len(exif))
+	}
+
+	// the application segments following the start of image
+	var jfif, rest []byte
+	pos := 2
+	for pos+4 <= len(jpeg) && jpeg[pos] == 0xff && jpeg[pos+1]&0xf0 == 0xe0 {
+		n := 2 + int(binary.BigEndian.Uint16(jpeg[pos+2:]))
+		if n < 4 || pos+n > len(jpeg) {
+			return nil, fmt.Errorf("invalid JPEG segment length at offset %d", pos)
+		}
+		seg := jpeg[pos : pos+n]
+		switch {
+		case seg[1] == 0xe0 && jfif == nil && rest == nil:
+			jfif = seg
+		case seg[1] == 0xe1 && bytes.HasPrefix(seg[4:], exifHeader):
+			// replaced
+		default:
+			rest = append(rest, seg...)
+		}
+		pos += n
+	}
+
+	out := make([]byte, 0, len(jpeg)+len(exif)+10)
+	out = append(out, 0xff, 0xd8)
+	out = append(out, jfif...)
+	out = append(out, 0xff, 0xe1)
+	out = binary.BigEndian.AppendUint16(out, uint16(2+len(exifHeader)+len(exif)))
+	out = append(out, exifHeader...)
+	out = append(out, exif...)
+	out = append(out, rest...)
+	return append(out, jpeg[pos:]...), nil
+}
+
+// writeExif inserts EXIF data into a JPEG file.  See insertExif.
+// Returns nil on success or error.
+func writeExif(filename string, exif []byte) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if data, err = insertExif(data, exif); err != nil {
+		return fmt.Errorf("inserting EXIF data into %s: %w", filename, err)
+	}
+	return os.WriteFile(filename, data, 0644)
+}
@@ -0,0 +1,218 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// readJpegExif reads the IFDs of the EXIF APP1 segment of a JPEG file.
+func readJpegExif(t *testing.T, name string) []*tiff.IFD {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("Error reading %s: %v\n", name, err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("Error decoding %s: %v\n", name, err)
+	}
+
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xff; {
+		n := 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if data[pos+1] == 0xe1 && bytes.HasPrefix(data[pos+4:], exifHeader) {
+			ifds, err := tiff.ReadAll(bytes.NewReader(data[pos+4+len(exifHeader) : pos+n]))
+			if err != nil {
+				t.Fatalf("Error reading EXIF data of %s: %v\n", name, err)
+			}
+			return ifds
+		}
+		pos += n
+	}
+	t.Fatalf("No EXIF data in %s\n", name)
+	return nil
+}
+
+// findExifEntry finds the first entry with a tag in IFDs of a kind.
+func findExifEntry(ifds []*tiff.IFD, kind tiff.Kind, tag uint16) *tiff.Entry {
+	for _, ifd := range ifds {
+		if ifd.Kind == kind {
+			if e := ifd.Find(tag); e != nil {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+func TestPreserveExifCopied(t *testing.T) {
+	setupCr2()
+
+	cr2, err := gCr2Parser.ProcessFile(&RawFileInfo{File: TestCR2File, DestDir: t.TempDir(), Quality: 50, PreserveExif: true})
+	if err != nil {
+		t.Fatalf("Unexpected error processing CR2: %v\n", err)
+	}
+
+	ifds := readJpegExif(t, cr2.JpegPath)
+	if e := findExifEntry(ifds, tiff.KindExif, 0x9003); e == nil {
+		t.Error("Missing DateTimeOriginal")
+	} else if s, _ := e.ASCII(); s != "2009:03:07 18:28:10" {
+		t.Errorf("Unexpected DateTimeOriginal: %q\n", s)
+	}
+	for _, tag := range []uint16{0x010f, 0x0110, 0x0112} {
+		if findExifEntry(ifds, tiff.KindMain, tag) == nil {
+			t.Errorf("Missing tag 0x%04x\n", tag)
+		}
+	}
+	for _, tag := range []uint16{0x0100, 0x0111, 0x927c} {
+		if findExifEntry(ifds, tiff.KindMain, tag) != nil || findExifEntry(ifds, tiff.KindExif, tag) != nil {
+			t.Errorf("Unexpected tag 0x%04x\n", tag)
+		}
+	}
+	hasGPS := false
+	for _, ifd := range ifds {
+		hasGPS = hasGPS || ifd.Kind == tiff.KindGPS
+	}
+	if !hasGPS {
+		t.Error("Missing GPS IFD")
+	}
+}
+
+func TestPreserveExifSynthesized(t *testing.T) {
+	path, dir := writeTestFile(t, "test.CRW", buildTestCrw(t))
+	p, _ := NewCrwParser(isHostLittleEndian())
+
+	crw, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75, PreserveExif: true})
+	if err != nil {
+		t.Fatalf("Unexpected error processing CRW: %v\n", err)
+	}
+
+	ifds := readJpegExif(t, crw.JpegPath)
+	if e := findExifEntry(ifds, tiff.KindExif, 0x9003); e == nil {
+		t.Error("Missing DateTimeOriginal")
+	} else if s, _ := e.ASCII(); s != crw.CreateDate.Format("2006:01:02 15:04:05") {
+		t.Errorf("Unexpected DateTimeOriginal: %q\n", s)
+	}
+	if e := findExifEntry(ifds, tiff.KindMain, 0x0112); e == nil {
+		t.Error("Missing Orientation")
+	} else if o, _ := e.Uint(); o != 8 {
+		t.Errorf("Unexpected Orientation: %d\n", o)
+	}
+}
+
+func TestInsertExif(t *testing.T) {
+	app0 := []byte{0xff, 0xe0, 0, 4, 'J', 'F'}
+	oldExif := append([]byte{0xff, 0xe1, 0, 8}, exifHeader...)
+	app2 := []byte{0xff, 0xe2, 0, 3, 'x'}
+	rest := []byte{0xff, 0xdb, 0xff, 0xd9}
+
+	var src []byte
+	for _, b := range [][]byte{{0xff, 0xd8}, app0, oldExif, app2, rest} {
+		src = append(src, b...)
+	}
+
+	got, err := insertExif(src, []byte("TIFF"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	var want []byte
+	newExif := append(append([]byte{0xff, 0xe1, 0, 12}, exifHeader...), "TIFF"...)
+	for _, b := range [][]byte{{0xff, 0xd8}, app0, newExif, app2, rest} {
+		want = append(want, b...)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Unexpected JPEG: % x\n", got)
+	}
+
+	if _, err := insertExif([]byte("GIF89a"), nil); err == nil {
+		t.Error("Expected error for non-JPEG data")
+	}
+	if _, err := insertExif(src, make([]byte, maxExifSize+1)); err == nil {
+		t.Error("Expected error for oversized EXIF data")
+	}
+}
+
+func TestArtistCopyright(t *testing.T) {
+	for _, tc := range []struct {
+		file, parser, artist, copyright string
+	}{
+		{TestNefFile, NefParserKey, "JEREMY TORRES", ""},
+		{TestCR2File, Cr2ParserKey, "Photographer: Jeremy T. Torres", "Copyright: 2009 Jeremy T. Torres All Rights Reserved"},
+	} {
+		r, err := NewFormatParser(tc.parser).ProcessFile(&RawFileInfo{File: tc.file, SkipExtraction: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		if r.Artist != tc.artist || r.Copyright != tc.copyright {
+			t.Errorf("%s: unexpected artist and copyright: %q %q\n", tc.file, r.Artist, r.Copyright)
+		}
+	}
+}
+
+func TestStampCopyright(t *testing.T) {
+	const artist, copyright = "Agency Photographer", "(c) 2026 Agency"
+	ascii := func(ifds []*tiff.IFD, tag uint16) string {
+		e := findExifEntry(ifds, tiff.KindMain, tag)
+		if e == nil {
+			return ""
+		}
+		s, _ := e.ASCII()
+		return s
+	}
+
+	crwPath, crwDir := writeTestFile(t, "test.CRW", buildTestCrw(t))
+	for _, tc := range []struct {
+		name     string
+		info     *RawFileInfo
+		preserve bool
+	}{
+		{"CR2", &RawFileInfo{File: TestCR2File, PreserveExif: true}, true},
+		{"CR2 stamp only", &RawFileInfo{File: TestCR2File}, false},
+		{"CRW", &RawFileInfo{File: crwPath, DestDir: crwDir, PreserveExif: true}, true},
+	} {
+		info := tc.info
+		if info.DestDir == "" {
+			info.DestDir = t.TempDir()
+		}
+		info.Quality, info.Artist, info.Copyright = 75, artist, copyright
+		r, err := NewFormatParser(filepath.Ext(info.File)).ProcessFile(info)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v\n", tc.name, err)
+		}
+
+		ifds := readJpegExif(t, r.JpegPath)
+		if a, c := ascii(ifds, 0x013b), ascii(ifds, 0x8298); a != artist || c != copyright {
+			t.Errorf("%s: unexpected stamped artist and copyright: %q %q\n", tc.name, a, c)
+		}
+		if hasOrientation := findExifEntry(ifds, tiff.KindMain, 0x0112) != nil; hasOrientation != tc.preserve {
+			t.Errorf("%s: expected the orientation only if the EXIF metadata is preserved\n", tc.name)
+		}
+	}
+}
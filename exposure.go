@@ -0,0 +1,334 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Exposure is a struct representing the exposure settings a photo was taken
+// with.  Fields not recorded by the camera are zero.
+type Exposure struct {
+	// Program is the EXIF ExposureProgram, e.g., aperture priority.
+	Program ExposureProgram `json:"program,omitempty"`
+
+	// MeteringMode is the EXIF MeteringMode, e.g., spot.
+	MeteringMode MeteringMode `json:"meteringMode,omitempty"`
+
+	// Mode is the EXIF ExposureMode, e.g., auto bracket.
+	Mode ExposureMode `json:"mode,omitempty"`
+
+	// Flash is the EXIF Flash: whether the flash fired, and its mode.
+	Flash Flash `json:"flash,omitempty"`
+
+	// Compensation is the EXIF ExposureBiasValue, in EV.
+	Compensation float64 `json:"compensation,omitempty"`
+
+	// FlashCompensation is the flash exposure compensation of the maker
+	// note of Canon and Nikon cameras, in EV.
+	FlashCompensation float64 `json:"flashCompensation,omitempty"`
+}
+
+// ExposureProgram is the exposure program of the camera, as recorded by
+// the EXIF ExposureProgram.
+type ExposureProgram uint16
+
+const (
+	ProgramUnknown          ExposureProgram = iota // not defined
+	ProgramManual                                  // manual
+	ProgramNormal                                  // program AE
+	ProgramAperturePriority                        // aperture priority AE
+	ProgramShutterPriority                         // shutter priority AE
+	ProgramCreative                                // biased toward depth of field
+	ProgramAction                                  // biased toward fast shutter speed
+	ProgramPortrait                                // closeup, background out of focus
+	ProgramLandscape                               // background in focus
+)
+
+// String returns the name of the exposure program, e.g.,
+// "Aperture priority".
+func (p ExposureProgram) String() string {
+	switch p {
+	case ProgramUnknown:
+		return "Unknown"
+	case ProgramManual:
+		return "Manual"
+	case ProgramNormal:
+		return "Program AE"
+	case ProgramAperturePriority:
+		return "Aperture priority"
+	case ProgramShutterPriority:
+		return "Shutter priority"
+	case ProgramCreative:
+		return "Creative"
+	case ProgramAction:
+		return "Action"
+	case ProgramPortrait:
+		return "Portrait"
+	case ProgramLandscape:
+		return "Landscape"
+	}
+	return fmt.Sprintf("ExposureProgram(%d)", int(p))
+}
+
+// MarshalText encodes the exposure program by name.
+func (p ExposureProgram) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// MeteringMode is the metering mode of the camera, as recorded by the EXIF
+// MeteringMode.
+type MeteringMode uint16
+
+const (
+	MeteringUnknown               MeteringMode = iota
+	MeteringAverage                            // average
+	MeteringCenterWeightedAverage              // center-weighted average
+	MeteringSpot                               // spot
+	MeteringMultiSpot                          // multi-spot
+	MeteringPattern                            // multi-segment, e.g., Nikon matrix
+	MeteringPartial                            // partial, e.g., Canon partial
+	MeteringOther                 MeteringMode = 255
+)
+
+// String returns the name of the metering mode, e.g.,
+// "Center-weighted average".
+func (m MeteringMode) String() string {
+	switch m {
+	case MeteringUnknown:
+		return "Unknown"
+	case MeteringAverage:
+		return "Average"
+	case MeteringCenterWeightedAverage:
+		return "Center-weighted average"
+	case MeteringSpot:
+		return "Spot"
+	case MeteringMultiSpot:
+		return "Multi-spot"
+	case MeteringPattern:
+		return "Multi-segment"
+	case MeteringPartial:
+		return "Partial"
+	case MeteringOther:
+		return "Other"
+	}
+	return fmt.Sprintf("MeteringMode(%d)", int(m))
+}
+
+// MarshalText encodes the metering mode by name.
+func (m MeteringMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// ExposureMode is the exposure mode of the camera, as recorded by the EXIF
+// ExposureMode.  The EXIF value is offset by one, so that the zero value
+// is ExposureModeUnknown rather than auto exposure.
+type ExposureMode uint16
+
+const (
+	ExposureModeUnknown     ExposureMode = iota // not recorded
+	ExposureModeAuto                            // auto exposure
+	ExposureModeManual                          // manual exposure
+	ExposureModeAutoBracket                     // auto bracket
+)
+
+// String returns the name of the exposure mode, e.g., "Auto bracket".
+func (m ExposureMode) String() string {
+	switch m {
+	case ExposureModeUnknown:
+		return "Unknown"
+	case ExposureModeAuto:
+		return "Auto"
+	case ExposureModeManual:
+		return "Manual"
+	case ExposureModeAutoBracket:
+		return "Auto bracket"
+	}
+	return fmt.Sprintf("ExposureMode(%d)", int(m))
+}
+
+// MarshalText encodes the exposure mode by name.
+func (m ExposureMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// Flash is the status of the flash, as recorded by the EXIF Flash: a set of
+// bit fields.
+type Flash uint16
+
+// FlashMode is the mode of the flash, bits 3-4 of the EXIF Flash.
+type FlashMode uint16
+
+const (
+	FlashModeUnknown    FlashMode = iota
+	FlashModeCompulsory           // fired by the camera regardless of the light
+	FlashModeSuppressed           // off, whatever the light
+	FlashModeAuto                 // fired if the light is low
+)
+
+// Fired determines if the flash fired.
+// Returns true if the flash fired; false otherwise.
+func (f Flash) Fired() bool {
+	return f&0x01 != 0
+}
+
+// Mode returns the mode of the flash.
+func (f Flash) Mode() FlashMode {
+	return FlashMode(f>>3) & 0x03
+}
+
+// ReturnDetected determines if the strobe return light was detected.
+// Returns true if detected; false if not detected or not recorded.
+func (f Flash) ReturnDetected() bool {
+	return (f>>1)&0x03 == 3
+}
+
+// RedEyeReduction determines if the red-eye reduction of the flash is on.
+// Returns true if on; false otherwise.
+func (f Flash) RedEyeReduction() bool {
+	return f&0x40 != 0
+}
+
+// NoFlashFunction determines if the camera has no flash.
+// Returns true if the camera has no flash; false otherwise.
+func (f Flash) NoFlashFunction() bool {
+	return f&0x20 != 0
+}
+
+// String returns a description of the flash status, e.g.,
+// "Auto, Fired, Red-eye reduction" or "Off, Did not fire".
+func (f Flash) String() string {
+	if f.NoFlashFunction() {
+		return "No flash function"
+	}
+
+	var parts []string
+	switch f.Mode() {
+	case FlashModeCompulsory:
+		parts = append(parts, "On")
+	case FlashModeSuppressed:
+		parts = append(parts, "Off")
+	case FlashModeAuto:
+		parts = append(parts, "Auto")
+	}
+	if f.Fired() {
+		parts = append(parts, "Fired")
+	} else {
+		parts = append(parts, "Did not fire")
+	}
+	switch (f >> 1) & 0x03 {
+	case 2:
+		parts = append(parts, "Return not detected")
+	case 3:
+		parts = append(parts, "Return detected")
+	}
+	if f.RedEyeReduction() {
+		parts = append(parts, "Red-eye reduction")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// MarshalText encodes the flash status by its description.
+func (f Flash) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// processExposureEntry records the exposure tags of the EXIF IFD
+// (ExposureProgram, MeteringMode, Flash, ExposureMode and
+// ExposureBiasValue).  Errors are not fatal as the tags are optional.
+func processExposureEntry(entry *IfdEntry, m *rawMetadata) {
+	e := &m.exposure
+
+	switch entry.tag {
+	case 0x8822: // ExposureProgram
+		if v, err := entry.Uint32(); err == nil {
+			e.Program = ExposureProgram(v)
+		}
+	case 0x9207: // MeteringMode
+		if v, err := entry.Uint32(); err == nil {
+			e.MeteringMode = MeteringMode(v)
+		}
+	case 0x9209: // Flash
+		if v, err := entry.Uint32(); err == nil {
+			e.Flash = Flash(v)
+		}
+	case 0xa402: // ExposureMode
+		if v, err := entry.Uint32(); err == nil {
+			e.Mode = ExposureMode(v + 1)
+		}
+	case 0x9204: // ExposureBiasValue
+		if ev, err := readSignedRational(entry); err == nil {
+			e.Compensation = ev
+		}
+	}
+}
+
+// readSignedRational reads the value of an SRATIONAL entry of count 1.
+// Returns the value or error.
+func readSignedRational(entry *IfdEntry) (float64, error) {
+	if entry.fieldType != 10 || entry.count != 1 {
+		return 0, fmt.Errorf("signed rational of type %d and count %d", entry.fieldType, entry.count)
+	}
+	b, err := entry.value(1, 8)
+	if err != nil {
+		return 0, err
+	}
+	num, den := int32(entry.order.Uint32(b)), int32(entry.order.Uint32(b[4:]))
+	if den == 0 {
+		return 0, fmt.Errorf("signed rational %d/0", num)
+	}
+	return float64(num) / float64(den), nil
+}
+
+// nikonFlashCompensation converts the FlashExposureComp of a Nikon maker
+// note, 4 bytes of which the first 3 are a signed factor and a fraction,
+// into EV.
+// Returns the compensation; 0 if invalid.
+func nikonFlashCompensation(b []byte) float64 {
+	if len(b) < 3 || b[2] == 0 {
+		return 0
+	}
+	return float64(int8(b[0])) * float64(b[1]) / float64(b[2])
+}
+
+// canonEv converts an exposure value of a Canon maker note, in 1/32 EV
+// with thirds encoded as 0x0c and 0x14, into EV.
+// Returns the exposure value.
+func canonEv(v int16) float64 {
+	sign := 1.0
+	val := int(v)
+	if val < 0 {
+		sign, val = -1, -val
+	}
+
+	frac := float64(val & 0x1f)
+	switch val & 0x1f {
+	case 0x0c:
+		frac = 32.0 / 3
+	case 0x14:
+		frac = 64.0 / 3
+	}
+	return sign * (float64(val&^0x1f) + frac) / 32
+}
@@ -0,0 +1,152 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFlashString(t *testing.T) {
+	tests := []struct {
+		flash Flash
+		want  string
+		fired bool
+	}{
+		{0x00, "Did not fire", false},
+		{0x01, "Fired", true},
+		{0x10, "Off, Did not fire", false},
+		{0x19, "Auto, Fired", true},
+		{0x0f, "On, Fired, Return detected", true},
+		{0x59, "Auto, Fired, Red-eye reduction", true},
+		{0x20, "No flash function", false},
+	}
+	for _, test := range tests {
+		if got := test.flash.String(); got != test.want || test.flash.Fired() != test.fired {
+			t.Errorf("Unexpected flash 0x%02x: %q %v\n", uint16(test.flash), got, test.flash.Fired())
+		}
+	}
+	if f := Flash(0x19); f.Mode() != FlashModeAuto || f.ReturnDetected() || f.RedEyeReduction() {
+		t.Errorf("Unexpected flash fields: %v\n", f)
+	}
+}
+
+func TestExposureEnumStrings(t *testing.T) {
+	if s := ProgramAperturePriority.String(); s != "Aperture priority" {
+		t.Errorf("Unexpected program: %s\n", s)
+	}
+	if s := MeteringOther.String(); s != "Other" {
+		t.Errorf("Unexpected metering mode: %s\n", s)
+	}
+	if s := MeteringMode(7).String(); s != "MeteringMode(7)" {
+		t.Errorf("Unexpected metering mode: %s\n", s)
+	}
+	if s := ExposureModeAutoBracket.String(); s != "Auto bracket" {
+		t.Errorf("Unexpected exposure mode: %s\n", s)
+	}
+}
+
+func TestMakerNoteFlashCompensation(t *testing.T) {
+	if ev := nikonFlashCompensation([]byte{0xfa, 1, 6, 0}); ev != -1 {
+		t.Errorf("Unexpected Nikon flash compensation: %v\n", ev)
+	}
+	if ev := nikonFlashCompensation([]byte{3, 1, 0, 0}); ev != 0 {
+		t.Errorf("Unexpected Nikon flash compensation: %v\n", ev)
+	}
+
+	tests := []struct {
+		v    int16
+		want float64
+	}{
+		{0, 0},
+		{0x20, 1},
+		{0x2c, 1 + 1.0/3},
+		{-0x14, -2.0 / 3},
+		{0x10, 0.5},
+	}
+	for _, test := range tests {
+		if got := canonEv(test.v); got != test.want {
+			t.Errorf("Unexpected Canon EV of 0x%x: %v\n", test.v, got)
+		}
+	}
+}
+
+func TestProcessFileExposure(t *testing.T) {
+	setupNef()
+	setupCr2()
+
+	nef, err := gNefParser.ProcessFile(&RawFileInfo{File: TestNefFile, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error processing NEF: %v\n", err)
+	}
+	want := Exposure{Program: ProgramAperturePriority, MeteringMode: MeteringPattern, Mode: ExposureModeAuto}
+	if nef.Exposure != want {
+		t.Errorf("Unexpected NEF exposure: %+v\n", nef.Exposure)
+	}
+
+	cr2, err := gCr2Parser.ProcessFile(&RawFileInfo{File: TestCR2File, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error processing CR2: %v\n", err)
+	}
+	e := cr2.Exposure
+	if e.Program != ProgramManual || e.Mode != ExposureModeManual || !e.Flash.Fired() || e.FlashCompensation != -1.0/3 {
+		t.Errorf("Unexpected CR2 exposure: %+v\n", e)
+	}
+
+	data, _ := json.Marshal(cr2)
+	if !strings.Contains(string(data), `"program":"Manual"`) || !strings.Contains(string(data), `"flash":"On, Fired"`) {
+		t.Errorf("Unexpected JSON: %s\n", data)
+	}
+}
+
+func TestProcessExifExposure(t *testing.T) {
+	tt := newTestTiff(false)
+	preview := testJpeg(t, 64, 48)
+	exif := tt.addIfd(0,
+		shortEntry(0x8822, 3),
+		testEntry{tag: 0x9204, fieldType: 10, values: []uint32{0xfffffffe, 3}}, // -2/3
+		shortEntry(0x9207, 3),
+		shortEntry(0x9209, 0x19),
+		shortEntry(0xa402, 2))
+	ifd0 := tt.addIfd(0,
+		longEntry(0x0201, tt.addBlob(preview)),
+		longEntry(0x0202, uint32(len(preview))),
+		longEntry(0x8769, exif))
+	path, _ := writeTestFile(t, "exposure.NRW", tt.bytes(ifd0))
+
+	p, _ := NewNrwParser(isHostLittleEndian())
+	r, err := p.ProcessFile(&RawFileInfo{File: path, SkipExtraction: true, Lenient: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	want := Exposure{Program: ProgramAperturePriority, MeteringMode: MeteringSpot,
+		Mode: ExposureModeAutoBracket, Flash: 0x19, Compensation: -2.0 / 3}
+	if r.Exposure != want {
+		t.Errorf("Unexpected exposure: %+v\n", r.Exposure)
+	}
+	if r.TagStats.Unknown != 0 {
+		t.Errorf("Unexpected unknown tags: %+v\n", r.TagStats)
+	}
+}
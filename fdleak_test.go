@@ -0,0 +1,179 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+)
+
+// openFdCount counts the open file descriptors of the test process.
+// Returns the count or false if unsupported on the host.
+func openFdCount() (int, bool) {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, false
+	}
+	return len(fds), true
+}
+
+func TestProcessFileErrorPathsCloseFiles(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("file descriptor counting requires /proc")
+	}
+
+	// a file that opens but fails header processing
+	truncated, dir := writeTestFile(t, "truncated.raw", []byte{'M', 'M', 0})
+	// a file whose IFD0 offset is beyond the end of file
+	badIfd, _ := writeTestFile(t, "badifd.raw", []byte{'I', 'I', 42, 0, 0xFF, 0xFF, 0, 0})
+	// a NEF without an embedded jpeg
+	noJpeg, _ := writeTestFile(t, "nojpeg.raw", buildNoJpegNef())
+
+	newParsers := []func(bool) (RawParser, string){
+		NewNefParser, NewCr2Parser, NewNrwParser, NewCrwParser,
+		NewRwlParser, NewThreeFrParser, NewIiqParser, NewDngParser, NewGprParser,
+		NewDcrParser, NewKdcParser, NewErfParser, NewFffParser, NewMosParser,
+	}
+
+	// warm up: lazily-opened descriptors (e.g., logging) are not leaks
+	for _, newParser := range newParsers {
+		p, _ := newParser(isHostLittleEndian())
+		p.ProcessFile(&RawFileInfo{File: truncated, DestDir: dir, Quality: 50})
+	}
+
+	before, ok := openFdCount()
+	if !ok {
+		t.Skip("unable to count file descriptors")
+	}
+
+	const iterations = 1000
+	for _, newParser := range newParsers {
+		p, key := newParser(isHostLittleEndian())
+		for i := 0; i < iterations; i++ {
+			for _, file := range []string{truncated, badIfd, noJpeg} {
+				if _, err := p.ProcessFile(&RawFileInfo{File: file, DestDir: dir, Quality: 50}); err == nil {
+					t.Fatalf("%s: expected error processing %s\n", key, file)
+				}
+			}
+		}
+	}
+
+	after, _ := openFdCount()
+	if after > before {
+		t.Fatalf("File descriptors leaked: %d before, %d after\n", before, after)
+	}
+	t.Logf("File descriptors: %d before, %d after\n", before, after)
+}
+
+func TestProcessFileSuccessClosesFile(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("file descriptor counting requires /proc")
+	}
+
+	setupNef()
+	dir := t.TempDir() + string(os.PathSeparator)
+
+	before, ok := openFdCount()
+	if !ok {
+		t.Skip("unable to count file descriptors")
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := gNefParser.ProcessFile(&RawFileInfo{File: TestNefFile, DestDir: dir, Quality: 50}); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+	}
+
+	if after, _ := openFdCount(); after > before {
+		t.Fatalf("File descriptors leaked: %d before, %d after\n", before, after)
+	}
+}
+
+func TestEntryPointsCloseFiles(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("file descriptor counting requires /proc")
+	}
+
+	setupNef()
+	dir := t.TempDir() + string(os.PathSeparator)
+	truncated, _ := writeTestFile(t, "truncated.NEF", []byte{'M', 'M', 0})
+	r, err := gNefParser.ProcessFile(&RawFileInfo{File: TestNefFile, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	// each is called with a raw file that is processed and one that fails
+	entryPoints := map[string]func(file string){
+		"DecodePreview":    func(file string) { DecodePreview(&RawFileInfo{File: file}) },
+		"DecodeSmallImage": func(file string) { DecodeSmallImage(&RawFileInfo{File: file}) },
+		"DumpIFDs":         func(file string) { DumpIFDs(&RawFileInfo{File: file}) },
+		"ExifData":         func(file string) { ExifData(&RawFileInfo{File: file}) },
+		"PreviewOnly":      func(file string) { PreviewOnly(&RawFileInfo{File: file, DestDir: dir}, 0) },
+		"Extract": func(file string) {
+			r.Extract(&RawFileInfo{File: file, DestDir: dir, Quality: 50, Overwrite: RenameWithSuffix})
+		},
+		"ExtractJpegTo": func(file string) { r.ExtractJpegTo(io.Discard, &RawFileInfo{File: file}) },
+	}
+	for _, fn := range entryPoints {
+		fn(TestCR2File)
+	}
+
+	before, ok := openFdCount()
+	if !ok {
+		t.Skip("unable to count file descriptors")
+	}
+	for name, fn := range entryPoints {
+		for _, file := range []string{TestNefFile, TestCR2File, truncated, dir + "missing.NEF"} {
+			fn(file)
+		}
+		if after, _ := openFdCount(); after > before {
+			t.Fatalf("%s: file descriptors leaked: %d before, %d after\n", name, before, after)
+		}
+	}
+}
+
+func TestCallerHandleNotClosed(t *testing.T) {
+	setupNef()
+	f, err := os.Open(TestNefFile)
+	if err != nil {
+		t.Fatalf("Unable to open test NEF file: %v\n", err)
+	}
+	defer f.Close()
+
+	r, err := gNefParser.ProcessFile(&RawFileInfo{File: TestNefFile, Handle: f, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if _, err := r.DecodePreview(&RawFileInfo{Handle: f}); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	// the caller retains ownership of the handle
+	if _, err := f.Stat(); err != nil {
+		t.Errorf("Expected the handle to remain open; got %v\n", err)
+	}
+}
@@ -0,0 +1,266 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownFormat is returned when a raw file matches no registered
+// format.
+var ErrUnknownFormat = errors.New("unknown raw file format")
+
+// format is a registered raw file format.
+type format struct {
+	key     string
+	magic   []byte
+	factory func() RawParser
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   = make(map[string]*format)
+)
+
+func init() {
+	le := hostIsLittleEndian()
+	builtin := func(newParser func(bool) (RawParser, string), magic []byte) {
+		_, key := newParser(le)
+		RegisterFormat(key, magic, func() RawParser {
+			p, _ := newParser(le)
+			return p
+		})
+	}
+
+	builtin(NewNefParser, nil)
+	builtin(NewNrwParser, nil)
+	builtin(NewCr2Parser, []byte("II*\x00\x10\x00\x00\x00CR"))
+	builtin(NewCrwParser, []byte("II\x1a\x00\x00\x00HEAPCCDR"))
+	builtin(NewRwlParser, nil)
+	builtin(NewThreeFrParser, nil)
+	builtin(NewIiqParser, nil)
+	builtin(NewDngParser, nil)
+	builtin(NewGprParser, nil)
+	builtin(NewDcrParser, nil)
+	builtin(NewKdcParser, nil)
+	builtin(NewErfParser, nil)
+	builtin(NewFffParser, nil)
+	builtin(NewMosParser, nil)
+}
+
+// RegisterFormat makes a raw file format available by key, the upper-case
+// file extension of the format (e.g., "NEF").  The magic bytes identify
+// the format by the start of the file; an empty magic registers a format
+// identified by its file extension only (e.g., the TIFF-based formats that
+// share a header).  The factory returns a new parser for the format.
+// Third-party packages typically call RegisterFormat from an init
+// function.
+// If RegisterFormat is called twice with the same key or if factory is nil,
+// it panics.
+func RegisterFormat(key string, magic []byte, factory func() RawParser) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	key = strings.ToUpper(key)
+	if factory == nil {
+		panic("rawparser: RegisterFormat factory is nil")
+	}
+	if _, dup := formats[key]; dup {
+		panic("rawparser: RegisterFormat called twice for format " + key)
+	}
+	formats[key] = &format{key, append([]byte(nil), magic...), factory}
+}
+
+// Formats returns a sorted list of the keys of the registered formats.
+func Formats() []string {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	keys := make([]string, 0, len(formats))
+	for key := range formats {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// NewFormatParser creates a parser for a registered format.  The key is
+// case-insensitive; a file extension, with or without the leading dot, is
+// accepted.
+// Returns a new RawParser or nil if the format is not registered.
+func NewFormatParser(key string) RawParser {
+	formatsMu.RLock()
+	f := formats[strings.ToUpper(strings.TrimPrefix(key, "."))]
+	formatsMu.RUnlock()
+
+	if f == nil {
+		return nil
+	}
+	return f.factory()
+}
+
+// isRegisteredFormat returns true if a format is registered for a file
+// extension.
+func isRegisteredFormat(ext string) bool {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	_, ok := formats[strings.ToUpper(strings.TrimPrefix(ext, "."))]
+	return ok
+}
+
+// SniffFormat identifies the format of a raw file by the magic bytes at the
+// start of the file.  If multiple formats match, the format with the
+// longest magic is selected.
+// Returns the key of the format or error wrapping ErrUnknownFormat.
+func SniffFormat(r io.ReaderAt) (string, error) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	maxLen := 0
+	for _, f := range formats {
+		if len(f.magic) > maxLen {
+			maxLen = len(f.magic)
+		}
+	}
+
+	header := make([]byte, maxLen)
+	n, err := r.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	header = header[:n]
+
+	var match *format
+	for _, f := range formats {
+		if len(f.magic) == 0 || !bytes.HasPrefix(header, f.magic) {
+			continue
+		}
+		if match == nil || len(f.magic) > len(match.magic) ||
+			(len(f.magic) == len(match.magic) && f.key < match.key) {
+			match = f
+		}
+	}
+
+	if match == nil {
+		return "", fmt.Errorf("%w: header % x", ErrUnknownFormat, header)
+	}
+	return match.key, nil
+}
+
+// RegisterFormats maps a new parser for each registered format to its key.
+func (p *RawParsers) RegisterFormats() {
+	for _, key := range Formats() {
+		p.Register(key, NewFormatParser(key))
+	}
+}
+
+// Capabilities is a struct defining the operations supported for a raw
+// file format.
+type Capabilities struct {
+	// PreviewExtraction is true if the embedded preview is extracted.
+	PreviewExtraction bool `json:"previewExtraction"`
+
+	// RawDecode is true if the raw image data is decoded.
+	RawDecode bool `json:"rawDecode"`
+
+	// Write is true if the tags of the raw file may be rewritten; see
+	// UpdateTags.
+	Write bool `json:"write"`
+}
+
+// CapabilityReporter is implemented by RawParsers reporting the
+// capabilities of their format.  A RawParser not implementing it is
+// assumed to support PreviewExtraction only.
+type CapabilityReporter interface {
+	// Capabilities returns the operations supported for the format.
+	Capabilities() Capabilities
+}
+
+// FormatInfo is a struct describing a raw file format supported by a
+// RawParsers, e.g., to populate the file filters of a file dialog.
+type FormatInfo struct {
+	// Key is the key of the RawParser, e.g., "NEF".
+	Key string `json:"key"`
+
+	// Extensions are the lower-case file extensions of the format,
+	// including the leading dot, e.g., ".nef".
+	Extensions []string `json:"extensions"`
+
+	// Magic are the magic signatures identifying the format by the start
+	// of the file; empty if the format is identified by its file
+	// extension only.  See RegisterFormat.
+	Magic [][]byte `json:"magic,omitempty"`
+
+	Capabilities
+}
+
+// SupportedFormats describes the formats of the registered parsers.
+// Returns the formats, sorted by key.
+func (p RawParsers) SupportedFormats() []FormatInfo {
+	infos := make([]FormatInfo, 0, len(p.parserMap))
+	for key, parser := range p.parserMap {
+		info := FormatInfo{
+			Key:          key,
+			Extensions:   []string{"." + strings.ToLower(key)},
+			Capabilities: Capabilities{PreviewExtraction: true},
+		}
+		if magic := formatMagic(key); len(magic) > 0 {
+			info.Magic = [][]byte{magic}
+		}
+		if reporter, ok := parser.(CapabilityReporter); ok {
+			info.Capabilities = reporter.Capabilities()
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos
+}
+
+// formatMagic looks up the magic bytes of a registered format.
+// Returns a copy of the magic bytes; nil if the format is not registered
+// or has no magic.
+func formatMagic(key string) []byte {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	f := formats[strings.ToUpper(strings.TrimPrefix(key, "."))]
+	if f == nil || len(f.magic) == 0 {
+		return nil
+	}
+	return append([]byte(nil), f.magic...)
+}
+
+// hostIsLittleEndian determines the endianness of the host.
+// Returns true if the host is a little endian machine; false otherwise.
+func hostIsLittleEndian() bool {
+	return binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+}
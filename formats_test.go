@@ -0,0 +1,145 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+// testFormatParser is a third-party parser for the format registered by the
+// tests.
+type testFormatParser struct {
+	rawParser
+}
+
+func (p *testFormatParser) ProcessFile(info *RawFileInfo) (*RawFile, error) {
+	return &RawFile{FileName: info.File}, nil
+}
+
+func init() {
+	RegisterFormat("xyz", []byte("XYZRAW"), func() RawParser {
+		return &testFormatParser{}
+	})
+}
+
+func TestSniffFormat(t *testing.T) {
+	f, err := os.Open(TestCR2File)
+	if err != nil {
+		t.Fatalf("Error opening %s: %v\n", TestCR2File, err)
+	}
+	defer f.Close()
+
+	key, err := SniffFormat(f)
+	if err != nil || key != Cr2ParserKey {
+		t.Errorf("Unexpected format: %s %v\n", key, err)
+	}
+
+	key, err = SniffFormat(bytes.NewReader([]byte("XYZRAW and then some")))
+	if err != nil || key != "XYZ" {
+		t.Errorf("Unexpected format: %s %v\n", key, err)
+	}
+
+	// TIFF-based formats are identified by extension only
+	_, err = SniffFormat(bytes.NewReader(buildTestNrw(t, true)))
+	if !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Expected ErrUnknownFormat; got %v\n", err)
+	}
+
+	_, err = SniffFormat(bytes.NewReader(nil))
+	if !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Expected ErrUnknownFormat for empty file; got %v\n", err)
+	}
+}
+
+func TestNewFormatParser(t *testing.T) {
+	if p := NewFormatParser(".xyz"); p == nil {
+		t.Error("Third-party parser not found by extension")
+	} else if r, _ := p.ProcessFile(&RawFileInfo{File: "a.xyz"}); r.FileName != "a.xyz" {
+		t.Errorf("Unexpected result from third-party parser: %+v\n", r)
+	}
+
+	if p := NewFormatParser("nef"); p == nil || p.IsHostLittleEndian() != hostIsLittleEndian() {
+		t.Error("Unexpected NEF parser")
+	}
+
+	if NewFormatParser("ABC") != nil {
+		t.Error("Unexpected parser for unregistered format")
+	}
+
+	rp := NewRawParsers()
+	rp.RegisterFormats()
+	for _, key := range []string{NefParserKey, Cr2ParserKey, DngParserKey, "XYZ"} {
+		if rp.GetParser(key) == nil {
+			t.Errorf("Format %s not registered\n", key)
+		}
+	}
+}
+
+func TestRegisterFormatDuplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic registering a duplicate format")
+		}
+	}()
+	RegisterFormat(NefParserKey, nil, func() RawParser { return nil })
+}
+
+func TestSupportedFormats(t *testing.T) {
+	rp := NewRawParsers()
+	rp.RegisterFormats()
+	formats := rp.SupportedFormats()
+	if len(formats) != len(Formats()) {
+		t.Fatalf("Unexpected number of formats: %d\n", len(formats))
+	}
+
+	byKey := make(map[string]FormatInfo)
+	for i, f := range formats {
+		if i > 0 && formats[i-1].Key >= f.Key {
+			t.Errorf("Formats not sorted: %s %s\n", formats[i-1].Key, f.Key)
+		}
+		byKey[f.Key] = f
+	}
+
+	cr2 := byKey[Cr2ParserKey]
+	if len(cr2.Extensions) != 1 || cr2.Extensions[0] != ".cr2" ||
+		len(cr2.Magic) != 1 || !bytes.HasPrefix(cr2.Magic[0], []byte("II*\x00")) {
+		t.Errorf("Unexpected CR2 format: %+v\n", cr2)
+	}
+	if want := (Capabilities{PreviewExtraction: true, Write: true}); cr2.Capabilities != want || byKey[NefParserKey].Capabilities != want {
+		t.Errorf("Unexpected CR2/NEF capabilities: %+v %+v\n", cr2.Capabilities, byKey[NefParserKey].Capabilities)
+	}
+
+	dng := byKey[DngParserKey]
+	if len(dng.Magic) != 0 || dng.Capabilities != (Capabilities{PreviewExtraction: true}) {
+		t.Errorf("Unexpected DNG format: %+v\n", dng)
+	}
+
+	// a third-party parser
+	if xyz := byKey["XYZ"]; xyz.Extensions[0] != ".xyz" || string(xyz.Magic[0]) != "XYZRAW" || !xyz.PreviewExtraction {
+		t.Errorf("Unexpected third-party format: %+v\n", xyz)
+	}
+}
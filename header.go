@@ -0,0 +1,88 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// tiffMagic is the magic value of the TIFF header.
+const tiffMagic = 42
+
+// HeaderError reports a header that does not match the format of the raw
+// file, e.g., a file that is not a raw file but begins with a TIFF byte
+// order mark.  A nonstandard magic value is a recoverable problem: if
+// RawFileInfo.Lenient is set, it is reported as a warning and the file is
+// parsed regardless, e.g., for the slightly nonstandard headers of some
+// vendors (such as the 0x4f52 of Olympus ORF).
+type HeaderError struct {
+	// Field names the header field, e.g., "TIFF magic value".
+	Field string
+
+	// Got and Want are the value of the field and the value expected.
+	Got, Want string
+}
+
+// Error returns the field and its unexpected value.
+func (e *HeaderError) Error() string {
+	return fmt.Sprintf("invalid %s: %s, expected %s", e.Field, e.Got, e.Want)
+}
+
+// Unwrap returns tiff.ErrInvalidHeader.
+func (e *HeaderError) Unwrap() error {
+	return tiff.ErrInvalidHeader
+}
+
+// checkTiffMagic validates the magic value of a TIFF header against those
+// accepted by the format.
+// Returns nil or a *HeaderError.
+func checkTiffMagic(h *tiff.Header, accepted ...uint16) error {
+	want := ""
+	for i, magic := range accepted {
+		if h.Magic == magic {
+			return nil
+		}
+		if i > 0 {
+			want += " or "
+		}
+		want += fmt.Sprintf("0x%x", magic)
+	}
+	return &HeaderError{Field: "TIFF magic value", Got: fmt.Sprintf("0x%x", h.Magic), Want: want}
+}
+
+// lenientHeader determines whether to parse a raw file regardless of the
+// error validating its header, which is the case for a *HeaderError if
+// info.Lenient is set.
+// Returns the *HeaderError to report as a warning once the file is
+// parsed, or nil, and the error to return; nil to parse the file.
+func lenientHeader(info *RawFileInfo, err error) (*HeaderError, error) {
+	var he *HeaderError
+	if err == nil || !info.Lenient || !errors.As(err, &he) {
+		return nil, err
+	}
+	return he, nil
+}
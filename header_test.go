@@ -0,0 +1,94 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// withMagic writes a raw file whose header has the magic value, in the
+// byte order of the file, and the bytes at offset 8 replaced by word, if
+// any.
+func withMagic(t *testing.T, name string, data []byte, magic uint16, word string) string {
+	data = append([]byte(nil), data...)
+	order := binary.ByteOrder(binary.LittleEndian)
+	if data[0] == 'M' {
+		order = binary.BigEndian
+	}
+	order.PutUint16(data[2:], magic)
+	copy(data[8:], word)
+	path, _ := writeTestFile(t, name, data)
+	return path
+}
+
+func TestHeaderMagic(t *testing.T) {
+	nrw := buildTestPhoto(t, "id-a", "v1")
+	cr2, err := os.ReadFile(TestCR2File)
+	if err != nil {
+		t.Fatalf("Error reading %s: %v\n", TestCR2File, err)
+	}
+
+	tests := []struct {
+		name, file string
+		field      string // empty if valid
+	}{
+		{"NEF garbage", withMagic(t, "a.NEF", nrw, 0x1234, ""), "TIFF magic value"},
+		{"NRW garbage", withMagic(t, "a.NRW", nrw, 0x1234, ""), "TIFF magic value"},
+		{"DNG ORF magic", withMagic(t, "a.DNG", nrw, 0x4f52, ""), "TIFF magic value"},
+		{"RWL TIFF magic", withMagic(t, "a.RWL", nrw, tiffMagic, ""), ""},
+		{"CR2 garbage", withMagic(t, "a.CR2", cr2, 0x1234, ""), "TIFF magic value"},
+		{"CR2 magic word", withMagic(t, "b.CR2", cr2, tiffMagic, "XX"), "CR2 magic word"},
+	}
+	for _, tc := range tests {
+		p := NewFormatParser(filepath.Ext(tc.file))
+		r, err := p.ProcessFile(&RawFileInfo{File: tc.file, SkipExtraction: true})
+		if tc.field == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v\n", tc.name, err)
+			}
+			continue
+		}
+		var he *HeaderError
+		if !errors.As(err, &he) || he.Field != tc.field || !errors.Is(err, tiff.ErrInvalidHeader) {
+			t.Errorf("%s: expected a header error of the %s; got %v\n", tc.name, tc.field, err)
+			continue
+		}
+
+		// parsed regardless, with a warning, if lenient
+		r, err = p.ProcessFile(&RawFileInfo{File: tc.file, SkipExtraction: true, Lenient: true})
+		if err != nil || len(r.Images) == 0 {
+			t.Errorf("%s: unexpected lenient result: %+v %v\n", tc.name, r, err)
+			continue
+		}
+		if len(r.Warnings) == 0 || !errors.As(r.Warnings[0], &he) || he.Field != tc.field {
+			t.Errorf("%s: expected a header warning; got %v\n", tc.name, r.Warnings)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// +build heic
+
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+// Note: modify these flags for your environment if required.
+
+// #cgo CFLAGS: -O2
+// #cgo LDFLAGS: -lheif
+// #include <stdlib.h>
+// #include <string.h>
+// #include <libheif/heif.h>
+//
+// typedef struct {
+//     unsigned char *data;
+//     size_t size;
+// } heicBuffer;
+//
+// static struct heif_error writeHeic(struct heif_context *ctx, const void *data,
+//                                    size_t size, void *userdata) {
+//     heicBuffer *buf = userdata;
+//     struct heif_error err = {heif_error_Ok, heif_suberror_Unspecified, "Success"};
+//     buf->data = malloc(size);
+//     if (buf->data == NULL) {
+//         err.code = heif_error_Memory_allocation_error;
+//         err.message = "out of memory";
+//         return err;
+//     }
+//     memcpy(buf->data, data, size);
+//     buf->size = size;
+//     return err;
+// }
+//
+// static int encodeHeic(unsigned char *rgb, int width, int height, int quality,
+//                       unsigned char **out, size_t *outSize) {
+//     struct heif_context *ctx = heif_context_alloc();
+//     struct heif_encoder *encoder = NULL;
+//     struct heif_image *image = NULL;
+//     struct heif_image_handle *handle = NULL;
+//     struct heif_writer writer = {1, writeHeic};
+//     heicBuffer buf = {NULL, 0};
+//     struct heif_error err;
+//     if (ctx == NULL) {
+//         return -1;
+//     }
+//
+//     err = heif_context_get_encoder_for_format(ctx, heif_compression_HEVC, &encoder);
+//     if (err.code == heif_error_Ok) {
+//         err = heif_image_create(width, height, heif_colorspace_RGB,
+//                                 heif_chroma_interleaved_RGB, &image);
+//     }
+//     if (err.code == heif_error_Ok) {
+//         err = heif_image_add_plane(image, heif_channel_interleaved, width, height, 8);
+//     }
+//     if (err.code == heif_error_Ok) {
+//         int stride, y;
+//         uint8_t *plane = heif_image_get_plane(image, heif_channel_interleaved, &stride);
+//         for (y = 0; y < height; y++) {
+//             memcpy(plane + y * stride, rgb + y * width * 3, width * 3);
+//         }
+//         err = heif_encoder_set_lossy_quality(encoder, quality);
+//     }
+//     if (err.code == heif_error_Ok) {
+//         err = heif_context_encode_image(ctx, image, encoder, NULL, &handle);
+//     }
+//     if (err.code == heif_error_Ok) {
+//         err = heif_context_write(ctx, &writer, &buf);
+//     }
+//
+//     if (handle != NULL) {
+//         heif_image_handle_release(handle);
+//     }
+//     if (image != NULL) {
+//         heif_image_release(image);
+//     }
+//     if (encoder != NULL) {
+//         heif_encoder_release(encoder);
+//     }
+//     heif_context_free(ctx);
+//     if (err.code != heif_error_Ok) {
+//         free(buf.data);
+//         return -1;
+//     }
+//     *out = buf.data;
+//     *outSize = buf.size;
+//     return 0;
+// }
+import "C"
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"unsafe"
+)
+
+func init() {
+	registerEncoder(OutputHeic, encodeHeic)
+}
+
+// encodeHeic encodes an image as HEIC using libheif and its HEVC encoder
+// (e.g., x265).
+func encodeHeic(w io.Writer, img image.Image, quality int) error {
+	b := img.Bounds()
+	if b.Empty() {
+		return fmt.Errorf("error encoding HEIC: empty image")
+	}
+	pix := rgbPixels(img)
+
+	var out *C.uchar
+	var outSize C.size_t
+	rc := C.encodeHeic((*C.uchar)(unsafe.Pointer(&pix[0])), C.int(b.Dx()),
+		C.int(b.Dy()), C.int(quality), &out, &outSize)
+	if rc != 0 {
+		return fmt.Errorf("error encoding HEIC")
+	}
+	defer C.free(unsafe.Pointer(out))
+
+	_, err := w.Write(C.GoBytes(unsafe.Pointer(out), C.int(outSize)))
+	return err
+}
@@ -0,0 +1,139 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"image"
+	"image/color"
+	"log"
+)
+
+// Histogram is a struct representing the histograms and clipping
+// statistics of the decoded preview of a raw file; see
+// RawFileInfo.Histogram.  The preview approximates the raw image as
+// rendered by the camera, e.g., to flag blown highlights while culling.
+type Histogram struct {
+	// Luminance counts the pixels of each luma value, from 0 to 255, per
+	// Rec. 601 (0.299 R + 0.587 G + 0.114 B).
+	Luminance [256]int `json:"luminance"`
+
+	// Red, Green, and Blue count the pixels of each channel value.
+	Red   [256]int `json:"red"`
+	Green [256]int `json:"green"`
+	Blue  [256]int `json:"blue"`
+
+	// Pixels is the number of pixels of the preview.
+	Pixels int `json:"pixels"`
+
+	// MeanLuminance is the mean luma, from 0 to 255.
+	MeanLuminance float64 `json:"meanLuminance"`
+
+	// HighlightsClipped is the fraction of pixels with any channel at 255.
+	HighlightsClipped float64 `json:"highlightsClipped"`
+
+	// ShadowsClipped is the fraction of pixels with every channel at 0.
+	ShadowsClipped float64 `json:"shadowsClipped"`
+}
+
+// fillHistogram decodes the embedded jpeg, if info.Histogram is set, and
+// computes its Histogram.  Errors are logged; the histogram is not
+// required to process a raw file.
+func fillHistogram(r *RawFile, info *RawFileInfo, f *rawSource) {
+	if !info.Histogram || r.preview == nil {
+		return
+	}
+
+	j := *r.preview
+	if err := checkPreviewMemory(f, &j, info.MaxPreviewMemory); err != nil {
+		log.Printf("Not computing histogram of '%s': %v\n", r.FileName, err)
+		return
+	}
+	data, err := readPreview(f, &j)
+	if err != nil {
+		log.Printf("Error reading preview of '%s': %v\n", r.FileName, err)
+		return
+	}
+	img, err := decodeJpeg(data)
+	if err != nil {
+		log.Printf("Error computing histogram of '%s': %v\n", r.FileName, err)
+		return
+	}
+	r.Histogram = histogramOf(img)
+}
+
+// histogramOf computes the Histogram of an image.
+// Returns the histogram.
+func histogramOf(img image.Image) *Histogram {
+	h := new(Histogram)
+	var highlights, shadows, sum int
+
+	add := func(r, g, b uint8) {
+		y := (299*int(r) + 587*int(g) + 114*int(b) + 500) / 1000
+		h.Luminance[y]++
+		h.Red[r]++
+		h.Green[g]++
+		h.Blue[b]++
+		sum += y
+		if r == 0xff || g == 0xff || b == 0xff {
+			highlights++
+		}
+		if r|g|b == 0 {
+			shadows++
+		}
+	}
+
+	b := img.Bounds()
+	switch m := img.(type) {
+	case *image.YCbCr:
+		// the common case of the embedded jpeg, without the generic At
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				yi, ci := m.YOffset(x, y), m.COffset(x, y)
+				add(color.YCbCrToRGB(m.Y[yi], m.Cb[ci], m.Cr[ci]))
+			}
+		}
+	case *image.Gray:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for _, v := range m.Pix[m.PixOffset(b.Min.X, y):m.PixOffset(b.Max.X, y)] {
+				add(v, v, v)
+			}
+		}
+	default:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+				add(c.R, c.G, c.B)
+			}
+		}
+	}
+
+	h.Pixels = b.Dx() * b.Dy()
+	if h.Pixels > 0 {
+		n := float64(h.Pixels)
+		h.MeanLuminance = float64(sum) / n
+		h.HighlightsClipped = float64(highlights) / n
+		h.ShadowsClipped = float64(shadows) / n
+	}
+	return h
+}
@@ -0,0 +1,111 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestHistogramOf(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	img.Set(0, 0, color.RGBA{0, 0, 0, 0xff})
+	img.Set(1, 0, color.RGBA{0xff, 0xff, 0xff, 0xff})
+	img.Set(2, 0, color.RGBA{0xff, 0, 0, 0xff})
+	img.Set(3, 0, color.RGBA{100, 100, 100, 0xff})
+
+	h := histogramOf(img)
+	if h.Pixels != 4 {
+		t.Fatalf("Unexpected pixels: %d\n", h.Pixels)
+	}
+	if h.Luminance[0] != 1 || h.Luminance[255] != 1 || h.Luminance[76] != 1 || h.Luminance[100] != 1 {
+		t.Errorf("Unexpected luminance histogram: %v\n", h.Luminance)
+	}
+	if h.Red[255] != 2 || h.Green[255] != 1 || h.Blue[0] != 2 {
+		t.Errorf("Unexpected channel histograms: %d %d %d\n", h.Red[255], h.Green[255], h.Blue[0])
+	}
+	if h.HighlightsClipped != 0.5 || h.ShadowsClipped != 0.25 {
+		t.Errorf("Unexpected clipping: %v %v\n", h.HighlightsClipped, h.ShadowsClipped)
+	}
+	if want := (0 + 255 + 76 + 100) / 4.0; h.MeanLuminance != want {
+		t.Errorf("Unexpected mean luminance: %v; expected %v\n", h.MeanLuminance, want)
+	}
+}
+
+func TestHistogramOfYCbCr(t *testing.T) {
+	img := image.NewYCbCr(image.Rect(0, 0, 8, 8), image.YCbCrSubsampleRatio420)
+	for i := range img.Y {
+		img.Y[i] = 0xff
+	}
+	for i := range img.Cb {
+		img.Cb[i], img.Cr[i] = 0x80, 0x80
+	}
+
+	h := histogramOf(img)
+	if h.Pixels != 64 || h.Luminance[255] != 64 || h.HighlightsClipped != 1 {
+		t.Errorf("Unexpected histogram of white image: %d %d %v\n", h.Pixels, h.Luminance[255], h.HighlightsClipped)
+	}
+
+	g := histogramOf(image.NewGray(image.Rect(0, 0, 3, 2)))
+	if g.Pixels != 6 || g.Luminance[0] != 6 || g.ShadowsClipped != 1 {
+		t.Errorf("Unexpected histogram of black image: %d %d %v\n", g.Pixels, g.Luminance[0], g.ShadowsClipped)
+	}
+}
+
+func TestProcessFileHistogram(t *testing.T) {
+	path, dir := writeTestFile(t, "histogram.NRW", buildTestNrw(t, true))
+	p, _ := NewNrwParser(isHostLittleEndian())
+
+	r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if r.Histogram != nil {
+		t.Errorf("Unexpected histogram without RawFileInfo.Histogram\n")
+	}
+
+	r, err = p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, SkipExtraction: true, Histogram: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if r.Histogram == nil || r.Histogram.Pixels != 320*240 {
+		t.Fatalf("Unexpected histogram: %+v\n", r.Histogram)
+	}
+	n := 0
+	for _, c := range r.Histogram.Luminance {
+		n += c
+	}
+	if n != r.Histogram.Pixels {
+		t.Errorf("Unexpected luminance histogram total: %d\n", n)
+	}
+
+	r.Histogram = nil
+	if _, err := r.Extract(&RawFileInfo{DestDir: dir, Quality: 80, Histogram: true}); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if r.Histogram == nil {
+		t.Errorf("Expected a histogram computed by Extract\n")
+	}
+}
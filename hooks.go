@@ -0,0 +1,93 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"io"
+	"log"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// TagFunc is called with the value of an entry of a TIFF-based raw file,
+// decoded as by tiff.Entry.Value, and the kind of its IFD: the tags of the
+// GPS and interoperability IFDs overlap those of the other IFDs.
+type TagFunc func(kind tiff.Kind, tag uint16, value any)
+
+// TagHooks registers the TagFuncs invoked for the tags of the IFDs of
+// TIFF-based raw files (see RawFileInfo.TagHooks), to read tags the parsers
+// do not expose.  Maker notes are not decoded.  The zero value has no
+// hooks.
+//
+// TagHooks shall not be modified while in use; the TagFuncs of TagHooks
+// shared by concurrent ProcessFile calls, e.g., of a BatchProcessor, are
+// called concurrently.
+type TagHooks struct {
+	funcs map[uint16][]TagFunc
+}
+
+// OnTag registers fn to be called with the value of every entry of a tag.
+// The functions of a tag are called in the order registered.
+func (h *TagHooks) OnTag(tag uint16, fn TagFunc) {
+	if h.funcs == nil {
+		h.funcs = make(map[uint16][]TagFunc)
+	}
+	h.funcs[tag] = append(h.funcs[tag], fn)
+}
+
+// runTagHooks walks the IFDs of a TIFF-based raw file and calls the hooks
+// of the tags of their entries.  Errors are not fatal as the hooks only
+// harvest additional metadata: values that cannot be decoded are logged
+// and skipped.
+func runTagHooks(f io.ReaderAt, hooks *TagHooks) {
+	if hooks == nil || len(hooks.funcs) == 0 {
+		return
+	}
+
+	h, err := tiff.ReadHeader(f)
+	if err != nil {
+		return
+	}
+	err = tiff.WalkIFDs(f, h, func(ifd *tiff.IFD) error {
+		for i := range ifd.Entries {
+			e := &ifd.Entries[i]
+			funcs := hooks.funcs[e.Tag]
+			if len(funcs) == 0 {
+				continue
+			}
+			value, err := e.Value()
+			if err != nil {
+				log.Printf("Error decoding tag 0x%04x: %v\n", e.Tag, err)
+				continue
+			}
+			for _, fn := range funcs {
+				fn(ifd.Kind, e.Tag, value)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error running tag hooks: %v\n", err)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jeremytorres/rawparser/tags"
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+func TestTagHooks(t *testing.T) {
+	var hooks TagHooks
+	var makes []string
+	var kinds []tiff.Kind
+	hooks.OnTag(tags.TagMake, func(kind tiff.Kind, tag uint16, value any) {
+		makes = append(makes, value.(string))
+	})
+	hooks.OnTag(tags.TagExposureTime, func(kind tiff.Kind, tag uint16, value any) {
+		kinds = append(kinds, kind)
+	})
+
+	p, _ := NewNefParser(isHostLittleEndian())
+	r, err := p.ProcessFile(&RawFileInfo{File: TestNefFile, SkipExtraction: true, TagHooks: &hooks})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if len(makes) != 1 || makes[0] != r.CameraModel.Make {
+		t.Errorf("Expected make %q; got %q\n", r.CameraModel.Make, makes)
+	}
+	if len(kinds) != 1 || kinds[0] != tiff.KindExif {
+		t.Errorf("Expected the ExposureTime of the EXIF IFD; got %v\n", kinds)
+	}
+}
+
+func TestTagHooksGps(t *testing.T) {
+	tt := newTestTiff(false)
+	gps := tt.addIfd(0, asciiEntry(tags.TagGPSLatitudeRef, "N"))
+	interop := tt.addIfd(0, asciiEntry(tags.TagInteroperabilityIndex, "R98"))
+	exif := tt.addIfd(0, longEntry(tags.TagInteroperabilityIFD, interop))
+	data := tt.bytes(tt.addIfd(0, longEntry(tags.TagGPSInfoIFD, gps), longEntry(tags.TagExifIFD, exif)))
+
+	// the tags of the GPS and interoperability IFDs overlap
+	var hooks TagHooks
+	got := make(map[tiff.Kind]any)
+	hooks.OnTag(0x0001, func(kind tiff.Kind, tag uint16, value any) {
+		got[kind] = value
+	})
+	runTagHooks(bytes.NewReader(data), &hooks)
+
+	if len(got) != 2 || got[tiff.KindGPS] != "N" || got[tiff.KindInterop] != "R98" {
+		t.Errorf("Unexpected values: %v\n", got)
+	}
+
+	// no hooks
+	runTagHooks(bytes.NewReader(data), nil)
+	runTagHooks(bytes.NewReader(data), new(TagHooks))
+}
@@ -0,0 +1,123 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+// srgbProfileOnce builds the sRGB ICC profile once.
+var srgbProfileOnce = sync.OnceValue(buildSRGBProfile)
+
+// srgbProfile returns an ICC (version 2.1) display profile of sRGB, the
+// color space of the images developed by the RawDecoders, to embed in the
+// images written: its D50-adapted primaries and its tone curve.  The
+// returned data is shared and must not be modified.
+func srgbProfile() []byte {
+	return srgbProfileOnce()
+}
+
+// buildSRGBProfile builds the sRGB ICC profile: a header, a tag table, and
+// the tag data, each aligned to 4 bytes.
+// Returns the profile.
+func buildSRGBProfile() []byte {
+	be := binary.BigEndian
+	xyz := func(x, y, z float64) []byte {
+		b := append([]byte("XYZ "), 0, 0, 0, 0)
+		for _, v := range []float64{x, y, z} {
+			b = be.AppendUint32(b, uint32(int32(math.Round(v*65536))))
+		}
+		return b
+	}
+
+	desc := "sRGB"
+	description := append([]byte("desc"), 0, 0, 0, 0)
+	description = be.AppendUint32(description, uint32(len(desc)+1))
+	description = append(description, desc...)
+	// the NUL, the empty Unicode and ScriptCode descriptions
+	description = append(description, make([]byte, 1+8+3+67)...)
+
+	curve := append([]byte("curv"), 0, 0, 0, 0)
+	const points = 1024
+	curve = be.AppendUint32(curve, points)
+	for i := range points {
+		curve = be.AppendUint16(curve, uint16(math.Round(srgbToLinear(float64(i)/(points-1))*0xffff)))
+	}
+
+	type tag struct {
+		sig  string
+		data []byte
+	}
+	tags := []tag{
+		{"desc", description},
+		{"cprt", append([]byte("text\x00\x00\x00\x00No copyright, use freely"), 0)},
+		{"wtpt", xyz(0.9642, 1, 0.8249)},
+		{"rXYZ", xyz(0.4361, 0.2225, 0.0139)},
+		{"gXYZ", xyz(0.3851, 0.7169, 0.0971)},
+		{"bXYZ", xyz(0.1431, 0.0606, 0.7141)},
+		{"rTRC", curve},
+		{"gTRC", curve},
+		{"bTRC", curve},
+	}
+
+	// the tag data follows the header and the tag table; the tone curves
+	// are shared
+	table := make([]byte, 0, 4+12*len(tags))
+	table = be.AppendUint32(table, uint32(len(tags)))
+	var data []byte
+	offsets := make(map[string]int)
+	for _, t := range tags {
+		key := string(t.data)
+		offset, ok := offsets[key]
+		if !ok {
+			offset = 128 + 4 + 12*len(tags) + len(data)
+			offsets[key] = offset
+			data = append(data, t.data...)
+			data = append(data, make([]byte, -len(data)&3)...)
+		}
+		table = append(table, t.sig...)
+		table = be.AppendUint32(table, uint32(offset))
+		table = be.AppendUint32(table, uint32(len(t.data)))
+	}
+
+	header := make([]byte, 128)
+	be.PutUint32(header, uint32(128+len(table)+len(data)))
+	be.PutUint32(header[8:], 0x02100000) // version 2.1
+	copy(header[12:], "mntrRGB XYZ ")
+	copy(header[36:], "acsp")
+	copy(header[68:], xyz(0.9642, 1, 0.8249)[8:]) // the D50 illuminant
+
+	profile := append(header, table...)
+	return append(profile, data...)
+}
+
+// srgbToLinear converts an sRGB value, from 0 to 1, to linear light.
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
@@ -0,0 +1,216 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrEntryType is returned by the accessors of IfdEntry for an entry whose
+// field type or count does not hold the requested value.
+var ErrEntryType = errors.New("rawparser: invalid IFD entry type")
+
+// IfdEntry is a struct representing an entry of a TIFF Image File
+// Directory (IFD).
+// Each 12-byte IFD entry has the following format:
+//   Bytes 0-1 The Tag that identifies the field.
+//   Bytes 2-3 The field Type.
+//   Bytes 4-7 The number of values, Count of the indicated Type.
+//   Bytes 8-11 The Value Offset, the file offset (in bytes) of the Value for the field.
+//
+// The accessors (Uint16, Uint32, Rational, ASCII and Shorts) read the value
+// in the byte order of the IFD, whether stored within the value offset or
+// at the offset of the value.
+type IfdEntry struct {
+	tag, fieldType     uint16
+	count, valueOffset uint32 // value, if within 4 bytes, or offset of value
+
+	// offset is the offset of the value from the start of the file, or of
+	// the value field of the entry if inline; unlike valueOffset, it holds
+	// the offsets of BigTIFF beyond 4 GB.  Offsets relative to a maker
+	// note are in valueOffset.
+	offset int64
+
+	// order is the byte order of the IFD and r the file from which values
+	// not within the value offset are read.
+	order binary.ByteOrder
+	r     io.ReaderAt
+}
+
+// Tag returns the tag of the entry.
+func (e *IfdEntry) Tag() uint16 {
+	return e.tag
+}
+
+// Type returns the field type of the entry, e.g., 3 for SHORT.
+func (e *IfdEntry) Type() uint16 {
+	return e.fieldType
+}
+
+// Count returns the number of values of the entry.
+func (e *IfdEntry) Count() uint32 {
+	return e.count
+}
+
+// Uint16 reads the first value of a SHORT or SSHORT entry.
+// Returns the value or error.
+func (e *IfdEntry) Uint16() (uint16, error) {
+	if e.fieldType != 3 && e.fieldType != 8 {
+		return 0, e.typeError("16-bit integer")
+	}
+	b, err := e.value(1, 2)
+	if err != nil {
+		return 0, err
+	}
+	return e.order.Uint16(b), nil
+}
+
+// Uint32 reads the first value of a SHORT, LONG or IFD entry, or of a
+// BigTIFF LONG8 or IFD8 entry whose value fits within 32 bits.
+// Returns the value or error.
+func (e *IfdEntry) Uint32() (uint32, error) {
+	switch e.fieldType {
+	case 3:
+		v, err := e.Uint16()
+		return uint32(v), err
+	case 4, 13:
+		b, err := e.value(1, 4)
+		if err != nil {
+			return 0, err
+		}
+		return e.order.Uint32(b), nil
+	case 16, 18:
+		b, err := e.value(1, 8)
+		if err != nil {
+			return 0, err
+		}
+		v := e.order.Uint64(b)
+		if v>>32 != 0 {
+			return 0, fmt.Errorf("%w: value %d of tag 0x%04x exceeds 32 bits", ErrEntryType, v, e.tag)
+		}
+		return uint32(v), nil
+	}
+	return 0, e.typeError("unsigned integer")
+}
+
+// Uint64 reads the first value of a SHORT, LONG, IFD, LONG8, or IFD8
+// entry.
+// Returns the value or error.
+func (e *IfdEntry) Uint64() (uint64, error) {
+	if e.fieldType != 16 && e.fieldType != 18 {
+		v, err := e.Uint32()
+		return uint64(v), err
+	}
+	b, err := e.value(1, 8)
+	if err != nil {
+		return 0, err
+	}
+	return e.order.Uint64(b), nil
+}
+
+// Shorts reads the values of a SHORT or SSHORT entry.
+// Returns the values or error.
+func (e *IfdEntry) Shorts() ([]uint16, error) {
+	if e.fieldType != 3 && e.fieldType != 8 {
+		return nil, e.typeError("16-bit integer")
+	}
+	b, err := e.value(e.count, 2)
+	if err != nil {
+		return nil, err
+	}
+	vals := make([]uint16, e.count)
+	for i := range vals {
+		vals[i] = e.order.Uint16(b[i*2:])
+	}
+	return vals, nil
+}
+
+// Rational reads the first value of a RATIONAL entry.
+// Returns a numerator, denominator, and rational (fractional) value, zero
+// if the denominator is zero, or error.
+func (e *IfdEntry) Rational() (num, den uint32, r float64, err error) {
+	if e.fieldType != 5 {
+		return 0, 0, 0, e.typeError("rational")
+	}
+	b, err := e.value(1, 8)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	num, den = e.order.Uint32(b), e.order.Uint32(b[4:])
+	if den > 0 {
+		r = float64(num) / float64(den)
+	}
+	return num, den, r, nil
+}
+
+// ASCII reads an ASCII entry, or an UNDEFINED entry holding text as
+// written by some firmware.
+// Returns the value, without trailing NULs and spaces, or error.
+func (e *IfdEntry) ASCII() (string, error) {
+	if e.fieldType != 2 && e.fieldType != 7 {
+		return "", e.typeError("ASCII")
+	}
+	b, err := e.value(e.count, 1)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(bytesToASCIIString(b), "\x00 "), nil
+}
+
+// value reads the first n values of size bytes of the entry.  Per the TIFF
+// spec, values totalling 4 bytes or less are stored within the value
+// offset and are left-justified; others, including those inline in a
+// BigTIFF entry, are read at the offset of the entry.
+// Returns the bytes, in file order, or error.
+func (e *IfdEntry) value(n, size uint32) ([]byte, error) {
+	if e.count == 0 || n > e.count {
+		return nil, fmt.Errorf("%w: tag 0x%04x has %d values", ErrEntryType, e.tag, e.count)
+	}
+	total, err := valueSize(e.count, size)
+	if err != nil {
+		return nil, err
+	}
+	if e.order == nil {
+		return nil, fmt.Errorf("%w: tag 0x%04x has no byte order", ErrEntryType, e.tag)
+	}
+
+	if total <= 4 {
+		b := make([]byte, 4)
+		e.order.PutUint32(b, e.valueOffset)
+		return b[:n*size], nil
+	}
+	if e.r == nil {
+		return nil, fmt.Errorf("%w: tag 0x%04x has no file", ErrEntryType, e.tag)
+	}
+	return readField(e.offset, n*size, e.r)
+}
+
+// typeError reports an entry whose field type does not hold a kind of value.
+func (e *IfdEntry) typeError(kind string) error {
+	return fmt.Errorf("%w: type %d of tag 0x%04x is not %s", ErrEntryType, e.fieldType, e.tag, kind)
+}
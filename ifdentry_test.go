@@ -0,0 +1,139 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// testIfdEntries builds a TIFF with an IFD of entries and reads it.
+// Returns the entries by tag.
+func testIfdEntries(t *testing.T, bigEndian bool, entries ...testEntry) map[uint16]*IfdEntry {
+	tt := newTestTiff(bigEndian)
+	ifd := tt.addIfd(0, entries...)
+
+	l, err := processIfd(isHostLittleEndian(), bigEndian, int64(ifd), bytes.NewReader(tt.bytes(ifd)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	m := make(map[uint16]*IfdEntry)
+	for e := l.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(IfdEntry)
+		m[entry.Tag()] = &entry
+	}
+	return m
+}
+
+func TestIfdEntryAccessors(t *testing.T) {
+	for _, bigEndian := range []bool{false, true} {
+		m := testIfdEntries(t, bigEndian,
+			shortEntry(0x0112, 6),            // inline
+			shortEntry(0x0102, 8, 12, 16),    // at offset
+			longEntry(0x0201, 0x12345678),    // inline
+			longEntry(0x0111, 7, 9),          // at offset
+			asciiEntry(0x010f, "abc"),        // inline
+			asciiEntry(0x0110, "NIKON D700"), // at offset
+			testEntry{tag: 0x011a, fieldType: 5, values: []uint32{300, 2}},
+		)
+
+		if v, err := m[0x0112].Uint16(); v != 6 || err != nil {
+			t.Errorf("Unexpected inline short (big endian %v): %d %v\n", bigEndian, v, err)
+		}
+		if v, err := m[0x0112].Uint32(); v != 6 || err != nil {
+			t.Errorf("Unexpected inline short as long (big endian %v): %d %v\n", bigEndian, v, err)
+		}
+		if v, err := m[0x0102].Shorts(); len(v) != 3 || v[0] != 8 || v[2] != 16 || err != nil {
+			t.Errorf("Unexpected shorts (big endian %v): %v %v\n", bigEndian, v, err)
+		}
+		if v, err := m[0x0102].Uint16(); v != 8 || err != nil {
+			t.Errorf("Unexpected first short (big endian %v): %d %v\n", bigEndian, v, err)
+		}
+		if v, err := m[0x0112].Uint64(); v != 6 || err != nil {
+			t.Errorf("Unexpected inline short as uint64 (big endian %v): %d %v\n", bigEndian, v, err)
+		}
+		if v, err := m[0x0201].Uint32(); v != 0x12345678 || err != nil {
+			t.Errorf("Unexpected inline long (big endian %v): %x %v\n", bigEndian, v, err)
+		}
+		if v, err := m[0x0111].Uint32(); v != 7 || err != nil {
+			t.Errorf("Unexpected first long (big endian %v): %d %v\n", bigEndian, v, err)
+		}
+		if v, err := m[0x010f].ASCII(); v != "abc" || err != nil {
+			t.Errorf("Unexpected inline ASCII (big endian %v): %q %v\n", bigEndian, v, err)
+		}
+		if v, err := m[0x0110].ASCII(); v != "NIKON D700" || err != nil {
+			t.Errorf("Unexpected ASCII (big endian %v): %q %v\n", bigEndian, v, err)
+		}
+		if num, den, r, err := m[0x011a].Rational(); num != 300 || den != 2 || r != 150 || err != nil {
+			t.Errorf("Unexpected rational (big endian %v): %d/%d %f %v\n", bigEndian, num, den, r, err)
+		}
+	}
+}
+
+func TestIfdEntryTypeErrors(t *testing.T) {
+	m := testIfdEntries(t, true, longEntry(0x0201, 1), asciiEntry(0x010f, "abc"), shortEntry(0x0100))
+
+	if _, err := m[0x0201].Uint16(); !errors.Is(err, ErrEntryType) {
+		t.Errorf("Expected a type error reading a long as a short; got %v\n", err)
+	}
+	if _, err := m[0x010f].Uint32(); !errors.Is(err, ErrEntryType) {
+		t.Errorf("Expected a type error reading ASCII as a long; got %v\n", err)
+	}
+	if _, _, _, err := m[0x010f].Rational(); !errors.Is(err, ErrEntryType) {
+		t.Errorf("Expected a type error reading ASCII as a rational; got %v\n", err)
+	}
+	if _, err := m[0x0201].ASCII(); !errors.Is(err, ErrEntryType) {
+		t.Errorf("Expected a type error reading a long as ASCII; got %v\n", err)
+	}
+	if _, err := m[0x0100].Uint16(); !errors.Is(err, ErrEntryType) {
+		t.Errorf("Expected an error reading an empty short; got %v\n", err)
+	}
+
+	entry := IfdEntry{tag: 0x0111, fieldType: 4, count: 0x40000001, offset: 8}
+	if _, err := entry.Uint32(); !errors.Is(err, errOffsetOverflow) {
+		t.Errorf("Expected overflow reading %d longs; got %v\n", entry.count, err)
+	}
+}
+
+func TestIfdPointer(t *testing.T) {
+	m := testIfdEntries(t, true, shortEntry(0x8769, 0x1234), longEntry(0x8825, 0x12345678))
+	if offset, err := ifdPointer(m[0x8769]); offset != 0x1234 || err != nil {
+		t.Errorf("Unexpected SHORT IFD pointer: %x %v\n", offset, err)
+	}
+	if offset, err := ifdPointer(m[0x8825]); offset != 0x12345678 || err != nil {
+		t.Errorf("Unexpected LONG IFD pointer: %x %v\n", offset, err)
+	}
+
+	// an IFD8 pointer beyond int64
+	b := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xf0}
+	entry := IfdEntry{tag: 0x8769, fieldType: 18, count: 1, order: binary.BigEndian, r: bytes.NewReader(b)}
+	if v, err := entry.Uint64(); v != 0xfffffffffffffff0 || err != nil {
+		t.Errorf("Unexpected IFD8 value: %x %v\n", v, err)
+	}
+	if _, err := ifdPointer(&entry); !errors.Is(err, errOffsetOverflow) {
+		t.Errorf("Expected overflow reading IFD8 pointer; got %v\n", err)
+	}
+}
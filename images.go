@@ -0,0 +1,240 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// ImageType classifies an image embedded in a raw file.
+type ImageType int
+
+const (
+	// ImageRaw is raw image data, e.g., the CFA samples of the sensor.
+	ImageRaw ImageType = iota
+
+	// ImagePreview is a rendered image, typically a JPEG, larger than a
+	// thumbnail.
+	ImagePreview
+
+	// ImageThumbnail is a rendered image whose long edge is at most 512
+	// pixels or, if its dimensions are not recorded, at most 32 KiB.
+	ImageThumbnail
+)
+
+const (
+	// thumbnailMaxEdge is the largest long edge, in pixels, of a rendered
+	// image classified as a thumbnail.
+	thumbnailMaxEdge = 512
+
+	// thumbnailMaxLength is the largest length, in bytes, of a rendered
+	// image of unrecorded dimensions classified as a thumbnail.
+	thumbnailMaxLength = 32 << 10
+)
+
+// String returns the name of the image type.
+func (t ImageType) String() string {
+	switch t {
+	case ImageRaw:
+		return "raw"
+	case ImagePreview:
+		return "preview"
+	case ImageThumbnail:
+		return "thumbnail"
+	}
+	return fmt.Sprintf("ImageType(%d)", int(t))
+}
+
+// MarshalText encodes the image type by name.
+func (t ImageType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// EmbeddedImage describes an image of a TIFF-based raw file, e.g., the
+// full-size preview, thumbnail, small RGB image, and raw data of a CR2.
+type EmbeddedImage struct {
+	// IFD names the IFD describing the image, e.g., "IFD0" or "SubIFD1".
+	IFD  string    `json:"ifd"`
+	Type ImageType `json:"type"`
+
+	// Width and Height are the dimensions, in pixels, of the image as
+	// recorded in the IFD or, for the embedded JPEG once extracted, its
+	// frame header; 0 if not recorded.
+	Width  int `json:"width"`
+	Height int `json:"height"`
+
+	// Compression is the TIFF Compression of the image, e.g., 1 for
+	// uncompressed or 6 for JPEG; 0 if not recorded.
+	Compression int `json:"compression"`
+
+	// BitsPerSample is the number of bits of the first sample; 0 if not
+	// recorded.
+	BitsPerSample int `json:"bitsPerSample,omitempty"`
+
+	// Offset is the offset of the image data: the JPEGInterchangeFormat, or
+	// the first strip or tile.  Length is the length, in bytes, of the
+	// JPEGInterchangeFormat or the sum of the lengths of the strips or
+	// tiles.
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// listImages walks the IFD0 chain and SubIFDs of a TIFF-based raw file and
+// describes the images they contain.  IFDs without image data are skipped.
+// Errors are not fatal as the images are informational.
+// Returns the images in the order the IFDs are visited.
+func listImages(f io.ReaderAt) []EmbeddedImage {
+	h, err := tiff.ReadHeader(f)
+	if err != nil {
+		return nil
+	}
+
+	var images []EmbeddedImage
+	err = tiff.WalkIFDs(f, h, func(ifd *tiff.IFD) error {
+		if ifd.Kind != tiff.KindMain && ifd.Kind != tiff.KindSub {
+			return tiff.SkipChildren
+		}
+		if img, ok := describeImage(ifd); ok {
+			images = append(images, img)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error listing images: %v\n", err)
+	}
+
+	return images
+}
+
+// describeImage describes the image of an IFD from its entries; the image
+// data is not read.  CFA and LinearRaw data, and the lossless JPEG of Canon
+// raw data (sliced, tag 0xc640), are classified as raw; JPEG, RGB, YCbCr,
+// and reduced-resolution data as a preview or thumbnail; other data as raw.
+// Returns the image and true, or false if the IFD has no image data.
+func describeImage(ifd *tiff.IFD) (EmbeddedImage, bool) {
+	img := EmbeddedImage{IFD: ifdName(ifd.Kind, ifd.Index)}
+	value := func(tag uint16) int {
+		if e := ifd.Find(tag); e != nil {
+			// offsets of a BigTIFF may exceed 32 bits
+			if v, err := e.Uint64(); err == nil && v <= math.MaxInt {
+				return int(v)
+			}
+		}
+		return 0
+	}
+
+	img.Width, img.Height = value(0x0100), value(0x0101)
+	img.BitsPerSample = value(0x0102)
+	img.Compression = value(0x0103)
+	photometric := value(0x0106)
+	reduced := value(0x00fe)&1 == 1
+
+	isJpeg := false
+	if offset, length := value(0x0201), value(0x0202); offset > 0 && length > 0 {
+		img.Offset, img.Length = int64(offset), int64(length)
+		isJpeg = true
+	} else if !dataExtent(ifd, 0x0111, 0x0117, &img) {
+		dataExtent(ifd, 0x0144, 0x0145, &img)
+	}
+	if img.Length <= 0 {
+		return img, false
+	}
+
+	switch {
+	case photometric == 32803 || photometric == 34892 || ifd.Find(0xc640) != nil:
+		img.Type = ImageRaw
+	case isJpeg || img.Compression == 6 || img.Compression == 7 ||
+		photometric == 2 || photometric == 6 || reduced:
+		img.Type = renderedImageType(img.Width, img.Height, img.Length)
+	default:
+		img.Type = ImageRaw
+	}
+
+	return img, true
+}
+
+// dataExtent records the offset and total length of the strips or tiles of
+// an IFD.
+// Returns true if the offsets and lengths are present and consistent.
+func dataExtent(ifd *tiff.IFD, offsetsTag, lengthsTag uint16, img *EmbeddedImage) bool {
+	oe, le := ifd.Find(offsetsTag), ifd.Find(lengthsTag)
+	if oe == nil || le == nil {
+		return false
+	}
+	offsets, err := oe.Uints64()
+	if err != nil || len(offsets) == 0 || offsets[0] > math.MaxInt64 {
+		return false
+	}
+	lengths, err := le.Uints64()
+	if err != nil || len(lengths) != len(offsets) {
+		return false
+	}
+
+	var length int64
+	for _, l := range lengths {
+		length += int64(l)
+	}
+	img.Offset, img.Length = int64(offsets[0]), length
+
+	return true
+}
+
+// renderedImageType classifies a rendered image by its long edge or, if its
+// dimensions are not recorded, by its length.
+func renderedImageType(width, height int, length int64) ImageType {
+	if width > 0 && height > 0 {
+		if max(width, height) <= thumbnailMaxEdge {
+			return ImageThumbnail
+		}
+		return ImagePreview
+	}
+	if length <= thumbnailMaxLength {
+		return ImageThumbnail
+	}
+	return ImagePreview
+}
+
+// setImageDimensions records the dimensions of the images whose dimensions
+// are not recorded in their IFD: the embedded JPEG, once its frame header
+// is read, and raw data, e.g., the lossless JPEG of a CR2, of the raw
+// sensor dimensions.
+func (r *RawFile) setImageDimensions(j *jpegInfo) {
+	for i := range r.Images {
+		img := &r.Images[i]
+		if img.Width > 0 && img.Height > 0 {
+			continue
+		}
+		switch {
+		case img.Type == ImageRaw:
+			img.Width, img.Height = r.ImageWidth, r.ImageHeight
+		case img.Offset == j.offset && j.width > 0 && j.height > 0:
+			img.Width, img.Height = j.width, j.height
+		}
+	}
+}
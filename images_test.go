@@ -0,0 +1,195 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestListImages(t *testing.T) {
+	tt := newTestTiff(true)
+	preview := testJpeg(t, 640, 480)
+	previewOffset := tt.addBlob(preview)
+	cfa := tt.addBlob(make([]byte, 64))
+	raw := tt.addIfd(0,
+		longEntry(0x00fe, 0),
+		longEntry(0x0100, 4),
+		longEntry(0x0101, 4),
+		shortEntry(0x0102, 14),
+		shortEntry(0x0103, 1),
+		shortEntry(0x0106, 32803),
+		longEntry(0x0111, cfa, cfa+32),
+		longEntry(0x0117, 32, 32))
+	jpeg := tt.addIfd(0,
+		longEntry(0x00fe, 1),
+		shortEntry(0x0103, 6),
+		longEntry(0x0201, previewOffset),
+		longEntry(0x0202, uint32(len(preview))))
+	exif := tt.addIfd(0, asciiEntry(0x9003, "2019:10:11 12:13:14"))
+	thumbnail := tt.addBlob(make([]byte, 160*120*3))
+	data := tt.bytes(tt.addIfd(0,
+		longEntry(0x00fe, 1),
+		longEntry(0x0100, 160),
+		longEntry(0x0101, 120),
+		shortEntry(0x0102, 8, 8, 8),
+		shortEntry(0x0103, 1),
+		shortEntry(0x0106, 2),
+		longEntry(0x0111, thumbnail),
+		longEntry(0x0117, 160*120*3),
+		longEntry(0x014a, jpeg, raw),
+		longEntry(0x8769, exif)))
+
+	images := listImages(bytes.NewReader(data))
+	want := []EmbeddedImage{
+		{IFD: "IFD0", Type: ImageThumbnail, Width: 160, Height: 120, Compression: 1, BitsPerSample: 8, Offset: int64(thumbnail), Length: 160 * 120 * 3},
+		{IFD: "SubIFD0", Type: ImagePreview, Compression: 6, Offset: int64(previewOffset), Length: int64(len(preview))},
+		{IFD: "SubIFD1", Type: ImageRaw, Width: 4, Height: 4, Compression: 1, BitsPerSample: 14, Offset: int64(cfa), Length: 64},
+	}
+	if len(images) != len(want) {
+		t.Fatalf("Expected %d images; got %+v\n", len(want), images)
+	}
+	for i := range want {
+		if images[i] != want[i] {
+			t.Errorf("Expected %+v; got %+v\n", want[i], images[i])
+		}
+	}
+}
+
+func TestRenderedImageType(t *testing.T) {
+	tests := []struct {
+		width, height int
+		length        int64
+		want          ImageType
+	}{
+		{160, 120, 1 << 20, ImageThumbnail},
+		{512, 340, 0, ImageThumbnail},
+		{513, 340, 0, ImagePreview},
+		{0, 0, 10 << 10, ImageThumbnail},
+		{0, 0, 1 << 20, ImagePreview},
+	}
+	for _, test := range tests {
+		if got := renderedImageType(test.width, test.height, test.length); got != test.want {
+			t.Errorf("%dx%d, %d bytes: expected %s; got %s\n", test.width, test.height, test.length, test.want, got)
+		}
+	}
+}
+
+func TestCr2Images(t *testing.T) {
+	p, _ := NewCr2Parser(isHostLittleEndian())
+	r, err := p.ProcessFile(&RawFileInfo{File: TestCR2File, DestDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	// full-size preview, thumbnail, small RGB, and raw
+	types := []ImageType{ImagePreview, ImageThumbnail, ImageThumbnail, ImageRaw}
+	if len(r.Images) != len(types) {
+		t.Fatalf("Expected %d images; got %+v\n", len(types), r.Images)
+	}
+	for i, img := range r.Images {
+		if img.Type != types[i] || img.Length <= 0 {
+			t.Errorf("Unexpected image %d: %+v\n", i, img)
+		}
+	}
+	if raw := r.Images[3]; raw.Width != r.ImageWidth || raw.Height != r.ImageHeight {
+		t.Errorf("Expected raw dimensions %dx%d; got %+v\n", r.ImageWidth, r.ImageHeight, raw)
+	}
+	if preview := r.Images[0]; preview.Width != r.PreviewWidth || preview.Offset != r.preview.offset {
+		t.Errorf("Expected the preview of width %d; got %+v\n", r.PreviewWidth, preview)
+	}
+
+	out, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if !strings.Contains(string(out), `"ifd":"IFD3","type":"raw"`) {
+		t.Errorf("Expected the raw image by type name; got %s\n", out)
+	}
+}
+
+func TestReadRawImage(t *testing.T) {
+	tt := newTestTiff(true)
+	cfa := tt.addBlob(make([]byte, 8*6*2))
+	raw := tt.addIfd(0,
+		longEntry(0x00fe, 0),
+		longEntry(0x0100, 8),
+		longEntry(0x0101, 6),
+		shortEntry(0x0102, 16),
+		shortEntry(0x0103, 1),
+		shortEntry(0x0106, 32803),
+		longEntry(0x0111, cfa),
+		longEntry(0x0117, 8*6*2),
+		shortEntry(0x828d, 2, 2),
+		testEntry{tag: 0x828e, fieldType: 1, raw: []byte{1, 2, 0, 1}},
+		testEntry{tag: 0xc61f, fieldType: 5, values: []uint32{4, 2, 1, 1}},
+		shortEntry(0xc620, 3, 2),
+		longEntry(0xc68d, 1, 2, 5, 8))
+	data := tt.bytes(tt.addIfd(0,
+		testEntry{tag: 0xc612, fieldType: 1, raw: []byte{1, 4, 0, 0}},
+		longEntry(0x014a, raw)))
+
+	r := readRawImage(bytes.NewReader(data))
+	want := RawImage{
+		IFD: "SubIFD0", Width: 8, Height: 6, BitsPerSample: 16, Compression: 1,
+		CFAPattern: "GBRG", CFAWidth: 2, CFAHeight: 2,
+		ActiveArea:       Area{Top: 1, Left: 2, Bottom: 5, Right: 8},
+		CropMargins:      Margins{Top: 1, Left: 2, Bottom: 1, Right: 1},
+		DefaultCropWidth: 3, DefaultCropHeight: 2,
+	}
+	if r == nil || *r != want {
+		t.Errorf("Expected %+v; got %+v\n", want, r)
+	}
+}
+
+func TestRawImageSensorArea(t *testing.T) {
+	tt := newTestTiff(true)
+	cfa := tt.addBlob(make([]byte, 64))
+	raw := tt.addIfd(0,
+		longEntry(0x0100, 8),
+		longEntry(0x0101, 6),
+		shortEntry(0x0106, 32803),
+		longEntry(0x0111, cfa),
+		longEntry(0x0117, 64))
+	// the columns and rows of the pattern in little-endian byte order
+	exif := tt.addIfd(0, testEntry{tag: 0xa302, fieldType: 7, raw: []byte{2, 0, 2, 0, 0, 1, 1, 2}})
+	data := tt.bytes(tt.addIfd(0, longEntry(0x014a, raw), longEntry(0x8769, exif)))
+
+	m := rawMetadata{rawImage: readRawImage(bytes.NewReader(data))}
+	if m.rawImage == nil || m.rawImage.CFAPattern != "RGGB" {
+		t.Fatalf("Expected RGGB pattern; got %+v\n", m.rawImage)
+	}
+
+	m.sensor = canonSensorInfo([]uint32{18, 8, 6, 0, 0, 1, 1, 6, 4})
+	r := m.rawImageInfo()
+	want := Area{Top: 1, Left: 1, Bottom: 5, Right: 7}
+	if r.ActiveArea != want || r.CFAPattern != "BGGR" {
+		t.Errorf("Expected BGGR pattern of %+v; got %+v\n", want, r)
+	}
+	if r.DefaultCropWidth != 6 || r.DefaultCropHeight != 4 || r.CropMargins != (Margins{}) {
+		t.Errorf("Unexpected default crop: %+v\n", r)
+	}
+}
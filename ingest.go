@@ -0,0 +1,276 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// IngestOptions configures Ingest.  Start from DefaultIngestOptions.
+type IngestOptions struct {
+	// Quality is the JPEG quality, from 1 to 100, of the previews, or
+	// QualityAuto to match the size, per pixel, of the embedded preview.
+	Quality int
+
+	// Jpeg are the chroma subsampling and progressive encoding of the
+	// previews.
+	Jpeg JpegOptions
+
+	// Sizes are the long edges, in pixels, of the previews written for
+	// each raw file; 0 writes the embedded preview at its full size.
+	// Previews are never enlarged.
+	Sizes []int
+
+	// Dedupe selects how duplicate raw files are detected; only one file
+	// of each group of duplicates is ingested.
+	Dedupe DedupeMode
+
+	// Workers is the number of raw files ingested concurrently; the number
+	// of CPUs if 0.
+	Workers int
+
+	// Sidecars writes the metadata of each raw file, as JSON, next to its
+	// previews.
+	Sidecars bool
+
+	// Manifest is the name of the manifest written to destRoot; none if
+	// empty.
+	Manifest string
+
+	// SkipHidden skips files and directories whose names begin with ".".
+	SkipHidden bool
+
+	// Checksums selects the checksums of the raw files to compute.
+	Checksums Checksum
+
+	// PreserveExif writes EXIF metadata to the previews.  See
+	// RawFileInfo.PreserveExif.
+	PreserveExif bool
+
+	// Artist and Copyright, if set, are stamped into the EXIF metadata of
+	// the previews.  See RawFileInfo.Artist.
+	Artist, Copyright string
+
+	// ConvertToSRGB converts previews in Adobe RGB to sRGB.  See
+	// RawFileInfo.ConvertToSRGB.
+	ConvertToSRGB bool
+
+	// CropAspect crops the previews, other than the full size, to an
+	// aspect ratio around the subject, e.g., 1 for the square thumbnails
+	// of a gallery.  See RawFileInfo.CropAspect.
+	CropAspect float64
+}
+
+// DefaultIngestOptions returns the options used by Ingest if none are
+// given: full-size, 1024, and 256 pixel previews at quality 85 with EXIF
+// metadata, deduplication by content, sidecars, and a "manifest.json".
+func DefaultIngestOptions() *IngestOptions {
+	return &IngestOptions{
+		Quality:      85,
+		Sizes:        []int{0, 1024, 256},
+		Dedupe:       DedupeContent,
+		Sidecars:     true,
+		Manifest:     "manifest.json",
+		SkipHidden:   true,
+		PreserveExif: true,
+	}
+}
+
+// Manifest is a struct representing the outcome of an Ingest.  Paths are
+// relative to the root of the scan (File, DuplicateOf) or to destRoot
+// (Previews, Sidecar).
+type Manifest struct {
+	Files []ManifestEntry `json:"files"`
+}
+
+// ManifestEntry is a struct representing the outcome of ingesting a raw
+// file.
+type ManifestEntry struct {
+	File        string   `json:"file"`
+	DuplicateOf string   `json:"duplicateOf,omitempty"`
+	PhotoID     string   `json:"photoID,omitempty"`
+	Previews    []string `json:"previews,omitempty"`
+	Sidecar     string   `json:"sidecar,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// Ingest runs the complete workflow of importing a directory tree of raw
+// files: the raw files below root are found (see RawFiles), duplicates are
+// detected, and each raw file is parsed; its previews are written, in the
+// sizes of opts, together with a JSON sidecar of its metadata, to the same
+// relative directory below destRoot; finally, a manifest of the files is
+// written to destRoot.  If opts is nil, DefaultIngestOptions is used.
+//
+//	manifest, err := rawparser.Ingest("/media/card", "/photos/previews", nil)
+//	if err != nil {
+//		log.Print(err) // the files that failed
+//	}
+//
+// Returns the manifest and a *BatchError of the files that failed, joined
+// with the errors finding the files and writing the manifest, if any.
+func Ingest(root, destRoot string, opts *IngestOptions) (*Manifest, error) {
+	if opts == nil {
+		opts = DefaultIngestOptions()
+	}
+
+	var files []string
+	var errs []error
+	for path, err := range RawFiles(root, &ScanOptions{SkipHidden: opts.SkipHidden}) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		files = append(files, path)
+	}
+
+	b := NewBatchProcessor(destRoot, opts.Quality, WithWorkers(opts.Workers), WithDedupe(opts.Dedupe))
+	results, pending := b.prepare(files)
+	previews := make([][]string, len(results))
+	sidecars := make([]string, len(results))
+	b.forEach(pending, func(i int) {
+		previews[i], sidecars[i] = ingestFile(&results[i], root, destRoot, opts)
+	})
+
+	m := &Manifest{Files: make([]ManifestEntry, len(results))}
+	for i, res := range results {
+		e := &m.Files[i]
+		e.File = relPath(root, res.File)
+		if res.DuplicateOf != "" {
+			e.DuplicateOf = relPath(root, res.DuplicateOf)
+		}
+		if res.RawFile != nil {
+			e.PhotoID = res.RawFile.PhotoID
+		}
+		for _, p := range previews[i] {
+			e.Previews = append(e.Previews, relPath(destRoot, p))
+		}
+		if sidecars[i] != "" {
+			e.Sidecar = relPath(destRoot, sidecars[i])
+		}
+		if res.Err != nil {
+			e.Error = res.Err.Error()
+		}
+	}
+
+	if opts.Manifest != "" {
+		if err := writeJSON(filepath.Join(destRoot, opts.Manifest), m); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return m, errors.Join(append(errs, BatchErrors(results))...)
+}
+
+// ingestFile parses a raw file of a batch, unless parsed by the pre-pass,
+// and writes its previews and sidecar to the directory below destRoot
+// matching its directory below root.  The sidecar is written even if the
+// previews could not be.
+// Returns the paths of the previews and the sidecar.
+func ingestFile(res *BatchResult, root, destRoot string, opts *IngestOptions) (previews []string, sidecar string) {
+	if res.RawFile == nil || opts.Checksums != 0 {
+		p := NewFormatParser(filepath.Ext(res.File))
+		if p == nil {
+			res.Err = fmt.Errorf("%w: %s", ErrUnknownFormat, res.File)
+			return nil, ""
+		}
+		res.RawFile, res.Err = p.ProcessFile(&RawFileInfo{File: res.File, SkipExtraction: true, Checksums: opts.Checksums})
+		if res.Err != nil {
+			res.RawFile = nil
+			return nil, ""
+		}
+	}
+	r := res.RawFile
+
+	destDir := filepath.Join(destRoot, filepath.Dir(relPath(root, res.File)))
+	if res.Err = os.MkdirAll(destDir, 0755); res.Err != nil {
+		return nil, ""
+	}
+
+	ex := new(ExtractionResult)
+	previews, ex.Err = writePreviewSizes(r, destDir, opts)
+	if len(previews) > 0 {
+		ex.JpegPath = previews[0]
+	}
+	r.JpegPath, r.Extraction = ex.JpegPath, ex
+	if ex.Err != nil {
+		res.Err = fmt.Errorf("%w: %w", ErrExtractionFailed, ex.Err)
+	}
+
+	if opts.Sidecars {
+		sidecar = filepath.Join(destDir, safeBaseName(res.File)+".json")
+		if err := writeJSON(sidecar, r); err != nil {
+			res.Err = errors.Join(res.Err, err)
+			sidecar = ""
+		}
+	}
+	return previews, sidecar
+}
+
+// writePreviewSizes writes the embedded preview of a parsed raw file in
+// each size of opts, as by WriteRenditions, to destDir.
+// Returns the paths of the previews written or error.
+func writePreviewSizes(r *RawFile, destDir string, opts *IngestOptions) ([]string, error) {
+	info := &RawFileInfo{
+		DestDir:      destDir,
+		Quality:      opts.Quality,
+		Jpeg:         opts.Jpeg,
+		PreserveExif: opts.PreserveExif,
+		Artist:       opts.Artist,
+		Copyright:    opts.Copyright,
+
+		ConvertToSRGB: opts.ConvertToSRGB,
+		CropAspect:    opts.CropAspect,
+	}
+	out, err := renditions(r, info, opts.Sizes, true)
+
+	paths := make([]string, 0, len(out))
+	for _, rd := range out {
+		paths = append(paths, rd.Path)
+	}
+	return paths, err
+}
+
+// writeJSON writes a value, as indented JSON, to a file.
+// Returns error.
+func writeJSON(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, append(data, '\n'), 0644)
+}
+
+// relPath returns the path of a file relative to a directory, with forward
+// slashes, or the path itself if it is not below the directory.
+func relPath(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,186 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+func TestResizeImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 100))
+	for x := 0; x < 400; x++ {
+		for y := 0; y < 100; y++ {
+			if x%2 == 0 {
+				src.Set(x, y, color.RGBA{200, 100, 0, 255})
+			}
+		}
+	}
+
+	dst := resizeImage(src, 100)
+	if b := dst.Bounds(); b.Dx() != 100 || b.Dy() != 25 {
+		t.Fatalf("Unexpected bounds: %v\n", b)
+	}
+	// each pixel averages two columns
+	if c := dst.At(10, 10).(color.RGBA); c != (color.RGBA{100, 50, 0, 127}) {
+		t.Errorf("Unexpected average: %v\n", c)
+	}
+
+	if resizeImage(src, 0) != image.Image(src) || resizeImage(src, 400) != image.Image(src) {
+		t.Error("Expected the image not to be resized")
+	}
+	if b := resizeImage(image.NewGray(image.Rect(0, 0, 30, 600)), 60).Bounds(); b.Dx() != 3 || b.Dy() != 60 {
+		t.Errorf("Unexpected bounds of portrait image: %v\n", b)
+	}
+}
+
+func TestDecodeScale(t *testing.T) {
+	tests := []struct{ width, height, longEdge, denom int }{
+		{6000, 4000, 0, 1},
+		{6000, 4000, 6000, 1},
+		{6000, 4000, 1024, min(4, maxDecodeScale)},
+		{6000, 4000, 256, min(8, maxDecodeScale)},
+		{4000, 6000, 1500, min(4, maxDecodeScale)},
+		{4000, 6000, 1501, min(2, maxDecodeScale)},
+	}
+	for _, test := range tests {
+		if denom := decodeScale(test.width, test.height, test.longEdge); denom != test.denom {
+			t.Errorf("Unexpected scale of %dx%d to %d: 1/%d\n", test.width, test.height, test.longEdge, denom)
+		}
+	}
+}
+
+// TestDecodeForSize verifies the decoding of a preview for a size, scaled
+// by the JPEG backend of the build, if supported.
+func TestDecodeForSize(t *testing.T) {
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, testColorImage(320, 240), &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("Error encoding test jpeg: %v\n", err)
+	}
+
+	fulls := 0
+	full := func() (image.Image, error) {
+		fulls++
+		return decodeJpeg(b.Bytes())
+	}
+	img, err := decodeForSize(b.Bytes(), 320, 240, 64, full)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	want := image.Rect(0, 0, 80, 60)
+	if maxDecodeScale == 1 {
+		want = image.Rect(0, 0, 320, 240)
+	}
+	if img.Bounds() != want || (fulls == 0) != (maxDecodeScale > 1) {
+		t.Errorf("Unexpected decode: %v, %d full\n", img.Bounds(), fulls)
+	}
+	if e := meanError(resizeImage(testColorImage(320, 240), 80), resizeImage(img, 80)); e > 6 {
+		t.Errorf("Unexpected mean error: %f\n", e)
+	}
+}
+
+func TestIngest(t *testing.T) {
+	root := t.TempDir()
+	dest := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "day1"), 0755); err != nil {
+		t.Fatalf("Error creating directory: %v\n", err)
+	}
+	photo := buildTestPhoto(t, "id-a", "v1")
+	writeFile(t, filepath.Join(root, "day1", "a.NRW"), photo)
+	writeFile(t, filepath.Join(root, "day1", "copy.NRW"), photo)
+	writeFile(t, filepath.Join(root, "b.NRW"), buildTestPhoto(t, "id-b", "v1"))
+	writeFile(t, filepath.Join(root, "broken.NRW"), []byte("not a raw file"))
+
+	opts := DefaultIngestOptions()
+	opts.Sizes = []int{0, 32}
+	m, err := Ingest(root, dest, opts)
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errs) != 1 || batchErr.Err(filepath.Join(root, "broken.NRW")) == nil {
+		t.Errorf("Expected an error for broken.NRW; got %v\n", err)
+	}
+
+	want := map[string]ManifestEntry{
+		"b.NRW": {File: "b.NRW", PhotoID: "id-b",
+			Previews: []string{"b.NRW_extracted.jpg", "b.NRW_32.jpg"}, Sidecar: "b.NRW.json"},
+		"day1/a.NRW": {File: "day1/a.NRW", PhotoID: "id-a",
+			Previews: []string{"day1/a.NRW_extracted.jpg", "day1/a.NRW_32.jpg"}, Sidecar: "day1/a.NRW.json"},
+		"day1/copy.NRW": {File: "day1/copy.NRW", DuplicateOf: "day1/a.NRW"},
+	}
+	if len(m.Files) != 4 {
+		t.Fatalf("Unexpected manifest: %+v\n", m)
+	}
+	for _, e := range m.Files {
+		if e.File == "broken.NRW" {
+			if e.Error == "" {
+				t.Errorf("Expected an error in the manifest: %+v\n", e)
+			}
+			continue
+		}
+		data, _ := json.Marshal(e)
+		wantData, _ := json.Marshal(want[e.File])
+		if string(data) != string(wantData) {
+			t.Errorf("Expected %s; got %s\n", wantData, data)
+		}
+	}
+
+	// the thumbnail is resized; the sidecar and manifest are written
+	f, err := os.Open(filepath.Join(dest, "b.NRW_32.jpg"))
+	if err != nil {
+		t.Fatalf("Thumbnail not found: %v\n", err)
+	}
+	defer f.Close()
+	if cfg, err := jpeg.DecodeConfig(f); err != nil || cfg.Width != 32 || cfg.Height != 24 {
+		t.Errorf("Unexpected thumbnail: %+v, %v\n", cfg, err)
+	}
+	if findExifEntry(readJpegExif(t, f.Name()), tiff.KindExif, 0xa420) == nil {
+		t.Error("Missing ImageUniqueID in the thumbnail EXIF data")
+	}
+
+	var sidecar map[string]any
+	if data, err := os.ReadFile(filepath.Join(dest, "day1", "a.NRW.json")); err != nil || json.Unmarshal(data, &sidecar) != nil {
+		t.Fatalf("Unexpected sidecar: %v\n", err)
+	}
+	if sidecar["photoID"] != "id-a" || sidecar["previewWidth"] != float64(64) {
+		t.Errorf("Unexpected sidecar: %v\n", sidecar)
+	}
+
+	var written Manifest
+	if data, err := os.ReadFile(filepath.Join(dest, "manifest.json")); err != nil || json.Unmarshal(data, &written) != nil {
+		t.Fatalf("Unexpected manifest file: %v\n", err)
+	}
+	if len(written.Files) != len(m.Files) {
+		t.Errorf("Unexpected manifest file: %+v\n", written)
+	}
+}
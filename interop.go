@@ -0,0 +1,52 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"container/list"
+	"io"
+)
+
+// processInteropIfd reads the interoperability IFD referenced by the
+// entry of the EXIF IFD.  Errors are recorded; see readFailed.
+func processInteropIfd(isHostLe, isFileBe bool, entry *IfdEntry, f io.ReaderAt, m *rawMetadata) {
+	entries, err := processIfdOf(isHostLe, isFileBe, entry, f)
+	if err != nil {
+		m.readFailed("Interop IFD", 0, err)
+	}
+	processInteropEntries(entries, m)
+}
+
+// processInteropEntries reads the InteroperabilityIndex of an
+// interoperability IFD.
+func processInteropEntries(entries *list.List, m *rawMetadata) {
+	m.tags.record(entries, interopTags)
+
+	for e := entries.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(IfdEntry)
+		if entry.tag == 0x0001 { // InteroperabilityIndex
+			m.interopIndex = m.readASCIIEntry("Interop IFD", &entry)
+		}
+	}
+}
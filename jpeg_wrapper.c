@@ -84,7 +84,7 @@ my_error_exit (j_common_ptr cinfo)
 
 // Derived from turbojpeg documenation and
 //  http://blog.thelifeofkenneth.com/2012/07/decompressing-jpegs-in-ram.html
-int decompressJpeg(unsigned char *data, size_t len, unsigned char **buf, unsigned long *bufSize, int *width, int *height)
+int decompressJpeg(unsigned char *data, size_t len, int scaleDenom, unsigned char **buf, unsigned long *bufSize, int *width, int *height)
 {
     int row_stride, pixel_size;
 
@@ -116,15 +116,19 @@ int decompressJpeg(unsigned char *data, size_t len, unsigned char **buf, unsigne
         return 1;
     }
 
-    // Setup decompression structure
-    cinfo.err = jpeg_std_error((struct jpeg_error_mgr *)&jerr);
-
+    // Setup decompression structure; the error handler is set above
     jpeg_create_decompress(&cinfo);
 
     jpeg_mem_src(&cinfo, data, len);
 
     // read info from header.
     (void) jpeg_read_header(&cinfo, TRUE);
+
+    // Scale by 1/scaleDenom (2, 4, or 8) while decoding: the scaled DCT
+    // skips most of the work of a full decode.  The output is always RGB.
+    cinfo.scale_num = 1;
+    cinfo.scale_denom = scaleDenom;
+    cinfo.out_color_space = JCS_RGB;
     jpeg_start_decompress(&cinfo);
 
 
@@ -182,7 +186,8 @@ int decompressJpeg(unsigned char *data, size_t len, unsigned char **buf, unsigne
 }
 
 inline int
-decodeEncodeWrite(unsigned char *ci, int ciLen, int quality, char *filename)
+decodeEncodeWrite(unsigned char *ci, int ciLen, int quality,
+                  int subsampling444, int progressive, char *filename)
 {
 
     // Pointer to decoded jpeg image.  Note: this function MUST free when
@@ -192,7 +197,7 @@ decodeEncodeWrite(unsigned char *ci, int ciLen, int quality, char *filename)
     int rc, w, h;
 
 
-    rc = decompressJpeg(ci, ciLen, &buffer, &bufLen, &w, &h);
+    rc = decompressJpeg(ci, ciLen, 1, &buffer, &bufLen, &w, &h);
 
     if (rc != 0)
     {
@@ -264,6 +269,18 @@ decodeEncodeWrite(unsigned char *ci, int ciLen, int quality, char *filename)
      * Here we just illustrate the use of quality (quantization table) scaling:
      */
     jpeg_set_quality(&cinfo, quality, TRUE /* limit to baseline-JPEG values */);
+    /* The defaults subsample the chroma 2x2 (4:2:0); 4:4:4 samples the
+     * luminance at the chroma resolution.
+     */
+    if (subsampling444)
+    {
+        cinfo.comp_info[0].h_samp_factor = 1;
+        cinfo.comp_info[0].v_samp_factor = 1;
+    }
+    if (progressive)
+    {
+        jpeg_simple_progression(&cinfo);
+    }
 
     /* Step 4: Start compressor */
 
@@ -316,3 +333,18 @@ cleanupString(char *c)
 {
     free(c);
 }
+
+int
+decodeScaled(unsigned char *ci, int ciLen, int scaleDenom,
+             unsigned char **buf, int *width, int *height)
+{
+    unsigned long bufLen;
+
+    return decompressJpeg(ci, ciLen, scaleDenom, buf, &bufLen, width, height);
+}
+
+void
+cleanupBuffer(unsigned char *buf)
+{
+    free(buf);
+}
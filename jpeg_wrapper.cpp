@@ -11,7 +11,8 @@ cleanupString(char *c)
 }
 
 extern "C" int
-decodeEncodeWrite(unsigned char *ci, int ciLen, int quality, char *filename)
+decodeEncodeWrite(unsigned char *ci, int ciLen, int quality,
+                  int subsampling444, int progressive, char *filename)
 {
     static const int requestedComps = 3; // RGB
     int actualComps, w, h;
@@ -24,6 +25,10 @@ decodeEncodeWrite(unsigned char *ci, int ciLen, int quality, char *filename)
         // default params are OK for color images
         jpge::params p;
         p.m_quality = quality;
+        if (subsampling444) {
+            p.m_subsampling = jpge::H1V1;
+        }
+        // progressive is not supported by jpge; see decodeAndWriteJpeg
 
         // compress using requested quality
         bool result = jpge::compress_image_to_jpeg_file(
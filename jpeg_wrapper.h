@@ -29,10 +29,19 @@ extern "C" {
 #endif
 
 int
-decodeEncodeWrite(unsigned char *ci, int ciLen, int quality, char *filename);
+decodeEncodeWrite(unsigned char *ci, int ciLen, int quality,
+                  int subsampling444, int progressive, char *filename);
 
 void cleanupString(char *c);
 
+// decodeScaled decodes a JPEG scaled by 1/scaleDenom to RGB; the caller
+// frees buf by cleanupBuffer.  Not implemented by the jpegcpp backend.
+int
+decodeScaled(unsigned char *ci, int ciLen, int scaleDenom,
+             unsigned char **buf, int *width, int *height);
+
+void cleanupBuffer(unsigned char *buf);
+
 #ifdef __cplusplus
 }
 #endif
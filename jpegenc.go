@@ -0,0 +1,551 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bufio"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// encodeJpeg encodes an image as JPEG using a quality parameter from 1 to
+// 100 and the JpegOptions.  The default options are encoded by the
+// image/jpeg package; the others, which image/jpeg does not support, by
+// jpegWriter.
+// Returns nil on success or error.
+func encodeJpeg(w io.Writer, img image.Image, quality int, opts JpegOptions) error {
+	if opts == (JpegOptions{}) {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	}
+	return writeJpeg(w, img, quality, opts)
+}
+
+// jpegEncoder returns an imageEncoder encoding JPEG with the JpegOptions.
+func jpegEncoder(opts JpegOptions) imageEncoder {
+	return func(w io.Writer, img image.Image, quality int) error {
+		return encodeJpeg(w, img, quality, opts)
+	}
+}
+
+// jpegUnzig maps the zig-zag order of the coefficients of a block to their
+// natural order.
+var jpegUnzig = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// jpegQuant are the luminance and chrominance quantization tables of
+// section K.1 of the JPEG specification, in zig-zag order, scaled by the
+// quality as by image/jpeg and libjpeg.
+var jpegQuant = [2][64]byte{
+	{
+		16, 11, 12, 14, 12, 10, 16, 14,
+		13, 14, 18, 17, 16, 19, 24, 40,
+		26, 24, 22, 22, 24, 49, 35, 37,
+		29, 40, 58, 51, 61, 60, 57, 51,
+		56, 55, 64, 72, 92, 78, 64, 68,
+		87, 69, 55, 56, 80, 109, 81, 87,
+		95, 98, 103, 104, 103, 62, 77, 113,
+		121, 112, 100, 120, 92, 101, 103, 99,
+	},
+	{
+		17, 18, 18, 24, 21, 24, 47, 26,
+		26, 47, 99, 66, 56, 66, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+// jpegHuffmanSpec is a Huffman table: the number of codes of each length,
+// from 1 to 16 bits, and the values coded, in order of their codes.
+type jpegHuffmanSpec struct {
+	count [16]byte
+	value []byte
+}
+
+// jpegHuffmanSpecs are the luminance DC and AC and the chrominance DC and
+// AC Huffman tables of section K.3 of the JPEG specification.  The AC
+// tables code the end of band (0x00) used by the progressive scans, which
+// code a single block per end of band run.
+var jpegHuffmanSpecs = [4]jpegHuffmanSpec{
+	{
+		[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		[]byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+	{
+		[16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+}
+
+// jpegHuffmanCode is the code, of size bits, of a value.
+type jpegHuffmanCode struct {
+	code uint16
+	size uint8
+}
+
+// codes computes the code of each value of the Huffman table.
+func (s *jpegHuffmanSpec) codes() (t [256]jpegHuffmanCode) {
+	code, k := uint16(0), 0
+	for i, n := range s.count {
+		for range n {
+			t[s.value[k]] = jpegHuffmanCode{code, uint8(i + 1)}
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return t
+}
+
+// jpegDctCos are the cosines of the forward DCT, including the scale
+// factors: jpegDctCos[u][x] = C(u)/2 * cos((2x+1)uπ/16).
+var jpegDctCos = func() (c [8][8]float64) {
+	for u := range 8 {
+		scale := 0.5
+		if u == 0 {
+			scale = 0.5 / math.Sqrt2
+		}
+		for x := range 8 {
+			c[u][x] = scale * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16)
+		}
+	}
+	return c
+}()
+
+// jpegComponent is a component of an image being encoded by jpegWriter.
+type jpegComponent struct {
+	h, v  int // sampling factors
+	table int // quantization and Huffman tables: 0 luminance, 1 chrominance
+
+	// blocksX and blocksY are the dimensions, in blocks, of the component,
+	// padded to whole MCUs; width and height those of the blocks covering
+	// its samples, coded by non-interleaved scans.
+	blocksX, blocksY int
+	width, height    int
+
+	// blocks are the quantized coefficients, in zig-zag order, of the
+	// blocks of the component, row by row.
+	blocks [][64]int16
+}
+
+// jpegWriter writes a JPEG, baseline or progressive, with 4:2:0 or 4:4:4
+// chroma subsampling, using the standard Huffman tables.  Progressive
+// JPEGs are coded by spectral selection: a scan of the DC coefficients of
+// all components, followed by scans of bands of the AC coefficients of
+// each component.
+type jpegWriter struct {
+	w   *bufio.Writer
+	err error
+
+	quant         [2][64]byte
+	huffman       [4][256]jpegHuffmanCode
+	comps         [3]jpegComponent
+	mcusX, mcusY  int
+	width, height int
+
+	acc  uint64 // pending bits of the entropy-coded segment
+	nAcc uint
+}
+
+// writeJpeg encodes an image as JPEG using a quality parameter from 1 to
+// 100 and the JpegOptions.
+// Returns nil on success or error.
+func writeJpeg(w io.Writer, img image.Image, quality int, opts JpegOptions) error {
+	b := img.Bounds()
+	if b.Dx() < 1 || b.Dy() < 1 || b.Dx() > maxJpegDimension || b.Dy() > maxJpegDimension {
+		return errors.New("jpeg: image is too large or empty to encode")
+	}
+
+	e := &jpegWriter{w: bufio.NewWriter(w), width: b.Dx(), height: b.Dy()}
+	e.init(quality, opts.Subsampling)
+	e.transform(img)
+
+	e.writeHeaders(opts.Progressive)
+	if opts.Progressive {
+		e.writeScan([]int{0, 1, 2}, 0, 0)
+		e.writeScan([]int{0}, 1, 5)
+		e.writeScan([]int{1}, 1, 63)
+		e.writeScan([]int{2}, 1, 63)
+		e.writeScan([]int{0}, 6, 63)
+	} else {
+		e.writeScan([]int{0, 1, 2}, 0, 63)
+	}
+	e.write(0xff, 0xd9)
+
+	if e.err == nil {
+		e.err = e.w.Flush()
+	}
+	return e.err
+}
+
+// init scales the quantization tables, computes the Huffman codes, and
+// lays out the components.
+func (e *jpegWriter) init(quality int, subsampling Subsampling) {
+	quality = min(max(quality, 1), 100)
+	scale := 200 - quality*2
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	for i := range e.quant {
+		for j, q := range jpegQuant[i] {
+			e.quant[i][j] = byte(min(max((int(q)*scale+50)/100, 1), 255))
+		}
+	}
+	for i := range e.huffman {
+		e.huffman[i] = jpegHuffmanSpecs[i].codes()
+	}
+
+	hmax := 1
+	e.comps[0] = jpegComponent{h: 1, v: 1}
+	if subsampling == Subsampling420 {
+		hmax = 2
+		e.comps[0] = jpegComponent{h: 2, v: 2}
+	}
+	e.comps[1] = jpegComponent{h: 1, v: 1, table: 1}
+	e.comps[2] = jpegComponent{h: 1, v: 1, table: 1}
+
+	e.mcusX = (e.width + 8*hmax - 1) / (8 * hmax)
+	e.mcusY = (e.height + 8*hmax - 1) / (8 * hmax)
+	for i := range e.comps {
+		c := &e.comps[i]
+		c.blocksX, c.blocksY = e.mcusX*c.h, e.mcusY*c.v
+		c.width = ((e.width*c.h+hmax-1)/hmax + 7) / 8
+		c.height = ((e.height*c.v+hmax-1)/hmax + 7) / 8
+		c.blocks = make([][64]int16, c.blocksX*c.blocksY)
+	}
+}
+
+// transform converts the image to YCbCr and computes the quantized DCT
+// coefficients of the blocks of each component.  The image is padded by
+// repeating its right and bottom edges.
+func (e *jpegWriter) transform(img image.Image) {
+	planes := ycbcrPlanes(img)
+
+	var samples [64]float64
+	for i := range e.comps {
+		c := &e.comps[i]
+		step := e.comps[0].h / c.h // 2 for subsampled chroma
+		for by := range c.blocksY {
+			for bx := range c.blocksX {
+				for y := range 8 {
+					for x := range 8 {
+						samples[y*8+x] = e.sample(planes[i], (bx*8+x)*step, (by*8+y)*step, step) - 128
+					}
+				}
+				fdct(&samples)
+				quantize(&c.blocks[by*c.blocksX+bx], &samples, &e.quant[c.table])
+			}
+		}
+	}
+}
+
+// sample returns the mean of the step x step pixels of a plane at x, y,
+// clamped to the image.
+func (e *jpegWriter) sample(plane []uint8, x, y, step int) float64 {
+	sum := 0
+	for dy := range step {
+		row := min(y+dy, e.height-1) * e.width
+		for dx := range step {
+			sum += int(plane[row+min(x+dx, e.width-1)])
+		}
+	}
+	return float64(sum) / float64(step*step)
+}
+
+// ycbcrPlanes converts an image to full resolution Y, Cb, and Cr planes.
+func ycbcrPlanes(img image.Image) [3][]uint8 {
+	b := img.Bounds()
+	n := b.Dx() * b.Dy()
+	planes := [3][]uint8{make([]uint8, n), make([]uint8, n), make([]uint8, n)}
+
+	i := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var yy, cb, cr uint8
+			switch m := img.(type) {
+			case *image.YCbCr:
+				yi, ci := m.YOffset(x, y), m.COffset(x, y)
+				yy, cb, cr = m.Y[yi], m.Cb[ci], m.Cr[ci]
+			case *image.Gray:
+				yy, cb, cr = m.Pix[m.PixOffset(x, y)], 128, 128
+			default:
+				r, g, b, _ := img.At(x, y).RGBA()
+				yy, cb, cr = color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+			}
+			planes[0][i], planes[1][i], planes[2][i] = yy, cb, cr
+			i++
+		}
+	}
+	return planes
+}
+
+// fdct computes the forward DCT of a block of level-shifted samples, in
+// place, in natural order.
+func fdct(s *[64]float64) {
+	var t [64]float64
+	for y := range 8 {
+		for u := range 8 {
+			sum := 0.0
+			for x := range 8 {
+				sum += jpegDctCos[u][x] * s[y*8+x]
+			}
+			t[y*8+u] = sum
+		}
+	}
+	for v := range 8 {
+		for u := range 8 {
+			sum := 0.0
+			for y := range 8 {
+				sum += jpegDctCos[v][y] * t[y*8+u]
+			}
+			s[v*8+u] = sum
+		}
+	}
+}
+
+// quantize quantizes the DCT coefficients of a block by the quantization
+// table, both in zig-zag order, into dst.
+func quantize(dst *[64]int16, s *[64]float64, q *[64]byte) {
+	for k := range 64 {
+		c := math.Round(s[jpegUnzig[k]] / float64(q[k]))
+		dst[k] = int16(min(max(c, -1023), 1023))
+	}
+}
+
+// write writes bytes, recording the first error.
+func (e *jpegWriter) write(p ...byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(p)
+	}
+}
+
+// writeByte writes a byte, recording the first error.
+func (e *jpegWriter) writeByte(b byte) {
+	if e.err == nil {
+		e.err = e.w.WriteByte(b)
+	}
+}
+
+// writeMarker writes a marker segment.
+func (e *jpegWriter) writeMarker(marker byte, data []byte) {
+	e.write(0xff, marker, byte((len(data)+2)>>8), byte(len(data)+2))
+	e.write(data...)
+}
+
+// writeHeaders writes the start of image, the quantization tables, the
+// start of frame, and the Huffman tables.
+func (e *jpegWriter) writeHeaders(progressive bool) {
+	e.write(0xff, 0xd8)
+
+	var dqt []byte
+	for i := range e.quant {
+		dqt = append(dqt, byte(i))
+		dqt = append(dqt, e.quant[i][:]...)
+	}
+	e.writeMarker(0xdb, dqt)
+
+	marker := byte(0xc0)
+	if progressive {
+		marker = 0xc2
+	}
+	sof := []byte{8, byte(e.height >> 8), byte(e.height), byte(e.width >> 8), byte(e.width), byte(len(e.comps))}
+	for i, c := range e.comps {
+		sof = append(sof, byte(i+1), byte(c.h<<4|c.v), byte(c.table))
+	}
+	e.writeMarker(marker, sof)
+
+	var dht []byte
+	for i, s := range jpegHuffmanSpecs {
+		// class (DC 0, AC 1) and table
+		dht = append(dht, byte(i%2<<4|i/2))
+		dht = append(dht, s.count[:]...)
+		dht = append(dht, s.value...)
+	}
+	e.writeMarker(0xc4, dht)
+}
+
+// writeScan writes a scan of the coefficients ss to se, in zig-zag order,
+// of the components.  A scan of several components is interleaved.
+func (e *jpegWriter) writeScan(comps []int, ss, se int) {
+	sos := []byte{byte(len(comps))}
+	for _, i := range comps {
+		t := e.comps[i].table
+		sos = append(sos, byte(i+1), byte(t<<4|t))
+	}
+	sos = append(sos, byte(ss), byte(se), 0)
+	e.writeMarker(0xda, sos)
+
+	var pred [3]int16
+	if len(comps) > 1 {
+		for my := range e.mcusY {
+			for mx := range e.mcusX {
+				for _, i := range comps {
+					c := &e.comps[i]
+					for v := range c.v {
+						for h := range c.h {
+							e.writeBlock(c, &c.blocks[(my*c.v+v)*c.blocksX+mx*c.h+h], ss, se, &pred[i])
+						}
+					}
+				}
+			}
+		}
+	} else {
+		c := &e.comps[comps[0]]
+		for by := range c.height {
+			for bx := range c.width {
+				e.writeBlock(c, &c.blocks[by*c.blocksX+bx], ss, se, &pred[comps[0]])
+			}
+		}
+	}
+
+	// pad the last byte with 1 bits
+	e.emit(0x7f, 7)
+	e.acc, e.nAcc = 0, 0
+}
+
+// writeBlock codes the coefficients ss to se of a block; pred is the DC
+// coefficient of the previous block of the component.
+func (e *jpegWriter) writeBlock(c *jpegComponent, b *[64]int16, ss, se int, pred *int16) {
+	dc, ac := &e.huffman[2*c.table], &e.huffman[2*c.table+1]
+	if ss == 0 {
+		e.emitValue(dc, 0, b[0]-*pred)
+		*pred = b[0]
+	}
+
+	run := 0
+	for k := max(ss, 1); k <= se; k++ {
+		if b[k] == 0 {
+			run++
+			continue
+		}
+		for ; run > 15; run -= 16 {
+			e.emitCode(ac, 0xf0)
+		}
+		e.emitValue(ac, run, b[k])
+		run = 0
+	}
+	if run > 0 {
+		e.emitCode(ac, 0x00)
+	}
+}
+
+// emitValue codes a value, preceded by a run of zero coefficients, by its
+// size category and its bits.
+func (e *jpegWriter) emitValue(t *[256]jpegHuffmanCode, run int, value int16) {
+	v := int32(value)
+	size := uint(bits.Len32(uint32(max(v, -v))))
+	e.emitCode(t, byte(run<<4)|byte(size))
+	if v < 0 {
+		v--
+	}
+	e.emit(uint32(v), size)
+}
+
+// emitCode codes a value of a Huffman table.
+func (e *jpegWriter) emitCode(t *[256]jpegHuffmanCode, value byte) {
+	e.emit(uint32(t[value].code), uint(t[value].size))
+}
+
+// emit appends n bits to the entropy-coded segment, stuffing a zero byte
+// after each 0xff byte.
+func (e *jpegWriter) emit(bits uint32, n uint) {
+	e.acc = e.acc<<n | uint64(bits&(1<<n-1))
+	e.nAcc += n
+	for e.nAcc >= 8 {
+		b := byte(e.acc >> (e.nAcc - 8))
+		e.writeByte(b)
+		if b == 0xff {
+			e.writeByte(0)
+		}
+		e.nAcc -= 8
+	}
+}
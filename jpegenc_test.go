@@ -0,0 +1,157 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testColorImage returns an RGBA image with colored gradients.
+func testColorImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / width), uint8(y * 255 / height), uint8((x + y) * 4), 255})
+		}
+	}
+	return img
+}
+
+// meanError returns the mean absolute difference of the RGB channels of
+// two images of the same size.
+func meanError(a, b image.Image) float64 {
+	sum, n := 0, 0
+	for y := a.Bounds().Min.Y; y < a.Bounds().Max.Y; y++ {
+		for x := a.Bounds().Min.X; x < a.Bounds().Max.X; x++ {
+			ar, ag, ab, _ := a.At(x, y).RGBA()
+			br, bg, bb, _ := b.At(x, y).RGBA()
+			for _, d := range []int{int(ar>>8) - int(br>>8), int(ag>>8) - int(bg>>8), int(ab>>8) - int(bb>>8)} {
+				sum += max(d, -d)
+				n++
+			}
+		}
+	}
+	return float64(sum) / float64(n)
+}
+
+func TestEncodeJpegOptions(t *testing.T) {
+	src := testColorImage(37, 23) // not a whole number of MCUs
+
+	tests := []struct {
+		opts  JpegOptions
+		ratio image.YCbCrSubsampleRatio
+	}{
+		{JpegOptions{}, image.YCbCrSubsampleRatio420},
+		{JpegOptions{Subsampling: Subsampling444}, image.YCbCrSubsampleRatio444},
+		{JpegOptions{Progressive: true}, image.YCbCrSubsampleRatio420},
+		{JpegOptions{Subsampling: Subsampling444, Progressive: true}, image.YCbCrSubsampleRatio444},
+	}
+
+	for _, test := range tests {
+		var b bytes.Buffer
+		if err := encodeJpeg(&b, src, 90, test.opts); err != nil {
+			t.Fatalf("Unexpected error encoding %+v: %v\n", test.opts, err)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(b.Bytes()))
+		if err != nil {
+			t.Fatalf("Unexpected error decoding %+v: %v\n", test.opts, err)
+		}
+
+		ycbcr, ok := img.(*image.YCbCr)
+		if !ok || ycbcr.SubsampleRatio != test.ratio || img.Bounds() != src.Bounds() {
+			t.Errorf("Unexpected image encoding %+v: %T %v\n", test.opts, img, img.Bounds())
+		}
+		if progressive := bytes.Contains(b.Bytes(), []byte{0xff, 0xc2}); progressive != test.opts.Progressive {
+			t.Errorf("Unexpected progressive encoding %+v\n", test.opts)
+		}
+		if e := meanError(src, img); e > 4 {
+			t.Errorf("Unexpected mean error encoding %+v: %f\n", test.opts, e)
+		}
+	}
+}
+
+func TestAutoQuality(t *testing.T) {
+	src := testColorImage(64, 48)
+	encode := jpegEncoder(JpegOptions{Progressive: true})
+
+	size := func(q int) int {
+		var n byteCounter
+		if err := encode(&n, src, q); err != nil {
+			t.Fatalf("Unexpected error encoding: %v\n", err)
+		}
+		return int(n)
+	}
+
+	limit := size(70)
+	q, err := autoQuality(src, limit, encode)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if q < 70 || size(q) > limit || (q < 100 && size(q+1) <= limit) {
+		t.Errorf("Unexpected quality: %d\n", q)
+	}
+
+	if q, _ := autoQuality(src, 0, encode); q != 1 {
+		t.Errorf("Unexpected quality without a fitting size: %d\n", q)
+	}
+}
+
+// TestProcessFileJpegOptions verifies the encoding of an extracted
+// preview, by the JPEG backend of the build, per the JpegOptions and
+// QualityAuto.
+func TestProcessFileJpegOptions(t *testing.T) {
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, testColorImage(320, 240), &jpeg.Options{Quality: 80}); err != nil {
+		t.Fatalf("Error encoding test jpeg: %v\n", err)
+	}
+	path, dir := writeTestFile(t, "preview.jpg", b.Bytes())
+
+	opts := JpegOptions{Subsampling: Subsampling444, Progressive: true}
+	out := filepath.Join(dir, "out.jpg")
+	if err := encodeAndWrite(b.Bytes(), OutputJpeg, QualityAuto, opts, ColorSpaceSRGB, out, nil); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Unexpected error reading %s: %v\n", out, err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error decoding %s: %v\n", out, err)
+	}
+	if ycbcr, ok := img.(*image.YCbCr); !ok || ycbcr.SubsampleRatio != image.YCbCrSubsampleRatio444 {
+		t.Errorf("Unexpected subsampling: %T\n", img)
+	}
+	if !bytes.Contains(data, []byte{0xff, 0xc2}) {
+		t.Error("Expected a progressive JPEG")
+	}
+	t.Logf("Re-encoded %s: %d bytes, from %d\n", path, len(data), b.Len())
+}
@@ -26,55 +26,49 @@
 package rawparser
 
 import (
-	"bytes"
 	"image"
-	"image/jpeg"
 	"log"
 	"os"
 )
 
+// nativeJpeg is true if the JPEG backend is a native library, rather than
+// the pure-Go encoder.
+const nativeJpeg = false
+
 func init() {
 	log.Println("Using pure GO JPEG package")
 }
 
-func decodeAndWriteJpeg(data []byte, quality int, filename string) error {
-	jpegFile, err := os.Create(filename)
-	defer jpegFile.Close()
+func decodeAndWriteJpeg(data []byte, quality int, opts JpegOptions, filename string) error {
+	// Decode image
+	decodedImage, err := decodeJpeg(data)
 	if err != nil {
-		log.Printf("Error creating jpeg file: %v\n", err)
+		log.Printf("Error decoding embedded jpeg: %v\n", err)
 		return err
 	}
 
-	// Decode image
-	decodedImage, err := decodeJpeg(data)
+	jpegFile, err := os.Create(filename)
 	if err != nil {
-		log.Printf("Error decoding embedded jpeg: %v\n", err)
+		log.Printf("Error creating jpeg file: %v\n", err)
 		return err
 	}
 
 	// Encode and write using specifid JPEG quality
-	err = encodeAndWriteJpeg(jpegFile, decodedImage, quality)
+	err = encodeAndWriteJpeg(jpegFile, decodedImage, quality, opts)
+	if cerr := jpegFile.Close(); err == nil {
+		err = cerr
+	}
 	if err != nil {
 		log.Printf("Error encoding embedded jpeg: %v\n", err)
 	}
 	return err
 }
 
-func decodeJpeg(data []byte) (img image.Image, e error) {
-	// Decode JPEG
-	bReader := bytes.NewReader(data)
-	img, e = jpeg.Decode(bReader)
-	if e != nil {
-		log.Printf("Error decoding embedded jpeg: %v\n", e)
-		return nil, e
-	}
-	return img, e
-}
-
 // encodeAndWriteJpeg encodes a JPEG image based on a JPEG quality parameter
-// from 1 to 100, where 100 is the best encoding quality.
-func encodeAndWriteJpeg(f *os.File, img image.Image, q int) error {
-	e := jpeg.Encode(f, img, &jpeg.Options{q})
+// from 1 to 100, where 100 is the best encoding quality, and the
+// JpegOptions.
+func encodeAndWriteJpeg(f *os.File, img image.Image, q int, opts JpegOptions) error {
+	e := encodeJpeg(f, img, q, opts)
 	if e != nil {
 		log.Printf("Error encoding and writing embedded jpeg: %v\n", e)
 	}
@@ -34,6 +34,7 @@ import "C"
 import (
 	"fmt"
 	"log"
+	"os"
 	"unsafe"
 )
 
@@ -41,13 +42,22 @@ func init() {
 	log.Println("Using standalone C++ native library")
 }
 
-func decodeAndWriteJpeg(data []byte, quality int, filename string) error {
+// nativeJpeg reports the jpgd/jpge backend, writing files only.
+const nativeJpeg = true
+
+func decodeAndWriteJpeg(data []byte, quality int, opts JpegOptions, filename string) error {
+	if opts.Progressive {
+		// jpge writes baseline JPEGs only
+		return writeJpegFile(data, quality, opts, filename)
+	}
+
 	var rc C.int
 	f := C.CString(filename)
 	defer C.cleanupString(f)
 
+	subsampling444, progressive := opts.flags()
 	rc = C.decodeEncodeWrite((*C.uchar)(unsafe.Pointer(&data[0])),
-		C.int(len(data)), C.int(quality), f)
+		C.int(len(data)), C.int(quality), C.int(subsampling444), C.int(progressive), f)
 
 	if rc != 0 {
 		return fmt.Errorf("error re-encoding JPEG")
@@ -55,3 +65,23 @@ func decodeAndWriteJpeg(data []byte, quality int, filename string) error {
 
 	return nil
 }
+
+// writeJpegFile decodes the embedded jpeg data and writes it, re-encoded by
+// encodeJpeg, to a new file.
+// Returns nil on success or error.
+func writeJpegFile(data []byte, quality int, opts JpegOptions, filename string) error {
+	img, err := decodeJpeg(data)
+	if err != nil {
+		return err
+	}
+
+	jpegFile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = encodeJpeg(jpegFile, img, quality, opts)
+	if cerr := jpegFile.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
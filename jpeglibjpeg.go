@@ -42,13 +42,17 @@ func init() {
 	log.Println("Using libjpeg native library")
 }
 
-func decodeAndWriteJpeg(data []byte, quality int, filename string) error {
+// nativeJpeg reports the libjpeg backend, writing files only.
+const nativeJpeg = true
+
+func decodeAndWriteJpeg(data []byte, quality int, opts JpegOptions, filename string) error {
 	var rc C.int
 	f := C.CString(filename)
 	defer C.cleanupString(f)
 
+	subsampling444, progressive := opts.flags()
 	rc = C.decodeEncodeWrite((*C.uchar)(unsafe.Pointer(&data[0])),
-		C.int(len(data)), C.int(quality), f)
+		C.int(len(data)), C.int(quality), C.int(subsampling444), C.int(progressive), f)
 
 	if rc != 0 {
 		return fmt.Errorf("error re-encoding JPEG")
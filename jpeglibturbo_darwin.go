@@ -29,29 +29,10 @@ package rawparser
 
 // #cgo CFLAGS: -I/usr/local/opt/jpeg-turbo/include -O2
 // #cgo LDFLAGS: -L/usr/local/opt/jpeg-turbo/lib -lturbojpeg
-// #include "jpeg_wrapper.h"
 import "C"
 
-import (
-	"fmt"
-	"log"
-	"unsafe"
-)
+import "log"
 
 func init() {
 	log.Println("Using turbojpeg native library")
 }
-
-func decodeAndWriteJpeg(data []byte, quality int, filename string) error {
-	var rc C.int
-	f := C.CString(filename)
-	defer C.cleanupString(f)
-
-	rc = C.decodeEncodeWrite((*C.uchar)(unsafe.Pointer(&data[0])),
-		C.int(len(data)), C.int(quality), f)
-
-	if rc != 0 {
-		return fmt.Errorf("error re-encoding JPEG")
-	}
-	return nil
-}
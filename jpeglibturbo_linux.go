@@ -25,37 +25,17 @@
 
 package rawparser
 
-// Note: modify these flags for your enviornment if required.
-// The Ubuntu Linux servers on Travis CI use apt-get and the
-// the .travis.yml is configured to retrieve the turbo jpeg
-// package which overwrites the symlink for libjpeg, as turbo
-// jpeg is interface compatible.
+// Note: the flags are read from the libjpeg.pc installed by libjpeg-turbo
+// (e.g., the libjpeg-turbo8-dev package of Ubuntu, which replaces
+// libjpeg, as turbo jpeg is interface compatible).  Set PKG_CONFIG_PATH
+// if libjpeg-turbo is installed elsewhere, e.g., /opt/libjpeg-turbo.
 
 // #cgo CFLAGS: -O2
-// #cgo LDFLAGS: -ljpeg
-// #include "jpeg_wrapper.h"
+// #cgo pkg-config: libjpeg
 import "C"
 
-import (
-	"fmt"
-	"log"
-	"unsafe"
-)
+import "log"
 
 func init() {
-	log.Println("Using turbojpeg native library.  Linux: AMD64.")
-}
-
-func decodeAndWriteJpeg(data []byte, quality int, filename string) error {
-	var rc C.int
-	f := C.CString(filename)
-	defer C.cleanupString(f)
-
-	rc = C.decodeEncodeWrite((*C.uchar)(unsafe.Pointer(&data[0])),
-		C.int(len(data)), C.int(quality), f)
-
-	if rc != 0 {
-		return fmt.Errorf("error re-encoding JPEG")
-	}
-	return nil
+	log.Println("Using turbojpeg native library.  Linux.")
 }
@@ -0,0 +1,60 @@
+// +build jpeg turbojpeg
+
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+// #include "jpeg_wrapper.h"
+import "C"
+
+import (
+	"fmt"
+	"image"
+	"unsafe"
+)
+
+// maxDecodeScale is the largest reduction the JPEG backend scales by while
+// decoding: 1/8, by the scaled DCT of libjpeg.
+const maxDecodeScale = 8
+
+// decodeJpegScaled decodes the embedded jpeg data scaled by 1/denom, where
+// denom is 2, 4, or 8, by libjpeg.  This is several times faster than a
+// full decode followed by resizeImage.
+// Returns the decoded image or error.
+func decodeJpegScaled(data []byte, denom int) (image.Image, error) {
+	var buf *C.uchar
+	var w, h C.int
+	rc := C.decodeScaled((*C.uchar)(unsafe.Pointer(&data[0])), C.int(len(data)), C.int(denom), &buf, &w, &h)
+	if rc != 0 || buf == nil {
+		return nil, fmt.Errorf("error decoding JPEG scaled by 1/%d", denom)
+	}
+	defer C.cleanupBuffer(buf)
+
+	rgb := unsafe.Slice((*byte)(unsafe.Pointer(buf)), int(w)*int(h)*3)
+	img := image.NewRGBA(image.Rect(0, 0, int(w), int(h)))
+	for i, j := 0, 0; i < len(rgb); i, j = i+3, j+4 {
+		img.Pix[j], img.Pix[j+1], img.Pix[j+2], img.Pix[j+3] = rgb[i], rgb[i+1], rgb[i+2], 0xff
+	}
+	return img, nil
+}
@@ -0,0 +1,132 @@
+// +build jxl
+
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+// Note: modify these flags for your enviornment if required.
+
+// #cgo CFLAGS: -O2
+// #cgo LDFLAGS: -ljxl
+// #include <stdlib.h>
+// #include <jxl/encode.h>
+//
+// static int encodeJxl(unsigned char *rgb, int width, int height, int quality,
+//                      unsigned char **out, size_t *outSize) {
+//     JxlEncoder *encoder = JxlEncoderCreate(NULL);
+//     JxlEncoderFrameSettings *settings;
+//     JxlBasicInfo info;
+//     JxlColorEncoding color;
+//     JxlPixelFormat format = {3, JXL_TYPE_UINT8, JXL_NATIVE_ENDIAN, 0};
+//     JxlEncoderStatus rc;
+//     size_t size = 64 * 1024, avail;
+//     unsigned char *buf, *next, *grown;
+//
+//     if (encoder == NULL) {
+//         return -1;
+//     }
+//
+//     JxlEncoderInitBasicInfo(&info);
+//     info.xsize = width;
+//     info.ysize = height;
+//     info.bits_per_sample = 8;
+//     info.num_color_channels = 3;
+//     info.uses_original_profile = JXL_FALSE;
+//     JxlColorEncodingSetToSRGB(&color, JXL_FALSE);
+//
+//     settings = JxlEncoderFrameSettingsCreate(encoder, NULL);
+//     if (JxlEncoderSetBasicInfo(encoder, &info) != JXL_ENC_SUCCESS ||
+//         JxlEncoderSetColorEncoding(encoder, &color) != JXL_ENC_SUCCESS ||
+//         JxlEncoderSetFrameDistance(settings,
+//             JxlEncoderDistanceFromQuality((float)quality)) != JXL_ENC_SUCCESS ||
+//         JxlEncoderAddImageFrame(settings, &format, rgb,
+//             (size_t)width * height * 3) != JXL_ENC_SUCCESS) {
+//         JxlEncoderDestroy(encoder);
+//         return -1;
+//     }
+//     JxlEncoderCloseInput(encoder);
+//
+//     buf = malloc(size);
+//     next = buf;
+//     avail = size;
+//     rc = JXL_ENC_NEED_MORE_OUTPUT;
+//     while (buf != NULL && rc == JXL_ENC_NEED_MORE_OUTPUT) {
+//         rc = JxlEncoderProcessOutput(encoder, &next, &avail);
+//         if (rc == JXL_ENC_NEED_MORE_OUTPUT) {
+//             size_t used = next - buf;
+//             grown = realloc(buf, size * 2);
+//             if (grown == NULL) {
+//                 free(buf);
+//                 buf = NULL;
+//                 break;
+//             }
+//             buf = grown;
+//             size *= 2;
+//             next = buf + used;
+//             avail = size - used;
+//         }
+//     }
+//     JxlEncoderDestroy(encoder);
+//
+//     if (buf == NULL || rc != JXL_ENC_SUCCESS) {
+//         free(buf);
+//         return -1;
+//     }
+//     *out = buf;
+//     *outSize = next - buf;
+//     return 0;
+// }
+import "C"
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"unsafe"
+)
+
+func init() {
+	registerEncoder(OutputJxl, encodeJxl)
+}
+
+// encodeJxl encodes an image as JPEG XL using libjxl.
+func encodeJxl(w io.Writer, img image.Image, quality int) error {
+	b := img.Bounds()
+	if b.Empty() {
+		return fmt.Errorf("error encoding JXL: empty image")
+	}
+	pix := rgbPixels(img)
+
+	var out *C.uchar
+	var outSize C.size_t
+	rc := C.encodeJxl((*C.uchar)(unsafe.Pointer(&pix[0])), C.int(b.Dx()),
+		C.int(b.Dy()), C.int(quality), &out, &outSize)
+	if rc != 0 {
+		return fmt.Errorf("error encoding JXL")
+	}
+	defer C.free(unsafe.Pointer(out))
+
+	_, err := w.Write(C.GoBytes(unsafe.Pointer(out), C.int(outSize)))
+	return err
+}
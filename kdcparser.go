@@ -0,0 +1,54 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+// KdcParserKey is a unique identifier for the KDC raw file parser.
+// This key may be used as a key the RawParsers map.
+const KdcParserKey = "KDC"
+
+// KdcParser is the struct defining the state of
+// the RawFile concept.  Implements the RawParser interface.
+// This parser provides basic parsing functionaity for the Kodak Digital
+// Camera format (KDC) of the later Kodak EasyShare bodies.  The TIFF-based
+// KDC is supported, not the proprietary layout of the earliest DC series;
+// the EXIF create time and orientation are parsed and the largest embedded
+// JPEG is extracted.
+type KdcParser struct {
+	tiffParser
+}
+
+// ProcessFile is the entry point into the KdcParser.  For a specified KDC,
+// via RawFileInfo, the file shall be processed, JPEG extracted, and
+// processed details returned to the caller.
+// Returns a pointer the RawFile data structure or error.
+func (n KdcParser) ProcessFile(info *RawFileInfo) (*RawFile, error) {
+	return n.processTiffFile(info)
+}
+
+// NewKdcParser creates an instance of KDC-specific RawParser.
+// Returns an instance of a KDC-specific RawParser.
+// The hostIsLittleEndian argument is ignored; see RawParser.
+func NewKdcParser(hostIsLittleEndian bool) (RawParser, string) {
+	return &KdcParser{tiffParser{rawParser: &rawParser{}}}, KdcParserKey
+}
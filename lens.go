@@ -0,0 +1,227 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Lens is a struct representing the lens a photo was taken with.  Fields
+// not recorded by the camera are empty.
+type Lens struct {
+	// Make and Model are the maker and the name of the lens.  The name is
+	// that recorded by the camera or, if not recorded, looked up by the
+	// lens ID of the maker note or derived from the focal lengths and
+	// apertures, e.g., "18-55mm f/3.5-5.6".
+	Make  string `json:"make,omitempty"`
+	Model string `json:"model,omitempty"`
+
+	// ID is the lens ID of the maker note: the Canon LensType, e.g.,
+	// "Canon 237", or the Nikon LensID, e.g., "Nikon 01 58 50 50 14 14 02
+	// 00".
+	ID string `json:"id,omitempty"`
+
+	// MinFocalLength and MaxFocalLength are the focal length range, in mm;
+	// equal for a prime lens.
+	MinFocalLength float64 `json:"minFocalLength,omitempty"`
+	MaxFocalLength float64 `json:"maxFocalLength,omitempty"`
+
+	// MaxApertureAtMinFocal and MaxApertureAtMaxFocal are the widest
+	// apertures, as f-numbers, at the ends of the focal length range.
+	MaxApertureAtMinFocal float64 `json:"maxApertureAtMinFocal,omitempty"`
+	MaxApertureAtMaxFocal float64 `json:"maxApertureAtMaxFocal,omitempty"`
+
+	// SerialNumber is the serial number of the lens: the EXIF
+	// LensSerialNumber or, if not recorded, the LensSerialNumber of the
+	// LensInfo of a Canon maker note.
+	SerialNumber string `json:"serialNumber,omitempty"`
+}
+
+// lensInfo is a struct representing the lens tags of a raw file.
+type lensInfo struct {
+	make, model string
+	serial      string
+	id          string
+	idName      string     // looked up by id
+	spec        [4]float64 // focal lengths and apertures, as LensInfo
+}
+
+// processLensEntry records the lens tags of the EXIF IFD (LensMake,
+// LensModel, LensSerialNumber and LensSpecification) and IFD0 (the DNG
+// LensInfo).  Errors are not fatal as the entries are optional.
+func processLensEntry(entry *IfdEntry, m *rawMetadata) {
+	switch entry.tag {
+	case 0xa433: // LensMake
+		m.lens.make, _ = entry.ASCII()
+	case 0xa434: // LensModel
+		m.lens.model, _ = entry.ASCII()
+	case 0xa435: // LensSerialNumber
+		// preferred to that of the Canon maker note
+		if serial, err := entry.ASCII(); err == nil && strings.TrimSpace(serial) != "" {
+			m.lens.serial = serial
+		}
+	case 0xa432, 0xc630: // LensSpecification, LensInfo
+		if spec, err := readLensSpec(entry, 0); err == nil {
+			m.lens.spec = spec
+		}
+	}
+}
+
+// readLensSpec reads the 4 rationals of a LensSpecification-like entry,
+// whose value offset is relative to base: the minimum and maximum focal
+// lengths and the apertures at each.
+// Returns the values or error.
+func readLensSpec(entry *IfdEntry, base int64) (spec [4]float64, err error) {
+	if entry.fieldType != 5 || entry.count != 4 {
+		return spec, fmt.Errorf("lens specification of type %d and count %d", entry.fieldType, entry.count)
+	}
+	// the offset of an entry of the file may exceed 32 bits (BigTIFF)
+	offset := entry.offset
+	if base != 0 {
+		if offset, err = addOffset(base, int64(entry.valueOffset)); err != nil {
+			return spec, err
+		}
+	}
+	b, err := readField(offset, 32, entry.r)
+	if err != nil {
+		return spec, err
+	}
+	order := entry.order
+	for i := range spec {
+		num, den := order.Uint32(b[i*8:]), order.Uint32(b[i*8+4:])
+		if den > 0 {
+			spec[i] = float64(num) / float64(den)
+		}
+	}
+	return spec, nil
+}
+
+// canonSettingsLens records the lens of the CameraSettings of a Canon
+// maker note: the LensType, named if not shared by third-party lenses,
+// and the focal lengths.
+func canonSettingsLens(settings []uint32, m *rawMetadata) {
+	if len(settings) <= 25 {
+		return
+	}
+	if lensType := uint16(settings[22]); lensType != 0 && lensType != 0xffff {
+		m.lens.id = "Canon " + strconv.Itoa(int(lensType))
+		m.lens.idName = canonLensTypes[lensType]
+	}
+	// the focal lengths, in focal units per mm
+	if units := float64(settings[25]); units > 0 && m.lens.spec[0] == 0 {
+		m.lens.spec[0] = float64(settings[24]) / units
+		m.lens.spec[1] = float64(settings[23]) / units
+	}
+}
+
+// Nikon LensData versions recording the lens ID unencrypted.
+var (
+	nikonLensData0100 = []byte("0100")
+	nikonLensData0101 = []byte("0101")
+)
+
+// nikonLensData records the LensID, and the focal lengths and apertures
+// if not recorded otherwise, of an unencrypted Nikon LensData.
+func nikonLensData(lensData []byte, lensType byte, m *rawMetadata) {
+	// LensIDNumber, LensFStops, MinFocalLength, MaxFocalLength,
+	// MaxApertureAtMinFocal, MaxApertureAtMaxFocal and MCUVersion
+	var id []byte
+	switch {
+	case len(lensData) < 0x12:
+		return
+	case bytes.HasPrefix(lensData, nikonLensData0100):
+		id = lensData[6:13]
+	case bytes.HasPrefix(lensData, nikonLensData0101):
+		id = lensData[0x0b:0x12]
+	default:
+		// encrypted
+		return
+	}
+	m.lens.id = fmt.Sprintf("Nikon % X %02X", id, lensType)
+	if m.lens.spec[0] == 0 && id[2] > 0 {
+		m.lens.spec = [4]float64{
+			nikonFocalLength(id[2]), nikonFocalLength(id[3]),
+			nikonAperture(id[4]), nikonAperture(id[5]),
+		}
+	}
+}
+
+// nikonFocalLength decodes a focal length of the Nikon LensData.
+// Returns the focal length, in mm.
+func nikonFocalLength(v byte) float64 {
+	return math.Round(5 * math.Pow(2, float64(v)/24))
+}
+
+// nikonAperture decodes an aperture of the Nikon LensData.
+// Returns the f-number, to one decimal.
+func nikonAperture(v byte) float64 {
+	return math.Round(10*math.Pow(2, float64(v)/24)) / 10
+}
+
+// lens resolves the Lens of the lens tags.
+// Returns the lens.
+func (l *lensInfo) lens() Lens {
+	lens := Lens{
+		Make:                  l.make,
+		Model:                 strings.TrimSpace(l.model),
+		SerialNumber:          strings.TrimSpace(l.serial),
+		ID:                    l.id,
+		MinFocalLength:        l.spec[0],
+		MaxFocalLength:        l.spec[1],
+		MaxApertureAtMinFocal: l.spec[2],
+		MaxApertureAtMaxFocal: l.spec[3],
+	}
+	if lens.Model == "" {
+		lens.Model = l.idName
+	}
+	if lens.Model == "" {
+		lens.Model = describeLens(l.spec)
+	}
+	return lens
+}
+
+// describeLens derives a lens name from its focal lengths and apertures,
+// e.g., "18-55mm f/3.5-5.6" or "50mm f/1.8".
+// Returns the name; empty if the focal lengths are not recorded.
+func describeLens(spec [4]float64) string {
+	if spec[0] <= 0 {
+		return ""
+	}
+	s := strconv.FormatFloat(spec[0], 'f', -1, 64)
+	if spec[1] > spec[0] {
+		s += "-" + strconv.FormatFloat(spec[1], 'f', -1, 64)
+	}
+	s += "mm"
+	if spec[2] > 0 {
+		s += " f/" + strconv.FormatFloat(spec[2], 'f', -1, 64)
+		if spec[3] > spec[2] {
+			s += "-" + strconv.FormatFloat(spec[3], 'f', -1, 64)
+		}
+	}
+	return s
+}
@@ -0,0 +1,139 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLensRealFiles(t *testing.T) {
+	tests := []struct {
+		file string
+		want Lens
+	}{
+		{TestNefFile, Lens{Model: "24-70mm f/2.8", MinFocalLength: 24, MaxFocalLength: 70,
+			MaxApertureAtMinFocal: 2.8, MaxApertureAtMaxFocal: 2.8}},
+		{TestCR2File, Lens{Model: "EF50mm f/1.2L USM", ID: "Canon 241", MinFocalLength: 50, MaxFocalLength: 50}},
+	}
+	for _, tc := range tests {
+		p := NewFormatParser(tc.file[len(tc.file)-3:])
+		r, err := p.ProcessFile(&RawFileInfo{File: tc.file, SkipExtraction: true})
+		if err != nil {
+			t.Fatalf("Unexpected error parsing %s: %v\n", tc.file, err)
+		}
+		if r.Lens != tc.want {
+			t.Errorf("Unexpected lens of %s: %+v; expected %+v\n", tc.file, r.Lens, tc.want)
+		}
+	}
+}
+
+func TestLensExif(t *testing.T) {
+	tt := newTestTiff(false)
+	preview := testJpeg(t, 160, 120)
+	previewOffset := tt.addBlob(preview)
+	exif := tt.addIfd(0,
+		asciiEntry(0x9004, "2011:03:04 05:06:07"),
+		testEntry{tag: 0xa432, fieldType: 5, values: []uint32{18, 1, 55, 1, 35, 10, 56, 10}},
+		asciiEntry(0xa433, "Canon"),
+		asciiEntry(0xa434, "EF-S18-55mm f/3.5-5.6 IS STM"))
+	ifd0 := tt.addIfd(0,
+		asciiEntry(0x010f, "Canon"),
+		longEntry(0x0201, previewOffset),
+		longEntry(0x0202, uint32(len(preview))),
+		longEntry(0x8769, exif))
+	path, _ := writeTestFile(t, "lens.DNG", tt.bytes(ifd0))
+
+	p, _ := NewDngParser(isHostLittleEndian())
+	r, err := p.ProcessFile(&RawFileInfo{File: path, SkipExtraction: true, Lenient: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	want := Lens{Make: "Canon", Model: "EF-S18-55mm f/3.5-5.6 IS STM", MinFocalLength: 18, MaxFocalLength: 55,
+		MaxApertureAtMinFocal: 3.5, MaxApertureAtMaxFocal: 5.6}
+	if r.Lens != want {
+		t.Errorf("Unexpected lens: %+v; expected %+v\n", r.Lens, want)
+	}
+}
+
+func TestCanonLensType(t *testing.T) {
+	settings := make([]uint32, 26)
+	settings[22], settings[23], settings[24], settings[25] = 237, 105, 24, 1
+
+	tt := newTestTiff(false)
+	mn := tt.addIfd(0, shortEntry(0x0001, settings...))
+	f := bytes.NewReader(tt.bytes(0))
+
+	var m rawMetadata
+	processCanonMakerNote(isHostLittleEndian(), false, &IfdEntry{tag: 0x927c, valueOffset: mn, offset: int64(mn)}, f, &m)
+	want := Lens{Model: "Canon EF 24-105mm f/4L IS USM", ID: "Canon 237", MinFocalLength: 24, MaxFocalLength: 105}
+	if got := m.lens.lens(); got != want {
+		t.Errorf("Unexpected lens: %+v; expected %+v\n", got, want)
+	}
+
+	// a LensType shared by third-party lenses is not named
+	settings[22] = 26
+	mn = tt.addIfd(0, shortEntry(0x0001, settings...))
+	m = rawMetadata{}
+	processCanonMakerNote(isHostLittleEndian(), false, &IfdEntry{tag: 0x927c, valueOffset: mn, offset: int64(mn)}, bytes.NewReader(tt.bytes(0)), &m)
+	if got := m.lens.lens(); got.Model != "24-105mm" || got.ID != "Canon 26" {
+		t.Errorf("Unexpected lens of an ambiguous LensType: %+v\n", got)
+	}
+}
+
+func TestNikonLensData(t *testing.T) {
+	lensData := append([]byte("0100"), 0, 0, 0x01, 0x58, 0x50, 0x50, 0x14, 0x14, 0x02, 0, 0, 0, 0, 0, 0)
+
+	tt := newTestTiff(true)
+	ifd := tt.addIfd(0,
+		testEntry{tag: 0x0083, fieldType: 1, raw: []byte{0x02}},
+		testEntry{tag: 0x0098, fieldType: 7, raw: lensData})
+	f := bytes.NewReader(tt.bytes(0))
+
+	var m rawMetadata
+	processNikonMakerNote(isHostLittleEndian(), &makerNote{ifdOffset: int64(ifd), isBigEndian: true}, f, &m)
+	want := Lens{Model: "50mm f/1.8", ID: "Nikon 01 58 50 50 14 14 02 02", MinFocalLength: 50, MaxFocalLength: 50,
+		MaxApertureAtMinFocal: 1.8, MaxApertureAtMaxFocal: 1.8}
+	if got := m.lens.lens(); got != want {
+		t.Errorf("Unexpected lens: %+v; expected %+v\n", got, want)
+	}
+}
+
+func TestDescribeLens(t *testing.T) {
+	tests := []struct {
+		spec [4]float64
+		want string
+	}{
+		{[4]float64{18, 55, 3.5, 5.6}, "18-55mm f/3.5-5.6"},
+		{[4]float64{50, 50, 1.8, 1.8}, "50mm f/1.8"},
+		{[4]float64{70, 200, 2.8, 2.8}, "70-200mm f/2.8"},
+		{[4]float64{24, 0, 0, 0}, "24mm"},
+		{[4]float64{}, ""},
+	}
+	for _, tc := range tests {
+		if got := describeLens(tc.spec); got != tc.want {
+			t.Errorf("Unexpected description of %v: %q; expected %q\n", tc.spec, got, tc.want)
+		}
+	}
+}
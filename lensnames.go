@@ -0,0 +1,118 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+// canonLensTypes are the names of the Canon LensType values of the
+// CameraSettings of the Canon maker note.  Values shared by third-party
+// lenses are omitted, as the LensType does not identify the lens; the
+// LensModel, recorded by recent cameras, names them.
+var canonLensTypes = map[uint16]string{
+	1:   "Canon EF 50mm f/1.8",
+	2:   "Canon EF 28mm f/2.8",
+	10:  "Canon EF 50mm f/2.5 Macro",
+	11:  "Canon EF 35mm f/2",
+	13:  "Canon EF 15mm f/2.8 Fisheye",
+	29:  "Canon EF 50mm f/1.8 II",
+	45:  "Canon EF-S 18-55mm f/3.5-5.6",
+	48:  "Canon EF-S 18-55mm f/3.5-5.6 IS",
+	49:  "Canon EF-S 55-250mm f/4-5.6 IS",
+	50:  "Canon EF-S 18-200mm f/3.5-5.6 IS",
+	51:  "Canon EF-S 18-135mm f/3.5-5.6 IS",
+	52:  "Canon EF-S 18-55mm f/3.5-5.6 IS II",
+	124: "Canon MP-E 65mm f/2.8 1-5x Macro Photo",
+	125: "Canon TS-E 24mm f/3.5L",
+	126: "Canon TS-E 45mm f/2.8",
+	127: "Canon TS-E 90mm f/2.8",
+	129: "Canon EF 300mm f/2.8L USM",
+	130: "Canon EF 50mm f/1.0L USM",
+	132: "Canon EF 1200mm f/5.6L USM",
+	134: "Canon EF 600mm f/4L IS USM",
+	135: "Canon EF 200mm f/1.8L USM",
+	142: "Canon EF 300mm f/2.8L IS USM",
+	143: "Canon EF 500mm f/4L IS USM",
+	149: "Canon EF 100mm f/2 USM",
+	155: "Canon EF 85mm f/1.8 USM",
+	165: "Canon EF 70-200mm f/2.8L USM",
+	166: "Canon EF 70-200mm f/2.8L USM + 1.4x",
+	167: "Canon EF 70-200mm f/2.8L USM + 2x",
+	170: "Canon EF 200mm f/2.8L II USM",
+	171: "Canon EF 300mm f/4L USM",
+	172: "Canon EF 400mm f/5.6L USM",
+	175: "Canon EF 400mm f/2.8L USM",
+	176: "Canon EF 24-85mm f/3.5-4.5 USM",
+	177: "Canon EF 300mm f/4L IS USM",
+	178: "Canon EF 28-135mm f/3.5-5.6 IS",
+	179: "Canon EF 24mm f/1.4L USM",
+	180: "Canon EF 35mm f/1.4L USM",
+	181: "Canon EF 100-400mm f/4.5-5.6L IS USM + 1.4x",
+	182: "Canon EF 100-400mm f/4.5-5.6L IS USM + 2x",
+	186: "Canon EF 70-200mm f/4L USM",
+	187: "Canon EF 70-200mm f/4L USM + 1.4x",
+	188: "Canon EF 70-200mm f/4L USM + 2x",
+	190: "Canon EF 100mm f/2.8 Macro USM",
+	191: "Canon EF 400mm f/4 DO IS",
+	193: "Canon EF 35-80mm f/4-5.6 USM",
+	194: "Canon EF 80-200mm f/4.5-5.6 USM",
+	195: "Canon EF 35-105mm f/4.5-5.6 USM",
+	197: "Canon EF 75-300mm f/4-5.6 IS USM",
+	198: "Canon EF 50mm f/1.4 USM",
+	202: "Canon EF 28-80mm f/3.5-5.6 USM IV",
+	208: "Canon EF 22-55mm f/4-5.6 USM",
+	209: "Canon EF 55-200mm f/4.5-5.6",
+	210: "Canon EF 28-90mm f/4-5.6 USM",
+	211: "Canon EF 28-200mm f/3.5-5.6 USM",
+	212: "Canon EF 28-105mm f/4-5.6 USM",
+	213: "Canon EF 90-300mm f/4.5-5.6 USM",
+	214: "Canon EF-S 18-55mm f/3.5-5.6 USM",
+	215: "Canon EF 55-200mm f/4.5-5.6 II USM",
+	224: "Canon EF 70-200mm f/2.8L IS USM",
+	225: "Canon EF 70-200mm f/2.8L IS USM + 1.4x",
+	226: "Canon EF 70-200mm f/2.8L IS USM + 2x",
+	227: "Canon EF 70-200mm f/2.8L IS USM + 2.8x",
+	228: "Canon EF 28-105mm f/3.5-4.5 USM",
+	229: "Canon EF 16-35mm f/2.8L USM",
+	230: "Canon EF 24-70mm f/2.8L USM",
+	231: "Canon EF 17-40mm f/4L USM",
+	232: "Canon EF 70-300mm f/4.5-5.6 DO IS USM",
+	233: "Canon EF 28-300mm f/3.5-5.6L IS USM",
+	234: "Canon EF-S 17-85mm f/4-5.6 IS USM",
+	235: "Canon EF-S 10-22mm f/3.5-4.5 USM",
+	236: "Canon EF-S 60mm f/2.8 Macro USM",
+	237: "Canon EF 24-105mm f/4L IS USM",
+	238: "Canon EF 70-300mm f/4-5.6 IS USM",
+	239: "Canon EF 85mm f/1.2L II USM",
+	240: "Canon EF-S 17-55mm f/2.8 IS USM",
+	241: "Canon EF 50mm f/1.2L USM",
+	242: "Canon EF 70-200mm f/4L IS USM",
+	243: "Canon EF 70-200mm f/4L IS USM + 1.4x",
+	244: "Canon EF 70-200mm f/4L IS USM + 2x",
+	245: "Canon EF 70-200mm f/4L IS USM + 2.8x",
+	246: "Canon EF 16-35mm f/2.8L II USM",
+	247: "Canon EF 14mm f/2.8L II USM",
+	248: "Canon EF 200mm f/2L IS USM",
+	249: "Canon EF 800mm f/5.6L IS USM",
+	250: "Canon EF 24mm f/1.4L II USM",
+	251: "Canon EF 70-200mm f/2.8L IS II USM",
+	254: "Canon EF 100mm f/2.8L Macro IS USM",
+}
@@ -0,0 +1,296 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxMakerNoteEntries is the largest plausible number of entries of a
+// maker note IFD.
+const maxMakerNoteEntries = 512
+
+// makerNote is a struct representing the location of a maker note IFD.
+// Offsets within the maker note are relative to base.
+type makerNote struct {
+	ifdOffset   int64 // offset from start of file
+	base        int64
+	isBigEndian bool
+}
+
+// Nikon maker note headers.  The first version of the header is followed by
+// an IFD with offsets relative to the file; the second version by a TIFF
+// header with its own byte order and offsets relative to the TIFF header.
+// The maker notes of early DSLRs (e.g., the D1) have no header at all.
+var (
+	nikonMakerNoteV1 = []byte("Nikon\x00\x01")
+	nikonMakerNoteV2 = []byte("Nikon\x00\x02")
+)
+
+// nikonMakerNote locates the IFD of a Nikon maker note referenced by the
+// EXIF MakerNote entry.
+// Returns the maker note or error.
+func nikonMakerNote(isHostLe, isFileBe bool, entry *IfdEntry, f io.ReaderAt) (*makerNote, error) {
+	start := entry.offset
+	mn := &makerNote{ifdOffset: start, isBigEndian: isFileBe}
+
+	header, err := readField(start, 18, f)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(header, nikonMakerNoteV2):
+		// the embedded TIFF header defines the byte order of the maker
+		// note, which may differ from the byte order of the file
+		mn.base = start + 10
+		isBigEndian, ifd, err := embeddedTiffHeader(isHostLe, header[10:18])
+		if err != nil {
+			return nil, err
+		}
+		mn.isBigEndian = isBigEndian
+		mn.ifdOffset = mn.base + int64(ifd)
+	case bytes.HasPrefix(header, nikonMakerNoteV1):
+		mn.ifdOffset = start + 8
+		mn.isBigEndian = detectIfdByteOrder(isHostLe, isFileBe, mn.ifdOffset, f)
+	default:
+		mn.isBigEndian = detectIfdByteOrder(isHostLe, isFileBe, mn.ifdOffset, f)
+	}
+
+	return mn, nil
+}
+
+// ascii reads the value of an ASCII entry of the maker note, whose offset
+// is relative to the base of the maker note.
+// Returns the value or error.
+func (mn *makerNote) ascii(entry *IfdEntry) (string, error) {
+	e, err := mn.entry(entry)
+	if err != nil {
+		return "", err
+	}
+	return e.ASCII()
+}
+
+// entry rebases the offset of an entry of the maker note, relative to the
+// base of the maker note, to the start of the file.
+// Returns the rebased entry or error.
+func (mn *makerNote) entry(entry *IfdEntry) (*IfdEntry, error) {
+	offset, err := addOffset(mn.base, int64(entry.valueOffset))
+	if err != nil {
+		return nil, err
+	}
+	e := *entry
+	e.offset = offset
+	return &e, nil
+}
+
+// embeddedTiffHeader parses the 8-byte TIFF header embedded within a maker
+// note.
+// Returns the byte order, the offset of the IFD relative to the header, or
+// error if the header is invalid.
+func embeddedTiffHeader(isHostLe bool, header []byte) (isBigEndian bool, ifd uint32, err error) {
+	switch string(header[0:2]) {
+	case "MM":
+		isBigEndian = true
+	case "II":
+		isBigEndian = false
+	default:
+		return false, 0, fmt.Errorf("invalid maker note byte order: % x", header[0:2])
+	}
+
+	if magic := bytesToUShort(isHostLe, isBigEndian, header[2:4]); magic != 42 {
+		return false, 0, fmt.Errorf("invalid maker note TIFF magic value: %d", magic)
+	}
+
+	return isBigEndian, bytesToUInt(isHostLe, isBigEndian, header[4:8]), nil
+}
+
+// detectIfdByteOrder determines the byte order of a maker note IFD without a
+// TIFF header.  Such maker notes are usually written in the byte order of
+// the file, but not when the file was rewritten by software that swapped
+// the byte order of the file and kept the maker note as-is.  The byte order
+// yielding a plausible entry count and field type is selected.
+// Returns true if the IFD is big endian; false otherwise.
+func detectIfdByteOrder(isHostLe, isFileBe bool, offset int64, f io.ReaderAt) bool {
+	b, err := readField(offset, 6, f)
+	if err != nil {
+		return isFileBe
+	}
+
+	plausible := func(isBigEndian bool) bool {
+		entries := bytesToUShort(isHostLe, isBigEndian, b[0:2])
+		fieldType := bytesToUShort(isHostLe, isBigEndian, b[4:6])
+		return entries > 0 && entries <= maxMakerNoteEntries &&
+			fieldType >= 1 && fieldType <= 13
+	}
+
+	if !plausible(isFileBe) && plausible(!isFileBe) {
+		return !isFileBe
+	}
+	return isFileBe
+}
+
+// nikonPreview reads the JPEG preview referenced by the PreviewIFD of a
+// Nikon maker note, as written by early DSLRs (e.g., the D100) that store
+// no JPEG in the SubIFDs.
+// Returns the offset and length of the preview; zero if not present.
+func nikonPreview(isHostLe bool, mn *makerNote, f io.ReaderAt) (offset, length int64) {
+	entries, err := processIfd(isHostLe, mn.isBigEndian, mn.ifdOffset, f)
+	if err != nil {
+		return 0, 0
+	}
+
+	for e := entries.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(IfdEntry)
+		if entry.tag != 0x0011 { // PreviewIFD
+			continue
+		}
+
+		ifdOffset, err := addOffset(mn.base, int64(entry.valueOffset))
+		if err != nil {
+			return 0, 0
+		}
+		preview, err := processIfd(isHostLe, mn.isBigEndian, ifdOffset, f)
+		if err != nil {
+			return 0, 0
+		}
+		for pe := preview.Front(); pe != nil; pe = pe.Next() {
+			previewEntry := pe.Value.(IfdEntry)
+			switch previewEntry.tag {
+			case 0x0201: // JPEGInterchangeFormat
+				v, _ := previewEntry.Uint32()
+				offset, err = addOffset(mn.base, int64(v))
+			case 0x0202: // JPEGInterchangeFormatLength
+				v, _ := previewEntry.Uint32()
+				length = int64(v)
+			}
+		}
+		if err != nil || offset == 0 || length == 0 {
+			return 0, 0
+		}
+		return offset, length
+	}
+
+	return 0, 0
+}
+
+// processCanonMakerNote records the lens, the FileNumber, the serial
+// numbers, the sensor borders, and the flash exposure compensation of a
+// Canon maker note: the LensModel or, if not recorded, the LensType of the
+// CameraSettings.  The maker note IFD has offsets relative to the file.
+// Errors are not fatal as the maker note is optional.
+func processCanonMakerNote(isHostLe, isFileBe bool, entry *IfdEntry, f io.ReaderAt, m *rawMetadata) {
+	entries, err := processIfd(isHostLe, isFileBe, entry.offset, f)
+	if err != nil {
+		return
+	}
+
+	for e := entries.Front(); e != nil; e = e.Next() {
+		mnEntry := e.Value.(IfdEntry)
+		switch mnEntry.tag {
+		case 0x0001: // CameraSettings
+			if settings, err := processIntegerArray(isHostLe, isFileBe, &mnEntry, f); err == nil {
+				canonSettingsLens(settings, m)
+			}
+		case 0x0004: // ShotInfo
+			if info, err := processIntegerArray(isHostLe, isFileBe, &mnEntry, f); err == nil && len(info) > 15 {
+				m.exposure.FlashCompensation = canonEv(int16(info[15]))
+			}
+		case 0x0008: // FileNumber, e.g., 1001234 for 100-1234
+			m.imageNumber, _ = mnEntry.Uint32()
+		case 0x000c: // SerialNumber
+			if serial, err := mnEntry.Uint32(); err == nil && serial != 0 && m.serialNumber == "" {
+				m.serialNumber = fmt.Sprintf("%010d", serial)
+			}
+		case 0x4019: // LensInfo, starting with the LensSerialNumber
+			if b, err := mnEntry.value(5, 1); err == nil && m.lens.serial == "" &&
+				!bytes.Equal(b, make([]byte, 5)) {
+				m.lens.serial = fmt.Sprintf("%x", b)
+			}
+		case 0x0095: // LensModel
+			if model, err := mnEntry.ASCII(); err == nil && m.lens.model == "" {
+				m.lens.model = model
+			}
+		case 0x00e0: // SensorInfo
+			if info, err := processIntegerArray(isHostLe, isFileBe, &mnEntry, f); err == nil {
+				m.sensor = canonSensorInfo(info)
+			}
+		}
+	}
+}
+
+// processNikonMakerNote records the lens, the ShutterCount, the
+// SerialNumber, the faces detected, and the flash exposure compensation of
+// a Nikon maker note:
+// the Lens (focal lengths and apertures) and, from an unencrypted
+// LensData, the LensID.  Errors are not
+// fatal as the maker note is optional.
+func processNikonMakerNote(isHostLe bool, mn *makerNote, f io.ReaderAt, m *rawMetadata) {
+	entries, err := processIfd(isHostLe, mn.isBigEndian, mn.ifdOffset, f)
+	if err != nil {
+		return
+	}
+
+	var lensType byte
+	var lensData []byte
+	var serial string
+	for e := entries.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(IfdEntry)
+		switch entry.tag {
+		case 0x0012: // FlashExposureComp
+			m.exposure.FlashCompensation = nikonFlashCompensation(inlineValueBytes(mn.isBigEndian, entry.valueOffset))
+		case 0x0083: // LensType
+			lensType = inlineValueBytes(mn.isBigEndian, entry.valueOffset)[0]
+		case 0x0084: // Lens
+			if spec, err := readLensSpec(&entry, mn.base); err == nil && m.lens.spec[0] == 0 {
+				m.lens.spec = spec
+			}
+		case 0x0098: // LensData
+			if offset, err := addOffset(mn.base, int64(entry.valueOffset)); err == nil && entry.count <= 64 {
+				lensData, _ = readField(offset, entry.count, f)
+			}
+		case 0x00a7: // ShutterCount
+			m.shutterCount, _ = entry.Uint32()
+		case 0x0021: // FaceDetect
+			if e, err := mn.entry(&entry); err == nil && entry.count <= 16+8*maxNikonFaces {
+				if b, err := e.value(e.count, 1); err == nil {
+					m.subjects.faces = nikonFaceDetect(b, e.order)
+				}
+			}
+		case 0x001d: // SerialNumber
+			serial, _ = mn.ascii(&entry)
+		case 0x00a0: // SerialNumber of early bodies, e.g., "NO= 3004f7b6"
+			if s, err := mn.ascii(&entry); err == nil && serial == "" {
+				serial = strings.TrimSpace(strings.TrimPrefix(s, "NO="))
+			}
+		}
+	}
+	nikonLensData(lensData, lensType, m)
+	if m.serialNumber == "" {
+		m.serialNumber = serial
+	}
+}
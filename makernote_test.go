@@ -0,0 +1,131 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestNefShutterCount(t *testing.T) {
+	p, _ := NewNefParser(isHostLittleEndian())
+	r, err := p.ProcessFile(&RawFileInfo{File: TestNefFile, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if r.ShutterCount != 12803 {
+		t.Errorf("Unexpected shutter count: %d\n", r.ShutterCount)
+	}
+}
+
+func TestMakerNoteCounters(t *testing.T) {
+	tt := newTestTiff(true)
+	nikon := tt.addIfd(0, longEntry(0x00a7, 48213))
+	canon := tt.addIfd(0, longEntry(0x0008, 1001234))
+	f := bytes.NewReader(tt.bytes(0))
+
+	var m rawMetadata
+	processNikonMakerNote(isHostLittleEndian(), &makerNote{ifdOffset: int64(nikon), isBigEndian: true}, f, &m)
+	processCanonMakerNote(isHostLittleEndian(), true, &IfdEntry{tag: 0x927c, valueOffset: canon, offset: int64(canon)}, f, &m)
+	if m.shutterCount != 48213 || m.imageNumber != 1001234 {
+		t.Errorf("Unexpected shutter count and image number: %d %d\n", m.shutterCount, m.imageNumber)
+	}
+}
+
+func TestExifImageNumber(t *testing.T) {
+	tt := newTestTiff(false)
+	preview := testJpeg(t, 160, 120)
+	previewOffset := tt.addBlob(preview)
+	exif := tt.addIfd(0,
+		asciiEntry(0x9004, "2011:03:04 05:06:07"),
+		longEntry(0x9211, 4321))
+	ifd0 := tt.addIfd(0,
+		longEntry(0x0201, previewOffset),
+		longEntry(0x0202, uint32(len(preview))),
+		longEntry(0x8769, exif))
+	path, _ := writeTestFile(t, "number.DNG", tt.bytes(ifd0))
+
+	p, _ := NewDngParser(isHostLittleEndian())
+	r, err := p.ProcessFile(&RawFileInfo{File: path, SkipExtraction: true, Lenient: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if r.ImageNumber != 4321 || r.ShutterCount != 0 {
+		t.Errorf("Unexpected image number and shutter count: %d %d\n", r.ImageNumber, r.ShutterCount)
+	}
+}
+
+func TestSerialNumbers(t *testing.T) {
+	for _, tc := range []struct {
+		file, parser, serial string
+	}{
+		{TestNefFile, NefParserKey, "2239306"},
+		{TestCR2File, Cr2ParserKey, "0420201657"},
+	} {
+		r, err := NewFormatParser(tc.parser).ProcessFile(&RawFileInfo{File: tc.file, SkipExtraction: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		if r.SerialNumber != tc.serial {
+			t.Errorf("%s: unexpected serial number: %q; expected %q\n", tc.file, r.SerialNumber, tc.serial)
+		}
+	}
+
+	// the LensSerialNumber of the Canon LensInfo
+	tt := newTestTiff(false)
+	lensInfo := append([]byte{0x00, 0x00, 0x41, 0x23, 0x45}, make([]byte, 25)...)
+	canon := tt.addIfd(0, longEntry(0x000c, 1234567), testEntry{tag: 0x4019, fieldType: 7, raw: lensInfo})
+	f := bytes.NewReader(tt.bytes(0))
+	var m rawMetadata
+	processCanonMakerNote(isHostLittleEndian(), false, &IfdEntry{tag: 0x927c, valueOffset: canon, offset: int64(canon)}, f, &m)
+	if m.serialNumber != "0001234567" || m.lens.serial != "0000412345" {
+		t.Errorf("Unexpected Canon serial numbers: %q %q\n", m.serialNumber, m.lens.serial)
+	}
+
+	// the EXIF serial numbers are preferred to those of the maker notes
+	processPhotoIDEntry(&IfdEntry{tag: 0xa431, fieldType: 2, count: 4, valueOffset: 0x31323300, order: binary.BigEndian}, &m)
+	processLensEntry(&IfdEntry{tag: 0xa435, fieldType: 2, count: 4, valueOffset: 0x34353600, order: binary.BigEndian}, &m)
+	if m.serialNumber != "123" || m.lens.serial != "456" {
+		t.Errorf("Unexpected EXIF serial numbers: %q %q\n", m.serialNumber, m.lens.serial)
+	}
+	processCanonMakerNote(isHostLittleEndian(), false, &IfdEntry{tag: 0x927c, valueOffset: canon, offset: int64(canon)}, f, &m)
+	if m.serialNumber != "123" || m.lens.serial != "456" {
+		t.Errorf("Unexpected serial numbers after the maker note: %q %q\n", m.serialNumber, m.lens.serial)
+	}
+
+	// the DNG CameraSerialNumber
+	tt = newTestTiff(true)
+	preview := testJpeg(t, 160, 120)
+	previewOffset := tt.addBlob(preview)
+	ifd0 := tt.addIfd(0,
+		longEntry(0x0201, previewOffset),
+		longEntry(0x0202, uint32(len(preview))),
+		asciiEntry(0xc62f, "A1B2C3D4"))
+	path, _ := writeTestFile(t, "serial.DNG", tt.bytes(ifd0))
+	r, err := NewFormatParser(DngParserKey).ProcessFile(&RawFileInfo{File: path, SkipExtraction: true, Lenient: true})
+	if err != nil || r.SerialNumber != "A1B2C3D4" {
+		t.Errorf("Unexpected DNG serial number: %q %v\n", r.SerialNumber, err)
+	}
+}
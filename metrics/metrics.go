@@ -0,0 +1,232 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+// Package metrics exposes the processing of raw files by the rawparser
+// package as Prometheus metrics: the raw files processed, the errors by
+// kind, the bytes read, and a histogram of the processing duration, by
+// raw file format.
+//
+// The package does not depend on the Prometheus client library; a Metrics
+// is an http.Handler serving the text exposition format, scraped directly:
+//
+//	m := metrics.New()
+//	http.Handle("/metrics", m)
+//	b := rawparser.NewBatchProcessor(dest, 85, rawparser.WithResultFunc(m.ObserveResult))
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jeremytorres/rawparser"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the buckets of the
+// processing duration histogram.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// unknownFormat labels the raw files of no registered format, so that the
+// file extensions of a batch do not create unbounded label values.
+const unknownFormat = "unknown"
+
+// Metrics records the processing of raw files.  Metrics is safe for
+// concurrent use.
+type Metrics struct {
+	buckets []float64
+
+	mu      sync.Mutex
+	formats map[string]*formatMetrics
+}
+
+// formatMetrics are the metrics of a raw file format.
+type formatMetrics struct {
+	files     uint64
+	bytesRead uint64
+	errors    map[string]uint64
+
+	// the processing duration histogram: counts by bucket, not cumulative
+	counts   []uint64
+	count    uint64
+	duration float64
+}
+
+// New creates a Metrics with the DefaultBuckets.
+// Returns the Metrics.
+func New() *Metrics {
+	return NewWithBuckets(DefaultBuckets)
+}
+
+// NewWithBuckets creates a Metrics with the upper bounds, in seconds, of the
+// buckets of the processing duration histogram.
+// Returns the Metrics.
+func NewWithBuckets(buckets []float64) *Metrics {
+	b := slices.Clone(buckets)
+	slices.Sort(b)
+	return &Metrics{buckets: slices.Compact(b), formats: make(map[string]*formatMetrics)}
+}
+
+// Observe records the processing of a raw file of a format (e.g., "NEF"),
+// which took d, by its RawFile, if parsed, and error.
+func (m *Metrics) Observe(format string, d time.Duration, r *rawparser.RawFile, err error) {
+	format = formatLabel(format)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fm := m.formats[format]
+	if fm == nil {
+		fm = &formatMetrics{errors: make(map[string]uint64), counts: make([]uint64, len(m.buckets))}
+		m.formats[format] = fm
+	}
+	fm.files++
+	if err != nil {
+		fm.errors[rawparser.FailureKind(err)]++
+	}
+	if r != nil {
+		fm.bytesRead += uint64(r.ReadStats.BytesRead)
+	}
+
+	seconds := d.Seconds()
+	if i, _ := slices.BinarySearch(m.buckets, seconds); i < len(m.buckets) {
+		fm.counts[i]++
+	}
+	fm.count++
+	fm.duration += seconds
+}
+
+// ObserveResult records the result of a file of a batch, by the format of
+// its file extension and the Timings of its RawFile; see
+// rawparser.WithResultFunc.  A duplicate, not processed, is not recorded.
+func (m *Metrics) ObserveResult(res rawparser.BatchResult) {
+	if res.DuplicateOf != "" {
+		return
+	}
+	var d time.Duration
+	if r := res.RawFile; r != nil {
+		d = r.Timings.Parse + r.Timings.Decode + r.Timings.Encode
+	}
+	m.Observe(filepath.Ext(res.File), d, res.RawFile, res.Err)
+}
+
+// formatLabel normalizes a format key or file extension, e.g., ".nef", to
+// the key of its format, or unknownFormat if not registered.
+// Returns the label value.
+func formatLabel(format string) string {
+	format = strings.ToUpper(strings.TrimPrefix(format, "."))
+	if rawparser.NewFormatParser(format) == nil {
+		return unknownFormat
+	}
+	return format
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format, by
+// format in order.
+// Returns the number of bytes written or error.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	formats := make([]string, 0, len(m.formats))
+	for format := range m.formats {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	cw := &countingWriter{w: w}
+	b := bufio.NewWriter(cw)
+
+	header(b, "rawparser_files_total", "counter", "Raw files processed, by format.")
+	for _, format := range formats {
+		fmt.Fprintf(b, "rawparser_files_total{format=%q} %d\n", format, m.formats[format].files)
+	}
+
+	header(b, "rawparser_errors_total", "counter", "Raw files that failed, by format and kind of failure.")
+	for _, format := range formats {
+		fm := m.formats[format]
+		kinds := make([]string, 0, len(fm.errors))
+		for kind := range fm.errors {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			fmt.Fprintf(b, "rawparser_errors_total{format=%q,kind=%q} %d\n", format, kind, fm.errors[kind])
+		}
+	}
+
+	header(b, "rawparser_bytes_read_total", "counter", "Bytes read from the raw files, by format.")
+	for _, format := range formats {
+		fmt.Fprintf(b, "rawparser_bytes_read_total{format=%q} %d\n", format, m.formats[format].bytesRead)
+	}
+
+	header(b, "rawparser_processing_seconds", "histogram", "Time processing a raw file, by format.")
+	for _, format := range formats {
+		fm := m.formats[format]
+		var cumulative uint64
+		for i, le := range m.buckets {
+			cumulative += fm.counts[i]
+			fmt.Fprintf(b, "rawparser_processing_seconds_bucket{format=%q,le=%q} %d\n", format, formatFloat(le), cumulative)
+		}
+		fmt.Fprintf(b, "rawparser_processing_seconds_bucket{format=%q,le=\"+Inf\"} %d\n", format, fm.count)
+		fmt.Fprintf(b, "rawparser_processing_seconds_sum{format=%q} %s\n", format, formatFloat(fm.duration))
+		fmt.Fprintf(b, "rawparser_processing_seconds_count{format=%q} %d\n", format, fm.count)
+	}
+
+	err := b.Flush()
+	return cw.n, err
+}
+
+// header writes the HELP and TYPE lines of a metric.
+func header(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// formatFloat formats a sample value or bucket bound as Prometheus does.
+func formatFloat(f float64) string {
+	return fmt.Sprint(f)
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
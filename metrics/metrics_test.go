@@ -0,0 +1,105 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jeremytorres/rawparser"
+)
+
+func TestObserve(t *testing.T) {
+	m := NewWithBuckets([]float64{1, 0.1, 1})
+	m.Observe("NEF", 50*time.Millisecond, &rawparser.RawFile{ReadStats: rawparser.ReadStats{BytesRead: 100}}, nil)
+	m.Observe(".nef", 500*time.Millisecond, nil, rawparser.ErrNoPreview)
+	m.Observe("NEF", 5*time.Second, nil, fmt.Errorf("%w: bad", rawparser.ErrExtractionFailed))
+	m.Observe(".xyz", 0, nil, rawparser.ErrUnknownFormat)
+
+	var b strings.Builder
+	n, err := m.WriteTo(&b)
+	if err != nil || n != int64(b.Len()) {
+		t.Fatalf("Unexpected WriteTo: %d, %v\n", n, err)
+	}
+	expected := `# HELP rawparser_files_total Raw files processed, by format.
+# TYPE rawparser_files_total counter
+rawparser_files_total{format="NEF"} 3
+rawparser_files_total{format="unknown"} 1
+# HELP rawparser_errors_total Raw files that failed, by format and kind of failure.
+# TYPE rawparser_errors_total counter
+rawparser_errors_total{format="NEF",kind="extraction"} 1
+rawparser_errors_total{format="NEF",kind="noPreview"} 1
+rawparser_errors_total{format="unknown",kind="unknownFormat"} 1
+# HELP rawparser_bytes_read_total Bytes read from the raw files, by format.
+# TYPE rawparser_bytes_read_total counter
+rawparser_bytes_read_total{format="NEF"} 100
+rawparser_bytes_read_total{format="unknown"} 0
+# HELP rawparser_processing_seconds Time processing a raw file, by format.
+# TYPE rawparser_processing_seconds histogram
+rawparser_processing_seconds_bucket{format="NEF",le="0.1"} 1
+rawparser_processing_seconds_bucket{format="NEF",le="1"} 2
+rawparser_processing_seconds_bucket{format="NEF",le="+Inf"} 3
+rawparser_processing_seconds_sum{format="NEF"} 5.55
+rawparser_processing_seconds_count{format="NEF"} 3
+rawparser_processing_seconds_bucket{format="unknown",le="0.1"} 1
+rawparser_processing_seconds_bucket{format="unknown",le="1"} 1
+rawparser_processing_seconds_bucket{format="unknown",le="+Inf"} 1
+rawparser_processing_seconds_sum{format="unknown"} 0
+rawparser_processing_seconds_count{format="unknown"} 1
+`
+	if b.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s\n", expected, b.String())
+	}
+}
+
+func TestObserveResult(t *testing.T) {
+	m := New()
+	m.ObserveResult(rawparser.BatchResult{File: "a.CR2", RawFile: &rawparser.RawFile{
+		Timings: rawparser.Timings{Parse: time.Millisecond, Decode: 2 * time.Millisecond, Encode: 3 * time.Millisecond},
+	}})
+	m.ObserveResult(rawparser.BatchResult{File: "b.CR2", DuplicateOf: "a.CR2"})
+	m.ObserveResult(rawparser.BatchResult{File: "c.cr2", Err: errors.New("corrupt")})
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type: %s\n", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`rawparser_files_total{format="CR2"} 2`,
+		`rawparser_errors_total{format="CR2",kind="parse"} 1`,
+		`rawparser_processing_seconds_bucket{format="CR2",le="0.005"} 1`,
+		`rawparser_processing_seconds_bucket{format="CR2",le="0.01"} 2`,
+		`rawparser_processing_seconds_sum{format="CR2"} 0.006`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in metrics:\n%s\n", want, body)
+		}
+	}
+}
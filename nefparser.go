@@ -25,10 +25,10 @@ package rawparser
 
 import (
 	"fmt"
-	"log"
-	"math"
+	"io"
 	"os"
-	"time"
+
+	"github.com/jeremytorres/rawparser/tiff"
 )
 
 // NefParserKey is a unique identifier for the NEF raw file parser.
@@ -54,7 +54,6 @@ type nefHeader struct {
 // NEF-specific information: http://lclevy.free.fr/nef/
 // TIFF specification: http://partners.adobe.com/public/developer/en/tiff/TIFF6.pdf
 type NefParser struct {
-	//	HostIsLittleEndian bool
 	*rawParser
 }
 
@@ -65,179 +64,384 @@ type NefParser struct {
 func (n NefParser) ProcessFile(info *RawFileInfo) (nef *RawFile, err error) {
 	nef = new(RawFile)
 
-	// file is closed in subsequent method
-	f, err := os.Open(info.File)
+	if info, err = info.withDefaults(); err != nil {
+		return nef, err
+	}
+
+	f, err := openRawFile(info)
 	if err != nil {
-		log.Printf("Error: Unable to open file: '%s'\n", info.File)
-	} else {
-		h, err := n.processHeader(f)
-		jpegInfo, createDate, err := n.processIfds(f, h)
-		if err != nil {
-			return nef, err
-		} else if jpegInfo.length <= 0 {
-			return nef, fmt.Errorf("invalid jpeg length: %d\n", jpegInfo.length)
-		}
-		jpegPath, err := n.decodeAndWriteJpeg(f, jpegInfo, info.DestDir, info.Quality)
-		if err == nil {
-			nef.FileName = info.File
-			nef.CreateDate = createDate
-			nef.JpegPath = jpegPath
-			nef.JpegOrientation = jpegInfo.orientation
-
-			log.Printf("========= Processed file %s\n", info.File)
-		}
+		return nef, err
+	}
+	defer f.Close()
+	if cached := info.Cache.lookup(f, info); cached != nil {
+		return cached, nil
+	}
 
+	cache := newReadCache(f)
+	h, err := n.processHeader(cache)
+	headerErr, err := lenientHeader(info, err)
+	if err != nil {
+		return nef, err
+	}
+	jpegInfo, meta, err := n.processIfds(cache, h)
+	if err != nil {
+		return nef, err
+	}
+	if headerErr != nil {
+		meta.warn(headerErr)
 	}
+	meta.images = listImages(cache)
+	meta.rawImage = readRawImage(cache)
+	runTagHooks(cache, info.TagHooks)
 
-	return nef, err
+	return nef, completeRawFile(nef, info, f, jpegInfo, meta)
 }
 
 // processHeader reads NEF header that defines:
 //   byte order;
 //   TIFF magic value
 //   TIFF offset
-// Returns a pointer to the header struct or error.
-func (n NefParser) processHeader(f *os.File) (*nefHeader, error) {
+// Returns a pointer to the header struct or error; a *HeaderError, with
+// the header read, if the magic value is not that of TIFF.
+func (n NefParser) processHeader(f io.ReaderAt) (*nefHeader, error) {
 	var h nefHeader
 
-	// byte order
-	bytes, err := readField(0, 2, f)
+	th, err := tiff.ReadHeader(f)
 	if err != nil {
 		return &h, err
 	}
-	// byte order
-	byteOrder := bytesToUShort(n.IsHostLittleEndian(), false, bytes)
-
-	// set byte order from file read
-	h.isBigEndian = (byteOrder == 0x4D4D)
+	h.isBigEndian = th.IsBigEndian()
+	h.tiffMagicValue = th.Magic
+	h.tiffOffset = th.Offset
 
-	// DEBUG
-	//if !h.isBigEndian {
-	//log.Println("NEF is LITTLE ENDIAN!")
-	//}
-	// DEBUG
-
-	// TIFF magic value
-	bytes, err = readField(2, 2, f)
-	if err != nil {
-		return &h, err
-	}
-	h.tiffMagicValue = bytesToUShort(n.IsHostLittleEndian(), h.isBigEndian, bytes)
-
-	// TIFF offset
-	bytes, err = readField(4, 4, f)
-	if err != nil {
-		return &h, err
-	}
-	val := bytesToUInt(n.IsHostLittleEndian(), h.isBigEndian, bytes)
-	h.tiffOffset = int64(val)
-
-	return &h, err
+	return &h, checkTiffMagic(th, tiffMagic)
 }
 
 // processIfds reads all currently-supported IFDs from the NEF.  Currently, it parses:
 //     jpegInfo - the information pertaining to the embedded jpeg within the NEF;
-//     cDate - the EXIF specified NEF creation time;
+//     meta - the EXIF specified NEF creation time and raw dimensions;
 //     Note: more EXIF and NEF-specific tags could be parsed in a future release.
-// Return jpegInfo, creation date/time or an error.
-func (n NefParser) processIfds(f *os.File, h *nefHeader) (j *jpegInfo, cDate time.Time, err error) {
+// Return jpegInfo, metadata or an error.
+func (n NefParser) processIfds(f io.ReaderAt, h *nefHeader) (j *jpegInfo, meta *rawMetadata, err error) {
 	var jpeg jpegInfo
+	var m rawMetadata
+	var ifd0Jpeg byteRange
+	var makerNoteEntry, subIfdsEntry *IfdEntry
+	earlyLayout := false
 	offset := h.tiffOffset
 
 	entries, err := processIfd(n.IsHostLittleEndian(), h.isBigEndian, offset, f)
+	if err != nil && entries.Len() > 0 {
+		// truncated within IFD0; the entries read are processed
+		m.readFailed("IFD0", 0, err)
+		err = nil
+	}
 
 	if err == nil {
+		m.tags.record(entries, ifd0Tags)
 		for e := entries.Front(); e != nil; e = e.Next() {
-			entry := e.Value.(ifdEntry)
+			entry := e.Value.(IfdEntry)
 			if entry.tag == 0x014a { // SUBID
-				// JPEG offset (SUBID 0)
-				bytes, err := readField(int64(entry.valueOffset), 4, f)
-				if err == nil {
-					subID0Offset := int64(bytesToUInt(n.IsHostLittleEndian(), h.isBigEndian, bytes))
-
-					// Read SUBIFD 0 for JPEG
-					subIfd0Entries, err := processIfd(n.IsHostLittleEndian(), h.isBigEndian, subID0Offset, f)
-					if err == nil {
-						for se := subIfd0Entries.Front(); se != nil; se = se.Next() {
-							subID0Entry := se.Value.(ifdEntry)
-
-							if subID0Entry.tag == 0x011a {
-								jpeg.xRes, _, jpeg.xResFloat, err = processRationalEntry(n.IsHostLittleEndian(), h.isBigEndian, subID0Entry.valueOffset, f)
-							}
-
-							if subID0Entry.tag == 0x011b {
-								jpeg.yRes, _, jpeg.yResFloat, err = processRationalEntry(n.IsHostLittleEndian(), h.isBigEndian, subID0Entry.valueOffset, f)
-							}
-
-							if subID0Entry.tag == 0x0201 {
-								jpeg.offset = int64(subID0Entry.valueOffset)
-							}
-							if subID0Entry.tag == 0x0202 {
-								jpeg.length = int64(subID0Entry.valueOffset)
-							}
-						}
-					} else {
-						return &jpeg, cDate, err
-					}
-				}
+				subIfdsEntry = &entry
+
+				// the preview and raw image SubIFDs.  Early NEFs have a
+				// single SubIFD, stored inline.
+				n.processSubIfds(f, h, &entry, &jpeg, &m)
+				earlyLayout = entry.count == 1
 			} else if entry.tag == 0x0112 { // orientation tag
-				o := processShortValue(h.isBigEndian, entry.valueOffset)
-				if o == 8 {
-					// rotate 270 CW
-					rotationRads := 270 * math.Pi / 180
-					jpeg.orientation = rotationRads
-				} else {
-					jpeg.orientation = 0.0
-				}
+				v, _ := entry.Uint16()
+				jpeg.orientation = orientationOf(v)
 			} else if entry.tag == 0x8769 { // EXIF IFD pointer
-				// EXIF IFD pointer.  Note: the pointer is the value represented
-				// in valueOffset.
+				// EXIF IFD pointer.  Note: the pointer is the value of the entry,
+				// by its field type; see ifdPointer.
 
 				// Read EXIF Entries
-				exifEntries, err := processIfd(n.IsHostLittleEndian(), h.isBigEndian, int64(entry.valueOffset), f)
+				exifEntries, err := processIfdOf(n.IsHostLittleEndian(), h.isBigEndian, &entry, f)
 				if err == nil {
+					m.tags.record(exifEntries, nefExifTags)
 					for exif := exifEntries.Front(); exif != nil; exif = exif.Next() {
-						exifEntry := exif.Value.(ifdEntry)
-						if exifEntry.tag == 0x9004 {
-							createDate, err := processASCIIEntry(&exifEntry, f)
-							if err == nil {
-								cDate, err = parseDateTime(createDate)
-							}
+						exifEntry := exif.Value.(IfdEntry)
+						processDateEntry(&exifEntry, &m.dates)
+						processPhotoIDEntry(&exifEntry, &m)
+						processLensEntry(&exifEntry, &m)
+						processExposureEntry(&exifEntry, &m)
+						processCompositeEntry(&exifEntry, &m)
+						processColorSpaceEntry(&exifEntry, &m)
+						processSubjectEntry(&exifEntry, &m)
+						if exifEntry.tag == 0xa005 { // Interoperability IFD pointer
+							processInteropIfd(n.IsHostLittleEndian(), h.isBigEndian, &exifEntry, f, &m)
+						}
+						if exifEntry.tag == 0x927c { // MakerNote
+							makerNoteEntry = &exifEntry
 						}
 					}
 				} else {
-					return &jpeg, cDate, err
+					m.readFailed("EXIF IFD", 0, err)
 				}
+			} else if entry.tag == 0x8825 { // GPS IFD pointer
+				processGpsIfd(n.IsHostLittleEndian(), h.isBigEndian, &entry, f, &m)
+			} else if entry.tag == 0x010f {
+				m.make = m.readASCIIEntry("IFD0", &entry)
+			} else if entry.tag == 0x0110 {
+				m.model = m.readASCIIEntry("IFD0", &entry)
+			} else if entry.tag == 0x0132 { // DateTime
+				m.dates.dateTime, _ = entry.ASCII()
+			} else if entry.tag == 0x013b || entry.tag == 0x8298 { // Artist, Copyright
+				processCopyrightEntry(&entry, &m)
+			} else if entry.tag == 0x02bc || entry.tag == 0x4746 { // XMP, Rating
+				processRatingEntry(&entry, &m)
+			} else if entry.tag == 0x0201 { // JPEGInterchangeFormat
+				v, _ := entry.Uint32()
+				ifd0Jpeg.offset = int64(v)
+			} else if entry.tag == 0x0202 { // JPEGInterchangeFormatLength
+				v, _ := entry.Uint32()
+				ifd0Jpeg.length = int64(v)
 			}
 		}
 	}
 
-	return &jpeg, cDate, err
+	if makerNoteEntry != nil {
+		if mn, err := nikonMakerNote(n.IsHostLittleEndian(), h.isBigEndian, makerNoteEntry, f); err == nil {
+			processNikonMakerNote(n.IsHostLittleEndian(), mn, f, &m)
+		}
+	}
+
+	if err == nil && jpeg.length == 0 &&
+		(earlyLayout || (CameraModel{m.make, m.model}).quirks()&quirkEarlyNefPreview != 0) {
+		n.processEarlyNefPreview(f, h, &ifd0Jpeg, makerNoteEntry, &jpeg)
+	}
+	if err == nil && jpeg.length == 0 {
+		n.processNefPreviewFallbacks(f, h, makerNoteEntry, subIfdsEntry, &jpeg)
+	}
+
+	return &jpeg, &m, err
 }
 
-// decodeAndWriteJpeg extracts the embedded jpeg bytes within a NEF,
-// decodes the JPEG data, and then creates a new jpeg file.
-// Returns the full path to the jpeg extracted or an error.
-func (n NefParser) decodeAndWriteJpeg(f *os.File, j *jpegInfo, destDir string, quality int) (jpegFileName string, err error) {
-	// extract jpeg to new file
-	jpegFileName = genExtractedJpegName(f, destDir, "_extracted.jpg")
-	log.Printf("Creating JPEG file: %s\n", jpegFileName)
+// processNefPreviewFallbacks locates the embedded jpeg of NEFs whose
+// SubIFD0 holds none, e.g., NEFs of some bodies or re-saved by Nikon
+// software.  In order of preference, the jpeg is taken from the
+// JPEGInterchangeFormat of IFD1, the PreviewIFD of the maker note, or the
+// largest jpeg strip of the SubIFDs.
+func (n NefParser) processNefPreviewFallbacks(f io.ReaderAt, h *nefHeader, makerNoteEntry, subIfdsEntry *IfdEntry, j *jpegInfo) {
+	if r := n.ifd1Preview(f, h); r.length > 0 {
+		j.offset, j.length = r.offset, r.length
+		return
+	}
+	if r := n.makerNotePreview(f, h, makerNoteEntry); r.length > 0 {
+		j.offset, j.length = r.offset, r.length
+		return
+	}
+	if r := n.largestSubIfdJpeg(f, h, subIfdsEntry); r.length > 0 {
+		j.offset, j.length = r.offset, r.length
+	}
+}
+
+// ifd1Preview reads the JPEGInterchangeFormat of IFD1.
+// Returns the location of the jpeg; zero if none.
+func (n NefParser) ifd1Preview(f io.ReaderAt, h *nefHeader) byteRange {
+	_, next, err := processIfdWithNext(n.IsHostLittleEndian(), h.isBigEndian, h.tiffOffset, f)
+	if err != nil || next <= 0 {
+		return byteRange{}
+	}
+	entries, err := processIfd(n.IsHostLittleEndian(), h.isBigEndian, next, f)
+	if err != nil {
+		return byteRange{}
+	}
+
+	var r byteRange
+	for e := entries.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(IfdEntry)
+		switch entry.tag {
+		case 0x0201:
+			v, _ := entry.Uint32()
+			r.offset = int64(v)
+		case 0x0202:
+			v, _ := entry.Uint32()
+			r.length = int64(v)
+		}
+	}
+	if r.length <= 0 || !isJpegAt(f, r.offset) {
+		return byteRange{}
+	}
+	return r
+}
+
+// makerNotePreview reads the PreviewIFD of the maker note.
+// Returns the location of the jpeg; zero if none.
+func (n NefParser) makerNotePreview(f io.ReaderAt, h *nefHeader, makerNoteEntry *IfdEntry) byteRange {
+	if makerNoteEntry == nil {
+		return byteRange{}
+	}
+	mn, err := nikonMakerNote(n.IsHostLittleEndian(), h.isBigEndian, makerNoteEntry, f)
+	if err != nil {
+		return byteRange{}
+	}
+	offset, length := nikonPreview(n.IsHostLittleEndian(), mn, f)
+	if length <= 0 || !isJpegAt(f, offset) {
+		return byteRange{}
+	}
+	return byteRange{offset, length}
+}
+
+// largestSubIfdJpeg finds the largest jpeg stored by a SubIFD, as a single
+// strip or by JPEGInterchangeFormat.
+// Returns the location of the jpeg; zero if none.
+func (n NefParser) largestSubIfdJpeg(f io.ReaderAt, h *nefHeader, subIfdsEntry *IfdEntry) byteRange {
+	var largest byteRange
+	if subIfdsEntry == nil {
+		return largest
+	}
+
+	for _, offset := range n.subIfdOffsets(f, h, subIfdsEntry) {
+		entries, err := processIfd(n.IsHostLittleEndian(), h.isBigEndian, offset, f)
+		if err != nil {
+			continue
+		}
+		var strip, jpeg byteRange
+		for e := entries.Front(); e != nil; e = e.Next() {
+			entry := e.Value.(IfdEntry)
+			switch {
+			case entry.tag == 0x0111 && entry.count == 1:
+				v, _ := entry.Uint32()
+				strip.offset = int64(v)
+			case entry.tag == 0x0117 && entry.count == 1:
+				v, _ := entry.Uint32()
+				strip.length = int64(v)
+			case entry.tag == 0x0201:
+				v, _ := entry.Uint32()
+				jpeg.offset = int64(v)
+			case entry.tag == 0x0202:
+				v, _ := entry.Uint32()
+				jpeg.length = int64(v)
+			}
+		}
+		for _, r := range []byteRange{strip, jpeg} {
+			if r.length > largest.length && isJpegAt(f, r.offset) {
+				largest = r
+			}
+		}
+	}
+	return largest
+}
+
+// processEarlyNefPreview locates the embedded jpeg of NEFs written by early
+// DSLRs (e.g., the D1 and D100), whose single SubIFD contains only the raw
+// image, or of the models with quirkEarlyNefPreview.
+// The jpeg is taken from IFD0 or, failing that, from the PreviewIFD of the
+// maker note.
+func (n NefParser) processEarlyNefPreview(f io.ReaderAt, h *nefHeader, ifd0Jpeg *byteRange, makerNoteEntry *IfdEntry, j *jpegInfo) {
+	if ifd0Jpeg.length > 0 && isJpegAt(f, ifd0Jpeg.offset) {
+		j.offset, j.length = ifd0Jpeg.offset, ifd0Jpeg.length
+		return
+	}
+
+	if r := n.makerNotePreview(f, h, makerNoteEntry); r.length > 0 {
+		j.offset, j.length = r.offset, r.length
+	}
+}
 
-	data := make([]byte, j.length)
-	_, err = f.ReadAt(data, j.offset)
+// processSubIfds reads every SubIFD referenced by the SubIFDs tag, which
+// are identified by their NewSubfileType: the dimensions of the
+// full-resolution raw image (0) are recorded, and the largest jpeg of the
+// other SubIFDs (e.g., the reduced-resolution preview, 1) is selected as
+// the embedded jpeg, with its resolution.  Most bodies store the preview
+// in SubIFD0, but some in SubIFD1 or SubIFD2.
+func (n NefParser) processSubIfds(f io.ReaderAt, h *nefHeader, subIfdsEntry *IfdEntry, j *jpegInfo, m *rawMetadata) {
+	for i, offset := range n.subIfdOffsets(f, h, subIfdsEntry) {
+		name := ifdName(tiff.KindSub, i)
+		entries, err := processIfd(n.IsHostLittleEndian(), h.isBigEndian, offset, f)
+		if err != nil {
+			// the entries read of a truncated SubIFD are processed
+			m.readFailed(name, 0, err)
+		}
+		m.tags.record(entries, ifd0Tags)
 
+		var width, height uint32
+		var jpeg jpegInfo
+		fullResolution := false
+		for e := entries.Front(); e != nil; e = e.Next() {
+			entry := e.Value.(IfdEntry)
+			switch entry.tag {
+			case 0x00fe: // NewSubfileType
+				v, err := entry.Uint32()
+				fullResolution = err == nil && v == 0
+			case 0x0100:
+				width, _ = entry.Uint32()
+			case 0x0101:
+				height, _ = entry.Uint32()
+			case 0x011a:
+				jpeg.xRes, _, jpeg.xResFloat, _ = entry.Rational()
+			case 0x011b:
+				jpeg.yRes, _, jpeg.yResFloat, _ = entry.Rational()
+			case 0x0201: // SHORT or LONG
+				v, _ := entry.Uint32()
+				jpeg.offset = int64(v)
+			case 0x0202:
+				v, _ := entry.Uint32()
+				jpeg.length = int64(v)
+			}
+		}
+
+		switch {
+		case fullResolution:
+			if width > 0 && height > 0 && m.imageWidth == 0 {
+				m.imageWidth, m.imageHeight = width, height
+			}
+		case jpeg.length > j.length:
+			if !isJpegAt(f, jpeg.offset) {
+				m.warn(fmt.Errorf("%s jpeg at offset %d is not a jpeg", name, jpeg.offset))
+				continue
+			}
+			j.offset, j.length = jpeg.offset, jpeg.length
+			j.xRes, j.xResFloat = jpeg.xRes, jpeg.xResFloat
+			j.yRes, j.yResFloat = jpeg.yRes, jpeg.yResFloat
+		}
+	}
+}
+
+// subIfdOffsets reads the offsets of the SubIFDs referenced by the SubIFDs
+// tag.
+// Returns the offsets; nil if they cannot be read.
+func (n NefParser) subIfdOffsets(f io.ReaderAt, h *nefHeader, entry *IfdEntry) []int64 {
+	if entry.count <= 1 {
+		return []int64{int64(entry.valueOffset)}
+	}
+
+	size, err := valueSize(entry.count, 4)
 	if err != nil {
-		log.Printf("Error reading embedded jpeg file: %v\n", err)
-		return jpegFileName, err
+		return nil
+	}
+	bytes, err := readField(entry.offset, size, f)
+	if err != nil {
+		return nil
+	}
+	offsets := make([]int64, 0, entry.count)
+	for i := 0; i < int(entry.count); i++ {
+		offsets = append(offsets, int64(bytesToUInt(n.IsHostLittleEndian(), h.isBigEndian, bytes[i*4:i*4+4])))
 	}
+	return offsets
+}
 
-	err = decodeAndWriteJpeg(data, quality, jpegFileName)
+// decodeAndWriteJpeg extracts the embedded jpeg bytes within a NEF,
+// decodes the JPEG data, and then creates a new jpeg file.
+// Returns the full path to the jpeg extracted or an error.
+func (n NefParser) decodeAndWriteJpeg(f *os.File, j *jpegInfo, destDir string, quality int) (jpegFileName string, err error) {
+	src := fileSource(f)
+	jpegFileName = genExtractedJpegName(src, destDir, OutputJpeg.suffix())
+	return jpegFileName, writePreview(src, j, jpegFileName, quality, OutputJpeg, JpegOptions{}, ColorSpaceSRGB, nil, nil)
+}
 
-	return jpegFileName, err
+// Capabilities returns the operations supported for NEF files: those of the
+// built-in parsers, and the tags may be rewritten by UpdateTags.
+func (n NefParser) Capabilities() Capabilities {
+	c := n.rawParser.Capabilities()
+	c.Write = true
+	return c
 }
 
 // NewNefParser creates an instance of NEF-specific RawParser.
 // Returns an instance of a NEF-specific RawParser.
+// The hostIsLittleEndian argument is ignored; see RawParser.
 func NewNefParser(hostIsLittleEndian bool) (RawParser, string) {
-	return &NefParser{&rawParser{hostIsLittleEndian}}, NefParserKey
+	return &NefParser{&rawParser{}}, NefParserKey
 }
@@ -24,23 +24,26 @@
 package rawparser
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 const (
 	TestNefFile       = "test_files/big_endian.NEF"
-	TestNefNoJpegFile = "test_files/little_endian_no_jpeg.NEF"
+	TestNefNoJpegFile = "test_files/little_endian_no_jpeg.NEF" // preview in the maker note only
 )
 
 var (
-	gHostIsLe  bool
 	gNefParser *NefParser
 )
 
 func setupNef() {
-	gHostIsLe = isHostLittleEndian()
-	gNefParser = &NefParser{&rawParser{gHostIsLe}}
+	gNefParser = &NefParser{&rawParser{}}
 }
 
 func openTestNefFile() (*os.File, error) {
@@ -111,11 +114,11 @@ func TestProcessNefIfds(t *testing.T) {
 			t.Fail()
 		}
 		t.Logf("Header: %v\n", h)
-		jpegInfo, createDate, err := gNefParser.processIfds(f, h)
+		jpegInfo, meta, err := gNefParser.processIfds(f, h)
 		if err != nil {
 			t.Fail()
 		}
-		t.Logf("jegInfo: %v createDate: %v\n", jpegInfo, createDate)
+		t.Logf("jegInfo: %v meta: %v\n", jpegInfo, meta)
 
 	} else {
 		t.Fatalf("Unable to open test NEF file: %v\n", e)
@@ -133,11 +136,11 @@ func TestProcessNefJpegDecodeAndWrite(t *testing.T) {
 			t.Fail()
 		}
 		t.Logf("Header: %v\n", h)
-		jpegInfo, createDate, err := gNefParser.processIfds(f, h)
+		jpegInfo, meta, err := gNefParser.processIfds(f, h)
 		if err != nil {
 			t.Fail()
 		}
-		t.Logf("jpegInfo: %v createDate: %v\n", jpegInfo, createDate)
+		t.Logf("jpegInfo: %v meta: %v\n", jpegInfo, meta)
 
 		curdir, e := os.Getwd()
 		if e != nil {
@@ -172,7 +175,7 @@ func TestNefProcessFile(t *testing.T) {
 	testdir, e := getNefTestDir()
 	if e == nil {
 		// big endian nef
-		ni := RawFileInfo{TestNefFile, testdir, 50}
+		ni := RawFileInfo{File: TestNefFile, DestDir: testdir, Quality: 50, CollectUnknownTags: true}
 		nef, err := gNefParser.ProcessFile(&ni)
 		defer os.Remove(nef.JpegPath)
 		if err != nil {
@@ -188,21 +191,94 @@ func TestNefProcessFile(t *testing.T) {
 			t.Fail()
 		}
 		t.Logf("Parsed big endian Nef: %v\n", nef)
+
+		// verify dimensions
+		if nef.ImageWidth != 4288 || nef.ImageHeight != 2844 {
+			t.Errorf("Unexpected raw dimensions: %dx%d\n", nef.ImageWidth, nef.ImageHeight)
+		}
+		if nef.PreviewWidth <= 0 || nef.PreviewHeight <= 0 {
+			t.Errorf("Unexpected preview dimensions: %dx%d\n", nef.PreviewWidth, nef.PreviewHeight)
+		}
+
+		// verify tag statistics
+		stats := nef.TagStats
+		if stats.Parsed == 0 || stats.Recognized == 0 ||
+			stats.Parsed != stats.Recognized+stats.Unknown || len(stats.UnknownTags) == 0 {
+			t.Errorf("Unexpected tag statistics: %+v\n", stats)
+		}
 	}
 }
 
+// buildNoJpegNef builds a NEF without an embedded jpeg: its SubIFDs hold
+// only the raw image.
+func buildNoJpegNef() []byte {
+	tt := newTestTiff(false)
+	raw := tt.addIfd(0,
+		longEntry(0x00fe, 0),
+		longEntry(0x0100, 2000),
+		longEntry(0x0101, 1312),
+		shortEntry(0x0103, 1))
+	return tt.bytes(tt.addIfd(0, longEntry(0x014a, raw, raw)))
+}
+
 func TestNefProcessFileNoJpeg(t *testing.T) {
 	setupNef()
 
-	testdir, e := getNefTestDir()
-	if e == nil {
-		ni := RawFileInfo{TestNefNoJpegFile, testdir, 50}
-		_, err := gNefParser.ProcessFile(&ni)
-		if err == nil {
-			t.Fail()
+	path, dir := writeTestFile(t, "nojpeg.NEF", buildNoJpegNef())
+	ni := RawFileInfo{File: path, DestDir: dir, Quality: 50}
+	_, err := gNefParser.ProcessFile(&ni)
+	if err == nil {
+		t.Fail()
+	}
+}
+
+// TestNefProcessFileMakerNotePreview verifies that the preview of a NEF
+// without a jpeg in SubIFD0 is taken from the maker note.
+func TestNefProcessFileMakerNotePreview(t *testing.T) {
+	setupNef()
+
+	nef, err := gNefParser.ProcessFile(&RawFileInfo{File: TestNefNoJpegFile, DestDir: t.TempDir(), Quality: 50})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if nef.JpegPath == "" || nef.PreviewWidth == 0 || nef.PreviewHeight == 0 {
+		t.Errorf("Unexpected result: %+v\n", nef)
+	}
+}
+
+func TestNefPreviewFallbacks(t *testing.T) {
+	p, _ := NewNefParser(isHostLittleEndian())
+
+	builders := map[string]func(tt *testTiff, preview []byte) uint32{
+		// JPEGInterchangeFormat of IFD1
+		"ifd1": func(tt *testTiff, preview []byte) uint32 {
+			raw := tt.addIfd(0, longEntry(0x00fe, 0))
+			ifd1 := tt.addIfd(0,
+				longEntry(0x0201, tt.addBlob(preview)),
+				longEntry(0x0202, uint32(len(preview))))
+			return tt.addIfd(ifd1, longEntry(0x014a, raw, raw))
+		},
+		// the largest jpeg strip of the SubIFDs
+		"strip": func(tt *testTiff, preview []byte) uint32 {
+			thumb := testJpeg(t, 32, 24)
+			small := tt.addIfd(0,
+				longEntry(0x0111, tt.addBlob(thumb)),
+				longEntry(0x0117, uint32(len(thumb))))
+			large := tt.addIfd(0,
+				longEntry(0x0111, tt.addBlob(preview)),
+				longEntry(0x0117, uint32(len(preview))))
+			return tt.addIfd(0, longEntry(0x014a, small, large))
+		},
+	}
+
+	for name, build := range builders {
+		tt := newTestTiff(true)
+		path, dir := writeTestFile(t, name+".NEF", tt.bytes(build(tt, testJpeg(t, 160, 120))))
+
+		r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75})
+		if err != nil || r.PreviewWidth != 160 || r.PreviewHeight != 120 {
+			t.Errorf("%s: unexpected result: %+v, %v\n", name, r, err)
 		}
-	} else {
-		t.Fatal("Unable to determine test directory")
 	}
 }
 
@@ -213,7 +289,7 @@ func TestNefProcessNonExistentFile(t *testing.T) {
 	if e != nil {
 		t.Fatal("Unable to determine test directory")
 	} else {
-		ni := RawFileInfo{"", testdir, 50}
+		ni := RawFileInfo{File: "", DestDir: testdir, Quality: 50}
 		_, err := gNefParser.ProcessFile(&ni)
 		if err == nil {
 			t.Fatal("Expected error not generated while parsing NEF")
@@ -226,11 +302,341 @@ func TestNefProcessNonExistentFile(t *testing.T) {
 func TestNefEndianessState(t *testing.T) {
 	setupNef()
 
-	if gNefParser.SetHostIsLittleEndian(true); gNefParser.IsHostLittleEndian() != true {
-		t.Fail()
+	// the host endianness is detected; setting it has no effect
+	for _, b := range []bool{true, false} {
+		if gNefParser.SetHostIsLittleEndian(b); gNefParser.IsHostLittleEndian() != isHostLittleEndian() {
+			t.Fail()
+		}
 	}
+}
 
-	if gNefParser.SetHostIsLittleEndian(false); gNefParser.IsHostLittleEndian() != false {
-		t.Fail()
+func TestNefProcessFileNoJpegMetadata(t *testing.T) {
+	setupNef()
+
+	testdir, e := getNefTestDir()
+	if e != nil {
+		t.Fatal("Unable to determine test directory")
+	}
+
+	path, _ := writeTestFile(t, "nojpeg.NEF", buildNoJpegNef())
+	ni := RawFileInfo{File: path, DestDir: testdir, Quality: 50}
+	nef, err := gNefParser.ProcessFile(&ni)
+	if !errors.Is(err, ErrExtractionFailed) {
+		t.Fatalf("Expected ErrExtractionFailed; got: %v\n", err)
+	}
+	if nef.Extraction == nil || !errors.Is(nef.Extraction.Err, ErrNoPreview) {
+		t.Fatalf("Expected ErrNoPreview extraction result; got: %+v\n", nef.Extraction)
+	}
+	if nef.FileName != path || nef.ImageWidth == 0 {
+		t.Errorf("Metadata not populated: %+v\n", nef)
+	}
+}
+
+func TestNefProcessFileSkipExtraction(t *testing.T) {
+	setupNef()
+
+	testdir, e := getNefTestDir()
+	if e != nil {
+		t.Fatal("Unable to determine test directory")
+	}
+
+	ni := RawFileInfo{File: TestNefFile, DestDir: testdir, Quality: 50, SkipExtraction: true}
+	nef, err := gNefParser.ProcessFile(&ni)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if !nef.Extraction.Skipped || nef.JpegPath != "" || nef.CreateDate.IsZero() {
+		t.Errorf("Unexpected result: %+v\n", nef)
+	}
+}
+
+// buildEarlyNef builds a synthetic NEF in the layout of early DSLRs: the
+// SubIFD holds only the raw image and the preview is stored in IFD0
+// (layout "ifd0") or in the PreviewIFD of the maker note, with a version
+// 1, version 2, or no maker note header (layouts "v1", "v2", "none").
+func buildEarlyNef(t *testing.T, layout string, fileBe, makerNoteBe bool) []byte {
+	tt := newTestTiff(fileBe)
+	preview := tt.addBlob(testJpeg(t, 160, 120))
+	previewLen := uint32(len(testJpeg(t, 160, 120)))
+
+	raw := tt.addIfd(0,
+		longEntry(0x00fe, 0),
+		longEntry(0x0100, 2000),
+		longEntry(0x0101, 1312),
+		shortEntry(0x0103, 1))
+
+	// ifdBytes builds a position-independent IFD
+	ifdBytes := func(be bool, entries ...testEntry) []byte {
+		ifd := newTestTiff(be)
+		return ifd.buf[ifd.addIfd(0, entries...):]
+	}
+
+	var makerNote []byte
+	switch layout {
+	case "v2":
+		mn := newTestTiff(makerNoteBe)
+		previewIfd := mn.addIfd(0,
+			longEntry(0x0201, mn.addBlob(testJpeg(t, 160, 120))),
+			longEntry(0x0202, previewLen))
+		makerNote = append([]byte("Nikon\x00\x02\x10\x00\x00"), mn.bytes(mn.addIfd(0, longEntry(0x0011, previewIfd)))...)
+	case "v1", "none":
+		previewIfd := tt.addBlob(ifdBytes(makerNoteBe, longEntry(0x0201, preview), longEntry(0x0202, previewLen)))
+		makerNote = ifdBytes(makerNoteBe, longEntry(0x0011, previewIfd))
+		if layout == "v1" {
+			makerNote = append([]byte("Nikon\x00\x01\x00"), makerNote...)
+		}
+	}
+
+	var ifd0Entries []testEntry
+	if makerNote != nil {
+		exif := tt.addIfd(0,
+			asciiEntry(0x9004, "2003:04:05 06:07:08"),
+			testEntry{tag: 0x927c, fieldType: 7, raw: makerNote})
+		ifd0Entries = append(ifd0Entries, longEntry(0x8769, exif))
+	} else {
+		ifd0Entries = append(ifd0Entries, longEntry(0x0201, preview), longEntry(0x0202, previewLen))
+	}
+	ifd0Entries = append(ifd0Entries, longEntry(0x014a, raw))
+
+	return tt.bytes(tt.addIfd(0, ifd0Entries...))
+}
+
+func TestNefProcessFileEarlyLayouts(t *testing.T) {
+	p, _ := NewNefParser(isHostLittleEndian())
+	for _, layout := range []string{"ifd0", "v1", "v2", "none"} {
+		for _, fileBe := range []bool{false, true} {
+			data := buildEarlyNef(t, layout, fileBe, fileBe)
+			path, dir := writeTestFile(t, "early.NEF", data)
+
+			r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75})
+			if err != nil {
+				t.Errorf("%s (big endian %v): unexpected error: %v\n", layout, fileBe, err)
+				continue
+			}
+			if r.PreviewWidth != 160 || r.PreviewHeight != 120 ||
+				r.ImageWidth != 2000 || r.ImageHeight != 1312 {
+				t.Errorf("%s (big endian %v): unexpected result: %+v\n", layout, fileBe, r)
+			}
+		}
+	}
+}
+
+func TestNefProcessFileMixedEndianMakerNote(t *testing.T) {
+	p, _ := NewNefParser(isHostLittleEndian())
+
+	for _, layout := range []string{"v1", "v2", "none"} {
+		for _, fileBe := range []bool{false, true} {
+			for _, makerNoteBe := range []bool{false, true} {
+				data := buildEarlyNef(t, layout, fileBe, makerNoteBe)
+				path, dir := writeTestFile(t, "mixed.NEF", data)
+
+				r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75})
+				if err != nil || r.PreviewWidth != 160 || r.PreviewHeight != 120 {
+					t.Errorf("%s (file big endian %v, maker note big endian %v): unexpected result: %+v, %v\n",
+						layout, fileBe, makerNoteBe, r, err)
+				}
+			}
+		}
+	}
+}
+
+func TestEmbeddedTiffHeader(t *testing.T) {
+	le := isHostLittleEndian()
+
+	isBigEndian, ifd, err := embeddedTiffHeader(le, []byte{'M', 'M', 0, 42, 0, 0, 0, 8})
+	if err != nil || !isBigEndian || ifd != 8 {
+		t.Errorf("Unexpected big endian header: %v %d %v\n", isBigEndian, ifd, err)
+	}
+
+	isBigEndian, ifd, err = embeddedTiffHeader(le, []byte{'I', 'I', 42, 0, 8, 0, 0, 0})
+	if err != nil || isBigEndian || ifd != 8 {
+		t.Errorf("Unexpected little endian header: %v %d %v\n", isBigEndian, ifd, err)
+	}
+
+	for _, header := range [][]byte{
+		{'M', 'I', 0, 42, 0, 0, 0, 8},
+		{'I', 'I', 0, 42, 0, 0, 0, 8},
+	} {
+		if _, _, err := embeddedTiffHeader(le, header); err == nil {
+			t.Errorf("Expected error for header % x\n", header)
+		}
+	}
+}
+
+// buildDamagedNef builds a NEF whose preview is intact but whose EXIF IFD
+// pointer is out of range.
+func buildDamagedNef(t *testing.T) []byte {
+	tt := newTestTiff(true)
+	preview := testJpeg(t, 160, 120)
+	sub0 := tt.addIfd(0,
+		longEntry(0x0201, tt.addBlob(preview)),
+		longEntry(0x0202, uint32(len(preview))))
+	return tt.bytes(tt.addIfd(0,
+		longEntry(0x014a, sub0, sub0),
+		longEntry(0x8769, 0x7ffffff0)))
+}
+
+func TestNefProcessFileLenient(t *testing.T) {
+	p, _ := NewNefParser(isHostLittleEndian())
+	path, dir := writeTestFile(t, "damaged.NEF", buildDamagedNef(t))
+
+	if _, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75}); err == nil {
+		t.Error("Expected error processing damaged NEF")
+	}
+
+	r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75, Lenient: true})
+	if err != nil {
+		t.Fatalf("Unexpected error processing damaged NEF leniently: %v\n", err)
+	}
+	if r.JpegPath == "" || r.PreviewWidth != 160 {
+		t.Errorf("Unexpected result: %+v\n", r)
+	}
+	if len(r.Warnings) != 2 || !errors.Is(r.Warnings[1], ErrNoCreateDate) {
+		t.Errorf("Unexpected warnings: %v\n", r.Warnings)
+	}
+
+	data, _ := json.Marshal(r)
+	if !strings.Contains(string(data), `"warnings":["reading EXIF IFD: `) {
+		t.Errorf("Unexpected JSON: %s\n", data)
+	}
+}
+
+// buildModernNef builds a synthetic NEF in the layout of current bodies:
+// the preview in SubIFD0, the raw image in SubIFD1, and a version 2 maker
+// note with its own TIFF header, in the byte order of makerNoteBe (e.g., a
+// NEF rewritten by editing software in another byte order).  The preview
+// location and the EXIF IFD pointer are recorded as SHORT or LONG values.
+func buildModernNef(t *testing.T, fileBe, makerNoteBe, shortOffsets bool) []byte {
+	tt := newTestTiff(fileBe)
+	preview := testJpeg(t, 320, 240)
+	previewOffset := tt.addBlob(preview)
+
+	location := []testEntry{longEntry(0x0201, previewOffset), longEntry(0x0202, uint32(len(preview)))}
+	pointer := longEntry
+	if shortOffsets {
+		location = []testEntry{shortEntry(0x0201, previewOffset), shortEntry(0x0202, uint32(len(preview)))}
+		pointer = shortEntry
+	}
+	sub0 := tt.addIfd(0, append([]testEntry{
+		longEntry(0x00fe, 1),
+		{tag: 0x011a, fieldType: 5, values: []uint32{300, 1}},
+		{tag: 0x011b, fieldType: 5, values: []uint32{300, 1}}}, location...)...)
+	sub1 := tt.addIfd(0,
+		longEntry(0x00fe, 0),
+		longEntry(0x0100, 6048),
+		longEntry(0x0101, 4032),
+		shortEntry(0x0103, 34713))
+
+	mn := newTestTiff(makerNoteBe)
+	mnIfd := mn.addIfd(0,
+		testEntry{tag: 0x0012, fieldType: 7, raw: []byte{0xfa, 1, 6, 0}}, // -1 EV
+		longEntry(0x00a7, 12345))
+	makerNote := append([]byte("Nikon\x00\x02\x10\x00\x00"), mn.bytes(mnIfd)...)
+
+	exif := tt.addIfd(0,
+		asciiEntry(0x9004, "2021:06:07 08:09:10"),
+		shortEntry(0x8822, 3),
+		testEntry{tag: 0x927c, fieldType: 7, raw: makerNote})
+
+	return tt.bytes(tt.addIfd(0,
+		asciiEntry(0x010f, "NIKON CORPORATION"),
+		asciiEntry(0x0110, "NIKON Z 6"),
+		shortEntry(0x0112, 6),
+		longEntry(0x014a, sub0, sub1),
+		pointer(0x8769, exif)))
+}
+
+func TestNefProcessFileByteOrders(t *testing.T) {
+	p, _ := NewNefParser(isHostLittleEndian())
+	want := time.Date(2021, time.June, 7, 8, 9, 10, 0, time.UTC)
+
+	for _, fileBe := range []bool{false, true} {
+		for _, makerNoteBe := range []bool{false, true} {
+			for _, shortOffsets := range []bool{false, true} {
+				name := fmt.Sprintf("file big endian %v, maker note big endian %v, SHORT offsets %v", fileBe, makerNoteBe, shortOffsets)
+				path, dir := writeTestFile(t, "modern.NEF", buildModernNef(t, fileBe, makerNoteBe, shortOffsets))
+
+				r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75})
+				if err != nil {
+					t.Errorf("%s: unexpected error: %v\n", name, err)
+					continue
+				}
+				if r.PreviewWidth != 320 || r.PreviewHeight != 240 || r.JpegPath == "" ||
+					r.ImageWidth != 6048 || r.ImageHeight != 4032 {
+					t.Errorf("%s: unexpected images: %+v\n", name, r)
+				}
+				if !r.CreateDate.Equal(want) || r.Orientation != Rotate90 || r.CameraModel.String() != "NIKON Z 6" {
+					t.Errorf("%s: unexpected metadata: %v %v %v\n", name, r.CreateDate, r.Orientation, r.CameraModel)
+				}
+				if r.ShutterCount != 12345 || r.Exposure.FlashCompensation != -1 || r.Exposure.Program != ProgramAperturePriority {
+					t.Errorf("%s: unexpected maker note: %d %+v\n", name, r.ShutterCount, r.Exposure)
+				}
+			}
+		}
+	}
+}
+
+func TestNefProcessFileLittleEndian(t *testing.T) {
+	setupNef()
+	p, _ := NewNefParser(isHostLittleEndian())
+
+	f, err := os.Open(TestNefNoJpegFile)
+	if err != nil {
+		t.Fatalf("Unable to open test NEF file: %v\n", err)
+	}
+	defer f.Close()
+	h, err := gNefParser.processHeader(f)
+	if err != nil || h.isBigEndian {
+		t.Fatalf("Unexpected header: %+v %v\n", h, err)
+	}
+
+	r, err := p.ProcessFile(&RawFileInfo{File: TestNefNoJpegFile, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if r.PreviewBytes == 0 || r.ImageWidth != 2576 || r.CreateDate.IsZero() || r.CameraModel.Model != "E5700" {
+		t.Errorf("Unexpected result: %+v\n", r)
+	}
+}
+
+func TestNefProcessFilePreviewInLaterSubIfd(t *testing.T) {
+	tt := newTestTiff(true)
+	thumb := testJpeg(t, 160, 120)
+	thumbOffset := tt.addBlob(thumb)
+	preview := testJpeg(t, 640, 480)
+	previewOffset := tt.addBlob(preview)
+
+	sub0 := tt.addIfd(0,
+		longEntry(0x00fe, 1),
+		longEntry(0x0201, thumbOffset),
+		longEntry(0x0202, uint32(len(thumb))))
+	sub1 := tt.addIfd(0,
+		longEntry(0x00fe, 0),
+		longEntry(0x0100, 6048),
+		longEntry(0x0101, 4032),
+		shortEntry(0x0103, 34713))
+	sub2 := tt.addIfd(0,
+		longEntry(0x00fe, 1),
+		testEntry{tag: 0x011a, fieldType: 5, values: []uint32{300, 1}},
+		testEntry{tag: 0x011b, fieldType: 5, values: []uint32{300, 1}},
+		longEntry(0x0201, previewOffset),
+		longEntry(0x0202, uint32(len(preview))))
+	exif := tt.addIfd(0, asciiEntry(0x9004, "2021:06:07 08:09:10"))
+	path, dir := writeTestFile(t, "subifd2.NEF", tt.bytes(tt.addIfd(0,
+		asciiEntry(0x010f, "NIKON CORPORATION"),
+		asciiEntry(0x0110, "NIKON Z 9"),
+		longEntry(0x014a, sub0, sub1, sub2),
+		longEntry(0x8769, exif))))
+
+	p, _ := NewNefParser(isHostLittleEndian())
+	r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if r.PreviewWidth != 640 || r.PreviewHeight != 480 || r.PreviewBytes != int64(len(preview)) {
+		t.Errorf("Expected the SubIFD2 preview, got %dx%d (%d bytes)\n", r.PreviewWidth, r.PreviewHeight, r.PreviewBytes)
+	}
+	if r.ImageWidth != 6048 || r.ImageHeight != 4032 {
+		t.Errorf("Expected the SubIFD1 raw dimensions, got %dx%d\n", r.ImageWidth, r.ImageHeight)
 	}
 }
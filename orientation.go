@@ -0,0 +1,151 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import "math"
+
+// Orientation is the orientation of the embedded JPEG, as the
+// transformation needed to display it upright.  Values are those of the
+// TIFF/EXIF Orientation tag (0x0112); the zero value is treated as
+// Horizontal.
+type Orientation uint16
+
+const (
+	// Horizontal requires no transformation.
+	Horizontal Orientation = iota + 1
+	// MirrorHorizontal mirrors the image horizontally.
+	MirrorHorizontal
+	// Rotate180 rotates the image 180 degrees.
+	Rotate180
+	// MirrorVertical mirrors the image vertically.
+	MirrorVertical
+	// MirrorHorizontalRotate270 mirrors the image horizontally, then
+	// rotates it 270 degrees clockwise.
+	MirrorHorizontalRotate270
+	// Rotate90 rotates the image 90 degrees clockwise.
+	Rotate90
+	// MirrorHorizontalRotate90 mirrors the image horizontally, then
+	// rotates it 90 degrees clockwise.
+	MirrorHorizontalRotate90
+	// Rotate270 rotates the image 270 degrees clockwise.
+	Rotate270
+)
+
+// orientationOf converts a TIFF orientation value to an Orientation.
+// Returns Horizontal for undefined values.
+func orientationOf(o uint16) Orientation {
+	if o < uint16(Horizontal) || o > uint16(Rotate270) {
+		return Horizontal
+	}
+	return Orientation(o)
+}
+
+// orientationOfDegrees converts a clockwise rotation, in degrees, to the
+// Orientation of the nearest quarter turn.
+func orientationOfDegrees(degrees float64) Orientation {
+	turns := math.Mod(math.Round(degrees/90), 4)
+	if turns < 0 {
+		turns += 4
+	}
+	switch turns {
+	case 1:
+		return Rotate90
+	case 2:
+		return Rotate180
+	case 3:
+		return Rotate270
+	}
+	return Horizontal
+}
+
+// Transform returns the transformation needed to display the image
+// upright: whether to mirror it horizontally and the clockwise rotation,
+// in degrees (0, 90, 180, or 270), to apply after mirroring.
+func (o Orientation) Transform() (degrees int, mirror bool) {
+	switch o {
+	case MirrorHorizontal:
+		return 0, true
+	case Rotate180:
+		return 180, false
+	case MirrorVertical:
+		return 180, true
+	case MirrorHorizontalRotate270:
+		return 270, true
+	case Rotate90:
+		return 90, false
+	case MirrorHorizontalRotate90:
+		return 90, true
+	case Rotate270:
+		return 270, false
+	}
+	return 0, false
+}
+
+// Degrees returns the clockwise rotation, in degrees, needed to display
+// the image upright.  See Transform for mirrored orientations.
+func (o Orientation) Degrees() int {
+	degrees, _ := o.Transform()
+	return degrees
+}
+
+// radians returns the clockwise rotation, in radians, as formerly
+// reported by RawFile.JpegOrientation.
+func (o Orientation) radians() float64 {
+	return float64(o.Degrees()) * math.Pi / 180
+}
+
+// String returns the name of the orientation, as in JSON.
+func (o Orientation) String() string {
+	switch o {
+	case MirrorHorizontal:
+		return OrientationMirrorHorizontal
+	case Rotate180:
+		return OrientationRotate180
+	case MirrorVertical:
+		return OrientationMirrorVertical
+	case MirrorHorizontalRotate270:
+		return OrientationMirrorHorizontalRotate270
+	case Rotate90:
+		return OrientationRotate90
+	case MirrorHorizontalRotate90:
+		return OrientationMirrorHorizontalRotate90
+	case Rotate270:
+		return OrientationRotate270
+	}
+	return OrientationNormal
+}
+
+// exif returns the EXIF orientation value.
+func (o Orientation) exif() uint16 {
+	return uint16(orientationOf(uint16(o)))
+}
+
+// orientation returns the Orientation of the embedded JPEG, falling back
+// to the deprecated JpegOrientation if Orientation is not set.
+func (r *RawFile) orientation() Orientation {
+	if r.Orientation != 0 {
+		return r.Orientation
+	}
+	return orientationOfDegrees(r.JpegOrientation * 180 / math.Pi)
+}
@@ -0,0 +1,119 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+func TestOrientationTransform(t *testing.T) {
+	tests := []struct {
+		o       Orientation
+		degrees int
+		mirror  bool
+		name    string
+	}{
+		{0, 0, false, OrientationNormal},
+		{Horizontal, 0, false, OrientationNormal},
+		{MirrorHorizontal, 0, true, OrientationMirrorHorizontal},
+		{Rotate180, 180, false, OrientationRotate180},
+		{MirrorVertical, 180, true, OrientationMirrorVertical},
+		{MirrorHorizontalRotate270, 270, true, OrientationMirrorHorizontalRotate270},
+		{Rotate90, 90, false, OrientationRotate90},
+		{MirrorHorizontalRotate90, 90, true, OrientationMirrorHorizontalRotate90},
+		{Rotate270, 270, false, OrientationRotate270},
+	}
+
+	for _, test := range tests {
+		degrees, mirror := test.o.Transform()
+		if degrees != test.degrees || mirror != test.mirror || test.o.Degrees() != test.degrees {
+			t.Errorf("Unexpected transform of %v: %d %t\n", test.o, degrees, mirror)
+		}
+		if test.o.String() != test.name {
+			t.Errorf("Unexpected name of %d: %s\n", test.o, test.o.String())
+		}
+	}
+}
+
+func TestOrientationOf(t *testing.T) {
+	for o, want := range map[uint16]Orientation{0: Horizontal, 1: Horizontal, 6: Rotate90, 8: Rotate270, 9: Horizontal} {
+		if got := orientationOf(o); got != want {
+			t.Errorf("Unexpected orientation of %d: %v\n", o, got)
+		}
+	}
+	for degrees, want := range map[float64]Orientation{0: Horizontal, 90: Rotate90, -90: Rotate270, 180: Rotate180, 270: Rotate270} {
+		if got := orientationOfDegrees(degrees); got != want {
+			t.Errorf("Unexpected orientation of %f degrees: %v\n", degrees, got)
+		}
+	}
+}
+
+// TestRawFileOrientationFallback verifies that a RawFile with only the
+// deprecated JpegOrientation set reports the equivalent Orientation.
+func TestRawFileOrientationFallback(t *testing.T) {
+	r := RawFile{JpegOrientation: 90 * math.Pi / 180}
+	if o := r.orientation(); o != Rotate90 {
+		t.Errorf("Unexpected orientation: %v\n", o)
+	}
+
+	r.Orientation = MirrorHorizontal
+	if o := r.orientation(); o != MirrorHorizontal {
+		t.Errorf("Unexpected orientation: %v\n", o)
+	}
+}
+
+// TestOrientationByteOrder verifies that the Orientation of IFD0, a SHORT
+// stored within the value offset, is read in the byte order of the file by
+// each parser, regardless of the byte order of the host.
+func TestOrientationByteOrder(t *testing.T) {
+	for _, bigEndian := range []bool{false, true} {
+		for _, o := range []uint16{1, 3, 6, 8} {
+			tt := newTestTiff(bigEndian)
+			ifd := tt.addIfd(0, shortEntry(0x0112, uint32(o)), asciiEntry(0x010f, "NIKON"))
+			f := bytes.NewReader(tt.bytes(ifd))
+			want := orientationOf(o)
+
+			nef, _, err := (&NefParser{&rawParser{}}).processIfds(f, &nefHeader{isBigEndian: bigEndian, tiffOffset: int64(ifd)})
+			if err != nil || nef.orientation != want {
+				t.Errorf("Unexpected NEF orientation %d (big endian %v): %v %v\n", o, bigEndian, nef.orientation, err)
+			}
+			cr2, _, err := (&Cr2Parser{&rawParser{}}).processIfds(f, &cr2Header{isBigEndian: bigEndian, tiffOffset: int64(ifd)})
+			if err != nil || cr2.orientation != want {
+				t.Errorf("Unexpected CR2 orientation %d (big endian %v): %v %v\n", o, bigEndian, cr2.orientation, err)
+			}
+			h, err := tiff.ReadHeader(f)
+			if err != nil {
+				t.Fatalf("Unexpected error reading header: %v\n", err)
+			}
+			tif, _, err := (tiffParser{rawParser: &rawParser{}}).processIfds(f, h)
+			if err != nil || tif.orientation != want {
+				t.Errorf("Unexpected TIFF orientation %d (big endian %v): %v %v\n", o, bigEndian, tif.orientation, err)
+			}
+		}
+	}
+}
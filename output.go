@@ -0,0 +1,386 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// OutputFormat is the image format of an extracted preview.
+type OutputFormat int
+
+const (
+	// OutputJpeg re-encodes the embedded preview as JPEG.  This is the
+	// default and is supported by every build.
+	OutputJpeg OutputFormat = iota
+
+	// OutputAvif encodes the embedded preview as AVIF.  Requires the
+	// "avif" build tag (libavif).
+	OutputAvif
+
+	// OutputJxl encodes the embedded preview as JPEG XL.  Requires the
+	// "jxl" build tag (libjxl).
+	OutputJxl
+
+	// OutputHeic encodes the embedded preview as HEIC (HEVC in a HEIF
+	// container).  Requires the "heic" build tag (libheif).
+	OutputHeic
+)
+
+// QualityAuto, as the quality of a preview, selects the highest JPEG
+// quality at which the re-encoded preview is no larger than the embedded
+// one.  The preview is encoded several times to find it.
+const QualityAuto = -1
+
+// Subsampling is the chroma subsampling of re-encoded JPEG previews.
+type Subsampling int
+
+const (
+	// Subsampling420 halves the resolution of the chroma horizontally and
+	// vertically.  This is the default.
+	Subsampling420 Subsampling = iota
+
+	// Subsampling444 keeps the full resolution of the chroma, e.g., for
+	// previews with fine colored detail.
+	Subsampling444
+)
+
+// String returns the name of the chroma subsampling.
+func (s Subsampling) String() string {
+	switch s {
+	case Subsampling420:
+		return "4:2:0"
+	case Subsampling444:
+		return "4:4:4"
+	}
+	return fmt.Sprintf("Subsampling(%d)", int(s))
+}
+
+// JpegOptions are the options, other than the quality, of re-encoded JPEG
+// previews.  The zero value is a baseline JPEG with 4:2:0 chroma
+// subsampling.
+type JpegOptions struct {
+	// Subsampling is the chroma subsampling.
+	Subsampling Subsampling
+
+	// Progressive writes a progressive JPEG, which web browsers display
+	// at increasing quality as it loads.
+	Progressive bool
+}
+
+// flags returns the options as the flags of the native JPEG encoders.
+func (o JpegOptions) flags() (subsampling444, progressive int) {
+	if o.Subsampling == Subsampling444 {
+		subsampling444 = 1
+	}
+	if o.Progressive {
+		progressive = 1
+	}
+	return subsampling444, progressive
+}
+
+// ErrOutputFormatUnsupported is returned when the requested OutputFormat
+// has no encoder in the current build.
+var ErrOutputFormatUnsupported = errors.New("output format not supported by this build")
+
+// imageEncoder encodes an image using a quality parameter from 1 to 100,
+// where 100 is the best encoding quality.
+type imageEncoder func(w io.Writer, img image.Image, quality int) error
+
+// outputEncoders are the encoders for the formats other than JPEG,
+// registered by the build-tagged encoder files.
+var outputEncoders = make(map[OutputFormat]imageEncoder)
+
+// registerEncoder makes an encoder available for an output format.
+func registerEncoder(format OutputFormat, e imageEncoder) {
+	log.Printf("Registering %s encoder\n", format)
+	outputEncoders[format] = e
+}
+
+// String returns the name of the output format.
+func (o OutputFormat) String() string {
+	switch o {
+	case OutputJpeg:
+		return "JPEG"
+	case OutputAvif:
+		return "AVIF"
+	case OutputJxl:
+		return "JXL"
+	case OutputHeic:
+		return "HEIC"
+	}
+	return fmt.Sprintf("OutputFormat(%d)", int(o))
+}
+
+// Supported determines if the output format has an encoder in the current
+// build.
+// Returns true if supported; false otherwise.
+func (o OutputFormat) Supported() bool {
+	if o == OutputJpeg {
+		return true
+	}
+	_, ok := outputEncoders[o]
+	return ok
+}
+
+// suffix is the remainder of the extracted file name, including the file
+// extension, for the output format.
+func (o OutputFormat) suffix() string {
+	switch o {
+	case OutputAvif:
+		return "_extracted.avif"
+	case OutputJxl:
+		return "_extracted.jxl"
+	case OutputHeic:
+		return "_extracted.heic"
+	}
+	return "_extracted.jpg"
+}
+
+// encodeAndWrite decodes the embedded jpeg data and writes it, re-encoded
+// in the output format, to a new file.  The JpegOptions apply to JPEG.  A
+// preview in Adobe RGB, by its color space space, is converted to sRGB and
+// encoded by encodeJpeg; see isAdobeRGBPreview.  The time spent is added
+// to t, if not nil.
+// Returns nil on success or error.
+func encodeAndWrite(data []byte, format OutputFormat, quality int, opts JpegOptions, space ColorSpace, filename string, t *Timings) error {
+	if format == OutputJpeg && !isAdobeRGBPreview(data, space) {
+		if quality == QualityAuto {
+			start := time.Now()
+			img, err := decodeJpeg(data)
+			t.addDecode(start)
+			if err != nil {
+				return err
+			}
+			start = time.Now()
+			quality, err = autoQuality(img, len(data), jpegEncoder(opts))
+			t.addEncode(start)
+			if err != nil {
+				return err
+			}
+		}
+		defer t.addEncode(time.Now())
+		return decodeAndWriteJpeg(data, quality, opts, filename)
+	}
+
+	encode, ok := outputEncoders[format]
+	if format == OutputJpeg {
+		encode, ok = jpegEncoder(opts), true
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrOutputFormatUnsupported, format)
+	}
+
+	start := time.Now()
+	img, err := decodeJpegSRGB(data, space)
+	t.addDecode(start)
+	if err != nil {
+		return err
+	}
+	defer t.addEncode(time.Now())
+	if quality == QualityAuto {
+		if quality, err = autoQuality(img, len(data), encode); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		log.Printf("Error creating %s file: %v\n", format, err)
+		return err
+	}
+
+	err = encode(f, img, quality)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Printf("Error encoding embedded jpeg as %s: %v\n", format, err)
+		os.Remove(filename)
+	}
+	return err
+}
+
+// writeFileAtomic creates or replaces the file name by write, which writes
+// the file it is given, a temporary file in the directory of name.  The
+// temporary file is synced and renamed over name, so that an interrupted
+// write never leaves a truncated file at name.
+// Returns nil on success or error; the temporary file is removed on error.
+func writeFileAtomic(name string, write func(name string) error) error {
+	dir := filepath.Dir(name)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		log.Printf("Error creating temporary file: %v\n", err)
+		return err
+	}
+	tmpName := tmp.Name()
+	err = tmp.Chmod(0644)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = write(tmpName)
+	}
+	if err == nil {
+		err = syncFile(tmpName)
+	}
+	if err == nil {
+		err = os.Rename(tmpName, name)
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	// persist the rename; not supported on every platform
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// syncFile commits the contents of a file to stable storage.
+// Returns nil on success or error.
+func syncFile(name string) error {
+	f, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// encodeTo decodes the embedded jpeg data and writes it, re-encoded in the
+// output format, to w.  JPEG is encoded by encodeJpeg, regardless of the
+// JPEG backend of the build.  A preview in Adobe RGB, by its color space
+// space, is converted to sRGB; see isAdobeRGBPreview.  The time spent is
+// added to t, if not nil.
+// Returns nil on success or error.
+func encodeTo(w io.Writer, data []byte, format OutputFormat, quality int, opts JpegOptions, space ColorSpace, t *Timings) error {
+	encode, ok := outputEncoders[format]
+	if format == OutputJpeg {
+		encode, ok = jpegEncoder(opts), true
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrOutputFormatUnsupported, format)
+	}
+
+	start := time.Now()
+	img, err := decodeJpegSRGB(data, space)
+	t.addDecode(start)
+	if err != nil {
+		return err
+	}
+	defer t.addEncode(time.Now())
+	if quality == QualityAuto {
+		if quality, err = autoQuality(img, len(data), encode); err != nil {
+			return err
+		}
+	}
+	return encode(w, img, quality)
+}
+
+// encodeWithExif encodes the embedded jpeg data as by encodeTo, with the
+// EXIF data exif, if not nil.
+// Returns nil on success or error.
+func encodeWithExif(w io.Writer, data []byte, format OutputFormat, quality int, opts JpegOptions, space ColorSpace, exif []byte, t *Timings) error {
+	if exif == nil {
+		return encodeTo(w, data, format, quality, opts, space, t)
+	}
+
+	var buf bytes.Buffer
+	if err := encodeTo(&buf, data, format, quality, opts, space, t); err != nil {
+		return err
+	}
+	out, err := insertExif(buf.Bytes(), exif)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// autoQuality finds, by binary search, the highest quality, from 1 to 100,
+// at which encode encodes the image in no more than limit bytes.
+// Returns the quality, 1 if none fits, or error.
+func autoQuality(img image.Image, limit int, encode imageEncoder) (int, error) {
+	lo, hi := 1, 100
+	for lo < hi {
+		q := (lo + hi + 1) / 2
+		var n byteCounter
+		if err := encode(&n, img, q); err != nil {
+			return 0, err
+		}
+		if int(n) <= limit {
+			lo = q
+		} else {
+			hi = q - 1
+		}
+	}
+	return lo, nil
+}
+
+// byteCounter is an io.Writer counting the bytes written.
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+// rgbPixels converts an image to packed 8-bit RGB, the input format of the
+// native encoders.
+// Returns the pixels, row by row, without padding.
+func rgbPixels(img image.Image) []byte {
+	b := img.Bounds()
+	rgba, ok := img.(*image.RGBA)
+	if !ok || rgba.Rect.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	}
+
+	w, h := rgba.Rect.Dx(), rgba.Rect.Dy()
+	pix := make([]byte, 0, w*h*3)
+	for y := 0; y < h; y++ {
+		row := rgba.Pix[y*rgba.Stride : y*rgba.Stride+w*4]
+		for x := 0; x < len(row); x += 4 {
+			pix = append(pix, row[x], row[x+1], row[x+2])
+		}
+	}
+	return pix
+}
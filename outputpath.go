@@ -0,0 +1,222 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrOutputTemplate is returned when an output path template is invalid:
+// it contains an unknown placeholder or does not expand to a path within
+// the destination directory.
+var ErrOutputTemplate = errors.New("invalid output template")
+
+// outputClaims maps the output paths generated by a batch to the raw
+// files they were generated for, so that two raw files of the same name
+// (e.g., "DSC_0001.NEF" of two memory cards or cameras) do not overwrite
+// each other's preview.  The claims of a batch are dropped once it
+// completes; see BatchProcessor.Process.
+type outputClaims struct {
+	sync.Mutex
+	paths map[string]string
+}
+
+// newOutputClaims creates the outputClaims of a batch.
+// Returns the outputClaims.
+func newOutputClaims() *outputClaims {
+	return &outputClaims{paths: make(map[string]string)}
+}
+
+// NameResolution records how the path of an extracted preview was
+// disambiguated from the path of the preview of another raw file of the
+// same name, extracted earlier by the same batch.
+type NameResolution int
+
+const (
+	// NameUnique: the path was not taken by another raw file.
+	NameUnique NameResolution = iota
+
+	// NameCaptureTime: the CreateDate of the raw file was appended to the
+	// path, e.g., "DSC_0001.NEF_extracted_20240307-182810.jpg".
+	NameCaptureTime
+
+	// NameHash: a hash of the path of the raw file was appended to the
+	// path, e.g., "DSC_0001.NEF_extracted_1a2b3c4d.jpg", as the raw file
+	// has no CreateDate or the path with the CreateDate was taken too.
+	NameHash
+)
+
+// String returns the name of the NameResolution; empty for NameUnique.
+func (n NameResolution) String() string {
+	switch n {
+	case NameUnique:
+		return ""
+	case NameCaptureTime:
+		return "captureTime"
+	case NameHash:
+		return "hash"
+	}
+	return fmt.Sprintf("NameResolution(%d)", int(n))
+}
+
+// MarshalText encodes the NameResolution by name.
+func (n NameResolution) MarshalText() ([]byte, error) {
+	return []byte(n.String()), nil
+}
+
+// outputPath determines the path of the extracted preview of a parsed raw
+// file: by info.OutputTemplate, if set, relative to DestDir, creating its
+// directories unless info.DryRun is set; otherwise, named after the raw
+// file in DestDir.  The path is claimed for the raw file, if processed by
+// a batch; see outputClaims.claim.
+// Returns the path, how it was disambiguated, or error.
+func (r *RawFile) outputPath(f *rawSource, info *RawFileInfo) (string, NameResolution, error) {
+	if info.OutputTemplate == "" {
+		path, resolution := info.claims.claim(genExtractedJpegName(f, info.DestDir, info.OutputFormat.suffix()), r.FileName, r.CreateDate)
+		return path, resolution, nil
+	}
+
+	rel, err := expandOutputTemplate(info.OutputTemplate, r.FileName, r.CreateDate)
+	if err != nil {
+		return "", NameUnique, err
+	}
+	path, resolution := info.claims.claim(filepath.Join(info.DestDir, rel), r.FileName, r.CreateDate)
+	if info.DryRun {
+		return path, resolution, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", resolution, err
+	}
+	return path, resolution, nil
+}
+
+// expandOutputTemplate expands the placeholders of an output path template,
+// e.g., "{year}/{month}/{day}/{base}.jpg", for a raw file:
+//
+//	{year}, {month}, {day}     the date of the CreateDate, e.g., 2024, 03, 07
+//	{hour}, {minute}, {second} the time of the CreateDate, e.g., 18, 28, 10
+//	{name}                     the name of the raw file, e.g., DSC_0001.NEF
+//	{base}                     the name without extension, e.g., DSC_0001
+//	{ext}                      the extension without ".", e.g., NEF
+//
+// The date placeholders of a raw file without a CreateDate are zeros.
+// The expansion depends only on the raw file, so that repeated runs
+// produce the same paths.
+// Returns the expanded path, with the separators of the host, or error
+// wrapping ErrOutputTemplate.
+func expandOutputTemplate(tmpl, rawName string, date time.Time) (string, error) {
+	name := safeBaseName(rawName)
+	ext := filepath.Ext(name)
+
+	values := map[string]string{
+		"name": name,
+		"base": strings.TrimSuffix(name, ext),
+		"ext":  strings.TrimPrefix(ext, "."),
+	}
+	if date.IsZero() {
+		for _, k := range []string{"year", "month", "day", "hour", "minute", "second"} {
+			values[k] = "00"
+		}
+		values["year"] = "0000"
+	} else {
+		values["year"] = strconv.Itoa(date.Year())
+		values["month"] = fmt.Sprintf("%02d", int(date.Month()))
+		values["day"] = fmt.Sprintf("%02d", date.Day())
+		values["hour"] = fmt.Sprintf("%02d", date.Hour())
+		values["minute"] = fmt.Sprintf("%02d", date.Minute())
+		values["second"] = fmt.Sprintf("%02d", date.Second())
+	}
+
+	var b strings.Builder
+	for rest := tmpl; rest != ""; {
+		i := strings.IndexByte(rest, '{')
+		if i < 0 {
+			b.WriteString(rest)
+			break
+		}
+		b.WriteString(rest[:i])
+		j := strings.IndexByte(rest[i:], '}')
+		if j < 0 {
+			return "", fmt.Errorf("%w: unterminated placeholder in %q", ErrOutputTemplate, tmpl)
+		}
+		v, ok := values[rest[i+1:i+j]]
+		if !ok {
+			return "", fmt.Errorf("%w: unknown placeholder %s in %q", ErrOutputTemplate, rest[i:i+j+1], tmpl)
+		}
+		b.WriteString(v)
+		rest = rest[i+j+1:]
+	}
+
+	path := filepath.FromSlash(b.String())
+	if !filepath.IsLocal(path) || strings.HasSuffix(b.String(), "/") {
+		return "", fmt.Errorf("%w: %q expands to %q, not a file within the destination directory", ErrOutputTemplate, tmpl, path)
+	}
+	return path, nil
+}
+
+// claim claims an output path for a raw file.  If the path was claimed
+// for another raw file, the path with the capture date of the raw file
+// appended is claimed instead or, if the raw file has no capture date or
+// that path was claimed too, a path disambiguated by a hash of the name of
+// the raw file, e.g., "DSC_0001_1a2b3c4d.jpg".  A nil outputClaims, that
+// of a raw file not processed by a batch, claims every path as is.
+// Returns the path claimed and how it was disambiguated.
+func (c *outputClaims) claim(path, rawName string, date time.Time) (string, NameResolution) {
+	if c == nil {
+		return path, NameUnique
+	}
+	if abs, err := filepath.Abs(rawName); err == nil {
+		rawName = abs
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	ext := filepath.Ext(path)
+	candidate, resolution := path, NameUnique
+	for {
+		owner, ok := c.paths[candidate]
+		if !ok || owner == rawName {
+			c.paths[candidate] = rawName
+			return candidate, resolution
+		}
+
+		if resolution == NameUnique && !date.IsZero() {
+			candidate = fmt.Sprintf("%s_%s%s", strings.TrimSuffix(path, ext), date.Format("20060102-150405"), ext)
+			resolution = NameCaptureTime
+			continue
+		}
+		h := newXXH64()
+		h.Write([]byte(rawName + candidate))
+		candidate = fmt.Sprintf("%s_%08x%s", strings.TrimSuffix(path, ext), uint32(h.Sum64()), ext)
+		resolution = NameHash
+	}
+}
@@ -0,0 +1,196 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandOutputTemplate(t *testing.T) {
+	date := time.Date(2011, time.March, 4, 5, 6, 7, 0, time.UTC)
+
+	tests := []struct {
+		tmpl string
+		date time.Time
+		want string
+		err  bool
+	}{
+		{"{year}/{month}/{day}/{base}.jpg", date, "2011/03/04/DSC_0001.jpg", false},
+		{"{hour}{minute}{second}_{name}.jpg", date, "050607_DSC_0001.NEF.jpg", false},
+		{"{ext}/{base}", date, "NEF/DSC_0001", false},
+		{"{year}/{base}.jpg", time.Time{}, "0000/DSC_0001.jpg", false},
+		{"../{base}.jpg", date, "", true},
+		{"/{base}.jpg", date, "", true},
+		{"{year}/", date, "", true},
+		{"{camera}/{base}.jpg", date, "", true},
+		{"{base.jpg", date, "", true},
+	}
+
+	for _, test := range tests {
+		got, err := expandOutputTemplate(test.tmpl, "/photos/DSC_0001.NEF", test.date)
+		if test.err {
+			if !errors.Is(err, ErrOutputTemplate) {
+				t.Errorf("Expected ErrOutputTemplate for %q; got %q, %v\n", test.tmpl, got, err)
+			}
+			continue
+		}
+		if err != nil || got != filepath.FromSlash(test.want) {
+			t.Errorf("Unexpected expansion of %q: %q, %v\n", test.tmpl, got, err)
+		}
+	}
+}
+
+func TestOutputTemplate(t *testing.T) {
+	path, dir := writeTestFile(t, "test.NRW", buildTestNrw(t, false))
+	p, _ := NewNrwParser(isHostLittleEndian())
+
+	info := &RawFileInfo{File: path, DestDir: dir, Quality: 75, OutputTemplate: "{year}/{month}/{day}/{base}.jpg"}
+	nrw, err := p.ProcessFile(info)
+	if err != nil {
+		t.Fatalf("Unexpected error processing NRW: %v\n", err)
+	}
+
+	want := filepath.Join(dir, nrw.CreateDate.Format("2006/01/02"), "test.jpg")
+	if nrw.JpegPath != want {
+		t.Errorf("Unexpected JpegPath: %s; expected %s\n", nrw.JpegPath, want)
+	}
+	if _, err := os.Stat(want); err != nil {
+		t.Errorf("Preview not written: %v\n", err)
+	}
+
+	// Reprocessing the same raw file writes the same path.
+	if nrw, err = p.ProcessFile(info); err != nil || nrw.JpegPath != want {
+		t.Errorf("Unexpected reprocessing result: %v, %v\n", nrw, err)
+	}
+
+	info.OutputTemplate = "../{base}.jpg"
+	if _, err := p.ProcessFile(info); !errors.Is(err, ErrOutputTemplate) {
+		t.Errorf("Expected ErrOutputTemplate; got %v\n", err)
+	}
+}
+
+func TestOutputTemplateDryRun(t *testing.T) {
+	path, _ := writeTestFile(t, "test.NRW", buildTestNrw(t, false))
+	dir := t.TempDir()
+	p, _ := NewNrwParser(isHostLittleEndian())
+
+	nrw, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75, OutputTemplate: "{year}/{base}.jpg", DryRun: true})
+	if err != nil {
+		t.Fatalf("Unexpected error processing NRW: %v\n", err)
+	}
+	want := filepath.Join(dir, nrw.CreateDate.Format("2006"), "test.jpg")
+	if planned := nrw.Extraction.Planned; planned == nil || planned.Path != want || planned.Overwrite {
+		t.Errorf("Unexpected planned file: %+v\n", planned)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Unexpected directories created by dry run: %v\n", entries)
+	}
+}
+
+func TestOutputPathNameConflict(t *testing.T) {
+	dest := t.TempDir()
+
+	// raw files of the same name taken at the same time, e.g., of four
+	// memory cards
+	var files []string
+	for i := 0; i < 4; i++ {
+		path, _ := writeTestFile(t, "DSC_0001.NRW", buildTestNrw(t, false))
+		files = append(files, path)
+	}
+	other, _ := writeTestFile(t, "DSC_0002.NRW", buildTestNrw(t, false))
+	files = append(files, other)
+
+	var results []*RawFile
+	for _, res := range NewBatchProcessor(dest, 75).Process(files) {
+		if res.Err != nil {
+			t.Fatalf("Unexpected error: %v\n", res.Err)
+		}
+		results = append(results, res.RawFile)
+	}
+
+	// the first raw file of the batch keeps the name
+	want := filepath.Join(dest, "DSC_0001.NRW_extracted.jpg")
+	if results[0].JpegPath != want || results[0].Extraction.NameResolution != NameUnique {
+		t.Errorf("Unexpected first path: %s (%v)\n", results[0].JpegPath, results[0].Extraction.NameResolution)
+	}
+	byTime := filepath.Join(dest, "DSC_0001.NRW_extracted_"+results[1].CreateDate.Format("20060102-150405")+".jpg")
+	if results[1].JpegPath != byTime || results[1].Extraction.NameResolution != NameCaptureTime {
+		t.Errorf("Unexpected second path: %s (%v); expected %s\n", results[1].JpegPath, results[1].Extraction.NameResolution, byTime)
+	}
+	for _, r := range results[2:4] {
+		if r.Extraction.NameResolution != NameHash || filepath.Dir(r.JpegPath) != dest ||
+			r.JpegPath == want || r.JpegPath == byTime {
+			t.Errorf("Unexpected hashed path: %s (%v)\n", r.JpegPath, r.Extraction.NameResolution)
+		}
+	}
+	if results[2].JpegPath == results[3].JpegPath {
+		t.Errorf("Colliding hashed paths: %s\n", results[2].JpegPath)
+	}
+	if results[4].JpegPath != filepath.Join(dest, "DSC_0002.NRW_extracted.jpg") || results[4].Extraction.NameResolution != NameUnique {
+		t.Errorf("Unexpected path of another name: %s (%v)\n", results[4].JpegPath, results[4].Extraction.NameResolution)
+	}
+
+	// the paths do not depend on the scheduling of the workers
+	for i := 0; i < 5; i++ {
+		again := NewBatchProcessor(dest, 75, WithWorkers(4)).Process(files)
+		for j, res := range again {
+			if res.Err != nil || res.RawFile.JpegPath != results[j].JpegPath {
+				t.Fatalf("Unexpected path of run %d, file %d: %+v; expected %s\n", i, j, res, results[j].JpegPath)
+			}
+		}
+	}
+
+	// the claims of a batch are dropped once it completes
+	fresh := t.TempDir()
+	res := NewBatchProcessor(fresh, 75).Process(files[1:2])[0]
+	if res.Err != nil || res.RawFile.JpegPath != filepath.Join(fresh, "DSC_0001.NRW_extracted.jpg") ||
+		res.RawFile.Extraction.NameResolution != NameUnique {
+		t.Errorf("Unexpected result of a new batch: %+v\n", res)
+	}
+
+	// a raw file not processed by a batch claims no path
+	p, _ := NewNrwParser(isHostLittleEndian())
+	r, err := p.ProcessFile(&RawFileInfo{File: files[1], DestDir: dest, Quality: 75})
+	if err != nil || r.JpegPath != want || r.Extraction.NameResolution != NameUnique {
+		t.Errorf("Unexpected result without a batch: %v, %v\n", r, err)
+	}
+
+	// a raw file without a capture date
+	claims := newOutputClaims()
+	claims.claim(want, files[0], time.Time{})
+	noDate := filepath.Join(t.TempDir(), "DSC_0001.NRW")
+	if path, resolution := claims.claim(want, noDate, time.Time{}); resolution != NameHash || path == want || path == byTime {
+		t.Errorf("Unexpected path without a capture date: %s (%v)\n", path, resolution)
+	}
+
+	if data, _ := json.Marshal(results[1].Extraction); !strings.Contains(string(data), `"nameResolution":"captureTime"`) {
+		t.Errorf("Unexpected JSON: %s\n", data)
+	}
+}
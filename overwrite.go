@@ -0,0 +1,141 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutputExists is returned by the ErrorIfExists OverwritePolicy when a
+// file exists at the path of an extracted preview.
+var ErrOutputExists = errors.New("output file exists")
+
+// OverwritePolicy defines the handling of an existing file at the path of
+// an extracted preview, e.g., of a previous run of a batch.
+type OverwritePolicy int
+
+const (
+	// OverwriteExisting replaces the existing file.  This is the default.
+	OverwriteExisting OverwritePolicy = iota
+
+	// SkipExisting keeps the existing file, which is taken as the
+	// extracted preview; the preview is not encoded.
+	SkipExisting
+
+	// ErrorIfExists fails the extraction with ErrOutputExists.
+	ErrorIfExists
+
+	// RenameWithSuffix writes the preview next to the existing file, with
+	// the first free numeric suffix, e.g., "DSC_0001_1.jpg".
+	RenameWithSuffix
+)
+
+// String returns the name of the OverwritePolicy.
+func (p OverwritePolicy) String() string {
+	switch p {
+	case OverwriteExisting:
+		return "overwrite"
+	case SkipExisting:
+		return "skip"
+	case ErrorIfExists:
+		return "error"
+	case RenameWithSuffix:
+		return "rename"
+	}
+	return fmt.Sprintf("OverwritePolicy(%d)", int(p))
+}
+
+// OutputAction is the action taken for the path of an extracted preview by
+// the OverwritePolicy.
+type OutputAction int
+
+const (
+	// ActionNone: no preview was written, e.g., the extraction failed.
+	ActionNone OutputAction = iota
+
+	// ActionCreated: the preview was written to a new file.
+	ActionCreated
+
+	// ActionOverwritten: the preview replaced an existing file.
+	ActionOverwritten
+
+	// ActionSkipped: the existing file was kept.
+	ActionSkipped
+
+	// ActionRenamed: the preview was written to a new file with a numeric
+	// suffix, next to the existing file.
+	ActionRenamed
+)
+
+// String returns the name of the OutputAction; empty for ActionNone.
+func (a OutputAction) String() string {
+	switch a {
+	case ActionNone:
+		return ""
+	case ActionCreated:
+		return "created"
+	case ActionOverwritten:
+		return "overwritten"
+	case ActionSkipped:
+		return "skipped"
+	case ActionRenamed:
+		return "renamed"
+	}
+	return fmt.Sprintf("OutputAction(%d)", int(a))
+}
+
+// MarshalText encodes the OutputAction by name.
+func (a OutputAction) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// applyOverwritePolicy resolves the path of an extracted preview by the
+// OverwritePolicy if a file exists at path.
+// Returns the path to write, the action, or error wrapping ErrOutputExists.
+func applyOverwritePolicy(policy OverwritePolicy, path string) (string, OutputAction, error) {
+	if _, err := os.Lstat(path); err != nil {
+		return path, ActionCreated, nil
+	}
+
+	switch policy {
+	case SkipExisting:
+		return path, ActionSkipped, nil
+	case ErrorIfExists:
+		return path, ActionNone, fmt.Errorf("%w: %s", ErrOutputExists, path)
+	case RenameWithSuffix:
+		ext := filepath.Ext(path)
+		base := strings.TrimSuffix(path, ext)
+		for i := 1; ; i++ {
+			candidate := fmt.Sprintf("%s_%d%s", base, i, ext)
+			if _, err := os.Lstat(candidate); err != nil {
+				return candidate, ActionRenamed, nil
+			}
+		}
+	}
+	return path, ActionOverwritten, nil
+}
@@ -0,0 +1,95 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOverwritePolicy(t *testing.T) {
+	path, dir := writeTestFile(t, "a.NRW", buildTestPhoto(t, "id-a", "v1"))
+	existing := filepath.Join(dir, "a.NRW_extracted.jpg")
+	p, _ := NewNrwParser(isHostLittleEndian())
+
+	tests := []struct {
+		policy OverwritePolicy
+		action OutputAction
+		path   string
+		kept   bool
+	}{
+		{SkipExisting, ActionSkipped, existing, true},
+		{RenameWithSuffix, ActionRenamed, filepath.Join(dir, "a.NRW_extracted_1.jpg"), true},
+		{OverwriteExisting, ActionOverwritten, existing, false},
+	}
+	for _, test := range tests {
+		writeFile(t, existing, testJpeg(t, 32, 24))
+		r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75, Overwrite: test.policy})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v\n", test.policy, err)
+		}
+		if r.Extraction.Action != test.action || r.JpegPath != test.path {
+			t.Errorf("%s: unexpected result: %v %s\n", test.policy, r.Extraction.Action, r.JpegPath)
+		}
+		if r.PreviewWidth != 64 {
+			t.Errorf("%s: unexpected preview width: %d\n", test.policy, r.PreviewWidth)
+		}
+		if data, _ := os.ReadFile(existing); bytes.Equal(data, testJpeg(t, 32, 24)) != test.kept {
+			t.Errorf("%s: existing file kept: %v\n", test.policy, !test.kept)
+		}
+		os.Remove(filepath.Join(dir, "a.NRW_extracted_1.jpg"))
+	}
+
+	r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75, Overwrite: ErrorIfExists})
+	if !errors.Is(err, ErrOutputExists) || r.JpegPath != "" || r.Extraction.Action != ActionNone {
+		t.Errorf("Expected ErrOutputExists; got %v %+v\n", err, r.Extraction)
+	}
+
+	os.Remove(existing)
+	r, err = p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75, Overwrite: ErrorIfExists})
+	if err != nil || r.Extraction.Action != ActionCreated || r.JpegPath != existing {
+		t.Errorf("Unexpected result: %v %+v\n", err, r.Extraction)
+	}
+}
+
+func TestBatchOverwritePolicy(t *testing.T) {
+	a, dir := writeTestFile(t, "a.NRW", buildTestPhoto(t, "id-a", "v1"))
+	existing := filepath.Join(dir, "a.NRW_extracted.jpg")
+	writeFile(t, existing, []byte("existing"))
+
+	res := NewBatchProcessor(dir, 75, WithOverwritePolicy(RenameWithSuffix), WithDryRun()).Process([]string{a})[0]
+	if res.Err != nil || res.RawFile.Extraction.Action != ActionRenamed {
+		t.Fatalf("Unexpected result: %+v\n", res)
+	}
+	if planned := res.RawFile.Extraction.Planned; planned == nil || planned.Overwrite ||
+		planned.Path != filepath.Join(dir, "a.NRW_extracted_1.jpg") {
+		t.Errorf("Unexpected planned file: %+v\n", planned)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("Unexpected files created by dry run: %v\n", entries)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"fmt"
+
+	"github.com/jeremytorres/rawparser/tags"
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// ReadError is a warning reporting an IFD or a tag of a raw file that could
+// not be read, e.g., of a truncated file.  The RawFile is marked Partial;
+// see RawFileInfo.Lenient.
+type ReadError struct {
+	// IFD names the IFD, e.g., "IFD0" or "EXIF IFD".
+	IFD string
+
+	// Tag is the tag whose value could not be read; 0 if the IFD itself
+	// could not be read in full.
+	Tag uint16
+
+	Err error
+}
+
+// Error returns the IFD, the tag, if any, and the cause of the failure.
+func (e *ReadError) Error() string {
+	if e.Tag == 0 {
+		return fmt.Sprintf("reading %s: %v", e.IFD, e.Err)
+	}
+	name := tags.TagName(e.Tag)
+	if name == "" {
+		name = fmt.Sprintf("tag 0x%04x", e.Tag)
+	}
+	return fmt.Sprintf("reading %s of %s: %v", name, e.IFD, e.Err)
+}
+
+// Unwrap returns the cause of the failure.
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+// ifdName names an IFD in warnings, e.g., "IFD0", "SubIFD1", or "EXIF IFD".
+func ifdName(kind tiff.Kind, index int) string {
+	switch kind {
+	case tiff.KindMain, tiff.KindSub:
+		return fmt.Sprintf("%s%d", kind, index)
+	}
+	return kind.String() + " IFD"
+}
+
+// readFailed records an IFD or a tag that could not be read as a warning
+// and marks the metadata partial.
+func (m *rawMetadata) readFailed(ifd string, tag uint16, err error) {
+	m.partial = true
+	m.warn(&ReadError{IFD: ifd, Tag: tag, Err: err})
+}
+
+// readASCIIEntry reads an ASCII entry of an IFD.  A failure to read the
+// value is recorded; see readFailed.
+// Returns the value; empty if it could not be read.
+func (m *rawMetadata) readASCIIEntry(ifd string, entry *IfdEntry) string {
+	val, err := entry.ASCII()
+	if err != nil {
+		m.readFailed(ifd, entry.tag, err)
+		return ""
+	}
+	return val
+}
@@ -0,0 +1,89 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jeremytorres/rawparser/tags"
+)
+
+// buildTruncatedNef builds a NEF truncated within the last entry of IFD0,
+// after the entries locating the preview and the EXIF IFD.
+func buildTruncatedNef(t *testing.T) []byte {
+	tt := newTestTiff(true)
+	preview := testJpeg(t, 160, 120)
+	sub0 := tt.addIfd(0,
+		longEntry(tags.TagJPEGInterchangeFormat, tt.addBlob(preview)),
+		longEntry(tags.TagJPEGInterchangeFormatLength, uint32(len(preview))))
+	exif := tt.addIfd(0, asciiEntry(tags.TagDateTimeDigitized, "2019:10:11 12:13:14"))
+	data := tt.bytes(tt.addIfd(0,
+		asciiEntry(tags.TagMake, "NIKON CORPORATION"),
+		longEntry(tags.TagSubIFDs, sub0, sub0),
+		longEntry(tags.TagExifIFD, exif),
+		shortEntry(tags.TagOrientation, 6)))
+
+	// the IFD0 is last: drop the next IFD offset and half of the last entry
+	return data[:len(data)-4-6]
+}
+
+func TestProcessFilePartial(t *testing.T) {
+	p, _ := NewNefParser(isHostLittleEndian())
+	path, dir := writeTestFile(t, "truncated.NEF", buildTruncatedNef(t))
+
+	var readErr *ReadError
+	_, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir})
+	if !errors.As(err, &readErr) || readErr.IFD != "IFD0" || readErr.Tag != 0 {
+		t.Errorf("Expected a ReadError of IFD0; got %v\n", err)
+	}
+
+	r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Lenient: true})
+	if err != nil {
+		t.Fatalf("Unexpected error processing the truncated NEF leniently: %v\n", err)
+	}
+	if !r.Partial || len(r.Warnings) != 1 || !errors.As(r.Warnings[0], &readErr) {
+		t.Errorf("Expected a partial RawFile; got %v, %v\n", r.Partial, r.Warnings)
+	}
+	if r.CameraModel.Make != "NIKON CORPORATION" || r.CreateDate.IsZero() || r.JpegPath == "" {
+		t.Errorf("Expected the metadata and preview located before the failure; got %+v\n", r)
+	}
+}
+
+func TestReadError(t *testing.T) {
+	cause := errors.New("unexpected EOF")
+	tests := []struct {
+		err  *ReadError
+		want string
+	}{
+		{&ReadError{IFD: "EXIF IFD", Err: cause}, "reading EXIF IFD: unexpected EOF"},
+		{&ReadError{IFD: "IFD0", Tag: tags.TagMake, Err: cause}, "reading Make of IFD0: unexpected EOF"},
+		{&ReadError{IFD: "IFD0", Tag: 0xfffe, Err: cause}, "reading tag 0xfffe of IFD0: unexpected EOF"},
+	}
+	for _, test := range tests {
+		if got := test.err.Error(); got != test.want || !errors.Is(test.err, cause) {
+			t.Errorf("Expected %q wrapping the cause; got %q\n", test.want, got)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import "strings"
+
+// processPhotoIDEntry records the EXIF ImageUniqueID, ImageNumber, and
+// BodySerialNumber.  Errors are not fatal as the entries are optional.
+func processPhotoIDEntry(entry *IfdEntry, m *rawMetadata) {
+	if entry.tag == 0x9211 && entry.count == 1 { // ImageNumber
+		m.imageNumber, _ = entry.Uint32()
+		return
+	}
+	if entry.tag == 0xa431 { // BodySerialNumber
+		// preferred to the serial numbers of the DNG and maker notes
+		if serial, err := entry.ASCII(); err == nil && strings.TrimSpace(serial) != "" {
+			m.serialNumber = serial
+		}
+		return
+	}
+	if entry.tag != 0xa420 { // ImageUniqueID
+		return
+	}
+
+	id, err := entry.ASCII()
+	if err == nil && strings.Trim(id, "0") != "" {
+		m.imageUniqueID = id
+	}
+}
+
+// photoID identifies a photo independent of the file containing it: the
+// EXIF ImageUniqueID or, if not recorded, the camera model and the capture
+// time.  Without sub-second precision, the capture time does not
+// distinguish the frames of a burst; therefore, it is not used.
+// Returns the photo ID; empty if the photo cannot be identified.
+func (m *rawMetadata) photoID() string {
+	if m.imageUniqueID != "" {
+		return m.imageUniqueID
+	}
+
+	d := &m.dates
+	if m.model == "" || d.original == "" || d.subSecOriginal == "" {
+		return ""
+	}
+	return m.make + "/" + m.model + "/" + d.original + "." + d.subSecOriginal
+}
@@ -0,0 +1,554 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"log"
+	"math"
+	"os"
+)
+
+const (
+	// maxJpegDimension is the largest width or height a JPEG frame
+	// header (SOF) is able to express.
+	maxJpegDimension = 65535
+
+	// panoramaAspectRatio is the long edge to short edge ratio at, or
+	// beyond, which an embedded preview is considered a panorama.
+	panoramaAspectRatio = 2.5
+
+	// largePreviewPixels is the number of pixels beyond which an embedded
+	// preview is considered unusually large (e.g., in-camera stitching).
+	largePreviewPixels = 64 * 1000 * 1000
+)
+
+// maxGoDecodePixels is the largest embedded preview, in pixels, the pure GO
+// decoder will attempt.  The decoder allocates the full image in memory,
+// therefore, larger previews (e.g., stitched panoramas) are rejected.
+const maxGoDecodePixels = 1 << 28
+
+var (
+	// ErrPreviewTooLarge is returned when an embedded preview exceeds the
+	// dimensions the selected JPEG backend is able to decode.
+	ErrPreviewTooLarge = errors.New("embedded preview too large to decode")
+
+	// ErrPreviewDimensions is returned when an embedded preview declares
+	// dimensions that cannot be decoded (e.g., a zero height deferred to a
+	// DNL marker, as written by some panorama modes).
+	ErrPreviewDimensions = errors.New("embedded preview has undecodable dimensions")
+
+	// ErrInvalidPreview is returned when the bytes of an embedded preview
+	// do not begin with a JPEG start of image marker or end with an end of
+	// image marker (e.g., the offset or length recorded in the raw file is
+	// wrong), before they are decoded or written.
+	ErrInvalidPreview = errors.New("embedded preview is not a complete jpeg")
+)
+
+// previewTailSize is the number of bytes at the end of an embedded preview
+// read to find its end of image marker, which may be followed by zero
+// padding.
+const previewTailSize = 512
+
+// previewDimensions reads the width and height from the frame header of the
+// embedded JPEG without decoding the image data.
+// Returns the width and height or error.
+func previewDimensions(data []byte) (width, height int, err error) {
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if cfg.Width <= 0 || cfg.Height <= 0 ||
+		cfg.Width > maxJpegDimension || cfg.Height > maxJpegDimension {
+		return cfg.Width, cfg.Height, fmt.Errorf("%w: %dx%d",
+			ErrPreviewDimensions, cfg.Width, cfg.Height)
+	}
+
+	return cfg.Width, cfg.Height, nil
+}
+
+// isPanorama determines if an embedded preview is a panorama based on its
+// aspect ratio.
+// Returns true if the long edge is at least panoramaAspectRatio times the
+// short edge; false otherwise.
+func isPanorama(width, height int) bool {
+	if width <= 0 || height <= 0 {
+		return false
+	}
+
+	long, short := width, height
+	if short > long {
+		long, short = short, long
+	}
+
+	return float64(long)/float64(short) >= panoramaAspectRatio
+}
+
+// writePreview extracts the embedded jpeg bytes within a raw file,
+// verifies its dimensions, decodes the JPEG data, and then creates a new
+// file, jpegFileName, in the output format, with the EXIF data exif, if
+// not nil, converting a preview in Adobe RGB to sRGB; see encodeAndWrite.
+// The file is written atomically; see writeFileAtomic.  The jpegInfo is
+// updated with the preview dimensions, and t, if not nil, with the time
+// spent.
+// Returns nil on success or error.
+func writePreview(f *rawSource, j *jpegInfo, jpegFileName string, quality int, format OutputFormat, opts JpegOptions, space ColorSpace, exif []byte, t *Timings) error {
+	// extract jpeg to new file
+	log.Printf("Creating %s file: %s\n", format, jpegFileName)
+
+	data, err := readPreview(f, j)
+	if err != nil {
+		log.Printf("Error reading embedded jpeg file: %v\n", err)
+		return err
+	}
+
+	j.width, j.height, err = previewDimensions(data)
+	if err != nil {
+		log.Printf("Error reading embedded jpeg dimensions: %v\n", err)
+		return err
+	}
+
+	if j.width*j.height > largePreviewPixels {
+		log.Printf("Large embedded jpeg: %dx%d\n", j.width, j.height)
+	}
+
+	if err = checkOutputPath(jpegFileName); err != nil {
+		log.Printf("Error creating %s file: %v\n", format, err)
+		return err
+	}
+
+	return writeFileAtomic(jpegFileName, func(name string) error {
+		if err := encodeAndWrite(data, format, quality, opts, space, name, t); err != nil || exif == nil {
+			return err
+		}
+		if err := writeExif(name, exif); err != nil {
+			log.Printf("Error writing EXIF data: %v\n", err)
+			return err
+		}
+		return nil
+	})
+}
+
+// planPreview extracts the embedded jpeg bytes within a raw file, verifies
+// its dimensions, and encodes it as writePreview would, counting the bytes
+// encoded in memory rather than creating jpegFileName.  The size is that
+// of the pure-Go encoder, an estimate if writePreview would use a native
+// JPEG backend; see RawFileInfo.DryRun.  The jpegInfo is updated with the
+// preview dimensions, and t, if not nil, with the time spent.
+// Returns the file writePreview would create or error.
+func planPreview(f *rawSource, j *jpegInfo, jpegFileName string, quality int, format OutputFormat, opts JpegOptions, space ColorSpace, exif []byte, t *Timings) (*PlannedFile, error) {
+	log.Printf("Dry run: not creating %s file: %s\n", format, jpegFileName)
+
+	data, err := readPreview(f, j)
+	if err != nil {
+		log.Printf("Error reading embedded jpeg file: %v\n", err)
+		return nil, err
+	}
+
+	j.width, j.height, err = previewDimensions(data)
+	if err != nil {
+		log.Printf("Error reading embedded jpeg dimensions: %v\n", err)
+		return nil, err
+	}
+
+	if err = checkOutputPath(jpegFileName); err != nil {
+		log.Printf("Error planning %s file: %v\n", format, err)
+		return nil, err
+	}
+
+	var n byteCounter
+	if err = encodeWithExif(&n, data, format, quality, opts, space, exif, t); err != nil {
+		return nil, err
+	}
+
+	_, err = os.Lstat(jpegFileName)
+	return &PlannedFile{Path: jpegFileName, Size: int64(n), Overwrite: err == nil}, nil
+}
+
+// extractPreview writes the embedded jpeg to jpegPath, as resolved by
+// info.Overwrite, setting JpegPath and Action, or, if info.DryRun is set,
+// records the file it would write in Planned.  A preview skipped by
+// SkipExisting is not encoded; only its dimensions are read.  A JPEG
+// preview exceeding info.MaxPreviewMemory is copied as is, setting Copied;
+// otherwise, the preview is in color space space; see previewSpace.  The
+// time spent decoding and encoding is added to t.
+// Returns nil on success or error.
+func (ex *ExtractionResult) extractPreview(f *rawSource, j *jpegInfo, jpegPath string, info *RawFileInfo, space ColorSpace, exif []byte, t *Timings) error {
+	jpegPath, action, err := applyOverwritePolicy(info.Overwrite, jpegPath)
+	if err != nil {
+		log.Printf("Error creating %s file: %v\n", info.OutputFormat, err)
+		return err
+	}
+	ex.Action = action
+
+	if action != ActionSkipped {
+		err = checkPreviewMemory(f, j, info.MaxPreviewMemory)
+		if errors.Is(err, ErrPreviewTooLarge) && info.OutputFormat == OutputJpeg {
+			log.Printf("Copying the embedded jpeg as is: %v\n", err)
+			ex.Copied, err = true, nil
+		}
+	}
+
+	switch {
+	case err != nil:
+	case action == ActionSkipped:
+		log.Printf("Skipping existing %s file: %s\n", info.OutputFormat, jpegPath)
+		if j.width, j.height, err = previewConfig(f, j); err != nil {
+			return err
+		}
+		if !info.DryRun {
+			ex.JpegPath = jpegPath
+		}
+	case ex.Copied && info.DryRun:
+		ex.Planned, err = planCopiedPreview(f, j, jpegPath, exif)
+	case ex.Copied:
+		err = writeCopiedPreview(f, j, jpegPath, exif)
+		if err == nil {
+			ex.JpegPath = jpegPath
+		}
+	case info.DryRun:
+		ex.Planned, err = planPreview(f, j, jpegPath, info.Quality, info.OutputFormat, info.Jpeg, space, exif, t)
+	default:
+		err = writePreview(f, j, jpegPath, info.Quality, info.OutputFormat, info.Jpeg, space, exif, t)
+		if err == nil {
+			ex.JpegPath = jpegPath
+		}
+	}
+	if err != nil {
+		ex.Action, ex.Copied = ActionNone, false
+	}
+	return err
+}
+
+// Extract extracts the embedded jpeg of a parsed raw file again, e.g., at a
+// different quality or in a different output format, using the preview
+// location found by ProcessFile; the raw file is not re-parsed.  The
+// DestDir, OutputTemplate, Quality, OutputFormat, PreserveExif, Artist,
+// Copyright, ConvertToSRGB, and Handle of info are used; if neither
+// info.Reader, info.Handle, nor info.File is set, the raw file is opened by
+// FileName.
+// The JpegPath, Extraction, and preview dimensions of the RawFile are
+// updated with the outcome, as are its Checksums if info.Checksums is set.
+// Returns the outcome of the extraction and an error wrapping
+// ErrExtractionFailed if the extraction failed; nil otherwise.
+func (r *RawFile) Extract(info *RawFileInfo) (*ExtractionResult, error) {
+	info = info.withDefaultQuality()
+
+	ex := new(ExtractionResult)
+
+	if r.preview == nil {
+		ex.Err = ErrNoPreview
+		return ex, fmt.Errorf("%w: %w", ErrExtractionFailed, ex.Err)
+	}
+
+	f, err := r.openRawFile(info)
+	if err != nil {
+		ex.Err = err
+		return ex, fmt.Errorf("%w: %w", ErrExtractionFailed, ex.Err)
+	}
+	defer f.Close()
+
+	j := *r.preview
+	r.Timings.Decode, r.Timings.Encode = 0, 0
+	jpegPath, resolution, err := r.outputPath(f, info)
+	ex.NameResolution = resolution
+	if err == nil {
+		err = ex.extractPreview(f, &j, jpegPath, info, r.previewSpace(info), r.previewExif(f, info), &r.Timings)
+	}
+	ex.Err = err
+
+	r.JpegPath = ex.JpegPath
+	r.Extraction = ex
+	if j.width > 0 && j.height > 0 {
+		r.PreviewWidth, r.PreviewHeight = j.width, j.height
+		r.Panorama = isPanorama(j.width, j.height)
+		r.setImageDimensions(&j)
+	}
+	r.setJpegBytes()
+	fillChecksums(r, info, f)
+	fillHistogram(r, info, f)
+	r.ReadStats.add(f.stats())
+
+	if ex.Err != nil {
+		return ex, fmt.Errorf("%w: %w", ErrExtractionFailed, ex.Err)
+	}
+	return ex, nil
+}
+
+// ExtractJpegTo writes the embedded jpeg of a parsed raw file to w,
+// re-encoded in info.OutputFormat at info.Quality, without creating a file;
+// e.g., to serve the preview over HTTP.  The raw file is opened as by
+// Extract and is not re-parsed.  EXIF metadata is written as by
+// info.PreserveExif.  A JPEG preview exceeding info.MaxPreviewMemory is
+// copied as is.  The preview dimensions of the RawFile are updated.
+// Returns nil on success or an error wrapping ErrExtractionFailed.
+func (r *RawFile) ExtractJpegTo(w io.Writer, info *RawFileInfo) error {
+	info = info.withDefaultQuality()
+
+	if r.preview == nil {
+		return fmt.Errorf("%w: %w", ErrExtractionFailed, ErrNoPreview)
+	}
+
+	f, err := r.openRawFile(info)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrExtractionFailed, err)
+	}
+	defer f.Close()
+
+	j := *r.preview
+	err = checkPreviewMemory(f, &j, info.MaxPreviewMemory)
+	if errors.Is(err, ErrPreviewTooLarge) && info.OutputFormat == OutputJpeg {
+		log.Printf("Copying the embedded jpeg as is: %v\n", err)
+		r.PreviewWidth, r.PreviewHeight = j.width, j.height
+		r.Panorama = isPanorama(j.width, j.height)
+		r.setImageDimensions(&j)
+		_, err = copyPreview(w, f, &j, r.previewExif(f, info))
+	} else if err == nil {
+		var data []byte
+		data, err = readPreview(f, &j)
+		if err == nil {
+			j.width, j.height, err = previewDimensions(data)
+		}
+		if err == nil {
+			r.PreviewWidth, r.PreviewHeight = j.width, j.height
+			r.Panorama = isPanorama(j.width, j.height)
+			r.setImageDimensions(&j)
+			r.Timings.Decode, r.Timings.Encode = 0, 0
+			err = encodeWithExif(w, data, info.OutputFormat, info.Quality, info.Jpeg, r.previewSpace(info), r.previewExif(f, info), &r.Timings)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrExtractionFailed, err)
+	}
+	return nil
+}
+
+// openRawFile opens the raw file of a parsed RawFile, by info.Reader,
+// info.Handle, or info.File if set, or by FileName otherwise.
+// Returns the raw file, which must be closed, or error.
+func (r *RawFile) openRawFile(info *RawFileInfo) (*rawSource, error) {
+	src := &RawFileInfo{File: info.File, Handle: info.Handle, Reader: info.Reader, Size: info.Size}
+	if src.File == "" && src.Handle == nil && src.Reader == nil {
+		src.File = r.FileName
+	}
+	return openRawFile(src)
+}
+
+// checkOutputPath verifies that the path of an extracted preview is not a
+// symbolic link; the file is created or replaced by the encoders, which
+// would follow it.
+// Returns nil or an error wrapping ErrUnsafeOutputPath.
+func checkOutputPath(name string) error {
+	fi, err := os.Lstat(name)
+	if err != nil {
+		// the file is created
+		return nil
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%w: %s is a symbolic link", ErrUnsafeOutputPath, name)
+	}
+	return nil
+}
+
+// readPreview reads the embedded jpeg bytes, as readImageBytes, and
+// verifies its markers; see checkPreviewMarkers.
+// Returns the jpeg bytes or error.
+func readPreview(f io.ReaderAt, j *jpegInfo) ([]byte, error) {
+	data, err := readImageBytes(f, j)
+	if err != nil {
+		return nil, err
+	}
+	return data, checkPreviewMarkers(j, data, data)
+}
+
+// readImageBytes reads the bytes of an embedded image, concatenating the
+// strips of an image stored as multiple strips.  The bytes allocated are
+// limited to the size of the raw file, if known, whatever the length
+// recorded by the file.
+// Returns the bytes or error.
+func readImageBytes(f io.ReaderAt, j *jpegInfo) ([]byte, error) {
+	if _, err := addOffset(j.offset, j.length); err != nil || j.length > math.MaxInt {
+		return nil, fmt.Errorf("jpeg of %d bytes at offset %d: %w", j.length, j.offset, errOffsetOverflow)
+	}
+	length := j.length
+	if size, ok := sourceSize(f); ok && length > size {
+		length = size
+	}
+	data := make([]byte, length)
+
+	if len(j.strips) == 0 {
+		_, err := f.ReadAt(data, j.offset)
+		return data, err
+	}
+
+	pos := int64(0)
+	for _, s := range j.strips {
+		if pos+s.length > length {
+			return nil, fmt.Errorf("jpeg strips exceed jpeg length %d", length)
+		}
+		if _, err := f.ReadAt(data[pos:pos+s.length], s.offset); err != nil {
+			return nil, err
+		}
+		pos += s.length
+	}
+
+	return data[:pos], nil
+}
+
+// sourceSize returns the size of the raw file read by f, if known.
+func sourceSize(f io.ReaderAt) (int64, bool) {
+	switch r := f.(type) {
+	case *readCache:
+		return sourceSize(r.r)
+	case *rawSource:
+		size, err := r.Size()
+		return size, err == nil
+	case *os.File:
+		if fi, err := r.Stat(); err == nil && fi.Mode().IsRegular() {
+			return fi.Size(), true
+		}
+	}
+	return 0, false
+}
+
+// verifyPreview reads the first two bytes and the last previewTailSize
+// bytes, of the last strip, of the embedded jpeg and verifies its markers,
+// as checkPreviewMarkers, e.g., before decoding it from previewReader.
+// Returns nil or error.
+func verifyPreview(f io.ReaderAt, j *jpegInfo) error {
+	first, last := byteRange{j.offset, j.length}, byteRange{j.offset, j.length}
+	if len(j.strips) > 0 {
+		first, last = j.strips[0], j.strips[len(j.strips)-1]
+	}
+	if first.length < 2 || last.length < 2 {
+		return checkPreviewMarkers(j, nil, nil)
+	}
+
+	head := make([]byte, 2)
+	if _, err := f.ReadAt(head, first.offset); err != nil {
+		return err
+	}
+	tail := make([]byte, min(last.length, previewTailSize))
+	if _, err := f.ReadAt(tail, last.offset+last.length-int64(len(tail))); err != nil {
+		return err
+	}
+	return checkPreviewMarkers(j, head, tail)
+}
+
+// checkPreviewMarkers verifies that the bytes of the embedded jpeg begin,
+// as head, with the start of image marker and end, as tail, with the end of
+// image marker, followed by zero padding only.
+// Returns nil or error wrapping ErrInvalidPreview, with the offsets of the
+// jpeg.
+func checkPreviewMarkers(j *jpegInfo, head, tail []byte) error {
+	if len(head) < 2 || head[0] != 0xff || head[1] != 0xd8 {
+		return fmt.Errorf("%w: no start of image at offset %d", ErrInvalidPreview, j.offset)
+	}
+	if !bytes.HasSuffix(bytes.TrimRight(tail, "\x00"), []byte{0xff, 0xd9}) {
+		return fmt.Errorf("%w: no end of image in the %d bytes at offset %d", ErrInvalidPreview, j.length, j.offset)
+	}
+	return nil
+}
+
+// previewReader reads the embedded jpeg bytes in order, across the strips
+// of a jpeg stored as multiple strips, without reading them whole.
+// Returns the reader.
+func previewReader(f io.ReaderAt, j *jpegInfo) io.Reader {
+	if len(j.strips) == 0 {
+		return io.NewSectionReader(f, j.offset, j.length)
+	}
+
+	strips := make([]io.Reader, len(j.strips))
+	for i, s := range j.strips {
+		strips[i] = io.NewSectionReader(f, s.offset, s.length)
+	}
+	return io.MultiReader(strips...)
+}
+
+// newByteRanges pairs strip offsets with strip byte counts.
+// Returns the strips; nil if the counts differ, a strip is empty, or a
+// strip ends beyond the range of int64.
+func newByteRanges(offsets, lengths []uint64) []byteRange {
+	if len(offsets) == 0 || len(offsets) != len(lengths) {
+		return nil
+	}
+
+	ranges := make([]byteRange, len(offsets))
+	for i := range offsets {
+		if lengths[i] == 0 || offsets[i] > math.MaxInt64 || lengths[i] > math.MaxInt64 {
+			return nil
+		}
+		ranges[i] = byteRange{int64(offsets[i]), int64(lengths[i])}
+		if _, err := addOffset(ranges[i].offset, ranges[i].length); err != nil {
+			return nil
+		}
+	}
+	return ranges
+}
+
+// stripsExtent determines the start offset and total length of strips.
+// Returns the offset of the first strip and the sum of the strip lengths;
+// zero if the sum exceeds the range of int64.
+func stripsExtent(strips []byteRange) (offset, length int64) {
+	if len(strips) == 0 {
+		return 0, 0
+	}
+	for _, s := range strips {
+		var err error
+		if length, err = addOffset(length, s.length); err != nil {
+			return 0, 0
+		}
+	}
+	return strips[0].offset, length
+}
+
+// decodeJpeg decodes the embedded jpeg with the pure GO decoder.
+// Returns the decoded image or error.
+func decodeJpeg(data []byte) (img image.Image, e error) {
+	// Verify the dimensions are within the decoder's limits
+	cfg, e := jpeg.DecodeConfig(bytes.NewReader(data))
+	if e != nil {
+		log.Printf("Error decoding embedded jpeg config: %v\n", e)
+		return nil, e
+	}
+	if cfg.Width*cfg.Height > maxGoDecodePixels {
+		return nil, fmt.Errorf("%w: %dx%d exceeds %d pixels",
+			ErrPreviewTooLarge, cfg.Width, cfg.Height, maxGoDecodePixels)
+	}
+
+	// Decode JPEG
+	bReader := bytes.NewReader(data)
+	img, e = jpeg.Decode(bReader)
+	if e != nil {
+		log.Printf("Error decoding embedded jpeg: %v\n", e)
+		return nil, e
+	}
+	return img, e
+}
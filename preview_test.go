@@ -0,0 +1,340 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsPanorama(t *testing.T) {
+	if isPanorama(4288, 2844) {
+		t.Error("3:2 preview detected as panorama")
+	}
+
+	if !isPanorama(12000, 2000) || !isPanorama(2000, 12000) {
+		t.Error("6:1 preview not detected as panorama")
+	}
+
+	if isPanorama(0, 0) {
+		t.Error("zero dimensions detected as panorama")
+	}
+}
+
+func TestPreviewDimensions(t *testing.T) {
+	data, err := ioutil.ReadFile(TestJpegFile)
+	if err != nil {
+		t.Fatalf("Error reading file: %v\n", err)
+	}
+
+	w, h, err := previewDimensions(data)
+	if err != nil {
+		t.Fatalf("Unexpected error reading dimensions: %v\n", err)
+	}
+	if w <= 0 || h <= 0 {
+		t.Fatalf("Invalid dimensions: %dx%d\n", w, h)
+	}
+	t.Logf("Preview dimensions: %dx%d\n", w, h)
+}
+
+func TestPreviewMarkers(t *testing.T) {
+	// a jpeg at offset 2, zero padded, within other data
+	f := bytes.NewReader([]byte{1, 2, 0xff, 0xd8, 3, 4, 0xff, 0xd9, 0, 0, 5, 6})
+	tests := []struct {
+		name  string
+		j     jpegInfo
+		valid bool
+	}{
+		{"contiguous", jpegInfo{offset: 2, length: 6}, true},
+		{"padded", jpegInfo{offset: 2, length: 8}, true},
+		{"strips", jpegInfo{offset: 2, length: 6, strips: []byteRange{{2, 3}, {5, 3}}}, true},
+		{"wrong offset", jpegInfo{offset: 1, length: 7}, false},
+		{"truncated", jpegInfo{offset: 2, length: 5}, false},
+		{"trailing data", jpegInfo{offset: 2, length: 10}, false},
+		{"empty", jpegInfo{offset: 2, length: 0}, false},
+	}
+	for _, test := range tests {
+		_, err := readPreview(f, &test.j)
+		if err2 := verifyPreview(f, &test.j); test.valid && (err != nil || err2 != nil) {
+			t.Errorf("%s: unexpected errors: %v, %v\n", test.name, err, err2)
+		} else if !test.valid && (!errors.Is(err, ErrInvalidPreview) || !errors.Is(err2, ErrInvalidPreview)) {
+			t.Errorf("%s: expected ErrInvalidPreview; got %v, %v\n", test.name, err, err2)
+		}
+	}
+}
+
+func TestPreviewLengthBeyondFile(t *testing.T) {
+	// a length recorded by a hostile file is not allocated
+	data := []byte{1, 2, 0xff, 0xd8, 3, 4, 0xff, 0xd9, 0, 0, 5, 6}
+	f := &rawSource{r: bytes.NewReader(data), size: int64(len(data))}
+	for _, j := range []jpegInfo{
+		{offset: 2, length: 1 << 40},
+		{offset: 2, length: 1 << 40, strips: []byteRange{{2, 1 << 40}}},
+	} {
+		if data, err := readPreview(f, &j); err == nil || len(data) > 12 {
+			t.Errorf("Unexpected preview of %d bytes: %d bytes read, %v\n", j.length, len(data), err)
+		}
+	}
+}
+
+func TestPreviewDimensionsDNL(t *testing.T) {
+	data, err := ioutil.ReadFile(TestJpegFile)
+	if err != nil {
+		t.Fatalf("Error reading file: %v\n", err)
+	}
+
+	// zero the SOF height to mimic a height deferred to a DNL marker
+	patched := false
+	for i := 2; i+8 < len(data) && data[i] == 0xFF; {
+		if data[i+1] == 0xC0 || data[i+1] == 0xC2 {
+			data[i+5], data[i+6] = 0, 0
+			patched = true
+			break
+		}
+		i += 2 + (int(data[i+2])<<8 | int(data[i+3]))
+	}
+	if !patched {
+		t.Fatal("SOF marker not found in test jpeg")
+	}
+
+	_, _, err = previewDimensions(data)
+	if !errors.Is(err, ErrPreviewDimensions) {
+		t.Fatalf("Expected ErrPreviewDimensions; got: %v\n", err)
+	}
+}
+
+func TestOutputFormatUnsupported(t *testing.T) {
+	for _, format := range []OutputFormat{OutputAvif, OutputJxl, OutputHeic} {
+		if format.Supported() {
+			continue
+		}
+
+		path, dir := writeTestFile(t, "output.NRW", buildTestNrw(t, true))
+		p, _ := NewNrwParser(isHostLittleEndian())
+		r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir,
+			Quality: 75, OutputFormat: format})
+		if !errors.Is(err, ErrOutputFormatUnsupported) {
+			t.Errorf("%s: expected ErrOutputFormatUnsupported; got: %v\n", format, err)
+		}
+		if r == nil || r.Extraction.JpegPath != "" || r.PreviewWidth != 320 {
+			t.Errorf("%s: unexpected result: %+v\n", format, r)
+		}
+	}
+}
+
+func TestOutputFormatSuffix(t *testing.T) {
+	expected := map[OutputFormat]string{
+		OutputJpeg: "_extracted.jpg",
+		OutputAvif: "_extracted.avif",
+		OutputJxl:  "_extracted.jxl",
+		OutputHeic: "_extracted.heic",
+	}
+	for format, suffix := range expected {
+		if format.suffix() != suffix {
+			t.Errorf("%s: expected suffix %s; got %s\n", format, suffix, format.suffix())
+		}
+	}
+	if !OutputJpeg.Supported() {
+		t.Error("JPEG output not supported")
+	}
+}
+
+func TestRgbPixels(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(1, 1, color.RGBA{10, 20, 30, 255})
+	img.Set(2, 2, color.RGBA{40, 50, 60, 255})
+
+	// use a sub-image offset from the origin
+	pix := rgbPixels(img.SubImage(image.Rect(1, 1, 3, 3)))
+	expected := []byte{10, 20, 30, 0, 0, 0, 0, 0, 0, 40, 50, 60}
+	if !bytes.Equal(pix, expected) {
+		t.Errorf("Unexpected pixels: %v; expected %v\n", pix, expected)
+	}
+}
+
+func TestRawFileExtract(t *testing.T) {
+	path, dir := writeTestFile(t, "extract.NRW", buildTestNrw(t, true))
+	p, _ := NewNrwParser(isHostLittleEndian())
+
+	r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if r.JpegPath != "" || r.PreviewWidth != 0 {
+		t.Fatalf("Unexpected extraction: %+v\n", r)
+	}
+
+	sizes := make([]int64, 0, 2)
+	for _, quality := range []int{10, 95} {
+		ex, err := r.Extract(&RawFileInfo{DestDir: dir, Quality: quality})
+		if err != nil {
+			t.Fatalf("Unexpected error extracting at quality %d: %v\n", quality, err)
+		}
+		if ex.JpegPath == "" || r.JpegPath != ex.JpegPath || r.Extraction != ex {
+			t.Errorf("Unexpected extraction result: %+v\n", ex)
+		}
+		fi, err := os.Stat(ex.JpegPath)
+		if err != nil {
+			t.Fatalf("Extracted jpeg not found: %v\n", err)
+		}
+		sizes = append(sizes, fi.Size())
+	}
+
+	if r.PreviewWidth != 320 || r.PreviewHeight != 240 {
+		t.Errorf("Unexpected preview dimensions: %dx%d\n", r.PreviewWidth, r.PreviewHeight)
+	}
+	if sizes[0] >= sizes[1] {
+		t.Errorf("Expected a smaller jpeg at lower quality: %v\n", sizes)
+	}
+
+	if _, err := new(RawFile).Extract(&RawFileInfo{DestDir: dir}); !errors.Is(err, ErrNoPreview) {
+		t.Errorf("Expected ErrNoPreview; got %v\n", err)
+	}
+}
+
+func TestRawFileExtractJpegTo(t *testing.T) {
+	path, dir := writeTestFile(t, "extractto.NRW", buildTestNrw(t, true))
+	p, _ := NewNrwParser(isHostLittleEndian())
+
+	r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	var buf bytes.Buffer
+	if err := r.ExtractJpegTo(&buf, &RawFileInfo{Quality: 80}); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	img, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatalf("Error decoding preview: %v\n", err)
+	}
+	if b := img.Bounds(); b.Dx() != 320 || b.Dy() != 240 || r.PreviewWidth != 320 {
+		t.Errorf("Unexpected preview dimensions: %v\n", b)
+	}
+	if r.JpegPath != "" {
+		t.Errorf("Unexpected jpeg path: %s\n", r.JpegPath)
+	}
+
+	err = r.ExtractJpegTo(&buf, &RawFileInfo{OutputFormat: OutputFormat(99)})
+	if !errors.Is(err, ErrExtractionFailed) || !errors.Is(err, ErrOutputFormatUnsupported) {
+		t.Errorf("Expected ErrOutputFormatUnsupported; got %v\n", err)
+	}
+	if err := new(RawFile).ExtractJpegTo(&buf, &RawFileInfo{}); !errors.Is(err, ErrNoPreview) {
+		t.Errorf("Expected ErrNoPreview; got %v\n", err)
+	}
+}
+
+func TestWritePreviewSymlink(t *testing.T) {
+	path, dir := writeTestFile(t, "link.NRW", buildTestNrw(t, true))
+	target := filepath.Join(t.TempDir(), "target")
+	writeFile(t, target, []byte("not to be overwritten"))
+	if err := os.Symlink(target, filepath.Join(dir, "link.NRW_extracted.jpg")); err != nil {
+		t.Skipf("Symbolic links not supported: %v\n", err)
+	}
+	p, _ := NewNrwParser(isHostLittleEndian())
+
+	_, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir})
+	if !errors.Is(err, ErrUnsafeOutputPath) {
+		t.Errorf("Expected ErrUnsafeOutputPath; got %v\n", err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "not to be overwritten" {
+		t.Errorf("Symbolic link target overwritten: %q\n", data)
+	}
+}
+
+func TestRawFileJpegBytes(t *testing.T) {
+	data := buildTestNrw(t, true)
+	path, dir := writeTestFile(t, "bytes.NRW", data)
+	p, _ := NewNrwParser(isHostLittleEndian())
+
+	r, err := p.ProcessFile(&RawFileInfo{File: path, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if want := int64(len(testJpeg(t, 320, 240))); r.PreviewBytes != want {
+		t.Errorf("Unexpected preview bytes: %d; expected %d\n", r.PreviewBytes, want)
+	}
+	if r.JpegBytes != 0 || r.CompressionRatio != 0 {
+		t.Errorf("Unexpected sizes without extraction: %d %v\n", r.JpegBytes, r.CompressionRatio)
+	}
+
+	if _, err := r.Extract(&RawFileInfo{DestDir: dir, Quality: 90}); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	fi, err := os.Stat(r.JpegPath)
+	if err != nil {
+		t.Fatalf("Extracted jpeg not found: %v\n", err)
+	}
+	if r.JpegBytes != fi.Size() {
+		t.Errorf("Unexpected jpeg bytes: %d; expected %d\n", r.JpegBytes, fi.Size())
+	}
+	if want := float64(320*240*3) / float64(fi.Size()); r.CompressionRatio != want {
+		t.Errorf("Unexpected compression ratio: %v; expected %v\n", r.CompressionRatio, want)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "preview.jpg")
+	writeFile(t, name, []byte("previous"))
+
+	// an interrupted write leaves the previous file
+	err := writeFileAtomic(name, func(tmp string) error {
+		if err := os.WriteFile(tmp, []byte("trunc"), 0644); err != nil {
+			return err
+		}
+		return errors.New("interrupted")
+	})
+	if err == nil {
+		t.Error("Expected error")
+	}
+	if data, _ := os.ReadFile(name); string(data) != "previous" {
+		t.Errorf("Previous file modified: %q\n", data)
+	}
+
+	err = writeFileAtomic(name, func(tmp string) error {
+		if filepath.Dir(tmp) != dir || tmp == name {
+			t.Errorf("Unexpected temporary file: %s\n", tmp)
+		}
+		return os.WriteFile(tmp, []byte("replaced"), 0644)
+	})
+	if data, _ := os.ReadFile(name); err != nil || string(data) != "replaced" {
+		t.Errorf("Unexpected result: %q %v\n", data, err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Temporary files left: %v\n", entries)
+	}
+	if fi, err := os.Stat(name); err != nil || fi.Mode().Perm() != 0644 {
+		t.Errorf("Unexpected mode: %v %v\n", fi, err)
+	}
+}
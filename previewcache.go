@@ -0,0 +1,219 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PreviewCache is a directory-based cache of the results of ProcessFile
+// (see RawFileInfo.Cache), e.g., for a photo manager re-scanning a library:
+// the RawFile of a raw file processed with the same options is returned
+// without parsing the raw file again, as long as the raw file is unchanged
+// and the preview extracted, if any, exists.  A raw file is identified by
+// a hash of its path; it is unchanged if its size and modification time
+// are.  A PreviewCache may be shared by concurrent ProcessFile calls.
+type PreviewCache struct {
+	dir string
+}
+
+// cacheEntry is a struct representing the RawFile of a raw file recorded
+// by a PreviewCache, with the size and modification time of the raw file
+// when processed.
+type cacheEntry struct {
+	Size    int64
+	ModTime time.Time
+	RawFile RawFile
+
+	// Warnings are the messages of the Warnings of the RawFile, which are
+	// errors of types unknown to gob.
+	Warnings []string
+
+	// Preview is the location of the embedded jpeg; nil if none.  See
+	// RawFile.Extract.
+	Preview *cachedPreview
+}
+
+// cachedPreview is a struct representing a jpegInfo, encoded by gob.
+type cachedPreview struct {
+	Orientation          Orientation
+	Offset, Length       int64
+	XRes, YRes           uint32
+	XResFloat, YResFloat float64
+	Width, Height        int
+	Strips               [][2]int64
+}
+
+// NewPreviewCache creates a PreviewCache recording the RawFiles in dir,
+// which is created if it does not exist.
+// Returns the PreviewCache or error.
+func NewPreviewCache(dir string) (*PreviewCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &PreviewCache{dir: dir}, nil
+}
+
+// lookup finds the RawFile of a raw file processed with the options of
+// info.  Entries of a raw file that changed, or whose preview no longer
+// exists, are ignored.
+// Returns the RawFile or nil if not found.
+func (c *PreviewCache) lookup(f *rawSource, info *RawFileInfo) *RawFile {
+	name, fi := c.entryName(f, info)
+	if name == "" {
+		return nil
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil
+	}
+
+	var e cacheEntry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&e); err != nil {
+		log.Printf("Error reading preview cache entry %s: %v\n", name, err)
+		return nil
+	}
+	if e.Size != fi.Size() || !e.ModTime.Equal(fi.ModTime()) {
+		return nil
+	}
+	r := &e.RawFile
+	if r.JpegPath != "" {
+		if jpeg, err := os.Stat(r.JpegPath); err != nil || jpeg.Size() != r.JpegBytes {
+			return nil
+		}
+	}
+
+	for _, w := range e.Warnings {
+		r.Warnings = append(r.Warnings, errors.New(w))
+	}
+	if p := e.Preview; p != nil {
+		j := &jpegInfo{orientation: p.Orientation, offset: p.Offset, length: p.Length, xRes: p.XRes, yRes: p.YRes,
+			xResFloat: p.XResFloat, yResFloat: p.YResFloat, width: p.Width, height: p.Height}
+		for _, s := range p.Strips {
+			j.strips = append(j.strips, byteRange{s[0], s[1]})
+		}
+		r.preview = j
+	}
+	r.Cached = true
+	r.ReadStats, r.Timings = f.stats(), Timings{}
+	log.Printf("========= Cached file %s\n", info.File)
+	return r
+}
+
+// store records the RawFile of a raw file processed with the options of
+// info.  Errors are logged: the cache only saves work.
+func (c *PreviewCache) store(f *rawSource, info *RawFileInfo, r *RawFile) {
+	name, fi := c.entryName(f, info)
+	if name == "" {
+		return
+	}
+
+	e := cacheEntry{Size: fi.Size(), ModTime: fi.ModTime(), RawFile: *r}
+	e.RawFile.Warnings = nil
+	for _, w := range r.Warnings {
+		e.Warnings = append(e.Warnings, w.Error())
+	}
+	if j := r.preview; j != nil {
+		e.Preview = &cachedPreview{Orientation: j.orientation, Offset: j.offset, Length: j.length, XRes: j.xRes, YRes: j.yRes,
+			XResFloat: j.xResFloat, YResFloat: j.yResFloat, Width: j.width, Height: j.height}
+		for _, s := range j.strips {
+			e.Preview.Strips = append(e.Preview.Strips, [2]int64{s.offset, s.length})
+		}
+	}
+
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(&e)
+	if err == nil {
+		err = writeCacheEntry(name, b.Bytes())
+	}
+	if err != nil {
+		log.Printf("Error writing preview cache entry %s: %v\n", name, err)
+	}
+}
+
+// entryName determines the entry of a raw file processed with the options
+// of info: a hash of the absolute path of the raw file and of the options.
+// Raw files not read from a file, and those processed by a dry run or with
+// TagHooks, which must be called, are not cached.
+// Returns the path of the entry and the file information of the raw file;
+// an empty path if not cached.
+func (c *PreviewCache) entryName(f *rawSource, info *RawFileInfo) (string, os.FileInfo) {
+	if c == nil || info.DryRun || info.TagHooks != nil {
+		return "", nil
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return "", nil
+	}
+	path, err := filepath.Abs(f.Name())
+	if err != nil {
+		return "", nil
+	}
+
+	h := newXXH64()
+	fmt.Fprintf(h, "%s\x00%s", path, cacheOptions(info))
+	return filepath.Join(c.dir, hex.EncodeToString(h.Sum(nil))+".gob"), fi
+}
+
+// cacheOptions formats the options of a RawFileInfo determining the
+// RawFile and the preview extracted.
+func cacheOptions(info *RawFileInfo) string {
+	loc := ""
+	if info.DefaultLocation != nil {
+		loc = info.DefaultLocation.String()
+	}
+	return fmt.Sprintf("%s|%d|%t|%q|%q|%t|%s|%t|%d|%t|%s|%t|%d|%d|%+v|%d|%t|%d|%t|%+v",
+		info.DestDir, info.Quality, info.PreserveExif, info.Artist, info.Copyright, info.ConvertToSRGB, info.OutputTemplate, info.SkipExtraction,
+		info.Overwrite, info.Lenient, loc, info.CollectUnknownTags, info.DatePolicy, info.OutputFormat,
+		info.Jpeg, info.Checksums, info.Histogram, info.MaxPreviewMemory, info.FixBadPixels, info.Render)
+}
+
+// writeCacheEntry writes an entry to a temporary file renamed over the
+// entry, so that concurrent lookups do not read a partial entry.
+// Returns error.
+func writeCacheEntry(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPreviewCache(t *testing.T) {
+	raw := copyTestFile(t, TestNefFile)
+	cache, err := NewPreviewCache(filepath.Join(t.TempDir(), "cache"))
+	if err != nil {
+		t.Fatalf("Unexpected error creating cache: %v\n", err)
+	}
+	info := &RawFileInfo{File: raw, DestDir: t.TempDir(), Quality: 75, Cache: cache}
+	p := NewFormatParser(NefParserKey)
+
+	first, err := p.ProcessFile(info)
+	if err != nil {
+		t.Fatalf("Unexpected error processing NEF: %v\n", err)
+	}
+	if first.Cached {
+		t.Errorf("Unexpected cached RawFile of the first call\n")
+	}
+
+	cached, err := p.ProcessFile(info)
+	if err != nil {
+		t.Fatalf("Unexpected error processing cached NEF: %v\n", err)
+	}
+	if !cached.Cached || cached.ReadStats.ReadCalls != 0 {
+		t.Errorf("Expected a cached RawFile without reads; got %v %+v\n", cached.Cached, cached.ReadStats)
+	}
+	if cached.JpegPath != first.JpegPath || !cached.CreateDate.Equal(first.CreateDate) ||
+		cached.Orientation != first.Orientation || cached.CameraModel != first.CameraModel ||
+		cached.PreviewWidth != first.PreviewWidth || cached.Extraction.Action != first.Extraction.Action {
+		t.Errorf("Unexpected cached RawFile: %+v; expected %+v\n", cached, first)
+	}
+
+	// the preview of a cached RawFile may be extracted again
+	var b bytes.Buffer
+	if err := cached.ExtractJpegTo(&b, &RawFileInfo{File: raw, Quality: 75}); err != nil || b.Len() == 0 {
+		t.Errorf("Unexpected error extracting the cached preview: %v\n", err)
+	}
+
+	// other options are cached separately
+	other := *info
+	other.Quality = 50
+	if r, err := p.ProcessFile(&other); err != nil || r.Cached {
+		t.Errorf("Unexpected cached RawFile of other options: %v\n", err)
+	}
+
+	// a raw file that changed, or whose preview was removed, is parsed
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(raw, later, later); err != nil {
+		t.Fatalf("Unexpected error touching raw file: %v\n", err)
+	}
+	if r, err := p.ProcessFile(info); err != nil || r.Cached {
+		t.Errorf("Unexpected cached RawFile of a modified raw file: %v\n", err)
+	}
+	if r, err := p.ProcessFile(info); err != nil || !r.Cached {
+		t.Errorf("Expected the modified raw file cached again: %v\n", err)
+	}
+	if err := os.Remove(first.JpegPath); err != nil {
+		t.Fatalf("Unexpected error removing preview: %v\n", err)
+	}
+	if r, err := p.ProcessFile(info); err != nil || r.Cached {
+		t.Errorf("Unexpected cached RawFile of a removed preview: %v\n", err)
+	}
+}
+
+func TestPreviewCacheNotCached(t *testing.T) {
+	cache, err := NewPreviewCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error creating cache: %v\n", err)
+	}
+	data, err := os.ReadFile(TestCR2File)
+	if err != nil {
+		t.Fatalf("Unable to read test CR2 file: %v\n", err)
+	}
+	p := NewFormatParser(Cr2ParserKey)
+
+	// raw files read by Reader have no modification time
+	for i := 0; i < 2; i++ {
+		info := &RawFileInfo{File: "a.CR2", Reader: bytes.NewReader(data), Size: int64(len(data)), DestDir: t.TempDir(), Cache: cache}
+		if r, err := p.ProcessFile(info); err != nil || r.Cached {
+			t.Errorf("Unexpected cached RawFile read by Reader: %v\n", err)
+		}
+	}
+
+	// dry runs write nothing to the cache
+	info := &RawFileInfo{File: TestCR2File, DestDir: t.TempDir(), DryRun: true, Cache: cache}
+	for i := 0; i < 2; i++ {
+		if r, err := p.ProcessFile(info); err != nil || r.Cached {
+			t.Errorf("Unexpected cached RawFile of a dry run: %v\n", err)
+		}
+	}
+	if entries, _ := os.ReadDir(cache.dir); len(entries) != 0 {
+		t.Errorf("Unexpected cache entries: %d\n", len(entries))
+	}
+}
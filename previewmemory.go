@@ -0,0 +1,155 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// decodedBytesPerPixel is the memory, in bytes, of a pixel of a decoded
+// preview, as estimated against RawFileInfo.MaxPreviewMemory.
+const decodedBytesPerPixel = 3
+
+// previewMemory estimates the memory, in bytes, needed to re-encode the
+// embedded jpeg: the larger of its length, as it is read whole, and its
+// decoded size.
+func previewMemory(j *jpegInfo) int64 {
+	return max(j.length, decodedBytesPerPixel*int64(j.width)*int64(j.height))
+}
+
+// checkPreviewMemory verifies that re-encoding the embedded jpeg fits a
+// memory budget, in bytes; 0 for no limit.  The dimensions of the jpeg, if
+// not known, are read from its frame header and recorded in j.
+// Returns nil or error; ErrPreviewTooLarge if the budget is exceeded.
+func checkPreviewMemory(f io.ReaderAt, j *jpegInfo, budget int64) error {
+	if budget <= 0 {
+		return nil
+	}
+	if j.width <= 0 || j.height <= 0 {
+		width, height, err := previewConfig(f, j)
+		if err != nil {
+			return err
+		}
+		j.width, j.height = width, height
+	}
+
+	if n := previewMemory(j); n > budget {
+		return fmt.Errorf("%w: %dx%d preview of %d bytes needs %d bytes, exceeding the memory budget of %d bytes",
+			ErrPreviewTooLarge, j.width, j.height, j.length, n, budget)
+	}
+	return nil
+}
+
+// copyPreview writes the embedded jpeg to w as is, streamed from the raw
+// file, with the EXIF data exif, if not nil, inserted as by insertExif:
+// only the application segments following its start of image are read
+// into memory.  Its markers are verified first; see verifyPreview.
+// Returns the number of bytes written or error.
+func copyPreview(w io.Writer, f io.ReaderAt, j *jpegInfo, exif []byte) (int64, error) {
+	if err := verifyPreview(f, j); err != nil {
+		return 0, err
+	}
+
+	r := bufio.NewReader(previewReader(f, j))
+	if exif == nil {
+		return io.Copy(w, r)
+	}
+
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return 0, err
+	}
+	for {
+		b, err := r.Peek(4)
+		if err != nil || b[0] != 0xff || b[1]&0xf0 != 0xe0 {
+			break
+		}
+		seg := make([]byte, 2+int(binary.BigEndian.Uint16(b[2:])))
+		if _, err := io.ReadFull(r, seg); err != nil {
+			return 0, err
+		}
+		head = append(head, seg...)
+	}
+	head, err := insertExif(head, exif)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(head)
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := io.Copy(w, r)
+	return int64(n) + m, err
+}
+
+// writeCopiedPreview creates the file jpegFileName with the embedded jpeg
+// copied as is, as by copyPreview, e.g., a preview exceeding the memory
+// budget.  The file is written atomically; see writeFileAtomic.
+// Returns nil on success or error.
+func writeCopiedPreview(f io.ReaderAt, j *jpegInfo, jpegFileName string, exif []byte) error {
+	log.Printf("Copying %s file: %s\n", OutputJpeg, jpegFileName)
+
+	if err := checkOutputPath(jpegFileName); err != nil {
+		log.Printf("Error creating %s file: %v\n", OutputJpeg, err)
+		return err
+	}
+
+	return writeFileAtomic(jpegFileName, func(name string) error {
+		out, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = copyPreview(out, f, j, exif)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	})
+}
+
+// planCopiedPreview determines the file writeCopiedPreview would create,
+// without creating jpegFileName.
+// Returns the file or error.
+func planCopiedPreview(f io.ReaderAt, j *jpegInfo, jpegFileName string, exif []byte) (*PlannedFile, error) {
+	log.Printf("Dry run: not copying %s file: %s\n", OutputJpeg, jpegFileName)
+
+	if err := checkOutputPath(jpegFileName); err != nil {
+		log.Printf("Error planning %s file: %v\n", OutputJpeg, err)
+		return nil, err
+	}
+
+	var n byteCounter
+	if _, err := copyPreview(&n, f, j, exif); err != nil {
+		return nil, err
+	}
+
+	_, err := os.Lstat(jpegFileName)
+	return &PlannedFile{Path: jpegFileName, Size: int64(n), Overwrite: err == nil}, nil
+}
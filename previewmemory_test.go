@@ -0,0 +1,131 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"errors"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testPreviewBudget is a memory budget exceeded by the 4256x2832 preview of
+// TestNefFile, but not by its length.
+const testPreviewBudget = 1 << 20
+
+func TestMaxPreviewMemory(t *testing.T) {
+	p := NewFormatParser(NefParserKey)
+	dir := t.TempDir()
+
+	r, err := p.ProcessFile(&RawFileInfo{File: TestNefFile, DestDir: dir, Quality: 75, MaxPreviewMemory: testPreviewBudget})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if !r.Extraction.Copied {
+		t.Errorf("Expected the preview to be copied\n")
+	}
+	if r.PreviewWidth != 4256 || r.PreviewHeight != 2832 {
+		t.Errorf("Unexpected preview dimensions: %dx%d\n", r.PreviewWidth, r.PreviewHeight)
+	}
+
+	// copied as is
+	f, err := os.Open(TestNefFile)
+	if err != nil {
+		t.Fatalf("Error opening test file: %v\n", err)
+	}
+	defer f.Close()
+	want, err := readPreview(f, r.preview)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if got, _ := os.ReadFile(r.JpegPath); !bytes.Equal(got, want) {
+		t.Errorf("Expected the %d bytes of the preview; got %d bytes\n", len(want), len(got))
+	}
+
+	var b bytes.Buffer
+	if err := r.ExtractJpegTo(&b, &RawFileInfo{File: TestNefFile, MaxPreviewMemory: testPreviewBudget}); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("Expected the %d bytes of the preview; got %d bytes\n", len(want), b.Len())
+	}
+
+	// with EXIF metadata
+	b.Reset()
+	if err := r.ExtractJpegTo(&b, &RawFileInfo{File: TestNefFile, MaxPreviewMemory: testPreviewBudget, PreserveExif: true}); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if !bytes.Contains(b.Bytes()[:64], exifHeader) || !bytes.HasSuffix(b.Bytes(), want[len(want)-1024:]) {
+		t.Errorf("Expected the preview with EXIF metadata\n")
+	}
+	if _, err := jpeg.DecodeConfig(bytes.NewReader(b.Bytes())); err != nil {
+		t.Errorf("Unexpected error: %v\n", err)
+	}
+
+	// a dry run plans the copy
+	dry, err := p.ProcessFile(&RawFileInfo{File: TestNefFile, DestDir: t.TempDir(), Quality: 75, DryRun: true, MaxPreviewMemory: testPreviewBudget})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if !dry.Extraction.Copied || dry.Extraction.Planned == nil || dry.Extraction.Planned.Size != int64(len(want)) {
+		t.Errorf("Unexpected dry run: %+v\n", dry.Extraction)
+	}
+
+	// within the budget, the preview is re-encoded
+	r, err = p.ProcessFile(&RawFileInfo{File: TestNefFile, DestDir: t.TempDir(), Quality: 75, MaxPreviewMemory: 64 << 20})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if r.Extraction.Copied {
+		t.Errorf("Unexpected copy of the preview within the budget\n")
+	}
+}
+
+func TestMaxPreviewMemoryDecode(t *testing.T) {
+	info := &RawFileInfo{File: TestNefFile, MaxPreviewMemory: testPreviewBudget}
+	if _, err := DecodePreview(info); !errors.Is(err, ErrPreviewTooLarge) {
+		t.Errorf("DecodePreview: expected ErrPreviewTooLarge; got %v\n", err)
+	}
+
+	r, err := NewFormatParser(NefParserKey).ProcessFile(&RawFileInfo{File: TestNefFile, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if _, err := r.Renditions(info, 256); !errors.Is(err, ErrPreviewTooLarge) {
+		t.Errorf("Renditions: expected ErrPreviewTooLarge; got %v\n", err)
+	}
+
+	// other output formats are re-encoded only
+	dir := t.TempDir()
+	_, err = NewFormatParser(NefParserKey).ProcessFile(&RawFileInfo{File: TestNefFile, DestDir: dir, Quality: 75,
+		OutputFormat: OutputAvif, MaxPreviewMemory: testPreviewBudget})
+	if !errors.Is(err, ErrPreviewTooLarge) {
+		t.Errorf("AVIF: expected ErrPreviewTooLarge; got %v\n", err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*")); len(matches) > 0 {
+		t.Errorf("Unexpected files: %v\n", matches)
+	}
+}
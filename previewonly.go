@@ -0,0 +1,145 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"path/filepath"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// PreviewOnly is a fast path for thumbnailing.  The raw file is processed
+// for its embedded preview only: the IFD walk stops as soon as a preview
+// whose long edge is at least minSize pixels is found (any preview if
+// minSize is 0), and the EXIF, GPS, and maker note IFDs are not parsed.
+// Therefore, the CreateDate of the RawFile is not populated.  The largest
+// preview found is used if none is large enough.  Files that are not
+// TIFF-based (e.g., CRW) or whose preview is not referenced by the IFDs are
+// processed in full by the parser registered for their file extension.
+// Returns a pointer the RawFile data structure or error.
+func PreviewOnly(info *RawFileInfo, minSize int) (*RawFile, error) {
+	r := new(RawFile)
+
+	info, err := info.withDefaults()
+	if err != nil {
+		return r, err
+	}
+	info.Cache = nil // the RawFile is not that of ProcessFile
+
+	f, err := openRawFile(info)
+	if err != nil {
+		return r, err
+	}
+	defer f.Close()
+
+	t := tiffParser{rawParser: &rawParser{}}
+	cache := newReadCache(f)
+	h, err := tiff.ReadHeader(cache)
+	if err != nil {
+		if errors.Is(err, tiff.ErrInvalidHeader) {
+			return processFileFallback(info, err)
+		}
+		return r, err
+	}
+	if err := checkTiffMagic(h, tiffMagic); err != nil {
+		// e.g., CRW shares the byte order mark of TIFF
+		return processFileFallback(info, err)
+	}
+
+	j, m, err := t.processPreviewIfds(cache, h, minSize)
+	if err != nil {
+		return r, err
+	}
+	if j.length <= 0 {
+		return processFileFallback(info, ErrNoPreview)
+	}
+
+	return r, completeRawFile(r, info, f, j, m)
+}
+
+// processFileFallback processes a raw file in full with the parser
+// registered for its file extension.
+// Returns a pointer the RawFile data structure or error wrapping cause if
+// no parser is registered.
+func processFileFallback(info *RawFileInfo, cause error) (*RawFile, error) {
+	name := info.File
+	if name == "" && info.Reader == nil && info.Handle != nil {
+		name = info.Handle.Name()
+	}
+
+	p := NewFormatParser(filepath.Ext(name))
+	if p == nil {
+		return new(RawFile), fmt.Errorf("no parser for %s: %w", name, cause)
+	}
+	return p.ProcessFile(info)
+}
+
+// processPreviewIfds walks the IFD0 chain and the SubIFDs of a TIFF-based
+// raw file until a preview whose long edge is at least minSize pixels is
+// found.
+// Return jpegInfo, metadata or an error.
+func (t tiffParser) processPreviewIfds(f io.ReaderAt, h *tiff.Header, minSize int) (*jpegInfo, *rawMetadata, error) {
+	var j jpegInfo
+	m := rawMetadata{datesSkipped: true}
+	isBigEndian := h.IsBigEndian()
+
+	err := tiff.WalkIFDs(f, h, func(ifd *tiff.IFD) error {
+		if ifd.Kind != tiff.KindMain && ifd.Kind != tiff.KindSub {
+			return tiff.SkipChildren
+		}
+
+		offset := j.offset
+		t.processImageIfd(f, isBigEndian, ifd, &j, &m)
+		if j.length <= 0 || j.offset == offset {
+			return nil
+		}
+
+		width, height, err := previewConfig(f, &j)
+		if err != nil {
+			return nil
+		}
+		j.width, j.height = width, height
+		if width >= minSize || height >= minSize {
+			return tiff.SkipAll
+		}
+		return nil
+	})
+
+	return &j, &m, err
+}
+
+// previewConfig reads the width and height from the frame header of the
+// embedded JPEG; only the bytes preceding the frame header are read.
+// Returns the width and height or error.
+func previewConfig(f io.ReaderAt, j *jpegInfo) (width, height int, err error) {
+	cfg, err := jpeg.DecodeConfig(previewReader(f, j))
+	if err != nil {
+		return 0, 0, err
+	}
+	return cfg.Width, cfg.Height, nil
+}
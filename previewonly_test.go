@@ -0,0 +1,130 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"testing"
+)
+
+func TestPreviewOnlyNef(t *testing.T) {
+	r, err := PreviewOnly(&RawFileInfo{File: TestNefFile, SkipExtraction: true}, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	t.Logf("Preview only NEF: %+v\n", r)
+
+	if r.PreviewWidth != 4256 || r.PreviewHeight != 2832 {
+		t.Errorf("Unexpected preview dimensions: %dx%d\n", r.PreviewWidth, r.PreviewHeight)
+	}
+	if r.JpegOrientation == 0 {
+		t.Error("Orientation not parsed")
+	}
+	if !r.CreateDate.IsZero() || r.DateSuspect {
+		t.Errorf("Unexpected create date: %v\n", r.CreateDate)
+	}
+}
+
+func TestPreviewOnlyMinSize(t *testing.T) {
+	tt := newTestTiff(false)
+	thumb := testJpeg(t, 160, 120)
+	preview := testJpeg(t, 640, 480)
+	sub := tt.addIfd(0,
+		longEntry(0x0201, tt.addBlob(preview)),
+		longEntry(0x0202, uint32(len(preview))))
+	ifd0 := tt.addIfd(0,
+		longEntry(0x0201, tt.addBlob(thumb)),
+		longEntry(0x0202, uint32(len(thumb))),
+		longEntry(0x014a, sub))
+	path, dir := writeTestFile(t, "min.NRW", tt.bytes(ifd0))
+
+	for _, tc := range []struct{ minSize, width int }{{0, 160}, {160, 160}, {161, 640}, {10000, 640}} {
+		r, err := PreviewOnly(&RawFileInfo{File: path, DestDir: dir, Quality: 75}, tc.minSize)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		if r.PreviewWidth != tc.width || r.JpegPath == "" {
+			t.Errorf("min size %d: unexpected preview: %dx%d %q\n",
+				tc.minSize, r.PreviewWidth, r.PreviewHeight, r.JpegPath)
+		}
+	}
+}
+
+func TestPreviewOnlyFallback(t *testing.T) {
+	// CRW is not TIFF-based
+	path, dir := writeTestFile(t, "test.CRW", buildTestCrw(t))
+	r, err := PreviewOnly(&RawFileInfo{File: path, DestDir: dir, Quality: 75}, 0)
+	if err != nil || r.PreviewWidth != 160 || r.CreateDate.IsZero() {
+		t.Errorf("Unexpected CRW result: %+v %v\n", r, err)
+	}
+
+	// the preview of early NEFs is referenced by the maker note
+	path, dir = writeTestFile(t, "early.NEF", buildEarlyNef(t, "v2", true, true))
+	r, err = PreviewOnly(&RawFileInfo{File: path, DestDir: dir, Quality: 75}, 0)
+	if err != nil || r.PreviewWidth != 160 {
+		t.Errorf("Unexpected early NEF result: %+v %v\n", r, err)
+	}
+
+	path, dir = writeTestFile(t, "test.XXX", buildTestCrw(t))
+	if _, err = PreviewOnly(&RawFileInfo{File: path, DestDir: dir}, 0); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
+
+func BenchmarkNefProcessFile(b *testing.B) {
+	p, _ := NewNefParser(isHostLittleEndian())
+	info := &RawFileInfo{File: TestNefFile, SkipExtraction: true}
+	for i := 0; i < b.N; i++ {
+		if _, err := p.ProcessFile(info); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNefPreviewOnly(b *testing.B) {
+	info := &RawFileInfo{File: TestNefFile, SkipExtraction: true}
+	for i := 0; i < b.N; i++ {
+		if _, err := PreviewOnly(info, 1024); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCr2ProcessFile(b *testing.B) {
+	p, _ := NewCr2Parser(isHostLittleEndian())
+	info := &RawFileInfo{File: TestCR2File, SkipExtraction: true}
+	for i := 0; i < b.N; i++ {
+		if _, err := p.ProcessFile(info); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCr2PreviewOnly(b *testing.B) {
+	info := &RawFileInfo{File: TestCR2File, SkipExtraction: true}
+	for i := 0; i < b.N; i++ {
+		if _, err := PreviewOnly(info, 1024); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"strings"
+)
+
+// CameraModel is a struct identifying the camera that wrote a raw file.
+type CameraModel struct {
+	// Make and Model are as recorded in IFD0, e.g., "NIKON CORPORATION"
+	// and "NIKON D1X"; empty if not recorded.
+	Make  string `json:"make,omitempty"`
+	Model string `json:"model,omitempty"`
+}
+
+// String returns the name of the camera: the model, prefixed with the make
+// unless the model names it, e.g., "NIKON D1X" or "DJI FC6310".
+func (c CameraModel) String() string {
+	brand, _, _ := strings.Cut(c.Make, " ")
+	switch {
+	case c.Model == "":
+		return c.Make
+	case brand == "" || strings.HasPrefix(strings.ToUpper(c.Model), strings.ToUpper(brand)):
+		return c.Model
+	}
+	return c.Make + " " + c.Model
+}
+
+// quirk is a deviation of a camera model from the layout usual for its raw
+// format, handled by the parsers.
+type quirk uint32
+
+const (
+	// quirkEarlyNefPreview: the preview is stored in IFD0 or in the
+	// PreviewIFD of the maker note, not in SubIFD0, whatever the layout
+	// of the SubIFDs (e.g., the NEFs of the D1 series and the D100, also
+	// as rewritten by Nikon Capture).
+	quirkEarlyNefPreview quirk = 1 << iota
+
+	// quirkTifContainer: the raw file is a TIF container without the CR2
+	// header, whose IFD0 immediately follows the TIFF header, and is
+	// parsed as a generic TIFF-based raw file (e.g., the EOS-1D and
+	// EOS-1Ds).
+	quirkTifContainer
+)
+
+// cameraQuirks are the quirks of camera models, by the first word of the
+// make, and the model; an empty model matches every model of the make.
+// Makes and models are matched regardless of case.
+var cameraQuirks = []struct {
+	brand, model string
+	quirks       quirk
+}{
+	{"NIKON", "NIKON D1", quirkEarlyNefPreview},
+	{"NIKON", "NIKON D1H", quirkEarlyNefPreview},
+	{"NIKON", "NIKON D1X", quirkEarlyNefPreview},
+	{"NIKON", "NIKON D100", quirkEarlyNefPreview},
+	{"Canon", "Canon EOS-1D", quirkTifContainer},
+	{"Canon", "Canon EOS-1DS", quirkTifContainer},
+}
+
+// quirks looks up the quirks of the camera model.
+// Returns the quirks; 0 if none are known.
+func (c CameraModel) quirks() quirk {
+	brand, _, _ := strings.Cut(strings.TrimSpace(c.Make), " ")
+	model := strings.TrimSpace(c.Model)
+
+	var q quirk
+	for _, known := range cameraQuirks {
+		if strings.EqualFold(known.brand, brand) && (known.model == "" || strings.EqualFold(known.model, model)) {
+			q |= known.quirks
+		}
+	}
+	return q
+}
@@ -0,0 +1,112 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCameraModelString(t *testing.T) {
+	tests := []struct {
+		camera CameraModel
+		want   string
+	}{
+		{CameraModel{"NIKON CORPORATION", "NIKON D1X"}, "NIKON D1X"},
+		{CameraModel{"Canon", "Canon EOS 5D Mark II"}, "Canon EOS 5D Mark II"},
+		{CameraModel{"DJI", "FC6310"}, "DJI FC6310"},
+		{CameraModel{"", "FC6310"}, "FC6310"},
+		{CameraModel{"DJI", ""}, "DJI"},
+		{CameraModel{}, ""},
+	}
+	for _, test := range tests {
+		if got := test.camera.String(); got != test.want {
+			t.Errorf("Unexpected name of %+v: %q\n", test.camera, got)
+		}
+	}
+}
+
+func TestCameraModelQuirks(t *testing.T) {
+	tests := []struct {
+		camera CameraModel
+		want   quirk
+	}{
+		{CameraModel{"NIKON CORPORATION", "NIKON D1X"}, quirkEarlyNefPreview},
+		{CameraModel{"Nikon", "nikon d100 "}, quirkEarlyNefPreview},
+		{CameraModel{"NIKON CORPORATION", "NIKON D90"}, 0},
+		{CameraModel{"DJI", "FC6310"}, 0},
+		{CameraModel{"Canon", "Canon EOS 5D Mark II"}, 0},
+		{CameraModel{"Canon", "Canon EOS-1DS"}, quirkTifContainer},
+		{CameraModel{"Canon", "Canon EOS-1D Mark II"}, 0},
+	}
+	for _, test := range tests {
+		if got := test.camera.quirks(); got != test.want {
+			t.Errorf("Unexpected quirks of %+v: %b\n", test.camera, got)
+		}
+	}
+}
+
+func TestProcessFileCameraModel(t *testing.T) {
+	setupCr2()
+
+	cr2, err := gCr2Parser.ProcessFile(&RawFileInfo{File: TestCR2File, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error processing CR2: %v\n", err)
+	}
+	if want := (CameraModel{"Canon", "Canon EOS 5D Mark II"}); cr2.CameraModel != want {
+		t.Errorf("Unexpected camera model: %+v\n", cr2.CameraModel)
+	}
+}
+
+// TestNefQuirkEarlyPreview verifies that the preview of a model with
+// quirkEarlyNefPreview is found in IFD0 although the SubIFDs do not have
+// the early layout.
+func TestNefQuirkEarlyPreview(t *testing.T) {
+	p, _ := NewNefParser(isHostLittleEndian())
+
+	for _, model := range []string{"NIKON D1X", "NIKON D90"} {
+		tt := newTestTiff(true)
+		preview := testJpeg(t, 160, 120)
+		previewOffset := tt.addBlob(preview)
+		raw := tt.addIfd(0, longEntry(0x00fe, 0), longEntry(0x0100, 2000), longEntry(0x0101, 1312))
+		ifd0 := tt.addIfd(0,
+			asciiEntry(0x010f, "NIKON CORPORATION"),
+			asciiEntry(0x0110, model),
+			longEntry(0x014a, raw, raw),
+			longEntry(0x0201, previewOffset),
+			longEntry(0x0202, uint32(len(preview))))
+		path, dir := writeTestFile(t, "quirk.NEF", tt.bytes(ifd0))
+
+		r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75})
+		if model == "NIKON D90" {
+			if !errors.Is(err, ErrNoPreview) {
+				t.Errorf("Expected ErrNoPreview for %s; got %v\n", model, err)
+			}
+			continue
+		}
+		if err != nil || r.PreviewWidth != 160 || r.CameraModel.Model != model {
+			t.Errorf("Unexpected result for %s: %+v, %v\n", model, r, err)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// rangeBlockSize is the smallest range read by a RangeReaderAt, so that the
+// small reads of parsing the IFDs do not each require a request.
+const rangeBlockSize = 64 << 10
+
+// RangeFunc reads the length bytes at offset of an object, e.g., by an S3
+// GetObject request with the Range HTTPRange(offset, length):
+//
+//	func(offset, length int64) (io.ReadCloser, error) {
+//		out, err := client.GetObject(ctx, &s3.GetObjectInput{
+//			Bucket: &bucket,
+//			Key:    &key,
+//			Range:  aws.String(rawparser.HTTPRange(offset, length)),
+//		})
+//		if err != nil {
+//			return nil, err
+//		}
+//		return out.Body, nil
+//	}
+type RangeFunc func(offset, length int64) (io.ReadCloser, error)
+
+// RangeReaderAt is an io.ReaderAt reading an object, e.g., a raw file in
+// object storage, by ranged requests, so that a raw file is parsed without
+// downloading all of it.  Small reads are rounded up to blocks of 64 KiB;
+// the most recent block is retained.  A RangeReaderAt is safe for
+// concurrent use.  See RawFileInfo.Reader.
+type RangeReaderAt struct {
+	size int64
+	read RangeFunc
+
+	mu       sync.Mutex
+	block    []byte
+	blockOff int64
+}
+
+// NewRangeReaderAt creates a RangeReaderAt reading an object of size bytes
+// by fn.
+// Returns the RangeReaderAt.
+func NewRangeReaderAt(size int64, fn RangeFunc) *RangeReaderAt {
+	return &RangeReaderAt{size: size, read: fn}
+}
+
+// NewHTTPReaderAt creates a RangeReaderAt reading an object by HTTP range
+// requests, e.g., a presigned S3 URL.  The size of the object is read from
+// the Content-Range of a first request.  If client is nil,
+// http.DefaultClient is used.
+// Returns the RangeReaderAt or error if the server does not support range
+// requests.
+func NewHTTPReaderAt(ctx context.Context, client *http.Client, url string) (*RangeReaderAt, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var size int64 = -1
+	fn := func(offset, length int64) (io.ReadCloser, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Range", HTTPRange(offset, length))
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			return nil, fmt.Errorf("range request for %s: %s", url, resp.Status)
+		}
+		if size < 0 {
+			size, err = contentRangeSize(resp.Header.Get("Content-Range"))
+			if err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+		}
+		return resp.Body, nil
+	}
+
+	// the first request reads the size
+	body, err := fn(0, 1)
+	if err != nil {
+		return nil, err
+	}
+	body.Close()
+
+	return NewRangeReaderAt(size, fn), nil
+}
+
+// HTTPRange formats the HTTP Range of the length bytes at offset.
+func HTTPRange(offset, length int64) string {
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+}
+
+// contentRangeSize parses the complete length of an HTTP Content-Range,
+// e.g., "bytes 0-0/1234".
+// Returns the length or error.
+func contentRangeSize(cr string) (int64, error) {
+	_, size, ok := strings.Cut(cr, "/")
+	if !ok || !strings.HasPrefix(cr, "bytes ") {
+		return 0, fmt.Errorf("invalid Content-Range: %q", cr)
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid Content-Range: %q", cr)
+	}
+	return n, nil
+}
+
+// Size returns the size of the object, in bytes.
+func (r *RangeReaderAt) Size() int64 {
+	return r.size
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *RangeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("RangeReaderAt.ReadAt: negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	// reads beyond the end are short
+	var eof error
+	if remaining := r.size - off; int64(len(p)) > remaining {
+		p = p[:remaining]
+		eof = io.EOF
+	}
+
+	// large reads (e.g., the preview) are not cached
+	if len(p) >= rangeBlockSize {
+		n, err := r.readRange(p, off)
+		if err == nil {
+			err = eof
+		}
+		return n, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if r.block == nil || pos < r.blockOff || pos >= r.blockOff+int64(len(r.block)) {
+			if err := r.fetchBlock(pos - pos%rangeBlockSize); err != nil {
+				return n, err
+			}
+		}
+		n += copy(p[n:], r.block[pos-r.blockOff:])
+	}
+	return n, eof
+}
+
+// fetchBlock reads the block at off.
+// Returns error.
+func (r *RangeReaderAt) fetchBlock(off int64) error {
+	block := make([]byte, min(rangeBlockSize, r.size-off))
+	if _, err := r.readRange(block, off); err != nil {
+		r.block = nil
+		return err
+	}
+	r.block, r.blockOff = block, off
+	return nil
+}
+
+// readRange reads len(p) bytes at off by a single request.
+// Returns the number of bytes read or error.
+func (r *RangeReaderAt) readRange(p []byte, off int64) (int, error) {
+	body, err := r.read(off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	n, err := io.ReadFull(body, p)
+	if err == io.ErrUnexpectedEOF {
+		err = fmt.Errorf("short range read at offset %d: %d of %d bytes", off, n, len(p))
+	}
+	return n, err
+}
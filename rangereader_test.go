@@ -0,0 +1,199 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// bytesRangeFunc serves ranged reads of data, counting the requests and
+// the bytes read.
+func bytesRangeFunc(data []byte, requests, read *int64) RangeFunc {
+	return func(offset, length int64) (io.ReadCloser, error) {
+		atomic.AddInt64(requests, 1)
+		atomic.AddInt64(read, length)
+		return io.NopCloser(io.NewSectionReader(bytes.NewReader(data), offset, length)), nil
+	}
+}
+
+func TestRangeReaderAt(t *testing.T) {
+	data := make([]byte, 3*rangeBlockSize+100)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	var requests, read int64
+	r := NewRangeReaderAt(int64(len(data)), bytesRangeFunc(data, &requests, &read))
+
+	tests := []struct {
+		off, n int64
+		want   int
+		eof    bool
+	}{
+		{0, 8, 8, false},
+		{10, 100, 100, false},             // same block
+		{rangeBlockSize - 4, 8, 8, false}, // spans blocks
+		{rangeBlockSize, 2 * rangeBlockSize, 2 * rangeBlockSize, false}, // not cached
+		{int64(len(data)) - 10, 20, 10, true},
+		{int64(len(data)), 1, 0, true},
+	}
+	for _, tt := range tests {
+		p := make([]byte, tt.n)
+		n, err := r.ReadAt(p, tt.off)
+		if n != tt.want || (err == io.EOF) != tt.eof || (err != nil && err != io.EOF) {
+			t.Errorf("ReadAt(%d, %d): unexpected %d, %v\n", tt.n, tt.off, n, err)
+		}
+		if !bytes.Equal(p[:n], data[tt.off:tt.off+int64(n)]) {
+			t.Errorf("ReadAt(%d, %d): unexpected content\n", tt.n, tt.off)
+		}
+	}
+	if requests != 4 {
+		t.Errorf("Expected 4 requests; got %d\n", requests)
+	}
+}
+
+func TestProcessFileRangeReader(t *testing.T) {
+	const name = "test_files/big_endian.NEF"
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("Error reading test file: %v\n", err)
+	}
+	p, _ := NewNefParser(isHostLittleEndian())
+
+	want, err := p.ProcessFile(&RawFileInfo{File: name, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	var requests, read int64
+	r := NewRangeReaderAt(int64(len(data)), bytesRangeFunc(data, &requests, &read))
+	got, err := p.ProcessFile(&RawFileInfo{File: name, Reader: r, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if !got.CreateDate.Equal(want.CreateDate) || got.FileName != name || got.ImageWidth != want.ImageWidth {
+		t.Errorf("Expected %+v; got %+v\n", want, got)
+	}
+	if read >= int64(len(data))/2 {
+		t.Errorf("Expected a partial read; read %d of %d bytes in %d requests\n", read, len(data), requests)
+	}
+
+	// the preview is extracted from the reader
+	dir := t.TempDir() + string(os.PathSeparator)
+	if _, err := got.Extract(&RawFileInfo{Reader: r, DestDir: dir, Quality: 50}); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if got.PreviewWidth != 4256 || got.PreviewHeight != 2832 {
+		t.Errorf("Unexpected preview dimensions: %dx%d\n", got.PreviewWidth, got.PreviewHeight)
+	}
+}
+
+func TestProcessBytes(t *testing.T) {
+	for _, name := range []string{TestNefFile, TestCR2File} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("Error reading test file: %v\n", err)
+		}
+		want, err := NewFormatParser(filepath.Ext(name)).ProcessFile(&RawFileInfo{File: name, SkipExtraction: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+
+		got, err := ProcessBytes(data, &RawFileInfo{File: filepath.Base(name), SkipExtraction: true})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v\n", name, err)
+		}
+		if !got.CreateDate.Equal(want.CreateDate) || got.CameraModel != want.CameraModel || got.PreviewBytes != want.PreviewBytes {
+			t.Errorf("%s: expected %+v; got %+v\n", name, want, got)
+		}
+	}
+
+	// the format of a CR2 is identified by its magic bytes
+	data, err := os.ReadFile(TestCR2File)
+	if err != nil {
+		t.Fatalf("Error reading test file: %v\n", err)
+	}
+	cr2, err := ProcessBytes(data, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	var b bytes.Buffer
+	if err := cr2.ExtractJpegTo(&b, &RawFileInfo{Reader: bytes.NewReader(data), Quality: 50}); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if b.Len() == 0 || cr2.PreviewWidth == 0 {
+		t.Errorf("Unexpected preview of %d bytes, %dx%d\n", b.Len(), cr2.PreviewWidth, cr2.PreviewHeight)
+	}
+
+	// TIFF-based formats are identified by extension only
+	if _, err := ProcessBytes([]byte("MM\x00\x2a\x00\x00\x00\x08"), nil); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Expected ErrUnknownFormat; got %v\n", err)
+	}
+}
+
+func TestHTTPReaderAt(t *testing.T) {
+	data, err := os.ReadFile("test_files/little_endian.CR2")
+	if err != nil {
+		t.Fatalf("Error reading test file: %v\n", err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeContent(w, req, "raw.CR2", time.Time{}, bytes.NewReader(data))
+	}))
+	defer ts.Close()
+
+	r, err := NewHTTPReaderAt(context.Background(), nil, ts.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if r.Size() != int64(len(data)) {
+		t.Errorf("Expected size %d; got %d\n", len(data), r.Size())
+	}
+
+	p, _ := NewCr2Parser(isHostLittleEndian())
+	cr2, err := p.ProcessFile(&RawFileInfo{File: "raw.CR2", Reader: r, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if cr2.CreateDate.IsZero() || cr2.FileName != "raw.CR2" {
+		t.Errorf("Unexpected raw file: %+v\n", cr2)
+	}
+
+	// servers ignoring the Range header are rejected
+	full := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(data)
+	}))
+	defer full.Close()
+	if _, err := NewHTTPReaderAt(context.Background(), nil, full.URL); err == nil {
+		t.Error("Expected error for a server without range requests")
+	}
+}
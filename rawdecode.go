@@ -0,0 +1,92 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"errors"
+	"image"
+	"log"
+	"sync"
+)
+
+// ErrRawDecodeUnsupported is returned by DecodeRaw when no RawDecoder is
+// available: the raw image data is not decoded by the pure GO parsers.
+var ErrRawDecodeUnsupported = errors.New("raw decoding not supported")
+
+// RawDecoder develops the raw image data of a raw file, rather than
+// extracting its embedded preview, e.g., by delegating to libraw (the
+// "libraw" build tag) or dcraw.
+type RawDecoder interface {
+	// DecodeRaw develops the raw image data of the raw file specified by
+	// the File, Handle, or Reader of info, applying info.Render; the image
+	// has 16-bit samples, e.g., an *image.RGBA64, at a BitDepth of 16.
+	// Returns the image or error.
+	DecodeRaw(info *RawFileInfo) (image.Image, error)
+}
+
+var (
+	rawDecoderMu sync.RWMutex
+	rawDecoder   RawDecoder
+)
+
+// RegisterRawDecoder makes a RawDecoder available to DecodeRaw, replacing
+// the one registered by a build-tagged backend, if any.  A nil RawDecoder
+// removes it.
+func RegisterRawDecoder(d RawDecoder) {
+	if d != nil {
+		log.Printf("Registering %T raw decoder\n", d)
+	}
+	rawDecoderMu.Lock()
+	defer rawDecoderMu.Unlock()
+	rawDecoder = d
+}
+
+// registeredRawDecoder returns the registered RawDecoder or nil if none.
+func registeredRawDecoder() RawDecoder {
+	rawDecoderMu.RLock()
+	defer rawDecoderMu.RUnlock()
+	return rawDecoder
+}
+
+// DecodeRaw develops the raw image data of a raw file by the registered
+// RawDecoder.  The image is rendered as by the RawDecoder, e.g., white
+// balanced and rotated by libraw, with the RawFileInfo.Render options,
+// then its bad pixels are corrected if RawFileInfo.FixBadPixels is set.
+// Returns the image or error; ErrRawDecodeUnsupported if no RawDecoder is
+// registered.
+func DecodeRaw(info *RawFileInfo) (image.Image, error) {
+	d := registeredRawDecoder()
+	if d == nil {
+		return nil, ErrRawDecodeUnsupported
+	}
+	if err := info.Render.validate(); err != nil {
+		return nil, err
+	}
+
+	img, err := d.DecodeRaw(info)
+	if err != nil || !info.FixBadPixels {
+		return img, err
+	}
+	return correctBadPixels(img, info), nil
+}
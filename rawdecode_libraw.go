@@ -0,0 +1,174 @@
+// +build libraw
+
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+// Note: modify these flags for your environment if required.
+
+// #cgo CFLAGS: -O2
+// #cgo LDFLAGS: -lraw
+// #include <stdlib.h>
+// #include <libraw/libraw.h>
+//
+// static int developRaw(const char *name, const void *buf, size_t size,
+//                       int bps, float expShift, int highlight,
+//                       libraw_processed_image_t **out) {
+//     int rc;
+//     libraw_data_t *lr = libraw_init(0);
+//     if (lr == NULL) {
+//         return LIBRAW_UNSPECIFIED_ERROR;
+//     }
+//     lr->params.output_bps = bps;
+//     lr->params.exp_correc = expShift != 1;
+//     lr->params.exp_shift = expShift;
+//     lr->params.highlight = highlight;
+//
+//     rc = name != NULL ? libraw_open_file(lr, name) : libraw_open_buffer(lr, buf, size);
+//     if (rc == LIBRAW_SUCCESS) {
+//         rc = libraw_unpack(lr);
+//     }
+//     if (rc == LIBRAW_SUCCESS) {
+//         rc = libraw_dcraw_process(lr);
+//     }
+//     if (rc == LIBRAW_SUCCESS) {
+//         *out = libraw_dcraw_make_mem_image(lr, &rc);
+//     }
+//
+//     libraw_close(lr);
+//     return rc;
+// }
+import "C"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"unsafe"
+)
+
+func init() {
+	RegisterRawDecoder(librawDecoder{})
+}
+
+// librawDecoder is a RawDecoder developing the raw image data with libraw,
+// with its default settings: camera white balance, AHD demosaicing, and
+// sRGB output, rotated by the orientation of the raw file.  The
+// ExposureStops are applied as the exposure shift of libraw and
+// HighlightBlend as its highlight mode 2.
+type librawDecoder struct{}
+
+// DecodeRaw develops the raw image data of a raw file with libraw.  A raw
+// file read from a Handle or Reader is read into memory first.
+// Returns the image or error.
+func (librawDecoder) DecodeRaw(info *RawFileInfo) (image.Image, error) {
+	var name *C.char
+	var buf unsafe.Pointer
+	var size C.size_t
+	if info.Handle == nil && info.Reader == nil {
+		name = C.CString(info.File)
+		defer C.free(unsafe.Pointer(name))
+	} else {
+		data, err := readRawFile(info)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			return nil, fmt.Errorf("libraw: empty raw file")
+		}
+		// retained by libraw until closed; Go memory may not be
+		buf, size = C.CBytes(data), C.size_t(len(data))
+		defer C.free(buf)
+	}
+
+	highlight := 0
+	if info.Render.Highlights == HighlightBlend {
+		highlight = 2
+	}
+	bits := info.Render.bitDepth()
+
+	var out *C.libraw_processed_image_t
+	rc := C.developRaw(name, buf, size, C.int(bits), C.float(info.Render.exposureScale()), C.int(highlight), &out)
+	if rc != C.LIBRAW_SUCCESS {
+		return nil, fmt.Errorf("libraw: %s", C.GoString(C.libraw_strerror(rc)))
+	}
+	defer C.libraw_dcraw_clear_mem(out)
+
+	if out._type != C.LIBRAW_IMAGE_BITMAP || int(out.bits) != bits || (out.colors != 1 && out.colors != 3) {
+		return nil, fmt.Errorf("libraw: unexpected image of %d colors, %d bits", out.colors, out.bits)
+	}
+	width, height, colors := int(out.width), int(out.height), int(out.colors)
+	if bits == 16 {
+		// samples in host byte order
+		pix := unsafe.Slice((*uint16)(unsafe.Pointer(&out.data[0])), width*height*colors)
+		return rgba64Image(pix, width, height, colors), nil
+	}
+	pix := unsafe.Slice((*byte)(unsafe.Pointer(&out.data[0])), width*height*colors)
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < width*height; i++ {
+		if colors == 3 {
+			copy(img.Pix[i*4:i*4+3], pix[i*3:i*3+3])
+		} else {
+			img.Pix[i*4], img.Pix[i*4+1], img.Pix[i*4+2] = pix[i], pix[i], pix[i]
+		}
+		img.Pix[i*4+3] = 0xff
+	}
+	return img, nil
+}
+
+// rgba64Image converts the 16-bit samples of the image developed by
+// libraw, of 1 or 3 colors, to an RGBA64 image.
+// Returns the image.
+func rgba64Image(pix []uint16, width, height, colors int) *image.RGBA64 {
+	img := image.NewRGBA64(image.Rect(0, 0, width, height))
+	for i := 0; i < width*height; i++ {
+		for c := 0; c < 3; c++ {
+			v := pix[i*colors]
+			if colors == 3 {
+				v = pix[i*3+c]
+			}
+			binary.BigEndian.PutUint16(img.Pix[i*8+c*2:], v)
+		}
+		binary.BigEndian.PutUint16(img.Pix[i*8+6:], 0xffff)
+	}
+	return img
+}
+
+// readRawFile reads the whole raw file specified by RawFileInfo.
+// Returns the content or error.
+func readRawFile(info *RawFileInfo) ([]byte, error) {
+	f, err := openRawFile(info)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	size, err := f.Size()
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(io.NewSectionReader(f, 0, size))
+}
@@ -0,0 +1,74 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"errors"
+	"image"
+	"testing"
+)
+
+// testRawDecoder is a RawDecoder recording the raw file it decodes.
+type testRawDecoder struct {
+	file string
+}
+
+func (d *testRawDecoder) DecodeRaw(info *RawFileInfo) (image.Image, error) {
+	d.file = info.File
+	return image.NewRGBA(image.Rect(0, 0, 6, 4)), nil
+}
+
+// registeredFormats returns the formats of the registered parsers.
+func registeredFormats() []FormatInfo {
+	rp := NewRawParsers()
+	rp.RegisterFormats()
+	return rp.SupportedFormats()
+}
+
+func TestDecodeRaw(t *testing.T) {
+	saved := registeredRawDecoder()
+	defer RegisterRawDecoder(saved)
+
+	RegisterRawDecoder(nil)
+	if _, err := DecodeRaw(&RawFileInfo{File: TestNefFile}); !errors.Is(err, ErrRawDecodeUnsupported) {
+		t.Errorf("Expected ErrRawDecodeUnsupported; got %v\n", err)
+	}
+	for _, f := range registeredFormats() {
+		if f.RawDecode {
+			t.Errorf("%s: expected no raw decoding\n", f.Key)
+		}
+	}
+
+	d := new(testRawDecoder)
+	RegisterRawDecoder(d)
+	img, err := DecodeRaw(&RawFileInfo{File: TestNefFile})
+	if err != nil || img.Bounds().Dx() != 6 || d.file != TestNefFile {
+		t.Errorf("Unexpected decode of %q: %v %v\n", d.file, img, err)
+	}
+	for _, f := range registeredFormats() {
+		if !f.RawDecode || !f.PreviewExtraction {
+			t.Errorf("%s: unexpected capabilities %+v\n", f.Key, f.Capabilities)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Orientations of the embedded JPEG, as named in JSON.  See
+// RawFile.Orientation.
+const (
+	OrientationNormal                    = "normal"
+	OrientationMirrorHorizontal          = "mirrorHorizontal"
+	OrientationRotate180                 = "rotate180"
+	OrientationMirrorVertical            = "mirrorVertical"
+	OrientationMirrorHorizontalRotate270 = "mirrorHorizontalRotate270"
+	OrientationRotate90                  = "rotate90"
+	OrientationMirrorHorizontalRotate90  = "mirrorHorizontalRotate90"
+	OrientationRotate270                 = "rotate270"
+)
+
+// MarshalJSON encodes a RawFile for catalog export (e.g., NDJSON).  The
+// CreateDate is formatted as RFC 3339 (omitted if not recorded), the
+// Orientation as one of the Orientation names, the DngVariant by name
+// for DNG-based raw files, and the Warnings as their messages.
+func (r RawFile) MarshalJSON() ([]byte, error) {
+	type rawFile RawFile // without the MarshalJSON method
+
+	out := struct {
+		CreateDate  string `json:"createDate,omitempty"`
+		Orientation string `json:"orientation"`
+		DngVariant  string `json:"dngVariant,omitempty"`
+		rawFile
+		Warnings []string `json:"warnings,omitempty"`
+	}{
+		Orientation: r.orientation().String(),
+		rawFile:     rawFile(r),
+	}
+	if !r.CreateDate.IsZero() {
+		out.CreateDate = r.CreateDate.Format(time.RFC3339Nano)
+	}
+	if r.DngVersion != "" {
+		out.DngVariant = r.DngVariant.String()
+	}
+	for _, w := range r.Warnings {
+		out.Warnings = append(out.Warnings, w.Error())
+	}
+
+	return json.Marshal(out)
+}
+
+// MarshalJSON encodes an ExtractionResult, with the error as its message.
+func (e ExtractionResult) MarshalJSON() ([]byte, error) {
+	type extractionResult ExtractionResult // without the MarshalJSON method
+
+	out := struct {
+		extractionResult
+		Err string `json:"error,omitempty"`
+	}{extractionResult: extractionResult(e)}
+	if e.Err != nil {
+		out.Err = e.Err.Error()
+	}
+
+	return json.Marshal(out)
+}
@@ -0,0 +1,430 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/binary"
+	"io"
+	"log"
+	"math"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// cfaColors are the colors of the CFAPattern values, by value: red, green,
+// blue, cyan, magenta, yellow, and white.
+const cfaColors = "RGBCMYW"
+
+// maxCFADim is the largest dimension, in pixels, of a CFA pattern, e.g., 6
+// for the X-Trans pattern.
+const maxCFADim = 16
+
+// RawImage describes the raw image data of a raw file and the geometry of
+// the sensor, e.g., for an external demosaicer.
+type RawImage struct {
+	// IFD names the IFD of the raw image data, e.g., "SubIFD1".
+	IFD string `json:"ifd"`
+
+	// Width and Height are the dimensions, in pixels, of the raw image
+	// data; 0 if not recorded.
+	Width  int `json:"width"`
+	Height int `json:"height"`
+
+	// BitsPerSample is the number of bits of the first sample; 0 if not
+	// recorded.
+	BitsPerSample int `json:"bitsPerSample,omitempty"`
+
+	// Compression is the TIFF Compression of the raw image data; 0 if not
+	// recorded.
+	Compression int `json:"compression"`
+
+	// CFAPattern is the color filter array pattern, one letter (R, G, B,
+	// C, M, Y, or W) per pixel of the repeating pattern, row by row from the
+	// top-left pixel of the ActiveArea, e.g., "RGGB"; empty if not recorded,
+	// e.g., of LinearRaw data.  CFAWidth and CFAHeight are the dimensions of
+	// the pattern, e.g., 2 by 2, or 6 by 6 for X-Trans.
+	CFAPattern string `json:"cfaPattern,omitempty"`
+	CFAWidth   int    `json:"cfaWidth,omitempty"`
+	CFAHeight  int    `json:"cfaHeight,omitempty"`
+
+	// ActiveArea is the area of the raw image data exposed to light,
+	// excluding masked pixels (e.g., to measure the black level): the DNG
+	// ActiveArea or the sensor borders of the Canon maker note.  Defaults to
+	// the whole raw image data.
+	ActiveArea Area `json:"activeArea"`
+
+	// CropMargins are the pixels of each edge of the ActiveArea outside the
+	// DefaultCrop: the DNG DefaultCropOrigin and DefaultCropSize.  Zero if
+	// not recorded.
+	CropMargins Margins `json:"cropMargins"`
+
+	// DefaultCropWidth and DefaultCropHeight are the dimensions, in pixels,
+	// of the image rendered from the ActiveArea, less the CropMargins: the
+	// DNG DefaultCropSize or the dimensions of the ActiveArea.
+	DefaultCropWidth  int `json:"defaultCropWidth"`
+	DefaultCropHeight int `json:"defaultCropHeight"`
+}
+
+// Area is a rectangle of the raw image data, in pixels from its top-left
+// pixel; Bottom and Right are exclusive.
+type Area struct {
+	Top    int `json:"top"`
+	Left   int `json:"left"`
+	Bottom int `json:"bottom"`
+	Right  int `json:"right"`
+}
+
+// Width returns the width, in pixels, of the area.
+func (a Area) Width() int {
+	return a.Right - a.Left
+}
+
+// Height returns the height, in pixels, of the area.
+func (a Area) Height() int {
+	return a.Bottom - a.Top
+}
+
+// within determines if the area is not empty and within an image of a
+// width and height.
+func (a Area) within(width, height int) bool {
+	return a.Top >= 0 && a.Left >= 0 && a.Top < a.Bottom && a.Left < a.Right &&
+		a.Bottom <= height && a.Right <= width
+}
+
+// Margins are the pixels cropped from each edge of an area.
+type Margins struct {
+	Top    int `json:"top"`
+	Left   int `json:"left"`
+	Bottom int `json:"bottom"`
+	Right  int `json:"right"`
+}
+
+// sensorInfo is the sensor geometry recorded by a maker note: the
+// dimensions of the sensor and its active area; zero if not recorded.
+type sensorInfo struct {
+	width, height int
+	active        Area
+}
+
+// canonSensorInfo reads the SensorInfo of a Canon maker note: the
+// SensorWidth and SensorHeight (indices 1 and 2) and the inclusive
+// SensorLeftBorder, SensorTopBorder, SensorRightBorder, and
+// SensorBottomBorder (indices 5 to 8).
+// Returns the sensor geometry; zero if inconsistent.
+func canonSensorInfo(info []uint32) sensorInfo {
+	if len(info) < 9 {
+		return sensorInfo{}
+	}
+	s := sensorInfo{
+		width:  int(info[1]),
+		height: int(info[2]),
+		active: Area{Top: int(info[6]), Left: int(info[5]), Bottom: int(info[8]) + 1, Right: int(info[7]) + 1},
+	}
+	if !s.active.within(s.width, s.height) {
+		return sensorInfo{}
+	}
+	return s
+}
+
+// rawImageInfo describes the raw image data, with the sensor geometry of
+// the maker note if not recorded by the IFD of the raw image data; the
+// sensor geometry is ignored for DNG-based raw files, whose raw image data
+// may be cropped.
+// Returns the raw image or nil if not described by an IFD.
+func (m *rawMetadata) rawImageInfo() *RawImage {
+	if m.rawImage != nil && m.sensor.width > 0 && m.dngVersion[0] == 0 {
+		m.rawImage.setSensorArea(m.sensor.width, m.sensor.height, m.sensor.active)
+	}
+	return m.rawImage
+}
+
+// rawIFDs are the IFDs of a TIFF-based raw file describing its raw image
+// data: IFD0, the IFD of the raw image data, and the EXIF IFD, if any.
+type rawIFDs struct {
+	order           binary.ByteOrder
+	ifd0, raw, exif *tiff.IFD
+	image           EmbeddedImage // of raw
+}
+
+// findRawIFDs walks the IFD0 chain, SubIFDs, and EXIF IFD of a TIFF-based
+// raw file for the IFD of its raw image data: that of NewSubfileType 0
+// (the full-resolution image) or, if none, the largest.  Errors are not
+// fatal as the IFDs found before are used.
+// Returns the IFDs or nil if the raw data is not described by an IFD.
+func findRawIFDs(f io.ReaderAt) *rawIFDs {
+	h, err := tiff.ReadHeader(f)
+	if err != nil {
+		return nil
+	}
+
+	ifds := &rawIFDs{order: h.ByteOrder}
+	err = tiff.WalkIFDs(f, h, func(ifd *tiff.IFD) error {
+		switch ifd.Kind {
+		case tiff.KindMain, tiff.KindSub:
+		case tiff.KindExif:
+			ifds.exif = ifd
+			return tiff.SkipChildren
+		default:
+			return tiff.SkipChildren
+		}
+		if ifd.Kind == tiff.KindMain && ifd.Index == 0 {
+			ifds.ifd0 = ifd
+		}
+
+		img, ok := describeImage(ifd)
+		if !ok || img.Type != ImageRaw {
+			return nil
+		}
+		raw := ifds.raw
+		if raw == nil || isFullResolution(ifd) && !isFullResolution(raw) ||
+			isFullResolution(ifd) == isFullResolution(raw) && img.Width*img.Height > ifds.image.Width*ifds.image.Height {
+			ifds.raw, ifds.image = ifd, img
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error reading raw image: %v\n", err)
+	}
+	if ifds.raw == nil {
+		return nil
+	}
+
+	return ifds
+}
+
+// readRawImage describes the raw image data of a TIFF-based raw file.
+// Returns the raw image or nil if the raw data is not described by an IFD.
+func readRawImage(f io.ReaderAt) *RawImage {
+	ifds := findRawIFDs(f)
+	if ifds == nil {
+		return nil
+	}
+	return ifds.rawImage()
+}
+
+// rawImage describes the raw image data from the entries of its IFD and,
+// if not recorded there, the CFAPattern of the EXIF IFD.
+func (ifds *rawIFDs) rawImage() *RawImage {
+	raw := ifds.raw
+	r := &RawImage{
+		IFD:           ifds.image.IFD,
+		Width:         ifds.image.Width,
+		Height:        ifds.image.Height,
+		BitsPerSample: ifds.image.BitsPerSample,
+		Compression:   ifds.image.Compression,
+		ActiveArea:    Area{Bottom: ifds.image.Height, Right: ifds.image.Width},
+	}
+	if !r.readCFAPattern(raw) && ifds.exif != nil {
+		if e := ifds.exif.Find(0xa302); e != nil {
+			r.readExifCFAPattern(e, ifds.order)
+		}
+	}
+
+	if v := entryInts(raw.Find(0xc68d)); len(v) == 4 { // ActiveArea
+		if area := (Area{v[0], v[1], v[2], v[3]}); area.within(r.Width, r.Height) {
+			r.ActiveArea = area
+		}
+	}
+	if ifds.ifd0 == nil || ifds.ifd0.Find(0xc612) == nil { // DNGVersion
+		// the pattern of TIFF/EP starts at the top-left pixel of the image
+		r.shiftCFAPattern(r.ActiveArea.Left, r.ActiveArea.Top)
+	}
+	r.setDefaultCrop(entryInts(raw.Find(0xc61f)), entryInts(raw.Find(0xc620)))
+
+	return r
+}
+
+// isFullResolution determines if an IFD is of NewSubfileType 0: the
+// full-resolution image.
+func isFullResolution(ifd *tiff.IFD) bool {
+	e := ifd.Find(0x00fe)
+	if e == nil {
+		return true
+	}
+	v, err := e.Uint()
+	return err == nil && v == 0
+}
+
+// entryInts reads the integer values of an entry, with RATIONAL values
+// rounded, e.g., of the DNG DefaultCropOrigin.
+// Returns the values; nil if the entry is nil, not an integer or RATIONAL,
+// or could not be read.
+func entryInts(e *tiff.Entry) []int {
+	if e == nil {
+		return nil
+	}
+	if e.Type != tiff.Rational {
+		u, err := e.Uints()
+		if err != nil {
+			return nil
+		}
+		v := make([]int, len(u))
+		for i := range u {
+			v[i] = int(u[i])
+		}
+		return v
+	}
+
+	value, err := e.Value()
+	if err != nil {
+		return nil
+	}
+	rationals := value.([]tiff.RationalValue)
+	v := make([]int, len(rationals))
+	for i, r := range rationals {
+		if r.Den == 0 {
+			return nil
+		}
+		v[i] = int(math.Round(float64(r.Num) / float64(r.Den)))
+	}
+	return v
+}
+
+// readCFAPattern records the CFA pattern of the CFARepeatPatternDim (rows
+// and columns) and CFAPattern of the IFD of the raw image data, with the
+// colors of the DNG CFAPlaneColor.
+// Returns true if recorded.
+func (r *RawImage) readCFAPattern(ifd *tiff.IFD) bool {
+	dim := entryInts(ifd.Find(0x828d))
+	pattern := ifd.Find(0x828e)
+	if len(dim) != 2 || pattern == nil {
+		return false
+	}
+	values, err := pattern.Bytes()
+	if err != nil {
+		return false
+	}
+
+	planes := []byte{0, 1, 2}
+	if e := ifd.Find(0xc616); e != nil {
+		if b, err := e.Bytes(); err == nil && len(b) > 0 {
+			planes = b
+		}
+	}
+	return r.setCFAPattern(dim[1], dim[0], values, planes)
+}
+
+// readExifCFAPattern records the CFA pattern of the EXIF CFAPattern: the
+// columns and rows of the pattern, as SHORTs, followed by the colors.  The
+// SHORTs are written in either byte order by cameras; the one consistent
+// with the length of the value is used.
+func (r *RawImage) readExifCFAPattern(e *tiff.Entry, order binary.ByteOrder) {
+	b, err := e.Bytes()
+	if err != nil || len(b) < 4 {
+		return
+	}
+
+	swapped := binary.ByteOrder(binary.BigEndian)
+	if order == binary.BigEndian {
+		swapped = binary.LittleEndian
+	}
+	for _, o := range []binary.ByteOrder{order, swapped} {
+		width, height := int(o.Uint16(b)), int(o.Uint16(b[2:]))
+		if width*height == len(b)-4 {
+			r.setCFAPattern(width, height, b[4:], []byte{0, 1, 2})
+			return
+		}
+	}
+}
+
+// setCFAPattern records a CFA pattern of a width and height, whose values
+// are indices of planes of a color.
+// Returns true if recorded; false if the pattern is inconsistent.
+func (r *RawImage) setCFAPattern(width, height int, values, planes []byte) bool {
+	if width < 1 || height < 1 || width > maxCFADim || height > maxCFADim || len(values) < width*height {
+		return false
+	}
+
+	pattern := make([]byte, width*height)
+	for i := range pattern {
+		if int(values[i]) >= len(planes) || int(planes[values[i]]) >= len(cfaColors) {
+			return false
+		}
+		pattern[i] = cfaColors[planes[values[i]]]
+	}
+
+	r.CFAPattern, r.CFAWidth, r.CFAHeight = string(pattern), width, height
+	return true
+}
+
+// shiftCFAPattern shifts the CFA pattern to start at a pixel of the raw
+// image data, e.g., the top-left pixel of the ActiveArea.
+func (r *RawImage) shiftCFAPattern(x, y int) {
+	if r.CFAPattern == "" || x%r.CFAWidth == 0 && y%r.CFAHeight == 0 {
+		return
+	}
+
+	pattern := make([]byte, len(r.CFAPattern))
+	for row := range r.CFAHeight {
+		for col := range r.CFAWidth {
+			pattern[row*r.CFAWidth+col] = r.CFAPattern[(row+y)%r.CFAHeight*r.CFAWidth+(col+x)%r.CFAWidth]
+		}
+	}
+	r.CFAPattern = string(pattern)
+}
+
+// setDefaultCrop records the default crop of the ActiveArea from the DNG
+// DefaultCropOrigin and DefaultCropSize (horizontal, then vertical), or the
+// whole ActiveArea if not recorded or inconsistent.
+func (r *RawImage) setDefaultCrop(origin, size []int) {
+	r.CropMargins = Margins{}
+	r.DefaultCropWidth, r.DefaultCropHeight = r.ActiveArea.Width(), r.ActiveArea.Height()
+	if len(size) != 2 || size[0] <= 0 || size[1] <= 0 {
+		return
+	}
+	if len(origin) != 2 {
+		origin = []int{0, 0}
+	}
+
+	m := Margins{
+		Top:    origin[1],
+		Left:   origin[0],
+		Bottom: r.ActiveArea.Height() - origin[1] - size[1],
+		Right:  r.ActiveArea.Width() - origin[0] - size[0],
+	}
+	if m.Top < 0 || m.Left < 0 || m.Bottom < 0 || m.Right < 0 {
+		return
+	}
+	r.CropMargins = m
+	r.DefaultCropWidth, r.DefaultCropHeight = size[0], size[1]
+}
+
+// setSensorArea records the dimensions and active area of the sensor of a
+// maker note, e.g., for a CR2, whose IFD of the raw image data does not
+// record them; they are ignored if the IFD records an ActiveArea.
+func (r *RawImage) setSensorArea(width, height int, active Area) {
+	if r.ActiveArea != (Area{Bottom: r.Height, Right: r.Width}) {
+		return
+	}
+	if r.Width == 0 && r.Height == 0 {
+		r.Width, r.Height = width, height
+	}
+	if !active.within(r.Width, r.Height) {
+		return
+	}
+
+	r.ActiveArea = active
+	r.shiftCFAPattern(active.Left, active.Top)
+	r.setDefaultCrop(nil, nil)
+}
@@ -22,91 +22,513 @@
 */
 
 // Package rawparser provides a basic parsing interface for camera raw files.  The current
-// incarnation supports TIFF-based RAW files (e.g., Canon CR2, Nikon NEF...).
+// incarnation supports TIFF-based RAW files (e.g., Canon CR2, Nikon NEF, NRW...)
+// and the legacy, CIFF-based, Canon CRW.
 //
 // TIFF specification: http://partners.adobe.com/public/developer/en/tiff/TIFF6.pdf
 package rawparser
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 )
 
-// ifdEntry is a struct representing a TIFF Image File Directory (IFD).
-// Each 12-byte IFD entry has the following format:
-//   Bytes 0-1 The Tag that identifies the field.
-//   Bytes 2-3 The field Type.
-//   Bytes 4-7 The number of values, Count of the indicated Type.
-//   Bytes 8-11 The Value Offset, the file offset (in bytes) of the Value for the field.
-type ifdEntry struct {
-	tag, fieldType     uint16
-	count, valueOffset uint32 // offset from start of file
-}
-
 // jpegInfo is a struct representing a RawFile'sembedded jpeg information.
 type jpegInfo struct {
-	orientation          float64
+	orientation          Orientation
 	offset, length       int64
 	xRes, yRes           uint32
 	xResFloat, yResFloat float64
+	width, height        int // dimensions of the embedded jpeg
+
+	// strips are the byte ranges of a jpeg stored as multiple strips, in
+	// order; nil if stored contiguously at offset.  length is the sum of
+	// the strip lengths.
+	strips []byteRange
+}
+
+// byteRange is a struct representing a range of bytes within a raw file.
+type byteRange struct {
+	offset, length int64
+}
+
+// rawMetadata is a struct representing the metadata parsed from a RawFile's
+// IFDs, independent of the embedded jpeg.
+type rawMetadata struct {
+	dates                   dateTags
+	tags                    tagStats
+	imageWidth, imageHeight uint32 // raw sensor dimensions
+	rawCompression          uint32 // compression of the raw image data
+	make, model             string
+	dngVersion              [4]byte
+	imageUniqueID           string
+	serialNumber            string // EXIF BodySerialNumber, or as recorded otherwise
+	artist, copyright       string
+	interopIndex            string
+	colorSpace              uint16 // EXIF ColorSpace
+	composite               compositeInfo
+	subjects                subjectInfo
+	ratings                 ratingInfo
+	lens                    lensInfo
+	exposure                Exposure
+	shutterCount            uint32 // Nikon ShutterCount
+	imageNumber             uint32 // EXIF ImageNumber or Canon FileNumber
+	images                  []EmbeddedImage
+	rawImage                *RawImage
+	sensor                  sensorInfo
+	partial                 bool // an IFD or tag could not be read
+	datesSkipped            bool // the date tags were not parsed; see PreviewOnly
+
+	// warnings are the recoverable problems found processing the IFDs.
+	warnings []error
+}
+
+// warn records a recoverable problem found processing the IFDs.
+func (m *rawMetadata) warn(err error) {
+	log.Printf("Warning: %v\n", err)
+	m.warnings = append(m.warnings, err)
 }
 
 // RawFileInfo is a struct defining key information for parsing a RawFile.
 type RawFileInfo struct {
-	File    string
+	// File is the path to the raw file.  If Handle is set, File is only
+	// used to name the raw file; it is not opened.
+	File string
+
+	// DestDir is the directory of the extracted preview.  Defaults to the
+	// directory of File, or the current directory if read by Reader.
 	DestDir string
+
+	// Quality is the JPEG quality, from 1 to 100, of the extracted
+	// preview, or QualityAuto.  Defaults to DefaultQuality.
 	Quality int
 	//	NumOfChannels int
+
+	// Handle is an already-open raw file (e.g., a descriptor received from
+	// another process).  If set, ProcessFile reads from Handle instead of
+	// opening File, and the caller retains ownership: Handle is not closed.
+	Handle *os.File
+
+	// PreserveExif, if set, writes EXIF metadata to extracted JPEGs (other
+	// output formats are written without): the EXIF metadata of TIFF-based
+	// raw files, including the date, orientation, camera, and GPS, without
+	// the tags describing the raw image data, or, for other raw files, the
+	// CreateDate, orientation, and camera make and model.
+	PreserveExif bool
+
+	// Artist and Copyright, if set, are stamped into the EXIF Artist and
+	// Copyright of extracted JPEGs, replacing those of the raw file, e.g.,
+	// as required for delivery to an agency.  If PreserveExif is not set,
+	// the EXIF metadata written holds these tags only.
+	Artist, Copyright string
+
+	// ConvertToSRGB, if set, converts previews in Adobe RGB, by the
+	// ColorSpace of the raw file or the ICC profile of the preview, to sRGB
+	// when re-encoded, so that the previews do not appear desaturated in,
+	// e.g., browsers.  A preview copied as is is not converted.
+	ConvertToSRGB bool
+
+	// CropAspect, if positive, crops the thumbnails of Renditions and
+	// WriteRenditions, other than the full size, to the aspect ratio
+	// width / height when displayed upright, e.g., 1 for square
+	// thumbnails: centered on the faces or subject area of the Subjects of
+	// the RawFile, or on the preview if none are recorded.
+	CropAspect float64
+
+	// OutputTemplate, if set, is the path of the extracted preview relative
+	// to DestDir, with placeholders for the CreateDate and the name of the
+	// raw file, e.g., "{year}/{month}/{day}/{base}.jpg".  Directories are
+	// created as needed.  See expandOutputTemplate for the placeholders.
+	// Defaults to the name of the raw file with an "_extracted" suffix.
+	OutputTemplate string
+
+	// Reader, if set, is the raw file, of Size bytes, e.g., an object in
+	// object storage read by ranged requests (see NewRangeReaderAt).  Only
+	// the parts of the raw file needed are read.  File names the raw file
+	// and is not opened.  Size may be omitted if Reader has a Size method;
+	// it is required by CRW and by Checksums only.
+	Reader io.ReaderAt
+	Size   int64
+
+	// SkipExtraction parses the metadata only; the embedded JPEG is not
+	// extracted.
+	SkipExtraction bool
+
+	// DryRun parses the raw file and encodes the preview as requested, but
+	// creates no file or directory: the path and size of the preview, and
+	// whether it would replace an existing file, are recorded in
+	// ExtractionResult.Planned instead.  The preview is encoded in memory
+	// by the pure-Go encoder, as the native JPEG backends, selected by the
+	// jpeg, turbojpeg, and jpegcpp build tags, write files only; with
+	// those, the size is an estimate.
+	DryRun bool
+
+	// Overwrite defines the handling of an existing file at the path of
+	// the extracted preview; the action taken is recorded in
+	// ExtractionResult.Action.  Defaults to OverwriteExisting.
+	Overwrite OverwritePolicy
+
+	// Lenient continues past recoverable problems, e.g., an unreadable
+	// EXIF IFD or a damaged tag, which are reported as RawFile.Warnings;
+	// otherwise, ProcessFile returns the first of them as its error.  IFDs
+	// and tags that cannot be read, e.g., of a truncated file, are
+	// skipped: the RawFile is marked Partial and holds the metadata and
+	// preview located before the failure.  A header whose magic value is
+	// nonstandard is reported as a *HeaderError.
+	Lenient bool
+
+	// DefaultLocation is the time zone of the CreateDate for raw files
+	// that record neither an EXIF offset time nor a GPS timestamp.
+	// Defaults to UTC.
+	DefaultLocation *time.Location
+
+	// CollectUnknownTags includes the IDs of the tags ignored by the parser
+	// in RawFile.TagStats.
+	CollectUnknownTags bool
+
+	// DatePolicy defines the handling of an implausible CreateDate, e.g.,
+	// a camera clock that was never set.  Defaults to DateAccept.
+	DatePolicy DatePolicy
+
+	// OutputFormat is the image format of the extracted preview.  Formats
+	// other than OutputJpeg require a build with the matching encoder; see
+	// OutputFormat.Supported.  Defaults to OutputJpeg.
+	OutputFormat OutputFormat
+
+	// Jpeg are the chroma subsampling and progressive encoding of JPEG
+	// previews.  Quality may be QualityAuto to match the size of the
+	// embedded preview.
+	Jpeg JpegOptions
+
+	// Checksums selects the checksums of the raw file and of the extracted
+	// preview to compute, e.g., to detect duplicate files without reading
+	// them again.  Defaults to none.
+	Checksums Checksum
+
+	// Histogram decodes the embedded jpeg and computes its histograms and
+	// clipping statistics; see RawFile.Histogram.  Defaults to false.
+	Histogram bool
+
+	// MaxPreviewMemory, if set, is the memory budget, in bytes, of the
+	// embedded JPEG of a raw file, e.g., 64 << 20 to protect a shared
+	// server from pathological or hostile files: the larger of its length
+	// and its decoded size, at 3 bytes per pixel.  A preview exceeding the
+	// budget is neither read into memory nor re-encoded: it is copied to
+	// the output as is, streamed from the raw file, with EXIF metadata as
+	// by PreserveExif; see ExtractionResult.Copied.  Output formats other
+	// than OutputJpeg, renditions, DecodePreview, and the Histogram fail
+	// with ErrPreviewTooLarge instead.  Defaults to no limit.
+	MaxPreviewMemory int64
+
+	// FixBadPixels corrects the bad pixels of the image developed by
+	// DecodeRaw: those listed by the DNG FixBadPixelsList opcodes and stuck
+	// pixels, e.g., the hot pixels of a long exposure, replaced by the
+	// median of their neighbors.  Defaults to false.
+	FixBadPixels bool
+
+	// Render are the exposure compensation, highlight handling, bit
+	// depth, and image format of the image developed by DecodeRaw and
+	// Develop.
+	Render RenderOptions
+
+	// TagHooks, if set, are called with the values of the tags of the IFDs
+	// of TIFF-based raw files, e.g., to read tags not exposed by RawFile.
+	TagHooks *TagHooks
+
+	// Cache, if set, returns the RawFile of a raw file processed with the
+	// same options, if unchanged, without parsing it again, and records
+	// the RawFiles processed; see PreviewCache.  Raw files read by Reader,
+	// dry runs, and raw files processed with TagHooks are not cached.
+	Cache *PreviewCache
+
+	// claims are the output paths claimed by the batch processing the raw
+	// file; nil if not processed by a batch.
+	claims *outputClaims
 }
 
 // RawFile is a struct representing parsed results for a specific raw file.
 type RawFile struct {
 	// Note: additional EXIF metadata may be added in future release.
-	CreateDate         time.Time
-	FileName, JpegPath string
-	JpegOrientation    float64
+	CreateDate time.Time `json:"-"` // see MarshalJSON
+	FileName   string    `json:"fileName"`
+	JpegPath   string    `json:"jpegPath,omitempty"`
+
+	// JpegOrientation is the clockwise rotation, in radians, needed to
+	// display the embedded JPEG upright.
+	//
+	// Deprecated: use Orientation, which also reports mirroring.
+	JpegOrientation float64 `json:"-"`
+
+	// Orientation is the transformation needed to display the embedded
+	// JPEG upright.
+	Orientation Orientation `json:"-"` // see MarshalJSON
+
+	// ImageWidth and ImageHeight are the raw sensor dimensions, in pixels,
+	// as recorded in the raw file.
+	ImageWidth  int `json:"imageWidth"`
+	ImageHeight int `json:"imageHeight"`
+
+	// PreviewWidth and PreviewHeight are the dimensions, in pixels, of the
+	// embedded JPEG.
+	PreviewWidth  int `json:"previewWidth"`
+	PreviewHeight int `json:"previewHeight"`
+
+	// PreviewBytes is the length, in bytes, of the embedded JPEG.  A
+	// preview much smaller than its dimensions suggest is often corrupt.
+	PreviewBytes int64 `json:"previewBytes,omitempty"`
+
+	// JpegBytes is the size, in bytes, of the extracted preview; 0 if not
+	// extracted.
+	JpegBytes int64 `json:"jpegBytes,omitempty"`
+
+	// CompressionRatio is the ratio of the size of the extracted preview,
+	// decoded at 3 bytes per pixel, to JpegBytes; 0 if not extracted.
+	CompressionRatio float64 `json:"compressionRatio,omitempty"`
+
+	// DateSuspect is true if the CreateDate parsed from the raw file is
+	// implausible (before 1990 or in the future).  See DatePolicy.
+	DateSuspect bool `json:"dateSuspect"`
+
+	// DateSource identifies the source of the CreateDate: the EXIF
+	// DateTimeDigitized or, if not recorded, the EXIF DateTimeOriginal, the
+	// TIFF DateTime of IFD0, or, as a last resort, the modification time of
+	// the raw file.  DateSourceNone if the CreateDate is zero.
+	DateSource DateSource `json:"dateSource,omitempty"`
+
+	// CameraModel identifies the camera that wrote the raw file.
+	CameraModel CameraModel `json:"cameraModel,omitzero"`
+
+	// Lens identifies the lens the photo was taken with, if recorded.
+	Lens Lens `json:"lens,omitzero"`
+
+	// Exposure are the exposure program, metering mode, flash, and
+	// exposure compensation the photo was taken with, if recorded.
+	Exposure Exposure `json:"exposure,omitzero"`
+
+	// ShutterCount is the number of shutter actuations of the camera when
+	// the photo was taken, as recorded by Nikon cameras; 0 if not
+	// recorded.
+	ShutterCount int `json:"shutterCount,omitempty"`
+
+	// ImageNumber is the image number of the EXIF ImageNumber or the Canon
+	// FileNumber, e.g., 1001234 for the file 1234 of the folder 100; 0 if
+	// not recorded.
+	ImageNumber int `json:"imageNumber,omitempty"`
+
+	// SerialNumber is the serial number of the camera body: the EXIF
+	// BodySerialNumber or, if not recorded, the DNG CameraSerialNumber or
+	// the serial number of a Canon or Nikon maker note; empty if not
+	// recorded.  See Lens.SerialNumber for the lens.
+	SerialNumber string `json:"serialNumber,omitempty"`
+
+	// Artist and Copyright are the TIFF Artist and Copyright of IFD0; empty
+	// if not recorded.
+	Artist    string `json:"artist,omitempty"`
+	Copyright string `json:"copyright,omitempty"`
+
+	// CompositeImage records whether the photo is a composite of several
+	// source images, e.g., an in-camera HDR, and CompositeSources the
+	// number of source images used, if recorded (EXIF 2.32).
+	CompositeImage   CompositeImage `json:"compositeImage,omitempty"`
+	CompositeSources int            `json:"compositeSources,omitempty"`
+
+	// InteropIndex is the InteroperabilityIndex of the EXIF
+	// interoperability IFD: "R98" for a DCF basic file (sRGB) or "R03" for
+	// a DCF option file (Adobe RGB); empty if not recorded.
+	InteropIndex string `json:"interopIndex,omitempty"`
+
+	// ColorSpace is the color space of the embedded preview, by the EXIF
+	// ColorSpace and InteropIndex; ColorSpaceUnknown if not recorded.
+	ColorSpace ColorSpace `json:"colorSpace,omitempty"`
+
+	// Subjects are the subject area recorded by the EXIF SubjectArea or
+	// SubjectLocation and the faces detected by the camera, as recorded by
+	// the FaceDetect of a Nikon maker note, e.g., to crop thumbnails to
+	// the subject; nil if none.
+	Subjects []Region `json:"subjects,omitempty"`
+
+	// Images describes every image of a TIFF-based raw file, e.g., the
+	// preview, thumbnail, and raw data; nil for other raw files.
+	Images []EmbeddedImage `json:"images,omitempty"`
+
+	// RawImage describes the raw image data of a TIFF-based raw file: its
+	// dimensions, CFA pattern, active area, and default crop; nil for other
+	// raw files or if not described by an IFD.
+	RawImage *RawImage `json:"rawImage,omitempty"`
+
+	// DngVersion is the DNG version, e.g., "1.4.0.0", of DNG-based raw
+	// files (DNG, GPR); empty otherwise.
+	DngVersion string `json:"dngVersion,omitempty"`
+
+	// DngVariant identifies vendor-specific DNG variants.
+	DngVariant DngVariant `json:"-"` // see MarshalJSON
+
+	// TagStats reports the number of IFD entries parsed, recognized, and
+	// ignored by the parser.
+	TagStats TagStats `json:"tagStats"`
+
+	// Extraction is the outcome of extracting the embedded JPEG.  It is
+	// populated whenever the metadata was parsed, even if the extraction
+	// failed or was skipped.
+	Extraction *ExtractionResult `json:"extraction,omitempty"`
+
+	// Panorama is true if the embedded preview has a panoramic aspect
+	// ratio (e.g., an in-camera stitched panorama).
+	Panorama bool `json:"panorama"`
+
+	// PhotoID identifies the photo independent of the file containing it,
+	// e.g., to detect copies of a raw file that were renamed or modified.
+	// It is the EXIF ImageUniqueID if recorded; otherwise, it is derived
+	// from the camera model and the capture time, if recorded with
+	// sub-second precision; empty otherwise.
+	PhotoID string `json:"photoID,omitempty"`
+
+	// Rating is the rating, from 1 to 5 stars or -1 if rejected, recorded
+	// by the camera or other software in the XMP packet or the Rating tag
+	// of IFD0; 0 if not rated.
+	Rating int `json:"rating,omitempty"`
+
+	// Label is the color label of the XMP packet, e.g., "Red"; empty if
+	// none.
+	Label string `json:"label,omitempty"`
+
+	// Keywords are the keywords (dc:subject) of the XMP packet.
+	Keywords []string `json:"keywords,omitempty"`
+
+	// Warnings are the recoverable problems found processing the raw
+	// file, e.g., a missing create date.  Problems that are errors unless
+	// RawFileInfo.Lenient is set are only reported here if it is set.
+	Warnings []error `json:"-"` // see MarshalJSON
+
+	// Partial is true if an IFD or a tag of the raw file could not be
+	// read, e.g., of a truncated file; the metadata and preview are those
+	// located before the failure.  The failures are reported as Warnings
+	// of type *ReadError.
+	Partial bool `json:"partial,omitempty"`
+
+	// Cached is true if the RawFile was returned by RawFileInfo.Cache
+	// rather than parsed.  Its Warnings retain their messages only and
+	// its ReadStats and Timings are zero.
+	Cached bool `json:"cached,omitempty"`
+
+	// Checksums are the checksums selected by RawFileInfo.Checksums; nil
+	// if none were selected or the raw file could not be read.
+	Checksums *Checksums `json:"checksums,omitempty"`
+
+	// Histogram is the histogram of the embedded jpeg requested by
+	// RawFileInfo.Histogram; nil if not requested or the preview could not
+	// be decoded.
+	Histogram *Histogram `json:"histogram,omitempty"`
+
+	// ReadStats reports the reads of the raw file by ProcessFile, and by
+	// Extract, which adds its reads.
+	ReadStats ReadStats `json:"readStats,omitzero"`
+
+	// Timings reports the time spent processing the raw file by
+	// ProcessFile; Decode and Encode are replaced by Extract.  Not
+	// exported to JSON, as it varies between runs; see BatchStats.
+	Timings Timings `json:"-"`
+
+	// preview is the location of the embedded JPEG, retained so that the
+	// preview may be extracted again without re-parsing.  See Extract.
+	preview *jpegInfo
+}
+
+// ExtractionResult is a struct representing the outcome of extracting the
+// embedded JPEG from a raw file, reported independently of the metadata.
+type ExtractionResult struct {
+	// JpegPath is the full path to the extracted preview, encoded in the
+	// requested OutputFormat, or the existing file kept by SkipExisting;
+	// empty unless the extraction succeeded.
+	JpegPath string `json:"jpegPath,omitempty"`
+
+	// Action is the action taken for the path of the preview by the
+	// OverwritePolicy (for a dry run, the action that would be taken).
+	Action OutputAction `json:"action,omitempty"`
+
+	// NameResolution records how the path of the preview was disambiguated
+	// from the preview of another raw file of the same name in the batch.
+	NameResolution NameResolution `json:"nameResolution,omitempty"`
+
+	// Skipped is true if extraction was not requested.
+	// See RawFileInfo.SkipExtraction.
+	Skipped bool `json:"skipped"`
+
+	// Planned is the file the extraction would have written; nil unless
+	// RawFileInfo.DryRun is set and the extraction succeeded.
+	Planned *PlannedFile `json:"planned,omitempty"`
+
+	// Copied is true if the embedded JPEG was copied as is, rather than
+	// re-encoded, as it exceeds RawFileInfo.MaxPreviewMemory.
+	Copied bool `json:"copied,omitempty"`
+
+	// Err is the error that caused the extraction to fail; nil otherwise.
+	Err error `json:"-"` // see MarshalJSON
+}
+
+// PlannedFile is a struct describing a file a dry run would have written.
+// See RawFileInfo.DryRun.
+type PlannedFile struct {
+	// Path is the path of the file.
+	Path string `json:"path"`
+
+	// Size is the size, in bytes, of the file; an estimate if the preview
+	// would be encoded by a native JPEG backend.
+	Size int64 `json:"size"`
+
+	// Overwrite is true if a file exists at Path and would be replaced.
+	Overwrite bool `json:"overwrite"`
 }
 
 // RawParser is the defining interface of a raw file parser.  Camera-specific parsers
 // shall implement this interface.
+//
+// A RawParser holds no per-file state: ProcessFile may be called
+// concurrently from multiple goroutines, so a single parser may be shared
+// by a batch of files.  Implementations shall preserve this guarantee.
 type RawParser interface {
 	// ProcessFile processes a raw file per the implementation of this parser.
 	// Return a pointer to a RawFile struct or error.
 	ProcessFile(i *RawFileInfo) (r *RawFile, e error)
 
-	// SetHostIsLittleEndian is a function to set the RawParser host's
-	// endianness.
-	// Set to true if host is a little endian machine; false otherwise.
+	// SetHostIsLittleEndian is retained for compatibility; the host's
+	// endianness is detected and does not affect parsing.
+	//
+	// Deprecated: the value is ignored.
 	SetHostIsLittleEndian(b bool)
 
-	// IsLittleEndian is a function to get the value of the specified host
-	// endianness.
+	// IsLittleEndian is a function to get the host endianness.
 	// Returns true if the host is a little endian machine.
 	IsHostLittleEndian() bool
 }
 
 // rawParser is a base implementation of the RawParser interface.
 // It's purpose is to provide common functionality to implentations
-// of the interface.
-type rawParser struct {
-	HostIsLittleEndian bool
-}
+// of the interface.  It is stateless; see RawParser.
+type rawParser struct{}
 
-// SetHostIsLittleEndian is a function to set the host's
-// endianness for the given instance of the RawParser.
-// Set to true if host is a little endian machine; false otherwise.
-func (r *rawParser) SetHostIsLittleEndian(hostIsLe bool) {
-	r.HostIsLittleEndian = hostIsLe
-}
+// SetHostIsLittleEndian does nothing; the host's endianness is detected.
+//
+// Deprecated: the value is ignored.
+func (r *rawParser) SetHostIsLittleEndian(hostIsLe bool) {}
 
-// IsHostLittleEndian is a function to get the host's
-// endianness specified for the given instance of the RawParser.
+// IsHostLittleEndian is a function to get the host's endianness.
 // Returns true if the host is a little endian machine.
 func (r rawParser) IsHostLittleEndian() bool {
-	return r.HostIsLittleEndian
+	return hostIsLittleEndian()
+}
+
+// Capabilities returns the operations supported by the built-in parsers:
+// the embedded preview is extracted, and the raw image data is decoded if
+// a RawDecoder is registered.
+func (r rawParser) Capabilities() Capabilities {
+	return Capabilities{PreviewExtraction: true, RawDecode: registeredRawDecoder() != nil}
 }
 
 // RawParsers is a structure containing a mapping
@@ -140,10 +562,222 @@ func (p *RawParsers) DeleteParser(key string) {
 	delete(p.parserMap, key)
 }
 
-// parseDateTime converts a TIFF-based date/time string into a time.Time.
+var (
+	// ErrExtractionFailed is returned by ProcessFile when the metadata was
+	// parsed but the embedded JPEG could not be extracted.  The returned
+	// RawFile is populated; see RawFile.Extraction for details.
+	ErrExtractionFailed = errors.New("jpeg extraction failed")
+
+	// ErrNoPreview is reported when a raw file contains no embedded JPEG.
+	ErrNoPreview = errors.New("no embedded jpeg found")
+
+	// ErrNoCreateDate is reported as a warning when a raw file records
+	// no create date.  See RawFile.Warnings.
+	ErrNoCreateDate = errors.New("no create date recorded")
+
+	// ErrUnsafeOutputPath is reported when the path of an extracted preview
+	// is a symbolic link, which could redirect the write outside DestDir.
+	ErrUnsafeOutputPath = errors.New("unsafe output path")
+)
+
+// NewRawFileInfoFromFd creates a RawFileInfo for an already-open file
+// descriptor, e.g., one received over a Unix domain socket.  The name is
+// used to name the raw file and the extracted JPEG.  The caller retains
+// ownership of the descriptor and must close it after processing.
+// Returns a pointer to the RawFileInfo or error if fd is invalid.
+func NewRawFileInfoFromFd(fd uintptr, name, destDir string, quality int) (*RawFileInfo, error) {
+	f := os.NewFile(fd, name)
+	if f == nil {
+		return nil, fmt.Errorf("invalid file descriptor: %d", fd)
+	}
+	return &RawFileInfo{File: name, DestDir: destDir, Quality: quality, Handle: f}, nil
+}
+
+// completeRawFile extracts the embedded jpeg, unless skipped, and populates
+// the RawFile.  The metadata is populated regardless of the outcome of the
+// extraction, which is recorded in RawFile.Extraction.
+// Returns the first recoverable problem processing the IFDs, unless
+// info.Lenient is set; an error wrapping ErrExtractionFailed if the
+// extraction failed; nil otherwise.
+func completeRawFile(r *RawFile, info *RawFileInfo, f *rawSource, j *jpegInfo, m *rawMetadata) error {
+	if len(m.warnings) > 0 && !info.Lenient {
+		return m.warnings[0]
+	}
+
+	ex := new(ExtractionResult)
+
+	switch {
+	case info.SkipExtraction:
+		ex.Skipped = true
+	case j.length <= 0:
+		ex.Err = fmt.Errorf("%w: invalid jpeg length: %d", ErrNoPreview, j.length)
+	}
+
+	fillRawFile(r, info, f, j, m)
+
+	r.Timings.Parse = time.Since(f.opened)
+	if !ex.Skipped && ex.Err == nil {
+		// the output path may depend on the metadata
+		jpegPath, resolution, err := r.outputPath(f, info)
+		ex.NameResolution = resolution
+		if err == nil {
+			err = ex.extractPreview(f, j, jpegPath, info, r.previewSpace(info), r.previewExif(f, info), &r.Timings)
+		}
+		ex.Err = err
+		r.setPreview(j)
+	}
+
+	r.JpegPath = ex.JpegPath
+	r.Extraction = ex
+	r.setJpegBytes()
+	fillChecksums(r, info, f)
+	fillHistogram(r, info, f)
+	r.ReadStats = f.stats()
+
+	if ex.Err != nil {
+		return fmt.Errorf("%w: %w", ErrExtractionFailed, ex.Err)
+	}
+	info.Cache.store(f, info, r)
+
+	log.Printf("========= Processed file %s\n", info.File)
+
+	return nil
+}
+
+// fillCreateDate resolves the CreateDate of a RawFile from the date tags,
+// falling back to the modification time of the raw file if none is
+// recorded, and applies the DatePolicy.
+func fillCreateDate(r *RawFile, info *RawFileInfo, f *rawSource, m *rawMetadata) {
+	if m.datesSkipped {
+		m.warn(ErrNoCreateDate)
+		return
+	}
+
+	createDate, source, err := m.dates.createDate(info.DefaultLocation)
+	switch {
+	case err != nil:
+		m.warn(fmt.Errorf("parsing create date: %w", err))
+		createDate, source = time.Time{}, DateSourceNone
+	case createDate.IsZero():
+		m.warn(ErrNoCreateDate)
+	}
+
+	if createDate.IsZero() {
+		if mt := modTime(f); !mt.IsZero() {
+			createDate, source = mt, DateSourceModTime
+		}
+	}
+
+	r.CreateDate, r.DateSuspect = applyDatePolicy(info.DatePolicy, createDate, f)
+	if !r.CreateDate.Equal(createDate) {
+		source = DateSourceModTime
+	}
+	r.DateSource = source
+}
+
+// fillRawFile populates a RawFile with the results of processing a raw file,
+// other than the outcome of the extraction.
+func fillRawFile(r *RawFile, info *RawFileInfo, f *rawSource, j *jpegInfo, m *rawMetadata) {
+	r.FileName = f.Name()
+	r.CameraModel = CameraModel{Make: m.make, Model: m.model}
+	fillCreateDate(r, info, f, m)
+	r.Orientation = orientationOf(uint16(j.orientation))
+	r.JpegOrientation = r.Orientation.radians()
+	r.ImageWidth = int(m.imageWidth)
+	r.ImageHeight = int(m.imageHeight)
+	r.TagStats = m.tags.toTagStats(info.CollectUnknownTags)
+	if m.dngVersion[0] > 0 {
+		r.DngVersion = fmt.Sprintf("%d.%d.%d.%d", m.dngVersion[0], m.dngVersion[1], m.dngVersion[2], m.dngVersion[3])
+		r.DngVariant = dngVariantOf(m)
+	}
+
+	r.PhotoID = m.photoID()
+	r.Rating, r.Label, r.Keywords = m.ratings.resolve()
+	r.Lens = m.lens.lens()
+	r.Exposure = m.exposure
+	r.ShutterCount = int(m.shutterCount)
+	r.ImageNumber = int(m.imageNumber)
+	r.SerialNumber = strings.TrimSpace(m.serialNumber)
+	r.Artist, r.Copyright = strings.TrimSpace(m.artist), strings.TrimSpace(m.copyright)
+	r.CompositeImage = m.composite.composite
+	r.CompositeSources = int(m.composite.sources)
+	r.InteropIndex = m.interopIndex
+	r.ColorSpace = colorSpaceOf(m.colorSpace, m.interopIndex)
+	r.Subjects = m.subjects.regions(m.imageWidth, m.imageHeight)
+	r.Images = m.images
+	r.RawImage = m.rawImageInfo()
+	r.Warnings = m.warnings
+	r.Partial = m.partial
+
+	r.setPreview(j)
+}
+
+// setPreview records the location and dimensions of the embedded jpeg.
+func (r *RawFile) setPreview(j *jpegInfo) {
+	r.PreviewWidth = j.width
+	r.PreviewHeight = j.height
+	r.PreviewBytes = max(j.length, 0)
+	r.Panorama = isPanorama(j.width, j.height)
+	r.setImageDimensions(j)
+
+	if j.length > 0 {
+		preview := *j
+		r.preview = &preview
+	}
+}
+
+// setJpegBytes records the size of the extracted preview, if extracted,
+// and its CompressionRatio.  Errors are logged; the size is informative.
+func (r *RawFile) setJpegBytes() {
+	r.JpegBytes, r.CompressionRatio = 0, 0
+	if r.JpegPath == "" {
+		return
+	}
+
+	fi, err := os.Stat(r.JpegPath)
+	if err != nil {
+		log.Printf("Error reading size of '%s': %v\n", r.JpegPath, err)
+		return
+	}
+	r.JpegBytes = fi.Size()
+	if r.JpegBytes > 0 {
+		r.CompressionRatio = float64(3*int64(r.PreviewWidth)*int64(r.PreviewHeight)) / float64(r.JpegBytes)
+	}
+}
+
+// fillChecksums computes the checksums selected by info of the raw file
+// and, if extracted, of the preview.  Errors are logged; the checksums are
+// not required to process a raw file.
+func fillChecksums(r *RawFile, info *RawFileInfo, f *rawSource) {
+	if info.Checksums == 0 {
+		return
+	}
+
+	c, err := checksumRaw(f, info.Checksums)
+	if err != nil {
+		log.Printf("Error computing checksums of '%s': %v\n", r.FileName, err)
+		return
+	}
+	if r.JpegPath != "" {
+		if err := c.checksumPreview(r.JpegPath, info.Checksums); err != nil {
+			log.Printf("Error computing checksums of '%s': %v\n", r.JpegPath, err)
+		}
+	}
+	r.Checksums = c
+}
+
+// parseDateTime converts a TIFF-based date/time string into a time.Time
+// in UTC.
 // Returns a time.Time or error.
 func parseDateTime(s string) (t time.Time, err error) {
-	const format = "02 Jan 06 15:04"
+	return parseDateTimeIn(s, time.UTC)
+}
+
+// parseDateTimeIn converts a TIFF-based date/time string, e.g.,
+// "2010:08:10 12:11:07", into a time.Time in the given location.
+// Returns a time.Time or error.
+func parseDateTimeIn(s string, loc *time.Location) (t time.Time, err error) {
+	const format = "02 Jan 2006 15:04:05"
 
 	split := strings.Split(s, " ")
 	if len(split) != 2 {
@@ -155,13 +789,13 @@ func parseDateTime(s string) (t time.Time, err error) {
 	dateTokens := strings.Split(dateToken, ":")
 	timeTokens := strings.Split(timeToken, ":")
 
-	if len(dateTokens) == 3 && len(timeTokens) == 3 {
+	if len(dateTokens) == 3 && len(timeTokens) == 3 && len(dateTokens[0]) == 4 {
 		montStr, err := toRfc822Date(dateTokens)
 		if err != nil {
 			return t, err
 		}
-		dateStr := dateTokens[2] + " " + montStr + " " + string(dateTokens[0][2]) + string(dateTokens[0][3])
-		t, err = time.Parse(format, dateStr+" "+timeTokens[0]+":"+timeTokens[1])
+		dateStr := dateTokens[2] + " " + montStr + " " + dateTokens[0]
+		t, err = time.ParseInLocation(format, dateStr+" "+timeToken, loc)
 		if err != nil {
 			return t, err
 		}
@@ -219,11 +853,24 @@ func toRfc822Date(dateTokens []string) (string, error) {
 // The input file is the pointer to the raw file and its base name is used
 // as the base of the JPEG files; destDir is the full path
 // to the destination directory containing the JPEG file; and suffix is
-// the remainder of the file name including file extension.
+// the remainder of the file name including file extension.  The name of
+// the raw file may be untrusted (e.g., an upload); only its base name is
+// used, so that the JPEG cannot be written outside destDir.
 // Example:
 //     destDir="/path_to/outputDir"
 //     suffix="_extracted.jpg"
 // Returns fully-qualified path to the JPEG extraced from the raw file.
-func genExtractedJpegName(f *os.File, destDir, suffix string) string {
-	return destDir + filepath.Base(f.Name()) + suffix
+func genExtractedJpegName(f *rawSource, destDir, suffix string) string {
+	return filepath.Join(destDir, safeBaseName(f.Name())+suffix)
+}
+
+// safeBaseName returns the base name of a path, or "raw" if the base name
+// does not name a file within a directory (e.g., "..").
+func safeBaseName(name string) string {
+	// untrusted names may use either separator
+	name = name[strings.LastIndexAny(name, `/\`)+1:]
+	if name == "" || name == "." || name == ".." || !filepath.IsLocal(name) {
+		return "raw"
+	}
+	return name
 }
@@ -24,11 +24,19 @@
 package rawparser
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"io/ioutil"
+	"math"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 	"unsafe"
+
+	"github.com/jeremytorres/rawparser/tiff"
 )
 
 const (
@@ -257,8 +265,8 @@ func TestParseDateTime(t *testing.T) {
 	if e != nil {
 		t.Fatalf("Unexpected error parsing date and time: %v\n", e)
 	} else {
-		const format = "02 Jan 06 15:04"
-		refTime, e := time.Parse(format, "10 Aug 10 12:11")
+		const format = "02 Jan 06 15:04:05"
+		refTime, e := time.Parse(format, "10 Aug 10 12:11:07")
 		if e != nil || !refTime.Equal(parsedTime) {
 			t.Fail()
 		}
@@ -311,7 +319,7 @@ func TestJpegCodec(t *testing.T) {
 	t.Logf("Read %d bytes from file\n", len(data))
 
 	for i := 0; i < 1; i++ {
-		err = decodeAndWriteJpeg(data, 75, TestJpegOutFile)
+		err = decodeAndWriteJpeg(data, 75, JpegOptions{}, TestJpegOutFile)
 		defer os.Remove(TestJpegOutFile)
 		if err != nil {
 			t.Errorf("Error while decode and write jpeg: %v\n", err)
@@ -328,3 +336,279 @@ func TestJpegCodec(t *testing.T) {
 		}
 	}
 }
+
+func TestApplyDatePolicy(t *testing.T) {
+	f, err := os.Open(TestJpegFile)
+	if err != nil {
+		t.Fatalf("Error opening file: %v\n", err)
+	}
+	defer f.Close()
+
+	valid := time.Date(2010, time.August, 10, 12, 11, 7, 0, time.UTC)
+	unset := time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC)
+	future := time.Now().AddDate(50, 0, 0)
+
+	for _, p := range []DatePolicy{DateAccept, DateFlag, DateReplaceWithModTime} {
+		if d, suspect := applyDatePolicy(p, valid, f); !d.Equal(valid) || suspect {
+			t.Errorf("Policy %d: valid date modified: %v %v\n", p, d, suspect)
+		}
+	}
+
+	if d, suspect := applyDatePolicy(DateAccept, unset, f); !d.Equal(unset) || suspect {
+		t.Errorf("DateAccept: unexpected result: %v %v\n", d, suspect)
+	}
+
+	if d, suspect := applyDatePolicy(DateFlag, future, f); !d.Equal(future) || !suspect {
+		t.Errorf("DateFlag: unexpected result: %v %v\n", d, suspect)
+	}
+
+	info, _ := f.Stat()
+	if d, suspect := applyDatePolicy(DateReplaceWithModTime, unset, f); !d.Equal(info.ModTime()) || !suspect {
+		t.Errorf("DateReplaceWithModTime: unexpected result: %v %v\n", d, suspect)
+	}
+}
+
+func TestDateTagsCreateDate(t *testing.T) {
+	// no zone information: UTC or the default location
+	d := dateTags{digitized: "2010:08:10 12:11:07"}
+	c, source, err := d.createDate(nil)
+	if err != nil || !c.Equal(time.Date(2010, time.August, 10, 12, 11, 7, 0, time.UTC)) || source != DateSourceDigitized {
+		t.Errorf("Unexpected UTC create date: %v %v %v\n", c, source, err)
+	}
+
+	loc := time.FixedZone("test", -5*3600)
+	c, _, err = d.createDate(loc)
+	if err != nil || !c.Equal(time.Date(2010, time.August, 10, 12, 11, 7, 0, loc)) {
+		t.Errorf("Unexpected default location create date: %v %v\n", c, err)
+	}
+
+	// offset time and sub-second time
+	d = dateTags{digitized: "2010:08:10 12:11:07", offsetDigitized: "+09:00", subSecDigitized: "59"}
+	c, _, err = d.createDate(loc)
+	want := time.Date(2010, time.August, 10, 3, 11, 7, 590000000, time.UTC)
+	if err != nil || !c.Equal(want) {
+		t.Errorf("Unexpected offset create date: %v %v\n", c, err)
+	}
+
+	// GPS timestamp; local time is UTC+02:00
+	d = dateTags{digitized: "2010:08:10 12:11:07", gpsDate: "2010:08:10",
+		gpsTime: [3]float64{10, 11, 5}, hasGpsTime: true}
+	c, _, err = d.createDate(loc)
+	if _, offset := c.Zone(); err != nil || offset != 2*3600 {
+		t.Errorf("Unexpected GPS create date: %v %v\n", c, err)
+	}
+
+	// fallback to DateTimeOriginal, with its offset and sub-second time
+	d = dateTags{original: "2010:08:10 12:11:07", dateTime: "2011:01:01 00:00:00",
+		offsetOriginal: "+09:00", subSecOriginal: "5", subSecDigitized: "99"}
+	c, source, err = d.createDate(nil)
+	want = time.Date(2010, time.August, 10, 3, 11, 7, 500000000, time.UTC)
+	if err != nil || !c.Equal(want) || source != DateSourceOriginal {
+		t.Errorf("Unexpected original create date: %v %v %v\n", c, source, err)
+	}
+
+	// fallback to the TIFF DateTime
+	d = dateTags{dateTime: "2011:01:01 10:00:00", gpsDate: "2011:01:01",
+		gpsTime: [3]float64{9, 0, 0}, hasGpsTime: true}
+	c, source, err = d.createDate(nil)
+	want = time.Date(2011, time.January, 1, 9, 0, 0, 0, time.UTC)
+	if err != nil || !c.Equal(want) || source != DateSourceDateTime {
+		t.Errorf("Unexpected DateTime create date: %v %v %v\n", c, source, err)
+	}
+
+	// missing date
+	d = dateTags{}
+	if c, source, err = d.createDate(nil); err != nil || !c.IsZero() || source != DateSourceNone {
+		t.Errorf("Unexpected missing create date: %v %v %v\n", c, source, err)
+	}
+}
+
+func TestDateSourceString(t *testing.T) {
+	tests := []struct {
+		source DateSource
+		want   string
+	}{
+		{DateSourceNone, ""},
+		{DateSourceDigitized, "dateTimeDigitized"},
+		{DateSourceOriginal, "dateTimeOriginal"},
+		{DateSourceDateTime, "dateTime"},
+		{DateSourceModTime, "modTime"},
+		{DateSource(42), "DateSource(42)"},
+	}
+	for _, test := range tests {
+		if got := test.source.String(); got != test.want {
+			t.Errorf("Unexpected name of %d: %q\n", int(test.source), got)
+		}
+	}
+}
+
+func TestProcessFileDateFallback(t *testing.T) {
+	// IFD0 DateTime only
+	tt := newTestTiff(false)
+	preview := testJpeg(t, 160, 120)
+	ifd0 := tt.addIfd(0,
+		asciiEntry(0x0132, "2012:03:04 05:06:07"),
+		longEntry(0x0201, tt.addBlob(preview)),
+		longEntry(0x0202, uint32(len(preview))))
+	path, _ := writeTestFile(t, "datetime.NEF", tt.bytes(ifd0))
+
+	p, _ := NewNefParser(isHostLittleEndian())
+	r, err := p.ProcessFile(&RawFileInfo{File: path, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if !r.CreateDate.Equal(time.Date(2012, time.March, 4, 5, 6, 7, 0, time.UTC)) || r.DateSource != DateSourceDateTime {
+		t.Errorf("Unexpected create date: %v %v\n", r.CreateDate, r.DateSource)
+	}
+
+	// no date recorded: the modification time
+	tt = newTestTiff(false)
+	ifd0 = tt.addIfd(0,
+		longEntry(0x0201, tt.addBlob(preview)),
+		longEntry(0x0202, uint32(len(preview))))
+	path, _ = writeTestFile(t, "nodate.NEF", tt.bytes(ifd0))
+	mtime := time.Date(2015, time.June, 7, 8, 9, 10, 0, time.UTC)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	r, err = p.ProcessFile(&RawFileInfo{File: path, SkipExtraction: true, Lenient: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if !r.CreateDate.Equal(mtime) || r.DateSource != DateSourceModTime {
+		t.Errorf("Unexpected create date: %v %v\n", r.CreateDate, r.DateSource)
+	}
+	if len(r.Warnings) != 1 || !errors.Is(r.Warnings[0], ErrNoCreateDate) {
+		t.Errorf("Unexpected warnings: %v\n", r.Warnings)
+	}
+
+	data, _ := json.Marshal(r)
+	if !strings.Contains(string(data), `"dateSource":"modTime"`) {
+		t.Errorf("Unexpected JSON: %s\n", data)
+	}
+}
+
+func TestParseOffsetTime(t *testing.T) {
+	loc, err := parseOffsetTime("-03:30")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if _, offset := time.Date(2010, 1, 1, 0, 0, 0, 0, loc).Zone(); offset != -(3*3600 + 30*60) {
+		t.Errorf("Unexpected offset: %d\n", offset)
+	}
+
+	for _, s := range []string{"", "09:00", "+9:00", "+AA:00", "+15:00"} {
+		if _, err := parseOffsetTime(s); err == nil {
+			t.Errorf("Expected error for offset time '%s'\n", s)
+		}
+	}
+}
+
+func TestRawFileMarshalJSON(t *testing.T) {
+	r := RawFile{
+		CreateDate:      time.Date(2013, time.July, 6, 14, 29, 40, 810000000, time.FixedZone("", -4*3600)),
+		FileName:        "a.NEF",
+		JpegOrientation: 270 * math.Pi / 180,
+		PreviewWidth:    4256,
+		TagStats:        TagStats{Parsed: 3, Recognized: 2, Unknown: 1},
+		Extraction:      &ExtractionResult{Err: ErrNoPreview},
+	}
+
+	data, err := json.Marshal(&r)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	var out map[string]any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Invalid JSON %s: %v\n", data, err)
+	}
+	if out["createDate"] != "2013-07-06T14:29:40.81-04:00" ||
+		out["orientation"] != OrientationRotate270 ||
+		out["fileName"] != "a.NEF" || out["previewWidth"] != 4256.0 {
+		t.Errorf("Unexpected JSON: %s\n", data)
+	}
+	if _, ok := out["dngVariant"]; ok {
+		t.Errorf("Unexpected DNG variant: %s\n", data)
+	}
+	if ex := out["extraction"].(map[string]any); ex["error"] != ErrNoPreview.Error() {
+		t.Errorf("Unexpected extraction: %s\n", data)
+	}
+
+	// zero dates are omitted
+	data, _ = json.Marshal(RawFile{DngVersion: "1.4.0.0", DngVariant: DngDji})
+	if string(data) != `{"orientation":"normal","dngVariant":"DJI","fileName":"","imageWidth":0,"imageHeight":0,"previewWidth":0,"previewHeight":0,"dateSuspect":false,"dngVersion":"1.4.0.0","tagStats":{"parsed":0,"recognized":0,"unknown":0},"panorama":false}` {
+		t.Errorf("Unexpected JSON: %s\n", data)
+	}
+}
+
+func TestGenExtractedJpegName(t *testing.T) {
+	dest := filepath.Join("out", "previews")
+	tests := []struct {
+		name, want string
+	}{
+		{"DSC_0001.NEF", "DSC_0001.NEF_extracted.jpg"},
+		{"/shoot/DSC_0001.NEF", "DSC_0001.NEF_extracted.jpg"},
+		{"../../etc/passwd", "passwd_extracted.jpg"},
+		{`..\..\evil.NEF`, "evil.NEF_extracted.jpg"},
+		{"..", "raw_extracted.jpg"},
+		{"/", "raw_extracted.jpg"},
+		{"", "raw_extracted.jpg"},
+	}
+
+	for _, tt := range tests {
+		got := genExtractedJpegName(&rawSource{name: tt.name}, dest, "_extracted.jpg")
+		if want := filepath.Join(dest, tt.want); got != want {
+			t.Errorf("%q: expected %s; got %s\n", tt.name, want, got)
+		}
+	}
+
+	// with or without a trailing separator
+	for _, dir := range []string{dest, dest + string(os.PathSeparator)} {
+		if got := genExtractedJpegName(&rawSource{name: "a.NEF"}, dir, ".jpg"); filepath.Dir(got) != dest {
+			t.Errorf("%q: unexpected directory of %s\n", dir, got)
+		}
+	}
+}
+
+func TestExifData(t *testing.T) {
+	data, err := ExifData(&RawFileInfo{File: TestCR2File})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	ifds, err := tiff.ReadAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	var exif, gps *tiff.IFD
+	for _, ifd := range ifds {
+		switch ifd.Kind {
+		case tiff.KindExif:
+			exif = ifd
+		case tiff.KindGPS:
+			gps = ifd
+		case tiff.KindMain:
+			if ifd.Find(0x0111) != nil || ifd.Find(0x0201) != nil {
+				t.Errorf("Unexpected image data entries in %s%d\n", ifd.Kind, ifd.Index)
+			}
+		}
+	}
+	if exif == nil || gps == nil {
+		t.Fatalf("Unexpected IFDs: %+v\n", ifds)
+	}
+	if v, err := exif.Find(0x9003).ASCII(); err != nil || v != "2009:03:07 18:28:10" {
+		t.Errorf("Unexpected DateTimeOriginal: %q, %v\n", v, err)
+	}
+	if exif.Find(0x927c) != nil {
+		t.Error("Unexpected maker note")
+	}
+	if v, err := ifds[0].Find(0x010f).ASCII(); err != nil || v != "Canon" {
+		t.Errorf("Unexpected make: %q, %v\n", v, err)
+	}
+
+	if _, err := ExifData(&RawFileInfo{File: "test_files/COPYRIGHT.txt"}); !errors.Is(err, tiff.ErrInvalidHeader) {
+		t.Errorf("Expected tiff.ErrInvalidHeader; got %v\n", err)
+	}
+}
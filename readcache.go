@@ -0,0 +1,120 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import "io"
+
+const (
+	// readCacheBlockSize is the size, in bytes, of a block of the read
+	// cache.  Metadata values are small and tend to be clustered near the
+	// IFDs referencing them.
+	readCacheBlockSize = 4096
+
+	// readCacheBlocks is the number of blocks retained by the read cache.
+	readCacheBlocks = 16
+)
+
+// cacheBlock is a block of a file retained by the readCache.
+type cacheBlock struct {
+	offset int64
+	data   []byte
+	used   uint64
+}
+
+// readCache is an io.ReaderAt caching the blocks of a file read while
+// parsing metadata, reducing the many small reads of IFD entries and their
+// values to a few block-sized reads.  Reads larger than a block (e.g., the
+// embedded JPEG) bypass the cache.
+// A readCache is not safe for concurrent use.
+type readCache struct {
+	r      io.ReaderAt
+	blocks []*cacheBlock
+	clock  uint64
+}
+
+// newReadCache creates a read cache for a file.
+func newReadCache(r io.ReaderAt) *readCache {
+	return &readCache{r: r, blocks: make([]*cacheBlock, 0, readCacheBlocks)}
+}
+
+// ReadAt implements io.ReaderAt.
+func (c *readCache) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) > readCacheBlockSize || off < 0 {
+		return c.r.ReadAt(p, off)
+	}
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		b, err := c.block(pos - pos%readCacheBlockSize)
+		start := int(pos - b.offset)
+		if start >= len(b.data) {
+			if err == nil {
+				err = io.EOF
+			}
+			return n, err
+		}
+		n += copy(p[n:], b.data[start:])
+	}
+	return n, nil
+}
+
+// block returns the cached block at an offset, reading it if necessary.
+// The least recently used block is evicted when the cache is full.
+// Returns the block and the error, if any, of a short read.
+func (c *readCache) block(offset int64) (*cacheBlock, error) {
+	c.clock++
+
+	for _, b := range c.blocks {
+		if b.offset == offset {
+			b.used = c.clock
+			return b, nil
+		}
+	}
+
+	var b *cacheBlock
+	if len(c.blocks) < readCacheBlocks {
+		b = &cacheBlock{data: make([]byte, readCacheBlockSize)}
+		c.blocks = append(c.blocks, b)
+	} else {
+		b = c.blocks[0]
+		for _, lru := range c.blocks[1:] {
+			if lru.used < b.used {
+				b = lru
+			}
+		}
+		b.data = b.data[:readCacheBlockSize]
+	}
+
+	n, err := c.r.ReadAt(b.data, offset)
+	b.offset, b.data, b.used = offset, b.data[:n], c.clock
+	switch {
+	case n == readCacheBlockSize:
+		err = nil
+	case err != io.EOF:
+		// do not retain a block that failed to read
+		b.offset = -1
+	}
+	return b, err
+}
@@ -0,0 +1,148 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// countingReader counts the reads of an io.ReaderAt.
+type countingReader struct {
+	r     io.ReaderAt
+	reads int
+}
+
+func (c *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	c.reads++
+	return c.r.ReadAt(p, off)
+}
+
+func TestReadCache(t *testing.T) {
+	data := make([]byte, 3*readCacheBlockSize+100)
+	rnd := rand.New(rand.NewSource(1))
+	rnd.Read(data)
+	c := newReadCache(bytes.NewReader(data))
+
+	for i := 0; i < 1000; i++ {
+		off := rnd.Int63n(int64(len(data)) + 10)
+		p := make([]byte, rnd.Intn(2*readCacheBlockSize))
+		q := make([]byte, len(p))
+
+		n, err := c.ReadAt(p, off)
+		en, eerr := bytes.NewReader(data).ReadAt(q, off)
+		if n != en || (err == nil) != (eerr == nil) || !bytes.Equal(p[:n], q[:en]) {
+			t.Fatalf("ReadAt(%d, %d) = %d, %v; expected %d, %v\n",
+				len(p), off, n, err, en, eerr)
+		}
+	}
+}
+
+func TestReadCacheIfdReads(t *testing.T) {
+	f, err := os.Open(TestNefFile)
+	if err != nil {
+		t.Fatalf("Error opening %s: %v\n", TestNefFile, err)
+	}
+	defer f.Close()
+
+	p, _ := NewNefParser(isHostLittleEndian())
+	n := p.(*NefParser)
+	h, err := n.processHeader(f)
+	if err != nil {
+		t.Fatalf("Error processing header: %v\n", err)
+	}
+
+	direct := &countingReader{r: f}
+	j, m, err := n.processIfds(direct, h)
+	if err != nil {
+		t.Fatalf("Error processing IFDs: %v\n", err)
+	}
+
+	cached := &countingReader{r: f}
+	cj, cm, err := n.processIfds(newReadCache(cached), h)
+	if err != nil {
+		t.Fatalf("Error processing cached IFDs: %v\n", err)
+	}
+
+	if j.offset != cj.offset || j.length != cj.length || m.imageWidth != cm.imageWidth {
+		t.Errorf("Cached parse differs: %+v %+v\n", j, cj)
+	}
+	if cached.reads >= direct.reads {
+		t.Errorf("Expected fewer reads with cache: %d; without: %d\n", cached.reads, direct.reads)
+	}
+	t.Logf("reads without cache: %d; with cache: %d\n", direct.reads, cached.reads)
+}
+
+func TestProcessIfdTruncated(t *testing.T) {
+	tt := newTestTiff(true)
+	ifd := tt.addIfd(0, shortEntry(0x0103, 6), longEntry(0x0201, 8), longEntry(0x0202, 10))
+	data := tt.bytes(ifd)
+
+	// truncated within the last entry
+	end := int(ifd) + 2 + 2*12 + 5
+	entries, err := processIfd(isHostLittleEndian(), true, int64(ifd), bytes.NewReader(data[:end]))
+	if err == nil || entries.Len() != 2 {
+		t.Errorf("Expected error after 2 entries; got %d entries, %v\n", entries.Len(), err)
+	}
+
+	// missing next IFD offset is tolerated
+	end = int(ifd) + 2 + 3*12
+	entries, next, err := processIfdWithNext(isHostLittleEndian(), true, int64(ifd), bytes.NewReader(data[:end]))
+	if err != nil || entries.Len() != 3 || next != 0 {
+		t.Errorf("Unexpected result: %d entries, next %d, %v\n", entries.Len(), next, err)
+	}
+}
+
+func TestReadStats(t *testing.T) {
+	p, _ := NewNefParser(isHostLittleEndian())
+	fi, err := os.Stat(TestNefFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	// the header, IFDs, and values are read in a few blocks
+	r, err := p.ProcessFile(&RawFileInfo{File: TestNefFile, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	meta := r.ReadStats
+	if meta.ReadCalls == 0 || meta.ReadCalls > 4 || meta.BytesRead > 4*readCacheBlockSize {
+		t.Errorf("Unexpected reads parsing the metadata: %+v\n", meta)
+	}
+
+	// extraction adds a single read of the preview
+	if _, err := r.Extract(&RawFileInfo{DestDir: t.TempDir() + string(os.PathSeparator), Quality: 50}); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	want := ReadStats{meta.ReadCalls + 1, meta.BytesRead + r.preview.length}
+	if r.ReadStats != want {
+		t.Errorf("Expected %+v; got %+v\n", want, r.ReadStats)
+	}
+	if r.ReadStats.BytesRead >= fi.Size()/10 {
+		t.Errorf("Expected a partial read of %d bytes; got %+v\n", fi.Size(), r.ReadStats)
+	}
+}
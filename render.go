@@ -0,0 +1,190 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"log"
+	"math"
+)
+
+// ErrRenderOptions is returned by DecodeRaw and Develop for RenderOptions
+// out of range.
+var ErrRenderOptions = errors.New("invalid render options")
+
+// Exposure compensation, in stops, supported by the RawDecoders: from a
+// quarter to 8 times the exposure of the raw image data.
+const (
+	MinExposureStops = -2
+	MaxExposureStops = 3
+)
+
+// HighlightMode is the handling of the highlights clipped by the sensor in
+// a developed image.
+type HighlightMode int
+
+const (
+	// HighlightClip clips the highlights to white.  This is the default.
+	HighlightClip HighlightMode = iota
+
+	// HighlightBlend blends the clipped channels with those that are not,
+	// recovering highlight detail with neutral colors.
+	HighlightBlend
+)
+
+// String returns the name of the highlight mode.
+func (h HighlightMode) String() string {
+	switch h {
+	case HighlightClip:
+		return "clip"
+	case HighlightBlend:
+		return "blend"
+	}
+	return fmt.Sprintf("HighlightMode(%d)", int(h))
+}
+
+// RenderFormat is the image format of a developed image written by
+// Develop.
+type RenderFormat int
+
+const (
+	// RenderPNG writes a PNG.  This is the default.
+	RenderPNG RenderFormat = iota
+
+	// RenderTIFF writes an uncompressed RGB TIFF with an sRGB ICC profile
+	// and the EXIF metadata of the raw file.
+	RenderTIFF
+)
+
+// String returns the name of the render format.
+func (f RenderFormat) String() string {
+	switch f {
+	case RenderPNG:
+		return "png"
+	case RenderTIFF:
+		return "tiff"
+	}
+	return fmt.Sprintf("RenderFormat(%d)", int(f))
+}
+
+// RenderOptions are the options of the image developed from the raw image
+// data by DecodeRaw and Develop.  They are applied by the RawDecoder to the
+// raw image data, e.g., by libraw.  The zero value develops an 8-bit PNG
+// without exposure compensation and with clipped highlights.
+type RenderOptions struct {
+	// ExposureStops is the exposure compensation, in stops, from
+	// MinExposureStops to MaxExposureStops, e.g., to develop a batch of
+	// underexposed photos.
+	ExposureStops float64
+
+	// Highlights is the handling of the clipped highlights.  Defaults to
+	// HighlightClip.
+	Highlights HighlightMode
+
+	// BitDepth is the number of bits, 8 or 16, of the samples of the
+	// developed image.  Defaults to 8.
+	BitDepth int
+
+	// Format is the image format written by Develop.  Defaults to
+	// RenderPNG.
+	Format RenderFormat
+}
+
+// validate checks the options are in range.
+// Returns error wrapping ErrRenderOptions if not.
+func (o RenderOptions) validate() error {
+	switch {
+	case math.IsNaN(o.ExposureStops) || o.ExposureStops < MinExposureStops || o.ExposureStops > MaxExposureStops:
+		return fmt.Errorf("%w: exposure of %g stops", ErrRenderOptions, o.ExposureStops)
+	case o.Highlights != HighlightClip && o.Highlights != HighlightBlend:
+		return fmt.Errorf("%w: %v", ErrRenderOptions, o.Highlights)
+	case o.BitDepth != 0 && o.BitDepth != 8 && o.BitDepth != 16:
+		return fmt.Errorf("%w: bit depth %d", ErrRenderOptions, o.BitDepth)
+	case o.Format != RenderPNG && o.Format != RenderTIFF:
+		return fmt.Errorf("%w: %v", ErrRenderOptions, o.Format)
+	}
+	return nil
+}
+
+// bitDepth returns the BitDepth, 8 if not set.
+func (o RenderOptions) bitDepth() int {
+	if o.BitDepth == 0 {
+		return 8
+	}
+	return o.BitDepth
+}
+
+// exposureScale returns the linear scale of the ExposureStops, e.g., 2 for
+// +1 stop.
+func (o RenderOptions) exposureScale() float64 {
+	return math.Exp2(o.ExposureStops)
+}
+
+// Develop develops the raw image data of a raw file by DecodeRaw and writes
+// it to w in the Format and BitDepth of RawFileInfo.Render, e.g., to develop
+// a batch of raw files.  A TIFF holds the EXIF metadata of a TIFF-based raw
+// file; see EncodeTIFF.
+// Returns error; ErrRawDecodeUnsupported if no RawDecoder is registered.
+func Develop(info *RawFileInfo, w io.Writer) error {
+	img, err := DecodeRaw(info)
+	if err != nil {
+		return err
+	}
+
+	if info.Render.Format == RenderTIFF {
+		exif, err := ExifData(info)
+		if err != nil {
+			log.Printf("Developing '%s' without EXIF metadata: %v\n", info.File, err)
+			exif = nil
+		}
+		return EncodeTIFF(w, img, info.Render.bitDepth(), exif)
+	}
+	return encodePNG(w, img, info.Render.bitDepth())
+}
+
+// encodePNG encodes a developed image as a PNG of a bit depth, 8 or 16.
+// Returns error.
+func encodePNG(w io.Writer, img image.Image, bitDepth int) error {
+	return png.Encode(w, convertDepth(img, bitDepth))
+}
+
+// convertDepth converts an image to an RGBA image of a bit depth: an
+// *image.RGBA64 of 16 bits, or an *image.RGBA otherwise.
+// Returns the image, with its bounds at the origin.
+func convertDepth(img image.Image, bitDepth int) draw.Image {
+	b := img.Bounds()
+	var dst draw.Image
+	if bitDepth == 16 {
+		dst = image.NewRGBA64(image.Rect(0, 0, b.Dx(), b.Dy()))
+	} else {
+		dst = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	}
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
@@ -0,0 +1,144 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// renderDecoder is a RawDecoder recording the RenderOptions and developing
+// a 3x2 image of the BitDepth.
+type renderDecoder struct {
+	opts RenderOptions
+}
+
+func (d *renderDecoder) DecodeRaw(info *RawFileInfo) (image.Image, error) {
+	d.opts = info.Render
+	if info.Render.BitDepth == 16 {
+		img := image.NewRGBA64(image.Rect(0, 0, 3, 2))
+		img.SetRGBA64(1, 0, color.RGBA64{0x1234, 0x5678, 0x9abc, 0xffff})
+		return img, nil
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.SetRGBA(1, 0, color.RGBA{0x12, 0x56, 0x9a, 0xff})
+	return img, nil
+}
+
+func TestRenderOptions(t *testing.T) {
+	saved := registeredRawDecoder()
+	defer RegisterRawDecoder(saved)
+	d := new(renderDecoder)
+	RegisterRawDecoder(d)
+
+	invalid := []RenderOptions{
+		{ExposureStops: 3.5},
+		{ExposureStops: math.NaN()},
+		{Highlights: HighlightMode(7)},
+		{BitDepth: 12},
+		{Format: RenderFormat(3)},
+	}
+	for _, o := range invalid {
+		if _, err := DecodeRaw(&RawFileInfo{File: TestNefFile, Render: o}); !errors.Is(err, ErrRenderOptions) {
+			t.Errorf("Expected ErrRenderOptions for %+v; got %v\n", o, err)
+		}
+	}
+
+	opts := RenderOptions{ExposureStops: 1, Highlights: HighlightBlend, BitDepth: 16}
+	var buf bytes.Buffer
+	if err := Develop(&RawFileInfo{File: TestNefFile, Render: opts}, &buf); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if d.opts != opts || opts.exposureScale() != 2 {
+		t.Errorf("Unexpected options %+v\n", d.opts)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected error decoding png: %v\n", err)
+	}
+	if c := color.RGBA64Model.Convert(img.At(1, 0)); c != (color.RGBA64{0x1234, 0x5678, 0x9abc, 0xffff}) {
+		t.Errorf("Unexpected 16-bit pixel %v\n", c)
+	}
+}
+
+func TestDevelopTiff(t *testing.T) {
+	saved := registeredRawDecoder()
+	defer RegisterRawDecoder(saved)
+	RegisterRawDecoder(new(renderDecoder))
+
+	tests := []struct {
+		bitDepth int
+		pixel    []byte
+	}{
+		{8, []byte{0x12, 0x56, 0x9a}},
+		{16, []byte{0x34, 0x12, 0x78, 0x56, 0xbc, 0x9a}},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		info := &RawFileInfo{File: TestNefFile, Render: RenderOptions{BitDepth: test.bitDepth, Format: RenderTIFF}}
+		if err := Develop(info, &buf); err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+
+		r := bytes.NewReader(buf.Bytes())
+		h, err := tiff.ReadHeader(r)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		ifd, err := tiff.ReadIFD(r, h.ByteOrder, h.Offset)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		bits, _ := ifd.Find(0x0102).Uints()
+		offset, _ := ifd.Find(0x0111).Uint()
+		length, _ := ifd.Find(0x0117).Uint()
+		if len(bits) != 3 || int(bits[0]) != test.bitDepth || int(length) != 3*2*len(test.pixel) ||
+			int(offset+length) != buf.Len() || h.ByteOrder != binary.LittleEndian {
+			t.Fatalf("Unexpected %d-bit tiff: bits %v, strip of %d bytes at %d\n", test.bitDepth, bits, length, offset)
+		}
+		if pixel := buf.Bytes()[int(offset)+len(test.pixel):][:len(test.pixel)]; !bytes.Equal(pixel, test.pixel) {
+			t.Errorf("Unexpected %d-bit pixel %x\n", test.bitDepth, pixel)
+		}
+
+		// the metadata of the NEF, upright, with the sRGB profile
+		if o, _ := ifd.Find(0x0112).Uint(); o != uint32(Horizontal) {
+			t.Errorf("Unexpected orientation %d\n", o)
+		}
+		if camera, _ := ifd.Find(0x010f).ASCII(); camera != "NIKON CORPORATION" || ifd.Find(0x8769) == nil {
+			t.Errorf("Expected the EXIF metadata of the NEF; got make %q\n", camera)
+		}
+		icc, err := ifd.Find(0x8773).Bytes()
+		if err != nil || len(icc) < 128 || binary.BigEndian.Uint32(icc) != uint32(len(icc)) || string(icc[36:40]) != "acsp" {
+			t.Errorf("Unexpected ICC profile: %v\n", err)
+		}
+	}
+}
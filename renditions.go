@@ -0,0 +1,210 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Rendition is the embedded preview of a raw file in one of the sizes
+// requested of Renditions or WriteRenditions.
+type Rendition struct {
+	// Size is the requested long edge, in pixels; 0 for the full size.
+	Size int
+
+	// Width and Height are the dimensions, in pixels, of the rendition.
+	// Renditions are never enlarged.
+	Width  int
+	Height int
+
+	// Path is the file the rendition was written to by WriteRenditions.
+	Path string
+
+	// Data are the encoded bytes of the rendition returned by Renditions.
+	Data []byte
+}
+
+// Renditions encodes the embedded jpeg of a parsed raw file in several
+// sizes, the long edges in pixels or 0 for the full size, from a single
+// decode of the preview; e.g., for the thumbnails of a gallery.  Each
+// rendition is encoded in info.OutputFormat at info.Quality, with EXIF
+// metadata as by info.PreserveExif, cropped as by info.CropAspect, and
+// returned in its Data.  The raw file is opened as by Extract and is not
+// re-parsed.  The preview dimensions of the RawFile are updated.  A
+// preview exceeding info.MaxPreviewMemory is not decoded.
+// Returns the renditions, in the order of sizes, or an error wrapping
+// ErrExtractionFailed.
+func (r *RawFile) Renditions(info *RawFileInfo, sizes ...int) ([]Rendition, error) {
+	out, err := renditions(r, info, sizes, false)
+	if err != nil {
+		return out, fmt.Errorf("%w: %w", ErrExtractionFailed, err)
+	}
+	return out, nil
+}
+
+// WriteRenditions is as Renditions but writes each rendition to
+// info.DestDir, named after the raw file and the size, e.g.,
+// "DSC_0001.NEF_1024.jpg", or "DSC_0001.NEF_extracted.jpg" for the full
+// size, and returns its Path.
+// Returns the renditions written, in the order of sizes, or an error
+// wrapping ErrExtractionFailed.
+func (r *RawFile) WriteRenditions(info *RawFileInfo, sizes ...int) ([]Rendition, error) {
+	out, err := renditions(r, info, sizes, true)
+	if err != nil {
+		return out, fmt.Errorf("%w: %w", ErrExtractionFailed, err)
+	}
+	return out, nil
+}
+
+// renditions decodes the embedded preview of a parsed raw file once and
+// encodes it in each of the sizes, written to info.DestDir if write is
+// set.
+// Returns the renditions encoded before any error or error.
+func renditions(r *RawFile, info *RawFileInfo, sizes []int, write bool) ([]Rendition, error) {
+	info = info.withDefaultQuality()
+
+	if r.preview == nil {
+		return nil, ErrNoPreview
+	}
+
+	encode := jpegEncoder(info.Jpeg)
+	if info.OutputFormat != OutputJpeg {
+		var ok bool
+		if encode, ok = outputEncoders[info.OutputFormat]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrOutputFormatUnsupported, info.OutputFormat)
+		}
+	}
+
+	f, err := r.openRawFile(info)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	j := *r.preview
+	if err := checkPreviewMemory(f, &j, info.MaxPreviewMemory); err != nil {
+		return nil, err
+	}
+	data, err := readPreview(f, &j)
+	if err != nil {
+		return nil, err
+	}
+	if j.width, j.height, err = previewDimensions(data); err != nil {
+		return nil, err
+	}
+	r.PreviewWidth, r.PreviewHeight = j.width, j.height
+	r.Panorama = isPanorama(j.width, j.height)
+
+	full := sync.OnceValues(func() (image.Image, error) {
+		return decodeJpeg(data)
+	})
+	exif := r.previewExif(f, info)
+	adobeRGB := isAdobeRGBPreview(data, r.previewSpace(info))
+
+	var out []Rendition
+	for _, size := range sizes {
+		rd := Rendition{Size: size}
+		if write {
+			rd.Path = genExtractedJpegName(f, info.DestDir, renditionSuffix(size, info.OutputFormat))
+			if err := checkOutputPath(rd.Path); err != nil {
+				return out, err
+			}
+		}
+
+		crop := size > 0 && info.CropAspect > 0
+		decodeEdge := size
+		if crop {
+			decodeEdge = cropDecodeEdge(j.width, j.height, size)
+		}
+		img, err := decodeForSize(data, j.width, j.height, decodeEdge, full)
+		if err != nil {
+			return out, err
+		}
+		if crop {
+			img = cropImage(img, smartCrop(img.Bounds(), r.cropAspect(info.CropAspect), r.Subjects))
+		}
+		img = resizeImage(img, size)
+		if adobeRGB {
+			img = adobeRGBToSRGB(img)
+		}
+		b := img.Bounds()
+		rd.Width, rd.Height = b.Dx(), b.Dy()
+
+		var buf bytes.Buffer
+		if err := encodeRendition(&buf, img, len(data), j.width*j.height, info.Quality, encode); err != nil {
+			return out, err
+		}
+		enc := buf.Bytes()
+		if exif != nil {
+			if enc, err = insertExif(enc, exif); err != nil {
+				return out, err
+			}
+		}
+
+		if write {
+			if err := os.WriteFile(rd.Path, enc, 0666); err != nil {
+				os.Remove(rd.Path)
+				return out, err
+			}
+		} else {
+			rd.Data = enc
+		}
+		out = append(out, rd)
+	}
+	r.ReadStats.add(f.stats())
+	return out, nil
+}
+
+// renditionSuffix is the remainder of the file name of a rendition,
+// including the file extension of the output format.
+func renditionSuffix(size int, format OutputFormat) string {
+	if size <= 0 {
+		return format.suffix()
+	}
+	return "_" + strconv.Itoa(size) + strings.TrimPrefix(format.suffix(), "_extracted")
+}
+
+// encodeRendition encodes a rendition, resized from the embedded preview
+// of n bytes and pixels pixels, at a quality.  QualityAuto limits the
+// rendition to the size of the embedded preview scaled by the number of
+// pixels.
+// Returns nil on success or error.
+func encodeRendition(buf *bytes.Buffer, resized image.Image, n, pixels, quality int, encode imageEncoder) error {
+	if quality == QualityAuto {
+		b := resized.Bounds()
+		limit := int(int64(n) * int64(b.Dx()*b.Dy()) / int64(max(pixels, 1)))
+
+		var err error
+		if quality, err = autoQuality(resized, limit, encode); err != nil {
+			return err
+		}
+	}
+	return encode(buf, resized, quality)
+}
@@ -0,0 +1,121 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"errors"
+	"image/jpeg"
+	"path/filepath"
+	"testing"
+)
+
+func TestRawFileRenditions(t *testing.T) {
+	path, dir := writeTestFile(t, "burst.NRW", buildTestNrw(t, true))
+	p, _ := NewNrwParser(isHostLittleEndian())
+
+	r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	out, err := r.Renditions(&RawFileInfo{Quality: 80}, 0, 160, 64, 1024)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	want := [][2]int{{320, 240}, {160, 120}, {64, 48}, {320, 240}}
+	if len(out) != len(want) {
+		t.Fatalf("Unexpected renditions: %d\n", len(out))
+	}
+	for i, rd := range out {
+		img, err := jpeg.Decode(bytes.NewReader(rd.Data))
+		if err != nil {
+			t.Fatalf("Error decoding rendition %d: %v\n", rd.Size, err)
+		}
+		b := img.Bounds()
+		if b.Dx() != want[i][0] || b.Dy() != want[i][1] || rd.Width != b.Dx() || rd.Height != b.Dy() {
+			t.Errorf("Unexpected rendition %d dimensions: %v; %dx%d\n", rd.Size, b, rd.Width, rd.Height)
+		}
+		if rd.Path != "" {
+			t.Errorf("Unexpected rendition path: %s\n", rd.Path)
+		}
+	}
+	if r.PreviewWidth != 320 || r.PreviewHeight != 240 || r.JpegPath != "" {
+		t.Errorf("Unexpected raw file: %+v\n", r)
+	}
+
+	_, err = r.Renditions(&RawFileInfo{OutputFormat: OutputFormat(99)}, 0)
+	if !errors.Is(err, ErrExtractionFailed) || !errors.Is(err, ErrOutputFormatUnsupported) {
+		t.Errorf("Expected ErrOutputFormatUnsupported; got %v\n", err)
+	}
+	if _, err := new(RawFile).Renditions(&RawFileInfo{}, 0); !errors.Is(err, ErrNoPreview) {
+		t.Errorf("Expected ErrNoPreview; got %v\n", err)
+	}
+}
+
+func TestRawFileWriteRenditions(t *testing.T) {
+	path, dir := writeTestFile(t, "burst.NRW", buildTestNrw(t, true))
+	p, _ := NewNrwParser(isHostLittleEndian())
+
+	r, err := p.ProcessFile(&RawFileInfo{File: path, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	out, err := r.WriteRenditions(&RawFileInfo{DestDir: dir, Quality: QualityAuto, PreserveExif: true}, 0, 100)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	names := []string{"burst.NRW_extracted.jpg", "burst.NRW_100.jpg"}
+	for i, rd := range out {
+		if rd.Path != filepath.Join(dir, names[i]) || rd.Data != nil {
+			t.Errorf("Unexpected rendition: %s\n", rd.Path)
+		}
+		if len(readJpegExif(t, rd.Path)) == 0 {
+			t.Errorf("Expected EXIF metadata in %s\n", rd.Path)
+		}
+	}
+	if len(out) != 2 || out[1].Width != 100 || out[1].Height != 75 {
+		t.Errorf("Unexpected renditions: %+v\n", out)
+	}
+}
+
+func TestRenditionSuffix(t *testing.T) {
+	tests := []struct {
+		size   int
+		format OutputFormat
+		want   string
+	}{
+		{0, OutputJpeg, "_extracted.jpg"},
+		{256, OutputJpeg, "_256.jpg"},
+		{1024, OutputAvif, "_1024.avif"},
+		{0, OutputJxl, "_extracted.jxl"},
+		{512, OutputHeic, "_512.heic"},
+	}
+	for _, tc := range tests {
+		if got := renditionSuffix(tc.size, tc.format); got != tc.want {
+			t.Errorf("Unexpected suffix of %d %s: %s; expected %s\n", tc.size, tc.format, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// ReportFormat is the format of the rows written by a ReportWriter.
+type ReportFormat int
+
+const (
+	// ReportNDJSON writes a JSON object per line.
+	ReportNDJSON ReportFormat = iota
+
+	// ReportCSV writes a CSV record per line, preceded by a header.
+	ReportCSV
+)
+
+// Statuses of a file reported by a ReportWriter.
+const (
+	ReportStatusOK        = "ok"
+	ReportStatusPartial   = "partial" // see RawFile.Partial
+	ReportStatusDuplicate = "duplicate"
+	ReportStatusFailed    = "failed"
+)
+
+// reportColumns are the header of CSV reports.
+var reportColumns = []string{"path", "date", "camera", "status", "jpegPath", "error", "duplicateOf"}
+
+// reportRow is a row of a report; see ReportWriter.
+type reportRow struct {
+	Path        string `json:"path"`
+	Date        string `json:"date,omitempty"`
+	Camera      string `json:"camera,omitempty"`
+	Status      string `json:"status"`
+	JpegPath    string `json:"jpegPath,omitempty"`
+	Error       string `json:"error,omitempty"`
+	DuplicateOf string `json:"duplicateOf,omitempty"`
+}
+
+// ReportWriter writes a row per file of a batch, e.g., as an audit log of a
+// migration: the path of the file, its CreateDate (RFC 3339), camera,
+// status, the path of the extracted preview (for a dry run, the path it
+// would be written to), the error, if any, and the
+// file it duplicates, if any.  The status is one of the ReportStatus
+// constants.  See WithReport.
+//
+// A ReportWriter is not safe for concurrent use.
+type ReportWriter struct {
+	json *json.Encoder
+	csv  *csv.Writer
+	rows int
+
+	// err is the first error writing a row; later rows are not written.
+	err error
+}
+
+// NewReportWriter creates a ReportWriter writing rows to w in a format.
+// Returns the ReportWriter.
+func NewReportWriter(w io.Writer, format ReportFormat) *ReportWriter {
+	rw := new(ReportWriter)
+	switch format {
+	case ReportCSV:
+		rw.csv = csv.NewWriter(w)
+	default:
+		rw.json = json.NewEncoder(w)
+		rw.json.SetEscapeHTML(false)
+	}
+	return rw
+}
+
+// Write writes the row of the result of a file.  CSV rows are buffered; see
+// Flush.  Once a row cannot be written, no further rows are written.
+// Returns nil or the first error writing a row.
+func (rw *ReportWriter) Write(res BatchResult) error {
+	if rw.err != nil {
+		return rw.err
+	}
+	rw.err = rw.write(newReportRow(&res))
+	return rw.err
+}
+
+// write writes a row in the format of the ReportWriter.
+func (rw *ReportWriter) write(row *reportRow) error {
+	rw.rows++
+	if rw.json != nil {
+		return rw.json.Encode(row)
+	}
+
+	if rw.rows == 1 {
+		if err := rw.csv.Write(reportColumns); err != nil {
+			return err
+		}
+	}
+	return rw.csv.Write([]string{row.Path, row.Date, row.Camera, row.Status, row.JpegPath, row.Error, row.DuplicateOf})
+}
+
+// Flush writes any buffered rows.
+// Returns nil or the first error writing a row.
+func (rw *ReportWriter) Flush() error {
+	if rw.csv != nil && rw.err == nil {
+		rw.csv.Flush()
+		rw.err = rw.csv.Error()
+	}
+	return rw.err
+}
+
+// newReportRow creates the row of the result of a file.
+// Returns the row.
+func newReportRow(res *BatchResult) *reportRow {
+	row := &reportRow{Path: res.File, Status: ReportStatusOK}
+	if r := res.RawFile; r != nil {
+		if !r.CreateDate.IsZero() {
+			row.Date = r.CreateDate.Format(time.RFC3339)
+		}
+		row.Camera = r.CameraModel.String()
+		row.JpegPath = r.JpegPath
+		if ex := r.Extraction; ex != nil && ex.Planned != nil {
+			row.JpegPath = ex.Planned.Path
+		}
+		if r.Partial {
+			row.Status = ReportStatusPartial
+		}
+	}
+
+	switch {
+	case res.Err != nil:
+		row.Status = ReportStatusFailed
+		row.Error = res.Err.Error()
+	case res.DuplicateOf != "":
+		row.Status = ReportStatusDuplicate
+		row.DuplicateOf = res.DuplicateOf
+	}
+
+	return row
+}
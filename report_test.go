@@ -0,0 +1,101 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestReportWriterNDJSON(t *testing.T) {
+	a, dir := writeTestFile(t, "a.NRW", buildTestPhoto(t, "id-a", "v1"))
+	b := filepath.Join(dir, "b.NRW")
+	writeFile(t, b, buildTestPhoto(t, "id-a", "v1"))
+	files := []string{a, b, filepath.Join(dir, "missing.NRW")}
+
+	var buf bytes.Buffer
+	rw := NewReportWriter(&buf, ReportNDJSON)
+	results := NewBatchProcessor(dir, 75, WithDedupe(DedupeContent), WithReport(rw)).Process(files)
+	if err := rw.Flush(); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	rows := make(map[string]reportRow)
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var row reportRow
+		if err := dec.Decode(&row); err != nil {
+			t.Fatalf("Unexpected error decoding %s: %v\n", buf.String(), err)
+		}
+		rows[row.Path] = row
+	}
+	if len(rows) != len(files) {
+		t.Fatalf("Expected %d rows; got %+v\n", len(files), rows)
+	}
+	if row := rows[a]; row.Status != ReportStatusOK || row.JpegPath != results[0].RawFile.JpegPath || row.Error != "" {
+		t.Errorf("Unexpected row: %+v\n", row)
+	}
+	if row := rows[b]; row.Status != ReportStatusDuplicate || row.DuplicateOf != a {
+		t.Errorf("Unexpected row: %+v\n", row)
+	}
+	if row := rows[files[2]]; row.Status != ReportStatusFailed || row.Error != results[2].Err.Error() {
+		t.Errorf("Unexpected row: %+v\n", row)
+	}
+}
+
+func TestReportWriterCSV(t *testing.T) {
+	var buf bytes.Buffer
+	rw := NewReportWriter(&buf, ReportCSV)
+	r := &RawFile{CameraModel: CameraModel{Make: "NIKON CORPORATION", Model: "NIKON D700"}, JpegPath: "/out/a.jpg", Partial: true}
+	rw.Write(BatchResult{File: "/in/a.NEF", RawFile: r})
+	rw.Write(BatchResult{File: "/in/b,c.NEF", Err: errors.New("bad \"file\"")})
+	if err := rw.Flush(); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	want := [][]string{
+		reportColumns,
+		{"/in/a.NEF", "", "NIKON D700", ReportStatusPartial, "/out/a.jpg", "", ""},
+		{"/in/b,c.NEF", "", "", ReportStatusFailed, "", "bad \"file\"", ""},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("Expected %d records; got %q\n", len(want), records)
+	}
+	for i := range want {
+		for j := range want[i] {
+			if records[i][j] != want[i][j] {
+				t.Errorf("Record %d: expected %q; got %q\n", i, want[i], records[i])
+				break
+			}
+		}
+	}
+}
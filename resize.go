@@ -0,0 +1,117 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"image"
+	"image/draw"
+	"log"
+)
+
+// decodeScale returns the largest reduction, a power of 2 up to the
+// maxDecodeScale of the JPEG backend, at which a width x height jpeg still
+// has a long edge of at least longEdge pixels.
+// Returns the denominator of the reduction; 1 if longEdge is not positive.
+func decodeScale(width, height, longEdge int) int {
+	denom := 1
+	if longEdge <= 0 {
+		return denom
+	}
+	long := max(width, height)
+	for denom < maxDecodeScale && (long+2*denom-1)/(2*denom) >= longEdge {
+		denom *= 2
+	}
+	return denom
+}
+
+// decodeForSize decodes the embedded jpeg data, of width x height pixels,
+// for a preview whose long edge is at most longEdge pixels: scaled while
+// decoding, if the JPEG backend supports it and the reduction is large
+// enough, or by full otherwise.  A failed scaled decode falls back to full.
+// Returns the decoded image or error.
+func decodeForSize(data []byte, width, height, longEdge int, full func() (image.Image, error)) (image.Image, error) {
+	if denom := decodeScale(width, height, longEdge); denom > 1 {
+		img, err := decodeJpegScaled(data, denom)
+		if err == nil {
+			return img, nil
+		}
+		log.Printf("Error decoding embedded jpeg scaled by 1/%d: %v\n", denom, err)
+	}
+	return full()
+}
+
+// resizeImage downscales an image, preserving its aspect ratio, so that its
+// long edge is at most longEdge pixels.  Each pixel of the result is the
+// average of the pixels it covers (a box filter), which is adequate for the
+// large reductions of thumbnailing.
+// Returns the resized image, or img if it is already small enough or
+// longEdge is not positive.
+func resizeImage(img image.Image, longEdge int) image.Image {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if longEdge <= 0 || (sw <= longEdge && sh <= longEdge) {
+		return img
+	}
+
+	dw, dh := longEdge, sh*longEdge/sw
+	if sh > sw {
+		dw, dh = sw*longEdge/sh, longEdge
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	src, ok := img.(*image.RGBA)
+	if !ok || src.Rect.Min != (image.Point{}) {
+		src = image.NewRGBA(image.Rect(0, 0, sw, sh))
+		draw.Draw(src, src.Rect, img, b.Min, draw.Src)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	sum := make([]uint64, dw*4)
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := dy*sh/dh, (dy+1)*sh/dh
+		clear(sum)
+		for y := y0; y < y1; y++ {
+			row := src.Pix[y*src.Stride:]
+			for dx := 0; dx < dw; dx++ {
+				x0, x1 := dx*sw/dw, (dx+1)*sw/dw
+				p := row[x0*4 : x1*4]
+				for i := 0; i < len(p); i += 4 {
+					sum[dx*4] += uint64(p[i])
+					sum[dx*4+1] += uint64(p[i+1])
+					sum[dx*4+2] += uint64(p[i+2])
+					sum[dx*4+3] += uint64(p[i+3])
+				}
+			}
+		}
+
+		out := dst.Pix[dy*dst.Stride:]
+		for dx := 0; dx < dw; dx++ {
+			n := uint64((y1 - y0) * ((dx+1)*sw/dw - dx*sw/dw))
+			for c := 0; c < 4; c++ {
+				out[dx*4+c] = uint8(sum[dx*4+c] / n)
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,192 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidMessage is returned when decoding a message that is not valid
+// protocol buffers wire format.
+var ErrInvalidMessage = errors.New("invalid protobuf message")
+
+// protocol buffers wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// ParseRequest is the ParseRequest message of rawparser.proto.  Data or
+// Path is set.
+type ParseRequest struct {
+	Data    []byte
+	Path    string
+	Format  string
+	Preview bool
+	Quality int32
+}
+
+// ParseResponse is the ParseResponse message of rawparser.proto.
+type ParseResponse struct {
+	MetadataJSON string
+	Preview      []byte
+}
+
+// MarshalBinary encodes the ParseRequest in protocol buffers wire format.
+// Returns the encoded message or error.
+func (m *ParseRequest) MarshalBinary() ([]byte, error) {
+	var b []byte
+	if m.Data != nil {
+		b = appendBytes(b, 1, m.Data)
+	} else if m.Path != "" {
+		b = appendBytes(b, 2, []byte(m.Path))
+	}
+	if m.Format != "" {
+		b = appendBytes(b, 3, []byte(m.Format))
+	}
+	if m.Preview {
+		b = appendVarint(b, 4, 1)
+	}
+	if m.Quality != 0 {
+		// int32 is sign-extended to 64 bits
+		b = appendVarint(b, 5, uint64(int64(m.Quality)))
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a ParseRequest from protocol buffers wire format.
+// Unknown fields are skipped.
+// Returns nil on success or an error wrapping ErrInvalidMessage.
+func (m *ParseRequest) UnmarshalBinary(b []byte) error {
+	*m = ParseRequest{}
+	return decodeFields(b, func(num int, v uint64, data []byte) {
+		switch num {
+		case 1:
+			m.Data, m.Path = data, ""
+		case 2:
+			m.Path, m.Data = string(data), nil
+		case 3:
+			m.Format = string(data)
+		case 4:
+			m.Preview = v != 0
+		case 5:
+			m.Quality = int32(v)
+		}
+	})
+}
+
+// MarshalBinary encodes the ParseResponse in protocol buffers wire format.
+// Returns the encoded message or error.
+func (m *ParseResponse) MarshalBinary() ([]byte, error) {
+	var b []byte
+	if m.MetadataJSON != "" {
+		b = appendBytes(b, 1, []byte(m.MetadataJSON))
+	}
+	if m.Preview != nil {
+		b = appendBytes(b, 2, m.Preview)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a ParseResponse from protocol buffers wire
+// format.  Unknown fields are skipped.
+// Returns nil on success or an error wrapping ErrInvalidMessage.
+func (m *ParseResponse) UnmarshalBinary(b []byte) error {
+	*m = ParseResponse{}
+	return decodeFields(b, func(num int, _ uint64, data []byte) {
+		switch num {
+		case 1:
+			m.MetadataJSON = string(data)
+		case 2:
+			m.Preview = data
+		}
+	})
+}
+
+// appendVarint appends a varint field.
+func appendVarint(b []byte, num int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+// appendBytes appends a length-delimited field: bytes, a string, or a
+// message.
+func appendBytes(b []byte, num int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// decodeFields decodes the fields of a message, calling field with the
+// number and the value of each varint or length-delimited field; fixed
+// width fields are skipped.  Length-delimited values alias b.
+// Returns nil on success or an error wrapping ErrInvalidMessage.
+func decodeFields(b []byte, field func(num int, v uint64, data []byte)) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return fmt.Errorf("%w: invalid field key", ErrInvalidMessage)
+		}
+		b = b[n:]
+
+		num := int(key >> 3)
+		if num <= 0 || key>>3 > 1<<29-1 {
+			return fmt.Errorf("%w: invalid field number %d", ErrInvalidMessage, key>>3)
+		}
+
+		switch key & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return fmt.Errorf("%w: invalid varint of field %d", ErrInvalidMessage, num)
+			}
+			b = b[n:]
+			field(num, v, nil)
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || l > uint64(len(b)-n) {
+				return fmt.Errorf("%w: invalid length of field %d", ErrInvalidMessage, num)
+			}
+			field(num, 0, b[n:n+int(l)])
+			b = b[n+int(l):]
+		case wireFixed64:
+			if len(b) < 8 {
+				return fmt.Errorf("%w: truncated field %d", ErrInvalidMessage, num)
+			}
+			b = b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return fmt.Errorf("%w: truncated field %d", ErrInvalidMessage, num)
+			}
+			b = b[4:]
+		default:
+			return fmt.Errorf("%w: unsupported wire type %d of field %d", ErrInvalidMessage, key&7, num)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+)
+
+const testFiles = "../test_files"
+
+func TestMessageRoundTrip(t *testing.T) {
+	req := ParseRequest{Path: "a/b.NEF", Format: "NEF", Preview: true, Quality: -1}
+	b, _ := req.MarshalBinary()
+	var got ParseRequest
+	if err := got.UnmarshalBinary(b); err != nil || got.Path != req.Path || got.Format != req.Format ||
+		!got.Preview || got.Quality != -1 || got.Data != nil {
+		t.Errorf("Unexpected request: %+v, %v\n", got, err)
+	}
+
+	// a field unknown to this version is skipped
+	resp := ParseResponse{MetadataJSON: `{"fileName":"b.NEF"}`, Preview: []byte{0xff, 0xd8}}
+	b, _ = resp.MarshalBinary()
+	b = appendVarint(b, 15, 300)
+	var gotResp ParseResponse
+	if err := gotResp.UnmarshalBinary(b); err != nil || gotResp.MetadataJSON != resp.MetadataJSON ||
+		!bytes.Equal(gotResp.Preview, resp.Preview) {
+		t.Errorf("Unexpected response: %+v, %v\n", gotResp, err)
+	}
+
+	for _, b := range [][]byte{{0x0a, 5, 1}, {0x08}, {0x00}, {0x0b}} {
+		if err := got.UnmarshalBinary(b); err == nil {
+			t.Errorf("Expected an error decoding % x\n", b)
+		}
+	}
+}
+
+// newTestServer starts a Server over HTTP/2 without TLS.
+func newTestServer(t *testing.T) (*httptest.Server, *http.Client) {
+	root, err := os.OpenRoot(testFiles)
+	if err != nil {
+		t.Fatalf("Error opening root: %v\n", err)
+	}
+	t.Cleanup(func() { root.Close() })
+
+	ts := httptest.NewUnstartedServer(NewServer(root, 64<<20, 0))
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	tr := &http.Transport{Protocols: new(http.Protocols)}
+	tr.Protocols.SetUnencryptedHTTP2(true)
+	return ts, &http.Client{Transport: tr}
+}
+
+// call calls the Parse method as a gRPC client does.
+// Returns the response, the grpc-status, and the grpc-message.
+func call(t *testing.T, ts *httptest.Server, c *http.Client, method string, req *ParseRequest) (*ParseResponse, int, string) {
+	msg, _ := req.MarshalBinary()
+	framed := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(msg)))
+	httpReq, _ := http.NewRequest(http.MethodPost, ts.URL+method, bytes.NewReader(append(framed, msg...)))
+	httpReq.Header.Set("Content-Type", "application/grpc")
+	httpReq.Header.Set("TE", "trailers")
+	httpResp, err := c.Do(httpReq)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	defer httpResp.Body.Close()
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil || httpResp.StatusCode != http.StatusOK || httpResp.Header.Get("Content-Type") != "application/grpc" {
+		t.Fatalf("Unexpected response: %s, %v\n", httpResp.Status, err)
+	}
+
+	code, err := strconv.Atoi(httpResp.Trailer.Get("Grpc-Status"))
+	if err != nil {
+		t.Fatalf("Missing grpc-status: %v\n", httpResp.Trailer)
+	}
+	if len(body) == 0 {
+		return nil, code, httpResp.Trailer.Get("Grpc-Message")
+	}
+	if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:])) != len(body)-5 {
+		t.Fatalf("Invalid response frame of %d bytes\n", len(body))
+	}
+	var resp ParseResponse
+	if err := resp.UnmarshalBinary(body[5:]); err != nil {
+		t.Fatalf("Error decoding response: %v\n", err)
+	}
+	return &resp, code, ""
+}
+
+func TestParse(t *testing.T) {
+	ts, c := newTestServer(t)
+	data, err := os.ReadFile(testFiles + "/little_endian.CR2")
+	if err != nil {
+		t.Fatalf("Error reading test file: %v\n", err)
+	}
+
+	resp, code, msg := call(t, ts, c, ParseMethod, &ParseRequest{Data: data, Format: "CR2"})
+	if code != codeOK || resp == nil || resp.Preview != nil {
+		t.Fatalf("Unexpected status: %d %s\n", code, msg)
+	}
+	var meta map[string]any
+	if err := json.Unmarshal([]byte(resp.MetadataJSON), &meta); err != nil || meta["createDate"] == nil {
+		t.Errorf("Unexpected metadata: %s, %v\n", resp.MetadataJSON, err)
+	}
+
+	resp, code, msg = call(t, ts, c, ParseMethod, &ParseRequest{Path: "big_endian.NEF", Preview: true, Quality: 50})
+	if code != codeOK || resp == nil {
+		t.Fatalf("Unexpected status: %d %s\n", code, msg)
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(resp.Preview))
+	if err != nil || cfg.Width != 4256 || cfg.Height != 2832 {
+		t.Errorf("Unexpected preview: %+v, %v\n", cfg, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	ts, c := newTestServer(t)
+
+	tests := []struct {
+		method string
+		req    ParseRequest
+		want   int
+	}{
+		{ParseMethod, ParseRequest{}, codeInvalidArgument},
+		{ParseMethod, ParseRequest{Path: "../README.md"}, codeInvalidArgument},
+		{ParseMethod, ParseRequest{Path: "missing.NEF"}, codeNotFound},
+		{ParseMethod, ParseRequest{Path: "COPYRIGHT.txt"}, codeInvalidArgument},
+		{ParseMethod, ParseRequest{Path: "big_endian.NEF", Quality: 101}, codeInvalidArgument},
+		{ParseMethod, ParseRequest{Data: []byte("not a raw file"), Format: "NEF"}, codeUnknown},
+		{"/rawparser.v1.RawParser/Render", ParseRequest{}, codeUnimplemented},
+	}
+
+	for _, tt := range tests {
+		if _, code, msg := call(t, ts, c, tt.method, &tt.req); code != tt.want || msg == "" {
+			t.Errorf("%s %+v: expected status %d; got %d %q\n", tt.method, tt.req, tt.want, code, msg)
+		}
+	}
+
+	// paths are parsed only with a root
+	s := NewServer(nil, 0, 0)
+	if s.maxPreviewMemory != DefaultMaxPreviewMemory {
+		t.Errorf("Unexpected preview memory budget: %d\n", s.maxPreviewMemory)
+	}
+	if _, err := s.Parse(&ParseRequest{Path: "big_endian.NEF"}); toStatus(err).code != codePermissionDenied {
+		t.Errorf("Expected permission denied; got %v\n", err)
+	}
+
+	if got := percentEncode("bad\n100%"); got != "bad%0A100%25" {
+		t.Errorf("Unexpected grpc-message: %s\n", got)
+	}
+}
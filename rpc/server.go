@@ -0,0 +1,278 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+// Package rpc serves the RawParser gRPC service of rawparser.proto, so that
+// services not written in Go parse raw files remotely, with the clients
+// generated for their language.
+//
+// The package does not depend on the gRPC or protocol buffers libraries: a
+// Server is an http.Handler implementing the gRPC protocol for the unary
+// Parse method, served over HTTP/2, e.g., without TLS:
+//
+//	srv := &http.Server{Addr: ":9090", Handler: rpc.NewServer(root, 256<<20, 64<<20)}
+//	srv.Protocols = new(http.Protocols)
+//	srv.Protocols.SetUnencryptedHTTP2(true)
+//	log.Fatal(srv.ListenAndServe())
+package rpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/jeremytorres/rawparser"
+)
+
+// ParseMethod is the path of the Parse method of the RawParser service.
+const ParseMethod = "/rawparser.v1.RawParser/Parse"
+
+// DefaultMaxMessage is the largest request message accepted by a Server
+// created with a maxMessage of 0, in bytes.
+const DefaultMaxMessage = 256 << 20
+
+// DefaultMaxPreviewMemory is the memory budget of the preview of a raw file
+// of a Server created with a maxPreviewMemory of 0, in bytes; see
+// rawparser.RawFileInfo.MaxPreviewMemory.
+const DefaultMaxPreviewMemory = 64 << 20
+
+// gRPC status codes
+const (
+	codeOK                = 0
+	codeUnknown           = 2
+	codeInvalidArgument   = 3
+	codeNotFound          = 5
+	codePermissionDenied  = 7
+	codeResourceExhausted = 8
+	codeUnimplemented     = 12
+	codeInternal          = 13
+)
+
+// statusError is an error with its gRPC status code.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e statusError) Error() string {
+	return e.msg
+}
+
+// Server serves the RawParser service.
+type Server struct {
+	// root is the directory of the raw files parsed by path; nil if
+	// disabled.
+	root *os.Root
+
+	// maxMessage is the largest request message accepted, in bytes.
+	maxMessage int64
+
+	// maxPreviewMemory is the memory budget of the preview of a raw file,
+	// in bytes.
+	maxPreviewMemory int64
+}
+
+// NewServer creates a Server parsing the raw files sent, of at most
+// maxMessage bytes (DefaultMaxMessage if 0), or by path below root, if not
+// nil.  The preview of a raw file exceeding maxPreviewMemory bytes
+// (DefaultMaxPreviewMemory if 0) is sent as is rather than decoded and
+// re-encoded.
+// Returns the Server.
+func NewServer(root *os.Root, maxMessage, maxPreviewMemory int64) *Server {
+	if maxMessage == 0 {
+		maxMessage = DefaultMaxMessage
+	}
+	if maxPreviewMemory == 0 {
+		maxPreviewMemory = DefaultMaxPreviewMemory
+	}
+	return &Server{root: root, maxMessage: maxMessage, maxPreviewMemory: maxPreviewMemory}
+}
+
+// ServeHTTP serves a gRPC call.  The status of the call is sent in the
+// trailers, after the response message, if any.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost || req.ProtoMajor != 2 {
+		http.Error(w, "gRPC requires POST over HTTP/2", http.StatusBadRequest)
+		return
+	}
+
+	var resp []byte
+	err := statusError{code: codeUnimplemented, msg: "unknown method " + req.URL.Path}
+	if req.URL.Path == ParseMethod {
+		resp, err = s.call(req.Body)
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.WriteHeader(http.StatusOK)
+	if err.code == codeOK {
+		w.Write(resp)
+	} else {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", percentEncode(err.msg))
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(err.code))
+}
+
+// call reads the request message of the Parse method, parses the raw file,
+// and frames the response message.
+// Returns the framed response message and the status of the call.
+func (s *Server) call(body io.Reader) ([]byte, statusError) {
+	// a message is framed by a compression flag and a 4-byte length
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return nil, statusError{codeInvalidArgument, "missing request message"}
+	}
+	if prefix[0] != 0 {
+		return nil, statusError{codeUnimplemented, "compressed messages are not supported"}
+	}
+	size := int64(binary.BigEndian.Uint32(prefix[1:]))
+	if size > s.maxMessage {
+		return nil, statusError{codeResourceExhausted, fmt.Sprintf("request message of %d bytes exceeds %d", size, s.maxMessage)}
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(body, data); err != nil {
+		return nil, statusError{codeInvalidArgument, "truncated request message"}
+	}
+
+	var req ParseRequest
+	if err := req.UnmarshalBinary(data); err != nil {
+		return nil, statusError{codeInvalidArgument, err.Error()}
+	}
+	resp, err := s.Parse(&req)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	msg, err := resp.MarshalBinary()
+	if err != nil {
+		return nil, statusError{codeInternal, err.Error()}
+	}
+
+	framed := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(framed[1:], uint32(len(msg)))
+	return append(framed, msg...), statusError{code: codeOK}
+}
+
+// Parse parses the raw file of a request and, if requested, extracts its
+// preview.
+// Returns the ParseResponse or error.
+func (s *Server) Parse(req *ParseRequest) (*ParseResponse, error) {
+	if req.Quality < rawparser.QualityAuto || req.Quality > 100 {
+		return nil, statusError{codeInvalidArgument, fmt.Sprintf("invalid quality: %d", req.Quality)}
+	}
+
+	info := &rawparser.RawFileInfo{SkipExtraction: true, Quality: int(req.Quality), MaxPreviewMemory: s.maxPreviewMemory}
+	key := req.Format
+	switch {
+	case req.Path != "":
+		if s.root == nil {
+			return nil, statusError{codePermissionDenied, "parsing by path is disabled"}
+		}
+		if !filepath.IsLocal(req.Path) {
+			return nil, statusError{codeInvalidArgument, fmt.Sprintf("invalid path: %q", req.Path)}
+		}
+		f, err := s.root.Open(req.Path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		info.File, info.Handle = f.Name(), f
+		if key == "" {
+			key = filepath.Ext(req.Path)
+		}
+	case req.Data != nil:
+		info.Reader, info.Size = bytes.NewReader(req.Data), int64(len(req.Data))
+	default:
+		return nil, statusError{codeInvalidArgument, "missing raw file: set data or path"}
+	}
+
+	p := rawparser.NewFormatParser(key)
+	if p == nil {
+		return nil, fmt.Errorf("%w: %q", rawparser.ErrUnknownFormat, key)
+	}
+	r, err := p.ProcessFile(info)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ParseResponse{}
+	if req.Preview {
+		var buf bytes.Buffer
+		if err := r.ExtractJpegTo(&buf, info); err != nil {
+			return nil, err
+		}
+		resp.Preview = buf.Bytes()
+	}
+
+	// after the preview, which updates the preview dimensions
+	metadata, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	resp.MetadataJSON = string(metadata)
+	return resp, nil
+}
+
+// toStatus maps an error parsing a raw file to its gRPC status.
+// Returns the status.
+func toStatus(err error) statusError {
+	var se statusError
+	code := codeUnknown
+	switch {
+	case errors.As(err, &se):
+		return se
+	case errors.Is(err, rawparser.ErrUnknownFormat):
+		code = codeInvalidArgument
+	case errors.Is(err, rawparser.ErrNoPreview):
+		code = codeNotFound
+	case errors.Is(err, os.ErrNotExist):
+		code = codeNotFound
+	case errors.Is(err, os.ErrPermission):
+		code = codePermissionDenied
+	}
+	if code == codeUnknown {
+		log.Printf("Error: %v\n", err)
+	}
+	return statusError{code, err.Error()}
+}
+
+// percentEncode encodes a grpc-message: the bytes other than printable
+// ASCII, and '%', are percent-encoded.
+// Returns the encoded message.
+func percentEncode(msg string) string {
+	var b []byte
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < ' ' || c > '~' || c == '%' {
+			b = fmt.Appendf(b, "%%%02X", c)
+		} else {
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
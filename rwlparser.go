@@ -0,0 +1,57 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+// RwlParserKey is a unique identifier for the RWL raw file parser.
+// This key may be used as a key the RawParsers map.
+const RwlParserKey = "RWL"
+
+// rw2Magic is the magic value of the TIFF-like header of RW2 and RWL.
+const rw2Magic = 0x55
+
+// RwlParser is the struct defining the state of
+// the RawFile concept.  Implements the RawParser interface.
+// This parser provides basic parsing functionaity for the Leica and Panasonic
+// raw format (RWL).  RWL shares the Panasonic RW2 layout: a TIFF-like header
+// whose magic value is 0x55 and a full-size JpgFromRaw preview whose EXIF
+// segment carries the capture date.  The create time and orientation are
+// parsed and the largest embedded JPEG is extracted.
+type RwlParser struct {
+	tiffParser
+}
+
+// ProcessFile is the entry point into the RwlParser.  For a specified RWL,
+// via RawFileInfo, the file shall be processed, JPEG extracted, and
+// processed details returned to the caller.
+// Returns a pointer the RawFile data structure or error.
+func (n RwlParser) ProcessFile(info *RawFileInfo) (*RawFile, error) {
+	return n.processTiffFile(info)
+}
+
+// NewRwlParser creates an instance of RWL-specific RawParser.
+// Returns an instance of a RWL-specific RawParser.
+// The hostIsLittleEndian argument is ignored; see RawParser.
+func NewRwlParser(hostIsLittleEndian bool) (RawParser, string) {
+	return &RwlParser{tiffParser{rawParser: &rawParser{}, magic: rw2Magic}}, RwlParserKey
+}
@@ -0,0 +1,103 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"io/fs"
+	"iter"
+	"path/filepath"
+	"strings"
+)
+
+// ScanOptions configures Scan.  The embedded RawFileInfo is the template of
+// the RawFileInfo of each raw file found; its File and Handle are ignored.
+type ScanOptions struct {
+	RawFileInfo
+
+	// SkipHidden skips files and directories whose names begin with ".".
+	SkipHidden bool
+}
+
+// RawFiles walks the directory tree rooted at root, in lexical order,
+// yielding the path of each file with the extension of a registered
+// format; see RegisterFormat.  An error reading a directory is yielded
+// with the path of the directory, and the walk continues.
+func RawFiles(root string, opts *ScanOptions) iter.Seq2[string, error] {
+	if opts == nil {
+		opts = new(ScanOptions)
+	}
+
+	return func(yield func(string, error) bool) {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if !yield(path, err) {
+					return filepath.SkipAll
+				}
+				return nil
+			}
+			if opts.SkipHidden && path != root && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() || !isRegisteredFormat(filepath.Ext(path)) {
+				return nil
+			}
+			if !yield(path, nil) {
+				return filepath.SkipAll
+			}
+			return nil
+		})
+	}
+}
+
+// Scan processes each raw file found by RawFiles, yielding the RawFile, or
+// error, of each file as it is processed.  As with ProcessFile, a RawFile
+// is yielded with an error wrapping ErrExtractionFailed if its metadata was
+// parsed but the extraction failed.  Breaking out of the loop stops the
+// scan.
+//
+//	for r, err := range rawparser.Scan(root, opts) {
+//		...
+//	}
+func Scan(root string, opts *ScanOptions) iter.Seq2[*RawFile, error] {
+	if opts == nil {
+		opts = new(ScanOptions)
+	}
+
+	return func(yield func(*RawFile, error) bool) {
+		for path, err := range RawFiles(root, opts) {
+			var r *RawFile
+			if err == nil {
+				info := opts.RawFileInfo
+				info.File, info.Handle = path, nil
+				r, err = NewFormatParser(filepath.Ext(path)).ProcessFile(&info)
+			}
+			if !yield(r, err) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// buildScanTree builds a directory tree of raw and other files.
+// Returns the root and the raw files, in lexical order.
+func buildScanTree(t *testing.T) (string, []string) {
+	root := t.TempDir()
+	for _, dir := range []string{"2024", ".cache"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Error creating directory: %v\n", err)
+		}
+	}
+
+	files := []string{
+		filepath.Join(root, ".cache", "c.NRW"),
+		filepath.Join(root, "2024", "b.nrw"),
+		filepath.Join(root, "a.NRW"),
+	}
+	for i, file := range files {
+		writeFile(t, file, buildTestPhoto(t, "id-"+file, string(rune('a'+i))))
+	}
+	writeFile(t, filepath.Join(root, "notes.txt"), []byte("not a raw file"))
+	return root, files
+}
+
+func TestRawFiles(t *testing.T) {
+	root, files := buildScanTree(t)
+
+	var found []string
+	for path, err := range RawFiles(root, nil) {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		found = append(found, path)
+	}
+	if !slices.Equal(found, files) {
+		t.Errorf("Expected %v; got %v\n", files, found)
+	}
+
+	found = found[:0]
+	for path := range RawFiles(root, &ScanOptions{SkipHidden: true}) {
+		found = append(found, path)
+	}
+	if !slices.Equal(found, files[1:]) {
+		t.Errorf("Expected %v; got %v\n", files[1:], found)
+	}
+
+	var errs int
+	for _, err := range RawFiles(filepath.Join(root, "missing"), nil) {
+		if err != nil {
+			errs++
+		}
+	}
+	if errs != 1 {
+		t.Errorf("Expected an error for a missing root; got %d\n", errs)
+	}
+}
+
+func TestScan(t *testing.T) {
+	root, files := buildScanTree(t)
+	dest := t.TempDir() + string(os.PathSeparator)
+
+	opts := &ScanOptions{SkipHidden: true}
+	opts.DestDir = dest
+	var names []string
+	for r, err := range Scan(root, opts) {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		if r.JpegPath == "" || filepath.Dir(r.JpegPath) != filepath.Clean(dest) {
+			t.Errorf("Unexpected jpeg path: %s\n", r.JpegPath)
+		}
+		names = append(names, r.FileName)
+	}
+	if !slices.Equal(names, files[1:]) {
+		t.Errorf("Expected %v; got %v\n", files[1:], names)
+	}
+
+	// breaking out of the loop stops the scan
+	opts = &ScanOptions{}
+	opts.SkipExtraction = true
+	n := 0
+	for r, err := range Scan(root, opts) {
+		if err != nil || r.JpegPath != "" {
+			t.Fatalf("Unexpected result: %+v, %v\n", r, err)
+		}
+		n++
+		break
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 file; got %d\n", n)
+	}
+}
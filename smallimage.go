@@ -0,0 +1,161 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// ErrNoSmallImage is returned by DecodeSmallImage when a raw file contains
+// no small uncompressed RGB image.
+var ErrNoSmallImage = errors.New("no small rgb image found")
+
+// maxSmallImagePixels is the largest small RGB image, in pixels, decoded;
+// the small image of a CR2 is well under a megapixel.
+const maxSmallImagePixels = 1 << 22
+
+// smallImageGamma is the gamma with which the linear samples of a 16-bit
+// small image are encoded.
+const smallImageGamma = 1 / 2.2
+
+// DecodeSmallImage decodes the small uncompressed RGB image stored in IFD2
+// of a CR2 (e.g., 362x234 on the EOS 50D), for instant thumbnails, e.g.,
+// contact sheets, without decoding a JPEG.  The 16-bit samples stored by
+// most bodies are linear sensor values: they are scaled between the
+// darkest and brightest samples and gamma encoded, but not white balanced.
+// The image is as stored: it is not rotated by the Orientation of the raw
+// file.
+// Returns the image or error; ErrNoSmallImage if not a CR2 or none stored.
+func DecodeSmallImage(info *RawFileInfo) (image.Image, error) {
+	f, err := openRawFile(info)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return decodeCr2SmallImage(newReadCache(f))
+}
+
+// decodeCr2SmallImage walks the IFD chain of a CR2 to IFD2 and decodes its
+// uncompressed RGB strips, of 8 or 16 bits per sample.
+// Returns the image or error.
+func decodeCr2SmallImage(f io.ReaderAt) (image.Image, error) {
+	h, err := Cr2Parser{&rawParser{}}.processHeader(f)
+	if err != nil {
+		return nil, err
+	}
+	if h.cr2MagicValue != cr2MagicWord {
+		return nil, fmt.Errorf("%w: not a CR2", ErrNoSmallImage)
+	}
+	order := binary.ByteOrder(binary.LittleEndian)
+	if h.isBigEndian {
+		order = binary.BigEndian
+	}
+
+	var ifd *tiff.IFD
+	offset := h.tiffOffset
+	for i := 0; i <= 2; i++ {
+		if offset <= 0 {
+			return nil, fmt.Errorf("%w: no IFD2", ErrNoSmallImage)
+		}
+		if ifd, err = tiff.ReadIFD(f, order, offset); err != nil {
+			return nil, err
+		}
+		offset = ifd.Next
+	}
+
+	value := func(tag uint16, def uint32) uint32 {
+		if e := ifd.Find(tag); e != nil {
+			if v, err := e.Uint(); err == nil {
+				return v
+			}
+		}
+		return def
+	}
+	width, height := int(value(0x0100, 0)), int(value(0x0101, 0))
+	bits := value(0x0102, 8)
+	if value(0x0103, 0) != 1 || value(0x0106, 0) != 2 || value(0x0115, 0) != 3 ||
+		value(0x011c, 1) != 1 || (bits != 8 && bits != 16) {
+		return nil, fmt.Errorf("%w: IFD2 is not uncompressed RGB", ErrNoSmallImage)
+	}
+	if width < 1 || height < 1 || width*height > maxSmallImagePixels {
+		return nil, fmt.Errorf("%w: IFD2 has invalid dimensions %dx%d", ErrNoSmallImage, width, height)
+	}
+
+	var offsets, lengths []uint64
+	if e := ifd.Find(0x0111); e != nil {
+		offsets, _ = e.Uints64()
+	}
+	if e := ifd.Find(0x0117); e != nil {
+		lengths, _ = e.Uints64()
+	}
+	strips := newByteRanges(offsets, lengths)
+	if len(strips) == 0 {
+		return nil, fmt.Errorf("%w: IFD2 has no strips", ErrNoSmallImage)
+	}
+	samples := width * height * 3
+	j := jpegInfo{length: int64(samples) * int64(bits/8), strips: strips}
+	data, err := readImageBytes(f, &j)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < int(j.length) {
+		return nil, fmt.Errorf("IFD2 strips of %d bytes; expected %d", len(data), j.length)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	if bits == 8 {
+		for i := 0; i < width*height; i++ {
+			copy(img.Pix[i*4:i*4+3], data[i*3:i*3+3])
+			img.Pix[i*4+3] = 0xff
+		}
+		return img, nil
+	}
+
+	values := make([]uint16, samples)
+	black, white := uint16(math.MaxUint16), uint16(0)
+	for i := range values {
+		values[i] = order.Uint16(data[i*2:])
+		black, white = min(black, values[i]), max(white, values[i])
+	}
+	lut := make([]uint8, int(white-black)+1)
+	scale := float64(max(white-black, 1))
+	for i := range lut {
+		lut[i] = uint8(math.Round(255 * math.Pow(float64(i)/scale, smallImageGamma)))
+	}
+	for i := 0; i < width*height; i++ {
+		for c := 0; c < 3; c++ {
+			img.Pix[i*4+c] = lut[values[i*3+c]-black]
+		}
+		img.Pix[i*4+3] = 0xff
+	}
+	return img, nil
+}
@@ -0,0 +1,194 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// errNotAFile is returned when the file information of a raw file read
+// from an io.ReaderAt is requested.
+var errNotAFile = errors.New("raw file is not read from a file")
+
+// rawSource is the raw file being processed: a file, or the io.ReaderAt of
+// RawFileInfo.Reader.
+type rawSource struct {
+	r    io.ReaderAt
+	name string
+	size int64 // -1 if unknown
+
+	// file is nil unless the raw file is read from a file.
+	file *os.File
+
+	// owned is true if the file was opened by openRawFile and must be
+	// closed by Close.
+	owned bool
+
+	// calls and bytes count the reads of the raw file; see ReadStats.
+	calls, bytes atomic.Int64
+
+	// opened is the time the raw file was opened, the start of its
+	// processing; see Timings.
+	opened time.Time
+}
+
+// ReadStats is a struct representing the reads of a raw file while it was
+// processed.  The parsers read the header, the IFDs, the entry values they
+// parse, and the preview, if extracted; not the raw image data.  The IFDs
+// and entry values are read through a cache of 4 KiB blocks, so that the
+// many small reads of parsing do not each reach the file; the preview is
+// read in a single read.  Checksums, if requested, read the entire file.
+type ReadStats struct {
+	// ReadCalls is the number of reads of the raw file.
+	ReadCalls int64 `json:"readCalls"`
+
+	// BytesRead is the number of bytes read from the raw file.
+	BytesRead int64 `json:"bytesRead"`
+}
+
+// fileSource creates a rawSource reading from a file.  The file is not
+// owned by the rawSource.
+func fileSource(f *os.File) *rawSource {
+	return &rawSource{r: f, name: f.Name(), size: -1, file: f, opened: time.Now()}
+}
+
+// ProcessBytes parses a raw file held in memory, e.g., by a mobile or
+// WebAssembly application, without writing it to a temporary file: data is
+// read as the RawFileInfo.Reader.  The format is identified by the
+// extension of opts.File or, if no parser is registered for it, by the
+// magic bytes of data; TIFF-based formats (e.g., NEF) are identified by
+// extension only, so opts.File should name the raw file.  The other fields
+// of opts are as for ProcessFile, but Reader, Size, and Handle; a nil opts
+// parses the raw file without extracting the preview, which
+// RawFile.ExtractJpegTo may stream later with the same Reader.
+// Returns a pointer to the RawFile data structure or error wrapping
+// ErrUnknownFormat if the format is not identified.
+func ProcessBytes(data []byte, opts *RawFileInfo) (*RawFile, error) {
+	info := RawFileInfo{SkipExtraction: true}
+	if opts != nil {
+		info = *opts
+	}
+	r := bytes.NewReader(data)
+	info.Reader, info.Size, info.Handle = r, r.Size(), nil
+
+	p := NewFormatParser(filepath.Ext(info.File))
+	if p == nil {
+		key, err := SniffFormat(r)
+		if err != nil {
+			return nil, err
+		}
+		p = NewFormatParser(key)
+	}
+	return p.ProcessFile(&info)
+}
+
+// openRawFile opens the raw file specified by RawFileInfo: the Reader or
+// Handle supplied by the caller, or File.
+// Returns the raw file, which must be closed after processing, or error.
+func openRawFile(info *RawFileInfo) (*rawSource, error) {
+	if info.Reader != nil {
+		s := &rawSource{r: info.Reader, name: info.File, size: info.Size, opened: time.Now()}
+		if sized, ok := info.Reader.(interface{ Size() int64 }); ok && s.size <= 0 {
+			s.size = sized.Size()
+		}
+		return s, nil
+	}
+
+	if info.Handle != nil {
+		return fileSource(info.Handle), nil
+	}
+
+	f, err := os.Open(info.File)
+	if err != nil {
+		log.Printf("Error: Unable to open file: '%s'\n", info.File)
+		return nil, err
+	}
+	s := fileSource(f)
+	s.owned = true
+	return s, nil
+}
+
+// ReadAt implements io.ReaderAt, counting the reads.
+func (s *rawSource) ReadAt(p []byte, off int64) (int, error) {
+	n, err := s.r.ReadAt(p, off)
+	s.calls.Add(1)
+	s.bytes.Add(int64(n))
+	return n, err
+}
+
+// stats returns the reads of the raw file so far.
+func (s *rawSource) stats() ReadStats {
+	return ReadStats{ReadCalls: s.calls.Load(), BytesRead: s.bytes.Load()}
+}
+
+// add adds the reads of other to the ReadStats.
+func (s *ReadStats) add(other ReadStats) {
+	s.ReadCalls += other.ReadCalls
+	s.BytesRead += other.BytesRead
+}
+
+// Name returns the name of the raw file.
+func (s *rawSource) Name() string {
+	return s.name
+}
+
+// Size returns the size of the raw file, in bytes, or error if unknown.
+func (s *rawSource) Size() (int64, error) {
+	if s.size > 0 {
+		return s.size, nil
+	}
+	if s.file == nil {
+		return 0, errors.New("size of raw file unknown: set RawFileInfo.Size")
+	}
+
+	fi, err := s.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// Stat returns the file information of the raw file, or error if the raw
+// file is not read from a file.
+func (s *rawSource) Stat() (os.FileInfo, error) {
+	if s.file == nil {
+		return nil, errNotAFile
+	}
+	return s.file.Stat()
+}
+
+// Close closes the raw file if it was opened by openRawFile.
+func (s *rawSource) Close() error {
+	if s.owned {
+		return s.file.Close()
+	}
+	return nil
+}
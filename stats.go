@@ -0,0 +1,185 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"maps"
+	"sync"
+	"time"
+)
+
+// Timings is a struct representing the time spent processing a raw file,
+// by stage.
+type Timings struct {
+	// Parse is the time parsing the metadata of the raw file, from
+	// opening it to the extraction of the preview.
+	Parse time.Duration
+
+	// Decode is the time decoding the embedded JPEG.  The native JPEG
+	// backends (the "jpeg", "turbojpeg", and "jpegcpp" build tags) decode
+	// and encode JPEG output in a single call, accounted as Encode.
+	Decode time.Duration
+
+	// Encode is the time encoding and writing the preview, including the
+	// search of QualityAuto.
+	Encode time.Duration
+}
+
+// addDecode adds the time since start to Decode; t may be nil.
+func (t *Timings) addDecode(start time.Time) {
+	if t != nil {
+		t.Decode += time.Since(start)
+	}
+}
+
+// addEncode adds the time since start to Encode; t may be nil.
+func (t *Timings) addEncode(start time.Time) {
+	if t != nil {
+		t.Encode += time.Since(start)
+	}
+}
+
+// Failure kinds of StatsSnapshot.Failures; see FailureKind.
+const (
+	FailureUnknownFormat = "unknownFormat"
+	FailureNotFound      = "notFound"
+	FailureNoPreview     = "noPreview"
+	FailureExtraction    = "extraction"
+	FailureParse         = "parse"
+)
+
+// FailureKind classifies the error processing a raw file, e.g., as the
+// label of a metric.
+// Returns the failure kind, e.g., FailureNoPreview.
+func FailureKind(err error) string {
+	switch {
+	case errors.Is(err, ErrUnknownFormat):
+		return FailureUnknownFormat
+	case errors.Is(err, fs.ErrNotExist):
+		return FailureNotFound
+	case errors.Is(err, ErrNoPreview):
+		return FailureNoPreview
+	case errors.Is(err, ErrExtractionFailed):
+		return FailureExtraction
+	}
+	return FailureParse
+}
+
+// StatsSnapshot is a struct representing the totals of a BatchStats at a
+// point in time.  The totals only increase, as the counters of a
+// monitoring system (e.g., Prometheus) expect.
+type StatsSnapshot struct {
+	// Files is the number of files completed, including those that failed
+	// and duplicates.
+	Files int64 `json:"files"`
+
+	// Failed is the number of files that failed, and Failures their
+	// number by failure kind, e.g., FailureNoPreview.
+	Failed   int64            `json:"failed"`
+	Failures map[string]int64 `json:"failures"`
+
+	// Duplicates is the number of files not processed as duplicates; see
+	// WithDedupe.
+	Duplicates int64 `json:"duplicates"`
+
+	// ReadCalls and BytesRead are the reads of the raw files; see
+	// ReadStats.
+	ReadCalls int64 `json:"readCalls"`
+	BytesRead int64 `json:"bytesRead"`
+
+	// ParseMs, DecodeMs, and EncodeMs are the time, in milliseconds, spent
+	// in each stage of processing the files; see Timings.
+	ParseMs  float64 `json:"parseMs"`
+	DecodeMs float64 `json:"decodeMs"`
+	EncodeMs float64 `json:"encodeMs"`
+}
+
+// BatchStats aggregates the outcomes of the files of the batches of a
+// BatchProcessor (see WithStats), e.g., to monitor a long-running ingest
+// daemon.  BatchStats is safe for concurrent use and implements
+// expvar.Var, so it may be published with expvar.Publish.  The zero value
+// is ready to use.
+type BatchStats struct {
+	mu       sync.Mutex
+	snapshot StatsSnapshot
+	timings  Timings
+}
+
+// record adds the result of a file of a batch.
+func (s *BatchStats) record(res *BatchResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.snapshot.Files++
+	if res.DuplicateOf != "" {
+		s.snapshot.Duplicates++
+	}
+	if res.Err != nil {
+		s.snapshot.Failed++
+		if s.snapshot.Failures == nil {
+			s.snapshot.Failures = make(map[string]int64)
+		}
+		s.snapshot.Failures[FailureKind(res.Err)]++
+	}
+	if r := res.RawFile; r != nil {
+		s.snapshot.ReadCalls += r.ReadStats.ReadCalls
+		s.snapshot.BytesRead += r.ReadStats.BytesRead
+		s.timings.Parse += r.Timings.Parse
+		s.timings.Decode += r.Timings.Decode
+		s.timings.Encode += r.Timings.Encode
+	}
+}
+
+// Snapshot returns the current totals.
+func (s *BatchStats) Snapshot() StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.snapshot
+	snapshot.Failures = maps.Clone(s.snapshot.Failures)
+	if snapshot.Failures == nil {
+		snapshot.Failures = make(map[string]int64)
+	}
+	snapshot.ParseMs = milliseconds(s.timings.Parse)
+	snapshot.DecodeMs = milliseconds(s.timings.Decode)
+	snapshot.EncodeMs = milliseconds(s.timings.Encode)
+	return snapshot
+}
+
+// String encodes the current totals as JSON, implementing expvar.Var.
+func (s *BatchStats) String() string {
+	data, err := json.Marshal(s.Snapshot())
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// milliseconds converts a duration to fractional milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,85 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/json"
+	"expvar"
+	"path/filepath"
+	"testing"
+)
+
+var _ expvar.Var = new(BatchStats)
+
+func TestBatchStats(t *testing.T) {
+	a, dir := writeTestFile(t, "a.NRW", buildTestPhoto(t, "id-a", "v1"))
+	files := []string{a, filepath.Join(dir, "missing.NRW"), filepath.Join(dir, "c.ABC")}
+
+	var stats BatchStats
+	NewBatchProcessor(dir, 75, WithStats(&stats)).Process(files)
+	NewBatchProcessor(dir, 75, WithStats(&stats)).Process(files[:1])
+
+	s := stats.Snapshot()
+	if s.Files != 4 || s.Failed != 2 || s.Duplicates != 0 {
+		t.Errorf("Unexpected counts: %+v\n", s)
+	}
+	if s.Failures[FailureNotFound] != 1 || s.Failures[FailureUnknownFormat] != 1 || len(s.Failures) != 2 {
+		t.Errorf("Unexpected failures: %v\n", s.Failures)
+	}
+	if s.ReadCalls == 0 || s.BytesRead == 0 || s.ParseMs <= 0 || s.DecodeMs+s.EncodeMs <= 0 {
+		t.Errorf("Unexpected totals: %+v\n", s)
+	}
+
+	// the snapshot is a copy
+	s.Failures[FailureParse]++
+	if stats.Snapshot().Failures[FailureParse] != 0 {
+		t.Error("Snapshot shares the failures of the BatchStats")
+	}
+
+	var decoded StatsSnapshot
+	if err := json.Unmarshal([]byte(stats.String()), &decoded); err != nil || decoded.Files != 4 {
+		t.Errorf("Unexpected expvar value %s: %v\n", stats.String(), err)
+	}
+}
+
+func TestTimingsExtract(t *testing.T) {
+	path, dir := writeTestFile(t, "timings.NRW", buildTestNrw(t, false))
+	p, _ := NewNrwParser(isHostLittleEndian())
+
+	r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if r.Timings.Parse <= 0 || r.Timings.Decode != 0 || r.Timings.Encode != 0 {
+		t.Errorf("Unexpected timings without extraction: %+v\n", r.Timings)
+	}
+
+	// the pure GO encoders decode separately
+	if _, err := r.Extract(&RawFileInfo{DestDir: dir, Quality: QualityAuto}); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if r.Timings.Decode <= 0 || r.Timings.Encode <= 0 {
+		t.Errorf("Unexpected timings of extraction: %+v\n", r.Timings)
+	}
+}
@@ -0,0 +1,155 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// RegionKind is the kind of a Region of a photo.
+type RegionKind uint8
+
+const (
+	RegionSubject RegionKind = iota // the main subject, by the EXIF SubjectArea
+	RegionFace                      // a face detected by the camera
+)
+
+// String returns the name of the region kind, e.g., "Face".
+func (k RegionKind) String() string {
+	switch k {
+	case RegionSubject:
+		return "Subject"
+	case RegionFace:
+		return "Face"
+	}
+	return fmt.Sprintf("RegionKind(%d)", int(k))
+}
+
+// MarshalText encodes the region kind by name.
+func (k RegionKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Region is a rectangle of a photo, e.g., a detected face, in the
+// coordinates of a frame of FrameWidth by FrameHeight pixels: the raw
+// image for the EXIF SubjectArea, or the frame of the face detection of
+// the camera.  A point has no Width and Height.  Regions are as recorded:
+// they are not rotated by the Orientation of the raw file.
+type Region struct {
+	Kind        RegionKind `json:"kind"`
+	X           int        `json:"x"` // the left edge
+	Y           int        `json:"y"` // the top edge
+	Width       int        `json:"width"`
+	Height      int        `json:"height"`
+	FrameWidth  int        `json:"frameWidth"`
+	FrameHeight int        `json:"frameHeight"`
+}
+
+// Relative returns the region as fractions, from 0 to 1, of its frame,
+// e.g., to crop a preview of any size to the region; zero if the frame
+// is not known.
+func (r Region) Relative() (x, y, width, height float64) {
+	if r.FrameWidth <= 0 || r.FrameHeight <= 0 {
+		return 0, 0, 0, 0
+	}
+	fw, fh := float64(r.FrameWidth), float64(r.FrameHeight)
+	return float64(r.X) / fw, float64(r.Y) / fh, float64(r.Width) / fw, float64(r.Height) / fh
+}
+
+// subjectInfo is a struct representing the subject area and the faces
+// detected of a raw file.
+type subjectInfo struct {
+	area  *Region // the frame of which is the raw image
+	faces []Region
+}
+
+// regions returns the subject area and the faces, the frame of the subject
+// area being the raw image of width by height pixels; nil if none.
+func (s *subjectInfo) regions(width, height uint32) []Region {
+	var out []Region
+	if s.area != nil {
+		area := *s.area
+		area.FrameWidth, area.FrameHeight = int(width), int(height)
+		out = append(out, area)
+	}
+	return append(out, s.faces...)
+}
+
+// processSubjectEntry records the subject area of the EXIF IFD: the
+// SubjectArea, a point, a circle, or a rectangle by its center, or, if not
+// recorded, the SubjectLocation point.  Errors are not fatal as the tags
+// are optional.
+func processSubjectEntry(entry *IfdEntry, m *rawMetadata) {
+	if entry.tag != 0x9214 && entry.tag != 0xa214 { // SubjectArea, SubjectLocation
+		return
+	}
+	v, err := entry.Shorts()
+	if err != nil || entry.tag == 0xa214 && (m.subjects.area != nil || len(v) != 2) {
+		return
+	}
+
+	area := &Region{Kind: RegionSubject, X: int(v[0]), Y: int(v[1])}
+	switch len(v) {
+	case 2: // point
+	case 3: // circle by its diameter
+		area.Width, area.Height = int(v[2]), int(v[2])
+	case 4: // rectangle
+		area.Width, area.Height = int(v[2]), int(v[3])
+	default:
+		return
+	}
+	area.X -= area.Width / 2
+	area.Y -= area.Height / 2
+	m.subjects.area = area
+}
+
+// maxNikonFaces is the number of faces recorded by the FaceDetect of a
+// Nikon maker note.
+const maxNikonFaces = 12
+
+// nikonFaceDetect decodes the FaceDetect of a Nikon maker note, 16-bit
+// values in the byte order of the maker note: the frame size, the faces
+// detected, and the left, top, width, and height of each face.
+// Returns the faces; nil if none.
+func nikonFaceDetect(b []byte, order binary.ByteOrder) []Region {
+	if len(b) < 8 {
+		return nil
+	}
+	frameWidth, frameHeight := int(order.Uint16(b[2:])), int(order.Uint16(b[4:]))
+	n := min(int(order.Uint16(b[6:])), maxNikonFaces)
+
+	var faces []Region
+	for i := 0; i < n && 16+8*i <= len(b); i++ {
+		p := b[8+8*i:]
+		face := Region{Kind: RegionFace,
+			X: int(order.Uint16(p)), Y: int(order.Uint16(p[2:])),
+			Width: int(order.Uint16(p[4:])), Height: int(order.Uint16(p[6:])),
+			FrameWidth: frameWidth, FrameHeight: frameHeight}
+		if face.Width > 0 && face.Height > 0 {
+			faces = append(faces, face)
+		}
+	}
+	return faces
+}
@@ -0,0 +1,102 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSubjectArea(t *testing.T) {
+	for _, tc := range []struct {
+		entry testEntry
+		want  Region
+	}{
+		{shortEntry(0x9214, 400, 300), Region{X: 400, Y: 300}},
+		{shortEntry(0x9214, 400, 300, 100), Region{X: 350, Y: 250, Width: 100, Height: 100}},
+		{shortEntry(0x9214, 400, 300, 200, 100), Region{X: 300, Y: 250, Width: 200, Height: 100}},
+		{shortEntry(0xa214, 10, 20), Region{X: 10, Y: 20}},
+	} {
+		tt := newTestTiff(false)
+		preview := testJpeg(t, 160, 120)
+		previewOffset := tt.addBlob(preview)
+		exif := tt.addIfd(0, tc.entry)
+		ifd0 := tt.addIfd(0,
+			longEntry(0x0201, previewOffset),
+			longEntry(0x0202, uint32(len(preview))),
+			longEntry(0x8769, exif))
+		path, _ := writeTestFile(t, "subject.DNG", tt.bytes(ifd0))
+
+		r, err := NewFormatParser(DngParserKey).ProcessFile(&RawFileInfo{File: path, SkipExtraction: true, Lenient: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n", err)
+		}
+		tc.want.FrameWidth, tc.want.FrameHeight = r.ImageWidth, r.ImageHeight
+		if len(r.Subjects) != 1 || r.Subjects[0] != tc.want {
+			t.Errorf("0x%04x %v: unexpected subjects: %+v; expected %+v\n", tc.entry.tag, tc.entry.values, r.Subjects, tc.want)
+		}
+	}
+
+	// the SubjectArea is preferred to the SubjectLocation
+	var m rawMetadata
+	order := binary.LittleEndian
+	processSubjectEntry(&IfdEntry{tag: 0x9214, fieldType: 3, count: 2, valueOffset: 0x00020001, order: order}, &m)
+	processSubjectEntry(&IfdEntry{tag: 0xa214, fieldType: 3, count: 2, valueOffset: 0x00040003, order: order}, &m)
+	if got := m.subjects.regions(8, 6); len(got) != 1 || got[0] != (Region{X: 1, Y: 2, FrameWidth: 8, FrameHeight: 6}) {
+		t.Errorf("Unexpected subjects: %+v\n", got)
+	}
+}
+
+func TestNikonFaceDetect(t *testing.T) {
+	faces := []uint16{0x0100, 640, 480, 2, 100, 50, 80, 90, 300, 200, 60, 70}
+	b := make([]byte, 2*len(faces)+16) // unused positions
+	for i, v := range faces {
+		binary.BigEndian.PutUint16(b[2*i:], v)
+	}
+
+	tt := newTestTiff(true)
+	nikon := tt.addIfd(0, testEntry{tag: 0x0021, fieldType: 7, raw: b})
+	var m rawMetadata
+	processNikonMakerNote(isHostLittleEndian(), &makerNote{ifdOffset: int64(nikon), isBigEndian: true}, bytes.NewReader(tt.bytes(0)), &m)
+
+	want := []Region{
+		{Kind: RegionFace, X: 100, Y: 50, Width: 80, Height: 90, FrameWidth: 640, FrameHeight: 480},
+		{Kind: RegionFace, X: 300, Y: 200, Width: 60, Height: 70, FrameWidth: 640, FrameHeight: 480},
+	}
+	if got := m.subjects.regions(0, 0); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected faces: %+v\n", got)
+	}
+	if x, y, w, h := want[0].Relative(); x != 100.0/640 || y != 50.0/480 || w != 80.0/640 || h != 90.0/480 {
+		t.Errorf("Unexpected relative region: %v %v %v %v\n", x, y, w, h)
+	}
+
+	data, err := json.Marshal(RawFile{Subjects: want[:1]})
+	if err != nil || !strings.Contains(string(data), `"subjects":[{"kind":"Face","x":100,"y":50,"width":80,"height":90,"frameWidth":640,"frameHeight":480}]`) {
+		t.Errorf("Unexpected JSON: %s %v\n", data, err)
+	}
+}
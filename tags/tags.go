@@ -0,0 +1,393 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+// Package tags defines the tags of the TIFF, TIFF/EP, EXIF, and DNG
+// specifications, e.g., TagOrientation, and their names, so that users of
+// the tiff package need not use magic numbers.
+//
+// The tags of the GPS and interoperability IFDs have their own namespace:
+// e.g., 0x0001 is GPSLatitudeRef in the GPS IFD and InteroperabilityIndex
+// in the interoperability IFD.  Use GPSTagName and InteropTagName for them.
+package tags
+
+// Tags of the main, SubIFD, and EXIF IFDs, which share a namespace.
+const (
+	TagProcessingSoftware          = 0x000b
+	TagNewSubfileType              = 0x00fe
+	TagSubfileType                 = 0x00ff
+	TagImageWidth                  = 0x0100
+	TagImageLength                 = 0x0101
+	TagBitsPerSample               = 0x0102
+	TagCompression                 = 0x0103
+	TagPhotometricInterpretation   = 0x0106
+	TagImageDescription            = 0x010e
+	TagMake                        = 0x010f
+	TagModel                       = 0x0110
+	TagStripOffsets                = 0x0111
+	TagOrientation                 = 0x0112
+	TagSamplesPerPixel             = 0x0115
+	TagRowsPerStrip                = 0x0116
+	TagStripByteCounts             = 0x0117
+	TagXResolution                 = 0x011a
+	TagYResolution                 = 0x011b
+	TagPlanarConfiguration         = 0x011c
+	TagResolutionUnit              = 0x0128
+	TagSoftware                    = 0x0131
+	TagDateTime                    = 0x0132
+	TagArtist                      = 0x013b
+	TagWhitePoint                  = 0x013e
+	TagPrimaryChromaticities       = 0x013f
+	TagTileWidth                   = 0x0142
+	TagTileLength                  = 0x0143
+	TagTileOffsets                 = 0x0144
+	TagTileByteCounts              = 0x0145
+	TagSubIFDs                     = 0x014a
+	TagSampleFormat                = 0x0153
+	TagJPEGInterchangeFormat       = 0x0201
+	TagJPEGInterchangeFormatLength = 0x0202
+	TagYCbCrCoefficients           = 0x0211
+	TagYCbCrSubSampling            = 0x0212
+	TagYCbCrPositioning            = 0x0213
+	TagReferenceBlackWhite         = 0x0214
+	TagXMP                         = 0x02bc
+	TagCFARepeatPatternDim         = 0x828d
+	TagTIFFEPCFAPattern            = 0x828e
+	TagCopyright                   = 0x8298
+	TagExposureTime                = 0x829a
+	TagFNumber                     = 0x829d
+	TagIPTC                        = 0x83bb
+	TagExifIFD                     = 0x8769
+	TagICCProfile                  = 0x8773
+	TagExposureProgram             = 0x8822
+	TagGPSInfoIFD                  = 0x8825
+	TagISOSpeedRatings             = 0x8827
+	TagSensitivityType             = 0x8830
+	TagRecommendedExposureIndex    = 0x8832
+	TagExifVersion                 = 0x9000
+	TagDateTimeOriginal            = 0x9003
+	TagDateTimeDigitized           = 0x9004
+	TagOffsetTime                  = 0x9010
+	TagOffsetTimeOriginal          = 0x9011
+	TagOffsetTimeDigitized         = 0x9012
+	TagComponentsConfiguration     = 0x9101
+	TagCompressedBitsPerPixel      = 0x9102
+	TagShutterSpeedValue           = 0x9201
+	TagApertureValue               = 0x9202
+	TagExposureBiasValue           = 0x9204
+	TagMaxApertureValue            = 0x9205
+	TagSubjectDistance             = 0x9206
+	TagMeteringMode                = 0x9207
+	TagLightSource                 = 0x9208
+	TagFlash                       = 0x9209
+	TagFocalLength                 = 0x920a
+	TagImageNumber                 = 0x9211
+	TagTIFFEPSensingMethod         = 0x9217
+	TagMakerNote                   = 0x927c
+	TagUserComment                 = 0x9286
+	TagSubSecTime                  = 0x9290
+	TagSubSecTimeOriginal          = 0x9291
+	TagSubSecTimeDigitized         = 0x9292
+	TagFlashpixVersion             = 0xa000
+	TagColorSpace                  = 0xa001
+	TagPixelXDimension             = 0xa002
+	TagPixelYDimension             = 0xa003
+	TagInteroperabilityIFD         = 0xa005
+	TagFocalPlaneXResolution       = 0xa20e
+	TagFocalPlaneYResolution       = 0xa20f
+	TagFocalPlaneResolutionUnit    = 0xa210
+	TagSensingMethod               = 0xa217
+	TagFileSource                  = 0xa300
+	TagSceneType                   = 0xa301
+	TagCFAPattern                  = 0xa302
+	TagCustomRendered              = 0xa401
+	TagExposureMode                = 0xa402
+	TagWhiteBalance                = 0xa403
+	TagDigitalZoomRatio            = 0xa404
+	TagFocalLengthIn35mmFilm       = 0xa405
+	TagSceneCaptureType            = 0xa406
+	TagGainControl                 = 0xa407
+	TagContrast                    = 0xa408
+	TagSaturation                  = 0xa409
+	TagSharpness                   = 0xa40a
+	TagSubjectDistanceRange        = 0xa40c
+	TagImageUniqueID               = 0xa420
+	TagCameraOwnerName             = 0xa430
+	TagBodySerialNumber            = 0xa431
+	TagLensSpecification           = 0xa432
+	TagLensMake                    = 0xa433
+	TagLensModel                   = 0xa434
+	TagLensSerialNumber            = 0xa435
+	TagPrintIM                     = 0xc4a5
+	TagDNGVersion                  = 0xc612
+	TagDNGBackwardVersion          = 0xc613
+	TagUniqueCameraModel           = 0xc614
+	TagLocalizedCameraModel        = 0xc615
+	TagBlackLevel                  = 0xc61a
+	TagWhiteLevel                  = 0xc61d
+	TagColorMatrix1                = 0xc621
+	TagColorMatrix2                = 0xc622
+	TagAnalogBalance               = 0xc627
+	TagAsShotNeutral               = 0xc628
+	TagCameraSerialNumber          = 0xc62f
+	TagDNGPrivateData              = 0xc634
+	TagCalibrationIlluminant1      = 0xc65a
+	TagCalibrationIlluminant2      = 0xc65b
+	TagOriginalRawFileName         = 0xc68b
+	TagCameraCalibrationSignature  = 0xc6f3
+
+	// the tags of composite images, of EXIF 2.32
+	TagCompositeImage                      = 0xa460
+	TagSourceImageNumberOfCompositeImage   = 0xa461
+	TagSourceExposureTimesOfCompositeImage = 0xa462
+
+	// the location of the main subject
+	TagSubjectArea     = 0x9214
+	TagSubjectLocation = 0xa214
+)
+
+// Tags of the GPS IFD.
+const (
+	TagGPSVersionID         = 0x0000
+	TagGPSLatitudeRef       = 0x0001
+	TagGPSLatitude          = 0x0002
+	TagGPSLongitudeRef      = 0x0003
+	TagGPSLongitude         = 0x0004
+	TagGPSAltitudeRef       = 0x0005
+	TagGPSAltitude          = 0x0006
+	TagGPSTimeStamp         = 0x0007
+	TagGPSSatellites        = 0x0008
+	TagGPSStatus            = 0x0009
+	TagGPSMeasureMode       = 0x000a
+	TagGPSDOP               = 0x000b
+	TagGPSSpeedRef          = 0x000c
+	TagGPSSpeed             = 0x000d
+	TagGPSTrackRef          = 0x000e
+	TagGPSTrack             = 0x000f
+	TagGPSImgDirectionRef   = 0x0010
+	TagGPSImgDirection      = 0x0011
+	TagGPSMapDatum          = 0x0012
+	TagGPSDestLatitudeRef   = 0x0013
+	TagGPSDestLatitude      = 0x0014
+	TagGPSDestLongitudeRef  = 0x0015
+	TagGPSDestLongitude     = 0x0016
+	TagGPSProcessingMethod  = 0x001b
+	TagGPSAreaInformation   = 0x001c
+	TagGPSDateStamp         = 0x001d
+	TagGPSDifferential      = 0x001e
+	TagGPSHPositioningError = 0x001f
+)
+
+// Tags of the interoperability IFD.
+const (
+	TagInteroperabilityIndex   = 0x0001
+	TagInteroperabilityVersion = 0x0002
+)
+
+// TagName returns the name of a tag of the main, SubIFD, or EXIF IFDs,
+// e.g., "DateTimeOriginal"; empty if unknown.
+func TagName(tag uint16) string {
+	return names[tag]
+}
+
+// GPSTagName returns the name of a tag of the GPS IFD, e.g.,
+// "GPSLatitude"; empty if unknown.
+func GPSTagName(tag uint16) string {
+	return gpsNames[tag]
+}
+
+// InteropTagName returns the name of a tag of the interoperability IFD,
+// e.g., "InteroperabilityIndex"; empty if unknown.
+func InteropTagName(tag uint16) string {
+	return interopNames[tag]
+}
+
+// names are the names of the tags of the main, SubIFD, and EXIF IFDs.
+var names = map[uint16]string{
+	TagProcessingSoftware:          "ProcessingSoftware",
+	TagNewSubfileType:              "NewSubfileType",
+	TagSubfileType:                 "SubfileType",
+	TagImageWidth:                  "ImageWidth",
+	TagImageLength:                 "ImageLength",
+	TagBitsPerSample:               "BitsPerSample",
+	TagCompression:                 "Compression",
+	TagPhotometricInterpretation:   "PhotometricInterpretation",
+	TagImageDescription:            "ImageDescription",
+	TagMake:                        "Make",
+	TagModel:                       "Model",
+	TagStripOffsets:                "StripOffsets",
+	TagOrientation:                 "Orientation",
+	TagSamplesPerPixel:             "SamplesPerPixel",
+	TagRowsPerStrip:                "RowsPerStrip",
+	TagStripByteCounts:             "StripByteCounts",
+	TagXResolution:                 "XResolution",
+	TagYResolution:                 "YResolution",
+	TagPlanarConfiguration:         "PlanarConfiguration",
+	TagResolutionUnit:              "ResolutionUnit",
+	TagSoftware:                    "Software",
+	TagDateTime:                    "DateTime",
+	TagArtist:                      "Artist",
+	TagWhitePoint:                  "WhitePoint",
+	TagPrimaryChromaticities:       "PrimaryChromaticities",
+	TagTileWidth:                   "TileWidth",
+	TagTileLength:                  "TileLength",
+	TagTileOffsets:                 "TileOffsets",
+	TagTileByteCounts:              "TileByteCounts",
+	TagSubIFDs:                     "SubIFDs",
+	TagSampleFormat:                "SampleFormat",
+	TagJPEGInterchangeFormat:       "JPEGInterchangeFormat",
+	TagJPEGInterchangeFormatLength: "JPEGInterchangeFormatLength",
+	TagYCbCrCoefficients:           "YCbCrCoefficients",
+	TagYCbCrSubSampling:            "YCbCrSubSampling",
+	TagYCbCrPositioning:            "YCbCrPositioning",
+	TagReferenceBlackWhite:         "ReferenceBlackWhite",
+	TagXMP:                         "XMP",
+	TagCFARepeatPatternDim:         "CFARepeatPatternDim",
+	TagTIFFEPCFAPattern:            "CFAPattern",
+	TagCopyright:                   "Copyright",
+	TagExposureTime:                "ExposureTime",
+	TagFNumber:                     "FNumber",
+	TagIPTC:                        "IPTC",
+	TagExifIFD:                     "ExifIFD",
+	TagICCProfile:                  "ICCProfile",
+	TagExposureProgram:             "ExposureProgram",
+	TagGPSInfoIFD:                  "GPSInfoIFD",
+	TagISOSpeedRatings:             "ISOSpeedRatings",
+	TagSensitivityType:             "SensitivityType",
+	TagRecommendedExposureIndex:    "RecommendedExposureIndex",
+	TagExifVersion:                 "ExifVersion",
+	TagDateTimeOriginal:            "DateTimeOriginal",
+	TagDateTimeDigitized:           "DateTimeDigitized",
+	TagOffsetTime:                  "OffsetTime",
+	TagOffsetTimeOriginal:          "OffsetTimeOriginal",
+	TagOffsetTimeDigitized:         "OffsetTimeDigitized",
+	TagComponentsConfiguration:     "ComponentsConfiguration",
+	TagCompressedBitsPerPixel:      "CompressedBitsPerPixel",
+	TagShutterSpeedValue:           "ShutterSpeedValue",
+	TagApertureValue:               "ApertureValue",
+	TagExposureBiasValue:           "ExposureBiasValue",
+	TagMaxApertureValue:            "MaxApertureValue",
+	TagSubjectDistance:             "SubjectDistance",
+	TagMeteringMode:                "MeteringMode",
+	TagLightSource:                 "LightSource",
+	TagFlash:                       "Flash",
+	TagFocalLength:                 "FocalLength",
+	TagImageNumber:                 "ImageNumber",
+	TagTIFFEPSensingMethod:         "SensingMethod",
+	TagMakerNote:                   "MakerNote",
+	TagUserComment:                 "UserComment",
+	TagSubSecTime:                  "SubSecTime",
+	TagSubSecTimeOriginal:          "SubSecTimeOriginal",
+	TagSubSecTimeDigitized:         "SubSecTimeDigitized",
+	TagFlashpixVersion:             "FlashpixVersion",
+	TagColorSpace:                  "ColorSpace",
+	TagPixelXDimension:             "PixelXDimension",
+	TagPixelYDimension:             "PixelYDimension",
+	TagInteroperabilityIFD:         "InteroperabilityIFD",
+	TagFocalPlaneXResolution:       "FocalPlaneXResolution",
+	TagFocalPlaneYResolution:       "FocalPlaneYResolution",
+	TagFocalPlaneResolutionUnit:    "FocalPlaneResolutionUnit",
+	TagSensingMethod:               "SensingMethod",
+	TagFileSource:                  "FileSource",
+	TagSceneType:                   "SceneType",
+	TagCFAPattern:                  "CFAPattern",
+	TagCustomRendered:              "CustomRendered",
+	TagExposureMode:                "ExposureMode",
+	TagWhiteBalance:                "WhiteBalance",
+	TagDigitalZoomRatio:            "DigitalZoomRatio",
+	TagFocalLengthIn35mmFilm:       "FocalLengthIn35mmFilm",
+	TagSceneCaptureType:            "SceneCaptureType",
+	TagGainControl:                 "GainControl",
+	TagContrast:                    "Contrast",
+	TagSaturation:                  "Saturation",
+	TagSharpness:                   "Sharpness",
+	TagSubjectDistanceRange:        "SubjectDistanceRange",
+	TagImageUniqueID:               "ImageUniqueID",
+	TagCameraOwnerName:             "CameraOwnerName",
+	TagBodySerialNumber:            "BodySerialNumber",
+	TagLensSpecification:           "LensSpecification",
+	TagLensMake:                    "LensMake",
+	TagLensModel:                   "LensModel",
+	TagLensSerialNumber:            "LensSerialNumber",
+	TagPrintIM:                     "PrintIM",
+	TagDNGVersion:                  "DNGVersion",
+	TagDNGBackwardVersion:          "DNGBackwardVersion",
+	TagUniqueCameraModel:           "UniqueCameraModel",
+	TagLocalizedCameraModel:        "LocalizedCameraModel",
+	TagBlackLevel:                  "BlackLevel",
+	TagWhiteLevel:                  "WhiteLevel",
+	TagColorMatrix1:                "ColorMatrix1",
+	TagColorMatrix2:                "ColorMatrix2",
+	TagAnalogBalance:               "AnalogBalance",
+	TagAsShotNeutral:               "AsShotNeutral",
+	TagCameraSerialNumber:          "CameraSerialNumber",
+	TagDNGPrivateData:              "DNGPrivateData",
+	TagCalibrationIlluminant1:      "CalibrationIlluminant1",
+	TagCalibrationIlluminant2:      "CalibrationIlluminant2",
+	TagOriginalRawFileName:         "OriginalRawFileName",
+	TagCameraCalibrationSignature:  "CameraCalibrationSignature",
+
+	TagCompositeImage:                      "CompositeImage",
+	TagSourceImageNumberOfCompositeImage:   "SourceImageNumberOfCompositeImage",
+	TagSourceExposureTimesOfCompositeImage: "SourceExposureTimesOfCompositeImage",
+
+	TagSubjectArea:     "SubjectArea",
+	TagSubjectLocation: "SubjectLocation",
+}
+
+// gpsNames are the names of the tags of the GPS IFD.
+var gpsNames = map[uint16]string{
+	TagGPSVersionID:         "GPSVersionID",
+	TagGPSLatitudeRef:       "GPSLatitudeRef",
+	TagGPSLatitude:          "GPSLatitude",
+	TagGPSLongitudeRef:      "GPSLongitudeRef",
+	TagGPSLongitude:         "GPSLongitude",
+	TagGPSAltitudeRef:       "GPSAltitudeRef",
+	TagGPSAltitude:          "GPSAltitude",
+	TagGPSTimeStamp:         "GPSTimeStamp",
+	TagGPSSatellites:        "GPSSatellites",
+	TagGPSStatus:            "GPSStatus",
+	TagGPSMeasureMode:       "GPSMeasureMode",
+	TagGPSDOP:               "GPSDOP",
+	TagGPSSpeedRef:          "GPSSpeedRef",
+	TagGPSSpeed:             "GPSSpeed",
+	TagGPSTrackRef:          "GPSTrackRef",
+	TagGPSTrack:             "GPSTrack",
+	TagGPSImgDirectionRef:   "GPSImgDirectionRef",
+	TagGPSImgDirection:      "GPSImgDirection",
+	TagGPSMapDatum:          "GPSMapDatum",
+	TagGPSDestLatitudeRef:   "GPSDestLatitudeRef",
+	TagGPSDestLatitude:      "GPSDestLatitude",
+	TagGPSDestLongitudeRef:  "GPSDestLongitudeRef",
+	TagGPSDestLongitude:     "GPSDestLongitude",
+	TagGPSProcessingMethod:  "GPSProcessingMethod",
+	TagGPSAreaInformation:   "GPSAreaInformation",
+	TagGPSDateStamp:         "GPSDateStamp",
+	TagGPSDifferential:      "GPSDifferential",
+	TagGPSHPositioningError: "GPSHPositioningError",
+}
+
+// interopNames are the names of the tags of the interoperability IFD.
+var interopNames = map[uint16]string{
+	TagInteroperabilityIndex:   "InteroperabilityIndex",
+	TagInteroperabilityVersion: "InteroperabilityVersion",
+}
@@ -0,0 +1,51 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package tags
+
+import "testing"
+
+func TestTagName(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"TagOrientation", TagName(TagOrientation), "Orientation"},
+		{"TagDateTimeOriginal", TagName(TagDateTimeOriginal), "DateTimeOriginal"},
+		{"TagTIFFEPSensingMethod", TagName(TagTIFFEPSensingMethod), "SensingMethod"},
+		{"TagGPSLatitude", GPSTagName(TagGPSLatitude), "GPSLatitude"},
+		{"TagInteroperabilityIndex", InteropTagName(TagInteroperabilityIndex), "InteroperabilityIndex"},
+		{"unknown", TagName(0xfffe), ""},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: expected %q; got %q\n", test.name, test.want, test.got)
+		}
+	}
+
+	// the namespaces overlap
+	if TagGPSLatitudeRef != TagInteroperabilityIndex || GPSTagName(0x0001) == InteropTagName(0x0001) {
+		t.Errorf("Expected distinct names of tag 0x0001\n")
+	}
+}
@@ -0,0 +1,178 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"container/list"
+	"sort"
+)
+
+// TagStats is a struct representing the number of IFD entries parsed from a
+// raw file, distinguishing the tags recognized by the parser from those that
+// are currently ignored.
+type TagStats struct {
+	// Parsed is the total number of IFD entries parsed.
+	Parsed int `json:"parsed"`
+
+	// Recognized is the number of IFD entries whose tag is used by the parser.
+	Recognized int `json:"recognized"`
+
+	// Unknown is the number of IFD entries whose tag is ignored by the parser.
+	Unknown int `json:"unknown"`
+
+	// UnknownTags is the sorted, de-duplicated list of ignored tag IDs.
+	// Only populated if RawFileInfo.CollectUnknownTags is set.
+	UnknownTags []uint16 `json:"unknownTags,omitempty"`
+}
+
+var (
+	// ifd0Tags are the IFD0 (and CR2 IFD1-3) tags used by the parsers.
+	ifd0Tags = map[uint16]bool{
+		0x00fe: true, // NewSubfileType
+		0x0100: true, // ImageWidth
+		0x0101: true, // ImageLength
+		0x0103: true, // Compression
+		0x010f: true, // Make
+		0x0110: true, // Model
+		0x0111: true, // StripOffsets
+		0x0112: true, // Orientation
+		0x0117: true, // StripByteCounts
+		0x011a: true, // XResolution
+		0x011b: true, // YResolution
+		0x0132: true, // DateTime
+		0x013b: true, // Artist
+		0x014a: true, // SubIFDs
+		0x0201: true, // JPEGInterchangeFormat
+		0x0202: true, // JPEGInterchangeFormatLength
+		0x02bc: true, // XMP
+		0x4746: true, // Rating
+		0x8298: true, // Copyright
+		0x8769: true, // ExifIFD
+		0x8825: true, // GPSInfoIFD
+		0xc612: true, // DNGVersion
+		0xc62f: true, // CameraSerialNumber
+		0xc630: true, // LensInfo
+	}
+
+	// exifTags are the EXIF IFD tags used by the parsers.
+	exifTags = map[uint16]bool{
+		0x8822: true, // ExposureProgram
+		0x9003: true, // DateTimeOriginal
+		0x9004: true, // DateTimeDigitized
+		0x9010: true, // OffsetTime
+		0x9011: true, // OffsetTimeOriginal
+		0x9012: true, // OffsetTimeDigitized
+		0x9204: true, // ExposureBiasValue
+		0x9207: true, // MeteringMode
+		0x9209: true, // Flash
+		0x9214: true, // SubjectArea
+		0x9291: true, // SubSecTimeOriginal
+		0x9211: true, // ImageNumber
+		0x9292: true, // SubSecTimeDigitized
+		0xa001: true, // ColorSpace
+		0xa005: true, // InteroperabilityIFD
+		0xa214: true, // SubjectLocation
+		0xa402: true, // ExposureMode
+		0xa420: true, // ImageUniqueID
+		0xa431: true, // BodySerialNumber
+		0xa432: true, // LensSpecification
+		0xa433: true, // LensMake
+		0xa434: true, // LensModel
+		0xa435: true, // LensSerialNumber
+		0xa460: true, // CompositeImage
+		0xa461: true, // SourceImageNumberOfCompositeImage
+	}
+
+	// nefExifTags are the EXIF IFD tags used by the NEF parser.
+	nefExifTags = withTags(exifTags, 0x927c) // MakerNote
+
+	// cr2ExifTags are the EXIF IFD tags used by the CR2 parser.
+	cr2ExifTags = withTags(exifTags, 0x927c) // MakerNote
+
+	// gpsTags are the GPS IFD tags used by the parsers.
+	gpsTags = map[uint16]bool{
+		0x0007: true, // GPSTimeStamp
+		0x001d: true, // GPSDateStamp
+	}
+
+	// interopTags are the interoperability IFD tags used by the parsers.
+	interopTags = map[uint16]bool{
+		0x0001: true, // InteroperabilityIndex
+	}
+)
+
+// withTags extends a set of recognized tags.
+// Returns a new set of the recognized tags and the additional tags.
+func withTags(recognized map[uint16]bool, tags ...uint16) map[uint16]bool {
+	s := make(map[uint16]bool, len(recognized)+len(tags))
+	for tag := range recognized {
+		s[tag] = true
+	}
+	for _, tag := range tags {
+		s[tag] = true
+	}
+	return s
+}
+
+// tagStats is a struct accumulating TagStats while processing IFDs.
+type tagStats struct {
+	parsed, recognized int
+	unknown            map[uint16]int
+}
+
+// record tallies the entries of a processed IFD against the set of tags
+// recognized for that IFD.
+func (s *tagStats) record(entries *list.List, recognized map[uint16]bool) {
+	if s.unknown == nil {
+		s.unknown = make(map[uint16]int)
+	}
+
+	for e := entries.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(IfdEntry)
+		s.parsed++
+		if recognized[entry.tag] {
+			s.recognized++
+		} else {
+			s.unknown[entry.tag]++
+		}
+	}
+}
+
+// toTagStats converts the accumulated statistics into a TagStats.  The list
+// of unknown tag IDs is only included if collectUnknown is true.
+func (s *tagStats) toTagStats(collectUnknown bool) TagStats {
+	t := TagStats{Parsed: s.parsed, Recognized: s.recognized}
+
+	for tag, count := range s.unknown {
+		t.Unknown += count
+		if collectUnknown {
+			t.UnknownTags = append(t.UnknownTags, tag)
+		}
+	}
+	sort.Slice(t.UnknownTags, func(i, j int) bool {
+		return t.UnknownTags[i] < t.UnknownTags[j]
+	})
+
+	return t
+}
@@ -0,0 +1,84 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"sync"
+	"time"
+)
+
+// throttle limits the rate at which the files of a batch are started, by
+// files and by bytes read per second, shared by the workers.  A zero rate
+// is unlimited.
+type throttle struct {
+	filesPerSec float64
+	bytesPerSec int64
+
+	mu sync.Mutex
+	// next is the time the next file may start.
+	next time.Time
+}
+
+// wait blocks until the next file may start, or until done is closed.
+// Returns false if done was closed.
+func (t *throttle) wait(done <-chan struct{}) bool {
+	t.mu.Lock()
+	now := time.Now()
+	start := t.next
+	if start.Before(now) {
+		start = now
+	}
+	t.next = start
+	if t.filesPerSec > 0 {
+		t.next = start.Add(time.Duration(float64(time.Second) / t.filesPerSec))
+	}
+	t.mu.Unlock()
+
+	d := start.Sub(now)
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// charge delays the next file by the time n bytes take at the byte rate.
+func (t *throttle) charge(n int64) {
+	if t.bytesPerSec <= 0 || n <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	t.next = t.next.Add(time.Duration(float64(n) / float64(t.bytesPerSec) * float64(time.Second)))
+}
@@ -0,0 +1,269 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package tiff
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// ErrEncode is returned when IFDs cannot be encoded.
+var ErrEncode = errors.New("tiff: cannot encode")
+
+// NewEntry creates an entry with a value, in a byte order, e.g., to add a
+// tag to an IFD to encode.
+// Returns the entry.
+func NewEntry(order binary.ByteOrder, tag uint16, typ Type, count uint32, value []byte) Entry {
+	e := Entry{Tag: tag, Type: typ, Count: count, order: order, value: value}
+	if e.Inline() {
+		v := make([]byte, 4)
+		copy(v, value)
+		e.ValueOffset = order.Uint32(v)
+	}
+	return e
+}
+
+// ReadAll reads the IFDs of TIFF data, e.g., the EXIF data of a JPEG as
+// exposed by EXIF libraries (the Raw field of goexif's exif.Exif), in the
+// order visited by WalkIFDs.
+// Returns the IFDs or error.
+func ReadAll(r io.ReaderAt) ([]*IFD, error) {
+	h, err := ReadHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var ifds []*IFD
+	err = WalkIFDs(r, h, func(ifd *IFD) error {
+		ifds = append(ifds, ifd)
+		return nil
+	})
+	return ifds, err
+}
+
+// encodedIFD is an IFD laid out by Encode.
+type encodedIFD struct {
+	ifd     *IFD
+	entries []Entry
+	values  [][]byte // of the entries, in the byte order of the output
+	offset  int64
+	size    int64 // of the entry table and the values
+
+	// children are the IFDs referenced by the pointer entries of the IFD,
+	// by tag.
+	children map[uint16]*encodedIFD
+}
+
+// Encode encodes IFDs as TIFF data in a byte order: the main chain, in
+// order, and the EXIF, GPS, and interoperability IFDs, which are
+// referenced from IFD0 and the EXIF IFD, respectively.  This is the format
+// of the EXIF data of a JPEG (APP1) and is read by EXIF libraries, e.g.,
+// goexif's exif.Decode.  The values of the entries are read from the file
+// of the IFDs and converted to the byte order.  Entries referencing data
+// by offset, other than the IFD pointers (e.g., SubIFDs or strips), are
+// not valid in the output; the caller excludes them.
+// Returns the TIFF data or error wrapping ErrEncode.
+func Encode(order binary.ByteOrder, ifds []*IFD) ([]byte, error) {
+	var main []*IFD
+	byKind := make(map[Kind]*IFD)
+	for _, ifd := range ifds {
+		switch ifd.Kind {
+		case KindMain:
+			main = append(main, ifd)
+		case KindExif, KindGPS, KindInterop:
+			if byKind[ifd.Kind] != nil {
+				return nil, fmt.Errorf("%w: multiple %s IFDs", ErrEncode, ifd.Kind)
+			}
+			byKind[ifd.Kind] = ifd
+		default:
+			return nil, fmt.Errorf("%w: %s IFDs are not supported", ErrEncode, ifd.Kind)
+		}
+	}
+	if len(main) == 0 {
+		return nil, fmt.Errorf("%w: no main IFD", ErrEncode)
+	}
+	if byKind[KindInterop] != nil && byKind[KindExif] == nil {
+		return nil, fmt.Errorf("%w: interoperability IFD without EXIF IFD", ErrEncode)
+	}
+
+	// the layout: IFD0, its children, then the rest of the chain
+	var layout []*encodedIFD
+	add := func(ifd *IFD) *encodedIFD {
+		e := &encodedIFD{ifd: ifd, children: make(map[uint16]*encodedIFD)}
+		layout = append(layout, e)
+		return e
+	}
+	ifd0 := add(main[0])
+	if exif := byKind[KindExif]; exif != nil {
+		e := add(exif)
+		ifd0.children[TagExifIFD] = e
+		if interop := byKind[KindInterop]; interop != nil {
+			e.children[TagInteropIFD] = add(interop)
+		}
+	}
+	if gps := byKind[KindGPS]; gps != nil {
+		ifd0.children[TagGPSIFD] = add(gps)
+	}
+	for _, ifd := range main[1:] {
+		add(ifd)
+	}
+
+	offset := int64(8)
+	for _, e := range layout {
+		if err := e.prepare(order); err != nil {
+			return nil, err
+		}
+		e.offset = offset
+		offset += e.size
+	}
+	if offset > 1<<32-1 {
+		return nil, fmt.Errorf("%w: %d bytes exceed 4 GiB", ErrEncode, offset)
+	}
+
+	ao, ok := order.(binary.AppendByteOrder)
+	if !ok {
+		return nil, fmt.Errorf("%w: byte order %v", ErrEncode, order)
+	}
+
+	b := make([]byte, 0, offset)
+	if order == binary.BigEndian {
+		b = append(b, 'M', 'M')
+	} else {
+		b = append(b, 'I', 'I')
+	}
+	b = ao.AppendUint16(b, 42)
+	b = ao.AppendUint32(b, 8)
+
+	for i, e := range layout {
+		var next int64
+		if e.ifd.Kind == KindMain {
+			for _, n := range layout[i+1:] {
+				if n.ifd.Kind == KindMain {
+					next = n.offset
+					break
+				}
+			}
+		}
+		b = e.append(b, ao, next)
+	}
+	return b, nil
+}
+
+// prepare determines the entries of the IFD, sorted by tag, with the
+// pointer entries of its children, and their values.
+// Returns error.
+func (e *encodedIFD) prepare(order binary.ByteOrder) error {
+	e.entries = e.entries[:0]
+	for _, entry := range e.ifd.Entries {
+		switch entry.Tag {
+		case TagExifIFD, TagGPSIFD, TagInteropIFD:
+			// replaced by the children
+			if e.ifd.Kind == KindMain || e.ifd.Kind == KindExif {
+				continue
+			}
+		}
+		e.entries = append(e.entries, entry)
+	}
+	for tag := range e.children {
+		e.entries = append(e.entries, Entry{Tag: tag, Type: Long, Count: 1})
+	}
+	slices.SortStableFunc(e.entries, func(a, b Entry) int {
+		return int(a.Tag) - int(b.Tag)
+	})
+
+	e.values = make([][]byte, len(e.entries))
+	e.size = 2 + int64(len(e.entries))*entrySize + 4
+	for i := range e.entries {
+		entry := &e.entries[i]
+		if e.children[entry.Tag] != nil && entry.order == nil {
+			continue
+		}
+		v, err := entry.Bytes()
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrEncode, err)
+		}
+		if entry.order != order {
+			swapValue(v, entry.Type)
+		}
+		e.values[i] = v
+		if !entry.Inline() {
+			e.size += int64(len(v) + len(v)%2) // word aligned
+		}
+	}
+	return nil
+}
+
+// append appends the encoded IFD, the entry table followed by the values
+// not stored inline.
+// Returns the extended buffer.
+func (e *encodedIFD) append(b []byte, order binary.AppendByteOrder, next int64) []byte {
+	valueOffset := e.offset + 2 + int64(len(e.entries))*entrySize + 4
+
+	b = order.AppendUint16(b, uint16(len(e.entries)))
+	for i, entry := range e.entries {
+		b = order.AppendUint16(b, entry.Tag)
+		b = order.AppendUint16(b, uint16(entry.Type))
+		b = order.AppendUint32(b, entry.Count)
+
+		switch v := e.values[i]; {
+		case v == nil:
+			b = order.AppendUint32(b, uint32(e.children[entry.Tag].offset))
+		case entry.Inline():
+			inline := make([]byte, 4)
+			copy(inline, v)
+			b = append(b, inline...)
+		default:
+			b = order.AppendUint32(b, uint32(valueOffset))
+			valueOffset += int64(len(v) + len(v)%2)
+		}
+	}
+	b = order.AppendUint32(b, uint32(next))
+
+	for i, entry := range e.entries {
+		if v := e.values[i]; v != nil && !entry.Inline() {
+			b = append(b, v...)
+			if len(v)%2 != 0 {
+				b = append(b, 0)
+			}
+		}
+	}
+	return b
+}
+
+// swapValue converts a value between byte orders, in place.
+func swapValue(v []byte, t Type) {
+	unit := t.Size()
+	switch t {
+	case Rational, SRational:
+		unit = 4
+	case Byte, ASCII, SByte, Undefined:
+		return
+	}
+	for i := 0; i+unit <= len(v); i += unit {
+		slices.Reverse(v[i : i+unit])
+	}
+}
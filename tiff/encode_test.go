@@ -0,0 +1,107 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package tiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	le := binary.LittleEndian
+	ifd0 := &IFD{Kind: KindMain, Entries: []Entry{
+		NewEntry(le, 0x0110, ASCII, 6, []byte("Model\x00")),
+		NewEntry(le, 0x0112, Short, 1, []byte{6, 0}),
+		NewEntry(le, TagExifIFD, Long, 1, []byte{0xff, 0, 0, 0}), // stale pointer
+	}}
+	exif := &IFD{Kind: KindExif, Entries: []Entry{
+		NewEntry(le, 0x829a, Rational, 1, []byte{1, 0, 0, 0, 250, 0, 0, 0}),
+		NewEntry(le, 0x9003, ASCII, 20, []byte("2009:03:07 18:28:10\x00")),
+	}}
+	gps := &IFD{Kind: KindGPS, Entries: []Entry{
+		NewEntry(le, 0x0002, Rational, 3, []byte{
+			35, 0, 0, 0, 1, 0, 0, 0,
+			39, 0, 0, 0, 1, 0, 0, 0,
+			0, 0, 0, 0, 1, 0, 0, 0}),
+	}}
+	ifd1 := &IFD{Kind: KindMain, Index: 1, Entries: []Entry{
+		NewEntry(le, 0x0100, Long, 1, []byte{0x40, 0, 0, 0}),
+	}}
+
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		data, err := Encode(order, []*IFD{ifd0, exif, gps, ifd1})
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v\n", order, err)
+		}
+
+		ifds, err := ReadAll(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v\n", order, err)
+		}
+		kinds := make(map[Kind]*IFD)
+		for _, ifd := range ifds {
+			kinds[ifd.Kind] = ifd
+		}
+		if len(ifds) != 4 || kinds[KindExif] == nil || kinds[KindGPS] == nil {
+			t.Fatalf("%v: unexpected IFDs: %+v\n", order, ifds)
+		}
+
+		want := map[*Entry]any{
+			ifds[0].Find(0x0110):         "Model",
+			ifds[0].Find(0x0112):         []uint16{6},
+			kinds[KindExif].Find(0x829a): []RationalValue{{1, 250}},
+			kinds[KindExif].Find(0x9003): "2009:03:07 18:28:10",
+			kinds[KindGPS].Find(0x0002):  []RationalValue{{35, 1}, {39, 1}, {0, 1}},
+			kinds[KindMain].Find(0x0100): []uint32{0x40},
+		}
+		for e, w := range want {
+			if e == nil {
+				t.Errorf("%v: missing entry of %v\n", order, w)
+				continue
+			}
+			if v, err := e.Value(); err != nil || !reflect.DeepEqual(v, w) {
+				t.Errorf("%v: tag 0x%04x: expected %v; got %v, %v\n", order, e.Tag, w, v, err)
+			}
+		}
+	}
+}
+
+func TestEncodeUnsupported(t *testing.T) {
+	le := binary.LittleEndian
+	tests := [][]*IFD{
+		nil,
+		{{Kind: KindSub}},
+		{{Kind: KindMain}, {Kind: KindInterop}},
+		{{Kind: KindMain}, {Kind: KindGPS}, {Kind: KindGPS}},
+		{{Kind: KindMain, Entries: []Entry{NewEntry(le, 0x0110, ASCII, 8, []byte("short"))}}},
+	}
+	for i, ifds := range tests {
+		if _, err := Encode(le, ifds); !errors.Is(err, ErrEncode) {
+			t.Errorf("%d: expected ErrEncode; got %v\n", i, err)
+		}
+	}
+}
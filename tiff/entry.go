@@ -0,0 +1,370 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package tiff
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// MaxValueSize is the largest entry value, in bytes, that is read.  Larger
+// values are rejected to bound the memory used by corrupt files.
+const MaxValueSize = 64 << 20
+
+// ErrValueType is returned when the value of an entry is requested as a
+// type it cannot be converted to.
+var ErrValueType = errors.New("tiff: unexpected value type")
+
+// Type is the field type of an IFD entry.
+type Type uint16
+
+// Field types defined by the TIFF 6.0 specification, the IFD type of TIFF
+// Technical Note 1, and the 8-byte types of BigTIFF.
+const (
+	Byte      Type = 1
+	ASCII     Type = 2
+	Short     Type = 3
+	Long      Type = 4
+	Rational  Type = 5
+	SByte     Type = 6
+	Undefined Type = 7
+	SShort    Type = 8
+	SLong     Type = 9
+	SRational Type = 10
+	Float     Type = 11
+	Double    Type = 12
+	IFDType   Type = 13
+	Long8     Type = 16
+	SLong8    Type = 17
+	IFD8      Type = 18
+)
+
+// Size returns the size, in bytes, of a single value of the type; 0 if the
+// type is unknown.
+func (t Type) Size() int {
+	switch t {
+	case Byte, ASCII, SByte, Undefined:
+		return 1
+	case Short, SShort:
+		return 2
+	case Long, SLong, Float, IFDType:
+		return 4
+	case Rational, SRational, Double, Long8, SLong8, IFD8:
+		return 8
+	}
+	return 0
+}
+
+// RationalValue is an unsigned fraction.
+type RationalValue struct {
+	Num, Den uint32
+}
+
+// SRationalValue is a signed fraction.
+type SRationalValue struct {
+	Num, Den int32
+}
+
+// Entry is a struct representing an IFD entry.
+type Entry struct {
+	Tag   uint16
+	Type  Type
+	Count uint32
+
+	// ValueOffset is the value, if the value fits within 4 bytes, or the
+	// offset of the value.  Inline values are left-justified: use Bytes or
+	// Value to read them.  The offsets of 4 GB or more of a BigTIFF are
+	// saturated: use Offset.  The Count of a BigTIFF entry is saturated
+	// likewise, as such values exceed MaxValueSize.
+	ValueOffset uint32
+
+	// Offset is the offset of the value from the start of the file or, if
+	// Inline, of the value field of the entry; 0 for an entry created by
+	// NewEntry.
+	Offset int64
+
+	order binary.ByteOrder
+	r     io.ReaderAt
+
+	// big is set for an entry of a BigTIFF, whose value field is 8 bytes.
+	big bool
+
+	// value is the value of an entry created by NewEntry.
+	value []byte
+}
+
+// Size returns the size, in bytes, of the value of the entry.
+func (e *Entry) Size() int64 {
+	return int64(e.Count) * int64(e.Type.Size())
+}
+
+// Inline determines if the value is stored within the entry: within 4
+// bytes, or 8 bytes for BigTIFF.
+func (e *Entry) Inline() bool {
+	if e.big {
+		return e.Size() <= 8
+	}
+	return e.Size() <= 4
+}
+
+// Bytes reads the bytes of the value, in file byte order.
+// Returns the bytes or error.
+func (e *Entry) Bytes() ([]byte, error) {
+	size := e.Size()
+	if e.Type.Size() == 0 {
+		return nil, fmt.Errorf("%w: unknown type %d of tag 0x%04x", ErrValueType, e.Type, e.Tag)
+	}
+	if size > MaxValueSize {
+		return nil, fmt.Errorf("tiff: value of tag 0x%04x too large: %d bytes", e.Tag, size)
+	}
+
+	if e.value != nil {
+		if int64(len(e.value)) != size {
+			return nil, fmt.Errorf("tiff: value of tag 0x%04x: %d bytes, expected %d", e.Tag, len(e.value), size)
+		}
+		return append([]byte(nil), e.value...), nil
+	}
+
+	b := make([]byte, size)
+	if e.Inline() && size <= 4 {
+		v := make([]byte, 4)
+		e.order.PutUint32(v, e.ValueOffset)
+		copy(b, v)
+		return b, nil
+	}
+
+	if n, err := e.r.ReadAt(b, e.Offset); n != len(b) {
+		return nil, fmt.Errorf("tiff: reading value of tag 0x%04x: %w", e.Tag, noEOF(err))
+	}
+	return b, nil
+}
+
+// Value reads and decodes the value.  The type of the value depends on the
+// field type: []byte (BYTE, UNDEFINED), string (ASCII), []uint16 (SHORT),
+// []uint32 (LONG, IFD), []RationalValue (RATIONAL), []int8 (SBYTE), []int16
+// (SSHORT), []int32 (SLONG), []SRationalValue (SRATIONAL), []float32
+// (FLOAT), []float64 (DOUBLE), []uint64 (LONG8, IFD8), or []int64 (SLONG8).
+// Returns the value or error.
+func (e *Entry) Value() (any, error) {
+	b, err := e.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	n := int(e.Count)
+	switch e.Type {
+	case Byte, Undefined:
+		return b, nil
+	case ASCII:
+		return strings.TrimRight(string(b), "\x00 "), nil
+	case SByte:
+		v := make([]int8, n)
+		for i := range v {
+			v[i] = int8(b[i])
+		}
+		return v, nil
+	case Short:
+		v := make([]uint16, n)
+		for i := range v {
+			v[i] = e.order.Uint16(b[i*2:])
+		}
+		return v, nil
+	case SShort:
+		v := make([]int16, n)
+		for i := range v {
+			v[i] = int16(e.order.Uint16(b[i*2:]))
+		}
+		return v, nil
+	case Long, IFDType:
+		v := make([]uint32, n)
+		for i := range v {
+			v[i] = e.order.Uint32(b[i*4:])
+		}
+		return v, nil
+	case SLong:
+		v := make([]int32, n)
+		for i := range v {
+			v[i] = int32(e.order.Uint32(b[i*4:]))
+		}
+		return v, nil
+	case Rational:
+		v := make([]RationalValue, n)
+		for i := range v {
+			v[i] = RationalValue{e.order.Uint32(b[i*8:]), e.order.Uint32(b[i*8+4:])}
+		}
+		return v, nil
+	case SRational:
+		v := make([]SRationalValue, n)
+		for i := range v {
+			v[i] = SRationalValue{int32(e.order.Uint32(b[i*8:])), int32(e.order.Uint32(b[i*8+4:]))}
+		}
+		return v, nil
+	case Float:
+		v := make([]float32, n)
+		for i := range v {
+			v[i] = math.Float32frombits(e.order.Uint32(b[i*4:]))
+		}
+		return v, nil
+	case Double:
+		v := make([]float64, n)
+		for i := range v {
+			v[i] = math.Float64frombits(e.order.Uint64(b[i*8:]))
+		}
+		return v, nil
+	case Long8, IFD8:
+		v := make([]uint64, n)
+		for i := range v {
+			v[i] = e.order.Uint64(b[i*8:])
+		}
+		return v, nil
+	case SLong8:
+		v := make([]int64, n)
+		for i := range v {
+			v[i] = int64(e.order.Uint64(b[i*8:]))
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("%w: unknown type %d of tag 0x%04x", ErrValueType, e.Type, e.Tag)
+}
+
+// Uints reads an unsigned integer value (BYTE, SHORT, LONG, or IFD), or a
+// LONG8 or IFD8 value whose values fit within 32 bits.
+// Returns the values or error.
+func (e *Entry) Uints() ([]uint32, error) {
+	v, err := e.Value()
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := v.(type) {
+	case []uint32:
+		return v, nil
+	case []uint64:
+		u := make([]uint32, len(v))
+		for i := range v {
+			if v[i] > math.MaxUint32 {
+				return nil, fmt.Errorf("%w: value %d of tag 0x%04x exceeds 32 bits", ErrValueType, v[i], e.Tag)
+			}
+			u[i] = uint32(v[i])
+		}
+		return u, nil
+	case []uint16:
+		u := make([]uint32, len(v))
+		for i := range v {
+			u[i] = uint32(v[i])
+		}
+		return u, nil
+	case []byte:
+		if e.Type == Byte {
+			u := make([]uint32, len(v))
+			for i := range v {
+				u[i] = uint32(v[i])
+			}
+			return u, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: type %d of tag 0x%04x is not an unsigned integer", ErrValueType, e.Type, e.Tag)
+}
+
+// Uint reads the first value of an unsigned integer value.
+// Returns the value or error.
+func (e *Entry) Uint() (uint32, error) {
+	if e.Count == 0 {
+		return 0, fmt.Errorf("tiff: tag 0x%04x has no value", e.Tag)
+	}
+	if e.Type == Short && e.Inline() {
+		// avoid the allocations of Uints for the most common case
+		v := make([]byte, 4)
+		e.order.PutUint32(v, e.ValueOffset)
+		return uint32(e.order.Uint16(v)), nil
+	}
+	if (e.Type == Long || e.Type == IFDType) && e.Count == 1 {
+		return e.ValueOffset, nil
+	}
+
+	v, err := e.Uints()
+	if err != nil {
+		return 0, err
+	}
+	return v[0], nil
+}
+
+// Uints64 reads an unsigned integer value, as Uints, including the 8-byte
+// values of BigTIFF (e.g., offsets beyond 4 GB).
+// Returns the values or error.
+func (e *Entry) Uints64() ([]uint64, error) {
+	if e.Type != Long8 && e.Type != IFD8 {
+		v, err := e.Uints()
+		if err != nil {
+			return nil, err
+		}
+		u := make([]uint64, len(v))
+		for i := range v {
+			u[i] = uint64(v[i])
+		}
+		return u, nil
+	}
+
+	v, err := e.Value()
+	if err != nil {
+		return nil, err
+	}
+	return v.([]uint64), nil
+}
+
+// Uint64 reads the first value of an unsigned integer value, as Uint,
+// including the 8-byte values of BigTIFF.
+// Returns the value or error.
+func (e *Entry) Uint64() (uint64, error) {
+	if e.Type != Long8 && e.Type != IFD8 {
+		v, err := e.Uint()
+		return uint64(v), err
+	}
+	if e.Count == 0 {
+		return 0, fmt.Errorf("tiff: tag 0x%04x has no value", e.Tag)
+	}
+
+	v, err := e.Uints64()
+	if err != nil {
+		return 0, err
+	}
+	return v[0], nil
+}
+
+// ASCII reads an ASCII value, without trailing NULs and spaces.
+// Returns the value or error.
+func (e *Entry) ASCII() (string, error) {
+	if e.Type != ASCII {
+		return "", fmt.Errorf("%w: type %d of tag 0x%04x is not ASCII", ErrValueType, e.Type, e.Tag)
+	}
+	v, err := e.Value()
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
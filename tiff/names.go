@@ -0,0 +1,82 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package tiff
+
+import (
+	"fmt"
+
+	"github.com/jeremytorres/rawparser/tags"
+)
+
+// String returns the name of the field type, e.g., "SHORT".
+func (t Type) String() string {
+	switch t {
+	case Byte:
+		return "BYTE"
+	case ASCII:
+		return "ASCII"
+	case Short:
+		return "SHORT"
+	case Long:
+		return "LONG"
+	case Rational:
+		return "RATIONAL"
+	case SByte:
+		return "SBYTE"
+	case Undefined:
+		return "UNDEFINED"
+	case SShort:
+		return "SSHORT"
+	case SLong:
+		return "SLONG"
+	case SRational:
+		return "SRATIONAL"
+	case Float:
+		return "FLOAT"
+	case Double:
+		return "DOUBLE"
+	case IFDType:
+		return "IFD"
+	case Long8:
+		return "LONG8"
+	case SLong8:
+		return "SLONG8"
+	case IFD8:
+		return "IFD8"
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// TagName returns the name of a tag of an IFD of a kind, as defined by the
+// TIFF, TIFF/EP, EXIF, and DNG specifications, e.g., "DateTimeOriginal";
+// empty if unknown.  See the tags package for the tags.
+func TagName(kind Kind, tag uint16) string {
+	switch kind {
+	case KindGPS:
+		return tags.GPSTagName(tag)
+	case KindInterop:
+		return tags.InteropTagName(tag)
+	}
+	return tags.TagName(tag)
+}
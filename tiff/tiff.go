@@ -0,0 +1,252 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+// Package tiff provides low-level access to the structure of TIFF-based
+// files: the header, the image file directories (IFDs), and their entries.
+// The raw file parsers of the rawparser package are built on this package;
+// it may be used directly to read tags the parsers do not expose, from any
+// TIFF-based format.
+//
+// BigTIFF, the variant of 8-byte offsets for files over 4 GB, is supported
+// for reading.
+//
+// The TIFF 6.0 specification:
+// http://partners.adobe.com/public/developer/en/tiff/TIFF6.pdf
+package tiff
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ErrInvalidHeader is returned when a file does not begin with a TIFF
+// byte order mark.
+var ErrInvalidHeader = errors.New("tiff: invalid header")
+
+// BigTIFFMagic is the magic value of a BigTIFF header.
+const BigTIFFMagic = 43
+
+// Header is a struct representing a TIFF header.
+//   Byte Order: offset 0, len 2
+//   Magic Value: offset 2, len 2
+//   IFD0 Offset: offset 4, len 4
+// or, for BigTIFF:
+//   Offset Size: offset 4, len 2 (8)
+//   Reserved: offset 6, len 2 (0)
+//   IFD0 Offset: offset 8, len 8
+type Header struct {
+	ByteOrder binary.ByteOrder
+
+	// Magic is 42 for TIFF and BigTIFFMagic for BigTIFF; some raw formats
+	// use their own value (e.g., 0x4f52 for Olympus ORF), therefore it is
+	// not validated.
+	Magic uint16
+
+	// Offset is the offset of IFD0 from the start of the file.
+	Offset int64
+
+	// BigTIFF is set if the IFDs have 8-byte counts and offsets; see
+	// ReadBigIFD.
+	BigTIFF bool
+}
+
+// ReadHeader reads the TIFF header at the start of a file.
+// Returns the header or error.
+func ReadHeader(r io.ReaderAt) (*Header, error) {
+	b := make([]byte, 8)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		return nil, fmt.Errorf("tiff: reading header: %w", err)
+	}
+
+	h := new(Header)
+	switch string(b[0:2]) {
+	case "II":
+		h.ByteOrder = binary.LittleEndian
+	case "MM":
+		h.ByteOrder = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%w: byte order 0x%x%x", ErrInvalidHeader, b[0], b[1])
+	}
+	h.Magic = h.ByteOrder.Uint16(b[2:4])
+	h.Offset = int64(h.ByteOrder.Uint32(b[4:8]))
+	if h.Magic != BigTIFFMagic {
+		return h, nil
+	}
+
+	if h.ByteOrder.Uint16(b[4:6]) != 8 || h.ByteOrder.Uint16(b[6:8]) != 0 {
+		return nil, fmt.Errorf("%w: BigTIFF offset size %d", ErrInvalidHeader, h.ByteOrder.Uint16(b[4:6]))
+	}
+	if _, err := r.ReadAt(b, 8); err != nil {
+		return nil, fmt.Errorf("tiff: reading BigTIFF header: %w", err)
+	}
+	offset := h.ByteOrder.Uint64(b)
+	if offset > math.MaxInt64 {
+		return nil, fmt.Errorf("%w: BigTIFF IFD0 offset %d", ErrInvalidHeader, offset)
+	}
+	h.Offset, h.BigTIFF = int64(offset), true
+
+	return h, nil
+}
+
+// IsBigEndian determines if the file is big endian ("MM").
+func (h *Header) IsBigEndian() bool {
+	return h.ByteOrder == binary.BigEndian
+}
+
+// IFD is a struct representing an image file directory.
+type IFD struct {
+	// Kind identifies how the IFD was reached and Index its position: in
+	// the IFD chain for KindMain or within the SubIFDs entry for KindSub.
+	Kind  Kind
+	Index int
+
+	// Offset is the offset of the IFD; Next is the offset of the next IFD
+	// in the chain, 0 if none.
+	Offset, Next int64
+
+	Entries []Entry
+}
+
+// Find returns the first entry with a tag or nil if not present.
+func (d *IFD) Find(tag uint16) *Entry {
+	for i := range d.Entries {
+		if d.Entries[i].Tag == tag {
+			return &d.Entries[i]
+		}
+	}
+	return nil
+}
+
+// ifdLayout is the size, in bytes, of the fields of an IFD: the entry
+// count, an entry (tag, type, count, and value or value offset), and the
+// offset of the next IFD; valueAt is the position of the value within an
+// entry.
+type ifdLayout struct {
+	countSize, entrySize, nextSize, valueAt int
+}
+
+// entrySize is the size, in bytes, of a TIFF IFD entry.
+const entrySize = 12
+
+var (
+	classicLayout = ifdLayout{2, entrySize, 4, 8}
+	bigLayout     = ifdLayout{8, 20, 8, 12}
+)
+
+// maxBigEntries is the largest entry count of a BigTIFF IFD read; a TIFF
+// IFD has at most 65535 entries.
+const maxBigEntries = 1<<16 - 1
+
+// ReadIFD reads the IFD at an offset.  The entry table is read in a single
+// read.  The offset of the next IFD may be omitted by the last IFD of a
+// file.
+// Returns the IFD or error.
+func ReadIFD(r io.ReaderAt, order binary.ByteOrder, offset int64) (*IFD, error) {
+	return readIFD(r, order, offset, classicLayout)
+}
+
+// ReadBigIFD reads the BigTIFF IFD at an offset, as ReadIFD: its entry
+// count, entry counts, values, and offsets are 8 bytes.
+// Returns the IFD or error.
+func ReadBigIFD(r io.ReaderAt, order binary.ByteOrder, offset int64) (*IFD, error) {
+	return readIFD(r, order, offset, bigLayout)
+}
+
+// readIFD reads the IFD at an offset of a TIFF or BigTIFF layout.
+// Returns the IFD or error.
+func readIFD(r io.ReaderAt, order binary.ByteOrder, offset int64, l ifdLayout) (*IFD, error) {
+	b := make([]byte, l.countSize)
+	if n, err := r.ReadAt(b, offset); n != l.countSize {
+		return nil, fmt.Errorf("tiff: reading IFD at %d: %w", offset, noEOF(err))
+	}
+	count := uint64(order.Uint16(b))
+	if l == bigLayout {
+		if count = order.Uint64(b); count > maxBigEntries {
+			return nil, fmt.Errorf("tiff: reading IFD at %d: %d entries", offset, count)
+		}
+	}
+
+	start := offset + int64(l.countSize)
+	table := make([]byte, int(count)*l.entrySize+l.nextSize)
+	n, err := r.ReadAt(table, start)
+
+	d := &IFD{Offset: offset, Entries: make([]Entry, 0, count)}
+	for i := 0; i < int(count); i++ {
+		if (i+1)*l.entrySize > n {
+			return d, fmt.Errorf("tiff: reading IFD at %d: read %d of %d entries: %w",
+				offset, i, count, noEOF(err))
+		}
+		e := table[i*l.entrySize : (i+1)*l.entrySize]
+		entry := Entry{
+			Tag:    order.Uint16(e[0:2]),
+			Type:   Type(order.Uint16(e[2:4])),
+			Offset: start + int64(i*l.entrySize+l.valueAt),
+			order:  order,
+			r:      r,
+			big:    l == bigLayout,
+		}
+		if entry.big {
+			// larger counts exceed MaxValueSize
+			entry.Count = uint32(min(order.Uint64(e[4:12]), math.MaxUint32))
+		} else {
+			entry.Count = order.Uint32(e[4:8])
+		}
+		value := e[l.valueAt:]
+
+		// the value, left-justified, or the offset of the value
+		entry.ValueOffset = order.Uint32(value)
+		if !entry.Inline() {
+			if entry.big {
+				valueOffset := order.Uint64(value)
+				entry.Offset = int64(min(valueOffset, math.MaxInt64))
+				entry.ValueOffset = uint32(min(valueOffset, math.MaxUint32))
+			} else {
+				entry.Offset = int64(entry.ValueOffset)
+			}
+		}
+		d.Entries = append(d.Entries, entry)
+	}
+
+	if n == len(table) {
+		next := table[int(count)*l.entrySize:]
+		if l == bigLayout {
+			d.Next = int64(min(order.Uint64(next), math.MaxInt64))
+		} else {
+			d.Next = int64(order.Uint32(next))
+		}
+	}
+
+	return d, nil
+}
+
+// noEOF converts an EOF, or the absence of an error, from a short read into
+// io.ErrUnexpectedEOF.
+func noEOF(err error) error {
+	if err == nil || err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
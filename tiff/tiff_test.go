@@ -0,0 +1,351 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package tiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+)
+
+const (
+	testCR2File = "../test_files/little_endian.CR2"
+	testNefFile = "../test_files/big_endian.NEF"
+)
+
+func openTestFile(t *testing.T, name string) *os.File {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatalf("Error opening %s: %v\n", name, err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+// testIFD encodes a big endian TIFF with a single IFD of the entries,
+// whose values must fit within 4 bytes, followed by data.
+func testIFD(next uint32, data []byte, entries ...Entry) []byte {
+	b := []byte{'M', 'M', 0, 42, 0, 0, 0, 8}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(entries)))
+	for _, e := range entries {
+		b = binary.BigEndian.AppendUint16(b, e.Tag)
+		b = binary.BigEndian.AppendUint16(b, uint16(e.Type))
+		b = binary.BigEndian.AppendUint32(b, e.Count)
+		b = binary.BigEndian.AppendUint32(b, e.ValueOffset)
+	}
+	b = binary.BigEndian.AppendUint32(b, next)
+	return append(b, data...)
+}
+
+func TestReadHeader(t *testing.T) {
+	h, err := ReadHeader(openTestFile(t, testNefFile))
+	if err != nil || !h.IsBigEndian() || h.Magic != 42 || h.Offset != 8 {
+		t.Errorf("Unexpected NEF header: %+v %v\n", h, err)
+	}
+
+	h, err = ReadHeader(openTestFile(t, testCR2File))
+	if err != nil || h.IsBigEndian() || h.Magic != 42 || h.Offset != 16 {
+		t.Errorf("Unexpected CR2 header: %+v %v\n", h, err)
+	}
+
+	_, err = ReadHeader(bytes.NewReader([]byte("XX\x00\x2a\x00\x00\x00\x08")))
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Expected ErrInvalidHeader; got %v\n", err)
+	}
+
+	if _, err = ReadHeader(bytes.NewReader([]byte("MM"))); err == nil {
+		t.Error("Expected error for truncated header")
+	}
+}
+
+func TestWalkIFDs(t *testing.T) {
+	f := openTestFile(t, testCR2File)
+	h, err := ReadHeader(f)
+	if err != nil {
+		t.Fatalf("Error reading header: %v\n", err)
+	}
+
+	kinds := make(map[Kind]int)
+	var original string
+	err = WalkIFDs(f, h, func(ifd *IFD) error {
+		kinds[ifd.Kind]++
+		if ifd.Kind == KindExif {
+			if e := ifd.Find(0x9003); e != nil {
+				original, _ = e.ASCII()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	if kinds[KindMain] != 4 || kinds[KindExif] != 1 || kinds[KindGPS] != 1 {
+		t.Errorf("Unexpected IFDs: %v\n", kinds)
+	}
+	if original != "2009:03:07 18:28:10" {
+		t.Errorf("Unexpected DateTimeOriginal: %q\n", original)
+	}
+}
+
+func TestWalkIFDsSkip(t *testing.T) {
+	f := openTestFile(t, testCR2File)
+	h, _ := ReadHeader(f)
+
+	visited := 0
+	err := WalkIFDs(f, h, func(ifd *IFD) error {
+		visited++
+		return SkipAll
+	})
+	if err != nil || visited != 1 {
+		t.Errorf("SkipAll: visited %d; %v\n", visited, err)
+	}
+
+	kinds := make(map[Kind]int)
+	err = WalkIFDs(f, h, func(ifd *IFD) error {
+		kinds[ifd.Kind]++
+		return SkipChildren
+	})
+	if err != nil || kinds[KindMain] != 4 || len(kinds) != 1 {
+		t.Errorf("SkipChildren: visited %v; %v\n", kinds, err)
+	}
+
+	stop := errors.New("stop")
+	if err = WalkIFDs(f, h, func(ifd *IFD) error { return stop }); err != stop {
+		t.Errorf("Expected the WalkFunc error; got %v\n", err)
+	}
+}
+
+func TestWalkIFDsLoop(t *testing.T) {
+	// the IFD is its own next IFD and SubIFD
+	data := testIFD(8, nil, Entry{Tag: TagSubIFDs, Type: Long, Count: 1, ValueOffset: 8})
+	h, _ := ReadHeader(bytes.NewReader(data))
+
+	visited := 0
+	err := WalkIFDs(bytes.NewReader(data), h, func(ifd *IFD) error {
+		visited++
+		return nil
+	})
+	if err != nil || visited != 1 {
+		t.Errorf("Visited %d; %v\n", visited, err)
+	}
+}
+
+func TestWalkIFDsPartial(t *testing.T) {
+	// IFD0 references an EXIF IFD beyond the end of file and is truncated
+	// within its last entry
+	data := testIFD(0, nil,
+		Entry{Tag: TagExifIFD, Type: Long, Count: 1, ValueOffset: 0x7ffffff0},
+		Entry{Tag: 0x0112, Type: Short, Count: 1, ValueOffset: 0x00010000})
+	data = data[:8+2+12+6]
+	h, _ := ReadHeader(bytes.NewReader(data))
+
+	if err := WalkIFDs(bytes.NewReader(data), h, func(ifd *IFD) error { return nil }); err == nil {
+		t.Error("Expected error reading IFD0")
+	}
+
+	var visited, failed []*IFD
+	err := WalkIFDsPartial(bytes.NewReader(data), h, func(ifd *IFD) error {
+		visited = append(visited, ifd)
+		return nil
+	}, func(ifd *IFD, err error) {
+		failed = append(failed, ifd)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if len(visited) != 1 || len(visited[0].Entries) != 1 || visited[0].Entries[0].Tag != TagExifIFD {
+		t.Errorf("Expected IFD0 with the entries read; got %+v\n", visited)
+	}
+	if len(failed) != 2 || failed[0].Kind != KindMain || failed[1].Kind != KindExif || failed[1].Offset != 0x7ffffff0 {
+		t.Errorf("Expected IFD0 and the EXIF IFD to fail; got %+v\n", failed)
+	}
+}
+
+func TestEntryValue(t *testing.T) {
+	// values beyond the IFD start at offset 8 + 2 + 5*12 + 4 = 74
+	data := []byte{
+		0x00, 0x01, 0x00, 0x02, 0x00, 0x03, // SHORT[3]
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x03, // RATIONAL
+		'C', 'a', 'n', 'o', 'n', 0, // ASCII[6]
+	}
+	b := testIFD(0, data,
+		Entry{Tag: 1, Type: Short, Count: 1, ValueOffset: 0x00070000},
+		Entry{Tag: 2, Type: Short, Count: 3, ValueOffset: 74},
+		Entry{Tag: 3, Type: Rational, Count: 1, ValueOffset: 80},
+		Entry{Tag: 4, Type: ASCII, Count: 6, ValueOffset: 88},
+		Entry{Tag: 5, Type: SShort, Count: 2, ValueOffset: 0xfffe0002})
+	ifd, err := ReadIFD(bytes.NewReader(b), binary.BigEndian, 8)
+	if err != nil || len(ifd.Entries) != 5 {
+		t.Fatalf("Unexpected IFD: %+v %v\n", ifd, err)
+	}
+
+	if v, err := ifd.Find(1).Uint(); err != nil || v != 7 {
+		t.Errorf("Unexpected inline SHORT: %d %v\n", v, err)
+	}
+	if v, err := ifd.Find(2).Uints(); err != nil || len(v) != 3 || v[2] != 3 {
+		t.Errorf("Unexpected SHORT array: %v %v\n", v, err)
+	}
+	if v, err := ifd.Find(3).Value(); err != nil || v.([]RationalValue)[0] != (RationalValue{1, 3}) {
+		t.Errorf("Unexpected RATIONAL: %v %v\n", v, err)
+	}
+	if v, err := ifd.Find(4).ASCII(); err != nil || v != "Canon" {
+		t.Errorf("Unexpected ASCII: %q %v\n", v, err)
+	}
+	if v, err := ifd.Find(5).Value(); err != nil || v.([]int16)[0] != -2 || v.([]int16)[1] != 2 {
+		t.Errorf("Unexpected SSHORT: %v %v\n", v, err)
+	}
+	if _, err := ifd.Find(4).Uints(); !errors.Is(err, ErrValueType) {
+		t.Errorf("Expected ErrValueType; got %v\n", err)
+	}
+	if ifd.Find(6) != nil {
+		t.Error("Unexpected entry found")
+	}
+}
+
+func TestEntryValueTooLarge(t *testing.T) {
+	b := testIFD(0, nil, Entry{Tag: 1, Type: Double, Count: 0xffffffff, ValueOffset: 8})
+	ifd, err := ReadIFD(bytes.NewReader(b), binary.BigEndian, 8)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if _, err := ifd.Entries[0].Bytes(); err == nil {
+		t.Error("Expected error for oversized value")
+	}
+}
+
+// sparseReader reads segments of data at offsets, e.g., beyond 4 GB,
+// without allocating the gaps between them, which read as zeros.
+type sparseReader map[int64][]byte
+
+func (s sparseReader) ReadAt(p []byte, off int64) (int, error) {
+	clear(p)
+	for at, data := range s {
+		if off < at+int64(len(data)) && at < off+int64(len(p)) {
+			start := max(off, at)
+			copy(p[start-off:], data[start-at:])
+		}
+	}
+	return len(p), nil
+}
+
+// bigEntry is an entry of a BigTIFF IFD encoded by testBigIFD; value is the
+// 8-byte value, or value offset, field.
+type bigEntry struct {
+	tag   uint16
+	typ   Type
+	count uint64
+	value uint64
+}
+
+// testBigIFD encodes a little endian BigTIFF IFD.
+func testBigIFD(next uint64, entries ...bigEntry) []byte {
+	b := binary.LittleEndian.AppendUint64(nil, uint64(len(entries)))
+	for _, e := range entries {
+		b = binary.LittleEndian.AppendUint16(b, e.tag)
+		b = binary.LittleEndian.AppendUint16(b, uint16(e.typ))
+		b = binary.LittleEndian.AppendUint64(b, e.count)
+		b = binary.LittleEndian.AppendUint64(b, e.value)
+	}
+	return binary.LittleEndian.AppendUint64(b, next)
+}
+
+func TestBigTIFF(t *testing.T) {
+	const (
+		ifd0  = 1 << 32
+		model = ifd0 + 0x1000
+		subs  = ifd0 + 0x2000
+		sub0  = ifd0 + 0x3000
+		sub1  = ifd0 + 0x4000
+		exif  = ifd0 + 0x5000
+		date  = ifd0 + 0x6000
+	)
+	r := sparseReader{
+		0: binary.LittleEndian.AppendUint64([]byte{'I', 'I', 43, 0, 8, 0, 0, 0}, ifd0),
+		ifd0: testBigIFD(0,
+			bigEntry{0x0112, Short, 1, 6},
+			bigEntry{0x010f, ASCII, 8, binary.LittleEndian.Uint64([]byte("Hasselb\x00"))},
+			bigEntry{0x0110, ASCII, 12, model},
+			bigEntry{TagSubIFDs, IFD8, 2, subs},
+			bigEntry{0x0201, Long8, 1, 1 << 33},
+			bigEntry{TagExifIFD, IFD8, 1, exif}),
+		model: []byte("BigTIFF Cam\x00"),
+		subs:  binary.LittleEndian.AppendUint64(binary.LittleEndian.AppendUint64(nil, sub0), sub1),
+		sub0:  testBigIFD(0, bigEntry{0x00fe, Long, 1, 0}),
+		sub1:  testBigIFD(0, bigEntry{0x00fe, Long, 1, 1}),
+		exif:  testBigIFD(0, bigEntry{0x9003, ASCII, 20, date}),
+		date:  []byte("2020:01:02 03:04:05\x00"),
+	}
+
+	h, err := ReadHeader(r)
+	if err != nil || !h.BigTIFF || h.Magic != BigTIFFMagic || h.Offset != ifd0 {
+		t.Fatalf("Unexpected BigTIFF header: %+v %v\n", h, err)
+	}
+
+	kinds := make(map[Kind]int)
+	var original string
+	err = WalkIFDs(r, h, func(ifd *IFD) error {
+		kinds[ifd.Kind]++
+		switch ifd.Kind {
+		case KindMain:
+			if v, err := ifd.Find(0x0112).Uint(); err != nil || v != 6 {
+				t.Errorf("Unexpected Orientation: %d %v\n", v, err)
+			}
+			if v, err := ifd.Find(0x010f).ASCII(); err != nil || v != "Hasselb" {
+				t.Errorf("Unexpected inline Make: %q %v\n", v, err)
+			}
+			e := ifd.Find(0x0110)
+			if v, err := e.ASCII(); err != nil || v != "BigTIFF Cam" || e.Offset != model {
+				t.Errorf("Unexpected Model: %q at %d %v\n", v, e.Offset, err)
+			}
+			e = ifd.Find(0x0201)
+			if v, err := e.Uint64(); err != nil || v != 1<<33 || e.Type.String() != "LONG8" {
+				t.Errorf("Unexpected LONG8: %d %v\n", v, err)
+			}
+			if _, err := e.Uint(); !errors.Is(err, ErrValueType) {
+				t.Errorf("Expected ErrValueType reading a LONG8 beyond 32 bits; got %v\n", err)
+			}
+		case KindExif:
+			original, _ = ifd.Find(0x9003).ASCII()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if kinds[KindMain] != 1 || kinds[KindSub] != 2 || kinds[KindExif] != 1 {
+		t.Errorf("Unexpected IFDs: %v\n", kinds)
+	}
+	if original != "2020:01:02 03:04:05" {
+		t.Errorf("Unexpected DateTimeOriginal: %q\n", original)
+	}
+
+	// only 8-byte offsets are defined
+	_, err = ReadHeader(bytes.NewReader([]byte{'M', 'M', 0, 43, 0, 4, 0, 0, 0, 0, 0, 0, 0, 0, 0, 16}))
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Expected ErrInvalidHeader; got %v\n", err)
+	}
+}
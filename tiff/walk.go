@@ -0,0 +1,219 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package tiff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/jeremytorres/rawparser/tags"
+)
+
+// MaxIFDs is the largest number of IFDs visited by WalkIFDs.  Corrupt or
+// malicious files may reference an unbounded number of IFDs.
+const MaxIFDs = 64
+
+// Tags of the entries referencing child IFDs.
+const (
+	TagSubIFDs    = tags.TagSubIFDs
+	TagExifIFD    = tags.TagExifIFD
+	TagGPSIFD     = tags.TagGPSInfoIFD
+	TagInteropIFD = tags.TagInteroperabilityIFD
+)
+
+// Kind identifies how an IFD was reached.
+type Kind int
+
+const (
+	// KindMain is an IFD of the main chain: IFD0, IFD1, ...
+	KindMain Kind = iota
+
+	// KindSub is an IFD referenced by a SubIFDs entry, or chained to one.
+	KindSub
+
+	// KindExif is the EXIF IFD.
+	KindExif
+
+	// KindGPS is the GPS IFD.
+	KindGPS
+
+	// KindInterop is the EXIF interoperability IFD.
+	KindInterop
+)
+
+// String returns the name of the IFD kind.
+func (k Kind) String() string {
+	switch k {
+	case KindMain:
+		return "IFD"
+	case KindSub:
+		return "SubIFD"
+	case KindExif:
+		return "EXIF"
+	case KindGPS:
+		return "GPS"
+	case KindInterop:
+		return "Interop"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+var (
+	// SkipChildren is returned by a WalkFunc to skip the IFDs referenced
+	// by the entries of the current IFD.  The next IFD of the chain is
+	// still visited.
+	SkipChildren = errors.New("tiff: skip children")
+
+	// SkipAll is returned by a WalkFunc to stop the walk.  WalkIFDs
+	// returns nil.
+	SkipAll = errors.New("tiff: skip all")
+)
+
+// WalkFunc is called by WalkIFDs for each IFD.  Returning an error other
+// than SkipChildren or SkipAll stops the walk and the error is returned by
+// WalkIFDs.
+type WalkFunc func(ifd *IFD) error
+
+// pendingIFD is an IFD yet to be visited by WalkIFDs.
+type pendingIFD struct {
+	kind   Kind
+	index  int
+	offset int64
+}
+
+// WalkIFDs visits the IFDs of a TIFF-based file: the main chain starting at
+// IFD0 and the SubIFDs, EXIF, GPS, and interoperability IFDs they
+// reference.  IFDs are visited in the order they are discovered; each IFD
+// is visited at most once and at most MaxIFDs are visited.  An error
+// reading IFD0 is returned; other IFDs that cannot be read are skipped, as
+// they are frequently damaged in otherwise usable files.
+// Returns nil or the error reading IFD0 or returned by fn.
+func WalkIFDs(r io.ReaderAt, h *Header, fn WalkFunc) error {
+	return walk(r, h, fn, nil)
+}
+
+// ErrorFunc is called by WalkIFDsPartial with an IFD that could not be read
+// in full: its kind, index, and offset are set and its entries are those
+// read, if any.
+type ErrorFunc func(ifd *IFD, err error)
+
+// WalkIFDsPartial visits the IFDs as WalkIFDs, for best-effort reading of
+// damaged or truncated files: IFDs that cannot be read in full, including
+// IFD0, are reported to errFn and, if any of their entries were read,
+// visited with those entries.
+// Returns nil or the error returned by fn.
+func WalkIFDsPartial(r io.ReaderAt, h *Header, fn WalkFunc, errFn ErrorFunc) error {
+	return walk(r, h, fn, errFn)
+}
+
+// walk implements WalkIFDs and, if errFn is set, WalkIFDsPartial.
+func walk(r io.ReaderAt, h *Header, fn WalkFunc, errFn ErrorFunc) error {
+	visited := make(map[int64]bool)
+	pending := []pendingIFD{{KindMain, 0, h.Offset}}
+
+	for len(pending) > 0 && len(visited) < MaxIFDs {
+		p := pending[0]
+		pending = pending[1:]
+		if p.offset <= 0 || visited[p.offset] {
+			continue
+		}
+		isIfd0 := len(visited) == 0
+		visited[p.offset] = true
+
+		layout := classicLayout
+		if h.BigTIFF {
+			layout = bigLayout
+		}
+		ifd, err := readIFD(r, h.ByteOrder, p.offset, layout)
+		if err != nil {
+			if errFn == nil {
+				if isIfd0 {
+					return err
+				}
+				continue
+			}
+			if ifd == nil {
+				ifd = &IFD{Offset: p.offset}
+			}
+			ifd.Kind, ifd.Index = p.kind, p.index
+			errFn(ifd, err)
+			if len(ifd.Entries) == 0 {
+				continue
+			}
+		}
+		ifd.Kind, ifd.Index = p.kind, p.index
+
+		err = fn(ifd)
+		switch {
+		case errors.Is(err, SkipAll):
+			return nil
+		case err != nil && !errors.Is(err, SkipChildren):
+			return err
+		}
+
+		if ifd.Next > 0 && (ifd.Kind == KindMain || ifd.Kind == KindSub) {
+			pending = append(pending, pendingIFD{ifd.Kind, ifd.Index + 1, ifd.Next})
+		}
+		if err != nil {
+			continue
+		}
+		pending = append(pending, children(ifd)...)
+	}
+
+	return nil
+}
+
+// children determines the IFDs referenced by the entries of an IFD.
+func children(ifd *IFD) []pendingIFD {
+	var c []pendingIFD
+	for i := range ifd.Entries {
+		e := &ifd.Entries[i]
+		var kind Kind
+		switch e.Tag {
+		case TagSubIFDs:
+			offsets, err := e.Uints64()
+			if err != nil {
+				continue
+			}
+			for j, offset := range offsets {
+				c = append(c, pendingIFD{KindSub, j, int64(min(offset, math.MaxInt64))})
+			}
+			continue
+		case TagExifIFD:
+			kind = KindExif
+		case TagGPSIFD:
+			kind = KindGPS
+		case TagInteropIFD:
+			kind = KindInterop
+		default:
+			continue
+		}
+		if offset, err := e.Uint64(); err == nil {
+			c = append(c, pendingIFD{kind, 0, int64(min(offset, math.MaxInt64))})
+		}
+	}
+	return c
+}
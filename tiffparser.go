@@ -0,0 +1,333 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"container/list"
+	"io"
+	"math"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// tiffParser is a generic parser for TIFF-based raw files whose embedded
+// JPEG previews are located via the standard TIFF tags.  It walks the IFD0
+// chain, SubIFDs, and the EXIF and GPS IFDs, and selects the largest
+// embedded JPEG.  Format-specific parsers (e.g., NRW) embed a tiffParser.
+type tiffParser struct {
+	*rawParser
+
+	// magic is the magic value of the header of the format, if it is
+	// neither that of TIFF nor that of BigTIFF (e.g., 0x55 for RWL).
+	magic uint16
+}
+
+// processTiffFile is the entry point for parsers built on the tiffParser.
+// For a specified raw file, via RawFileInfo, the file shall be processed,
+// JPEG extracted, and processed details returned to the caller.
+// Returns a pointer the RawFile data structure or error.
+func (t tiffParser) processTiffFile(info *RawFileInfo) (*RawFile, error) {
+	r := new(RawFile)
+
+	info, err := info.withDefaults()
+	if err != nil {
+		return r, err
+	}
+
+	f, err := openRawFile(info)
+	if err != nil {
+		return r, err
+	}
+	defer f.Close()
+	if cached := info.Cache.lookup(f, info); cached != nil {
+		return cached, nil
+	}
+
+	cache := newReadCache(f)
+	h, err := t.processHeader(cache)
+	headerErr, err := lenientHeader(info, err)
+	if err != nil {
+		return r, err
+	}
+
+	jpegInfo, meta, err := t.processIfds(cache, h)
+	if err != nil {
+		return r, err
+	}
+	if headerErr != nil {
+		meta.warn(headerErr)
+	}
+	meta.images = listImages(cache)
+	meta.rawImage = readRawImage(cache)
+	runTagHooks(cache, info.TagHooks)
+
+	return r, completeRawFile(r, info, f, jpegInfo, meta)
+}
+
+// processHeader reads the TIFF header that defines:
+//   byte order;
+//   TIFF magic value
+//   TIFF offset
+// Returns a pointer to the header struct or error; a *HeaderError, with
+// the header read, if the magic value is not that of the format.
+func (t tiffParser) processHeader(f io.ReaderAt) (*tiff.Header, error) {
+	h, err := tiff.ReadHeader(f)
+	if err != nil {
+		return h, err
+	}
+	accepted := []uint16{tiffMagic, tiff.BigTIFFMagic}
+	if t.magic != 0 {
+		accepted = append(accepted, t.magic)
+	}
+	return h, checkTiffMagic(h, accepted...)
+}
+
+// tiffImage is a struct representing the image-related tags of a single IFD.
+type tiffImage struct {
+	subfileType, compression     uint32
+	width, height                uint32
+	jpegOffset, jpegLength       int64 // JPEGInterchangeFormat(Length)
+	stripOffsets, stripLengths   []uint64
+	jpgFromRaw, jpgFromRawLength int64 // Panasonic/Leica JpgFromRaw
+}
+
+// processIfds walks the IFDs of a TIFF-based raw file.  Currently, it parses:
+//     jpegInfo - the largest embedded jpeg within the raw file;
+//     meta - the EXIF specified creation time and raw dimensions;
+// Return jpegInfo, metadata or an error.
+func (t tiffParser) processIfds(f io.ReaderAt, h *tiff.Header) (*jpegInfo, *rawMetadata, error) {
+	var jpeg jpegInfo
+	var m rawMetadata
+	isBigEndian := h.IsBigEndian()
+
+	err := tiff.WalkIFDsPartial(f, h, func(ifd *tiff.IFD) error {
+		switch ifd.Kind {
+		case tiff.KindExif:
+			t.processExifEntries(ifdEntryList(ifd, byteOrder(isBigEndian), f), &m)
+		case tiff.KindGPS:
+			processGpsEntries(t.IsHostLittleEndian(), isBigEndian, ifdEntryList(ifd, byteOrder(isBigEndian), f), f, &m)
+		case tiff.KindInterop:
+			processInteropEntries(ifdEntryList(ifd, byteOrder(isBigEndian), f), &m)
+		case tiff.KindMain, tiff.KindSub:
+			t.processImageIfd(f, isBigEndian, ifd, &jpeg, &m)
+		}
+		return nil
+	}, func(ifd *tiff.IFD, err error) {
+		m.readFailed(ifdName(ifd.Kind, ifd.Index), 0, err)
+	})
+	if err != nil {
+		return &jpeg, &m, err
+	}
+
+	if m.dates.digitized == "" && jpeg.length > 0 {
+		// e.g., RWL stores the EXIF within the embedded jpeg only
+		t.processJpegExif(f, jpeg.offset, jpeg.length, &m)
+	}
+
+	return &jpeg, &m, nil
+}
+
+// processImageIfd records the image described by an IFD of the IFD0 chain
+// or a SubIFD and, for IFD0, the camera make, model, serial number,
+// date/time, artist, copyright, DNG version, orientation, rating, and lens.
+func (t tiffParser) processImageIfd(f io.ReaderAt, isBigEndian bool, ifd *tiff.IFD, jpeg *jpegInfo, m *rawMetadata) {
+	entries := ifdEntryList(ifd, byteOrder(isBigEndian), f)
+	isIfd0 := ifd.Kind == tiff.KindMain && ifd.Index == 0
+	m.tags.record(entries, ifd0Tags)
+
+	// the offsets of a BigTIFF may exceed 32 bits
+	var img tiffImage
+	for i := range ifd.Entries {
+		e := &ifd.Entries[i]
+		switch e.Tag {
+		case 0x0111:
+			img.stripOffsets, _ = e.Uints64()
+		case 0x0117:
+			img.stripLengths, _ = e.Uints64()
+		case 0x002e:
+			img.jpgFromRaw, img.jpgFromRawLength = e.Offset, int64(e.Count)
+		case 0x0201:
+			v, _ := e.Uint64()
+			img.jpegOffset = int64(min(v, math.MaxInt64))
+		case 0x0202:
+			v, _ := e.Uint64()
+			img.jpegLength = int64(min(v, math.MaxInt64))
+		}
+	}
+
+	for e := entries.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(IfdEntry)
+		switch entry.tag {
+		case 0x00fe:
+			img.subfileType, _ = entry.Uint32()
+		case 0x0100:
+			img.width, _ = entry.Uint32()
+		case 0x0101:
+			img.height, _ = entry.Uint32()
+		case 0x0103:
+			img.compression, _ = entry.Uint32()
+		case 0x010f:
+			if isIfd0 {
+				m.make = m.readASCIIEntry("IFD0", &entry)
+			}
+		case 0x0110:
+			if isIfd0 {
+				m.model = m.readASCIIEntry("IFD0", &entry)
+			}
+		case 0x0132:
+			if isIfd0 {
+				m.dates.dateTime, _ = entry.ASCII()
+			}
+		case 0xc612:
+			if isIfd0 && entry.count == 4 {
+				copy(m.dngVersion[:], inlineValueBytes(isBigEndian, entry.valueOffset))
+			}
+		case 0x0112:
+			if isIfd0 {
+				v, _ := entry.Uint16()
+				jpeg.orientation = orientationOf(v)
+			}
+		case 0x02bc, 0x4746:
+			if isIfd0 {
+				processRatingEntry(&entry, m)
+			}
+		case 0xc630:
+			if isIfd0 {
+				processLensEntry(&entry, m)
+			}
+		case 0x013b, 0x8298: // Artist, Copyright
+			if isIfd0 {
+				processCopyrightEntry(&entry, m)
+			}
+		case 0xc62f: // CameraSerialNumber
+			if isIfd0 && m.serialNumber == "" {
+				m.serialNumber, _ = entry.ASCII()
+			}
+		}
+	}
+
+	t.selectImage(f, &img, jpeg, m)
+}
+
+// processJpegExif reads the date/time entries from the EXIF (APP1) segment
+// of an embedded jpeg, recording those not recorded by the raw file.  The
+// EXIF segment is a TIFF structure whose offsets are relative to its own
+// header.  Errors are not fatal as the entries are optional.
+func (t tiffParser) processJpegExif(f io.ReaderAt, offset, length int64, m *rawMetadata) {
+	end, err := addOffset(offset, length)
+	if err != nil {
+		return
+	}
+	pos := offset + 2
+
+	// bound the marker walk; APP segments precede the image data
+	for i := 0; i < 16 && pos+4 <= end; i++ {
+		bytes, err := readField(pos, 4, f)
+		if err != nil || bytes[0] != 0xFF {
+			return
+		}
+		marker := bytes[1]
+		segmentLength := int64(bytesToUShort(t.IsHostLittleEndian(), true, bytes[2:4]))
+
+		if marker == 0xE1 && segmentLength > 8 {
+			bytes, err = readField(pos+4, 6, f)
+			if err == nil && bytesToASCIIString(bytes) == "Exif\x00\x00" {
+				exif := io.NewSectionReader(f, pos+10, segmentLength-8)
+				h, err := t.processHeader(exif)
+				if err != nil {
+					return
+				}
+				_, exifMeta, err := t.processIfds(exif, h)
+				if err == nil {
+					m.dates.fill(&exifMeta.dates)
+				}
+				return
+			}
+		} else if marker == 0xDA {
+			return
+		}
+
+		pos += 2 + segmentLength
+	}
+}
+
+// selectImage records the image described by an IFD: an embedded JPEG
+// larger than the current one is selected as the preview and a
+// full-resolution image (NewSubfileType 0) larger than the current one
+// defines the raw dimensions.
+func (t tiffParser) selectImage(f io.ReaderAt, img *tiffImage, jpeg *jpegInfo, m *rawMetadata) {
+	offset, length := img.jpegOffset, img.jpegLength
+	var strips []byteRange
+	if length <= 0 && (img.compression == 6 || (img.compression == 7 && img.subfileType&1 == 1)) {
+		// JPEG compressed, reduced-resolution strip(s)
+		strips = newByteRanges(img.stripOffsets, img.stripLengths)
+		offset, length = stripsExtent(strips)
+	}
+	if img.jpgFromRawLength > length {
+		offset, length, strips = img.jpgFromRaw, img.jpgFromRawLength, nil
+	}
+	if _, err := addOffset(offset, length); err != nil {
+		// a corrupt offset or length
+		length = 0
+	}
+	if length > jpeg.length && isJpegAt(f, offset) {
+		jpeg.offset, jpeg.length = offset, length
+		jpeg.strips = nil
+		if len(strips) > 1 {
+			jpeg.strips = strips
+		}
+	}
+
+	if img.subfileType == 0 && img.compression != 6 &&
+		uint64(img.width)*uint64(img.height) > uint64(m.imageWidth)*uint64(m.imageHeight) {
+		m.imageWidth, m.imageHeight = img.width, img.height
+		m.rawCompression = img.compression
+	}
+}
+
+// processExifEntries reads the EXIF IFD date/time, lens, exposure,
+// composite image, color space, and subject area entries.
+func (t tiffParser) processExifEntries(entries *list.List, m *rawMetadata) {
+	m.tags.record(entries, exifTags)
+
+	for e := entries.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(IfdEntry)
+		processDateEntry(&entry, &m.dates)
+		processPhotoIDEntry(&entry, m)
+		processLensEntry(&entry, m)
+		processExposureEntry(&entry, m)
+		processCompositeEntry(&entry, m)
+		processColorSpaceEntry(&entry, m)
+		processSubjectEntry(&entry, m)
+	}
+}
+
+// isJpegAt determines if a JPEG start of image marker is located at offset.
+func isJpegAt(f io.ReaderAt, offset int64) bool {
+	if offset <= 0 {
+		return false
+	}
+	bytes, err := readField(offset, 2, f)
+	return err == nil && bytes[0] == 0xFF && bytes[1] == 0xD8
+}
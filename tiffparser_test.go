@@ -0,0 +1,527 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEntry is a synthetic IFD entry.  Values are encoded per fieldType:
+// ASCII (2) uses ascii; BYTE/UNDEFINED (1, 7) use raw; SHORT (3) and LONG
+// (4) use values; RATIONAL (5) uses values as numerator/denominator pairs.
+type testEntry struct {
+	tag, fieldType uint16
+	values         []uint32
+	ascii          string
+	raw            []byte
+}
+
+func shortEntry(tag uint16, v ...uint32) testEntry {
+	return testEntry{tag: tag, fieldType: 3, values: v}
+}
+func longEntry(tag uint16, v ...uint32) testEntry {
+	return testEntry{tag: tag, fieldType: 4, values: v}
+}
+func asciiEntry(tag uint16, s string) testEntry { return testEntry{tag: tag, fieldType: 2, ascii: s} }
+
+// testTiff builds a synthetic TIFF file.  IFDs are built bottom-up: child
+// IFDs (and blobs) are added first so their offsets can be referenced.
+type testTiff struct {
+	order interface {
+		binary.ByteOrder
+		binary.AppendByteOrder
+	}
+	buf []byte
+}
+
+func newTestTiff(bigEndian bool) *testTiff {
+	t := &testTiff{order: binary.LittleEndian, buf: []byte{'I', 'I', 42, 0, 0, 0, 0, 0}}
+	if bigEndian {
+		t.order = binary.BigEndian
+		t.buf = []byte{'M', 'M', 0, 42, 0, 0, 0, 0}
+	}
+	return t
+}
+
+// addBlob appends word-aligned data.  Returns the offset of the data.
+func (t *testTiff) addBlob(data []byte) uint32 {
+	if len(t.buf)%2 == 1 {
+		t.buf = append(t.buf, 0)
+	}
+	offset := uint32(len(t.buf))
+	t.buf = append(t.buf, data...)
+	return offset
+}
+
+func (t *testTiff) encode(e testEntry) (uint32, []byte) {
+	var data []byte
+	var count uint32
+	switch e.fieldType {
+	case 2:
+		data = append([]byte(e.ascii), 0)
+		count = uint32(len(data))
+	case 1, 7:
+		data = e.raw
+		count = uint32(len(data))
+	case 3:
+		for _, v := range e.values {
+			data = t.order.AppendUint16(data, uint16(v))
+		}
+		count = uint32(len(e.values))
+	case 4:
+		for _, v := range e.values {
+			data = t.order.AppendUint32(data, v)
+		}
+		count = uint32(len(e.values))
+	case 5, 10:
+		for _, v := range e.values {
+			data = t.order.AppendUint32(data, v)
+		}
+		count = uint32(len(e.values) / 2)
+	}
+	return count, data
+}
+
+// addIfd appends an IFD with the given entries and next IFD offset.
+// Returns the offset of the IFD.
+func (t *testTiff) addIfd(next uint32, entries ...testEntry) uint32 {
+	type encoded struct {
+		count uint32
+		value []byte
+	}
+	values := make([]encoded, len(entries))
+	for i, e := range entries {
+		count, data := t.encode(e)
+		if len(data) > 4 {
+			data = t.order.AppendUint32(nil, t.addBlob(data))
+		}
+		values[i] = encoded{count, append(data, make([]byte, 4-len(data))...)}
+	}
+
+	ifd := t.order.AppendUint16(nil, uint16(len(entries)))
+	for i, e := range entries {
+		ifd = t.order.AppendUint16(ifd, e.tag)
+		ifd = t.order.AppendUint16(ifd, e.fieldType)
+		ifd = t.order.AppendUint32(ifd, values[i].count)
+		ifd = append(ifd, values[i].value...)
+	}
+	ifd = t.order.AppendUint32(ifd, next)
+
+	return t.addBlob(ifd)
+}
+
+// bytes sets the IFD0 offset and returns the file contents.
+func (t *testTiff) bytes(ifd0 uint32) []byte {
+	t.order.PutUint32(t.buf[4:8], ifd0)
+	return t.buf
+}
+
+// testJpeg encodes a gray JPEG of the given dimensions.
+func testJpeg(t testing.TB, width, height int) []byte {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+	img.Set(0, 0, color.White)
+
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("Error encoding test jpeg: %v\n", err)
+	}
+	return b.Bytes()
+}
+
+// writeTestFile writes data to a file within a temporary directory.
+// Returns the file path and the directory, with a trailing separator,
+// to use as the destination directory.
+func writeTestFile(t testing.TB, name string, data []byte) (string, string) {
+	dir := t.TempDir() + string(os.PathSeparator)
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Error writing test file: %v\n", err)
+	}
+	return path, dir
+}
+
+// buildTestNrw builds a NEF-like synthetic raw file: IFD0 holds a small
+// thumbnail, SubIFD0 the preview JPEG, and SubIFD1 the raw dimensions.
+func buildTestNrw(t testing.TB, bigEndian bool) []byte {
+	tt := newTestTiff(bigEndian)
+	thumb := testJpeg(t, 32, 24)
+	preview := testJpeg(t, 320, 240)
+
+	thumbOffset := tt.addBlob(thumb)
+	previewOffset := tt.addBlob(preview)
+
+	exif := tt.addIfd(0,
+		asciiEntry(0x9004, "2011:03:04 05:06:07"),
+		asciiEntry(0x9012, "+01:00"),
+		asciiEntry(0x9292, "5"))
+	sub0 := tt.addIfd(0,
+		longEntry(0x00fe, 1),
+		shortEntry(0x0103, 6),
+		longEntry(0x0201, previewOffset),
+		longEntry(0x0202, uint32(len(preview))))
+	sub1 := tt.addIfd(0,
+		longEntry(0x00fe, 0),
+		longEntry(0x0100, 4000),
+		longEntry(0x0101, 3000),
+		shortEntry(0x0103, 1))
+	ifd0 := tt.addIfd(0,
+		longEntry(0x00fe, 1),
+		shortEntry(0x0103, 6),
+		asciiEntry(0x010f, "NIKON"),
+		longEntry(0x0111, thumbOffset),
+		shortEntry(0x0112, 8),
+		longEntry(0x0117, uint32(len(thumb))),
+		longEntry(0x014a, sub0, sub1),
+		longEntry(0x8769, exif))
+
+	return tt.bytes(ifd0)
+}
+
+func TestNrwProcessFile(t *testing.T) {
+	for _, bigEndian := range []bool{false, true} {
+		path, dir := writeTestFile(t, "test.NRW", buildTestNrw(t, bigEndian))
+
+		p, key := NewNrwParser(isHostLittleEndian())
+		if key != NrwParserKey {
+			t.Fatalf("Unexpected key: %s\n", key)
+		}
+
+		nrw, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75})
+		if err != nil {
+			t.Fatalf("Unexpected error processing NRW (big endian: %v): %v\n", bigEndian, err)
+		}
+		t.Logf("Parsed NRW: %+v\n", nrw)
+
+		if nrw.PreviewWidth != 320 || nrw.PreviewHeight != 240 {
+			t.Errorf("Unexpected preview dimensions: %dx%d\n", nrw.PreviewWidth, nrw.PreviewHeight)
+		}
+		if nrw.ImageWidth != 4000 || nrw.ImageHeight != 3000 {
+			t.Errorf("Unexpected raw dimensions: %dx%d\n", nrw.ImageWidth, nrw.ImageHeight)
+		}
+		if nrw.CreateDate.UTC().Format("2006-01-02 15:04:05.000") != "2011-03-04 04:06:07.500" {
+			t.Errorf("Unexpected create date: %v\n", nrw.CreateDate)
+		}
+		if nrw.Orientation != Rotate270 || nrw.JpegOrientation == 0 {
+			t.Errorf("Unexpected orientation: %v %f\n", nrw.Orientation, nrw.JpegOrientation)
+		}
+		if _, err := os.Stat(nrw.JpegPath); err != nil {
+			t.Errorf("Extracted jpeg not found: %v\n", err)
+		}
+	}
+}
+
+func TestTiffParserNoJpeg(t *testing.T) {
+	tt := newTestTiff(false)
+	ifd0 := tt.addIfd(0, longEntry(0x0100, 10), longEntry(0x0101, 10))
+	path, dir := writeTestFile(t, "nojpeg.NRW", tt.bytes(ifd0))
+
+	p, _ := NewNrwParser(isHostLittleEndian())
+	if _, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75}); err == nil {
+		t.Fatal("Expected error processing file without jpeg")
+	}
+}
+
+// withExif inserts an EXIF (APP1) segment, containing DateTimeDigitized,
+// into a jpeg.
+func withExif(jpegData []byte, dateTime string) []byte {
+	tt := newTestTiff(true)
+	exif := tt.addIfd(0, asciiEntry(0x9004, dateTime))
+	return withExifTiff(jpegData, tt.bytes(tt.addIfd(0, longEntry(0x8769, exif))))
+}
+
+// withExifTiff inserts an EXIF (APP1) segment, containing a TIFF
+// structure, into a jpeg.
+func withExifTiff(jpegData, tiff []byte) []byte {
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(2+6+len(tiff)))
+	segment = append(segment, "Exif\x00\x00"...)
+	segment = append(segment, tiff...)
+
+	out := append([]byte{}, jpegData[:2]...)
+	out = append(out, segment...)
+	return append(out, jpegData[2:]...)
+}
+
+func TestRwlProcessFile(t *testing.T) {
+	tt := newTestTiff(false)
+	tt.buf[2] = 0x55 // RW2/RWL magic value
+	preview := withExif(testJpeg(t, 256, 192), "2015:06:07 08:09:10")
+	ifd0 := tt.addIfd(0,
+		longEntry(0x0100, 6000),
+		longEntry(0x0101, 4000),
+		testEntry{tag: 0x002e, fieldType: 7, raw: preview})
+	path, dir := writeTestFile(t, "test.RWL", tt.bytes(ifd0))
+
+	p, key := NewRwlParser(isHostLittleEndian())
+	if key != RwlParserKey {
+		t.Fatalf("Unexpected key: %s\n", key)
+	}
+
+	rwl, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75})
+	if err != nil {
+		t.Fatalf("Unexpected error processing RWL: %v\n", err)
+	}
+	if rwl.PreviewWidth != 256 || rwl.PreviewHeight != 192 {
+		t.Errorf("Unexpected preview dimensions: %dx%d\n", rwl.PreviewWidth, rwl.PreviewHeight)
+	}
+	if !rwl.CreateDate.Equal(time.Date(2015, time.June, 7, 8, 9, 10, 0, time.UTC)) {
+		t.Errorf("Unexpected create date: %v\n", rwl.CreateDate)
+	}
+}
+
+// TestJpegExifKeepsRawDates verifies that the dates of the EXIF of an
+// embedded jpeg only fill in those the raw file does not record.
+func TestJpegExifKeepsRawDates(t *testing.T) {
+	exif := newTestTiff(true)
+	preview := withExifTiff(testJpeg(t, 160, 120), exif.bytes(exif.addIfd(0, shortEntry(0x0112, 6))))
+
+	tt := newTestTiff(false)
+	previewOffset := tt.addBlob(preview)
+	ifd0 := tt.addIfd(0,
+		asciiEntry(0x0132, "2010:08:10 12:11:00"),
+		longEntry(0x0201, previewOffset),
+		longEntry(0x0202, uint32(len(preview))))
+	path, _ := writeTestFile(t, "test.3FR", tt.bytes(ifd0))
+
+	p, _ := NewThreeFrParser(isHostLittleEndian())
+	r, err := p.ProcessFile(&RawFileInfo{File: path, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error processing 3FR: %v\n", err)
+	}
+	if !r.CreateDate.Equal(time.Date(2010, time.August, 10, 12, 11, 0, 0, time.UTC)) || r.DateSource != DateSourceDateTime {
+		t.Errorf("Unexpected create date: %v (%v)\n", r.CreateDate, r.DateSource)
+	}
+}
+
+func TestMediumFormatProcessFile(t *testing.T) {
+	newParsers := []func(bool) (RawParser, string){NewThreeFrParser, NewIiqParser, NewFffParser, NewMosParser}
+
+	for _, newParser := range newParsers {
+		p, key := newParser(isHostLittleEndian())
+		path, dir := writeTestFile(t, "test."+key, buildTestNrw(t, false))
+
+		r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75})
+		if err != nil {
+			t.Fatalf("Unexpected error processing %s: %v\n", key, err)
+		}
+		if r.PreviewWidth != 320 || r.CreateDate.IsZero() {
+			t.Errorf("Unexpected %s result: %+v\n", key, r)
+		}
+	}
+}
+
+// sparseFile is a large raw file read via RawFileInfo.Reader, without
+// allocating it: the header at offset 0 and a blob at a large offset; the
+// bytes in between are zero.
+type sparseFile struct {
+	header     []byte
+	blobOffset int64
+	blob       []byte
+}
+
+func (s *sparseFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= s.Size() {
+		return 0, io.EOF
+	}
+	n := min(int64(len(p)), s.Size()-off)
+	clear(p[:n])
+	for _, seg := range []struct {
+		offset int64
+		data   []byte
+	}{{0, s.header}, {s.blobOffset, s.blob}} {
+		if off < seg.offset+int64(len(seg.data)) && seg.offset < off+n {
+			start := max(off, seg.offset)
+			copy(p[start-off:n], seg.data[start-seg.offset:])
+		}
+	}
+	if n < int64(len(p)) {
+		return int(n), io.EOF
+	}
+	return int(n), nil
+}
+
+func (s *sparseFile) Size() int64 {
+	return s.blobOffset + int64(len(s.blob))
+}
+
+func TestMediumFormatLargeOffsets(t *testing.T) {
+	// past 2 GB, where an offset read as a signed 32-bit value is negative
+	const previewOffset = 0xE0000000
+	preview := testJpeg(t, 320, 240)
+
+	for _, newParser := range []func(bool) (RawParser, string){NewFffParser, NewMosParser} {
+		tt := newTestTiff(true)
+		ifd0 := tt.addIfd(0,
+			longEntry(0x0100, 8000),
+			longEntry(0x0101, 6000),
+			longEntry(0x0201, previewOffset),
+			longEntry(0x0202, uint32(len(preview))))
+		f := &sparseFile{header: tt.bytes(ifd0), blobOffset: previewOffset, blob: preview}
+
+		p, key := newParser(isHostLittleEndian())
+		dir := t.TempDir()
+		r, err := p.ProcessFile(&RawFileInfo{File: "large." + key, Reader: f, DestDir: dir, Quality: 75})
+		if err != nil {
+			t.Fatalf("Unexpected error processing %s: %v\n", key, err)
+		}
+		if r.PreviewWidth != 320 || r.PreviewHeight != 240 || r.ImageWidth != 8000 {
+			t.Errorf("Unexpected %s result: %+v\n", key, r)
+		}
+		if _, err := os.Stat(r.JpegPath); err != nil {
+			t.Errorf("Extracted %s jpeg not found: %v\n", key, err)
+		}
+	}
+}
+
+func TestLegacyProcessFile(t *testing.T) {
+	newParsers := []func(bool) (RawParser, string){NewDcrParser, NewKdcParser, NewErfParser}
+
+	for _, newParser := range newParsers {
+		p, key := newParser(isHostLittleEndian())
+		if NewFormatParser(key) == nil {
+			t.Errorf("Format %s not registered\n", key)
+		}
+		path, dir := writeTestFile(t, "test."+strings.ToLower(key), buildTestNrw(t, true))
+
+		r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75})
+		if err != nil {
+			t.Fatalf("Unexpected error processing %s: %v\n", key, err)
+		}
+		if r.PreviewWidth != 320 || r.CreateDate.IsZero() || r.ImageWidth != 4000 {
+			t.Errorf("Unexpected %s result: %+v\n", key, r)
+		}
+		if _, err := os.Stat(r.JpegPath); err != nil {
+			t.Errorf("Extracted %s jpeg not found: %v\n", key, err)
+		}
+	}
+}
+
+func TestTiffParserMultiStripPreview(t *testing.T) {
+	tt := newTestTiff(true)
+	preview := testJpeg(t, 300, 200)
+
+	// store the preview as 3 strips, out of order and separated by padding
+	third := len(preview) / 3
+	parts := [][]byte{preview[:third], preview[third : 2*third], preview[2*third:]}
+	offsets := make([]uint32, 3)
+	lengths := make([]uint32, 3)
+	for _, i := range []int{2, 0, 1} {
+		tt.addBlob([]byte{0xAA, 0xBB, 0xCC, 0xDD})
+		offsets[i] = tt.addBlob(parts[i])
+		lengths[i] = uint32(len(parts[i]))
+	}
+
+	ifd0 := tt.addIfd(0,
+		longEntry(0x00fe, 1),
+		shortEntry(0x0103, 6),
+		longEntry(0x0111, offsets...),
+		longEntry(0x0117, lengths...))
+	path, dir := writeTestFile(t, "strips.NRW", tt.bytes(ifd0))
+
+	p, _ := NewNrwParser(isHostLittleEndian())
+	r, err := p.ProcessFile(&RawFileInfo{File: path, DestDir: dir, Quality: 75})
+	if err != nil {
+		t.Fatalf("Unexpected error processing multi-strip preview: %v\n", err)
+	}
+	if r.PreviewWidth != 300 || r.PreviewHeight != 200 {
+		t.Errorf("Unexpected preview dimensions: %dx%d\n", r.PreviewWidth, r.PreviewHeight)
+	}
+}
+
+func TestProcessIntegerArray(t *testing.T) {
+	tt := newTestTiff(true)
+	ifd := tt.addIfd(0, shortEntry(0x0111, 7, 9), longEntry(0x0117, 1, 2, 3))
+	f := bytes.NewReader(tt.bytes(ifd))
+
+	entries, err := processIfd(isHostLittleEndian(), true, int64(ifd), f)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	expected := [][]uint32{{7, 9}, {1, 2, 3}}
+	i := 0
+	for e := entries.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(IfdEntry)
+		vals, err := processIntegerArray(isHostLittleEndian(), true, &entry, f)
+		if err != nil || len(vals) != len(expected[i]) {
+			t.Fatalf("Unexpected values: %v %v\n", vals, err)
+		}
+		for j := range vals {
+			if vals[j] != expected[i][j] {
+				t.Errorf("Unexpected values: %v; expected %v\n", vals, expected[i])
+			}
+		}
+		i++
+	}
+}
+
+func TestOffsetOverflow(t *testing.T) {
+	if n, err := addOffset(1, 2); n != 3 || err != nil {
+		t.Errorf("Unexpected sum: %d %v\n", n, err)
+	}
+	for _, c := range [][2]int64{{math.MaxInt64, 1}, {-1, 0}, {0, -1}} {
+		if _, err := addOffset(c[0], c[1]); !errors.Is(err, errOffsetOverflow) {
+			t.Errorf("Expected overflow adding %d + %d; got %v\n", c[0], c[1], err)
+		}
+	}
+
+	f := bytes.NewReader(make([]byte, 16))
+	if _, err := readField(-1, 4, f); !errors.Is(err, errOffsetOverflow) {
+		t.Errorf("Expected overflow reading at a negative offset; got %v\n", err)
+	}
+	entry := IfdEntry{tag: 0x0111, fieldType: 4, count: 0x40000001, offset: 8}
+	if _, err := processIntegerArray(isHostLittleEndian(), true, &entry, f); !errors.Is(err, errOffsetOverflow) {
+		t.Errorf("Expected overflow reading %d longs; got %v\n", entry.count, err)
+	}
+
+	if r := newByteRanges([]uint64{math.MaxInt64 - 1}, []uint64{2}); r != nil {
+		t.Errorf("Unexpected strips ending beyond int64: %v\n", r)
+	}
+	if r := newByteRanges([]uint64{1 << 63}, []uint64{1}); r != nil {
+		t.Errorf("Unexpected strips beyond int64: %v\n", r)
+	}
+	if _, n := stripsExtent([]byteRange{{0, math.MaxInt64}, {0, 1}}); n != 0 {
+		t.Errorf("Unexpected length of strips beyond int64: %d\n", n)
+	}
+	j := jpegInfo{offset: math.MaxInt64, length: 1}
+	if _, err := readPreview(f, &j); !errors.Is(err, errOffsetOverflow) {
+		t.Errorf("Expected overflow reading preview; got %v\n", err)
+	}
+}
@@ -25,55 +25,48 @@ package rawparser
 
 import (
 	"container/list"
+	"encoding/binary"
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"math"
+
+	"github.com/jeremytorres/rawparser/tiff"
 )
 
 // bytesToUShort is a utility function for converting bytes
 // representing an unsigned short, based on a raw file's defined
 // endianess.
-// isBigEndian is an input parameter defining the raw file endiannes.
+// isBigEndian is an input parameter defining the raw file endiannes;
+// the host's endianness does not affect the conversion and
+// isHostLittleEndian is ignored.
 // Returns an uint16 based on the raw file endianness.
 //
 // Implemenation Note: to reduce the error handling code,
 // the critical function for retrieving bytes is error checked. Therefore,
 // it's assumed the caller will supply exactly 2 bytes.
 func bytesToUShort(isHostLittleEndian, isBigEndian bool, buf []byte) uint16 {
-	var val uint16
-
-	if isBigEndian && isHostLittleEndian {
-		val = (uint16(buf[0]) << 8) | (uint16(buf[1]) & 0xFF)
-	} else {
-		val = (uint16(buf[1]) << 8) | (uint16(buf[0]) & 0xFF)
+	if isBigEndian {
+		return binary.BigEndian.Uint16(buf)
 	}
-
-	return val
+	return binary.LittleEndian.Uint16(buf)
 }
 
 // bytesToUInt is a utility function for converting bytes
 // representing an unsigned int, based on a raw file's defined
 // endianess.
-// isBigEndian is an input parameter defining the raw file endiannes.
+// isBigEndian is an input parameter defining the raw file endiannes;
+// isHostLittleEndian is ignored.
 // Returns an uint32 based on the raw file endianness.
 //
 // Implemenation Note: to reduce the error handling code,
 // the critical function for retrieving bytes is error checked. Therefore,
 // it's assumed the caller will supply exactly 4 bytes.
 func bytesToUInt(isHostLittleEndian, isBigEndian bool, buf []byte) uint32 {
-	var a, b uint16
-	var val uint32
-
-	a = bytesToUShort(isHostLittleEndian, isBigEndian, buf[0:2])
-	b = bytesToUShort(isHostLittleEndian, isBigEndian, buf[2:])
-
-	if isBigEndian && isHostLittleEndian {
-		// convert
-		val = (uint32(a)<<16 | (uint32(b) & 0xFFFF))
-	} else {
-		val = (uint32(b)<<16 | (uint32(a) & 0xFFFF))
+	if isBigEndian {
+		return binary.BigEndian.Uint32(buf)
 	}
-
-	return val
+	return binary.LittleEndian.Uint32(buf)
 }
 
 // bytesToAsciiString is a utility function for converting bytes
@@ -83,9 +76,51 @@ func bytesToASCIIString(bytes []byte) (val string) {
 	return val
 }
 
+// errOffsetOverflow is returned when an offset or size read from a raw
+// file is out of range, e.g., of a corrupt file.
+var errOffsetOverflow = errors.New("offset out of range")
+
+// addOffset adds a length, or an offset relative to a base, to an offset
+// read from a raw file.
+// Returns the sum or an error wrapping errOffsetOverflow if an operand is
+// negative or the sum exceeds int64.
+func addOffset(offset, n int64) (int64, error) {
+	if offset < 0 || n < 0 || offset > math.MaxInt64-n {
+		return 0, fmt.Errorf("%w: %d + %d", errOffsetOverflow, offset, n)
+	}
+	return offset + n, nil
+}
+
+// ifdPointer reads the offset of the IFD referenced by an entry, e.g., the
+// EXIF IFD pointer, by the field type of the entry.
+// Returns the offset or an error, wrapping errOffsetOverflow if the
+// offset exceeds int64.
+func ifdPointer(entry *IfdEntry) (int64, error) {
+	v, err := entry.Uint64()
+	if err != nil {
+		return 0, err
+	}
+	// an offset beyond int64 is negative once converted, and rejected
+	return addOffset(int64(v), 0)
+}
+
+// valueSize determines the size, in bytes, of count values of a size.
+// Returns the size or an error wrapping errOffsetOverflow if larger than
+// tiff.MaxValueSize.
+func valueSize(count, size uint32) (uint32, error) {
+	n := uint64(count) * uint64(size)
+	if n > tiff.MaxValueSize {
+		return 0, fmt.Errorf("%w: value of %d bytes", errOffsetOverflow, n)
+	}
+	return uint32(n), nil
+}
+
 // readField reads a specified number of bytes from the raw file based
 // on an offset.  Returns the bytes read or error.
-func readField(offset int64, bytesToRead uint32, f *os.File) (bytes []byte, err error) {
+func readField(offset int64, bytesToRead uint32, f io.ReaderAt) (bytes []byte, err error) {
+	if offset < 0 || bytesToRead > tiff.MaxValueSize {
+		return nil, fmt.Errorf("%w: %d bytes at %d", errOffsetOverflow, bytesToRead, offset)
+	}
 	cache := make([]byte, bytesToRead)
 
 	bytesRead, err := f.ReadAt(cache, int64(offset))
@@ -99,70 +134,74 @@ func readField(offset int64, bytesToRead uint32, f *os.File) (bytes []byte, err
 // processIfd processed a TIFF IFD, based on:
 // the parsed raw file header and a given offset witin the raw file.
 // Returns a list of processed IFDs or error.
-func processIfd(isHostLe, isFileBe bool, offset int64, f *os.File) (*list.List, error) {
-	l := list.New()
-
-	// entries
-	bytes, err := readField(offset, 2, f)
-	//	log.Printf("Bytes: %v\n", bytes)
-	entries := bytesToUShort(isHostLe, isFileBe, bytes)
-	//	log.Printf("Entries in IFD0: 0x%x\n", entries)
-	offset += 2
-
-	for i := 0; i < int(entries); i++ {
-		var entry ifdEntry
-		// tag
-		bytes, err = readField(offset, 2, f)
-		if err != nil {
-			return l, err
-		}
-		entry.tag = bytesToUShort(isHostLe, isFileBe, bytes)
-		offset += 2
+func processIfd(isHostLe, isFileBe bool, offset int64, f io.ReaderAt) (*list.List, error) {
+	l, _, err := processIfdWithNext(isHostLe, isFileBe, offset, f)
+	return l, err
+}
 
-		// type
-		bytes, err = readField(offset, 2, f)
-		if err != nil {
-			return l, err
-		}
-		entry.fieldType = bytesToUShort(isHostLe, isFileBe, bytes)
-		offset += 2
+// processIfdOf processes the TIFF IFD referenced by an entry, e.g., the
+// EXIF IFD pointer; see ifdPointer.
+// Returns a list of processed IFDs or error.
+func processIfdOf(isHostLe, isFileBe bool, entry *IfdEntry, f io.ReaderAt) (*list.List, error) {
+	offset, err := ifdPointer(entry)
+	if err != nil {
+		return list.New(), err
+	}
+	return processIfd(isHostLe, isFileBe, offset, f)
+}
 
-		// count
-		bytes, err = readField(offset, 4, f)
-		if err != nil {
-			return l, err
-		}
-		entry.count = bytesToUInt(isHostLe, isFileBe, bytes)
-		offset += 4
+// processIfdWithNext processed a TIFF IFD, based on:
+// the parsed raw file header and a given offset witin the raw file.
+// Returns a list of processed IFDs, the offset of the next IFD (0 if none) or error.
+func processIfdWithNext(isHostLe, isFileBe bool, offset int64, f io.ReaderAt) (*list.List, int64, error) {
+	ifd, err := tiff.ReadIFD(f, byteOrder(isFileBe), offset)
+	if ifd == nil {
+		return list.New(), 0, err
+	}
+	return ifdEntryList(ifd, byteOrder(isFileBe), f), ifd.Next, err
+}
 
-		// value offset
-		bytes, err = readField(offset, 4, f)
-		if err != nil {
-			return l, err
-		}
-		entry.valueOffset = bytesToUInt(isHostLe, isFileBe, bytes)
-		if err != nil {
-			return l, err
-		}
-		offset += 4
+// ifdEntryList converts the entries of an IFD read by the tiff package.
+// Values of more than 4 bytes are read at the offset of the entry,
+// including those inline in a BigTIFF entry, from f in the byte order of
+// the IFD.
+// Returns a list of IfdEntry.
+func ifdEntryList(ifd *tiff.IFD, order binary.ByteOrder, f io.ReaderAt) *list.List {
+	l := list.New()
+	for _, e := range ifd.Entries {
+		l.PushBack(IfdEntry{e.Tag, uint16(e.Type), e.Count, e.ValueOffset, e.Offset, order, f})
+	}
+	return l
+}
 
-		l.PushBack(entry)
+// uint64s widens 32-bit values, e.g., the strip offsets of a TIFF.
+// Returns the values.
+func uint64s(v []uint32) []uint64 {
+	u := make([]uint64, len(v))
+	for i := range v {
+		u[i] = uint64(v[i])
 	}
+	return u
+}
 
-	return l, err
+// byteOrder converts the endianness of a raw file to a binary.ByteOrder.
+func byteOrder(isFileBe bool) binary.ByteOrder {
+	if isFileBe {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
 }
 
 // processRationalEntry determines a TIFF-based rational entry (fractional) for
 // per a given offset and raw file header.
 // Returns a numerator, denominator, and rational (fractional) value or error.
-func processRationalEntry(isHostLe, isFileBe bool, offset uint32, f *os.File) (num, den uint32, r float64, err error) {
-	// numerator
-	bytes, err := readField(int64(offset), 4, f)
-	num = bytesToUInt(isHostLe, isFileBe, bytes)
-
-	// denominator
-	bytes, err = readField(int64(offset)+4, 4, f)
-	den = bytesToUInt(isHostLe, isFileBe, bytes)
+func processRationalEntry(isHostLe, isFileBe bool, offset int64, f io.ReaderAt) (num, den uint32, r float64, err error) {
+	bytes, err := readField(offset, 8, f)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	num = bytesToUInt(isHostLe, isFileBe, bytes[0:4])
+	den = bytesToUInt(isHostLe, isFileBe, bytes[4:8])
 
 	if den > 0 {
 		r = float64(num / den)
@@ -173,28 +212,91 @@ func processRationalEntry(isHostLe, isFileBe bool, offset uint32, f *os.File) (n
 	return num, den, r, err
 }
 
-// processAsciiEntry converts a TIFF-based ASCII entry into a string
-// per a given offset and raw file header.
-// Return a string based on the ASCII bytes.
-func processASCIIEntry(entry *ifdEntry, f *os.File) (val string, err error) {
-	bytes, err := readField(int64(entry.valueOffset), entry.count, f)
-	val = bytesToASCIIString(bytes)
+// inlineValueBytes converts a value offset back into the 4 bytes, in file
+// order, from which it was read.  Values of 4 bytes or less are stored
+// within the value offset and are left-justified.
+// Returns the 4 bytes of the value offset.
+func inlineValueBytes(isFileBe bool, val uint32) []byte {
+	bytes := make([]byte, 4)
+	if isFileBe {
+		binary.BigEndian.PutUint32(bytes, val)
+	} else {
+		binary.LittleEndian.PutUint32(bytes, val)
+	}
+	return bytes
+}
 
-	return val, err
+// losslessJpegDimensions reads the frame header (SOF3) of a lossless JPEG,
+// as used to store raw image data, beginning at offset.  JPEG markers are
+// always big endian.
+// Returns the width (samples per line times components) and height; zero if
+// the frame header is not found.
+func losslessJpegDimensions(isHostLe bool, f io.ReaderAt, offset int64) (width, height uint32) {
+	bytes, err := readField(offset, 2, f)
+	if err != nil || bytes[0] != 0xFF || bytes[1] != 0xD8 {
+		return 0, 0
+	}
+	offset += 2
+
+	// bound the marker walk; the frame header precedes the scan data
+	for i := 0; i < 32; i++ {
+		bytes, err = readField(offset, 4, f)
+		if err != nil || bytes[0] != 0xFF {
+			return 0, 0
+		}
+		marker := bytes[1]
+		length := bytesToUShort(isHostLe, true, bytes[2:4])
+
+		if marker == 0xC3 {
+			bytes, err = readField(offset+4, 6, f)
+			if err != nil {
+				return 0, 0
+			}
+			height = uint32(bytesToUShort(isHostLe, true, bytes[1:3]))
+			width = uint32(bytesToUShort(isHostLe, true, bytes[3:5])) * uint32(bytes[5])
+			return width, height
+		} else if marker == 0xDA {
+			// start of scan; no frame header found
+			return 0, 0
+		}
+
+		offset += 2 + int64(length)
+	}
+
+	return 0, 0
 }
 
-// processShortValue extracts a 16-bit (unsigned short) value from a
-// 4-bytes.  Per the TIFF spec, a tag with type 3 (unsigned short) will
-// contain a left-justified value within a 4-bytes value offset.
-// Returns an uint16.
-func processShortValue(isFileBe bool, val uint32) (r uint16) {
-	// assume big endian: msb/lsb
-	msb, lsb := (val >> 16), (val & 0x0000FFFF)
-	if isFileBe {
-		r = uint16(msb)
-	} else {
-		r = uint16(lsb)
+// processIntegerArray reads the values of an entry whose type is either
+// unsigned short (type 3) or unsigned long (type 4).  Per the TIFF spec,
+// values totalling 4 bytes or less are stored within the value offset.
+// Returns the values or error.
+func processIntegerArray(isHostLe, isFileBe bool, entry *IfdEntry, f io.ReaderAt) ([]uint32, error) {
+	size := uint32(4)
+	if entry.fieldType == 3 {
+		size = 2
+	} else if entry.fieldType != 4 {
+		return nil, fmt.Errorf("invalid integer type: %d", entry.fieldType)
+	}
+
+	n, err := valueSize(entry.count, size)
+	if err != nil {
+		return nil, err
 	}
 
-	return r
+	var bytes []byte
+	if n <= 4 {
+		bytes = inlineValueBytes(isFileBe, entry.valueOffset)
+	} else if bytes, err = readField(entry.offset, n, f); err != nil {
+		return nil, err
+	}
+
+	vals := make([]uint32, entry.count)
+	for i := range vals {
+		if size == 2 {
+			vals[i] = uint32(bytesToUShort(isHostLe, isFileBe, bytes[i*2:i*2+2]))
+		} else {
+			vals[i] = bytesToUInt(isHostLe, isFileBe, bytes[i*4:i*4+4])
+		}
+	}
+	return vals, nil
 }
@@ -0,0 +1,162 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"slices"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+// tiffWriterExcludedTags are the tags of the EXIF metadata not copied to a
+// TIFF written by EncodeTIFF, in addition to previewExcludedTags and the
+// DNG tags: they are written by EncodeTIFF.
+var tiffWriterExcludedTags = map[uint16]bool{
+	0x0112: true, // Orientation; the developed image is upright
+	0x0117: true, // StripByteCounts
+	0x8773: true, // ICCProfile
+}
+
+// EncodeTIFF writes a developed image, e.g., by DecodeRaw, as an
+// uncompressed, little endian RGB TIFF of 8 or 16-bit samples: the
+// hand-off format of editing tools.  The image is upright and in the sRGB
+// color space, whose ICC profile is embedded.  If exif is not nil, the
+// metadata of its IFD0 and EXIF, GPS, and interoperability IFDs are
+// copied, e.g., the TIFF data returned by ExifData, without the tags
+// describing the raw image data.
+// Returns error.
+func EncodeTIFF(w io.Writer, img image.Image, bitDepth int, exif []byte) error {
+	if bitDepth != 8 && bitDepth != 16 {
+		return fmt.Errorf("%w: bit depth %d", ErrRenderOptions, bitDepth)
+	}
+
+	var meta []*tiff.IFD
+	if exif != nil {
+		ifds, err := tiff.ReadAll(bytes.NewReader(exif))
+		if err != nil {
+			return fmt.Errorf("reading EXIF data: %w", err)
+		}
+		meta = ifds
+	}
+
+	rgba := convertDepth(img, bitDepth)
+	var pix []byte
+	var stride int
+	switch i := rgba.(type) {
+	case *image.RGBA:
+		pix, stride = i.Pix, i.Stride
+	case *image.RGBA64:
+		pix, stride = i.Pix, i.Stride
+	}
+	bytesPerSample := bitDepth / 8
+
+	width, height := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+	length := int64(width) * int64(height) * 3 * int64(bytesPerSample)
+
+	le := binary.LittleEndian
+	short := func(tag uint16, v ...uint16) tiff.Entry {
+		var b []byte
+		for _, s := range v {
+			b = le.AppendUint16(b, s)
+		}
+		return tiff.NewEntry(le, tag, tiff.Short, uint32(len(v)), b)
+	}
+	long := func(tag uint16, v uint32) tiff.Entry {
+		return tiff.NewEntry(le, tag, tiff.Long, 1, le.AppendUint32(nil, v))
+	}
+	bits := uint16(bitDepth)
+	icc := srgbProfile()
+	ifds := func(offset uint32) []*tiff.IFD {
+		ifd0 := &tiff.IFD{Kind: tiff.KindMain, Entries: []tiff.Entry{
+			long(0x0100, uint32(width)),
+			long(0x0101, uint32(height)),
+			short(0x0102, bits, bits, bits),
+			short(0x0103, 1), // uncompressed
+			short(0x0106, 2), // RGB
+			long(0x0111, offset),
+			short(0x0112, uint16(Horizontal)),
+			short(0x0115, 3),
+			long(0x0116, uint32(height)),
+			long(0x0117, uint32(length)),
+			short(0x011c, 1), // chunky
+			tiff.NewEntry(le, 0x8773, tiff.Undefined, uint32(len(icc)), icc),
+		}}
+		out := []*tiff.IFD{ifd0}
+		for _, ifd := range meta {
+			switch {
+			case ifd.Kind == tiff.KindMain && ifd.Index == 0:
+				for _, e := range ifd.Entries {
+					if !previewExcludedTags[e.Tag] && !isDngTag(e.Tag) && !tiffWriterExcludedTags[e.Tag] &&
+						!slices.ContainsFunc(ifd0.Entries, func(i tiff.Entry) bool { return i.Tag == e.Tag }) {
+						ifd0.Entries = append(ifd0.Entries, e)
+					}
+				}
+			case ifd.Kind == tiff.KindExif || ifd.Kind == tiff.KindGPS || ifd.Kind == tiff.KindInterop:
+				out = append(out, ifd)
+			}
+		}
+		return out
+	}
+
+	// the strip follows the IFDs, whose size does not depend on its offset
+	header, err := tiff.Encode(le, ifds(0))
+	if err != nil {
+		return err
+	}
+	if header, err = tiff.Encode(le, ifds(uint32(len(header)))); err != nil {
+		return err
+	}
+	if int64(len(header))+length > math.MaxUint32 {
+		return fmt.Errorf("tiff: image of %d bytes exceeds 4 GiB", int64(len(header))+length)
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	row := make([]byte, 0, width*3*bytesPerSample)
+	for y := 0; y < height; y++ {
+		row = row[:0]
+		p := pix[y*stride : y*stride+width*4*bytesPerSample]
+		for x := 0; x < len(p); x += 4 * bytesPerSample {
+			if bytesPerSample == 1 {
+				row = append(row, p[x], p[x+1], p[x+2])
+				continue
+			}
+			// RGBA64 samples are big endian
+			for c := 0; c < 6; c += 2 {
+				row = append(row, p[x+c+1], p[x+c])
+			}
+		}
+		if _, err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jeremytorres/rawparser/tiff"
+)
+
+var (
+	// ErrUpdateUnsupported is returned when a raw file cannot be updated:
+	// its format is not supported or the tags to update cannot be
+	// rewritten in place.
+	ErrUpdateUnsupported = errors.New("raw file update not supported")
+
+	// ErrUpdateVerification is returned when the updated raw file does not
+	// read back as expected; the raw file is left unchanged.
+	ErrUpdateVerification = errors.New("raw file update verification failed")
+)
+
+// exifDateLayout is the layout of the EXIF date/time tags.
+const exifDateLayout = "2006:01:02 15:04:05"
+
+// TagUpdate is a struct defining the tags rewritten by UpdateTags.  The
+// zero value of a field leaves the tags unchanged.
+type TagUpdate struct {
+	// Orientation replaces the Orientation of the IFDs recording one.
+	Orientation Orientation
+
+	// CreateDate replaces the DateTime, DateTimeOriginal, and
+	// DateTimeDigitized, formatted in the location of CreateDate.  The
+	// EXIF offset time and sub-second tags are unchanged.
+	CreateDate time.Time
+
+	// DateShift is added to the DateTime, DateTimeOriginal, and
+	// DateTimeDigitized, e.g., to fix the camera clock of a shoot.  It may
+	// not be combined with CreateDate.
+	DateShift time.Duration
+}
+
+// tagPatch is a value of an IFD entry rewritten in place.
+type tagPatch struct {
+	tag    uint16
+	offset int64
+	data   []byte
+}
+
+// UpdateTags rewrites the Orientation and the date/time tags of a NEF or
+// CR2 file in place: the values are replaced without moving any other data
+// of the file, which is otherwise unchanged.  The raw file is copied to a
+// temporary file in its directory, which is updated, verified, and renamed
+// over the raw file; the raw file is unchanged if any step fails.  The
+// embedded previews, and the maker notes, retain their own metadata.
+// Returns nil on success, an error wrapping ErrUpdateUnsupported or
+// ErrUpdateVerification, or error.
+func UpdateTags(name string, u TagUpdate) error {
+	switch strings.ToUpper(filepath.Ext(name)) {
+	case ".NEF", ".CR2":
+	default:
+		return fmt.Errorf("%w: %s", ErrUpdateUnsupported, name)
+	}
+	if u.Orientation != 0 && orientationOf(uint16(u.Orientation)) != u.Orientation {
+		return fmt.Errorf("%w: invalid orientation %d", ErrUpdateUnsupported, u.Orientation)
+	}
+	if !u.CreateDate.IsZero() && u.DateShift != 0 {
+		return fmt.Errorf("%w: both CreateDate and DateShift set", ErrUpdateUnsupported)
+	}
+
+	// rename replaces a symbolic link rather than its target
+	name, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	patches, err := planTagUpdate(src, &u)
+	if err != nil {
+		return err
+	}
+
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	err = writeUpdated(tmp, src, fi, patches)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = verifyUpdate(tmpName, filepath.Ext(name), patches, &u)
+	}
+	if err == nil {
+		err = os.Rename(tmpName, name)
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	log.Printf("Updated %d tags of %s\n", len(patches), name)
+	return nil
+}
+
+// planTagUpdate locates the entries of the tags to update within the IFDs
+// of a raw file and encodes their new values.  Dates are rewritten only if
+// the new value has the size of the recorded one.
+// Returns the patches or error.
+func planTagUpdate(f io.ReaderAt, u *TagUpdate) ([]tagPatch, error) {
+	h, err := tiff.ReadHeader(f)
+	if err != nil {
+		return nil, err
+	}
+	updateDates := !u.CreateDate.IsZero() || u.DateShift != 0
+
+	var patches []tagPatch
+	err = tiff.WalkIFDs(f, h, func(ifd *tiff.IFD) error {
+		for i := range ifd.Entries {
+			e := &ifd.Entries[i]
+			switch {
+			case e.Tag == 0x0112 && u.Orientation != 0 && (ifd.Kind == tiff.KindMain || ifd.Kind == tiff.KindSub):
+				if e.Type != tiff.Short || e.Count != 1 {
+					return fmt.Errorf("%w: Orientation of type %s", ErrUpdateUnsupported, e.Type)
+				}
+				data := make([]byte, 2)
+				h.ByteOrder.PutUint16(data, uint16(u.Orientation))
+				patches = append(patches, tagPatch{e.Tag, e.Offset, data})
+			case updateDates && isUpdatedDate(ifd.Kind, e.Tag):
+				p, err := datePatch(e, u)
+				if err != nil {
+					return err
+				}
+				patches = append(patches, p)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("%w: no tags to update", ErrUpdateUnsupported)
+	}
+	return patches, nil
+}
+
+// isUpdatedDate determines if an entry is a date/time tag rewritten by
+// UpdateTags: the DateTime of IFD0 and the DateTimeOriginal and
+// DateTimeDigitized of the EXIF IFD.
+// Returns true if the entry is updated; false otherwise.
+func isUpdatedDate(kind tiff.Kind, tag uint16) bool {
+	switch kind {
+	case tiff.KindMain:
+		return tag == 0x0132
+	case tiff.KindExif:
+		return tag == 0x9003 || tag == 0x9004
+	}
+	return false
+}
+
+// datePatch encodes the new value of a date/time entry.
+// Returns the patch or error.
+func datePatch(e *tiff.Entry, u *TagUpdate) (tagPatch, error) {
+	if e.Type != tiff.ASCII || e.Inline() {
+		return tagPatch{}, fmt.Errorf("%w: tag 0x%04x of type %s", ErrUpdateUnsupported, e.Tag, e.Type)
+	}
+	old, err := e.ASCII()
+	if err != nil {
+		return tagPatch{}, err
+	}
+
+	t := u.CreateDate
+	if t.IsZero() {
+		if t, err = time.Parse(exifDateLayout, old); err != nil {
+			return tagPatch{}, fmt.Errorf("%w: tag 0x%04x: %w", ErrUpdateUnsupported, e.Tag, err)
+		}
+		t = t.Add(u.DateShift)
+	}
+
+	data := append([]byte(t.Format(exifDateLayout)), 0)
+	if int64(len(data)) != e.Size() {
+		return tagPatch{}, fmt.Errorf("%w: tag 0x%04x of %d bytes", ErrUpdateUnsupported, e.Tag, e.Size())
+	}
+	return tagPatch{e.Tag, e.Offset, data}, nil
+}
+
+// writeUpdated copies a raw file to a temporary file, applies the patches,
+// and syncs it.  The permissions of the raw file are retained.
+// Returns nil on success or error.
+func writeUpdated(tmp *os.File, src *os.File, fi os.FileInfo, patches []tagPatch) error {
+	if _, err := io.Copy(tmp, io.NewSectionReader(src, 0, fi.Size())); err != nil {
+		return err
+	}
+	for _, p := range patches {
+		if _, err := tmp.WriteAt(p.data, p.offset); err != nil {
+			return err
+		}
+	}
+	if err := tmp.Chmod(fi.Mode().Perm()); err != nil {
+		return err
+	}
+	return tmp.Sync()
+}
+
+// verifyUpdate reads back the patched values of an updated raw file and
+// parses it, verifying the Orientation and the dates.
+// Returns nil or an error wrapping ErrUpdateVerification.
+func verifyUpdate(name, ext string, patches []tagPatch, u *TagUpdate) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, p := range patches {
+		data := make([]byte, len(p.data))
+		if _, err := f.ReadAt(data, p.offset); err != nil || !bytes.Equal(data, p.data) {
+			return fmt.Errorf("%w: tag 0x%04x at %d", ErrUpdateVerification, p.tag, p.offset)
+		}
+	}
+
+	p := NewFormatParser(ext)
+	if p == nil {
+		return fmt.Errorf("%w: %w: %s", ErrUpdateVerification, ErrUnknownFormat, ext)
+	}
+	r, err := p.ProcessFile(&RawFileInfo{File: name, Handle: f, SkipExtraction: true, Lenient: true})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdateVerification, err)
+	}
+	if u.Orientation != 0 && r.Orientation != u.Orientation {
+		return fmt.Errorf("%w: orientation %s; expected %s", ErrUpdateVerification, r.Orientation, u.Orientation)
+	}
+	if want := u.CreateDate.Format(exifDateLayout); !u.CreateDate.IsZero() && r.CreateDate.Format(exifDateLayout) != want {
+		return fmt.Errorf("%w: create date %s; expected %s", ErrUpdateVerification, r.CreateDate.Format(exifDateLayout), want)
+	}
+	return nil
+}
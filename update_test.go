@@ -0,0 +1,139 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// copyTestFile copies a raw file into a temporary directory.
+// Returns the path of the copy.
+func copyTestFile(t *testing.T, name string) string {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("Error reading %s: %v\n", name, err)
+	}
+	path, _ := writeTestFile(t, filepath.Base(name), data)
+	return path
+}
+
+func TestUpdateTags(t *testing.T) {
+	for _, name := range []string{TestNefFile, TestCR2File} {
+		path := copyTestFile(t, name)
+		p := NewFormatParser(filepath.Ext(path))
+		before, err := p.ProcessFile(&RawFileInfo{File: path, SkipExtraction: true})
+		if err != nil {
+			t.Fatalf("Unexpected error parsing %s: %v\n", name, err)
+		}
+		orig, _ := os.ReadFile(path)
+
+		if err := UpdateTags(path, TagUpdate{Orientation: Rotate90, DateShift: -90 * time.Minute}); err != nil {
+			t.Fatalf("Unexpected error updating %s: %v\n", name, err)
+		}
+		after, err := p.ProcessFile(&RawFileInfo{File: path, SkipExtraction: true})
+		if err != nil {
+			t.Fatalf("Unexpected error parsing updated %s: %v\n", name, err)
+		}
+		if after.Orientation != Rotate90 {
+			t.Errorf("Unexpected orientation of %s: %s\n", name, after.Orientation)
+		}
+		if d := before.CreateDate.Sub(after.CreateDate); d != 90*time.Minute {
+			t.Errorf("Unexpected create date of %s: %v; shifted by %v\n", name, after.CreateDate, d)
+		}
+
+		updated, _ := os.ReadFile(path)
+		if len(updated) != len(orig) {
+			t.Fatalf("Unexpected size of %s: %d; expected %d\n", name, len(updated), len(orig))
+		}
+		changed := 0
+		for i := range orig {
+			if orig[i] != updated[i] {
+				changed++
+			}
+		}
+		// the orientation and at most three dates
+		if changed == 0 || changed > 2+3*19 {
+			t.Errorf("Unexpected number of bytes changed in %s: %d\n", name, changed)
+		}
+		if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".*.tmp")); len(matches) > 0 {
+			t.Errorf("Temporary files left: %v\n", matches)
+		}
+	}
+}
+
+func TestUpdateTagsCreateDate(t *testing.T) {
+	path := copyTestFile(t, TestCR2File)
+	link := filepath.Join(t.TempDir(), "link.CR2")
+	if err := os.Symlink(path, link); err != nil {
+		t.Skipf("Symbolic links not supported: %v\n", err)
+	}
+
+	date := time.Date(2024, time.March, 7, 8, 9, 10, 0, time.UTC)
+	if err := UpdateTags(link, TagUpdate{CreateDate: date}); err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Symbolic link replaced: %v\n", err)
+	}
+	p, _ := NewCr2Parser(isHostLittleEndian())
+	r, err := p.ProcessFile(&RawFileInfo{File: path, SkipExtraction: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if got := r.CreateDate.Format(exifDateLayout); got != "2024:03:07 08:09:10" {
+		t.Errorf("Unexpected create date: %s\n", got)
+	}
+}
+
+func TestUpdateTagsUnsupported(t *testing.T) {
+	path := copyTestFile(t, TestNefFile)
+	orig, _ := os.ReadFile(path)
+
+	tests := []struct {
+		name string
+		u    TagUpdate
+	}{
+		{"orientation", TagUpdate{Orientation: 9}},
+		{"dates", TagUpdate{CreateDate: time.Now(), DateShift: time.Hour}},
+		{"nothing", TagUpdate{}},
+		{"year", TagUpdate{CreateDate: time.Date(12345, time.January, 1, 0, 0, 0, 0, time.UTC)}},
+	}
+	for _, tc := range tests {
+		if err := UpdateTags(path, tc.u); !errors.Is(err, ErrUpdateUnsupported) {
+			t.Errorf("Expected ErrUpdateUnsupported for %s; got %v\n", tc.name, err)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != string(orig) {
+		t.Errorf("Raw file changed by failed updates\n")
+	}
+
+	other, _ := writeTestFile(t, "photo.DNG", orig)
+	if err := UpdateTags(other, TagUpdate{Orientation: Rotate90}); !errors.Is(err, ErrUpdateUnsupported) {
+		t.Errorf("Expected ErrUpdateUnsupported for DNG; got %v\n", err)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+)
+
+// DefaultQuality is the JPEG quality of extracted previews if
+// RawFileInfo.Quality is 0.
+const DefaultQuality = 85
+
+// ErrInvalidInfo is returned when a RawFileInfo does not describe a raw
+// file to process; see RawFileInfo.Validate.
+var ErrInvalidInfo = errors.New("invalid RawFileInfo")
+
+// Validate verifies that a RawFileInfo describes a raw file to process:
+// one of File, Handle, or Reader is set, Quality is 0 (DefaultQuality),
+// from 1 to 100, or QualityAuto, and the enumerations are defined.
+// Validate is called by ProcessFile.
+// Returns nil or an error wrapping ErrInvalidInfo.
+func (info *RawFileInfo) Validate() error {
+	if info == nil {
+		return fmt.Errorf("%w: nil", ErrInvalidInfo)
+	}
+
+	var errs []error
+	if info.File == "" && info.Handle == nil && info.Reader == nil {
+		errs = append(errs, fmt.Errorf("%w: no File, Handle, or Reader", ErrInvalidInfo))
+	}
+	if q := info.Quality; q != QualityAuto && (q < 0 || q > 100) {
+		errs = append(errs, fmt.Errorf("%w: Quality %d not from 1 to 100 or QualityAuto", ErrInvalidInfo, q))
+	}
+	if info.Size < 0 {
+		errs = append(errs, fmt.Errorf("%w: negative Size %d", ErrInvalidInfo, info.Size))
+	}
+	if info.MaxPreviewMemory < 0 {
+		errs = append(errs, fmt.Errorf("%w: negative MaxPreviewMemory %d", ErrInvalidInfo, info.MaxPreviewMemory))
+	}
+	switch info.Jpeg.Subsampling {
+	case Subsampling420, Subsampling444:
+	default:
+		errs = append(errs, fmt.Errorf("%w: undefined %s", ErrInvalidInfo, info.Jpeg.Subsampling))
+	}
+	switch info.DatePolicy {
+	case DateAccept, DateFlag, DateReplaceWithModTime:
+	default:
+		errs = append(errs, fmt.Errorf("%w: undefined DatePolicy %d", ErrInvalidInfo, info.DatePolicy))
+	}
+	return errors.Join(errs...)
+}
+
+// withDefaults validates a RawFileInfo and applies the defaults of the
+// fields not set: Quality is DefaultQuality and DestDir the directory of
+// File, unless read by Reader.  The RawFileInfo is not modified.
+// Returns a copy of the RawFileInfo with the defaults or error.
+func (info *RawFileInfo) withDefaults() (*RawFileInfo, error) {
+	if err := info.Validate(); err != nil {
+		log.Printf("Error: %v\n", err)
+		return nil, err
+	}
+
+	i := info.withDefaultQuality()
+	if i.DestDir == "" && i.File != "" && i.Reader == nil {
+		i.DestDir = filepath.Dir(i.File)
+	}
+	return i, nil
+}
+
+// withDefaultQuality applies DefaultQuality if Quality is 0, e.g., to
+// extract the preview of a parsed raw file as ProcessFile would.  The
+// RawFileInfo is not modified.
+// Returns a copy of the RawFileInfo.
+func (info *RawFileInfo) withDefaultQuality() *RawFileInfo {
+	i := *info
+	if i.Quality == 0 {
+		i.Quality = DefaultQuality
+	}
+	return &i
+}
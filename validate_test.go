@@ -0,0 +1,96 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestRawFileInfoValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		info  *RawFileInfo
+		valid bool
+	}{
+		{"file", &RawFileInfo{File: "a.NEF"}, true},
+		{"reader", &RawFileInfo{Reader: bytes.NewReader(nil), Quality: QualityAuto}, true},
+		{"quality", &RawFileInfo{File: "a.NEF", Quality: 100}, true},
+		{"nil", nil, false},
+		{"no file", &RawFileInfo{Quality: 85}, false},
+		{"quality too high", &RawFileInfo{File: "a.NEF", Quality: 101}, false},
+		{"quality negative", &RawFileInfo{File: "a.NEF", Quality: -2}, false},
+		{"size", &RawFileInfo{Reader: bytes.NewReader(nil), Size: -1}, false},
+		{"preview memory", &RawFileInfo{File: "a.NEF", MaxPreviewMemory: -1}, false},
+		{"subsampling", &RawFileInfo{File: "a.NEF", Jpeg: JpegOptions{Subsampling: 7}}, false},
+		{"date policy", &RawFileInfo{File: "a.NEF", DatePolicy: 9}, false},
+	}
+	for _, tc := range tests {
+		err := tc.info.Validate()
+		if tc.valid && err != nil {
+			t.Errorf("Unexpected error validating %s: %v\n", tc.name, err)
+		}
+		if !tc.valid && !errors.Is(err, ErrInvalidInfo) {
+			t.Errorf("Expected ErrInvalidInfo validating %s; got %v\n", tc.name, err)
+		}
+	}
+}
+
+func TestRawFileInfoDefaults(t *testing.T) {
+	info := &RawFileInfo{File: filepath.Join("photos", "a.NEF")}
+	i, err := info.withDefaults()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if i.Quality != DefaultQuality || i.DestDir != "photos" {
+		t.Errorf("Unexpected defaults: %+v\n", i)
+	}
+	if info.Quality != 0 || info.DestDir != "" {
+		t.Errorf("RawFileInfo modified: %+v\n", info)
+	}
+
+	i, _ = (&RawFileInfo{File: "bucket/a.NEF", Reader: bytes.NewReader(nil), Quality: 50}).withDefaults()
+	if i.Quality != 50 || i.DestDir != "" {
+		t.Errorf("Unexpected defaults of a Reader: %+v\n", i)
+	}
+}
+
+func TestProcessFileDefaults(t *testing.T) {
+	path, dir := writeTestFile(t, "defaults.NRW", buildTestNrw(t, true))
+	p, _ := NewNrwParser(isHostLittleEndian())
+
+	r, err := p.ProcessFile(&RawFileInfo{File: path})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if want := filepath.Join(dir, "defaults.NRW_extracted.jpg"); r.JpegPath != want {
+		t.Errorf("Unexpected jpeg path: %s; expected %s\n", r.JpegPath, want)
+	}
+
+	if _, err := p.ProcessFile(&RawFileInfo{File: path, Quality: 200}); !errors.Is(err, ErrInvalidInfo) {
+		t.Errorf("Expected ErrInvalidInfo; got %v\n", err)
+	}
+}
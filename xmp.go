@@ -0,0 +1,175 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxXmpSize is the largest embedded XMP packet, in bytes, that is parsed.
+const maxXmpSize = 1 << 20
+
+// XMP namespaces of the properties read from the embedded XMP packet.
+const (
+	nsXmp = "http://ns.adobe.com/xap/1.0/"
+	nsDc  = "http://purl.org/dc/elements/1.1/"
+	nsRdf = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+)
+
+// xmpInfo is a struct representing the culling properties of an XMP
+// packet: xmp:Rating, xmp:Label and the keywords of dc:subject.
+type xmpInfo struct {
+	rating    int
+	hasRating bool
+	label     string
+	keywords  []string
+}
+
+// ratingInfo is a struct representing the rating tags of IFD0.
+type ratingInfo struct {
+	xmp       *xmpInfo
+	rating    int // Rating tag
+	hasRating bool
+}
+
+// processRatingEntry records the XMP packet and the Rating of IFD0.
+// Errors are not fatal as the entries are optional.
+func processRatingEntry(entry *IfdEntry, m *rawMetadata) {
+	switch entry.tag {
+	case 0x02bc: // XMP
+		if entry.count == 0 || entry.count > maxXmpSize {
+			return
+		}
+		data, err := entry.value(entry.count, 1)
+		if err == nil {
+			m.ratings.xmp, err = parseXmp(data)
+		}
+		if err != nil {
+			log.Printf("Error reading XMP packet: %v\n", err)
+		}
+	case 0x4746: // Rating
+		if v, err := entry.Uint16(); err == nil {
+			m.ratings.rating = int(int16(v))
+			m.ratings.hasRating = true
+		}
+	}
+}
+
+// parseXmp reads the rating, label, and keywords of an XMP packet.  The
+// properties may be attributes of rdf:Description or elements.
+// Returns the properties read before any error, and error.
+func parseXmp(data []byte) (*xmpInfo, error) {
+	x := new(xmpInfo)
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var elements []xml.Name
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return x, nil
+		}
+		if err != nil {
+			return x, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space == nsRdf && t.Name.Local == "Description" {
+				for _, a := range t.Attr {
+					x.set(a.Name, a.Value)
+				}
+			}
+			elements = append(elements, t.Name)
+		case xml.EndElement:
+			if len(elements) > 0 {
+				elements = elements[:len(elements)-1]
+			}
+		case xml.CharData:
+			value := strings.TrimSpace(string(t))
+			if value == "" || len(elements) == 0 {
+				continue
+			}
+			name := elements[len(elements)-1]
+			if name.Space == nsRdf && name.Local == "li" && inSubject(elements) {
+				x.keywords = append(x.keywords, value)
+			} else {
+				x.set(name, value)
+			}
+		}
+	}
+}
+
+// set records an XMP property if it is xmp:Rating or xmp:Label.
+func (x *xmpInfo) set(name xml.Name, value string) {
+	if name.Space != nsXmp {
+		return
+	}
+	switch name.Local {
+	case "Rating":
+		// e.g., "3" or "3.0"
+		if r, err := strconv.ParseFloat(value, 64); err == nil {
+			x.rating, x.hasRating = clampRating(int(math.Round(r))), true
+		}
+	case "Label":
+		x.label = value
+	}
+}
+
+// inSubject determines if an element is within dc:subject.
+// Returns true if within dc:subject; false otherwise.
+func inSubject(elements []xml.Name) bool {
+	for _, name := range elements {
+		if name.Space == nsDc && name.Local == "subject" {
+			return true
+		}
+	}
+	return false
+}
+
+// clampRating limits a rating to -1 (rejected) to 5 stars.
+func clampRating(r int) int {
+	return min(max(r, -1), 5)
+}
+
+// resolve selects the rating of the XMP packet, written by the last
+// software to rate the raw file, over the Rating tag.
+// Returns the rating, label, and keywords.
+func (r *ratingInfo) resolve() (rating int, label string, keywords []string) {
+	if r.hasRating {
+		rating = clampRating(r.rating)
+	}
+	if x := r.xmp; x != nil {
+		if x.hasRating {
+			rating = x.rating
+		}
+		label, keywords = x.label, x.keywords
+	}
+	return rating, label, keywords
+}
@@ -0,0 +1,120 @@
+/*
+ Copyright (c) 2013 Jeremy Torres, https://github.com/jeremytorres/rawparser
+
+ Permission is hereby granted, free of charge, to any person obtaining
+ a copy of this software and associated documentation files (the
+ "Software"), to deal in the Software without restriction, including
+ without limitation the rights to use, copy, modify, merge, publish,
+ distribute, sublicense, and/or sell copies of the Software, and to
+ permit persons to whom the Software is furnished to do so, subject to
+ the following conditions:
+
+ The above copyright notice and this permission notice shall be
+ included in all copies or substantial portions of the Software.
+
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+ LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+ WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package rawparser
+
+import (
+	"slices"
+	"testing"
+)
+
+const testXmp = `<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/" xmp:Rating="4">
+   <xmp:Label>Red</xmp:Label>
+   <dc:subject>
+    <rdf:Bag>
+     <rdf:li>birds</rdf:li>
+     <rdf:li>heron &amp; egret</rdf:li>
+    </rdf:Bag>
+   </dc:subject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+func TestParseXmp(t *testing.T) {
+	x, err := parseXmp([]byte(testXmp))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if !x.hasRating || x.rating != 4 || x.label != "Red" {
+		t.Errorf("Unexpected rating and label: %+v\n", x)
+	}
+	if !slices.Equal(x.keywords, []string{"birds", "heron & egret"}) {
+		t.Errorf("Unexpected keywords: %q\n", x.keywords)
+	}
+
+	tests := []struct {
+		xmp    string
+		rating int
+	}{
+		{`<rdf:Description xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:Rating="-1"/>`, -1},
+		{`<rdf:Description xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:xmp="http://ns.adobe.com/xap/1.0/"><xmp:Rating>3.0</xmp:Rating></rdf:Description>`, 3},
+		{`<rdf:Description xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:Rating="9"/>`, 5},
+	}
+	for _, tc := range tests {
+		x, err := parseXmp([]byte(tc.xmp))
+		if err != nil || !x.hasRating || x.rating != tc.rating {
+			t.Errorf("Unexpected rating of %s: %+v, %v; expected %d\n", tc.xmp, x, err, tc.rating)
+		}
+	}
+
+	if _, err := parseXmp([]byte("<x:xmpmeta><unterminated")); err == nil {
+		t.Errorf("Expected error parsing malformed XMP\n")
+	}
+}
+
+func TestProcessFileRating(t *testing.T) {
+	p, _ := NewNrwParser(isHostLittleEndian())
+
+	tests := []struct {
+		name     string
+		entries  []testEntry
+		rating   int
+		label    string
+		keywords []string
+	}{
+		{"none", nil, 0, "", nil},
+		{"tag", []testEntry{shortEntry(0x4746, 2)}, 2, "", nil},
+		{"xmp", []testEntry{
+			shortEntry(0x4746, 2),
+			{tag: 0x02bc, fieldType: 1, raw: []byte(testXmp)},
+		}, 4, "Red", []string{"birds", "heron & egret"}},
+	}
+	for _, tc := range tests {
+		tt := newTestTiff(false)
+		preview := testJpeg(t, 160, 120)
+		previewOffset := tt.addBlob(preview)
+		entries := append([]testEntry{
+			asciiEntry(0x010f, "NIKON CORPORATION"),
+			asciiEntry(0x0110, "NIKON P7000"),
+			longEntry(0x0201, previewOffset),
+			longEntry(0x0202, uint32(len(preview))),
+		}, tc.entries...)
+		path, _ := writeTestFile(t, "rating.NRW", tt.bytes(tt.addIfd(0, entries...)))
+
+		r, err := p.ProcessFile(&RawFileInfo{File: path, SkipExtraction: true, Lenient: true})
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v\n", tc.name, err)
+		}
+		if r.Rating != tc.rating || r.Label != tc.label || !slices.Equal(r.Keywords, tc.keywords) {
+			t.Errorf("Unexpected rating for %s: %d %q %q\n", tc.name, r.Rating, r.Label, r.Keywords)
+		}
+		if r.TagStats.Unknown != 0 {
+			t.Errorf("Unexpected unknown tags for %s: %+v\n", tc.name, r.TagStats)
+		}
+	}
+}